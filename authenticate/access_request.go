@@ -0,0 +1,127 @@
+package authenticate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pomerium/csrf"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/accessrequest"
+	"github.com/pomerium/pomerium/internal/frontend"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+const accessRequestPath = "/.pomerium/access_request"
+
+// accessRequest shows users who were denied access to a route a form to request it, and records their request
+// in the databroker for approvers.
+func (a *Authenticate) accessRequest(w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(r.Context(), "authenticate.accessRequest")
+	defer span.End()
+
+	requestURL, err := urlutil.ParseAndValidateURL(r.FormValue(urlutil.QueryRedirectURI))
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+	policy := getAccessRequestPolicy(a.options.Load(), requestURL)
+	if policy == nil {
+		return httputil.NewError(http.StatusNotFound, errors.New("route does not accept access requests"))
+	}
+
+	input := map[string]interface{}{
+		"csrfField":   csrf.TemplateField(r),
+		"RequestPath": accessRequestPath,
+		"RedirectURL": requestURL.String(),
+		"Route":       requestURL.Hostname(),
+		"Result":      "",
+	}
+	render := func(status int) error {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(status)
+		return frontend.Templates().ExecuteTemplate(w, "access_request.html", input)
+	}
+
+	if r.Method != http.MethodPost {
+		return render(http.StatusOK)
+	}
+
+	ar, err := a.newAccessRequest(ctx, requestURL.Hostname(), r.FormValue("reason"))
+	if err != nil {
+		return err
+	}
+	if err := a.putAccessRequest(ctx, ar); err != nil {
+		return err
+	}
+	// the request is recorded even if approvers can't be notified, so it can still be found with the admin API
+	if err := accessrequest.Notify(ctx, a.options.Load().SMTP, policy.AccessRequests, ar); err != nil {
+		log.Error(ctx).Err(err).Str("route", ar.Route).Msg("authenticate: error notifying access request approvers")
+	}
+
+	input["Result"] = "requested"
+	return render(http.StatusOK)
+}
+
+// getAccessRequestPolicy returns the route for the URL if it accepts access requests.
+func getAccessRequestPolicy(options *config.Options, requestURL *url.URL) *config.Policy {
+	for _, p := range options.GetAllPolicies() {
+		p := p
+		if p.AccessRequests != nil && p.Source != nil && p.Source.Hostname() == requestURL.Hostname() {
+			return &p
+		}
+	}
+	return nil
+}
+
+func (a *Authenticate) newAccessRequest(ctx context.Context, route, reason string) (*accessrequest.AccessRequest, error) {
+	state := a.state.Load()
+
+	s, err := a.getSessionFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pbSession, err := session.Get(ctx, state.dataBrokerClient, s.ID)
+	if err != nil {
+		return nil, httputil.NewError(http.StatusUnauthorized, err)
+	}
+
+	// access is granted to the impersonated user, since that's who authorize evaluates
+	userID := pbSession.GetUserId()
+	if pbSession.GetImpersonateUserId() != "" {
+		userID = pbSession.GetImpersonateUserId()
+	}
+	email := pbSession.GetImpersonateEmail()
+	if email == "" {
+		if pbUser, err := user.Get(ctx, state.dataBrokerClient, userID); err == nil {
+			email = pbUser.GetEmail()
+		}
+	}
+
+	return &accessrequest.AccessRequest{
+		ID:        accessrequest.ID(userID, route),
+		UserID:    userID,
+		Email:     email,
+		Route:     route,
+		Reason:    reason,
+		Status:    accessrequest.StatusPending,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+func (a *Authenticate) putAccessRequest(ctx context.Context, ar *accessrequest.AccessRequest) error {
+	record, err := ar.ToRecord()
+	if err != nil {
+		return err
+	}
+	_, err = a.state.Load().dataBrokerClient.Put(ctx, &databroker.PutRequest{Record: record})
+	return err
+}
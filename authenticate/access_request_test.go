@@ -0,0 +1,127 @@
+package authenticate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/accessrequest"
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestAuthenticate_accessRequest(t *testing.T) {
+	t.Parallel()
+
+	signer, err := jws.NewHS256Signer(nil)
+	require.NoError(t, err)
+
+	records := map[string]*databroker.Record{}
+	for id, msg := range map[string]proto.Message{
+		"SESSION_ID": &session.Session{Id: "SESSION_ID", UserId: "USER_ID"},
+		"USER_ID":    &user.User{Id: "USER_ID", Email: "user@example.com"},
+	} {
+		data, err := anypb.New(msg)
+		require.NoError(t, err)
+		records[id] = &databroker.Record{Id: id, Data: data}
+	}
+
+	o := config.NewAtomicOptions()
+	o.Store(&config.Options{
+		Policies: []config.Policy{
+			{
+				Source:         &config.StringURL{URL: mustParseURL("https://from.example.com")},
+				AccessRequests: &config.AccessRequests{},
+			},
+			{
+				Source: &config.StringURL{URL: mustParseURL("https://other.example.com")},
+			},
+		},
+	})
+	a := &Authenticate{
+		options: o,
+		state: newAtomicAuthenticateState(&authenticateState{
+			redirectURL:   mustParseURL("https://authenticate.example.com/oauth2/callback"),
+			cookieSecret:  cryptutil.NewKey(),
+			sharedEncoder: signer,
+			dataBrokerClient: mockDataBrokerServiceClient{
+				get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+					record, ok := records[in.GetId()]
+					if !ok {
+						return nil, status.Error(codes.NotFound, "not found")
+					}
+					return &databroker.GetResponse{Record: record}, nil
+				},
+				put: func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error) {
+					records[in.GetRecord().GetId()] = in.GetRecord()
+					return &databroker.PutResponse{Record: in.GetRecord()}, nil
+				},
+			},
+		}),
+	}
+
+	request := func(t *testing.T, method string, form url.Values) (*httptest.ResponseRecorder, error) {
+		jwt, err := signer.Marshal(&sessions.State{ID: "SESSION_ID", Subject: "USER_ID"})
+		require.NoError(t, err)
+
+		var r *http.Request
+		if method == http.MethodGet {
+			r = httptest.NewRequest(method, accessRequestPath+"?"+form.Encode(), nil)
+		} else {
+			r = httptest.NewRequest(method, accessRequestPath, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		r = r.WithContext(sessions.NewContext(r.Context(), string(jwt), nil))
+		w := httptest.NewRecorder()
+		return w, a.accessRequest(w, r)
+	}
+
+	t.Run("form", func(t *testing.T) {
+		w, err := request(t, http.MethodGet, url.Values{"pomerium_redirect_uri": {"https://from.example.com/some/path"}})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Request access to from.example.com")
+	})
+	t.Run("request", func(t *testing.T) {
+		w, err := request(t, http.MethodPost, url.Values{
+			"pomerium_redirect_uri": {"https://from.example.com/some/path"},
+			"reason":                {"on call"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "has been sent to its approvers")
+
+		record, ok := records[accessrequest.ID("USER_ID", "from.example.com")]
+		require.True(t, ok)
+		ar, err := accessrequest.FromRecord(record)
+		require.NoError(t, err)
+		assert.Equal(t, "USER_ID", ar.UserID)
+		assert.Equal(t, "user@example.com", ar.Email)
+		assert.Equal(t, "from.example.com", ar.Route)
+		assert.Equal(t, "on call", ar.Reason)
+		assert.Equal(t, accessrequest.StatusPending, ar.Status)
+	})
+	t.Run("route without access requests", func(t *testing.T) {
+		_, err := request(t, http.MethodPost, url.Values{"pomerium_redirect_uri": {"https://other.example.com"}})
+		var httpErr *httputil.HTTPError
+		require.ErrorAs(t, err, &httpErr)
+		assert.Equal(t, http.StatusNotFound, httpErr.Status)
+	})
+}
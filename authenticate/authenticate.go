@@ -6,10 +6,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"html/template"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
 
 	"github.com/pomerium/pomerium/config"
-	"github.com/pomerium/pomerium/internal/frontend"
 	"github.com/pomerium/pomerium/internal/identity"
 	"github.com/pomerium/pomerium/internal/identity/oauth"
 	"github.com/pomerium/pomerium/internal/log"
@@ -50,20 +51,21 @@ func ValidateOptions(o *config.Options) error {
 
 // Authenticate contains data required to run the authenticate service.
 type Authenticate struct {
-	templates *template.Template
-
 	options  *config.AtomicOptions
 	provider *identity.AtomicAuthenticator
 	state    *atomicAuthenticateState
+
+	signInThrottle *signInThrottle
 }
 
 // New validates and creates a new authenticate service from a set of Options.
 func New(cfg *config.Config) (*Authenticate, error) {
 	a := &Authenticate{
-		templates: template.Must(frontend.NewTemplates()),
-		options:   config.NewAtomicOptions(),
-		provider:  identity.NewAtomicAuthenticator(),
-		state:     newAtomicAuthenticateState(newAuthenticateState()),
+		options:  config.NewAtomicOptions(),
+		provider: identity.NewAtomicAuthenticator(),
+		state:    newAtomicAuthenticateState(newAuthenticateState()),
+
+		signInThrottle: newSignInThrottle(),
 	}
 
 	state, err := newAuthenticateStateFromConfig(cfg)
@@ -106,17 +108,35 @@ func (a *Authenticate) updateProvider(cfg *config.Config) error {
 	redirectURL, _ := urlutil.DeepCopy(u)
 	redirectURL.Path = cfg.Options.AuthenticateCallbackPath
 
+	sharedKey, err := cfg.Options.GetSharedKey()
+	if err != nil {
+		return err
+	}
+	var requestObjectSigningKey *jose.JSONWebKey
+	if cfg.Options.SignedRequestObjects {
+		requestObjectSigningKey, err = cfg.Options.GetActiveSigningJWK(time.Now())
+		if err != nil {
+			return err
+		} else if requestObjectSigningKey == nil {
+			return errors.New("no signing key is active to sign request objects")
+		}
+	}
+
 	// configure our identity provider
 	provider, err := identity.NewAuthenticator(
 		oauth.Options{
-			RedirectURL:     redirectURL,
-			ProviderName:    cfg.Options.Provider,
-			ProviderURL:     cfg.Options.ProviderURL,
-			ClientID:        cfg.Options.ClientID,
-			ClientSecret:    cfg.Options.ClientSecret,
-			Scopes:          cfg.Options.Scopes,
-			ServiceAccount:  cfg.Options.ServiceAccount,
-			AuthCodeOptions: cfg.Options.RequestParams,
+			RedirectURL:                 redirectURL,
+			ProviderName:                cfg.Options.Provider,
+			ProviderURL:                 cfg.Options.ProviderURL,
+			ClientID:                    cfg.Options.ClientID,
+			ClientSecret:                cfg.Options.ClientSecret,
+			Scopes:                      cfg.Options.Scopes,
+			ServiceAccount:              cfg.Options.ServiceAccount,
+			AuthCodeOptions:             cfg.Options.RequestParams,
+			PKCE:                        cfg.Options.PKCE,
+			PKCEKey:                     sharedKey,
+			PushedAuthorizationRequests: cfg.Options.PushedAuthorizationRequests,
+			RequestObjectSigningKey:     requestObjectSigningKey,
 		})
 	if err != nil {
 		return err
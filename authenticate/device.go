@@ -0,0 +1,339 @@
+package authenticate
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pomerium/csrf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/internal/frontend"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// The device authorization grant lets CLI tools and headless hosts obtain a session by having the user
+// enter a short code in a browser on another machine.
+//
+// https://datatracker.ietf.org/doc/html/rfc8628
+const (
+	deviceCodePath         = "/.pomerium/device/code"
+	deviceTokenPath        = "/.pomerium/device/token"
+	deviceVerificationPath = "/.pomerium/device"
+
+	deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// deviceAuthorizationRecordType is the databroker record type of device authorizations, which are
+	// stored as JSON so that they're shared between authenticate instances.
+	deviceAuthorizationRecordType = "pomerium.io/DeviceAuthorization"
+	// deviceAuthorizationCapacity bounds the device authorizations kept in the databroker, since ones which
+	// are abandoned before they expire are never deleted.
+	deviceAuthorizationCapacity = 10000
+
+	deviceCodeTTL      = 10 * time.Minute
+	devicePollInterval = 5 * time.Second
+
+	// user codes avoid vowels and easily confused characters, per rfc8628#section-6.1
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+type deviceAuthorization struct {
+	UserCode       string    `json:"user_code"`
+	DeviceCodeHash []byte    `json:"device_code_hash"`
+	Audience       string    `json:"audience"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	Denied         bool      `json:"denied,omitempty"`
+	// Token is the signed session JWT, set once the user approves the device.
+	Token string `json:"token,omitempty"`
+}
+
+// deviceCode returns a new device authorization code for a CLI tool or headless host, along with the user
+// code the user enters on the verification page.
+func (a *Authenticate) deviceCode(w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(r.Context(), "authenticate.deviceCode")
+	defer span.End()
+
+	state := a.state.Load()
+	options := a.options.Load()
+
+	audience := r.FormValue(urlutil.QueryAudience)
+	if audience == "" {
+		return httputil.NewError(http.StatusBadRequest, errors.New("audience is required"))
+	}
+	if !isRouteHostname(options.GetAllPolicies(), audience) {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("unknown audience: %s", audience))
+	}
+
+	userCode, err := newUserCode()
+	if err != nil {
+		return err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(cryptutil.NewKey())
+	deviceCode := userCode + "." + secret
+	hash := sha256.Sum256([]byte(deviceCode))
+
+	err = a.putDeviceAuthorization(ctx, &deviceAuthorization{
+		UserCode:       userCode,
+		DeviceCodeHash: hash[:],
+		Audience:       audience,
+		ExpiresAt:      time.Now().Add(deviceCodeTTL),
+	}, false)
+	if err != nil {
+		return err
+	}
+
+	verificationURL := state.redirectURL.ResolveReference(&url.URL{Path: deviceVerificationPath})
+	verificationURLComplete := *verificationURL
+	verificationURLComplete.RawQuery = url.Values{"user_code": {formatUserCode(userCode)}}.Encode()
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURL.String(),
+		VerificationURIComplete: verificationURLComplete.String(),
+		ExpiresIn:               int(deviceCodeTTL / time.Second),
+		Interval:                int(devicePollInterval / time.Second),
+	})
+	return nil
+}
+
+// deviceToken is polled by the device for its token, until the user approves or denies it, or the device
+// code expires. The token is only returned once.
+func (a *Authenticate) deviceToken(w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(r.Context(), "authenticate.deviceToken")
+	defer span.End()
+
+	renderError := func(code string) error {
+		httputil.RenderJSON(w, http.StatusBadRequest, struct {
+			Error string `json:"error"`
+		}{code})
+		return nil
+	}
+
+	if grantType := r.FormValue("grant_type"); grantType != "" && grantType != deviceGrantType {
+		return renderError("unsupported_grant_type")
+	}
+
+	deviceCode := r.FormValue("device_code")
+	userCode := strings.SplitN(deviceCode, ".", 2)[0]
+	da, err := a.getDeviceAuthorization(ctx, userCode)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(deviceCode))
+	if da == nil || subtle.ConstantTimeCompare(hash[:], da.DeviceCodeHash) != 1 {
+		return renderError("invalid_grant")
+	}
+
+	switch {
+	case time.Now().After(da.ExpiresAt):
+		if err := a.putDeviceAuthorization(ctx, da, true); err != nil {
+			return err
+		}
+		return renderError("expired_token")
+	case da.Denied:
+		if err := a.putDeviceAuthorization(ctx, da, true); err != nil {
+			return err
+		}
+		return renderError("access_denied")
+	case da.Token == "":
+		return renderError("authorization_pending")
+	}
+
+	if err := a.putDeviceAuthorization(ctx, da, true); err != nil {
+		return err
+	}
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}{da.Token, httputil.AuthorizationTypePomerium})
+	return nil
+}
+
+// deviceVerification is the page where a signed in user enters the user code shown by a device, and approves
+// or denies it.
+func (a *Authenticate) deviceVerification(w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(r.Context(), "authenticate.deviceVerification")
+	defer span.End()
+
+	state := a.state.Load()
+
+	input := map[string]interface{}{
+		"csrfField":        csrf.TemplateField(r),
+		"VerificationPath": deviceVerificationPath,
+		"UserCode":         "",
+		"Audience":         "",
+		"Error":            "",
+		"Result":           "",
+	}
+	render := func(status int) error {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.WriteHeader(status)
+		return frontend.Templates().ExecuteTemplate(w, "device.html", input)
+	}
+
+	rawUserCode := r.FormValue("user_code")
+	if rawUserCode == "" {
+		return render(http.StatusOK)
+	}
+	input["UserCode"] = rawUserCode
+
+	da, err := a.getDeviceAuthorization(ctx, normalizeUserCode(rawUserCode))
+	if err != nil {
+		return err
+	}
+	if da == nil || time.Now().After(da.ExpiresAt) || da.Denied || da.Token != "" {
+		input["Error"] = "The code is invalid or has expired."
+		return render(http.StatusBadRequest)
+	}
+	input["Audience"] = da.Audience
+
+	if r.Method != http.MethodPost {
+		return render(http.StatusOK)
+	}
+
+	switch r.FormValue("action") {
+	case "approve":
+		s, err := a.getSessionFromCtx(ctx)
+		if err != nil {
+			return err
+		}
+		newSession := sessions.NewSession(s, state.redirectURL.Host, []string{state.redirectURL.Host, da.Audience})
+		newSession.Programmatic = true
+		token, err := state.sharedEncoder.Marshal(newSession)
+		if err != nil {
+			return err
+		}
+		da.Token = string(token)
+		input["Result"] = "approved"
+	case "deny":
+		da.Denied = true
+		input["Result"] = "denied"
+	default:
+		return httputil.NewError(http.StatusBadRequest, errors.New("unknown action"))
+	}
+	if err := a.putDeviceAuthorization(ctx, da, false); err != nil {
+		return err
+	}
+	return render(http.StatusOK)
+}
+
+func (a *Authenticate) getDeviceAuthorization(ctx context.Context, userCode string) (*deviceAuthorization, error) {
+	if userCode == "" {
+		return nil, nil
+	}
+
+	res, err := a.state.Load().dataBrokerClient.Get(ctx, &databroker.GetRequest{
+		Type: deviceAuthorizationRecordType,
+		Id:   userCode,
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if res.GetRecord().GetDeletedAt() != nil {
+		return nil, nil
+	}
+
+	var value wrapperspb.BytesValue
+	if err := res.GetRecord().GetData().UnmarshalTo(&value); err != nil {
+		return nil, fmt.Errorf("authenticate: error decoding device authorization: %w", err)
+	}
+	var da deviceAuthorization
+	if err := json.Unmarshal(value.GetValue(), &da); err != nil {
+		return nil, fmt.Errorf("authenticate: error decoding device authorization: %w", err)
+	}
+	return &da, nil
+}
+
+func (a *Authenticate) putDeviceAuthorization(ctx context.Context, da *deviceAuthorization, deleted bool) error {
+	client := a.state.Load().dataBrokerClient
+
+	_, err := client.SetOptions(ctx, &databroker.SetOptionsRequest{
+		Type: deviceAuthorizationRecordType,
+		Options: &databroker.Options{
+			Capacity: proto.Uint64(deviceAuthorizationCapacity),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	bs, err := json.Marshal(da)
+	if err != nil {
+		return err
+	}
+	data, err := anypb.New(wrapperspb.Bytes(bs))
+	if err != nil {
+		return err
+	}
+	record := &databroker.Record{
+		Type: deviceAuthorizationRecordType,
+		Id:   da.UserCode,
+		Data: data,
+	}
+	if deleted {
+		record.DeletedAt = timestamppb.Now()
+	}
+	_, err = client.Put(ctx, &databroker.PutRequest{Record: record})
+	return err
+}
+
+func newUserCode() (string, error) {
+	var b strings.Builder
+	for i := 0; i < userCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// formatUserCode formats a user code as XXXX-XXXX, which is easier to read.
+func formatUserCode(userCode string) string {
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+// normalizeUserCode normalizes a user code entered by the user, who may have omitted the dash or typed
+// lowercase characters.
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return r
+	}, userCode)
+}
@@ -0,0 +1,182 @@
+package authenticate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func TestAuthenticate_deviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	signer, err := jws.NewHS256Signer(nil)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	records := map[string]*databroker.Record{}
+
+	o := config.NewAtomicOptions()
+	o.Store(&config.Options{
+		Policies: []config.Policy{{
+			Source: &config.StringURL{URL: mustParseURL("https://from.example.com")},
+		}},
+	})
+	a := &Authenticate{
+		options: o,
+		state: newAtomicAuthenticateState(&authenticateState{
+			redirectURL:   mustParseURL("https://authenticate.example.com/oauth2/callback"),
+			cookieSecret:  cryptutil.NewKey(),
+			sharedEncoder: signer,
+			dataBrokerClient: mockDataBrokerServiceClient{
+				get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					record, ok := records[in.GetId()]
+					if !ok {
+						return nil, status.Error(codes.NotFound, "not found")
+					}
+					return &databroker.GetResponse{Record: proto.Clone(record).(*databroker.Record)}, nil
+				},
+				put: func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					records[in.GetRecord().GetId()] = proto.Clone(in.GetRecord()).(*databroker.Record)
+					return &databroker.PutResponse{Record: in.GetRecord()}, nil
+				},
+			},
+		}),
+	}
+
+	post := func(t *testing.T, path string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		a.Handler().ServeHTTP(w, r)
+		return w
+	}
+	newDeviceCode := func(t *testing.T) (deviceCode, userCode string) {
+		w := post(t, deviceCodePath, url.Values{"pomerium_audience": {"from.example.com"}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var res struct {
+			DeviceCode              string `json:"device_code"`
+			UserCode                string `json:"user_code"`
+			VerificationURI         string `json:"verification_uri"`
+			VerificationURIComplete string `json:"verification_uri_complete"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, "https://authenticate.example.com/.pomerium/device", res.VerificationURI)
+		assert.Equal(t, res.VerificationURI+"?user_code="+res.UserCode, res.VerificationURIComplete)
+		return res.DeviceCode, res.UserCode
+	}
+	pollToken := func(t *testing.T, deviceCode string) (code int, errorCode, token string) {
+		w := post(t, deviceTokenPath, url.Values{"grant_type": {deviceGrantType}, "device_code": {deviceCode}})
+		var res struct {
+			Error       string `json:"error"`
+			AccessToken string `json:"access_token"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return w.Code, res.Error, res.AccessToken
+	}
+	verify := func(t *testing.T, form url.Values) *httptest.ResponseRecorder {
+		jwt, err := signer.Marshal(&sessions.State{ID: "SESSION_ID", Subject: "USER_ID"})
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodPost, deviceVerificationPath, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r = r.WithContext(sessions.NewContext(r.Context(), string(jwt), nil))
+		w := httptest.NewRecorder()
+		require.NoError(t, a.deviceVerification(w, r))
+		return w
+	}
+
+	t.Run("approve", func(t *testing.T) {
+		deviceCode, userCode := newDeviceCode(t)
+
+		_, errorCode, _ := pollToken(t, deviceCode)
+		assert.Equal(t, "authorization_pending", errorCode)
+
+		w := verify(t, url.Values{"user_code": {strings.ToLower(userCode)}, "action": {"approve"}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "You can return to your device.")
+
+		code, _, token := pollToken(t, deviceCode)
+		require.Equal(t, http.StatusOK, code)
+		var s sessions.State
+		require.NoError(t, signer.Unmarshal([]byte(token), &s))
+		assert.Equal(t, "USER_ID", s.Subject)
+		assert.Equal(t, []string{"authenticate.example.com", "from.example.com"}, []string(s.Audience))
+		assert.True(t, s.Programmatic)
+
+		_, errorCode, _ = pollToken(t, deviceCode)
+		assert.Equal(t, "invalid_grant", errorCode, "token should only be returned once")
+	})
+	t.Run("deny", func(t *testing.T) {
+		deviceCode, userCode := newDeviceCode(t)
+
+		w := verify(t, url.Values{"user_code": {userCode}, "action": {"deny"}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		_, errorCode, _ := pollToken(t, deviceCode)
+		assert.Equal(t, "access_denied", errorCode)
+	})
+	t.Run("expired", func(t *testing.T) {
+		deviceCode, userCode := newDeviceCode(t)
+
+		da, err := a.getDeviceAuthorization(context.Background(), normalizeUserCode(userCode))
+		require.NoError(t, err)
+		da.ExpiresAt = time.Now().Add(-time.Second)
+		require.NoError(t, a.putDeviceAuthorization(context.Background(), da, false))
+
+		w := verify(t, url.Values{"user_code": {userCode}, "action": {"approve"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		_, errorCode, _ := pollToken(t, deviceCode)
+		assert.Equal(t, "expired_token", errorCode)
+	})
+	t.Run("invalid device code", func(t *testing.T) {
+		_, userCode := newDeviceCode(t)
+
+		_, errorCode, _ := pollToken(t, normalizeUserCode(userCode)+".not-the-secret")
+		assert.Equal(t, "invalid_grant", errorCode)
+	})
+	t.Run("unknown audience", func(t *testing.T) {
+		w := post(t, deviceCodePath, url.Values{"pomerium_audience": {"other.example.com"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestUserCode(t *testing.T) {
+	t.Parallel()
+
+	userCode, err := newUserCode()
+	require.NoError(t, err)
+	assert.Len(t, userCode, userCodeLength)
+	for _, r := range userCode {
+		assert.Contains(t, userCodeAlphabet, string(r))
+	}
+
+	formatted := formatUserCode(userCode)
+	assert.Equal(t, userCode[:4]+"-"+userCode[4:], formatted)
+	assert.Equal(t, userCode, normalizeUserCode(formatted))
+	assert.Equal(t, "BCDFGHJK", normalizeUserCode(" bcdf-ghjk "))
+}
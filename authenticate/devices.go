@@ -0,0 +1,298 @@
+package authenticate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pomerium/csrf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/devicecredential"
+	"github.com/pomerium/pomerium/internal/frontend"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+const (
+	devicesPath = "/.pomerium/devices"
+
+	// deviceSessionCapacity bounds the session bindings kept in the databroker, since they aren't deleted when
+	// their sessions are.
+	deviceSessionCapacity = 10000
+)
+
+// devices lets users enroll WebAuthn credentials for their devices, list and remove them, and bind their session
+// to a device by verifying its credential. The WebAuthn ceremonies run in the browser, which posts the results
+// back as a form.
+func (a *Authenticate) devices(w http.ResponseWriter, r *http.Request) error {
+	ctx, span := trace.StartSpan(r.Context(), "authenticate.devices")
+	defer span.End()
+
+	state := a.state.Load()
+
+	s, err := a.getSessionFromCtx(ctx)
+	if err != nil {
+		return err
+	}
+	pbSession, err := session.Get(ctx, state.dataBrokerClient, s.ID)
+	if err != nil {
+		return httputil.NewError(http.StatusUnauthorized, err)
+	}
+	userID := pbSession.GetUserId()
+
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "register":
+			err = a.registerDeviceCredential(ctx, r, s.ID, userID)
+		case "verify":
+			err = a.verifyDeviceCredential(ctx, r, s.ID, userID)
+		case "remove":
+			err = a.removeDeviceCredential(ctx, r.FormValue("id"), userID)
+		default:
+			err = httputil.NewError(http.StatusBadRequest, errors.New("unknown action"))
+		}
+		if err != nil {
+			return err
+		}
+		httputil.Redirect(w, r, devicesPath, http.StatusFound)
+		return nil
+	}
+
+	credentials, err := a.listDeviceCredentials(ctx, userID)
+	if err != nil {
+		return err
+	}
+	var rawIDs []string
+	for _, c := range credentials {
+		rawIDs = append(rawIDs, c.RawID)
+	}
+	currentCredentialID := ""
+	if binding, err := a.getDeviceSession(ctx, s.ID); err == nil {
+		currentCredentialID = binding.CredentialID
+	}
+	userName := userID
+	if pbUser, err := user.Get(ctx, state.dataBrokerClient, userID); err == nil && pbUser.GetEmail() != "" {
+		userName = pbUser.GetEmail()
+	}
+	userHandle := sha256.Sum256([]byte(userID))
+
+	now := time.Now()
+	nonce := base64.StdEncoding.EncodeToString(cryptutil.NewKey())
+	input := map[string]interface{}{
+		"csrfField":           csrf.TemplateField(r),
+		"DevicesPath":         devicesPath,
+		"Nonce":               nonce,
+		"Credentials":         credentials,
+		"CurrentCredentialID": currentCredentialID,
+		"RawIDs":              strings.Join(rawIDs, " "),
+		"RelyingPartyID":      state.redirectURL.Hostname(),
+		"UserHandle":          base64.RawURLEncoding.EncodeToString(userHandle[:]),
+		"UserName":            userName,
+		"RegisterChallenge":   devicecredential.NewChallenge(state.cookieSecret, s.ID, "register", now),
+		"VerifyChallenge":     devicecredential.NewChallenge(state.cookieSecret, s.ID, "verify", now),
+	}
+	// the page runs the WebAuthn ceremonies with an inline script, which the default policy doesn't allow
+	w.Header().Set("Content-Security-Policy", httputil.HeadersContentSecurityPolicy["Content-Security-Policy"]+
+		" script-src 'nonce-"+nonce+"';")
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	return frontend.Templates().ExecuteTemplate(w, "devices.html", input)
+}
+
+// getRelyingParty returns the WebAuthn relying party, which is the authenticate service.
+func (a *Authenticate) getRelyingParty() devicecredential.RelyingParty {
+	redirectURL := a.state.Load().redirectURL
+	return devicecredential.RelyingParty{
+		ID:     redirectURL.Hostname(),
+		Origin: redirectURL.Scheme + "://" + redirectURL.Host,
+	}
+}
+
+func (a *Authenticate) registerDeviceCredential(ctx context.Context, r *http.Request, sessionID, userID string) error {
+	challenge := r.FormValue("challenge")
+	err := devicecredential.VerifyChallenge(a.state.Load().cookieSecret, challenge, sessionID, "register", time.Now())
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+	rawID := r.FormValue("raw_id")
+	values, err := decodeFormValues(r, "client_data", "authenticator_data", "public_key")
+	if err != nil {
+		return err
+	}
+	signCount, err := devicecredential.VerifyRegistration(a.getRelyingParty(), challenge, values[0], values[1], values[2])
+	if err != nil || rawID == "" {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid device credential: %v", err))
+	}
+
+	c := &devicecredential.Credential{
+		ID:        devicecredential.ID(rawID),
+		UserID:    userID,
+		Name:      r.FormValue("name"),
+		RawID:     rawID,
+		PublicKey: values[2],
+		SignCount: signCount,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if existing, err := a.getDeviceCredential(ctx, c.ID); err == nil && existing.UserID != userID {
+		return httputil.NewError(http.StatusConflict, errors.New("device credential is enrolled by another user"))
+	}
+	return a.putDeviceCredential(ctx, c, false)
+}
+
+func (a *Authenticate) verifyDeviceCredential(ctx context.Context, r *http.Request, sessionID, userID string) error {
+	challenge := r.FormValue("challenge")
+	err := devicecredential.VerifyChallenge(a.state.Load().cookieSecret, challenge, sessionID, "verify", time.Now())
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+	c, err := a.getDeviceCredential(ctx, devicecredential.ID(r.FormValue("raw_id")))
+	if err != nil || c.UserID != userID {
+		return httputil.NewError(http.StatusBadRequest, errors.New("unknown device credential"))
+	}
+	values, err := decodeFormValues(r, "client_data", "authenticator_data", "signature")
+	if err != nil {
+		return err
+	}
+	signCount, err := devicecredential.VerifyAssertion(a.getRelyingParty(), challenge, c, values[0], values[1], values[2])
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	c.SignCount = signCount
+	c.LastUsedAt = &now
+	if err := a.putDeviceCredential(ctx, c, false); err != nil {
+		return err
+	}
+	return a.putDeviceSession(ctx, &devicecredential.Session{
+		SessionID:    sessionID,
+		CredentialID: c.ID,
+		VerifiedAt:   now,
+	})
+}
+
+func (a *Authenticate) removeDeviceCredential(ctx context.Context, id, userID string) error {
+	c, err := a.getDeviceCredential(ctx, id)
+	if err != nil || c.UserID != userID {
+		return httputil.NewError(http.StatusNotFound, errors.New("unknown device credential"))
+	}
+	return a.putDeviceCredential(ctx, c, true)
+}
+
+// decodeFormValues returns the base64url encoded form values with the given names.
+func decodeFormValues(r *http.Request, names ...string) ([][]byte, error) {
+	values := make([][]byte, len(names))
+	for i, name := range names {
+		value, err := base64.RawURLEncoding.DecodeString(r.FormValue(name))
+		if err != nil {
+			return nil, httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid %s: %w", name, err))
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (a *Authenticate) listDeviceCredentials(ctx context.Context, userID string) ([]*devicecredential.Credential, error) {
+	client := a.state.Load().dataBrokerClient
+
+	var credentials []*devicecredential.Credential
+	for offset := int64(0); ; {
+		res, err := client.Query(ctx, &databroker.QueryRequest{
+			Type:   devicecredential.RecordType,
+			Offset: offset,
+			Limit:  100,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range res.GetRecords() {
+			c, err := devicecredential.FromRecord(record)
+			if err != nil {
+				return nil, err
+			}
+			if c.UserID == userID {
+				credentials = append(credentials, c)
+			}
+		}
+		offset += int64(len(res.GetRecords()))
+		if len(res.GetRecords()) == 0 || offset >= res.GetTotalCount() {
+			break
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+	return credentials, nil
+}
+
+func (a *Authenticate) getDeviceCredential(ctx context.Context, id string) (*devicecredential.Credential, error) {
+	res, err := a.state.Load().dataBrokerClient.Get(ctx, &databroker.GetRequest{
+		Type: devicecredential.RecordType,
+		Id:   id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.GetRecord().GetDeletedAt() != nil {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	return devicecredential.FromRecord(res.GetRecord())
+}
+
+func (a *Authenticate) putDeviceCredential(ctx context.Context, c *devicecredential.Credential, deleted bool) error {
+	record, err := c.ToRecord()
+	if err != nil {
+		return err
+	}
+	if deleted {
+		record.DeletedAt = timestamppb.Now()
+	}
+	_, err = a.state.Load().dataBrokerClient.Put(ctx, &databroker.PutRequest{Record: record})
+	return err
+}
+
+func (a *Authenticate) getDeviceSession(ctx context.Context, sessionID string) (*devicecredential.Session, error) {
+	res, err := a.state.Load().dataBrokerClient.Get(ctx, &databroker.GetRequest{
+		Type: devicecredential.SessionRecordType,
+		Id:   sessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return devicecredential.SessionFromRecord(res.GetRecord())
+}
+
+func (a *Authenticate) putDeviceSession(ctx context.Context, s *devicecredential.Session) error {
+	client := a.state.Load().dataBrokerClient
+
+	_, err := client.SetOptions(ctx, &databroker.SetOptionsRequest{
+		Type: devicecredential.SessionRecordType,
+		Options: &databroker.Options{
+			Capacity: proto.Uint64(deviceSessionCapacity),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	record, err := s.ToRecord()
+	if err != nil {
+		return err
+	}
+	_, err = client.Put(ctx, &databroker.PutRequest{Record: record})
+	return err
+}
@@ -0,0 +1,180 @@
+package authenticate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/devicecredential"
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestAuthenticate_devices(t *testing.T) {
+	t.Parallel()
+
+	signer, err := jws.NewHS256Signer(nil)
+	require.NoError(t, err)
+	cookieSecret := cryptutil.NewKey()
+
+	records := map[[2]string]*databroker.Record{}
+	data, err := anypb.New(&session.Session{Id: "SESSION_ID", UserId: "USER_ID"})
+	require.NoError(t, err)
+	records[[2]string{data.GetTypeUrl(), "SESSION_ID"}] = &databroker.Record{Type: data.GetTypeUrl(), Id: "SESSION_ID", Data: data}
+
+	a := &Authenticate{
+		options: config.NewAtomicOptions(),
+		state: newAtomicAuthenticateState(&authenticateState{
+			redirectURL:   mustParseURL("https://authenticate.example.com/oauth2/callback"),
+			cookieSecret:  cookieSecret,
+			sharedEncoder: signer,
+			dataBrokerClient: mockDataBrokerServiceClient{
+				get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+					record, ok := records[[2]string{in.GetType(), in.GetId()}]
+					if !ok {
+						return nil, status.Error(codes.NotFound, "not found")
+					}
+					return &databroker.GetResponse{Record: record}, nil
+				},
+				put: func(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error) {
+					records[[2]string{in.GetRecord().GetType(), in.GetRecord().GetId()}] = in.GetRecord()
+					return &databroker.PutResponse{Record: in.GetRecord()}, nil
+				},
+				query: func(ctx context.Context, in *databroker.QueryRequest, opts ...grpc.CallOption) (*databroker.QueryResponse, error) {
+					res := new(databroker.QueryResponse)
+					for k, record := range records {
+						if k[0] == in.GetType() && record.GetDeletedAt() == nil {
+							res.Records = append(res.Records, record)
+						}
+					}
+					res.TotalCount = int64(len(res.Records))
+					return res, nil
+				},
+			},
+		}),
+	}
+
+	request := func(t *testing.T, method string, form url.Values) *httptest.ResponseRecorder {
+		jwt, err := signer.Marshal(&sessions.State{ID: "SESSION_ID", Subject: "USER_ID"})
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(method, devicesPath, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r = r.WithContext(sessions.NewContext(r.Context(), string(jwt), nil))
+		w := httptest.NewRecorder()
+		require.NoError(t, a.devices(w, r))
+		return w
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+
+	// a software authenticator
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	rpIDHash := sha256.Sum256([]byte("authenticate.example.com"))
+	authenticatorData := func(signCount uint32) []byte {
+		data := append(rpIDHash[:], 0x01, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[33:], signCount)
+		return data
+	}
+	clientData := func(typ, challenge string) []byte {
+		bs, _ := json.Marshal(map[string]string{
+			"type":      typ,
+			"challenge": challenge,
+			"origin":    "https://authenticate.example.com",
+		})
+		return bs
+	}
+	rawID := encode([]byte("CREDENTIAL_ID"))
+	credentialKey := [2]string{devicecredential.RecordType, devicecredential.ID(rawID)}
+
+	t.Run("empty", func(t *testing.T) {
+		w := request(t, http.MethodGet, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Security-Policy"), "script-src 'nonce-")
+		assert.Contains(t, w.Body.String(), "No devices enrolled.")
+	})
+	t.Run("register", func(t *testing.T) {
+		challenge := devicecredential.NewChallenge(cookieSecret, "SESSION_ID", "register", time.Now())
+		w := request(t, http.MethodPost, url.Values{
+			"action":             {"register"},
+			"challenge":          {challenge},
+			"name":               {"laptop"},
+			"raw_id":             {rawID},
+			"client_data":        {encode(clientData("webauthn.create", challenge))},
+			"authenticator_data": {encode(authenticatorData(0))},
+			"public_key":         {encode(publicKey)},
+		})
+		assert.Equal(t, http.StatusFound, w.Code)
+
+		c, err := devicecredential.FromRecord(records[credentialKey])
+		require.NoError(t, err)
+		assert.Equal(t, "USER_ID", c.UserID)
+		assert.Equal(t, "laptop", c.Name)
+
+		w = request(t, http.MethodGet, nil)
+		assert.Contains(t, w.Body.String(), c.ID)
+	})
+	t.Run("verify", func(t *testing.T) {
+		challenge := devicecredential.NewChallenge(cookieSecret, "SESSION_ID", "verify", time.Now())
+		clientDataJSON := clientData("webauthn.get", challenge)
+		authData := authenticatorData(1)
+		clientDataHash := sha256.Sum256(clientDataJSON)
+		digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+		signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+
+		w := request(t, http.MethodPost, url.Values{
+			"action":             {"verify"},
+			"challenge":          {challenge},
+			"raw_id":             {rawID},
+			"client_data":        {encode(clientDataJSON)},
+			"authenticator_data": {encode(authData)},
+			"signature":          {encode(signature)},
+		})
+		assert.Equal(t, http.StatusFound, w.Code)
+
+		s, err := devicecredential.SessionFromRecord(records[[2]string{devicecredential.SessionRecordType, "SESSION_ID"}])
+		require.NoError(t, err)
+		assert.Equal(t, devicecredential.ID(rawID), s.CredentialID)
+		c, err := devicecredential.FromRecord(records[credentialKey])
+		require.NoError(t, err)
+		assert.Equal(t, uint32(1), c.SignCount)
+		assert.NotNil(t, c.LastUsedAt)
+
+		w = request(t, http.MethodGet, nil)
+		assert.Contains(t, w.Body.String(), "laptop (this session)")
+	})
+	t.Run("remove", func(t *testing.T) {
+		w := request(t, http.MethodPost, url.Values{"action": {"remove"}, "id": {devicecredential.ID(rawID)}})
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.NotNil(t, records[credentialKey].GetDeletedAt())
+
+		w = request(t, http.MethodGet, nil)
+		assert.Contains(t, w.Body.String(), "No devices enrolled.")
+	})
+}
@@ -18,9 +18,11 @@ import (
 	"golang.org/x/oauth2"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/pomerium/pomerium/internal/frontend"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/identity"
 	"github.com/pomerium/pomerium/internal/identity/manager"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
 	"github.com/pomerium/pomerium/internal/identity/oidc"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/middleware"
@@ -48,7 +50,7 @@ func (a *Authenticate) Mount(r *mux.Router) {
 		options := a.options.Load()
 		state := a.state.Load()
 		csrfKey := fmt.Sprintf("%s_csrf", options.CookieName)
-		return csrf.Protect(
+		protected := csrf.Protect(
 			state.cookieSecret,
 			csrf.Secure(options.CookieSecure),
 			csrf.Path("/"),
@@ -63,11 +65,24 @@ func (a *Authenticate) Mount(r *mux.Router) {
 			csrf.SameSite(csrf.SameSiteLaxMode),
 			csrf.ErrorHandler(httputil.HandlerFunc(httputil.CSRFFailureHandler)),
 		)(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the service account token and device endpoints are called by clients without cookies
+			if r.URL.Path == serviceAccountTokenPath || r.URL.Path == deviceCodePath || r.URL.Path == deviceTokenPath {
+				h.ServeHTTP(w, r)
+				return
+			}
+			protected.ServeHTTP(w, r)
+		})
 	})
 
 	r.Path("/robots.txt").HandlerFunc(a.RobotsTxt).Methods(http.MethodGet)
 	// Identity Provider (IdP) endpoints
 	r.Path("/oauth2/callback").Handler(httputil.HandlerFunc(a.OAuthCallback)).Methods(http.MethodGet)
+	// Service account token exchange, authenticated by the service account's own credential
+	r.Path(serviceAccountTokenPath).Handler(httputil.HandlerFunc(a.serviceAccountToken)).Methods(http.MethodPost)
+	// Device authorization grant, for CLI tools and headless hosts
+	r.Path(deviceCodePath).Handler(httputil.HandlerFunc(a.deviceCode)).Methods(http.MethodPost)
+	r.Path(deviceTokenPath).Handler(httputil.HandlerFunc(a.deviceToken)).Methods(http.MethodPost)
 
 	a.mountDashboard(r)
 	a.mountWellKnown(r)
@@ -93,6 +108,9 @@ func (a *Authenticate) mountDashboard(r *mux.Router) {
 	sr.Path("/").Handler(a.requireValidSignatureOnRedirect(a.userInfo))
 	sr.Path("/sign_in").Handler(a.requireValidSignature(a.SignIn))
 	sr.Path("/sign_out").Handler(a.requireValidSignature(a.SignOut))
+	sr.Path("/device").Handler(httputil.HandlerFunc(a.deviceVerification)).Methods(http.MethodGet, http.MethodPost)
+	sr.Path("/access_request").Handler(httputil.HandlerFunc(a.accessRequest)).Methods(http.MethodGet, http.MethodPost)
+	sr.Path("/devices").Handler(httputil.HandlerFunc(a.devices)).Methods(http.MethodGet, http.MethodPost)
 }
 
 func (a *Authenticate) mountWellKnown(r *mux.Router) {
@@ -149,6 +167,15 @@ func (a *Authenticate) VerifySession(next http.Handler) http.Handler {
 			return a.reauthenticateOrFail(w, r, err)
 		}
 
+		// stateless sessions aren't stored in the databroker
+		if len(sessionState.StatelessSession) > 0 {
+			if sessionState.IsExpired() {
+				return a.reauthenticateOrFail(w, r, errors.New("session expired"))
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return nil
+		}
+
 		if state.dataBrokerClient == nil {
 			return errors.New("authenticate: databroker client cannot be nil")
 		}
@@ -263,7 +290,14 @@ func (a *Authenticate) SignOut(w http.ResponseWriter, r *http.Request) error {
 		redirectString = signOutURL.String()
 	}
 	if uri := r.FormValue(urlutil.QueryRedirectURI); uri != "" {
-		redirectString = uri
+		redirectURL, err := urlutil.ParseAndValidateURL(uri)
+		if err != nil {
+			return httputil.NewError(http.StatusBadRequest, err)
+		}
+		if !a.options.Load().IsRedirectAllowed(redirectURL) {
+			return httputil.NewError(http.StatusBadRequest, errors.New("invalid redirect uri"))
+		}
+		redirectString = redirectURL.String()
 	}
 
 	endSessionURL, err := a.provider.Load().LogOut()
@@ -300,6 +334,9 @@ func (a *Authenticate) reauthenticateOrFail(w http.ResponseWriter, r *http.Reque
 	if reqType := r.Header.Get("X-Requested-With"); strings.EqualFold(reqType, "XmlHttpRequest") {
 		return httputil.NewError(http.StatusUnauthorized, err)
 	}
+	if err := a.checkSignInThrottle(w, r, ""); err != nil {
+		return err
+	}
 	state.sessionStore.ClearSession(w, r)
 	redirectURL := state.redirectURL.ResolveReference(r.URL)
 	nonce := csrf.Token(r)
@@ -339,12 +376,27 @@ func (a *Authenticate) statusForErrorCode(errorCode string) int {
 	}
 }
 
-func (a *Authenticate) getOAuthCallback(w http.ResponseWriter, r *http.Request) (*url.URL, error) {
+func (a *Authenticate) getOAuthCallback(w http.ResponseWriter, r *http.Request) (_ *url.URL, err error) {
 	ctx, span := trace.StartSpan(r.Context(), "authenticate.getOAuthCallback")
 	defer span.End()
 
 	state := a.state.Load()
 
+	if err := a.checkSignInThrottle(w, r, ""); err != nil {
+		return nil, err
+	}
+	// failed callbacks, e.g. replayed codes or tampered state, count towards a lockout of the client and, once
+	// the code is redeemed, of the identity
+	var signInIdentity string
+	countFailure := true
+	defer func() {
+		if err == nil {
+			a.recordSignInSuccess(r, signInIdentity)
+		} else if countFailure {
+			a.recordSignInFailure(ctx, r, signInIdentity, err)
+		}
+	}()
+
 	// Error Authentication Response: rfc6749#section-4.1.2.1 & OIDC#3.1.2.6
 	//
 	// first, check if the identity provider returned an error
@@ -361,10 +413,17 @@ func (a *Authenticate) getOAuthCallback(w http.ResponseWriter, r *http.Request)
 	//
 	// Exchange the supplied Authorization Code for a valid user session.
 	var claims identity.SessionClaims
-	accessToken, err := a.provider.Load().Authenticate(ctx, code, &claims)
+	accessToken, err := a.provider.Load().Authenticate(oauth.WithState(ctx, r.FormValue("state")), code, &claims)
 	if err != nil {
 		return nil, fmt.Errorf("error redeeming authenticate code: %w", err)
 	}
+	if sub, ok := claims.Claims["sub"].(string); ok && sub != "" {
+		signInIdentity = sub
+		if err := a.checkSignInThrottle(w, r, signInIdentity); err != nil {
+			countFailure = false
+			return nil, err
+		}
+	}
 
 	// state includes a csrf nonce (validated by middleware) and redirect uri
 	bytes, err := base64.URLEncoding.DecodeString(r.FormValue("state"))
@@ -413,8 +472,16 @@ func (a *Authenticate) getOAuthCallback(w http.ResponseWriter, r *http.Request)
 		newState.Audience = append(newState.Audience, nextRedirectURL.Hostname())
 	}
 
-	// save the session and access token to the databroker
-	err = a.saveSessionToDataBroker(ctx, &newState, claims, accessToken)
+	// the sign in itself succeeded, so errors saving the session aren't the user's fault
+	countFailure = false
+
+	if a.options.Load().StatelessSessions {
+		// store the session in the session state itself
+		err = a.saveStatelessSession(ctx, &newState, claims, accessToken)
+	} else {
+		// save the session and access token to the databroker
+		err = a.saveSessionToDataBroker(ctx, &newState, claims, accessToken)
+	}
 	if err != nil {
 		return nil, httputil.NewError(http.StatusInternalServerError, err)
 	}
@@ -451,16 +518,19 @@ func (a *Authenticate) userInfo(w http.ResponseWriter, r *http.Request) error {
 		s.ID = uuid.New().String()
 	}
 
-	pbSession, err := session.Get(ctx, state.dataBrokerClient, s.ID)
-	if err != nil {
-		pbSession = &session.Session{
-			Id: s.ID,
+	pbSession, pbUser := new(session.Session), new(user.User)
+	if ok, _ := s.GetStateless(pbSession, pbUser); !ok {
+		pbSession, err = session.Get(ctx, state.dataBrokerClient, s.ID)
+		if err != nil {
+			pbSession = &session.Session{
+				Id: s.ID,
+			}
 		}
-	}
-	pbUser, err := user.Get(ctx, state.dataBrokerClient, pbSession.GetUserId())
-	if err != nil {
-		pbUser = &user.User{
-			Id: pbSession.GetUserId(),
+		pbUser, err = user.Get(ctx, state.dataBrokerClient, pbSession.GetUserId())
+		if err != nil {
+			pbUser = &user.User{
+				Id: pbSession.GetUserId(),
+			}
 		}
 	}
 	pbDirectoryUser, err := directory.GetUser(ctx, state.dataBrokerClient, pbSession.GetUserId())
@@ -496,16 +566,15 @@ func (a *Authenticate) userInfo(w http.ResponseWriter, r *http.Request) error {
 		"csrfField":       csrf.TemplateField(r),
 		"SignOutURL":      signoutURL,
 	}
-	return a.templates.ExecuteTemplate(w, "userInfo.html", input)
+	return frontend.Templates().ExecuteTemplate(w, "userInfo.html", input)
 }
 
-func (a *Authenticate) saveSessionToDataBroker(
-	ctx context.Context,
+// newSession returns the session for the session state, which expires after the cookie expiry.
+func (a *Authenticate) newSession(
 	sessionState *sessions.State,
 	claims identity.SessionClaims,
 	accessToken *oauth2.Token,
-) error {
-	state := a.state.Load()
+) *session.Session {
 	options := a.options.Load()
 
 	sessionExpiry := timestamppb.New(time.Now().Add(options.CookieExpire))
@@ -527,7 +596,43 @@ func (a *Authenticate) saveSessionToDataBroker(
 		Audience:   sessionState.Audience,
 	}
 	s.SetRawIDToken(claims.RawIDToken)
-	s.AddClaims(claims.Flatten())
+	flattenedClaims := claims.Flatten()
+	options.ClaimTransforms.Apply(flattenedClaims)
+	s.AddClaims(flattenedClaims)
+	return s
+}
+
+// saveStatelessSession stores the session and user in the session state, instead of the databroker.
+func (a *Authenticate) saveStatelessSession(
+	ctx context.Context,
+	sessionState *sessions.State,
+	claims identity.SessionClaims,
+	accessToken *oauth2.Token,
+) error {
+	s := a.newSession(sessionState, claims, accessToken)
+	// stateless sessions are never refreshed, so the tokens are left out to keep the cookie small
+	s.OauthToken = nil
+	s.IdToken.Raw = ""
+
+	mu := manager.User{
+		User: &user.User{
+			Id: s.GetUserId(),
+		},
+	}
+	if err := a.provider.Load().UpdateUserInfo(ctx, accessToken, &mu); err != nil {
+		return fmt.Errorf("authenticate: error retrieving user info: %w", err)
+	}
+	return sessionState.SetStateless(s, mu.User)
+}
+
+func (a *Authenticate) saveSessionToDataBroker(
+	ctx context.Context,
+	sessionState *sessions.State,
+	claims identity.SessionClaims,
+	accessToken *oauth2.Token,
+) error {
+	state := a.state.Load()
+	s := a.newSession(sessionState, claims, accessToken)
 
 	// if no user exists yet, create a new one
 	currentUser, _ := user.Get(ctx, state.dataBrokerClient, s.GetUserId())
@@ -574,7 +679,7 @@ func (a *Authenticate) revokeSession(ctx context.Context, w http.ResponseWriter,
 
 	var rawIDToken string
 	sessionState, err := a.getSessionFromCtx(ctx)
-	if err != nil {
+	if err != nil || len(sessionState.StatelessSession) > 0 {
 		return rawIDToken
 	}
 
@@ -0,0 +1,99 @@
+package authenticate
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/sessions/header"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+const serviceAccountTokenPath = "/.pomerium/service_account_token"
+
+// serviceAccountTokenTTL is the maximum lifetime of a token issued by the service account token endpoint.
+const serviceAccountTokenTTL = 5 * time.Minute
+
+// serviceAccountToken exchanges a service account's credential, passed in the Authorization header, for a
+// short-lived JWT that is only valid for the route given by the audience form value.
+func (a *Authenticate) serviceAccountToken(w http.ResponseWriter, r *http.Request) error {
+	state := a.state.Load()
+	options := a.options.Load()
+
+	rawJWT, err := header.NewStore(state.sharedEncoder, httputil.AuthorizationTypePomerium).LoadSession(r)
+	if err != nil {
+		return httputil.NewError(http.StatusUnauthorized, err)
+	}
+	var credential sessions.State
+	if err := state.sharedEncoder.Unmarshal([]byte(rawJWT), &credential); err != nil {
+		return httputil.NewError(http.StatusUnauthorized, err)
+	}
+	if credential.IsExpired() {
+		return httputil.NewError(http.StatusUnauthorized, errors.New("credential expired"))
+	}
+	// the tokens issued by this endpoint can't be exchanged for new ones, or they could be renewed forever
+	if credential.Programmatic || len(credential.Audience) > 0 {
+		return httputil.NewError(http.StatusUnauthorized, errors.New("invalid service account credential"))
+	}
+
+	sa, err := user.GetServiceAccount(r.Context(), state.dataBrokerClient, credential.ID)
+	if status.Code(err) == codes.NotFound {
+		return httputil.NewError(http.StatusUnauthorized, errors.New("service account not found"))
+	} else if err != nil {
+		return err
+	}
+	now := time.Now()
+	if sa.GetExpiresAt() != nil && now.After(sa.GetExpiresAt().AsTime()) {
+		return httputil.NewError(http.StatusUnauthorized, errors.New("service account expired"))
+	}
+
+	audience := r.FormValue(urlutil.QueryAudience)
+	if audience == "" {
+		return httputil.NewError(http.StatusBadRequest, errors.New("audience is required"))
+	}
+	if !isRouteHostname(options.GetAllPolicies(), audience) {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("unknown audience: %s", audience))
+	}
+
+	expiry := now.Add(serviceAccountTokenTTL)
+	if sa.GetExpiresAt() != nil && sa.GetExpiresAt().AsTime().Before(expiry) {
+		expiry = sa.GetExpiresAt().AsTime()
+	}
+	token, err := state.sharedEncoder.Marshal(&sessions.State{
+		Issuer:       state.redirectURL.Hostname(),
+		Subject:      sa.GetUserId(),
+		Audience:     jwt.Audience{audience},
+		Expiry:       jwt.NewNumericDate(expiry),
+		NotBefore:    jwt.NewNumericDate(now),
+		IssuedAt:     jwt.NewNumericDate(now),
+		ID:           sa.GetId(),
+		Programmatic: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{string(token), expiry.UTC()})
+	return nil
+}
+
+func isRouteHostname(policies []config.Policy, hostname string) bool {
+	for _, p := range policies {
+		if p.Source != nil && p.Source.Hostname() == hostname {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package authenticate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/encoding/jws"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestAuthenticate_serviceAccountToken(t *testing.T) {
+	t.Parallel()
+
+	signer, err := jws.NewHS256Signer(nil)
+	require.NoError(t, err)
+
+	serviceAccounts := map[string]*user.ServiceAccount{
+		"SA_GOOD":    {Id: "SA_GOOD", UserId: "USER_ID"},
+		"SA_EXPIRED": {Id: "SA_EXPIRED", UserId: "USER_ID", ExpiresAt: timestamppb.New(time.Now().Add(-time.Minute))},
+		"SA_SOON":    {Id: "SA_SOON", UserId: "USER_ID", ExpiresAt: timestamppb.New(time.Now().Add(time.Minute))},
+	}
+
+	o := config.NewAtomicOptions()
+	o.Store(&config.Options{
+		Policies: []config.Policy{{
+			Source: &config.StringURL{URL: mustParseURL("https://from.example.com")},
+		}},
+	})
+	a := &Authenticate{
+		options: o,
+		state: newAtomicAuthenticateState(&authenticateState{
+			redirectURL:   mustParseURL("https://authenticate.example.com/oauth2/callback"),
+			cookieSecret:  cryptutil.NewKey(),
+			sharedEncoder: signer,
+			dataBrokerClient: mockDataBrokerServiceClient{
+				get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+					sa, ok := serviceAccounts[in.GetId()]
+					if !ok {
+						return nil, status.Error(codes.NotFound, "not found")
+					}
+					data, err := anypb.New(sa)
+					if err != nil {
+						return nil, err
+					}
+					return &databroker.GetResponse{
+						Record: &databroker.Record{
+							Version: 1,
+							Type:    data.GetTypeUrl(),
+							Id:      sa.GetId(),
+							Data:    data,
+						},
+					}, nil
+				},
+			},
+		}),
+	}
+
+	sign := func(state *sessions.State) string {
+		raw, err := signer.Marshal(state)
+		require.NoError(t, err)
+		return "Pomerium " + string(raw)
+	}
+	credential := func(id string) string {
+		return sign(&sessions.State{ID: id})
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		audience      string
+		wantCode      int
+		wantExpiry    time.Duration
+	}{
+		{"good", credential("SA_GOOD"), "from.example.com", http.StatusOK, serviceAccountTokenTTL},
+		{"expires with service account", credential("SA_SOON"), "from.example.com", http.StatusOK, time.Minute},
+		{"missing credential", "", "from.example.com", http.StatusUnauthorized, 0},
+		{"bad credential", "Pomerium not-a-jwt", "from.example.com", http.StatusUnauthorized, 0},
+		{"unknown service account", credential("SA_MISSING"), "from.example.com", http.StatusUnauthorized, 0},
+		{"expired service account", credential("SA_EXPIRED"), "from.example.com", http.StatusUnauthorized, 0},
+		{"expired credential", sign(&sessions.State{
+			ID:     "SA_GOOD",
+			Expiry: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		}), "from.example.com", http.StatusUnauthorized, 0},
+		{"issued token", sign(&sessions.State{
+			ID:           "SA_GOOD",
+			Audience:     jwt.Audience{"from.example.com"},
+			Expiry:       jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			Programmatic: true,
+		}), "from.example.com", http.StatusUnauthorized, 0},
+		{"missing audience", credential("SA_GOOD"), "", http.StatusBadRequest, 0},
+		{"unknown audience", credential("SA_GOOD"), "other.example.com", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"pomerium_audience": {tt.audience}}
+			r := httptest.NewRequest(http.MethodPost, "/.pomerium/service_account_token", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("Accept", "application/json")
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			a.Handler().ServeHTTP(w, r)
+			require.Equal(t, tt.wantCode, w.Code, w.Body.String())
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var res struct {
+				Token string `json:"token"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+
+			var token sessions.State
+			require.NoError(t, signer.Unmarshal([]byte(res.Token), &token))
+			assert.Equal(t, []string{"from.example.com"}, []string(token.Audience))
+			assert.Equal(t, "USER_ID", token.Subject)
+			assert.True(t, token.Programmatic)
+			assert.WithinDuration(t, time.Now().Add(tt.wantExpiry), token.Expiry.Time(), 5*time.Second)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package authenticate
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// signInThrottlePruneInterval is how often failures which have been forgotten are removed.
+const signInThrottlePruneInterval = time.Minute
+
+var errSignInThrottled = errors.New("too many failed sign ins")
+
+// A signInThrottle tracks the failed sign ins of client IP addresses and identities, to lock them out of
+// signing in after repeated failures, e.g. credential stuffing through the identity provider or replayed
+// callbacks.
+type signInThrottle struct {
+	now func() time.Time
+
+	mu         sync.Mutex
+	failures   map[string]*signInFailures
+	lastPruned time.Time
+}
+
+type signInFailures struct {
+	count       uint32
+	last        time.Time
+	lockedUntil time.Time
+}
+
+func newSignInThrottle() *signInThrottle {
+	return &signInThrottle{
+		now:      time.Now,
+		failures: make(map[string]*signInFailures),
+	}
+}
+
+// lockout returns how long any of the keys is still locked out for, or 0 if none are.
+func (t *signInThrottle) lockout(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var remaining time.Duration
+	for _, key := range keys {
+		if f, ok := t.failures[key]; ok && f.lockedUntil.After(now) && f.lockedUntil.Sub(now) > remaining {
+			remaining = f.lockedUntil.Sub(now)
+		}
+	}
+	return remaining
+}
+
+// recordFailure records a failed sign in of each of the keys. It returns the most consecutive failures of any
+// key, and the lockout which started, if any.
+func (t *signInThrottle) recordFailure(limit *config.SignInRateLimit, keys ...string) (uint32, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.prune(limit, now)
+
+	var count uint32
+	var lockout time.Duration
+	for _, key := range keys {
+		f, ok := t.failures[key]
+		if !ok {
+			f = new(signInFailures)
+			t.failures[key] = f
+		}
+		f.count++
+		f.last = now
+		if d := limit.GetLockout(f.count); d > 0 {
+			f.lockedUntil = now.Add(d)
+			if d > lockout {
+				lockout = d
+			}
+		}
+		if f.count > count {
+			count = f.count
+		}
+	}
+	return count, lockout
+}
+
+// recordSuccess forgets the failed sign ins of each of the keys.
+func (t *signInThrottle) recordSuccess(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		delete(t.failures, key)
+	}
+}
+
+func (t *signInThrottle) prune(limit *config.SignInRateLimit, now time.Time) {
+	if now.Sub(t.lastPruned) < signInThrottlePruneInterval {
+		return
+	}
+	t.lastPruned = now
+
+	maxLockout := limit.GetMaxLockout()
+	for key, f := range t.failures {
+		if now.After(f.lockedUntil) && now.Sub(f.last) > maxLockout {
+			delete(t.failures, key)
+		}
+	}
+}
+
+// checkSignInThrottle returns an error if the client IP address or the identity is locked out of signing in.
+func (a *Authenticate) checkSignInThrottle(w http.ResponseWriter, r *http.Request, identity string) error {
+	limit := a.options.Load().SignInRateLimit
+	if limit == nil {
+		return nil
+	}
+
+	ip := a.getClientIP(r)
+	remaining := a.signInThrottle.lockout(signInThrottleKeys(ip, identity)...)
+	if remaining <= 0 {
+		return nil
+	}
+
+	log.AccessInfo(r.Context()).
+		Str("service", "authenticate").
+		Str("event", "sign-in-throttled").
+		Str("ip", ip).
+		Str("identity", identity).
+		Dur("retry-after", remaining).
+		Msg("authenticate: sign in throttled")
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+	return httputil.NewError(http.StatusTooManyRequests, errSignInThrottled)
+}
+
+// recordSignInFailure records a failed sign in of the client IP address and the identity, if it's known.
+func (a *Authenticate) recordSignInFailure(ctx context.Context, r *http.Request, identity string, err error) {
+	limit := a.options.Load().SignInRateLimit
+	if limit == nil {
+		return
+	}
+
+	ip := a.getClientIP(r)
+	failures, lockout := a.signInThrottle.recordFailure(limit, signInThrottleKeys(ip, identity)...)
+	event, msg := "sign-in-failure", "authenticate: sign in failed"
+	if lockout > 0 {
+		event, msg = "sign-in-lockout", "authenticate: sign in locked out after repeated failures"
+	}
+	log.AccessInfo(ctx).
+		Str("service", "authenticate").
+		Str("event", event).
+		Str("ip", ip).
+		Str("identity", identity).
+		Uint32("failures", failures).
+		Dur("lockout", lockout).
+		Str("reason", err.Error()).
+		Msg(msg)
+}
+
+// recordSignInSuccess forgets the failed sign ins of the client IP address and the identity.
+func (a *Authenticate) recordSignInSuccess(r *http.Request, identity string) {
+	if a.options.Load().SignInRateLimit == nil {
+		return
+	}
+	a.signInThrottle.recordSuccess(signInThrottleKeys(a.getClientIP(r), identity)...)
+}
+
+// getClientIP returns the IP address of the client, which is the address envoy appended to the
+// X-Forwarded-For header, skipping the configured number of trusted hops.
+func (a *Authenticate) getClientIP(r *http.Request) string {
+	var hops []string
+	for _, value := range r.Header.Values(httputil.HeaderForwardedFor) {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if idx := len(hops) - 1 - int(a.options.Load().XffNumTrustedHops); len(hops) > 0 {
+		if idx < 0 {
+			idx = 0
+		}
+		if ip := httputil.ParseNodeIP(hops[idx]); ip != nil {
+			return ip.String()
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func signInThrottleKeys(ip, identity string) []string {
+	keys := []string{"ip:" + ip}
+	if identity != "" {
+		keys = append(keys, "identity:"+identity)
+	}
+	return keys
+}
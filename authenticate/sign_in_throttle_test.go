@@ -0,0 +1,92 @@
+package authenticate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/identity"
+)
+
+func TestSignInThrottle(t *testing.T) {
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	throttle := newSignInThrottle()
+	throttle.now = func() time.Time { return now }
+	limit := &config.SignInRateLimit{MaxFailures: 3, Lockout: time.Minute, MaxLockout: 3 * time.Minute}
+
+	for i, expect := range []time.Duration{0, 0, time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		count, lockout := throttle.recordFailure(limit, "ip:203.0.113.1")
+		assert.Equal(t, uint32(i+1), count)
+		assert.Equal(t, expect, lockout, "failure %d", i+1)
+	}
+	assert.Equal(t, 3*time.Minute, throttle.lockout("ip:203.0.113.1", "identity:USER_ID"))
+	assert.Equal(t, time.Duration(0), throttle.lockout("ip:203.0.113.2"))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, 2*time.Minute, throttle.lockout("ip:203.0.113.1"))
+
+	throttle.recordSuccess("ip:203.0.113.1")
+	assert.Equal(t, time.Duration(0), throttle.lockout("ip:203.0.113.1"))
+
+	t.Run("prune", func(t *testing.T) {
+		throttle.recordFailure(limit, "ip:203.0.113.3")
+		now = now.Add(time.Hour)
+		throttle.recordFailure(limit, "ip:203.0.113.4")
+		assert.NotContains(t, throttle.failures, "ip:203.0.113.3")
+		assert.Contains(t, throttle.failures, "ip:203.0.113.4")
+	})
+}
+
+func TestAuthenticate_getClientIP(t *testing.T) {
+	a := &Authenticate{options: config.NewAtomicOptions()}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal(t, "192.0.2.1", a.getClientIP(r))
+
+	r.Header.Add("X-Forwarded-For", "198.51.100.1, 203.0.113.1")
+	r.Header.Add("X-Forwarded-For", "10.0.0.1")
+	assert.Equal(t, "10.0.0.1", a.getClientIP(r))
+
+	opts := config.NewDefaultOptions()
+	opts.XffNumTrustedHops = 1
+	a.options.Store(opts)
+	assert.Equal(t, "203.0.113.1", a.getClientIP(r))
+
+	opts.XffNumTrustedHops = 5
+	assert.Equal(t, "198.51.100.1", a.getClientIP(r))
+}
+
+func TestAuthenticate_OAuthCallback_SignInThrottle(t *testing.T) {
+	a := &Authenticate{
+		options:        config.NewAtomicOptions(),
+		provider:       identity.NewAtomicAuthenticator(),
+		state:          newAtomicAuthenticateState(newAuthenticateState()),
+		signInThrottle: newSignInThrottle(),
+	}
+	opts := config.NewDefaultOptions()
+	opts.SignInRateLimit = &config.SignInRateLimit{MaxFailures: 2}
+	a.options.Store(opts)
+	a.provider.Store(identity.MockProvider{})
+
+	callback := func(ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/oauth2/callback?error=invalid_request", nil)
+		r.Header.Set("X-Forwarded-For", ip)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(a.OAuthCallback).ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, callback("203.0.113.1").Code)
+	assert.Equal(t, http.StatusBadRequest, callback("203.0.113.1").Code)
+	w := callback("203.0.113.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusBadRequest, callback("203.0.113.2").Code, "other clients shouldn't be locked out")
+}
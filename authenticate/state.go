@@ -125,20 +125,9 @@ func newAuthenticateStateFromConfig(cfg *config.Config) (*authenticateState, err
 
 	state.sessionStore = cookieStore
 	state.sessionLoaders = []sessions.SessionLoader{headerStore, cookieStore}
-	if cfg.Options.SigningKeyAlgorithm == "" {
-		cfg.Options.SigningKeyAlgorithm = string(jose.ES256)
-	}
-	state.jwk = new(jose.JSONWebKeySet)
-	if cfg.Options.SigningKey != "" {
-		decodedCert, err := base64.StdEncoding.DecodeString(cfg.Options.SigningKey)
-		if err != nil {
-			return nil, fmt.Errorf("authenticate: failed to decode signing key: %w", err)
-		}
-		jwk, err := cryptutil.PublicJWKFromBytes(decodedCert, jose.SignatureAlgorithm(cfg.Options.SigningKeyAlgorithm))
-		if err != nil {
-			return nil, fmt.Errorf("authenticate: failed to convert jwks: %w", err)
-		}
-		state.jwk.Keys = append(state.jwk.Keys, *jwk)
+	state.jwk, err = cfg.Options.GetPublicJWKS()
+	if err != nil {
+		return nil, fmt.Errorf("authenticate: %w", err)
 	}
 
 	sharedKey, err := cfg.Options.GetSharedKey()
@@ -151,13 +140,27 @@ func newAuthenticateStateFromConfig(cfg *config.Config) (*authenticateState, err
 		return nil, err
 	}
 
+	clientCert, err := cfg.Options.GetGRPCClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+
 	dataBrokerConn, err := grpc.GetGRPCClientConn(context.Background(), "databroker", &grpc.Options{
 		Addrs:                   urls,
 		OverrideCertificateName: cfg.Options.OverrideCertificateName,
 		CA:                      cfg.Options.CA,
 		CAFile:                  cfg.Options.CAFile,
+		ClientCertificate:       clientCert,
+		SPIREAgentSocket:        cfg.Options.SPIREAgentSocket,
+		InternalCA:              cfg.Options.GetInternalCA(),
 		RequestTimeout:          cfg.Options.GRPCClientTimeout,
 		ClientDNSRoundRobin:     cfg.Options.GRPCClientDNSRoundRobin,
+		PoolSize:                cfg.Options.GRPCClientPoolSize,
+		KeepaliveTime:           cfg.Options.GRPCClientKeepaliveTime,
+		KeepaliveTimeout:        cfg.Options.GRPCClientKeepaliveTimeout,
+		BackoffMaxDelay:         cfg.Options.GRPCClientBackoffMaxDelay,
+		CircuitBreakerThreshold: cfg.Options.GRPCClientCircuitBreakerThreshold,
+		CircuitBreakerTimeout:   cfg.Options.GRPCClientCircuitBreakerTimeout,
 		WithInsecure:            cfg.Options.GetGRPCInsecure(),
 		InstallationID:          cfg.Options.InstallationID,
 		ServiceName:             cfg.Options.Services,
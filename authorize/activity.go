@@ -0,0 +1,180 @@
+package authorize
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/internal/activity"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/requestid"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+const (
+	// sessionActivityInterval is how often the last seen time of a session is updated.
+	sessionActivityInterval = time.Minute
+	// activityQueueSize is the number of records waiting to be written to the databroker. Once the queue is
+	// full, records are dropped rather than slowing down authorize checks.
+	activityQueueSize = 1000
+	// unauthenticatedDecisionsPerMinute is how many deny decisions without a session are recorded each minute,
+	// so that anonymous traffic, such as scanners, can't push the decisions of users out of the databroker.
+	unauthenticatedDecisionsPerMinute = 60
+)
+
+// An activityRecorder writes session activity and deny decisions to the databroker in the background.
+type activityRecorder struct {
+	now     func() time.Time
+	records chan *databroker.Record
+
+	mu                         sync.Mutex
+	lastSeen                   map[string]time.Time
+	unauthenticatedWindowStart time.Time
+	unauthenticatedDecisions   int
+}
+
+func newActivityRecorder() *activityRecorder {
+	return &activityRecorder{
+		now:      time.Now,
+		records:  make(chan *databroker.Record, activityQueueSize),
+		lastSeen: make(map[string]time.Time),
+	}
+}
+
+// Run writes the recorded activity to the databroker until the context is canceled.
+func (r *activityRecorder) Run(ctx context.Context, getClient func() databroker.DataBrokerServiceClient) error {
+	capacities := map[string]uint64{
+		activity.SessionRecordType:  activity.SessionCapacity,
+		activity.DecisionRecordType: activity.DecisionCapacity,
+	}
+	optionsSet := make(map[string]bool)
+	for {
+		var record *databroker.Record
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case record = <-r.records:
+		}
+
+		client := getClient()
+		if !optionsSet[record.GetType()] {
+			_, err := client.SetOptions(ctx, &databroker.SetOptionsRequest{
+				Type: record.GetType(),
+				Options: &databroker.Options{
+					Capacity: proto.Uint64(capacities[record.GetType()]),
+				},
+			})
+			if err != nil {
+				log.Warn(ctx).Err(err).Str("type", record.GetType()).Msg("authorize: error setting activity record options")
+				continue
+			}
+			optionsSet[record.GetType()] = true
+		}
+
+		_, err := client.Put(ctx, &databroker.PutRequest{Record: record})
+		if err != nil {
+			log.Warn(ctx).Err(err).Str("type", record.GetType()).Msg("authorize: error saving activity record")
+		}
+	}
+}
+
+// RecordCheck records the activity of an authorize check: the last seen time of its session, and the
+// decision if the request was denied. Redirects to sign in aren't recorded as decisions, and the decisions of
+// requests without a session are rate limited.
+func (r *activityRecorder) RecordCheck(
+	ctx context.Context,
+	in *envoy_service_auth_v3.CheckRequest, out *envoy_service_auth_v3.CheckResponse,
+	res *evaluator.Result, routeID string, s sessionOrServiceAccount, u *user.User,
+) {
+	now := r.now()
+
+	if sess, ok := s.(*session.Session); ok && r.shouldRecordSession(sess.GetId(), now) {
+		a := &activity.SessionActivity{
+			SessionID: sess.GetId(),
+			UserID:    sess.GetUserId(),
+			LastSeen:  now,
+		}
+		if record, err := a.ToRecord(); err == nil {
+			r.enqueue(ctx, record)
+		}
+	}
+
+	code := int(out.GetDeniedResponse().GetStatus().GetCode())
+	if code < http.StatusBadRequest {
+		return
+	}
+	if s == nil && !r.shouldRecordUnauthenticatedDecision(now) {
+		return
+	}
+	requestURL := getCheckRequestURL(in)
+	requestURL.RawQuery = ""
+	d := &activity.Decision{
+		ID:        uuid.NewString(),
+		RequestID: requestid.FromContext(ctx),
+		Time:      now,
+		Route:     routeID,
+		Method:    in.GetAttributes().GetRequest().GetHttp().GetMethod(),
+		URL:       requestURL.String(),
+		Status:    code,
+		Reason:    http.StatusText(code),
+	}
+	if s != nil {
+		d.UserID = s.GetUserId()
+	}
+	if sess, ok := s.(*session.Session); ok {
+		d.SessionID = sess.GetId()
+	}
+	d.Email = u.GetEmail()
+	if res != nil && res.Deny != nil && res.Deny.Message != "" {
+		d.Reason = res.Deny.Message
+	}
+	if record, err := d.ToRecord(); err == nil {
+		r.enqueue(ctx, record)
+	}
+}
+
+func (r *activityRecorder) shouldRecordSession(sessionID string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last, ok := r.lastSeen[sessionID]; ok && now.Sub(last) < sessionActivityInterval {
+		return false
+	}
+	// the databroker only keeps the most recent sessions, so there's no need to remember more than that
+	if len(r.lastSeen) >= activity.SessionCapacity {
+		r.lastSeen = make(map[string]time.Time)
+	}
+	r.lastSeen[sessionID] = now
+	return true
+}
+
+func (r *activityRecorder) shouldRecordUnauthenticatedDecision(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Sub(r.unauthenticatedWindowStart) >= time.Minute {
+		r.unauthenticatedWindowStart = now
+		r.unauthenticatedDecisions = 0
+	}
+	if r.unauthenticatedDecisions >= unauthenticatedDecisionsPerMinute {
+		return false
+	}
+	r.unauthenticatedDecisions++
+	return true
+}
+
+func (r *activityRecorder) enqueue(ctx context.Context, record *databroker.Record) {
+	select {
+	case r.records <- record:
+	default:
+		log.Debug(ctx).Str("type", record.GetType()).Msg("authorize: activity queue is full, dropping record")
+	}
+}
@@ -0,0 +1,167 @@
+package authorize
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	envoy_type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/internal/activity"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestActivityRecorder_RecordCheck(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	r := newActivityRecorder()
+	r.now = func() time.Time { return now }
+
+	in := &envoy_service_auth_v3.CheckRequest{
+		Attributes: &envoy_service_auth_v3.AttributeContext{
+			Request: &envoy_service_auth_v3.AttributeContext_Request{
+				Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+					Method: http.MethodPost,
+					Scheme: "https",
+					Host:   "example.com",
+					Path:   "/admin?token=secret",
+				},
+			},
+		},
+	}
+	denied := func(code envoy_type_v3.StatusCode) *envoy_service_auth_v3.CheckResponse {
+		return &envoy_service_auth_v3.CheckResponse{
+			HttpResponse: &envoy_service_auth_v3.CheckResponse_DeniedResponse{
+				DeniedResponse: &envoy_service_auth_v3.DeniedHttpResponse{
+					Status: &envoy_type_v3.HttpStatus{Code: code},
+				},
+			},
+		}
+	}
+	s := &session.Session{Id: "SESSION_ID", UserId: "USER_ID"}
+	u := &user.User{Id: "USER_ID", Email: "user@example.com"}
+	res := &evaluator.Result{Deny: &evaluator.Denial{Status: http.StatusForbidden, Message: "blocked by policy"}}
+
+	t.Run("denied", func(t *testing.T) {
+		r.RecordCheck(ctx, in, denied(envoy_type_v3.StatusCode_Forbidden), res, "1234", s, u)
+		require.Len(t, r.records, 2)
+
+		sa, err := activity.SessionFromRecord(<-r.records)
+		require.NoError(t, err)
+		assert.Equal(t, &activity.SessionActivity{SessionID: "SESSION_ID", UserID: "USER_ID", LastSeen: now}, sa)
+
+		d, err := activity.DecisionFromRecord(<-r.records)
+		require.NoError(t, err)
+		assert.NotEmpty(t, d.ID)
+		d.ID = ""
+		assert.Equal(t, &activity.Decision{
+			Time:      now,
+			Route:     "1234",
+			Method:    http.MethodPost,
+			URL:       "https://example.com/admin",
+			SessionID: "SESSION_ID",
+			UserID:    "USER_ID",
+			Email:     "user@example.com",
+			Status:    http.StatusForbidden,
+			Reason:    "blocked by policy",
+		}, d)
+	})
+	t.Run("throttled", func(t *testing.T) {
+		now = now.Add(sessionActivityInterval / 2)
+		r.RecordCheck(ctx, in, &envoy_service_auth_v3.CheckResponse{}, nil, "1234", s, u)
+		assert.Len(t, r.records, 0)
+
+		now = now.Add(sessionActivityInterval)
+		r.RecordCheck(ctx, in, &envoy_service_auth_v3.CheckResponse{}, nil, "1234", s, u)
+		require.Len(t, r.records, 1)
+		sa, err := activity.SessionFromRecord(<-r.records)
+		require.NoError(t, err)
+		assert.Equal(t, now, sa.LastSeen)
+	})
+	t.Run("unauthenticated", func(t *testing.T) {
+		r.RecordCheck(ctx, in, denied(envoy_type_v3.StatusCode_Found), nil, "1234", nil, nil)
+		assert.Len(t, r.records, 0)
+
+		r.RecordCheck(ctx, in, denied(envoy_type_v3.StatusCode_Unauthorized), nil, "1234", nil, nil)
+		require.Len(t, r.records, 1)
+		d, err := activity.DecisionFromRecord(<-r.records)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, d.Status)
+		assert.Equal(t, "Unauthorized", d.Reason)
+		assert.Empty(t, d.UserID)
+	})
+	t.Run("unauthenticated rate limit", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		for i := 0; i < unauthenticatedDecisionsPerMinute+10; i++ {
+			r.RecordCheck(ctx, in, denied(envoy_type_v3.StatusCode_Unauthorized), nil, "1234", nil, nil)
+		}
+		assert.Len(t, r.records, unauthenticatedDecisionsPerMinute)
+		for len(r.records) > 0 {
+			<-r.records
+		}
+
+		r.RecordCheck(ctx, in, denied(envoy_type_v3.StatusCode_Forbidden), res, "1234", s, u)
+		require.Len(t, r.records, 2, "decisions with a session shouldn't be limited")
+		<-r.records
+		d, err := activity.DecisionFromRecord(<-r.records)
+		require.NoError(t, err)
+		assert.Equal(t, "USER_ID", d.UserID)
+
+		now = now.Add(time.Minute)
+		r.RecordCheck(ctx, in, denied(envoy_type_v3.StatusCode_Unauthorized), nil, "1234", nil, nil)
+		assert.Len(t, r.records, 1)
+		<-r.records
+	})
+}
+
+type activityDataBrokerServiceClient struct {
+	databroker.DataBrokerServiceClient
+
+	options map[string]*databroker.Options
+	puts    chan *databroker.Record
+}
+
+func (m *activityDataBrokerServiceClient) SetOptions(ctx context.Context, in *databroker.SetOptionsRequest, opts ...grpc.CallOption) (*databroker.SetOptionsResponse, error) {
+	m.options[in.GetType()] = in.GetOptions()
+	return new(databroker.SetOptionsResponse), nil
+}
+
+func (m *activityDataBrokerServiceClient) Put(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error) {
+	m.puts <- in.GetRecord()
+	return new(databroker.PutResponse), nil
+}
+
+func TestActivityRecorder_Run(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := &activityDataBrokerServiceClient{
+		options: make(map[string]*databroker.Options),
+		puts:    make(chan *databroker.Record),
+	}
+	r := newActivityRecorder()
+	go func() {
+		_ = r.Run(ctx, func() databroker.DataBrokerServiceClient { return client })
+	}()
+
+	record, err := (&activity.SessionActivity{SessionID: "SESSION_ID", LastSeen: time.Now()}).ToRecord()
+	require.NoError(t, err)
+	r.enqueue(ctx, record)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("record was not saved")
+	case put := <-client.puts:
+		assert.Equal(t, activity.SessionRecordType, put.GetType())
+		assert.Equal(t, "SESSION_ID", put.GetId())
+	}
+	assert.Equal(t, uint64(activity.SessionCapacity), client.options[activity.SessionRecordType].GetCapacity())
+}
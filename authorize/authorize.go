@@ -7,6 +7,10 @@ import (
 	"fmt"
 	"html/template"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
 
 	"github.com/pomerium/pomerium/authorize/evaluator"
 	"github.com/pomerium/pomerium/config"
@@ -15,6 +19,8 @@ import (
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	registrypb "github.com/pomerium/pomerium/pkg/grpc/registry"
 )
 
 // Authorize struct holds
@@ -24,12 +30,27 @@ type Authorize struct {
 	currentOptions *config.AtomicOptions
 	templates      *template.Template
 
+	// policyIndex holds the *policyIndexEntry for the current options.
+	policyIndex atomic.Value
+
 	dataBrokerInitialSync chan struct{}
+	partitioner           *sessionPartitioner
+
+	// activity records session activity and deny decisions for the admin API.
+	activity *activityRecorder
+	// decisionHook sends the summaries of decisions to the decision hook.
+	decisionHook *decisionHook
+
+	// policyBundleConfigChanged signals the policy bundle syncer to fetch the bundle again.
+	policyBundleConfigChanged chan struct{}
 
 	// The stateLock prevents updating the evaluator store simultaneously with an evaluation.
 	// This should provide a consistent view of the data at a given server/record version and
 	// avoid partial updates.
 	stateLock sync.RWMutex
+
+	signingKeyRotationMu    sync.Mutex
+	signingKeyRotationTimer *time.Timer
 }
 
 // New validates and creates a new Authorize service from a set of config options.
@@ -39,9 +60,15 @@ func New(cfg *config.Config) (*Authorize, error) {
 		store:                 evaluator.NewStore(),
 		templates:             template.Must(frontend.NewTemplates()),
 		dataBrokerInitialSync: make(chan struct{}),
+		partitioner:           newSessionPartitioner(),
+		activity:              newActivityRecorder(),
+		decisionHook:          newDecisionHook(),
+
+		policyBundleConfigChanged: make(chan struct{}, 1),
 	}
+	a.partitioner.SetEnabled(cfg.Options.AuthorizeSessionPartitioning)
 
-	state, err := newAuthorizeStateFromConfig(cfg, a.store)
+	state, err := newAuthorizeStateFromConfig(cfg, a.store, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +79,29 @@ func New(cfg *config.Config) (*Authorize, error) {
 
 // Run runs the authorize service.
 func (a *Authorize) Run(ctx context.Context) error {
-	return newDataBrokerSyncer(a).Run(ctx)
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		return a.partitioner.Run(ctx, func() registrypb.RegistryClient {
+			return a.state.Load().registryClient
+		})
+	})
+	eg.Go(func() error {
+		return newDataBrokerSyncer(a).Run(ctx)
+	})
+	eg.Go(func() error {
+		return newPolicyBundleSyncer(a).Run(ctx)
+	})
+	eg.Go(func() error {
+		return a.activity.Run(ctx, func() databroker.DataBrokerServiceClient {
+			return a.state.Load().dataBrokerClient
+		})
+	})
+	eg.Go(func() error {
+		return a.decisionHook.Run(ctx, a.currentOptions.Load, func() databroker.DataBrokerServiceClient {
+			return a.state.Load().dataBrokerClient
+		})
+	})
+	return eg.Wait()
 }
 
 // WaitForInitialSync blocks until the initial sync is complete.
@@ -80,8 +129,9 @@ func validateOptions(o *config.Options) error {
 	return nil
 }
 
-// newPolicyEvaluator returns an policy evaluator.
-func newPolicyEvaluator(opts *config.Options, store *evaluator.Store) (*evaluator.Evaluator, error) {
+// newPolicyEvaluator returns an policy evaluator. Policies which haven't changed since the previous
+// evaluator are not compiled again.
+func newPolicyEvaluator(opts *config.Options, store *evaluator.Store, previous *evaluator.Evaluator) (*evaluator.Evaluator, error) {
 	metrics.AddPolicyCountCallback("pomerium-authorize", func() int64 {
 		return int64(len(opts.GetAllPolicies()))
 	})
@@ -94,27 +144,85 @@ func newPolicyEvaluator(opts *config.Options, store *evaluator.Store) (*evaluato
 		return nil, fmt.Errorf("authorize: invalid client CA: %w", err)
 	}
 
+	clientCRL, err := opts.GetClientCRL()
+	if err != nil {
+		return nil, fmt.Errorf("authorize: invalid client CRL: %w", err)
+	}
+
 	authenticateURL, err := opts.GetAuthenticateURL()
 	if err != nil {
 		return nil, fmt.Errorf("authorize: invalid authenticate url: %w", err)
 	}
 
-	return evaluator.New(ctx, store,
+	// shared URLs are disabled without a shared key, which is validated with the rest of the options
+	sharedKey, _ := opts.GetSharedKey()
+
+	var signingKey, signingKeyAlgorithm string
+	if activeSigningKey, err := opts.GetActiveSigningKey(time.Now()); err != nil {
+		return nil, fmt.Errorf("authorize: invalid signing key: %w", err)
+	} else if activeSigningKey != nil {
+		signingKey, signingKeyAlgorithm = activeSigningKey.Key, activeSigningKey.Algorithm
+	}
+
+	return evaluator.New(ctx, store, previous,
 		evaluator.WithPolicies(opts.GetAllPolicies()),
 		evaluator.WithClientCA(clientCA),
-		evaluator.WithSigningKey(opts.SigningKeyAlgorithm, opts.SigningKey),
+		evaluator.WithClientCRL(clientCRL),
+		evaluator.WithClientCRLURL(opts.ClientCRLURL),
+		evaluator.WithClientOCSP(opts.ClientOCSP),
+		evaluator.WithClientRevocationSoftFail(opts.ClientRevocationSoftFail),
+		evaluator.WithSigningKey(signingKeyAlgorithm, signingKey),
 		evaluator.WithAuthenticateURL(authenticateURL.String()),
 		evaluator.WithGoogleCloudServerlessAuthenticationServiceAccount(opts.GetGoogleCloudServerlessAuthenticationServiceAccount()),
 		evaluator.WithJWTClaimsHeaders(opts.JWTClaimsHeaders),
+		evaluator.WithProviderURL(opts.ProviderURL),
+		evaluator.WithSharedKey(sharedKey),
+		evaluator.WithGroupsClaim(opts.GroupsClaim),
+		evaluator.WithClaimTransforms(opts.ClaimTransforms),
 	)
 }
 
 // OnConfigChange updates internal structures based on config.Options
 func (a *Authorize) OnConfigChange(ctx context.Context, cfg *config.Config) {
 	a.currentOptions.Store(cfg.Options)
-	if state, err := newAuthorizeStateFromConfig(cfg, a.store); err != nil {
+	a.partitioner.SetEnabled(cfg.Options.AuthorizeSessionPartitioning)
+	// build the policy index now rather than on the first request
+	a.getPolicyIndex()
+	if state, err := newAuthorizeStateFromConfig(cfg, a.store, a.state.Load()); err != nil {
 		log.Error(ctx).Err(err).Msg("authorize: error updating state")
 	} else {
 		a.state.Store(state)
 	}
+	a.scheduleSigningKeyRotation(ctx, cfg)
+
+	select {
+	case a.policyBundleConfigChanged <- struct{}{}:
+	default:
+	}
+}
+
+// scheduleSigningKeyRotation rebuilds the state when the next signing key becomes active, so that the new key
+// is used without a configuration change.
+func (a *Authorize) scheduleSigningKeyRotation(ctx context.Context, cfg *config.Config) {
+	a.signingKeyRotationMu.Lock()
+	defer a.signingKeyRotationMu.Unlock()
+
+	if a.signingKeyRotationTimer != nil {
+		a.signingKeyRotationTimer.Stop()
+		a.signingKeyRotationTimer = nil
+	}
+
+	next, ok := cfg.Options.GetNextSigningKeyRotation(time.Now())
+	if !ok {
+		return
+	}
+	log.Info(ctx).Time("at", next).Msg("authorize: scheduled signing key rotation")
+	a.signingKeyRotationTimer = time.AfterFunc(time.Until(next), func() {
+		// ignore the rotation if the config has changed since it was scheduled
+		if a.currentOptions.Load() != cfg.Options {
+			return
+		}
+		log.Info(ctx).Msg("authorize: rotating signing key")
+		a.OnConfigChange(ctx, cfg)
+	})
 }
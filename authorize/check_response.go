@@ -15,6 +15,7 @@ import (
 	envoy_type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/tniswong/go.rfcx/rfc7231"
+	octrace "go.opencensus.io/trace"
 	"google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc/codes"
 
@@ -22,14 +23,23 @@ import (
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry/requestid"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
 )
 
-func (a *Authorize) okResponse(reply *evaluator.Result) *envoy_service_auth_v3.CheckResponse {
+func (a *Authorize) okResponse(ctx context.Context, reply *evaluator.Result) *envoy_service_auth_v3.CheckResponse {
 	var requestHeaders []*envoy_config_core_v3.HeaderValueOption
 	for k, vs := range reply.Headers {
 		requestHeaders = append(requestHeaders, mkHeader(k, strings.Join(vs, ","), false))
 	}
+	// propagate the authorize span to the upstream so its spans are part of the same trace
+	if span := octrace.FromContext(ctx); span != nil {
+		traceparent, tracestate := trace.SpanContextToW3CHeaders(span.SpanContext())
+		requestHeaders = append(requestHeaders, mkHeader(trace.TraceparentHeader, traceparent, false))
+		if tracestate != "" {
+			requestHeaders = append(requestHeaders, mkHeader(trace.TracestateHeader, tracestate, false))
+		}
+	}
 	// ensure request headers are sorted by key for deterministic output
 	sort.Slice(requestHeaders, func(i, j int) bool {
 		return requestHeaders[i].Header.Key < requestHeaders[j].Header.Value
@@ -47,7 +57,7 @@ func (a *Authorize) okResponse(reply *evaluator.Result) *envoy_service_auth_v3.C
 func (a *Authorize) deniedResponse(
 	ctx context.Context,
 	in *envoy_service_auth_v3.CheckRequest,
-	code int32, reason string, headers map[string]string,
+	code int32, errorCode httputil.ErrorCode, reason string, headers map[string]string,
 ) (*envoy_service_auth_v3.CheckResponse, error) {
 	var details string
 	switch code {
@@ -69,10 +79,18 @@ func (a *Authorize) deniedResponse(
 	// run the request through our go error handler
 	httpErr := httputil.HTTPError{
 		Status:    int(code),
+		Code:      errorCode,
 		Err:       errors.New(details),
 		DebugURL:  debugEndpoint,
 		RequestID: requestid.FromContext(ctx),
 	}
+	switch code {
+	case http.StatusUnauthorized:
+		// signing in is the remediation for clients which weren't redirected to sign in
+		httpErr.RemediationURL, _ = a.signInURL(in)
+	case http.StatusForbidden:
+		httpErr.AccessRequestURL, _ = a.accessRequestURL(in)
+	}
 	httpErr.ErrorResponse(w, r)
 
 	// transpose the go http response writer into a envoy response
@@ -106,6 +124,24 @@ func (a *Authorize) deniedResponse(
 }
 
 func (a *Authorize) requireLoginResponse(ctx context.Context, in *envoy_service_auth_v3.CheckRequest) (*envoy_service_auth_v3.CheckResponse, error) {
+	if !shouldRedirect(in) {
+		return a.deniedResponse(ctx, in,
+			http.StatusUnauthorized, httputil.ErrorCodeUnauthenticated, http.StatusText(http.StatusUnauthorized), nil)
+	}
+
+	signinURL, err := a.signInURL(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.deniedResponse(ctx, in, http.StatusFound, httputil.ErrorCodeUnauthenticated, "Login", map[string]string{
+		"Location": signinURL.String(),
+	})
+}
+
+// signInURL returns the signed url of the authenticate service's sign in page, which redirects back to the
+// request's url.
+func (a *Authorize) signInURL(in *envoy_service_auth_v3.CheckRequest) (*url.URL, error) {
 	opts := a.currentOptions.Load()
 	state := a.state.Load()
 	authenticateURL, err := opts.GetAuthenticateURL()
@@ -113,10 +149,6 @@ func (a *Authorize) requireLoginResponse(ctx context.Context, in *envoy_service_
 		return nil, err
 	}
 
-	if !shouldRedirect(in) {
-		return a.deniedResponse(ctx, in, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized), nil)
-	}
-
 	signinURL := authenticateURL.ResolveReference(&url.URL{
 		Path: "/.pomerium/sign_in",
 	})
@@ -128,11 +160,7 @@ func (a *Authorize) requireLoginResponse(ctx context.Context, in *envoy_service_
 
 	q.Set(urlutil.QueryRedirectURI, url.String())
 	signinURL.RawQuery = q.Encode()
-	redirectTo := urlutil.NewSignedURL(state.sharedKey, signinURL).String()
-
-	return a.deniedResponse(ctx, in, http.StatusFound, "Login", map[string]string{
-		"Location": redirectTo,
-	})
+	return urlutil.NewSignedURL(state.sharedKey, signinURL).Sign(), nil
 }
 
 func mkHeader(k, v string, shouldAppend bool) *envoy_config_core_v3.HeaderValueOption {
@@ -163,6 +191,27 @@ func toEnvoyHeaders(headers http.Header) []*envoy_config_core_v3.HeaderValueOpti
 
 // userInfoEndpointURL returns the user info endpoint url which can be used to debug the user's
 // session that lives on the authenticate service.
+// accessRequestURL returns the URL to request access to the request's route, or nil if the route doesn't accept
+// access requests.
+func (a *Authorize) accessRequestURL(in *envoy_service_auth_v3.CheckRequest) (*url.URL, error) {
+	requestURL := getCheckRequestURL(in)
+	policy := a.getMatchingPolicy(requestURL)
+	if policy == nil || policy.AccessRequests == nil {
+		return nil, nil
+	}
+
+	authenticateURL, err := a.currentOptions.Load().GetAuthenticateURL()
+	if err != nil {
+		return nil, err
+	}
+	return authenticateURL.ResolveReference(&url.URL{
+		Path: "/.pomerium/access_request",
+		RawQuery: url.Values{
+			urlutil.QueryRedirectURI: {requestURL.String()},
+		}.Encode(),
+	}), nil
+}
+
 func (a *Authorize) userInfoEndpointURL(in *envoy_service_auth_v3.CheckRequest) (*url.URL, error) {
 	opts := a.currentOptions.Load()
 	authenticateURL, err := opts.GetAuthenticateURL()
@@ -204,6 +253,7 @@ func shouldRedirect(in *envoy_service_auth_v3.CheckRequest) bool {
 	mediaType, ok := a.MostAcceptable([]string{
 		"text/html",
 		"application/json",
+		httputil.ContentTypeProblemJSON,
 		"text/plain",
 		"application/grpc-web-text",
 		"application/grpc-web+proto",
@@ -2,6 +2,7 @@ package authorize
 
 import (
 	"context"
+	"encoding/json"
 	"html/template"
 	"net/http"
 	"net/url"
@@ -20,6 +21,7 @@ import (
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/encoding/jws"
 	"github.com/pomerium/pomerium/internal/frontend"
+	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/testutil"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
 	"github.com/pomerium/pomerium/pkg/grpc/user"
@@ -52,7 +54,7 @@ func TestAuthorize_okResponse(t *testing.T) {
 			Email: "foo@example.com",
 		},
 	)
-	pe, err := newPolicyEvaluator(opt, a.store)
+	pe, err := newPolicyEvaluator(opt, a.store, nil)
 	require.NoError(t, err)
 	a.state.Load().evaluator = pe
 
@@ -93,7 +95,7 @@ func TestAuthorize_okResponse(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got := a.okResponse(tc.reply)
+			got := a.okResponse(context.Background(), tc.reply)
 			assert.Equal(t, tc.want.Status.Code, got.Status.Code)
 			assert.Equal(t, tc.want.Status.Message, got.Status.Message)
 			want, _ := protojson.Marshal(tc.want.GetOkResponse())
@@ -151,7 +153,7 @@ func TestAuthorize_deniedResponse(t *testing.T) {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			t.Parallel()
-			got, err := a.deniedResponse(context.TODO(), tc.in, tc.code, tc.reason, tc.headers)
+			got, err := a.deniedResponse(context.TODO(), tc.in, tc.code, httputil.ErrorCodeForStatus(int(tc.code)), tc.reason, tc.headers)
 			require.NoError(t, err)
 			assert.Equal(t, tc.want.Status.Code, got.Status.Code)
 			assert.Equal(t, tc.want.Status.Message, got.Status.Message)
@@ -160,6 +162,49 @@ func TestAuthorize_deniedResponse(t *testing.T) {
 	}
 }
 
+func TestAuthorize_accessRequestURL(t *testing.T) {
+	a := &Authorize{currentOptions: config.NewAtomicOptions(), state: newAtomicAuthorizeState(new(authorizeState))}
+	a.currentOptions.Store(&config.Options{
+		AuthenticateURLString: "https://authenticate.example.com",
+		Policies: []config.Policy{
+			{
+				Source:         &config.StringURL{URL: &url.URL{Scheme: "https", Host: "from.example.com"}},
+				AccessRequests: &config.AccessRequests{},
+			},
+			{
+				Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "other.example.com"}},
+			},
+		},
+	})
+	checkRequest := func(host string) *envoy_service_auth_v3.CheckRequest {
+		return &envoy_service_auth_v3.CheckRequest{
+			Attributes: &envoy_service_auth_v3.AttributeContext{
+				Request: &envoy_service_auth_v3.AttributeContext_Request{
+					Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+						Scheme: "https",
+						Host:   host,
+						Path:   "/some/path",
+					},
+				},
+			},
+		}
+	}
+
+	u, err := a.accessRequestURL(checkRequest("from.example.com"))
+	require.NoError(t, err)
+	require.NotNil(t, u)
+	assert.Equal(t, "authenticate.example.com", u.Host)
+	assert.Equal(t, "/.pomerium/access_request", u.Path)
+	redirectURL, err := url.Parse(u.Query().Get("pomerium_redirect_uri"))
+	require.NoError(t, err)
+	assert.Equal(t, "from.example.com", redirectURL.Hostname())
+	assert.Equal(t, "/some/path", redirectURL.Path)
+
+	u, err = a.accessRequestURL(checkRequest("other.example.com"))
+	require.NoError(t, err)
+	assert.Nil(t, u)
+}
+
 func mustParseWeightedURLs(t *testing.T, urls ...string) []config.WeightedURL {
 	wu, err := config.ParseWeightedUrls(urls...)
 	require.NoError(t, err)
@@ -209,4 +254,29 @@ func TestRequireLogin(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusUnauthorized, int(res.GetDeniedResponse().GetStatus().GetCode()))
 	})
+	t.Run("accept problem json", func(t *testing.T) {
+		res, err := a.requireLoginResponse(context.Background(), &envoy_service_auth_v3.CheckRequest{
+			Attributes: &envoy_service_auth_v3.AttributeContext{
+				Request: &envoy_service_auth_v3.AttributeContext_Request{
+					Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+						Host: "from.example.com",
+						Path: "/some/path",
+						Headers: map[string]string{
+							"accept": "application/problem+json",
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, int(res.GetDeniedResponse().GetStatus().GetCode()))
+
+		var problem map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(res.GetDeniedResponse().GetBody()), &problem))
+		assert.Equal(t, "unauthenticated", problem["code"])
+		assert.Equal(t, "urn:pomerium:error:unauthenticated", problem["type"])
+		remediationURL, err := url.Parse(problem["remediation_url"].(string))
+		require.NoError(t, err)
+		assert.Equal(t, "/.pomerium/sign_in", remediationURL.Path)
+	})
 }
@@ -0,0 +1,86 @@
+package authorize
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+const (
+	// concurrencyLeaseMetadataKey is the key of the lease of a request in the ext_authz dynamic metadata. The
+	// control plane releases it when envoy logs the completed request.
+	concurrencyLeaseMetadataKey = "pomerium_concurrency_lease"
+	// defaultConcurrencyLeaseDuration is how long the lease of a request to a route without a timeout is held,
+	// if it isn't released.
+	defaultConcurrencyLeaseDuration = 5 * time.Minute
+)
+
+// A concurrencyLease is a databroker lease on one of the concurrent requests a user may make to a route.
+type concurrencyLease struct {
+	name, id string
+}
+
+// acquireConcurrencyLease acquires one of the concurrent requests the user may make to the route, if it limits
+// them. It returns false if the user is already making as many requests as the route allows. The lease is
+// released when the request completes, or expires after the route's timeout.
+func (a *Authorize) acquireConcurrencyLease(
+	ctx context.Context, policy *config.Policy, s sessionOrServiceAccount,
+) (*concurrencyLease, bool) {
+	if policy == nil || policy.MaxConcurrentRequestsPerUser == 0 || s == nil || s.GetUserId() == "" {
+		return nil, true
+	}
+
+	duration := getConcurrencyLeaseDuration(a.currentOptions.Load(), policy)
+	client := a.state.Load().dataBrokerClient
+	for i := uint32(0); i < policy.MaxConcurrentRequestsPerUser; i++ {
+		name := getConcurrencyLeaseName(policy, s.GetUserId(), i)
+		res, err := client.AcquireLease(ctx, &databroker.AcquireLeaseRequest{
+			Name:     name,
+			Duration: durationpb.New(duration),
+		})
+		if status.Code(err) == codes.AlreadyExists {
+			continue
+		} else if err != nil {
+			// rather than rejecting every request to the route while the databroker is unavailable, the limit
+			// isn't enforced
+			log.Warn(ctx).Err(err).Msg("authorize: error acquiring concurrent request lease")
+			return nil, true
+		}
+		return &concurrencyLease{name: name, id: res.GetId()}, true
+	}
+	return nil, false
+}
+
+// toMetadata returns the ext_authz dynamic metadata which the control plane uses to release the lease.
+func (lease *concurrencyLease) toMetadata() *structpb.Struct {
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		concurrencyLeaseMetadataKey: structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"name": structpb.NewStringValue(lease.name),
+			"id":   structpb.NewStringValue(lease.id),
+		}}),
+	}}
+}
+
+func getConcurrencyLeaseName(policy *config.Policy, userID string, slot uint32) string {
+	return fmt.Sprintf("%s%s/%s/%d", config.ConcurrencyLeasePrefix, getRouteID(policy), userID, slot)
+}
+
+func getConcurrencyLeaseDuration(options *config.Options, policy *config.Policy) time.Duration {
+	timeout := options.DefaultUpstreamTimeout
+	if policy.UpstreamTimeout != nil {
+		timeout = *policy.UpstreamTimeout
+	}
+	if timeout <= 0 {
+		return defaultConcurrencyLeaseDuration
+	}
+	return timeout
+}
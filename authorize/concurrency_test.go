@@ -0,0 +1,96 @@
+package authorize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+type leaseDataBrokerServiceClient struct {
+	databroker.DataBrokerServiceClient
+
+	acquireLease func(ctx context.Context, in *databroker.AcquireLeaseRequest, opts ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error)
+}
+
+func (m leaseDataBrokerServiceClient) AcquireLease(ctx context.Context, in *databroker.AcquireLeaseRequest, opts ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error) {
+	return m.acquireLease(ctx, in, opts...)
+}
+
+func TestAuthorize_acquireConcurrencyLease(t *testing.T) {
+	ctx := context.Background()
+	a := &Authorize{currentOptions: config.NewAtomicOptions(), state: newAtomicAuthorizeState(new(authorizeState))}
+	a.currentOptions.Store(&config.Options{DefaultUpstreamTimeout: 30 * time.Second})
+
+	held := map[string]bool{}
+	var acquireErr error
+	a.state.Load().dataBrokerClient = leaseDataBrokerServiceClient{
+		acquireLease: func(ctx context.Context, in *databroker.AcquireLeaseRequest, opts ...grpc.CallOption) (*databroker.AcquireLeaseResponse, error) {
+			if acquireErr != nil {
+				return nil, acquireErr
+			}
+			assert.Equal(t, 30*time.Second, in.GetDuration().AsDuration())
+			if held[in.GetName()] {
+				return nil, status.Error(codes.AlreadyExists, "lease is already taken")
+			}
+			held[in.GetName()] = true
+			return &databroker.AcquireLeaseResponse{Id: "LEASE_" + in.GetName()}, nil
+		},
+	}
+
+	policy := &config.Policy{From: "https://from.example.com", MaxConcurrentRequestsPerUser: 2}
+	s := &session.Session{Id: "SESSION_ID", UserId: "USER_ID"}
+
+	t.Run("unlimited", func(t *testing.T) {
+		lease, ok := a.acquireConcurrencyLease(ctx, &config.Policy{From: "https://from.example.com"}, s)
+		assert.True(t, ok)
+		assert.Nil(t, lease)
+	})
+	t.Run("limited", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			lease, ok := a.acquireConcurrencyLease(ctx, policy, s)
+			require.True(t, ok)
+			require.NotNil(t, lease)
+			assert.True(t, strings.HasPrefix(lease.name, config.ConcurrencyLeasePrefix))
+			assert.True(t, strings.HasSuffix(lease.name, fmt.Sprintf("/USER_ID/%d", i)))
+			assert.Equal(t, "LEASE_"+lease.name, lease.id)
+		}
+
+		lease, ok := a.acquireConcurrencyLease(ctx, policy, s)
+		assert.False(t, ok, "every slot is held")
+		assert.Nil(t, lease)
+
+		lease, ok = a.acquireConcurrencyLease(ctx, policy, &session.Session{Id: "OTHER_SESSION_ID", UserId: "OTHER_USER_ID"})
+		assert.True(t, ok, "other users have their own slots")
+		assert.NotNil(t, lease)
+	})
+	t.Run("databroker error", func(t *testing.T) {
+		acquireErr = errors.New("unavailable")
+		defer func() { acquireErr = nil }()
+
+		lease, ok := a.acquireConcurrencyLease(ctx, policy, s)
+		assert.True(t, ok, "the limit isn't enforced when the databroker is unavailable")
+		assert.Nil(t, lease)
+	})
+}
+
+func TestGetConcurrencyLeaseDuration(t *testing.T) {
+	timeout := time.Minute
+	assert.Equal(t, time.Minute, getConcurrencyLeaseDuration(&config.Options{DefaultUpstreamTimeout: 30 * time.Second},
+		&config.Policy{UpstreamTimeout: &timeout}))
+	assert.Equal(t, 30*time.Second, getConcurrencyLeaseDuration(&config.Options{DefaultUpstreamTimeout: 30 * time.Second},
+		&config.Policy{}))
+	assert.Equal(t, defaultConcurrencyLeaseDuration, getConcurrencyLeaseDuration(&config.Options{}, &config.Policy{}))
+}
@@ -0,0 +1,197 @@
+package authorize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/requestid"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+const (
+	// decisionHookQueueSize is the number of decisions waiting to be sent to the decision hook. Once the queue
+	// is full, decisions are dropped rather than slowing down authorize checks.
+	decisionHookQueueSize = 1000
+	// decisionHookMaxResponseSize is the largest decision hook response which is read.
+	decisionHookMaxResponseSize = 1 << 16
+)
+
+// A decisionSummary is the summary of an authorization decision sent to the decision hook.
+type decisionSummary struct {
+	ID               string    `json:"id"`
+	RequestID        string    `json:"request_id,omitempty"`
+	Time             time.Time `json:"time"`
+	RouteID          string    `json:"route_id,omitempty"`
+	Method           string    `json:"method"`
+	URL              string    `json:"url"`
+	IP               string    `json:"ip,omitempty"`
+	UserAgent        string    `json:"user_agent,omitempty"`
+	Allow            bool      `json:"allow"`
+	Status           int       `json:"status"`
+	Reason           string    `json:"reason,omitempty"`
+	SessionID        string    `json:"session_id,omitempty"`
+	ServiceAccountID string    `json:"service_account_id,omitempty"`
+	UserID           string    `json:"user_id,omitempty"`
+	Email            string    `json:"email,omitempty"`
+}
+
+// A decisionHookResponse is the response of the decision hook.
+type decisionHookResponse struct {
+	// Reauthenticate signs out the session of the decision, if the hook is allowed to.
+	Reauthenticate bool `json:"reauthenticate"`
+}
+
+// A decisionHook sends the summaries of authorization decisions to the decision hook in the background.
+type decisionHook struct {
+	client    *http.Client
+	now       func() time.Time
+	summaries chan *decisionSummary
+}
+
+func newDecisionHook() *decisionHook {
+	return &decisionHook{
+		client:    &http.Client{},
+		now:       time.Now,
+		summaries: make(chan *decisionSummary, decisionHookQueueSize),
+	}
+}
+
+// Run sends the recorded decisions to the decision hook until the context is canceled.
+func (h *decisionHook) Run(
+	ctx context.Context,
+	getOptions func() *config.Options,
+	getClient func() databroker.DataBrokerServiceClient,
+) error {
+	for {
+		var summary *decisionSummary
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case summary = <-h.summaries:
+		}
+
+		hook := getOptions().DecisionHook
+		if hook == nil {
+			continue
+		}
+
+		res, err := h.send(ctx, hook, summary)
+		if err != nil {
+			log.Warn(ctx).Err(err).Str("request-id", summary.RequestID).Msg("authorize: error calling decision hook")
+			continue
+		}
+		if !res.Reauthenticate || summary.SessionID == "" {
+			continue
+		}
+		if !hook.AllowReauthenticate {
+			log.Warn(ctx).Str("session-id", summary.SessionID).
+				Msg("authorize: decision hook requested reauthentication, but allow_reauthenticate isn't set")
+			continue
+		}
+		if err := session.Delete(ctx, getClient(), summary.SessionID); err != nil {
+			log.Warn(ctx).Err(err).Str("session-id", summary.SessionID).Msg("authorize: error deleting session")
+			continue
+		}
+		log.Info(ctx).
+			Str("session-id", summary.SessionID).
+			Str("user-id", summary.UserID).
+			Msg("authorize: session signed out by decision hook")
+	}
+}
+
+func (h *decisionHook) send(ctx context.Context, hook *config.DecisionHook, summary *decisionSummary) (*decisionHookResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, hook.GetTimeout())
+	defer cancel()
+
+	body, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected response status: %d", res.StatusCode)
+	}
+
+	// the hook doesn't have to respond with anything
+	var hookResponse decisionHookResponse
+	bs, err := ioutil.ReadAll(io.LimitReader(res.Body, decisionHookMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(bs)) > 0 {
+		if err := json.Unmarshal(bs, &hookResponse); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+	}
+	return &hookResponse, nil
+}
+
+// RecordCheck queues the summary of the decision of an authorize check.
+func (h *decisionHook) RecordCheck(
+	ctx context.Context,
+	in *envoy_service_auth_v3.CheckRequest, out *envoy_service_auth_v3.CheckResponse,
+	res *evaluator.Result, routeID string, s sessionOrServiceAccount, u *user.User,
+) {
+	hattrs := in.GetAttributes().GetRequest().GetHttp()
+	requestURL := getCheckRequestURL(in)
+	requestURL.RawQuery = ""
+	summary := &decisionSummary{
+		ID:        uuid.NewString(),
+		RequestID: requestid.FromContext(ctx),
+		Time:      h.now(),
+		RouteID:   routeID,
+		Method:    hattrs.GetMethod(),
+		URL:       requestURL.String(),
+		IP:        in.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress(),
+		UserAgent: hattrs.GetHeaders()["user-agent"],
+		Allow:     out.GetStatus().GetCode() == int32(codes.OK),
+		Status:    http.StatusOK,
+		Email:     u.GetEmail(),
+	}
+	if !summary.Allow {
+		summary.Status = int(out.GetDeniedResponse().GetStatus().GetCode())
+		summary.Reason = http.StatusText(summary.Status)
+	}
+	if res != nil && res.Deny != nil && res.Deny.Message != "" {
+		summary.Reason = res.Deny.Message
+	}
+	switch s := s.(type) {
+	case *session.Session:
+		summary.SessionID = s.GetId()
+		summary.UserID = s.GetUserId()
+	case *user.ServiceAccount:
+		summary.ServiceAccountID = s.GetId()
+		summary.UserID = s.GetUserId()
+	}
+
+	select {
+	case h.summaries <- summary:
+	default:
+		log.Debug(ctx).Msg("authorize: decision hook queue is full, dropping decision")
+	}
+}
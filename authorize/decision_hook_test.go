@@ -0,0 +1,136 @@
+package authorize
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	envoy_type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/status"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestDecisionHook_RecordCheck(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	h := newDecisionHook()
+	h.now = func() time.Time { return now }
+
+	in := &envoy_service_auth_v3.CheckRequest{
+		Attributes: &envoy_service_auth_v3.AttributeContext{
+			Source: &envoy_service_auth_v3.AttributeContext_Peer{
+				Address: &envoy_config_core_v3.Address{
+					Address: &envoy_config_core_v3.Address_SocketAddress{
+						SocketAddress: &envoy_config_core_v3.SocketAddress{Address: "203.0.113.1"},
+					},
+				},
+			},
+			Request: &envoy_service_auth_v3.AttributeContext_Request{
+				Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+					Method:  http.MethodGet,
+					Scheme:  "https",
+					Host:    "example.com",
+					Path:    "/admin?token=secret",
+					Headers: map[string]string{"user-agent": "curl"},
+				},
+			},
+		},
+	}
+	s := &session.Session{Id: "SESSION_ID", UserId: "USER_ID"}
+	u := &user.User{Id: "USER_ID", Email: "user@example.com"}
+
+	t.Run("allowed", func(t *testing.T) {
+		h.RecordCheck(ctx, in, &envoy_service_auth_v3.CheckResponse{Status: &status.Status{}}, nil, "1234", s, u)
+		require.Len(t, h.summaries, 1)
+		summary := <-h.summaries
+		assert.NotEmpty(t, summary.ID)
+		summary.ID = ""
+		assert.Equal(t, &decisionSummary{
+			Time:      now,
+			RouteID:   "1234",
+			Method:    http.MethodGet,
+			URL:       "https://example.com/admin",
+			IP:        "203.0.113.1",
+			UserAgent: "curl",
+			Allow:     true,
+			Status:    http.StatusOK,
+			SessionID: "SESSION_ID",
+			UserID:    "USER_ID",
+			Email:     "user@example.com",
+		}, summary)
+	})
+	t.Run("denied", func(t *testing.T) {
+		out := &envoy_service_auth_v3.CheckResponse{
+			Status: &status.Status{Code: 7},
+			HttpResponse: &envoy_service_auth_v3.CheckResponse_DeniedResponse{
+				DeniedResponse: &envoy_service_auth_v3.DeniedHttpResponse{
+					Status: &envoy_type_v3.HttpStatus{Code: envoy_type_v3.StatusCode_Forbidden},
+				},
+			},
+		}
+		res := &evaluator.Result{Deny: &evaluator.Denial{Status: http.StatusForbidden, Message: "blocked by policy"}}
+		h.RecordCheck(ctx, in, out, res, "1234", s, u)
+		require.Len(t, h.summaries, 1)
+		summary := <-h.summaries
+		assert.False(t, summary.Allow)
+		assert.Equal(t, http.StatusForbidden, summary.Status)
+		assert.Equal(t, "blocked by policy", summary.Reason)
+	})
+}
+
+func TestDecisionHook_Run(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	received := make(chan *decisionSummary, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary decisionSummary
+		_ = json.NewDecoder(r.Body).Decode(&summary)
+		received <- &summary
+		if summary.Reason == "impossible travel" {
+			_, _ = w.Write([]byte(`{"reauthenticate": true}`))
+		}
+	}))
+	defer srv.Close()
+
+	options := &config.Options{DecisionHook: &config.DecisionHook{URL: srv.URL, AllowReauthenticate: true}}
+	client := &activityDataBrokerServiceClient{puts: make(chan *databroker.Record, 10)}
+	h := newDecisionHook()
+	go func() {
+		_ = h.Run(ctx, func() *config.Options { return options }, func() databroker.DataBrokerServiceClient {
+			return client
+		})
+	}()
+
+	h.summaries <- &decisionSummary{ID: "1", SessionID: "SESSION_ID"}
+	h.summaries <- &decisionSummary{ID: "2", SessionID: "SESSION_ID", Reason: "impossible travel"}
+
+	for _, id := range []string{"1", "2"} {
+		select {
+		case <-ctx.Done():
+			t.Fatal("decision was not sent")
+		case summary := <-received:
+			assert.Equal(t, id, summary.ID)
+		}
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("session was not deleted")
+	case put := <-client.puts:
+		assert.Equal(t, "SESSION_ID", put.GetId())
+		assert.NotNil(t, put.GetDeletedAt())
+	}
+	assert.Len(t, client.puts, 0, "only the flagged session should be deleted")
+}
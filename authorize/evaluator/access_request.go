@@ -0,0 +1,68 @@
+package evaluator
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/internal/accessrequest"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// hasAccessGrant returns true if the request's user has an approved access request for a route which accepts
+// them. Access requests are synced from the databroker to the store.
+func (e *Evaluator) hasAccessGrant(ctx context.Context, req *Request) bool {
+	if req.Policy.AccessRequests == nil || req.Session.ID == "" {
+		return false
+	}
+
+	userID := e.getSessionUserID(ctx, req.Session.ID)
+	if userID == "" {
+		return false
+	}
+
+	requestURL, err := url.Parse(req.HTTP.URL)
+	if err != nil {
+		return false
+	}
+
+	id := accessrequest.ID(userID, requestURL.Hostname())
+	value, ok := e.store.GetRecordData(accessrequest.RecordType, id).(*wrapperspb.BytesValue)
+	if !ok {
+		return false
+	}
+	r, err := accessrequest.FromBytes(value.GetValue())
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("authorize: invalid access request record")
+		return false
+	}
+	return r.GrantsAccess(userID, requestURL.Hostname(), time.Now())
+}
+
+// getSessionUserID returns the user id of a session or service account, preferring the impersonated user.
+func (e *Evaluator) getSessionUserID(ctx context.Context, sessionID string) string {
+	for _, typeURL := range []string{
+		grpcutil.GetTypeURL(new(session.Session)),
+		grpcutil.GetTypeURL(new(user.ServiceAccount)),
+	} {
+		msg := getContextRecordData(ctx, typeURL, sessionID)
+		if msg == nil {
+			msg = e.store.GetRecordData(typeURL, sessionID)
+		}
+		switch s := msg.(type) {
+		case *session.Session:
+			if s.GetImpersonateUserId() != "" {
+				return s.GetImpersonateUserId()
+			}
+			return s.GetUserId()
+		case *user.ServiceAccount:
+			return s.GetUserId()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package evaluator
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/accessrequest"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestAccessRequests(t *testing.T) {
+	policies := []config.Policy{
+		{
+			From:           "https://from.example.com",
+			To:             config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			AllowedUsers:   []string{"admin@example.com"},
+			AccessRequests: &config.AccessRequests{},
+		},
+		{
+			From:         "https://other.example.com",
+			To:           config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			AllowedUsers: []string{"admin@example.com"},
+		},
+	}
+
+	store := NewStoreFromProtos(math.MaxUint64,
+		&session.Session{Id: "session1", UserId: "user1"},
+		&session.Session{Id: "session2", UserId: "user2"},
+		&session.Session{Id: "session3", UserId: "user3"},
+	)
+	for _, r := range []*accessrequest.AccessRequest{
+		{UserID: "user1", Route: "from.example.com", Status: accessrequest.StatusApproved, ExpiresAt: timePtr(time.Now().Add(time.Hour))},
+		{UserID: "user1", Route: "other.example.com", Status: accessrequest.StatusApproved, ExpiresAt: timePtr(time.Now().Add(time.Hour))},
+		{UserID: "user2", Route: "from.example.com", Status: accessrequest.StatusApproved, ExpiresAt: timePtr(time.Now().Add(-time.Hour))},
+		{UserID: "user3", Route: "from.example.com", Status: accessrequest.StatusPending},
+	} {
+		r.ID = accessrequest.ID(r.UserID, r.Route)
+		record, err := r.ToRecord()
+		require.NoError(t, err)
+		store.UpdateRecord(0, record)
+	}
+
+	e, err := New(context.Background(), store, nil,
+		WithAuthenticateURL("https://authn.example.com"),
+		WithPolicies(policies))
+	require.NoError(t, err)
+	eval := func(t *testing.T, policy *config.Policy, sessionID string) *Result {
+		res, err := e.Evaluate(context.Background(), &Request{
+			Policy:  policy,
+			Session: RequestSession{ID: sessionID},
+			HTTP: RequestHTTP{
+				Method: http.MethodGet,
+				URL:    policy.From + "/",
+			},
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("approved", func(t *testing.T) {
+		assert.True(t, eval(t, &policies[0], "session1").Allow)
+	})
+	t.Run("route without access requests", func(t *testing.T) {
+		assert.False(t, eval(t, &policies[1], "session1").Allow)
+	})
+	t.Run("expired", func(t *testing.T) {
+		assert.False(t, eval(t, &policies[0], "session2").Allow)
+	})
+	t.Run("pending", func(t *testing.T) {
+		assert.False(t, eval(t, &policies[0], "session3").Allow)
+	})
+	t.Run("no session", func(t *testing.T) {
+		assert.False(t, eval(t, &policies[0], "").Allow)
+	})
+}
@@ -0,0 +1,55 @@
+package evaluator
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/internal/apikey"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// RequestAPIKey is the API key field in the request, set when a request has an API key which is valid for the
+// route.
+type RequestAPIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GetAPIKey returns the API key of a request for a route which accepts them.
+func GetAPIKey(req *Request) string {
+	if req.Policy == nil || req.Policy.APIKey == nil {
+		return ""
+	}
+	return req.HTTP.Headers[req.Policy.APIKey.GetHeader()]
+}
+
+// getAPIKey returns the API key of the request if it's valid for the route. API keys are synced from the
+// databroker to the store.
+func (e *Evaluator) getAPIKey(ctx context.Context, req *Request) *RequestAPIKey {
+	key := GetAPIKey(req)
+	if key == "" {
+		return nil
+	}
+
+	requestURL, err := url.Parse(req.HTTP.URL)
+	if err != nil {
+		return nil
+	}
+
+	value, ok := e.store.GetRecordData(apikey.RecordType, apikey.Hash(key)).(*wrapperspb.BytesValue)
+	if !ok {
+		return nil
+	}
+	k, err := apikey.FromBytes(value.GetValue())
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("authorize: invalid api key record")
+		return nil
+	}
+	if !k.IsValidFor(requestURL.Hostname(), time.Now()) {
+		return nil
+	}
+	return &RequestAPIKey{ID: k.ID, Name: k.Name}
+}
@@ -0,0 +1,92 @@
+package evaluator
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/apikey"
+)
+
+func TestAPIKey(t *testing.T) {
+	policies := []config.Policy{
+		{
+			From:   "https://hooks.example.com",
+			To:     config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			APIKey: &config.APIKey{},
+		},
+		{
+			From:   "https://probes.example.com",
+			To:     config.WeightedURLs{{URL: *mustParseURL("https://to2.example.com")}},
+			APIKey: &config.APIKey{Header: "X-Probe-Token"},
+		},
+	}
+
+	store := NewStoreFromProtos(math.MaxUint64)
+	keys := map[string]string{}
+	for name, k := range map[string]*apikey.APIKey{
+		"valid":   {Name: "valid", Routes: []string{"hooks.example.com", "probes.example.com"}},
+		"expired": {Name: "expired", Routes: []string{"hooks.example.com"}, ExpiresAt: timePtr(time.Now().Add(-time.Hour))},
+		"other":   {Name: "other", Routes: []string{"other.example.com"}},
+	} {
+		keys[name] = apikey.New()
+		k.ID = apikey.Hash(keys[name])
+		record, err := k.ToRecord()
+		require.NoError(t, err)
+		store.UpdateRecord(0, record)
+	}
+
+	e, err := New(context.Background(), store, nil,
+		WithAuthenticateURL("https://authn.example.com"),
+		WithPolicies(policies))
+	require.NoError(t, err)
+	eval := func(t *testing.T, policy *config.Policy, headers map[string]string) *Result {
+		res, err := e.Evaluate(context.Background(), &Request{
+			Policy: policy,
+			HTTP: RequestHTTP{
+				Method:  http.MethodPost,
+				URL:     policy.From + "/hook",
+				Headers: headers,
+			},
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		res := eval(t, &policies[0], map[string]string{"X-Pomerium-Api-Key": keys["valid"]})
+		assert.True(t, res.Allow)
+		assert.Equal(t, &RequestAPIKey{ID: apikey.Hash(keys["valid"]), Name: "valid"}, res.APIKey)
+	})
+	t.Run("custom header", func(t *testing.T) {
+		res := eval(t, &policies[1], map[string]string{"X-Probe-Token": keys["valid"]})
+		assert.True(t, res.Allow)
+		res = eval(t, &policies[1], map[string]string{"X-Pomerium-Api-Key": keys["valid"]})
+		assert.False(t, res.Allow)
+	})
+	t.Run("expired", func(t *testing.T) {
+		res := eval(t, &policies[0], map[string]string{"X-Pomerium-Api-Key": keys["expired"]})
+		assert.False(t, res.Allow)
+		assert.Nil(t, res.APIKey)
+	})
+	t.Run("other route", func(t *testing.T) {
+		res := eval(t, &policies[0], map[string]string{"X-Pomerium-Api-Key": keys["other"]})
+		assert.False(t, res.Allow)
+		assert.Nil(t, res.APIKey)
+	})
+	t.Run("unknown", func(t *testing.T) {
+		res := eval(t, &policies[0], map[string]string{"X-Pomerium-Api-Key": apikey.New()})
+		assert.False(t, res.Allow)
+		assert.Nil(t, res.APIKey)
+	})
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
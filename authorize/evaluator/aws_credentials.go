@@ -0,0 +1,240 @@
+package evaluator
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// awsCredentialsExpiryDelta is how long before they expire temporary credentials are refreshed
+	awsCredentialsExpiryDelta = 5 * time.Minute
+	// awsCredentialsMaxResponseSize is the maximum size of a credentials response
+	awsCredentialsMaxResponseSize = 1 << 20
+	awsCredentialsRequestTimeout  = 10 * time.Second
+)
+
+var (
+	awsCredentials = &awsCredentialsProvider{getenv: os.Getenv}
+
+	awsCredentialsHTTP         = &http.Client{Timeout: awsCredentialsRequestTimeout}
+	awsContainerCredentialsURL = "http://169.254.170.2"
+	awsInstanceMetadataURL     = "http://169.254.169.254"
+	awsSTSURL                  = func(region string) string { return "https://sts." + region + ".amazonaws.com/" }
+)
+
+type awsCredentialsValue struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expiry is zero for credentials which don't expire.
+	Expiry time.Time
+}
+
+// awsCredentialsProvider retrieves AWS credentials using the same sources, in the same order, as the AWS SDKs:
+// environment variables, a web identity token (used by IRSA on EKS), the ECS container credentials endpoint
+// and the EC2 instance metadata service. Temporary credentials are cached until shortly before they expire.
+type awsCredentialsProvider struct {
+	getenv func(string) string
+
+	mu     sync.Mutex
+	cached map[string]*awsCredentialsValue
+}
+
+func (p *awsCredentialsProvider) Retrieve(ctx context.Context, region string) (*awsCredentialsValue, error) {
+	if creds := p.fromEnvironment(); creds != nil {
+		return creds, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// web identity credentials are requested from the regional STS endpoint, so they're cached per region
+	if creds, ok := p.cached[region]; ok && (creds.Expiry.IsZero() || time.Now().Add(awsCredentialsExpiryDelta).Before(creds.Expiry)) {
+		return creds, nil
+	}
+
+	var creds *awsCredentialsValue
+	var err error
+	switch {
+	case p.getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "" && p.getenv("AWS_ROLE_ARN") != "":
+		creds, err = p.fromWebIdentity(ctx, region)
+	case p.getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || p.getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		creds, err = p.fromContainer(ctx)
+	default:
+		creds, err = p.fromInstanceMetadata(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.cached == nil {
+		p.cached = make(map[string]*awsCredentialsValue)
+	}
+	p.cached[region] = creds
+	return creds, nil
+}
+
+func (p *awsCredentialsProvider) fromEnvironment() *awsCredentialsValue {
+	accessKeyID, secretAccessKey := p.getenv("AWS_ACCESS_KEY_ID"), p.getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil
+	}
+	return &awsCredentialsValue{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+		SessionToken:    p.getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func (p *awsCredentialsProvider) fromWebIdentity(ctx context.Context, region string) (*awsCredentialsValue, error) {
+	token, err := ioutil.ReadFile(p.getenv("AWS_WEB_IDENTITY_TOKEN_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading web identity token: %w", err)
+	}
+	sessionName := p.getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("pomerium-%d", time.Now().UnixNano())
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {p.getenv("AWS_ROLE_ARN")},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, awsSTSURL(region), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := doAWSCredentialsRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("error assuming role with web identity: %w", err)
+	}
+
+	var res struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("error parsing web identity credentials: %w", err)
+	}
+	return &awsCredentialsValue{
+		AccessKeyID:     res.Credentials.AccessKeyID,
+		SecretAccessKey: res.Credentials.SecretAccessKey,
+		SessionToken:    res.Credentials.SessionToken,
+		Expiry:          res.Credentials.Expiration,
+	}, nil
+}
+
+func (p *awsCredentialsProvider) fromContainer(ctx context.Context) (*awsCredentialsValue, error) {
+	endpoint := p.getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relativeURI := p.getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relativeURI != "" {
+		endpoint = awsContainerCredentialsURL + relativeURI
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := p.getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	body, err := doAWSCredentialsRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving container credentials: %w", err)
+	}
+	return parseAWSCredentialsJSON(body)
+}
+
+func (p *awsCredentialsProvider) fromInstanceMetadata(ctx context.Context) (*awsCredentialsValue, error) {
+	// IMDSv2 requires a session token
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, awsInstanceMetadataURL+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "21600")
+	token, err := doAWSCredentialsRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("no aws credentials found: error retrieving instance metadata token: %w", err)
+	}
+
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, awsInstanceMetadataURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+		return doAWSCredentialsRequest(req)
+	}
+
+	roles, err := get("/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving instance profile: %w", err)
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, errors.New("no instance profile role found")
+	}
+
+	body, err := get("/latest/meta-data/iam/security-credentials/" + role)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving instance profile credentials: %w", err)
+	}
+	return parseAWSCredentialsJSON(body)
+}
+
+func parseAWSCredentialsJSON(body []byte) (*awsCredentialsValue, error) {
+	var res struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("error parsing aws credentials: %w", err)
+	}
+	if res.AccessKeyID == "" || res.SecretAccessKey == "" {
+		return nil, errors.New("aws credentials response is missing an access key")
+	}
+	return &awsCredentialsValue{
+		AccessKeyID:     res.AccessKeyID,
+		SecretAccessKey: res.SecretAccessKey,
+		SessionToken:    res.Token,
+		Expiry:          res.Expiration,
+	}, nil
+}
+
+func doAWSCredentialsRequest(req *http.Request) ([]byte, error) {
+	res, err := awsCredentialsHTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, awsCredentialsMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
@@ -0,0 +1,189 @@
+package evaluator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+const (
+	awsSigV4Algorithm       = "AWS4-HMAC-SHA256"
+	awsSigV4TimeFormat      = "20060102T150405Z"
+	awsSigV4DateFormat      = "20060102"
+	awsSigV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+var awsSigV4Now = time.Now
+
+// An awsSigV4Request is the upstream request which is signed.
+type awsSigV4Request struct {
+	Method string
+	URL    *url.URL
+	Host   string
+	Body   []byte
+}
+
+// addAWSSigV4Headers adds the headers which sign the upstream request for the policy to headers.
+func addAWSSigV4Headers(ctx context.Context, req *Request, headers http.Header) error {
+	u, err := url.Parse(req.HTTP.URL)
+	if err != nil {
+		return fmt.Errorf("authorize: invalid request url: %w", err)
+	}
+	signed, err := getAWSSigV4Headers(ctx, req.Policy.AWSSigV4, &awsSigV4Request{
+		Method: req.HTTP.Method,
+		URL:    u,
+		Host:   req.Policy.AWSSigV4.GetUpstreamHost(req.Policy, u.Host),
+		Body:   req.HTTP.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("authorize: error signing aws request: %w", err)
+	}
+	for k := range signed {
+		headers.Set(k, signed.Get(k))
+	}
+	return nil
+}
+
+// getAWSSigV4Headers returns the headers which sign the request with AWS Signature Version 4.
+func getAWSSigV4Headers(ctx context.Context, cfg *config.AWSSigV4, req *awsSigV4Request) (http.Header, error) {
+	creds, err := awsCredentials.Retrieve(ctx, cfg.Region)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving aws credentials: %w", err)
+	}
+	return signAWSSigV4(cfg, req, creds, awsSigV4Now().UTC()), nil
+}
+
+func signAWSSigV4(cfg *config.AWSSigV4, req *awsSigV4Request, creds *awsCredentialsValue, now time.Time) http.Header {
+	amzDate := now.Format(awsSigV4TimeFormat)
+	scope := strings.Join([]string{now.Format(awsSigV4DateFormat), cfg.Region, cfg.Service, "aws4_request"}, "/")
+
+	payloadHash := awsSigV4UnsignedPayload
+	if cfg.SignsPayload() {
+		payloadHash = hexSHA256(req.Body)
+	}
+
+	headers := make(http.Header)
+	headers.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		headers.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	if cfg.Service == "s3" {
+		headers.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	signedHeaders := map[string]string{"host": req.Host}
+	for k := range headers {
+		signedHeaders[strings.ToLower(k)] = headers.Get(k)
+	}
+	signedHeaderNames := make([]string, 0, len(signedHeaders))
+	for k := range signedHeaders {
+		signedHeaderNames = append(signedHeaderNames, k)
+	}
+	sort.Strings(signedHeaderNames)
+	var canonicalHeaders strings.Builder
+	for _, k := range signedHeaderNames {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(signedHeaders[k]) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsSigV4CanonicalPath(req.URL, cfg.Service != "s3"),
+		awsSigV4CanonicalQuery(req.URL),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaderNames, ";"),
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		awsSigV4Algorithm,
+		amzDate,
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), now.Format(awsSigV4DateFormat))
+	key = hmacSHA256(key, cfg.Region)
+	key = hmacSHA256(key, cfg.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	headers.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigV4Algorithm, creds.AccessKeyID, scope, strings.Join(signedHeaderNames, ";"), signature))
+	return headers
+}
+
+// awsSigV4CanonicalPath returns the URI-encoded path. Every service except S3 encodes the path twice.
+func awsSigV4CanonicalPath(u *url.URL, doubleEncode bool) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		segment = awsSigV4Escape(segment)
+		if doubleEncode {
+			segment = awsSigV4Escape(segment)
+		}
+		segments[i] = segment
+	}
+	path := strings.Join(segments, "/")
+	if path == "" {
+		path = "/"
+	}
+	return path
+}
+
+// awsSigV4CanonicalQuery returns the URI-encoded query string sorted by key and value.
+func awsSigV4CanonicalQuery(u *url.URL) string {
+	var params [][2]string
+	for k, vs := range u.Query() {
+		for _, v := range vs {
+			params = append(params, [2]string{awsSigV4Escape(k), awsSigV4Escape(v)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	encoded := make([]string, len(params))
+	for i, kv := range params {
+		encoded[i] = kv[0] + "=" + kv[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+// awsSigV4Escape URI-encodes every byte except the unreserved characters.
+func awsSigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hexSHA256(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,156 @@
+package evaluator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+func TestSignAWSSigV4(t *testing.T) {
+	// from the AWS Signature Version 4 test suite
+	creds := &awsCredentialsValue{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	cfg := &config.AWSSigV4{Service: "service", Region: "us-east-1"}
+
+	t.Run("get-vanilla", func(t *testing.T) {
+		headers := signAWSSigV4(cfg, &awsSigV4Request{
+			Method: http.MethodGet,
+			URL:    mustParseURL("https://example.amazonaws.com/"),
+			Host:   "example.amazonaws.com",
+		}, creds, now)
+		assert.Equal(t, "20150830T123600Z", headers.Get("X-Amz-Date"))
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", headers.Get("Authorization"))
+	})
+	t.Run("get-vanilla-query-order-key-case", func(t *testing.T) {
+		headers := signAWSSigV4(cfg, &awsSigV4Request{
+			Method: http.MethodGet,
+			URL:    mustParseURL("https://example.amazonaws.com/?Param2=value2&Param1=value1"),
+			Host:   "example.amazonaws.com",
+		}, creds, now)
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500", headers.Get("Authorization"))
+	})
+	t.Run("session token", func(t *testing.T) {
+		creds := *creds
+		creds.SessionToken = "SESSION_TOKEN"
+		headers := signAWSSigV4(cfg, &awsSigV4Request{
+			Method: http.MethodGet,
+			URL:    mustParseURL("https://example.amazonaws.com/"),
+			Host:   "example.amazonaws.com",
+		}, &creds, now)
+		assert.Equal(t, "SESSION_TOKEN", headers.Get("X-Amz-Security-Token"))
+		assert.Contains(t, headers.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,")
+	})
+	t.Run("s3", func(t *testing.T) {
+		headers := signAWSSigV4(&config.AWSSigV4{Service: "s3", Region: "us-east-1"}, &awsSigV4Request{
+			Method: http.MethodPut,
+			URL:    mustParseURL("https://bucket.s3.amazonaws.com/some%20key"),
+			Host:   "bucket.s3.amazonaws.com",
+			Body:   []byte("BODY"),
+		}, creds, now)
+		assert.Equal(t, "UNSIGNED-PAYLOAD", headers.Get("X-Amz-Content-Sha256"))
+		assert.Contains(t, headers.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date,")
+	})
+}
+
+func TestAWSSigV4CanonicalPath(t *testing.T) {
+	u := mustParseURL("https://example.amazonaws.com/documents%20and%20settings/a+b")
+	assert.Equal(t, "/documents%2520and%2520settings/a%252Bb", awsSigV4CanonicalPath(u, true))
+	assert.Equal(t, "/documents%20and%20settings/a%2Bb", awsSigV4CanonicalPath(u, false))
+	assert.Equal(t, "/", awsSigV4CanonicalPath(mustParseURL("https://example.amazonaws.com"), true))
+}
+
+func TestAWSCredentialsProvider(t *testing.T) {
+	env := func(m map[string]string) func(string) string {
+		return func(k string) string { return m[k] }
+	}
+
+	t.Run("environment", func(t *testing.T) {
+		p := &awsCredentialsProvider{getenv: env(map[string]string{
+			"AWS_ACCESS_KEY_ID":     "ACCESS_KEY_ID",
+			"AWS_SECRET_ACCESS_KEY": "SECRET_ACCESS_KEY",
+			"AWS_SESSION_TOKEN":     "SESSION_TOKEN",
+		})}
+		creds, err := p.Retrieve(context.Background(), "us-east-1")
+		require.NoError(t, err)
+		assert.Equal(t, &awsCredentialsValue{
+			AccessKeyID:     "ACCESS_KEY_ID",
+			SecretAccessKey: "SECRET_ACCESS_KEY",
+			SessionToken:    "SESSION_TOKEN",
+		}, creds)
+	})
+	t.Run("container", func(t *testing.T) {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			assert.Equal(t, "/v2/credentials/ID", r.URL.Path)
+			assert.Equal(t, "TOKEN", r.Header.Get("Authorization"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"AccessKeyId":     "ACCESS_KEY_ID",
+				"SecretAccessKey": "SECRET_ACCESS_KEY",
+				"Token":           "SESSION_TOKEN",
+				"Expiration":      time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			})
+		}))
+		defer srv.Close()
+
+		defer func(original string) { awsContainerCredentialsURL = original }(awsContainerCredentialsURL)
+		awsContainerCredentialsURL = srv.URL
+
+		p := &awsCredentialsProvider{getenv: env(map[string]string{
+			"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "/v2/credentials/ID",
+			"AWS_CONTAINER_AUTHORIZATION_TOKEN":      "TOKEN",
+		})}
+		creds, err := p.Retrieve(context.Background(), "us-east-1")
+		require.NoError(t, err)
+		assert.Equal(t, "ACCESS_KEY_ID", creds.AccessKeyID)
+		assert.Equal(t, "SESSION_TOKEN", creds.SessionToken)
+
+		_, err = p.Retrieve(context.Background(), "us-east-1")
+		require.NoError(t, err)
+		assert.Equal(t, 1, requests, "credentials should be cached")
+	})
+	t.Run("instance metadata", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/latest/api/token":
+				assert.Equal(t, http.MethodPut, r.Method)
+				_, _ = w.Write([]byte("IMDS_TOKEN"))
+				return
+			}
+			assert.Equal(t, "IMDS_TOKEN", r.Header.Get("X-Aws-Ec2-Metadata-Token"))
+			switch r.URL.Path {
+			case "/latest/meta-data/iam/security-credentials/":
+				_, _ = w.Write([]byte("ROLE\n"))
+			case "/latest/meta-data/iam/security-credentials/ROLE":
+				_, _ = w.Write([]byte(`{"AccessKeyId":"ACCESS_KEY_ID","SecretAccessKey":"SECRET_ACCESS_KEY","Token":"SESSION_TOKEN"}`))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer srv.Close()
+
+		defer func(original string) { awsInstanceMetadataURL = original }(awsInstanceMetadataURL)
+		awsInstanceMetadataURL = srv.URL
+
+		p := &awsCredentialsProvider{getenv: env(nil)}
+		creds, err := p.Retrieve(context.Background(), "us-east-1")
+		require.NoError(t, err)
+		assert.Equal(t, "ACCESS_KEY_ID", creds.AccessKeyID)
+		assert.Equal(t, "SECRET_ACCESS_KEY", creds.SecretAccessKey)
+	})
+}
@@ -0,0 +1,115 @@
+package evaluator
+
+import (
+	"crypto/x509"
+	"regexp"
+	"strings"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+// ClientCertificateInfo contains the attributes of the downstream client certificate which are made
+// available to policy evaluation.
+type ClientCertificateInfo struct {
+	Presented      bool     `json:"presented"`
+	Subject        string   `json:"subject,omitempty"`
+	Issuer         string   `json:"issuer,omitempty"`
+	SerialNumber   string   `json:"serial_number,omitempty"`
+	DNSNames       []string `json:"dns_names,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+	IPAddresses    []string `json:"ip_addresses,omitempty"`
+}
+
+func newClientCertificateInfo(cert *x509.Certificate) ClientCertificateInfo {
+	info := ClientCertificateInfo{
+		Presented:      true,
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		SerialNumber:   cert.SerialNumber.String(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+	}
+	for _, u := range cert.URIs {
+		info.URIs = append(info.URIs, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
+
+// getClientCertificateInfo returns the attributes of the PEM-encoded client certificate. If no client
+// certificate was supplied nothing is set, and if it can't be parsed only Presented is set.
+func getClientCertificateInfo(cert string) (ClientCertificateInfo, *x509.Certificate) {
+	if cert == "" {
+		return ClientCertificateInfo{}, nil
+	}
+	xcert, err := parseCertificate(cert)
+	if err != nil {
+		return ClientCertificateInfo{Presented: true}, nil
+	}
+	return newClientCertificateInfo(xcert), xcert
+}
+
+// isClientCertificateAllowed returns true if cert satisfies the route's subject alternative name and
+// issuer constraints, where issuers are the route's compiled issuer patterns. When constraints are set a
+// client certificate is required.
+func isClientCertificateAllowed(policy *config.Policy, issuers []*regexp.Regexp, info ClientCertificateInfo, cert *x509.Certificate) bool {
+	if len(policy.AllowedClientCertSANs) == 0 && len(issuers) == 0 {
+		return true
+	}
+	if cert == nil {
+		return false
+	}
+
+	if len(policy.AllowedClientCertSANs) > 0 && !hasAllowedSAN(policy.AllowedClientCertSANs, info) {
+		return false
+	}
+
+	if len(issuers) > 0 && !hasAllowedIssuer(issuers, info.Issuer) {
+		return false
+	}
+
+	return true
+}
+
+func hasAllowedSAN(allowed []string, info ClientCertificateInfo) bool {
+	for _, pattern := range allowed {
+		for _, dnsName := range info.DNSNames {
+			if isDNSNameMatch(pattern, dnsName) {
+				return true
+			}
+		}
+		for _, email := range info.EmailAddresses {
+			if strings.EqualFold(pattern, email) {
+				return true
+			}
+		}
+		for _, values := range [][]string{info.URIs, info.IPAddresses} {
+			for _, value := range values {
+				if pattern == value {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func isDNSNameMatch(pattern, dnsName string) bool {
+	pattern, dnsName = strings.ToLower(pattern), strings.ToLower(dnsName)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(dnsName, pattern[1:])
+	}
+	return pattern == dnsName
+}
+
+func hasAllowedIssuer(allowed []*regexp.Regexp, issuer string) bool {
+	for _, re := range allowed {
+		if re.MatchString(issuer) {
+			return true
+		}
+	}
+	return false
+}
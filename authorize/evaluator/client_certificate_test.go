@@ -0,0 +1,73 @@
+package evaluator
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+func TestIsClientCertificateAllowed(t *testing.T) {
+	cert := &x509.Certificate{
+		SerialNumber:   big.NewInt(1234),
+		Subject:        pkix.Name{CommonName: "client"},
+		Issuer:         pkix.Name{CommonName: "Example CA", Organization: []string{"Example"}},
+		DNSNames:       []string{"device-1.devices.example.com"},
+		EmailAddresses: []string{"User@example.com"},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/workload"}},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+	}
+	info := newClientCertificateInfo(cert)
+	assert.Equal(t, ClientCertificateInfo{
+		Presented:      true,
+		Subject:        "CN=client",
+		Issuer:         "CN=Example CA,O=Example",
+		SerialNumber:   "1234",
+		DNSNames:       []string{"device-1.devices.example.com"},
+		EmailAddresses: []string{"User@example.com"},
+		URIs:           []string{"spiffe://example.com/workload"},
+		IPAddresses:    []string{"10.0.0.1"},
+	}, info)
+
+	for _, tc := range []struct {
+		name     string
+		sans     []string
+		issuers  []string
+		noCert   bool
+		expected bool
+	}{
+		{"no constraints", nil, nil, false, true},
+		{"no constraints no certificate", nil, nil, true, true},
+		{"no certificate", []string{"device-1.devices.example.com"}, nil, true, false},
+		{"dns", []string{"DEVICE-1.devices.example.com"}, nil, false, true},
+		{"dns wildcard", []string{"*.devices.example.com"}, nil, false, true},
+		{"dns wildcard mismatch", []string{"*.example.org"}, nil, false, false},
+		{"email", []string{"user@example.com"}, nil, false, true},
+		{"uri", []string{"spiffe://example.com/workload"}, nil, false, true},
+		{"ip", []string{"10.0.0.1"}, nil, false, true},
+		{"san mismatch", []string{"other.example.com", "10.0.0.2"}, nil, false, false},
+		{"issuer", nil, []string{"CN=Example CA,O=.*"}, false, true},
+		{"issuer partial", nil, []string{"CN=Example CA"}, false, false},
+		{"san and issuer", []string{"10.0.0.1"}, []string{"CN=Other CA,O=Example", "CN=Example CA,O=Example"}, false, true},
+		{"san but not issuer", []string{"10.0.0.1"}, []string{"CN=Other CA,O=Example"}, false, false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			policy := &config.Policy{AllowedClientCertSANs: tc.sans, AllowedClientCertIssuers: tc.issuers}
+			issuers, err := policy.AllowedClientCertIssuerRegexps()
+			require.NoError(t, err)
+			if tc.noCert {
+				assert.Equal(t, tc.expected, isClientCertificateAllowed(policy, issuers, ClientCertificateInfo{}, nil))
+			} else {
+				assert.Equal(t, tc.expected, isClientCertificateAllowed(policy, issuers, info, cert))
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package evaluator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/pkg/sdk"
+)
+
+const (
+	// clientCredentialsMaxResponseSize is the maximum size of an OpenID configuration response
+	clientCredentialsMaxResponseSize = 1 << 20
+	clientCredentialsRequestTimeout  = 10 * time.Second
+)
+
+var (
+	// clientCredentialsVerifiers caches the verifiers of client credentials tokens, so that the issuer's JSON
+	// web key set is retrieved once rather than for every request.
+	clientCredentialsVerifiers, _ = lru.New(100)
+	clientCredentialsHTTP         = &http.Client{Timeout: clientCredentialsRequestTimeout}
+)
+
+// RequestClientCredentials is the client credentials field in the request, set when a request has a valid
+// client credentials bearer token.
+type RequestClientCredentials struct {
+	ClientID string   `json:"client_id"`
+	Subject  string   `json:"subject"`
+	Scopes   []string `json:"scopes"`
+}
+
+// GetClientCredentialsToken returns the client credentials bearer token of a request for a route which accepts
+// them. Pomerium bearer tokens are ignored.
+func GetClientCredentialsToken(req *Request) string {
+	if req.Policy == nil || req.Policy.ClientCredentials == nil {
+		return ""
+	}
+
+	authorization := req.HTTP.Headers["Authorization"]
+	if len(authorization) < len("Bearer ") || !strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		return ""
+	}
+	token := strings.TrimSpace(authorization[len("Bearer "):])
+	if strings.HasPrefix(token, httputil.AuthorizationTypePomerium+"-") {
+		return ""
+	}
+	return token
+}
+
+// verifyClientCredentials verifies the signature, issuer, audience and expiry of a client credentials token.
+func verifyClientCredentials(
+	ctx context.Context,
+	cc *config.ClientCredentials,
+	providerURL, rawToken, host string,
+) (*RequestClientCredentials, error) {
+	verifier, err := getClientCredentialsVerifier(ctx, cc, providerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := verifier.Verify(ctx, rawToken, host)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RequestClientCredentials{
+		ClientID: getClientCredentialsClientID(claims),
+		Subject:  claims.Subject,
+		Scopes:   getClientCredentialsScopes(claims.RawClaims),
+	}, nil
+}
+
+func getClientCredentialsVerifier(ctx context.Context, cc *config.ClientCredentials, providerURL string) (*sdk.Verifier, error) {
+	issuer := cc.GetIssuer(providerURL)
+	if issuer == "" {
+		return nil, fmt.Errorf("client credentials issuer is required")
+	}
+
+	key := strings.Join([]string{issuer, cc.JWKSURL, strings.Join(cc.Audiences, ",")}, "|")
+	if v, ok := clientCredentialsVerifiers.Get(key); ok {
+		return v.(*sdk.Verifier), nil
+	}
+
+	jwksURL := cc.JWKSURL
+	if jwksURL == "" {
+		var err error
+		jwksURL, err = discoverJWKSURL(ctx, issuer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	verifier, err := sdk.New(&sdk.Options{
+		Issuer:       issuer,
+		Audience:     cc.Audiences,
+		JWKSEndpoint: jwksURL,
+		HTTPClient:   clientCredentialsHTTP,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clientCredentialsVerifiers.Add(key, verifier)
+	return verifier, nil
+}
+
+// discoverJWKSURL returns the jwks_uri in the issuer's OpenID configuration.
+func discoverJWKSURL(ctx context.Context, issuer string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", fmt.Errorf("invalid client credentials issuer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := clientCredentialsHTTP.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving openid configuration: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code retrieving openid configuration from %s: %d", u, res.StatusCode)
+	}
+
+	var configuration struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, clientCredentialsMaxResponseSize)).Decode(&configuration)
+	if err != nil {
+		return "", fmt.Errorf("error decoding openid configuration: %w", err)
+	}
+	if configuration.JWKSURI == "" {
+		return "", fmt.Errorf("openid configuration from %s is missing a jwks_uri", u)
+	}
+	return configuration.JWKSURI, nil
+}
+
+// getClientCredentialsClientID returns the client id of a token. Identity providers use different claims for
+// it, and for client credentials tokens the subject is usually the client id.
+func getClientCredentialsClientID(claims *sdk.Claims) string {
+	for _, name := range []string{"client_id", "azp", "cid", "appid"} {
+		if clientID, ok := claims.RawClaims[name].(string); ok && clientID != "" {
+			return clientID
+		}
+	}
+	return claims.Subject
+}
+
+// getClientCredentialsScopes returns the scopes of a token, from either a space-separated scope claim
+// (RFC 9068) or an scp claim, which some identity providers use instead.
+func getClientCredentialsScopes(rawClaims map[string]interface{}) []string {
+	scopes := []string{}
+	for _, name := range []string{"scope", "scp"} {
+		switch v := rawClaims[name].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(v)...)
+		case []interface{}:
+			for _, scope := range v {
+				if s, ok := scope.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,169 @@
+package evaluator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/sdk"
+)
+
+func TestClientCredentials(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwk := jose.JSONWebKey{Key: key, KeyID: "KEY_ID", Algorithm: string(jose.ES256), Use: "sig"}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk}, nil)
+	require.NoError(t, err)
+
+	var issuer string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/jwks.json"})
+		case "/jwks.json":
+			_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	issuer = srv.URL
+
+	newToken := func(t *testing.T, claims map[string]interface{}) string {
+		c := map[string]interface{}{
+			"iss":       issuer,
+			"aud":       "api.example.com",
+			"sub":       "CLIENT_ID",
+			"client_id": "CLIENT_ID",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range claims {
+			c[k] = v
+		}
+		raw, err := jwt.Signed(signer).Claims(c).CompactSerialize()
+		require.NoError(t, err)
+		return raw
+	}
+
+	policies := []config.Policy{
+		{
+			From: "https://api.example.com",
+			To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			ClientCredentials: &config.ClientCredentials{
+				AllowedScopes: []string{"api:read"},
+			},
+		},
+		{
+			From: "https://other.example.com",
+			To:   config.WeightedURLs{{URL: *mustParseURL("https://to2.example.com")}},
+			ClientCredentials: &config.ClientCredentials{
+				Audiences:        []string{"https://api.example.com"},
+				AllowedClientIDs: []string{"OTHER_CLIENT_ID"},
+			},
+		},
+	}
+	eval := func(t *testing.T, policy *config.Policy, authorization string) *Result {
+		store := NewStoreFromProtos(math.MaxUint64)
+		e, err := New(context.Background(), store, nil,
+			WithAuthenticateURL("https://authn.example.com"),
+			WithPolicies(policies),
+			WithProviderURL(issuer))
+		require.NoError(t, err)
+		res, err := e.Evaluate(context.Background(), &Request{
+			Policy: policy,
+			HTTP: RequestHTTP{
+				Method:  http.MethodGet,
+				URL:     policy.From + "/resource",
+				Headers: map[string]string{"Authorization": authorization},
+			},
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("allowed scope", func(t *testing.T) {
+		res := eval(t, &policies[0], "Bearer "+newToken(t, map[string]interface{}{"scope": "api:read api:write"}))
+		assert.True(t, res.Allow)
+		assert.Equal(t, &RequestClientCredentials{
+			ClientID: "CLIENT_ID",
+			Subject:  "CLIENT_ID",
+			Scopes:   []string{"api:read", "api:write"},
+		}, res.ClientCredentials)
+	})
+	t.Run("scp claim", func(t *testing.T) {
+		res := eval(t, &policies[0], "Bearer "+newToken(t, map[string]interface{}{"scp": []string{"api:read"}}))
+		assert.True(t, res.Allow)
+	})
+	t.Run("missing scope", func(t *testing.T) {
+		res := eval(t, &policies[0], "Bearer "+newToken(t, map[string]interface{}{"scope": "api:write"}))
+		assert.False(t, res.Allow)
+		assert.NotNil(t, res.ClientCredentials)
+	})
+	t.Run("invalid audience", func(t *testing.T) {
+		res := eval(t, &policies[0], "Bearer "+newToken(t, map[string]interface{}{"scope": "api:read", "aud": "other.example.com"}))
+		assert.False(t, res.Allow)
+		assert.Nil(t, res.ClientCredentials)
+	})
+	t.Run("invalid issuer", func(t *testing.T) {
+		res := eval(t, &policies[0], "Bearer "+newToken(t, map[string]interface{}{"scope": "api:read", "iss": "https://idp.example.com"}))
+		assert.False(t, res.Allow)
+		assert.Nil(t, res.ClientCredentials)
+	})
+	t.Run("expired", func(t *testing.T) {
+		res := eval(t, &policies[0], "Bearer "+newToken(t, map[string]interface{}{"scope": "api:read", "exp": time.Now().Add(-time.Hour).Unix()}))
+		assert.False(t, res.Allow)
+		assert.Nil(t, res.ClientCredentials)
+	})
+	t.Run("configured audience and client id", func(t *testing.T) {
+		res := eval(t, &policies[1], "Bearer "+newToken(t, map[string]interface{}{"aud": "https://api.example.com", "client_id": "OTHER_CLIENT_ID"}))
+		assert.True(t, res.Allow)
+	})
+}
+
+func TestGetClientCredentialsToken(t *testing.T) {
+	policy := &config.Policy{ClientCredentials: &config.ClientCredentials{}}
+	for _, tc := range []struct {
+		name          string
+		policy        *config.Policy
+		authorization string
+		expect        string
+	}{
+		{"bearer", policy, "Bearer TOKEN", "TOKEN"},
+		{"lowercase", policy, "bearer TOKEN", "TOKEN"},
+		{"pomerium", policy, "Bearer Pomerium-TOKEN", ""},
+		{"basic", policy, "Basic dXNlcjpwYXNz", ""},
+		{"not accepted by route", &config.Policy{}, "Bearer TOKEN", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, GetClientCredentialsToken(&Request{
+				Policy: tc.policy,
+				HTTP:   RequestHTTP{Headers: map[string]string{"Authorization": tc.authorization}},
+			}))
+		})
+	}
+}
+
+func TestGetClientCredentialsClientID(t *testing.T) {
+	assert.Equal(t, "AZP", getClientCredentialsClientID(&sdk.Claims{
+		Claims:    jwt.Claims{Subject: "SUBJECT"},
+		RawClaims: map[string]interface{}{"azp": "AZP"},
+	}))
+	assert.Equal(t, "SUBJECT", getClientCredentialsClientID(&sdk.Claims{
+		Claims:    jwt.Claims{Subject: "SUBJECT"},
+		RawClaims: map[string]interface{}{},
+	}))
+}
@@ -7,11 +7,19 @@ import (
 type evaluatorConfig struct {
 	policies                                          []config.Policy
 	clientCA                                          []byte
+	clientCRL                                         []byte
+	clientCRLURL                                      string
+	clientOCSP                                        bool
+	clientRevocationSoftFail                          bool
 	signingKey                                        string
 	signingKeyAlgorithm                               string
 	authenticateURL                                   string
 	googleCloudServerlessAuthenticationServiceAccount string
 	jwtClaimsHeaders                                  config.JWTClaimHeaders
+	providerURL                                       string
+	sharedKey                                         []byte
+	groupsClaim                                       string
+	claimTransforms                                   config.ClaimTransforms
 }
 
 // An Option customizes the evaluator config.
@@ -39,6 +47,35 @@ func WithClientCA(clientCA []byte) Option {
 	}
 }
 
+// WithClientCRL sets the PEM-encoded client certificate revocation list in the config.
+func WithClientCRL(clientCRL []byte) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.clientCRL = clientCRL
+	}
+}
+
+// WithClientCRLURL sets the URL of the client certificate revocation list in the config.
+func WithClientCRLURL(clientCRLURL string) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.clientCRLURL = clientCRLURL
+	}
+}
+
+// WithClientOCSP enables OCSP checking of client certificates in the config.
+func WithClientOCSP(enabled bool) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.clientOCSP = enabled
+	}
+}
+
+// WithClientRevocationSoftFail sets whether client certificates are accepted when their revocation status
+// can't be determined in the config.
+func WithClientRevocationSoftFail(softFail bool) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.clientRevocationSoftFail = softFail
+	}
+}
+
 // WithSigningKey sets the signing key and algorithm in the config.
 func WithSigningKey(signingKeyAlgorithm, signingKey string) Option {
 	return func(cfg *evaluatorConfig) {
@@ -68,3 +105,31 @@ func WithJWTClaimsHeaders(headers config.JWTClaimHeaders) Option {
 		cfg.jwtClaimsHeaders = headers
 	}
 }
+
+// WithProviderURL sets the identity provider URL in the config.
+func WithProviderURL(providerURL string) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.providerURL = providerURL
+	}
+}
+
+// WithSharedKey sets the shared key, which verifies shared URLs, in the config.
+func WithSharedKey(sharedKey []byte) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.sharedKey = sharedKey
+	}
+}
+
+// WithClaimTransforms sets the claim transforms applied to the JWT assertion in the config.
+func WithClaimTransforms(claimTransforms config.ClaimTransforms) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.claimTransforms = claimTransforms
+	}
+}
+
+// WithGroupsClaim sets the ID token claim which contains the user's groups in the config.
+func WithGroupsClaim(groupsClaim string) Option {
+	return func(cfg *evaluatorConfig) {
+		cfg.groupsClaim = groupsClaim
+	}
+}
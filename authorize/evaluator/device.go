@@ -0,0 +1,46 @@
+package evaluator
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/internal/devicecredential"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// RequestDevice is the device field in the request, set when the request's session was verified with one of its
+// user's enrolled device credentials.
+type RequestDevice struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// getDevice returns the device the request's session is bound to, if its credential is still enrolled. Device
+// credentials and session bindings are synced from the databroker to the store.
+func (e *Evaluator) getDevice(ctx context.Context, req *Request) *RequestDevice {
+	if req.Session.ID == "" {
+		return nil
+	}
+
+	value, ok := e.store.GetRecordData(devicecredential.SessionRecordType, req.Session.ID).(*wrapperspb.BytesValue)
+	if !ok {
+		return nil
+	}
+	s, err := devicecredential.SessionFromBytes(value.GetValue())
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("authorize: invalid device session record")
+		return nil
+	}
+
+	value, ok = e.store.GetRecordData(devicecredential.RecordType, s.CredentialID).(*wrapperspb.BytesValue)
+	if !ok {
+		return nil
+	}
+	c, err := devicecredential.FromBytes(value.GetValue())
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("authorize: invalid device credential record")
+		return nil
+	}
+	return &RequestDevice{ID: c.ID, Name: c.Name}
+}
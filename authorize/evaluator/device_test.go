@@ -0,0 +1,63 @@
+package evaluator
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/devicecredential"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+func TestDevice(t *testing.T) {
+	policies := []config.Policy{{
+		From: "https://from.example.com",
+		To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		Allow: &config.PolicyRule{Rule: parser.Rule{And: []parser.Criterion{
+			{Name: "device", Data: parser.Boolean(true)},
+		}}},
+	}}
+
+	store := NewStoreFromProtos(math.MaxUint64)
+	for _, c := range []*devicecredential.Credential{
+		{ID: "DEVICE_ID", UserID: "USER_ID", Name: "laptop"},
+	} {
+		record, err := c.ToRecord()
+		require.NoError(t, err)
+		store.UpdateRecord(0, record)
+	}
+	for _, s := range []*devicecredential.Session{
+		{SessionID: "SESSION_ID", CredentialID: "DEVICE_ID"},
+		{SessionID: "REMOVED_DEVICE_SESSION_ID", CredentialID: "REMOVED_DEVICE_ID"},
+	} {
+		record, err := s.ToRecord()
+		require.NoError(t, err)
+		store.UpdateRecord(0, record)
+	}
+
+	e, err := New(context.Background(), store, nil,
+		WithAuthenticateURL("https://authn.example.com"),
+		WithPolicies(policies))
+	require.NoError(t, err)
+	eval := func(t *testing.T, sessionID string) *Result {
+		res, err := e.Evaluate(context.Background(), &Request{
+			Policy:  &policies[0],
+			Session: RequestSession{ID: sessionID},
+			HTTP: RequestHTTP{
+				Method: http.MethodGet,
+				URL:    "https://from.example.com/",
+			},
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	assert.True(t, eval(t, "SESSION_ID").Allow)
+	assert.False(t, eval(t, "REMOVED_DEVICE_SESSION_ID").Allow)
+	assert.False(t, eval(t, "OTHER_SESSION_ID").Allow)
+}
@@ -5,7 +5,10 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/go-jose/go-jose/v3"
 	"github.com/open-policy-agent/opa/rego"
@@ -13,6 +16,7 @@ import (
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/sharedurl"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
@@ -24,6 +28,7 @@ var notFoundOutput = &Result{
 	Deny: &Denial{
 		Status:  http.StatusNotFound,
 		Message: "route not found",
+		Code:    httputil.ErrorCodeRouteNotFound,
 	},
 	Headers: make(http.Header),
 }
@@ -41,6 +46,15 @@ type RequestHTTP struct {
 	URL               string            `json:"url"`
 	Headers           map[string]string `json:"headers"`
 	ClientCertificate string            `json:"client_certificate"`
+	IP                string            `json:"ip"`
+	// Subdomain is the subdomain matched by the wildcard of the route's from url, if it has one.
+	Subdomain string `json:"subdomain,omitempty"`
+	// Body is only set for routes which authorize the request body or sign it with AWS SigV4.
+	Body []byte `json:"-"`
+	// RequestBody is the request body, for routes which authorize it.
+	RequestBody string `json:"body,omitempty"`
+	// JSONBody is the parsed request body, for routes which authorize it and parse JSON bodies.
+	JSONBody interface{} `json:"json_body,omitempty"`
 }
 
 // RequestSession is the session field in the request.
@@ -53,6 +67,10 @@ type Result struct {
 	Allow   bool
 	Deny    *Denial
 	Headers http.Header
+	// ClientCredentials is set when the request has a valid client credentials token.
+	ClientCredentials *RequestClientCredentials
+	// APIKey is set when the request has a valid API key.
+	APIKey *RequestAPIKey
 
 	DataBrokerServerVersion, DataBrokerRecordVersion uint64
 }
@@ -63,10 +81,14 @@ type Evaluator struct {
 	policyEvaluators  map[uint64]*PolicyEvaluator
 	headersEvaluators *HeadersEvaluator
 	clientCA          []byte
+	revocation        *revocationChecker
+	providerURL       string
+	sharedKey         []byte
 }
 
-// New creates a new Evaluator.
-func New(ctx context.Context, store *Store, options ...Option) (*Evaluator, error) {
+// New creates a new Evaluator. Compiling the rego for a policy is expensive, so the policy evaluators of the
+// previous evaluator, if any, are reused for policies which haven't changed.
+func New(ctx context.Context, store *Store, previous *Evaluator, options ...Option) (*Evaluator, error) {
 	e := &Evaluator{store: store}
 
 	cfg := getConfig(options...)
@@ -76,18 +98,33 @@ func New(ctx context.Context, store *Store, options ...Option) (*Evaluator, erro
 		return nil, err
 	}
 
-	e.headersEvaluators, err = NewHeadersEvaluator(ctx, store)
-	if err != nil {
-		return nil, err
+	// the headers rego only depends on the store
+	if previous != nil && previous.store == store {
+		e.headersEvaluators = previous.headersEvaluators
+	} else {
+		e.headersEvaluators, err = NewHeadersEvaluator(ctx, store)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	e.policyEvaluators = make(map[uint64]*PolicyEvaluator)
-	for _, configPolicy := range cfg.policies {
+	for i := range cfg.policies {
+		configPolicy := &cfg.policies[i]
 		id, err := configPolicy.RouteID()
 		if err != nil {
 			return nil, fmt.Errorf("authorize: error computing policy route id: %w", err)
 		}
-		policyEvaluator, err := NewPolicyEvaluator(ctx, store, &configPolicy) //nolint
+		checksum := configPolicy.Checksum()
+
+		if previous != nil && previous.store == store {
+			if policyEvaluator, ok := previous.policyEvaluators[id]; ok && policyEvaluator.policyChecksum == checksum {
+				e.policyEvaluators[id] = policyEvaluator
+				continue
+			}
+		}
+
+		policyEvaluator, err := NewPolicyEvaluator(ctx, store, configPolicy)
 		if err != nil {
 			return nil, err
 		}
@@ -95,6 +132,12 @@ func New(ctx context.Context, store *Store, options ...Option) (*Evaluator, erro
 	}
 
 	e.clientCA = cfg.clientCA
+	e.providerURL = cfg.providerURL
+	e.sharedKey = cfg.sharedKey
+	e.revocation, err = newRevocationChecker(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("authorize: invalid client CRL: %w", err)
+	}
 
 	return e, nil
 }
@@ -118,43 +161,164 @@ func (e *Evaluator) Evaluate(ctx context.Context, req *Request) (*Result, error)
 		return notFoundOutput, nil
 	}
 
-	clientCA, err := e.getClientCA(req.Policy)
+	policyInput, err := e.newPolicyRequest(ctx, req, policyEvaluator)
 	if err != nil {
 		return nil, err
 	}
-
-	isValidClientCertificate, err := isValidClientCertificate(clientCA, req.HTTP.ClientCertificate)
+	policyOutput, err := policyEvaluator.Evaluate(ctx, policyInput)
 	if err != nil {
-		return nil, fmt.Errorf("authorize: error validating client certificate: %w", err)
+		return nil, err
 	}
 
-	policyOutput, err := policyEvaluator.Evaluate(ctx, &PolicyRequest{
-		HTTP:                     req.HTTP,
-		Session:                  req.Session,
-		IsValidClientCertificate: isValidClientCertificate,
-	})
-	if err != nil {
-		return nil, err
+	// the policy bundle applies to every route
+	if policyBundle := e.store.GetPolicyBundle(); policyBundle != nil {
+		bundleOutput, err := policyBundle.Evaluate(ctx, policyInput)
+		if err != nil {
+			return nil, err
+		}
+		policyOutput = policyOutput.Merge(bundleOutput)
+	}
+
+	// health checks, shared URLs and approved access requests are allowed regardless of the route's policy, but
+	// denials still take precedence
+	if isHealthCheckRequest(req) || e.isValidSharedURL(ctx, req) || e.hasAccessGrant(ctx, req) {
+		policyOutput.Allow = true
+	} else if req.Policy.ExternalAuthorizer != nil {
+		e.applyExternalAuthorizer(ctx, req.Policy.ExternalAuthorizer, policyInput, policyOutput)
 	}
 
 	headersReq := NewHeadersRequestFromPolicy(req.Policy)
 	headersReq.Session = req.Session
+	if req.HTTP.Subdomain != "" {
+		// the audience of wildcard routes is the requested host, rather than the wildcard
+		if u, err := url.Parse(req.HTTP.URL); err == nil {
+			headersReq.FromAudience = u.Hostname()
+		}
+	}
 	headersOutput, err := e.headersEvaluators.Evaluate(ctx, headersReq)
 	if err != nil {
 		return nil, err
 	}
+	if req.HTTP.Subdomain != "" {
+		headersOutput.Headers.Set(httputil.HeaderPomeriumSubdomain, req.HTTP.Subdomain)
+	}
 
 	carryOverJWTAssertion(headersOutput.Headers, req.HTTP.Headers)
 
+	if req.Policy.TenantIsolation != nil {
+		err := applyTenantIsolation(req.Policy.TenantIsolation, req, headersOutput.Claims, headersOutput.Headers, policyOutput)
+		if err != nil {
+			log.Info(ctx).Err(err).Msg("authorize: denied request by tenant isolation")
+		}
+	}
+
+	if policyOutput.Allow && req.Policy.AWSSigV4 != nil {
+		if err := addAWSSigV4Headers(ctx, req, headersOutput.Headers); err != nil {
+			return nil, err
+		}
+	}
+
 	res := &Result{
-		Allow:   policyOutput.Allow,
-		Deny:    policyOutput.Deny,
-		Headers: headersOutput.Headers,
+		Allow:             policyOutput.Allow,
+		Deny:              policyOutput.Deny,
+		Headers:           headersOutput.Headers,
+		ClientCredentials: policyInput.ClientCredentials,
+		APIKey:            policyInput.APIKey,
 	}
 	res.DataBrokerServerVersion, res.DataBrokerRecordVersion = e.store.GetDataBrokerVersions()
 	return res, nil
 }
 
+// newPolicyRequest returns the input to policy evaluation for the request.
+func (e *Evaluator) newPolicyRequest(ctx context.Context, req *Request, policyEvaluator *PolicyEvaluator) (*PolicyRequest, error) {
+	clientCA, err := e.getClientCA(req.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	isValidClientCertificate, err := isValidClientCertificate(ctx, clientCA, req.HTTP.ClientCertificate, e.revocation)
+	if err != nil {
+		return nil, fmt.Errorf("authorize: error validating client certificate: %w", err)
+	}
+
+	clientCertificate, xcert := getClientCertificateInfo(req.HTTP.ClientCertificate)
+	if isValidClientCertificate && !isClientCertificateAllowed(req.Policy, policyEvaluator.allowedClientCertIssuers, clientCertificate, xcert) {
+		isValidClientCertificate = false
+	}
+
+	clientCredentials := e.getClientCredentials(ctx, req)
+	apiKey := e.getAPIKey(ctx, req)
+	device := e.getDevice(ctx, req)
+
+	return &PolicyRequest{
+		HTTP:                     req.HTTP,
+		Session:                  req.Session,
+		IsValidClientCertificate: isValidClientCertificate,
+		ClientCertificate:        clientCertificate,
+		ClientCredentials:        clientCredentials,
+		APIKey:                   apiKey,
+		Device:                   device,
+	}, nil
+}
+
+func isHealthCheckRequest(req *Request) bool {
+	if len(req.Policy.HealthCheckPaths) == 0 {
+		return false
+	}
+
+	requestURL, err := url.Parse(req.HTTP.URL)
+	if err != nil {
+		return false
+	}
+
+	return req.Policy.IsHealthCheck(req.HTTP.Method, *requestURL, net.ParseIP(req.HTTP.IP))
+}
+
+// IsSharedURLRequest returns true if the request is for a shared URL, whether or not it's valid.
+func IsSharedURLRequest(req *Request) bool {
+	requestURL, err := url.Parse(req.HTTP.URL)
+	return err == nil && sharedurl.HasSignature(requestURL)
+}
+
+// isValidSharedURL returns true if the request is for a valid shared URL.
+func (e *Evaluator) isValidSharedURL(ctx context.Context, req *Request) bool {
+	if len(e.sharedKey) == 0 || !IsSharedURLRequest(req) {
+		return false
+	}
+
+	requestURL, err := url.Parse(req.HTTP.URL)
+	if err != nil {
+		return false
+	}
+
+	if err := sharedurl.Verify(e.sharedKey, req.HTTP.Method, requestURL, time.Now()); err != nil {
+		log.Info(ctx).Err(err).Str("url", requestURL.Path).Msg("authorize: invalid shared url")
+		return false
+	}
+	return true
+}
+
+// getClientCredentials returns the verified client credentials token of the request, if any. Invalid tokens are
+// treated as if the request had none.
+func (e *Evaluator) getClientCredentials(ctx context.Context, req *Request) *RequestClientCredentials {
+	rawToken := GetClientCredentialsToken(req)
+	if rawToken == "" {
+		return nil
+	}
+
+	requestURL, err := url.Parse(req.HTTP.URL)
+	if err != nil {
+		return nil
+	}
+
+	clientCredentials, err := verifyClientCredentials(ctx, req.Policy.ClientCredentials, e.providerURL, rawToken, requestURL.Hostname())
+	if err != nil {
+		log.Info(ctx).Err(err).Msg("authorize: invalid client credentials token")
+		return nil
+	}
+	return clientCredentials
+}
+
 func (e *Evaluator) getClientCA(policy *config.Policy) (string, error) {
 	if policy != nil && policy.TLSDownstreamClientCA != "" {
 		bs, err := base64.StdEncoding.DecodeString(policy.TLSDownstreamClientCA)
@@ -183,6 +347,8 @@ func (e *Evaluator) updateStore(cfg *evaluatorConfig) error {
 		cfg.googleCloudServerlessAuthenticationServiceAccount,
 	)
 	e.store.UpdateJWTClaimHeaders(cfg.jwtClaimsHeaders)
+	e.store.UpdateGroupsClaim(cfg.groupsClaim)
+	e.store.UpdateClaimTransforms(cfg.claimTransforms)
 	e.store.UpdateRoutePolicies(cfg.policies)
 	e.store.UpdateSigningKey(jwk)
 
@@ -2,6 +2,7 @@ package evaluator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/config"
@@ -38,7 +40,7 @@ func TestEvaluator(t *testing.T) {
 		store.UpdateIssuer("authenticate.example.com")
 		store.UpdateJWTClaimHeaders(config.NewJWTClaimHeaders("email", "groups", "user", "CUSTOM_KEY"))
 		store.UpdateSigningKey(privateJWK)
-		e, err := New(context.Background(), store, options...)
+		e, err := New(context.Background(), store, nil, options...)
 		require.NoError(t, err)
 		return e.Evaluate(context.Background(), req)
 	}
@@ -86,6 +88,64 @@ func TestEvaluator(t *testing.T) {
 			To:                        config.WeightedURLs{{URL: *mustParseURL("https://to9.example.com")}},
 			AllowAnyAuthenticatedUser: true,
 		},
+		{
+			To:                               config.WeightedURLs{{URL: *mustParseURL("https://to10.example.com")}},
+			AllowPublicUnauthenticatedAccess: true,
+			AllowedClientCertSANs:            []string{"example-subject"},
+			AllowedClientCertIssuers:         []string{"CN=mkcert .*,O=mkcert development CA"},
+		},
+		{
+			To:                               config.WeightedURLs{{URL: *mustParseURL("https://to11.example.com")}},
+			AllowPublicUnauthenticatedAccess: true,
+			AllowedClientCertSANs:            []string{"other-subject"},
+		},
+		{
+			To:                               config.WeightedURLs{{URL: *mustParseURL("https://to12.example.com")}},
+			AllowPublicUnauthenticatedAccess: true,
+			AllowedClientCertIssuers:         []string{"CN=mkcert"},
+		},
+		{
+			To: config.WeightedURLs{{URL: *mustParseURL("https://to13.example.com")}},
+			SubPolicies: []config.SubPolicy{{
+				Rego: []string{`
+package pomerium.policy
+
+allow {
+	input.client_certificate.dns_names[_] == "example-subject"
+}`},
+			}},
+		},
+		{
+			To:           config.WeightedURLs{{URL: *mustParseURL("https://to14.example.com")}},
+			AllowedUsers: []string{"a@example.com"},
+			HealthCheckPaths: []config.HealthCheckPath{
+				{Path: "/healthz", Methods: []string{"GET"}, SourceCIDRs: []string{"10.0.0.0/8"}},
+			},
+		},
+		{
+			To: config.WeightedURLs{{URL: *mustParseURL("https://to15.example.com")}},
+			SubPolicies: []config.SubPolicy{{
+				Rego: []string{`
+package pomerium.policy
+
+allow {
+	input.http.subdomain == "tenant"
+}`},
+			}},
+		},
+		{
+			To:                   config.WeightedURLs{{URL: *mustParseURL("https://to16.example.com")}},
+			AuthorizeRequestBody: true,
+			ParseRequestBodyJSON: true,
+			SubPolicies: []config.SubPolicy{{
+				Rego: []string{`
+package pomerium.policy
+
+allow {
+	input.http.json_body.account_id == 123456789012
+}`},
+			}},
+		},
 	}
 	options := []Option{
 		WithAuthenticateURL("https://authn.example.com"),
@@ -111,6 +171,47 @@ func TestEvaluator(t *testing.T) {
 			require.NoError(t, err)
 			assert.Nil(t, res.Deny)
 		})
+		t.Run("allowed san and issuer", func(t *testing.T) {
+			res, err := eval(t, options, nil, &Request{
+				Policy: &policies[9],
+				HTTP: RequestHTTP{
+					ClientCertificate: testValidCert,
+				},
+			})
+			require.NoError(t, err)
+			assert.Nil(t, res.Deny)
+		})
+		t.Run("disallowed san", func(t *testing.T) {
+			res, err := eval(t, options, nil, &Request{
+				Policy: &policies[10],
+				HTTP: RequestHTTP{
+					ClientCertificate: testValidCert,
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, &Denial{Status: 495, Message: "invalid client certificate"}, res.Deny)
+		})
+		t.Run("partial issuer match", func(t *testing.T) {
+			res, err := eval(t, options, nil, &Request{
+				Policy: &policies[11],
+				HTTP: RequestHTTP{
+					ClientCertificate: testValidCert,
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, &Denial{Status: 495, Message: "invalid client certificate"}, res.Deny)
+		})
+		t.Run("rego", func(t *testing.T) {
+			res, err := eval(t, options, nil, &Request{
+				Policy: &policies[12],
+				HTTP: RequestHTTP{
+					ClientCertificate: testValidCert,
+				},
+			})
+			require.NoError(t, err)
+			assert.True(t, res.Allow)
+			assert.Nil(t, res.Deny)
+		})
 	})
 	t.Run("identity_headers", func(t *testing.T) {
 		t.Run("kubernetes", func(t *testing.T) {
@@ -455,6 +556,96 @@ func TestEvaluator(t *testing.T) {
 		require.NoError(t, err)
 		assert.True(t, res.Allow)
 	})
+	t.Run("health check", func(t *testing.T) {
+		for _, tc := range []struct {
+			name   string
+			method string
+			url    string
+			ip     string
+			allow  bool
+		}{
+			{"allowed", "GET", "https://from.example.com/healthz", "10.1.2.3", true},
+			{"other path", "GET", "https://from.example.com/healthz/other", "10.1.2.3", false},
+			{"other method", "POST", "https://from.example.com/healthz", "10.1.2.3", false},
+			{"other source", "GET", "https://from.example.com/healthz", "192.168.1.1", false},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				res, err := eval(t, options, nil, &Request{
+					Policy: &policies[13],
+					HTTP: RequestHTTP{
+						Method:            tc.method,
+						URL:               tc.url,
+						IP:                tc.ip,
+						ClientCertificate: testValidCert,
+					},
+				})
+				require.NoError(t, err)
+				assert.Equal(t, tc.allow, res.Allow)
+				assert.Nil(t, res.Deny)
+			})
+		}
+		t.Run("invalid client certificate", func(t *testing.T) {
+			res, err := eval(t, options, nil, &Request{
+				Policy: &policies[13],
+				HTTP: RequestHTTP{
+					Method: "GET",
+					URL:    "https://from.example.com/healthz",
+					IP:     "10.1.2.3",
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, &Denial{Status: 495, Message: "invalid client certificate"}, res.Deny)
+		})
+	})
+	t.Run("wildcard subdomain", func(t *testing.T) {
+		res, err := eval(t, options, nil, &Request{
+			Policy: &policies[14],
+			HTTP: RequestHTTP{
+				Method:    "GET",
+				URL:       "https://tenant.apps.example.com",
+				Subdomain: "tenant",
+			},
+		})
+		require.NoError(t, err)
+		assert.True(t, res.Allow)
+		assert.Equal(t, "tenant", res.Headers.Get(httputil.HeaderPomeriumSubdomain))
+
+		res, err = eval(t, options, nil, &Request{
+			Policy: &policies[14],
+			HTTP: RequestHTTP{
+				Method:    "GET",
+				URL:       "https://other.apps.example.com",
+				Subdomain: "other",
+			},
+		})
+		require.NoError(t, err)
+		assert.False(t, res.Allow)
+	})
+	t.Run("request body", func(t *testing.T) {
+		res, err := eval(t, options, nil, &Request{
+			Policy: &policies[15],
+			HTTP: RequestHTTP{
+				Method:      "POST",
+				URL:         "https://from.example.com",
+				RequestBody: `{"account_id":123456789012}`,
+				JSONBody:    map[string]interface{}{"account_id": json.Number("123456789012")},
+			},
+		})
+		require.NoError(t, err)
+		assert.True(t, res.Allow)
+
+		res, err = eval(t, options, nil, &Request{
+			Policy: &policies[15],
+			HTTP: RequestHTTP{
+				Method:      "POST",
+				URL:         "https://from.example.com",
+				RequestBody: `{"account_id":210987654321}`,
+				JSONBody:    map[string]interface{}{"account_id": json.Number("210987654321")},
+			},
+		})
+		require.NoError(t, err)
+		assert.False(t, res.Allow)
+	})
 	t.Run("carry over assertion header", func(t *testing.T) {
 		tcs := []struct {
 			src             map[string]string
@@ -505,6 +696,70 @@ func mustParseURL(str string) *url.URL {
 	return u
 }
 
+func TestNew_ReusesPolicyEvaluators(t *testing.T) {
+	store := NewStore()
+	policies := []config.Policy{
+		{From: "https://a.example.com", To: config.WeightedURLs{{URL: *mustParseURL("https://a.internal")}}, AllowedUsers: []string{"a"}},
+		{From: "https://b.example.com", To: config.WeightedURLs{{URL: *mustParseURL("https://b.internal")}}, AllowedUsers: []string{"b"}},
+	}
+	idA, err := policies[0].RouteID()
+	require.NoError(t, err)
+	idB, err := policies[1].RouteID()
+	require.NoError(t, err)
+
+	e1, err := New(context.Background(), store, nil, WithAuthenticateURL("https://authn.example.com"), WithPolicies(policies))
+	require.NoError(t, err)
+
+	updated := []config.Policy{policies[0], policies[1]}
+	updated[1].AllowedUsers = []string{"c"}
+	e2, err := New(context.Background(), store, e1, WithAuthenticateURL("https://authn.example.com"), WithPolicies(updated))
+	require.NoError(t, err)
+	assert.Same(t, e1.headersEvaluators, e2.headersEvaluators)
+	assert.Same(t, e1.policyEvaluators[idA], e2.policyEvaluators[idA], "unchanged policies should be reused")
+	assert.NotSame(t, e1.policyEvaluators[idB], e2.policyEvaluators[idB], "changed policies should be compiled again")
+
+	e3, err := New(context.Background(), NewStore(), e2, WithAuthenticateURL("https://authn.example.com"), WithPolicies(updated))
+	require.NoError(t, err)
+	assert.NotSame(t, e2.policyEvaluators[idA], e3.policyEvaluators[idA], "policies for a different store should be compiled again")
+}
+
+func TestEvaluator_GroupsClaim(t *testing.T) {
+	policies := []config.Policy{{
+		From:          "https://from.example.com",
+		To:            config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		AllowedGroups: []string{"admins"},
+	}}
+	groups, err := structpb.NewList([]interface{}{"admins", "developers"})
+	require.NoError(t, err)
+	store := NewStoreFromProtos(math.MaxUint64,
+		&session.Session{
+			Id:     "SESSION_ID",
+			UserId: "USER_ID",
+			Claims: map[string]*structpb.ListValue{"realm_access.roles": groups},
+		},
+		&user.User{Id: "USER_ID"},
+	)
+
+	eval := func(t *testing.T, groupsClaim string) *Result {
+		e, err := New(context.Background(), store, nil,
+			WithAuthenticateURL("https://authn.example.com"),
+			WithPolicies(policies),
+			WithGroupsClaim(groupsClaim))
+		require.NoError(t, err)
+		res, err := e.Evaluate(context.Background(), &Request{
+			Policy:  &policies[0],
+			Session: RequestSession{ID: "SESSION_ID"},
+			HTTP:    RequestHTTP{Method: http.MethodGet, URL: "https://from.example.com/path"},
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	assert.True(t, eval(t, "realm_access.roles").Allow)
+	assert.False(t, eval(t, "groups").Allow)
+	assert.False(t, eval(t, "").Allow)
+}
+
 func BenchmarkEvaluator_Evaluate(b *testing.B) {
 	store := NewStore()
 
@@ -522,7 +777,7 @@ func BenchmarkEvaluator_Evaluate(b *testing.B) {
 		WithPolicies(policies),
 	}
 
-	e, err := New(context.Background(), store, options...)
+	e, err := New(context.Background(), store, nil, options...)
 	if !assert.NoError(b, err) {
 		return
 	}
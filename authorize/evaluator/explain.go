@@ -0,0 +1,153 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/topdown"
+
+	"github.com/pomerium/pomerium/pkg/policy"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+// An Explanation explains why a request was allowed or denied.
+type Explanation struct {
+	Allow bool    `json:"allow"`
+	Deny  *Denial `json:"deny,omitempty"`
+	// Criteria are the results of each criterion of the route's policy.
+	Criteria []ExplanationCriterion `json:"criteria"`
+	// SubPolicies are the results of each sub policy's custom rego, with a trace of its evaluation.
+	SubPolicies []ExplanationSubPolicy `json:"sub_policies,omitempty"`
+}
+
+// An ExplanationCriterion is the result of a single criterion of a policy.
+type ExplanationCriterion struct {
+	// Action is the action of the rule the criterion belongs to: allow or deny.
+	Action string `json:"action"`
+	// Operator is how the criterion is combined with the rest of the rule: and, or, not or nor.
+	Operator string `json:"operator"`
+	// Criterion is the criterion in PPL, e.g. {"groups":{"has":"admins"}}.
+	Criterion string `json:"criterion"`
+	// Matched is true if the criterion matched the request.
+	Matched bool `json:"matched"`
+}
+
+// An ExplanationSubPolicy is the result of a sub policy's custom rego.
+type ExplanationSubPolicy struct {
+	Name  string  `json:"name"`
+	Allow bool    `json:"allow"`
+	Deny  *Denial `json:"deny,omitempty"`
+	Trace string  `json:"trace"`
+}
+
+// Explain evaluates the request like Evaluate, and explains the result by evaluating each criterion of the
+// route's policy on its own and tracing the evaluation of custom rego. Every criterion is compiled
+// separately, so explaining a request is much more expensive than evaluating it.
+func (e *Evaluator) Explain(ctx context.Context, req *Request) (*Explanation, error) {
+	res, err := e.Evaluate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &Explanation{
+		Allow:    res.Allow,
+		Deny:     res.Deny,
+		Criteria: []ExplanationCriterion{},
+	}
+	if req.Policy == nil {
+		return explanation, nil
+	}
+
+	id, err := req.Policy.RouteID()
+	if err != nil {
+		return nil, fmt.Errorf("authorize: error computing policy route id: %w", err)
+	}
+	policyEvaluator, ok := e.policyEvaluators[id]
+	if !ok {
+		return explanation, nil
+	}
+
+	input, err := e.newPolicyRequest(ctx, req, policyEvaluator)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range req.Policy.ToPPL().Rules {
+		for _, op := range []struct {
+			operator string
+			criteria []parser.Criterion
+		}{
+			{"and", rule.And},
+			{"or", rule.Or},
+			{"not", rule.Not},
+			{"nor", rule.Nor},
+		} {
+			for _, c := range op.criteria {
+				matched, err := e.evaluateCriterion(ctx, c, input)
+				if err != nil {
+					return nil, err
+				}
+				explanation.Criteria = append(explanation.Criteria, ExplanationCriterion{
+					Action:    string(rule.Action),
+					Operator:  op.operator,
+					Criterion: c.String(),
+					Matched:   matched,
+				})
+			}
+		}
+	}
+
+	for _, q := range policyEvaluator.queries {
+		// the base query is the generated rego for the criteria
+		if q.name == "" {
+			continue
+		}
+
+		tracer := topdown.NewBufferTracer()
+		o, err := policyEvaluator.evaluateQuery(ctx, input, q, rego.EvalQueryTracer(tracer))
+		if err != nil {
+			return nil, err
+		}
+
+		var trace strings.Builder
+		topdown.PrettyTraceWithLocation(&trace, *tracer)
+		explanation.SubPolicies = append(explanation.SubPolicies, ExplanationSubPolicy{
+			Name:  q.name,
+			Allow: o.Allow,
+			Deny:  o.Deny,
+			Trace: trace.String(),
+		})
+	}
+
+	return explanation, nil
+}
+
+// evaluateCriterion returns true if the criterion matches the input.
+func (e *Evaluator) evaluateCriterion(ctx context.Context, c parser.Criterion, input *PolicyRequest) (bool, error) {
+	script, err := policy.GenerateRegoFromPolicy(&parser.Policy{
+		Rules: []parser.Rule{{Action: parser.ActionAllow, Or: []parser.Criterion{c}}},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	q, err := rego.New(
+		rego.Store(e.store),
+		rego.Module("pomerium.policy", script),
+		rego.Query("result = data.pomerium.policy"),
+		getGoogleCloudServerlessHeadersRegoOption,
+		e.store.GetDataBrokerRecordOption(),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	pe := new(PolicyEvaluator)
+	o, err := pe.evaluateQuery(ctx, input, policyQuery{PreparedEvalQuery: q, script: script})
+	if err != nil {
+		return false, err
+	}
+	return o.Allow, nil
+}
@@ -0,0 +1,76 @@
+package evaluator
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestEvaluator_Explain(t *testing.T) {
+	store := NewStoreFromProtos(math.MaxUint64,
+		&session.Session{Id: "SESSION_ID", UserId: "USER_ID"},
+		&user.User{Id: "USER_ID", Email: "a@example.com"},
+	)
+	policy := &config.Policy{
+		From:           "https://from.example.com",
+		To:             config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		AllowedUsers:   []string{"b@example.com"},
+		AllowedDomains: []string{"example.com"},
+		SubPolicies: []config.SubPolicy{{
+			Name: "office hours",
+			Rego: []string{`package pomerium.policy
+
+deny = [403, "closed"] {
+	input.http.method == "DELETE"
+}`},
+		}},
+	}
+	e, err := New(context.Background(), store, nil,
+		WithAuthenticateURL("https://authn.example.com"),
+		WithPolicies([]config.Policy{*policy}))
+	require.NoError(t, err)
+
+	explain := func(t *testing.T, method string) *Explanation {
+		res, err := e.Explain(context.Background(), &Request{
+			Policy:  policy,
+			HTTP:    RequestHTTP{Method: method, URL: "https://from.example.com/"},
+			Session: RequestSession{ID: "SESSION_ID"},
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	t.Run("allowed", func(t *testing.T) {
+		res := explain(t, http.MethodGet)
+		assert.True(t, res.Allow)
+		assert.Nil(t, res.Deny)
+
+		matched := map[string]bool{}
+		for _, c := range res.Criteria {
+			matched[c.Criterion] = c.Matched
+		}
+		assert.Equal(t, true, matched[`{"domain":{"is":"example.com"}}`])
+		assert.Equal(t, false, matched[`{"email":{"is":"b@example.com"}}`])
+
+		if assert.Len(t, res.SubPolicies, 1) {
+			assert.Equal(t, "office hours", res.SubPolicies[0].Name)
+			assert.Nil(t, res.SubPolicies[0].Deny)
+			assert.NotEmpty(t, res.SubPolicies[0].Trace)
+		}
+	})
+	t.Run("denied", func(t *testing.T) {
+		res := explain(t, http.MethodDelete)
+		assert.Equal(t, &Denial{Status: 403, Message: "closed"}, res.Deny)
+		if assert.Len(t, res.SubPolicies, 1) {
+			assert.Equal(t, &Denial{Status: 403, Message: "closed"}, res.SubPolicies[0].Deny)
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	pomeriumgrpc "github.com/pomerium/pomerium/pkg/grpc"
+)
+
+const (
+	// ExternalAuthorizerGRPCMethod is the method called on gRPC external authorizers. Its request and response
+	// are google.protobuf.Structs with the same fields as the JSON request and response of HTTP authorizers.
+	ExternalAuthorizerGRPCMethod = "/pomerium.authorize.ExternalAuthorizer/Authorize"
+
+	externalAuthorizerDefaultTimeout   = 5 * time.Second
+	externalAuthorizerMaxResponseSize  = 1 << 20
+	externalAuthorizerDefaultDenialMsg = "Denied by external authorizer"
+)
+
+var externalAuthorizerHTTP = &http.Client{}
+
+// externalAuthorizerResponse is the verdict of an external authorizer.
+type externalAuthorizerResponse struct {
+	Allow  bool
+	Reason string
+}
+
+// applyExternalAuthorizer combines the verdict of the route's external authorizer with the policy output. In
+// require_both mode the authorizer is only called for requests the policy allows, and in either mode only for
+// requests it doesn't allow. Errors calling the authorizer deny the request.
+func (e *Evaluator) applyExternalAuthorizer(
+	ctx context.Context,
+	ea *config.ExternalAuthorizer,
+	input *PolicyRequest,
+	output *PolicyResponse,
+) {
+	if output.Deny != nil {
+		return
+	}
+
+	switch ea.GetMode() {
+	case config.ExternalAuthorizerModeEither:
+		if output.Allow {
+			return
+		}
+		res, err := callExternalAuthorizer(ctx, ea, input)
+		if err != nil {
+			log.Error(ctx).Err(err).Str("url", ea.URL).Msg("authorize: error calling external authorizer")
+			return
+		}
+		output.Allow = res.Allow
+	default:
+		if !output.Allow {
+			return
+		}
+		res, err := callExternalAuthorizer(ctx, ea, input)
+		if err != nil {
+			log.Error(ctx).Err(err).Str("url", ea.URL).Msg("authorize: error calling external authorizer")
+			res = &externalAuthorizerResponse{}
+		}
+		if !res.Allow {
+			output.Allow = false
+			output.Deny = &Denial{
+				Status:  http.StatusForbidden,
+				Message: res.Reason,
+				Code:    httputil.ErrorCodeExternalAuthorizerDenied,
+			}
+			if output.Deny.Message == "" {
+				output.Deny.Message = externalAuthorizerDefaultDenialMsg
+			}
+		}
+	}
+}
+
+// callExternalAuthorizer sends the policy input to an external authorizer as `{"input": ...}`. The authorizer
+// responds with `{"allow": true}`, optionally with a "reason" for denials. Responses from Open Policy Agent's
+// data API, where the verdict is in "result", are also accepted.
+func callExternalAuthorizer(
+	ctx context.Context,
+	ea *config.ExternalAuthorizer,
+	input *PolicyRequest,
+) (*externalAuthorizerResponse, error) {
+	u, err := ea.GetURL()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := ea.Timeout
+	if timeout == 0 {
+		timeout = externalAuthorizerDefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	switch u.Scheme {
+	case "grpc", "grpcs":
+		raw, err = callGRPCExternalAuthorizer(ctx, u, body)
+	default:
+		raw, err = callHTTPExternalAuthorizer(ctx, u, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseExternalAuthorizerResponse(raw), nil
+}
+
+func callHTTPExternalAuthorizer(ctx context.Context, u *url.URL, body []byte) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := externalAuthorizerHTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from external authorizer: %d", res.StatusCode)
+	}
+
+	var raw map[string]interface{}
+	err = json.NewDecoder(io.LimitReader(res.Body, externalAuthorizerMaxResponseSize)).Decode(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding external authorizer response: %w", err)
+	}
+	return raw, nil
+}
+
+func callGRPCExternalAuthorizer(ctx context.Context, u *url.URL, body []byte) (map[string]interface{}, error) {
+	// the gRPC client uses http and https to pick the default port and transport security
+	addr := *u
+	addr.Scheme = "http"
+	if u.Scheme == "grpcs" {
+		addr.Scheme = "https"
+	}
+	cc, err := pomeriumgrpc.GetGRPCClientConn(ctx, "external_authorizer:"+u.Host, &pomeriumgrpc.Options{
+		Addrs:        []*url.URL{&addr},
+		WithInsecure: u.Scheme == "grpc",
+		ServiceName:  "authorize",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req := new(structpb.Struct)
+	if err := req.UnmarshalJSON(body); err != nil {
+		return nil, err
+	}
+	res := new(structpb.Struct)
+	if err := cc.Invoke(ctx, ExternalAuthorizerGRPCMethod, req, res); err != nil {
+		return nil, err
+	}
+	return res.AsMap(), nil
+}
+
+func parseExternalAuthorizerResponse(raw map[string]interface{}) *externalAuthorizerResponse {
+	if result, ok := raw["result"]; ok {
+		switch result := result.(type) {
+		case bool:
+			return &externalAuthorizerResponse{Allow: result}
+		case map[string]interface{}:
+			raw = result
+		default:
+			return &externalAuthorizerResponse{}
+		}
+	}
+
+	res := new(externalAuthorizerResponse)
+	res.Allow, _ = raw["allow"].(bool)
+	res.Reason, _ = raw["reason"].(string)
+	return res
+}
@@ -0,0 +1,140 @@
+package evaluator
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+)
+
+func TestEvaluator_ExternalAuthorizer(t *testing.T) {
+	var inputs []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input map[string]interface{} `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		inputs = append(inputs, body.Input)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/allow":
+			_, _ = w.Write([]byte(`{"result":{"allow":true}}`))
+		case "/deny":
+			_, _ = w.Write([]byte(`{"allow":false,"reason":"outside business hours"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	eval := func(t *testing.T, policy *config.Policy) *Result {
+		inputs = nil
+		store := NewStoreFromProtos(math.MaxUint64)
+		e, err := New(context.Background(), store, nil,
+			WithAuthenticateURL("https://authn.example.com"),
+			WithPolicies([]config.Policy{*policy}))
+		require.NoError(t, err)
+		res, err := e.Evaluate(context.Background(), &Request{
+			Policy: policy,
+			HTTP:   RequestHTTP{Method: http.MethodGet, URL: "https://from.example.com/"},
+		})
+		require.NoError(t, err)
+		return res
+	}
+	publicPolicy := func(path, mode string) *config.Policy {
+		return &config.Policy{
+			From:                             "https://from.example.com",
+			To:                               config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			AllowPublicUnauthenticatedAccess: true,
+			ExternalAuthorizer:               &config.ExternalAuthorizer{URL: srv.URL + path, Mode: mode},
+		}
+	}
+	privatePolicy := func(path, mode string) *config.Policy {
+		return &config.Policy{
+			From:               "https://from.example.com",
+			To:                 config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			AllowedUsers:       []string{"a@example.com"},
+			ExternalAuthorizer: &config.ExternalAuthorizer{URL: srv.URL + path, Mode: mode},
+		}
+	}
+
+	t.Run("require both", func(t *testing.T) {
+		res := eval(t, publicPolicy("/allow", ""))
+		assert.True(t, res.Allow)
+		assert.Nil(t, res.Deny)
+		if assert.Len(t, inputs, 1) {
+			assert.Equal(t, "https://from.example.com/", inputs[0]["http"].(map[string]interface{})["url"])
+		}
+
+		res = eval(t, publicPolicy("/deny", ""))
+		assert.False(t, res.Allow)
+		assert.Equal(t, &Denial{Status: 403, Message: "outside business hours", Code: httputil.ErrorCodeExternalAuthorizerDenied}, res.Deny)
+
+		res = eval(t, publicPolicy("/error", ""))
+		assert.False(t, res.Allow)
+		assert.Equal(t, &Denial{Status: 403, Message: "Denied by external authorizer", Code: httputil.ErrorCodeExternalAuthorizerDenied}, res.Deny)
+
+		res = eval(t, privatePolicy("/allow", ""))
+		assert.False(t, res.Allow)
+		assert.Empty(t, inputs, "should not call the authorizer when the policy denies")
+	})
+	t.Run("either", func(t *testing.T) {
+		res := eval(t, privatePolicy("/allow", config.ExternalAuthorizerModeEither))
+		assert.True(t, res.Allow)
+		assert.Nil(t, res.Deny)
+
+		res = eval(t, privatePolicy("/deny", config.ExternalAuthorizerModeEither))
+		assert.False(t, res.Allow)
+		assert.Nil(t, res.Deny)
+
+		res = eval(t, privatePolicy("/error", config.ExternalAuthorizerModeEither))
+		assert.False(t, res.Allow)
+
+		res = eval(t, publicPolicy("/deny", config.ExternalAuthorizerModeEither))
+		assert.True(t, res.Allow)
+		assert.Empty(t, inputs, "should not call the authorizer when the policy allows")
+	})
+}
+
+func TestCallExternalAuthorizer_GRPC(t *testing.T) {
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var method string
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		method, _ = grpc.MethodFromServerStream(stream)
+		req := new(structpb.Struct)
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		u := req.GetFields()["input"].GetStructValue().GetFields()["http"].GetStructValue().GetFields()["url"]
+		return stream.SendMsg(&structpb.Struct{Fields: map[string]*structpb.Value{
+			"allow": structpb.NewBoolValue(u.GetStringValue() == "https://from.example.com/allowed"),
+		}})
+	}))
+	go func() { _ = srv.Serve(li) }()
+	defer srv.Stop()
+
+	ea := &config.ExternalAuthorizer{URL: "grpc://" + li.Addr().String()}
+
+	res, err := callExternalAuthorizer(context.Background(), ea, &PolicyRequest{HTTP: RequestHTTP{URL: "https://from.example.com/allowed"}})
+	require.NoError(t, err)
+	assert.True(t, res.Allow)
+	assert.Equal(t, ExternalAuthorizerGRPCMethod, method)
+
+	res, err = callExternalAuthorizer(context.Background(), ea, &PolicyRequest{HTTP: RequestHTTP{URL: "https://from.example.com/other"}})
+	require.NoError(t, err)
+	assert.False(t, res.Allow)
+}
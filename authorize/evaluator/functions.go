@@ -13,7 +13,15 @@ import (
 
 var isValidClientCertificateCache, _ = lru.New2Q(100)
 
-func isValidClientCertificate(ca, cert string) (bool, error) {
+type clientCertificateVerification struct {
+	valid  bool
+	cert   *x509.Certificate
+	issuer *x509.Certificate
+}
+
+// isValidClientCertificate returns true if cert is valid for ca and, when revocation is not nil, has not
+// been revoked.
+func isValidClientCertificate(ctx context.Context, ca, cert string, revocation *revocationChecker) (bool, error) {
 	// when ca is the empty string, client certificates are always accepted
 	if ca == "" {
 		return true, nil
@@ -24,11 +32,24 @@ func isValidClientCertificate(ca, cert string) (bool, error) {
 		return false, nil
 	}
 
+	v, err := verifyClientCertificate(ca, cert)
+	if err != nil || !v.valid {
+		return false, err
+	}
+
+	// a client certificate trusted directly by the CA has no issuer to check revocation against
+	if revocation == nil || v.issuer == nil {
+		return true, nil
+	}
+	return !revocation.isRevoked(ctx, v.cert, v.issuer), nil
+}
+
+func verifyClientCertificate(ca, cert string) (*clientCertificateVerification, error) {
 	cacheKey := [2]string{ca, cert}
 
 	value, ok := isValidClientCertificateCache.Get(cacheKey)
 	if ok {
-		return value.(bool), nil
+		return value.(*clientCertificateVerification), nil
 	}
 
 	roots := x509.NewCertPool()
@@ -36,22 +57,28 @@ func isValidClientCertificate(ca, cert string) (bool, error) {
 
 	xcert, err := parseCertificate(cert)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	_, verifyErr := xcert.Verify(x509.VerifyOptions{
+	chains, verifyErr := xcert.Verify(x509.VerifyOptions{
 		Roots:     roots,
 		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
 	})
-	valid := verifyErr == nil
+	v := &clientCertificateVerification{
+		valid: verifyErr == nil,
+		cert:  xcert,
+	}
+	if len(chains) > 0 && len(chains[0]) > 1 {
+		v.issuer = chains[0][1]
+	}
 
 	if verifyErr != nil {
 		log.Debug(context.Background()).Err(verifyErr).Msg("client certificate failed verification: %w")
 	}
 
-	isValidClientCertificateCache.Add(cacheKey, valid)
+	isValidClientCertificateCache.Add(cacheKey, v)
 
-	return valid, nil
+	return v, nil
 }
 
 func parseCertificate(pemStr string) (*x509.Certificate, error) {
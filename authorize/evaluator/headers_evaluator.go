@@ -2,48 +2,68 @@ package evaluator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 
+	"github.com/go-jose/go-jose/v3"
 	"github.com/open-policy-agent/opa/rego"
 
 	"github.com/pomerium/pomerium/authorize/evaluator/opa"
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
 )
 
 // HeadersRequest is the input to the headers.rego script.
 type HeadersRequest struct {
-	EnableGoogleCloudServerlessAuthentication bool           `json:"enable_google_cloud_serverless_authentication"`
-	FromAudience                              string         `json:"from_audience"`
-	KubernetesServiceAccountToken             string         `json:"kubernetes_service_account_token"`
-	ToAudience                                string         `json:"to_audience"`
-	Session                                   RequestSession `json:"session"`
+	EnableGoogleCloudServerlessAuthentication bool                   `json:"enable_google_cloud_serverless_authentication"`
+	FeatureFlags                              map[string]string      `json:"feature_flags"`
+	FromAudience                              string                 `json:"from_audience"`
+	IDPAccessTokenHeader                      string                 `json:"idp_access_token_header"`
+	IDPIDTokenHeader                          string                 `json:"idp_id_token_header"`
+	JWTClaimHeaders                           config.JWTClaimHeaders `json:"jwt_claim_headers"`
+	KubernetesServiceAccountToken             string                 `json:"kubernetes_service_account_token"`
+	ToAudience                                string                 `json:"to_audience"`
+	Session                                   RequestSession         `json:"session"`
+	// TokenExchange is performed outside of the headers.rego script, so it's not part of the input.
+	TokenExchange *config.TokenExchange `json:"-"`
 }
 
 // NewHeadersRequestFromPolicy creates a new HeadersRequest from a policy.
 func NewHeadersRequestFromPolicy(policy *config.Policy) *HeadersRequest {
 	input := new(HeadersRequest)
 	input.EnableGoogleCloudServerlessAuthentication = policy.EnableGoogleCloudServerlessAuthentication
+	input.FeatureFlags = policy.FeatureFlags
 	if u, err := urlutil.ParseAndValidateURL(policy.From); err == nil {
 		input.FromAudience = u.Hostname()
 	}
+	input.IDPAccessTokenHeader = policy.IDPAccessTokenHeader
+	input.IDPIDTokenHeader = policy.IDPIDTokenHeader
+	input.JWTClaimHeaders = policy.JWTClaimsHeaders
 	input.KubernetesServiceAccountToken = policy.KubernetesServiceAccountToken
+	input.TokenExchange = policy.TokenExchange
 	for _, wu := range policy.To {
 		input.ToAudience = wu.URL.Hostname()
 	}
+	if policy.GoogleCloudServerlessAuthenticationAudience != "" {
+		input.ToAudience = policy.GoogleCloudServerlessAuthenticationAudience
+	}
 	return input
 }
 
 // HeadersResponse is the output from the headers.rego script.
 type HeadersResponse struct {
 	Headers http.Header
+	// Claims are the claims of the JWT assertion.
+	Claims map[string]interface{}
 }
 
 // A HeadersEvaluator evaluates the headers.rego script.
 type HeadersEvaluator struct {
-	q rego.PreparedEvalQuery
+	q     rego.PreparedEvalQuery
+	store *Store
 }
 
 // NewHeadersEvaluator creates a new HeadersEvaluator.
@@ -62,7 +82,8 @@ func NewHeadersEvaluator(ctx context.Context, store *Store) (*HeadersEvaluator,
 	}
 
 	return &HeadersEvaluator{
-		q: q,
+		q:     q,
+		store: store,
 	}, nil
 }
 
@@ -79,11 +100,74 @@ func (e *HeadersEvaluator) Evaluate(ctx context.Context, req *HeadersRequest) (*
 		return nil, fmt.Errorf("authorize: unexpected empty result from evaluating headers.rego")
 	}
 
+	headers := e.getHeader(rs[0].Bindings)
+	signedJWT, claims, err := e.signJWT(rs[0].Bindings)
+	if err != nil {
+		return nil, fmt.Errorf("authorize: error signing jwt: %w", err)
+	}
+	headers.Set(httputil.HeaderPomeriumJWTAssertion, signedJWT)
+
+	if req.TokenExchange != nil {
+		subjectToken := e.getSessionToken(rs[0].Bindings, req.TokenExchange.GetSubjectTokenType())
+		name, value, err := getTokenExchangeHeader(ctx, req.TokenExchange, subjectToken)
+		if err != nil {
+			return nil, fmt.Errorf("authorize: error exchanging token: %w", err)
+		}
+		headers.Set(name, value)
+	}
+
 	return &HeadersResponse{
-		Headers: e.getHeader(rs[0].Bindings),
+		Headers: headers,
+		Claims:  claims,
 	}, nil
 }
 
+// signJWT signs the JWT payload computed by the headers.rego script with the store's signing key. It returns
+// the signed JWT and its claims.
+func (e *HeadersEvaluator) signJWT(vars rego.Vars) (string, map[string]interface{}, error) {
+	m, _ := vars["result"].(map[string]interface{})
+	payload, ok := m["jwt_payload"].(map[string]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("missing jwt payload")
+	}
+	e.store.GetClaimTransforms().ApplyToMap(payload)
+
+	signingKey := e.store.GetSigningKey()
+	if signingKey == nil {
+		return "", nil, fmt.Errorf("missing signing key")
+	}
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.SignatureAlgorithm(signingKey.Algorithm), Key: signingKey},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	// the payload contains json.Numbers, so it's serialized with encoding/json before signing
+	bs, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	jws, err := signer.Sign(bs)
+	if err != nil {
+		return "", nil, err
+	}
+	signedJWT, err := jws.CompactSerialize()
+	if err != nil {
+		return "", nil, err
+	}
+	return signedJWT, payload, nil
+}
+
+// getSessionToken returns the session's identity provider access_token or id_token computed by the
+// headers.rego script.
+func (e *HeadersEvaluator) getSessionToken(vars rego.Vars, tokenType string) string {
+	m, _ := vars["result"].(map[string]interface{})
+	tokens, _ := m["session_tokens"].(map[string]interface{})
+	token, _ := tokens[tokenType].(string)
+	return token
+}
+
 func (e *HeadersEvaluator) getHeader(vars rego.Vars) http.Header {
 	h := make(http.Header)
 
@@ -2,7 +2,13 @@ package evaluator
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -11,11 +17,36 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
 )
 
+func TestNewHeadersRequestFromPolicy(t *testing.T) {
+	req := NewHeadersRequestFromPolicy(&config.Policy{
+		EnableGoogleCloudServerlessAuthentication: true,
+		From: "https://from.example.com",
+		To: config.WeightedURLs{
+			{URL: *mustParseURL("http://to.example.com")},
+		},
+	})
+	assert.Equal(t, "from.example.com", req.FromAudience)
+	assert.Equal(t, "to.example.com", req.ToAudience)
+
+	req = NewHeadersRequestFromPolicy(&config.Policy{
+		EnableGoogleCloudServerlessAuthentication:   true,
+		GoogleCloudServerlessAuthenticationAudience: "CLIENT_ID.apps.googleusercontent.com",
+		From: "https://from.example.com",
+		To: config.WeightedURLs{
+			{URL: *mustParseURL("http://to.example.com")},
+		},
+	})
+	assert.Equal(t, "CLIENT_ID.apps.googleusercontent.com", req.ToAudience)
+}
+
 func TestHeadersEvaluator(t *testing.T) {
 	type A = []interface{}
 	type M = map[string]interface{}
@@ -59,5 +90,217 @@ func TestHeadersEvaluator(t *testing.T) {
 
 		assert.LessOrEqual(t, claims["exp"], float64(time.Now().Add(time.Minute*6).Unix()),
 			"JWT should expire within 5 minutes, but got: %v", claims["exp"])
+		assert.NotContains(t, claims, "feature_flags")
+	})
+	t.Run("eddsa", func(t *testing.T) {
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(edKey)
+		require.NoError(t, err)
+		edPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		edPrivateJWK, err := cryptutil.PrivateJWKFromBytes(edPEM, jose.EdDSA)
+		require.NoError(t, err)
+		edPublicJWK, err := cryptutil.PublicJWKFromBytes(edPEM, jose.EdDSA)
+		require.NoError(t, err)
+
+		store := NewStoreFromProtos(math.MaxUint64)
+		store.UpdateIssuer("authenticate.example.com")
+		store.UpdateSigningKey(edPrivateJWK)
+		e, err := NewHeadersEvaluator(context.Background(), store)
+		require.NoError(t, err)
+		output, err := e.Evaluate(context.Background(), &HeadersRequest{
+			FromAudience: "from.example.com",
+			ToAudience:   "to.example.com",
+		})
+		require.NoError(t, err)
+
+		rawJWT, err := jwt.ParseSigned(output.Headers.Get("X-Pomerium-Jwt-Assertion"))
+		require.NoError(t, err)
+		require.Len(t, rawJWT.Headers, 1)
+		assert.Equal(t, "EdDSA", rawJWT.Headers[0].Algorithm)
+		assert.Equal(t, edPublicJWK.KeyID, rawJWT.Headers[0].KeyID)
+
+		var claims M
+		assert.NoError(t, rawJWT.Claims(edPublicJWK, &claims))
+	})
+	t.Run("claim transforms", func(t *testing.T) {
+		store := NewStoreFromProtos(math.MaxUint64)
+		store.UpdateIssuer("AUTHENTICATE.example.com")
+		store.UpdateSigningKey(privateJWK)
+		store.UpdateClaimTransforms(config.ClaimTransforms{
+			{Rename: "iss", To: "issuer"},
+			{Lowercase: "issuer"},
+			{Default: "tenant", Value: "acme"},
+		})
+		e, err := NewHeadersEvaluator(context.Background(), store)
+		require.NoError(t, err)
+		output, err := e.Evaluate(context.Background(), &HeadersRequest{
+			FromAudience: "from.example.com",
+			ToAudience:   "to.example.com",
+		})
+		require.NoError(t, err)
+
+		rawJWT, err := jwt.ParseSigned(output.Headers.Get("X-Pomerium-Jwt-Assertion"))
+		require.NoError(t, err)
+
+		var claims M
+		err = rawJWT.Claims(publicJWK, &claims)
+		require.NoError(t, err)
+
+		assert.NotContains(t, claims, "iss")
+		assert.Equal(t, "authenticate.example.com", claims["issuer"])
+		assert.Equal(t, "acme", claims["tenant"])
+		assert.Equal(t, "from.example.com", claims["aud"])
+	})
+	t.Run("feature flags", func(t *testing.T) {
+		output, err := eval(t,
+			[]proto.Message{},
+			&HeadersRequest{
+				FeatureFlags: map[string]string{"beta": "true", "theme": "dark"},
+				FromAudience: "from.example.com",
+				ToAudience:   "to.example.com",
+			})
+		require.NoError(t, err)
+
+		rawJWT, err := jwt.ParseSigned(output.Headers.Get("X-Pomerium-Jwt-Assertion"))
+		require.NoError(t, err)
+
+		var claims M
+		err = rawJWT.Claims(publicJWK, &claims)
+		require.NoError(t, err)
+
+		assert.Equal(t, M{"beta": "true", "theme": "dark"}, claims["feature_flags"])
+	})
+	t.Run("idp tokens", func(t *testing.T) {
+		output, err := eval(t,
+			[]proto.Message{
+				&session.Session{
+					Id:         "s1",
+					IdToken:    &session.IDToken{Raw: "ID_TOKEN"},
+					OauthToken: &session.OAuthToken{AccessToken: "ACCESS_TOKEN"},
+				},
+			},
+			&HeadersRequest{
+				FromAudience:         "from.example.com",
+				ToAudience:           "to.example.com",
+				IDPAccessTokenHeader: "X-Idp-Access-Token",
+				IDPIDTokenHeader:     "X-Idp-Id-Token",
+				Session:              RequestSession{ID: "s1"},
+			})
+		require.NoError(t, err)
+		assert.Equal(t, "ACCESS_TOKEN", output.Headers.Get("X-Idp-Access-Token"))
+		assert.Equal(t, "ID_TOKEN", output.Headers.Get("X-Idp-Id-Token"))
+
+		output, err = eval(t,
+			[]proto.Message{&session.Session{Id: "s2"}},
+			&HeadersRequest{
+				FromAudience:         "from.example.com",
+				ToAudience:           "to.example.com",
+				IDPAccessTokenHeader: "X-Idp-Access-Token",
+				Session:              RequestSession{ID: "s2"},
+			})
+		require.NoError(t, err)
+		assert.Equal(t, []string{""}, output.Headers.Values("X-Idp-Access-Token"),
+			"the header should be cleared when the session has no token")
+		assert.Empty(t, output.Headers.Values("X-Idp-Id-Token"))
+	})
+	t.Run("token exchange", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = r.ParseForm()
+			_, _ = w.Write([]byte(`{"access_token":"EXCHANGED_` + r.Form.Get("subject_token") + `","token_type":"Bearer"}`))
+		}))
+		defer srv.Close()
+
+		output, err := eval(t,
+			[]proto.Message{
+				&session.Session{Id: "s1", IdToken: &session.IDToken{Raw: "ID_TOKEN"}},
+			},
+			&HeadersRequest{
+				FromAudience: "from.example.com",
+				ToAudience:   "to.example.com",
+				Session:      RequestSession{ID: "s1"},
+				TokenExchange: &config.TokenExchange{
+					TokenURL:         srv.URL,
+					SubjectTokenType: "id_token",
+					Header:           "X-Upstream-Token",
+				},
+			})
+		require.NoError(t, err)
+		assert.Equal(t, "EXCHANGED_ID_TOKEN", output.Headers.Get("X-Upstream-Token"))
+	})
+	t.Run("kubernetes", func(t *testing.T) {
+		output, err := eval(t,
+			[]proto.Message{
+				&session.Session{Id: "s1", UserId: "u1"},
+				&user.User{Id: "u1"},
+			},
+			&HeadersRequest{
+				FromAudience:                  "from.example.com",
+				ToAudience:                    "to.example.com",
+				KubernetesServiceAccountToken: "TOKEN",
+				Session:                       RequestSession{ID: "s1"},
+			})
+		require.NoError(t, err)
+		assert.Equal(t, "Bearer TOKEN", output.Headers.Get("Authorization"))
+		assert.Equal(t, "u1", output.Headers.Get("Impersonate-User"),
+			"the user id should be used when the user has no email")
+		assert.Empty(t, output.Headers.Values("Impersonate-Group"))
+
+		output, err = eval(t,
+			[]proto.Message{},
+			&HeadersRequest{
+				FromAudience:                  "from.example.com",
+				ToAudience:                    "to.example.com",
+				KubernetesServiceAccountToken: "TOKEN",
+			})
+		require.NoError(t, err)
+		assert.Equal(t, "system:anonymous", output.Headers.Get("Impersonate-User"))
+	})
+	t.Run("jwt claim headers", func(t *testing.T) {
+		address, _ := structpb.NewList([]interface{}{map[string]interface{}{"country": "CA"}})
+		groups, _ := structpb.NewList([]interface{}{"a", "b"})
+		nickname, _ := structpb.NewList([]interface{}{"user1"})
+
+		store := NewStoreFromProtos(math.MaxUint64, &session.Session{
+			Id: "s1",
+			Claims: map[string]*structpb.ListValue{
+				"address":  address,
+				"roles":    groups,
+				"nickname": nickname,
+			},
+		})
+		store.UpdateIssuer("authenticate.example.com")
+		store.UpdateJWTClaimHeaders(config.JWTClaimHeaders{
+			"X-Remote-Country":  {Claim: "address", Path: "country"},
+			"X-Remote-Roles":    {Claim: "roles", Delimiter: ";"},
+			"X-Remote-Nickname": {Claim: "nickname"},
+		})
+		store.UpdateSigningKey(privateJWK)
+		e, err := NewHeadersEvaluator(context.Background(), store)
+		require.NoError(t, err)
+
+		output, err := e.Evaluate(context.Background(), &HeadersRequest{
+			FromAudience: "from.example.com",
+			ToAudience:   "to.example.com",
+			Session:      RequestSession{ID: "s1"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "CA", output.Headers.Get("X-Remote-Country"))
+		assert.Equal(t, "a;b", output.Headers.Get("X-Remote-Roles"))
+		assert.Equal(t, "user1", output.Headers.Get("X-Remote-Nickname"))
+
+		output, err = e.Evaluate(context.Background(), &HeadersRequest{
+			FromAudience: "from.example.com",
+			ToAudience:   "to.example.com",
+			Session:      RequestSession{ID: "s1"},
+			JWTClaimHeaders: config.JWTClaimHeaders{
+				"X-Remote-Nickname": {},
+				"X-Remote-User":     {Claim: "nickname"},
+			},
+		})
+		require.NoError(t, err)
+		assert.Empty(t, output.Headers.Values("X-Remote-Nickname"))
+		assert.Equal(t, "user1", output.Headers.Get("X-Remote-User"))
+		assert.Equal(t, "a;b", output.Headers.Get("X-Remote-Roles"))
 	})
 }
@@ -2,7 +2,11 @@ package pomerium.headers
 
 # input:
 #   enable_google_cloud_serverless_authentication: boolean
+#   feature_flags: map[string]string
 #   from_audience: string
+#   idp_access_token_header: string
+#   idp_id_token_header: string
+#   jwt_claim_headers: map[string]{claim: string, path: string, delimiter: string}
 #   kubernetes_service_account_token: string
 #   session:
 #     id: string
@@ -10,10 +14,7 @@ package pomerium.headers
 #
 # data:
 #   issuer: string
-#   jwt_claim_headers: map[string]string
-#   signing_key:
-#     alg: string
-#     kid: string
+#   jwt_claim_headers: map[string]{claim: string, path: string, delimiter: string}
 #
 # functions:
 #   get_databroker_record
@@ -22,6 +23,8 @@ package pomerium.headers
 #
 # output:
 #   identity_headers: map[string][]string
+#   session_tokens: {access_token: string, id_token: string}, used by the headers evaluator for token exchange
+#   jwt_payload: map[string]any, signed by the headers evaluator as the x-pomerium-jwt-assertion header
 
 # 5 minutes from now in seconds
 five_minutes := round((time.now_ns() / 1e9) + (60 * 5))
@@ -62,18 +65,16 @@ group_ids = gs {
 } else = gs {
 	gs = directory_user.group_ids
 	gs != null
+} else = gs {
+	data.groups_claim != ""
+	gs = session.claims[data.groups_claim]
+	gs != null
 } else = [] {
 	true
 }
 
 groups := array.concat(group_ids, array.concat(get_databroker_group_names(group_ids), get_databroker_group_emails(group_ids)))
 
-jwt_headers = {
-	"typ": "JWT",
-	"alg": data.signing_key.alg,
-	"kid": data.signing_key.kid,
-}
-
 jwt_payload_aud = v {
 	v := input.from_audience
 } else = "" {
@@ -138,6 +139,13 @@ jwt_payload_groups = v {
 	true
 }
 
+jwt_payload_feature_flags = v {
+	v = input.feature_flags
+	count(v) > 0
+} else = null {
+	true
+}
+
 base_jwt_claims := [
 	["iss", jwt_payload_iss],
 	["aud", jwt_payload_aud],
@@ -148,11 +156,19 @@ base_jwt_claims := [
 	["user", jwt_payload_user],
 	["email", jwt_payload_email],
 	["groups", jwt_payload_groups],
+	["feature_flags", jwt_payload_feature_flags],
 ]
 
+# the route's jwt claim headers override the global ones, and a header with an empty claim is removed
+jwt_claim_headers := {header_name: spec |
+	headers := object.union(object_or_empty(data.jwt_claim_headers), object_or_empty(input.jwt_claim_headers))
+	spec := headers[header_name]
+	spec.claim != ""
+}
+
 additional_jwt_claims := [[k, v] |
 	some header_name
-	claim_key := data.jwt_claim_headers[header_name]
+	claim_key := jwt_claim_headers[header_name].claim
 
 	# exclude base_jwt_claims
 	count([1 |
@@ -161,7 +177,7 @@ additional_jwt_claims := [[k, v] |
 	]) == 0
 
 	# the claim value can come from session claims or user claims
-	claim_value := object.get(session.claims, claim_key, object.get(user.claims, claim_key, null))
+	claim_value := get_claim_value(claim_key)
 
 	k := claim_key
 	v := get_header_string_value(claim_value)
@@ -175,19 +191,45 @@ jwt_payload = {key: value |
 	value != null
 }
 
-signed_jwt = io.jwt.encode_sign(jwt_headers, jwt_payload, data.signing_key)
+# an empty Impersonate-User header is ignored by the API server, which would then authorize the request as the
+# service account itself, so the user falls back to the user id and finally to the anonymous user
+kubernetes_impersonate_user = v {
+	v := jwt_payload_email
+	v != ""
+} else = v {
+	v := jwt_payload_user
+	v != ""
+} else = "system:anonymous" {
+	true
+}
 
 kubernetes_headers = h {
 	input.kubernetes_service_account_token != ""
-	h := [
+	h1 := [
 		["Authorization", concat(" ", ["Bearer", input.kubernetes_service_account_token])],
-		["Impersonate-User", jwt_payload_email],
-		["Impersonate-Group", get_header_string_value(jwt_payload_groups)],
+		["Impersonate-User", kubernetes_impersonate_user],
 	]
+
+	# an empty Impersonate-Group header would impersonate a group named ""
+	h2 := [["Impersonate-Group", get_header_string_value(jwt_payload_groups)] | count(jwt_payload_groups) > 0]
+	h := array.concat(h1, h2)
 } else = [] {
 	true
 }
 
+session_tokens := {
+	"access_token": object.get(object_or_empty(object.get(session, "oauth_token", {})), "access_token", ""),
+	"id_token": object.get(object_or_empty(object.get(session, "id_token", {})), "raw", ""),
+}
+
+# the identity provider token headers are always set when configured, even if the session has no token, so that
+# a client cannot supply its own value
+idp_token_headers = h {
+	h1 := [[input.idp_access_token_header, session_tokens.access_token] | input.idp_access_token_header != ""]
+	h2 := [[input.idp_id_token_header, session_tokens.id_token] | input.idp_id_token_header != ""]
+	h := array.concat(h1, h2)
+}
+
 google_cloud_serverless_authentication_service_account = s {
 	s := data.google_cloud_serverless_authentication_service_account
 } else = "" {
@@ -202,21 +244,15 @@ google_cloud_serverless_headers = h {
 }
 
 identity_headers := {key: values |
-	h1 := [["x-pomerium-jwt-assertion", signed_jwt]]
-	h2 := [[header_name, header_value] |
+	h1 := [[header_name, header_value] |
 		some header_name
-		k := data.jwt_claim_headers[header_name]
-		header_value := array.concat(
-			[cv |
-				[ck, cv] := jwt_claims[_]
-				ck == k
-			],
-			[""]
-		)[0]
+		spec := jwt_claim_headers[header_name]
+		header_value := get_claim_header_value(spec)
 	]
 
-	h3 := kubernetes_headers
-	h4 := [[k, v] | v := google_cloud_serverless_headers[k]]
+	h2 := kubernetes_headers
+	h3 := [[k, v] | v := google_cloud_serverless_headers[k]]
+	h4 := idp_token_headers
 
 	h := array.concat(array.concat(array.concat(h1, h2), h3), h4)
 
@@ -243,3 +279,61 @@ get_header_string_value(obj) = s {
 } else = s {
 	s := concat(",", [obj])
 }
+
+object_or_empty(obj) = obj {
+	is_object(obj)
+} else = {} {
+	true
+}
+
+# get_claim_value returns the value of a claim, either from the base JWT claims, the session claims or the
+# user claims.
+get_claim_value(k) = v {
+	[xk, v] := base_jwt_claims[_]
+	xk == k
+	v != null
+} else = v {
+	v := object.get(object.get(session, "claims", {}), k, object.get(object.get(user, "claims", {}), k, null))
+	v != null
+} else = null {
+	true
+}
+
+# get_claim_path_value returns the value nested in a claim at the dot-separated path. Claims from the identity
+# provider are stored as lists, so a single element list is unwrapped first.
+get_claim_path_value(v, path) = v {
+	path == ""
+} else = r {
+	walk(unwrap_single_value(v), [split(path, "."), r])
+} else = null {
+	true
+}
+
+unwrap_single_value(v) = r {
+	is_array(v)
+	count(v) == 1
+	r := v[0]
+} else = v {
+	true
+}
+
+get_claim_header_value(spec) = s {
+	v := get_claim_path_value(get_claim_value(spec.claim), object.get(spec, "path", ""))
+	v != null
+	s := join_header_values(v, object.get(spec, "delimiter", ","))
+} else = "" {
+	true
+}
+
+join_header_values(v, delimiter) = s {
+	is_array(v)
+	s := concat(delimiter, [to_header_string(x) | x := v[_]])
+} else = s {
+	s := to_header_string(v)
+}
+
+to_header_string(v) = v {
+	is_string(v)
+} else = s {
+	s := json.marshal(v)
+}
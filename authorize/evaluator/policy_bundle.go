@@ -0,0 +1,111 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/open-policy-agent/opa/rego"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+const (
+	// policyBundleKeyID is the id of the configured verification key. It overrides the key id of the
+	// bundle's signature, so bundles are always verified with the configured key.
+	policyBundleKeyID = "pomerium"
+	// policyBundleMaxSize is the maximum size of a policy bundle
+	policyBundleMaxSize        = 100 << 20
+	policyBundleRequestTimeout = 30 * time.Second
+)
+
+var policyBundleHTTP = &http.Client{Timeout: policyBundleRequestTimeout}
+
+// FetchPolicyBundle fetches the policy bundle and verifies its signature. If etag is set and the bundle
+// hasn't changed since it was fetched, nil is returned. Otherwise the bundle is returned with its new etag.
+func FetchPolicyBundle(ctx context.Context, cfg *config.PolicyBundle, etag string) (*bundle.Bundle, string, error) {
+	key, err := cfg.GetVerificationKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid verification key: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	res, err := policyBundleHTTP.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, etag, nil
+	default:
+		return nil, "", fmt.Errorf("unexpected status code fetching policy bundle: %d", res.StatusCode)
+	}
+
+	b, err := bundle.NewReader(io.LimitReader(res.Body, policyBundleMaxSize)).
+		WithSizeLimitBytes(policyBundleMaxSize).
+		WithBundleVerificationConfig(bundle.NewVerificationConfig(map[string]*bundle.KeyConfig{
+			policyBundleKeyID: {Key: key, Algorithm: cfg.GetSigningAlgorithm()},
+		}, policyBundleKeyID, cfg.Scope, nil)).
+		Read()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid policy bundle: %w", err)
+	}
+	// the reader only verifies signatures when there are any
+	if len(b.Signatures.Signatures) == 0 {
+		return nil, "", errors.New("invalid policy bundle: bundle is not signed")
+	}
+
+	return &b, res.Header.Get("ETag"), nil
+}
+
+// NewPolicyBundleEvaluator creates a PolicyEvaluator for the Rego policies of a bundle. The bundle must
+// define the pomerium.policy package, whose allow and deny rules are merged with those of every route.
+func NewPolicyBundleEvaluator(ctx context.Context, store *Store, b *bundle.Bundle) (*PolicyEvaluator, error) {
+	hasPolicy := false
+	options := []func(*rego.Rego){
+		rego.Store(store),
+		rego.Query("result = data.pomerium.policy"),
+		getGoogleCloudServerlessHeadersRegoOption,
+		store.GetDataBrokerRecordOption(),
+	}
+	var raw []byte
+	for _, m := range b.Modules {
+		if m.Parsed != nil && m.Parsed.Package.Path.String() == "data.pomerium.policy" {
+			hasPolicy = true
+		}
+		options = append(options, rego.Module(m.Path, string(m.Raw)))
+		raw = append(raw, m.Raw...)
+	}
+	if !hasPolicy {
+		return nil, errors.New("invalid policy bundle: no module in the pomerium.policy package")
+	}
+
+	q, err := rego.New(options...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy bundle: %w", err)
+	}
+
+	return &PolicyEvaluator{
+		queries: []policyQuery{{
+			PreparedEvalQuery: q,
+			checksum:          fmt.Sprintf("%x", cryptutil.Hash("policy_bundle", raw)),
+			name:              "policy_bundle",
+			filename:          "policy_bundle",
+		}},
+	}, nil
+}
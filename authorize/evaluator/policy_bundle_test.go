@@ -0,0 +1,162 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/bundle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+const testPolicyBundleRego = `package pomerium.policy
+
+allow {
+	input.http.url == "https://from.example.com/allowed"
+}
+
+deny = [451, "unavailable for legal reasons"] {
+	input.http.url == "https://from.example.com/denied"
+}
+`
+
+func TestPolicyBundle(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	// opa stats the signing key as a file first, which can fail for an inline PEM with a long path component
+	privateKeyFile := filepath.Join(t.TempDir(), "private.pem")
+	require.NoError(t, ioutil.WriteFile(privateKeyFile, privatePEM, 0o600))
+
+	writeBundle := func(t *testing.T, rego string, sign bool) []byte {
+		b := bundle.Bundle{
+			Manifest: bundle.Manifest{Revision: "1"},
+			Data:     map[string]interface{}{},
+			Modules: []bundle.ModuleFile{{
+				URL:  "/pomerium/policy.rego",
+				Path: "/pomerium/policy.rego",
+				Raw:  []byte(rego),
+			}},
+		}
+		if sign {
+			require.NoError(t, b.GenerateSignature(bundle.NewSigningConfig(privateKeyFile, "RS256", ""), "", false))
+		}
+		var buf bytes.Buffer
+		require.NoError(t, bundle.NewWriter(&buf).Write(b))
+		return buf.Bytes()
+	}
+
+	bundles := map[string][]byte{
+		"/signed":   writeBundle(t, testPolicyBundleRego, true),
+		"/unsigned": writeBundle(t, testPolicyBundleRego, false),
+		"/package":  writeBundle(t, "package example\n\nallow = true\n", true),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		bs, ok := bundles[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write(bs)
+	}))
+	defer srv.Close()
+
+	cfg := func(path string) *config.PolicyBundle {
+		return &config.PolicyBundle{
+			URL:             srv.URL + path,
+			VerificationKey: base64.StdEncoding.EncodeToString(publicPEM),
+		}
+	}
+
+	t.Run("fetch", func(t *testing.T) {
+		b, etag, err := FetchPolicyBundle(context.Background(), cfg("/signed"), "")
+		require.NoError(t, err)
+		assert.Equal(t, `"v1"`, etag)
+		assert.Equal(t, "1", b.Manifest.Revision)
+		assert.Len(t, b.Modules, 1)
+	})
+	t.Run("not modified", func(t *testing.T) {
+		b, etag, err := FetchPolicyBundle(context.Background(), cfg("/signed"), `"v1"`)
+		require.NoError(t, err)
+		assert.Nil(t, b)
+		assert.Equal(t, `"v1"`, etag)
+	})
+	t.Run("unsigned", func(t *testing.T) {
+		_, _, err := FetchPolicyBundle(context.Background(), cfg("/unsigned"), "")
+		assert.Error(t, err)
+	})
+	t.Run("wrong key", func(t *testing.T) {
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		otherDER, err := x509.MarshalPKIXPublicKey(&otherKey.PublicKey)
+		require.NoError(t, err)
+		c := cfg("/signed")
+		c.VerificationKey = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: otherDER}))
+		_, _, err = FetchPolicyBundle(context.Background(), c, "")
+		assert.Error(t, err)
+	})
+	t.Run("missing package", func(t *testing.T) {
+		b, _, err := FetchPolicyBundle(context.Background(), cfg("/package"), "")
+		require.NoError(t, err)
+		_, err = NewPolicyBundleEvaluator(context.Background(), NewStore(), b)
+		assert.Error(t, err)
+	})
+	t.Run("evaluate", func(t *testing.T) {
+		b, _, err := FetchPolicyBundle(context.Background(), cfg("/signed"), "")
+		require.NoError(t, err)
+
+		store := NewStoreFromProtos(math.MaxUint64)
+		policy := &config.Policy{
+			From:         "https://from.example.com",
+			To:           config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+			AllowedUsers: []string{"a@example.com"},
+		}
+		e, err := New(context.Background(), store, nil,
+			WithAuthenticateURL("https://authn.example.com"),
+			WithPolicies([]config.Policy{*policy}))
+		require.NoError(t, err)
+
+		eval := func(url string) *Result {
+			res, err := e.Evaluate(context.Background(), &Request{
+				Policy: policy,
+				HTTP:   RequestHTTP{Method: http.MethodGet, URL: url},
+			})
+			require.NoError(t, err)
+			return res
+		}
+
+		assert.False(t, eval("https://from.example.com/allowed").Allow)
+
+		pe, err := NewPolicyBundleEvaluator(context.Background(), store, b)
+		require.NoError(t, err)
+		store.UpdatePolicyBundle(pe)
+
+		assert.True(t, eval("https://from.example.com/allowed").Allow)
+		assert.False(t, eval("https://from.example.com/other").Allow)
+		assert.Equal(t, &Denial{Status: 451, Message: "unavailable for legal reasons"}, eval("https://from.example.com/denied").Deny)
+
+		store.UpdatePolicyBundle(nil)
+		assert.False(t, eval("https://from.example.com/allowed").Allow)
+	})
+}
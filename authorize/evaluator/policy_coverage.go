@@ -0,0 +1,101 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/cover"
+)
+
+// PolicyCoverage tracks which rego expressions of a policy were evaluated. It is intended for policy
+// test runs and is not safe for concurrent use.
+type PolicyCoverage struct {
+	cover *cover.Cover
+}
+
+// NewPolicyCoverage creates a new PolicyCoverage.
+func NewPolicyCoverage() *PolicyCoverage {
+	return &PolicyCoverage{
+		cover: cover.New(),
+	}
+}
+
+// A PolicyCoverageReport reports the rego coverage of a policy.
+type PolicyCoverageReport struct {
+	// Policy is the coverage of the rego generated from the policy's allowed users, groups, domains and claims.
+	Policy float64
+	// SubPolicies is the coverage of the custom rego for each sub policy, keyed by sub policy name.
+	SubPolicies map[string]float64
+}
+
+// Report returns the coverage of the policy evaluator's rego scripts.
+func (c *PolicyCoverage) Report(e *PolicyEvaluator) (*PolicyCoverageReport, error) {
+	modules := map[string]*ast.Module{}
+	for _, q := range e.queries {
+		m, err := ast.ParseModule(q.filename, q.script)
+		if err != nil {
+			return nil, fmt.Errorf("authorize: error parsing policy rego for coverage: %w", err)
+		}
+		modules[q.filename] = m
+	}
+
+	cr := c.cover.Report(modules)
+
+	report := &PolicyCoverageReport{
+		SubPolicies: map[string]float64{},
+	}
+
+	// a sub policy may have more than one script, so combine their coverage by lines
+	covered, notCovered := map[string]int{}, map[string]int{}
+	for _, q := range e.queries {
+		fr, ok := cr.Files[q.filename]
+		if !ok {
+			continue
+		}
+
+		if q.name == "" {
+			report.Policy = fr.Coverage
+			continue
+		}
+
+		covered[q.name] += countRangeLines(fr.Covered)
+		notCovered[q.name] += countRangeLines(fr.NotCovered)
+	}
+	for name := range covered {
+		total := covered[name] + notCovered[name]
+		if total == 0 {
+			report.SubPolicies[name] = 0
+			continue
+		}
+		report.SubPolicies[name] = 100 * float64(covered[name]) / float64(total)
+	}
+
+	return report, nil
+}
+
+// Validate returns an error if the coverage of any sub policy is below the given threshold, which is a
+// percentage between 0 and 100.
+func (r *PolicyCoverageReport) Validate(threshold float64) error {
+	var below []string
+	for name, coverage := range r.SubPolicies {
+		if coverage < threshold {
+			below = append(below, fmt.Sprintf("%s (%.2f%%)", name, coverage))
+		}
+	}
+	if len(below) == 0 {
+		return nil
+	}
+	sort.Strings(below)
+	return fmt.Errorf("authorize: sub policy coverage below threshold of %.2f%%: %s",
+		threshold, strings.Join(below, ", "))
+}
+
+func countRangeLines(rs []cover.Range) int {
+	n := 0
+	for _, r := range rs {
+		n += r.End.Row - r.Start.Row + 1
+	}
+	return n
+}
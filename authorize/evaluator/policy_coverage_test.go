@@ -0,0 +1,67 @@
+package evaluator
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+func TestPolicyCoverage(t *testing.T) {
+	ctx := context.Background()
+	store := NewStoreFromProtos(math.MaxUint64)
+	e, err := NewPolicyEvaluator(ctx, store, &config.Policy{
+		From: "https://from.example.com",
+		To:   config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		SubPolicies: []config.SubPolicy{{
+			Name: "get",
+			Rego: []string{`
+package pomerium.policy
+
+allow {
+	input.http.method == "GET"
+}
+`},
+		}, {
+			Name: "admin",
+			Rego: []string{`
+allow {
+	input.http.method == "POST"
+	input.http.url == "https://from.example.com/admin"
+}
+`},
+		}},
+	})
+	require.NoError(t, err)
+
+	coverage := NewPolicyCoverage()
+	res, err := e.EvaluateWithCoverage(ctx, &PolicyRequest{
+		HTTP: RequestHTTP{Method: "GET", URL: "https://from.example.com/"},
+	}, coverage)
+	require.NoError(t, err)
+	assert.True(t, res.Allow)
+
+	report, err := coverage.Report(e)
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, report.SubPolicies["get"])
+	assert.Less(t, report.SubPolicies["admin"], 100.0)
+	assert.Greater(t, report.Policy, 0.0)
+
+	assert.NoError(t, report.Validate(0))
+	assert.EqualError(t, report.Validate(80),
+		"authorize: sub policy coverage below threshold of 80.00%: admin (0.00%)")
+
+	res, err = e.EvaluateWithCoverage(ctx, &PolicyRequest{
+		HTTP: RequestHTTP{Method: "POST", URL: "https://from.example.com/admin"},
+	}, coverage)
+	require.NoError(t, err)
+	assert.True(t, res.Allow)
+
+	report, err = coverage.Report(e)
+	require.NoError(t, err)
+	assert.NoError(t, report.Validate(100))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -11,6 +12,7 @@ import (
 	octrace "go.opencensus.io/trace"
 
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
@@ -19,9 +21,13 @@ import (
 
 // PolicyRequest is the input to policy evaluation.
 type PolicyRequest struct {
-	HTTP                     RequestHTTP    `json:"http"`
-	Session                  RequestSession `json:"session"`
-	IsValidClientCertificate bool           `json:"is_valid_client_certificate"`
+	HTTP                     RequestHTTP               `json:"http"`
+	Session                  RequestSession            `json:"session"`
+	IsValidClientCertificate bool                      `json:"is_valid_client_certificate"`
+	ClientCertificate        ClientCertificateInfo     `json:"client_certificate"`
+	ClientCredentials        *RequestClientCredentials `json:"client_credentials,omitempty"`
+	APIKey                   *RequestAPIKey            `json:"api_key,omitempty"`
+	Device                   *RequestDevice            `json:"device,omitempty"`
 }
 
 // PolicyResponse is the result of evaluating a policy.
@@ -45,23 +51,52 @@ func (res *PolicyResponse) Merge(other *PolicyResponse) *PolicyResponse {
 
 // A Denial indicates the request should be denied (even if otherwise allowed).
 type Denial struct {
-	Status  int
-	Message string
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	// Code identifies the kind of denial. Denials by the policy use the code of their status.
+	Code httputil.ErrorCode `json:"code,omitempty"`
+}
+
+// GetCode returns the code of the denial, which defaults to the code of its status.
+func (d *Denial) GetCode() httputil.ErrorCode {
+	if d.Code == "" {
+		return httputil.ErrorCodeForStatus(d.Status)
+	}
+	return d.Code
 }
 
 type policyQuery struct {
 	rego.PreparedEvalQuery
 	checksum string
+	name     string
+	filename string
+	script   string
+}
+
+type policyScript struct {
+	name     string
+	filename string
+	script   string
 }
 
 // A PolicyEvaluator evaluates policies.
 type PolicyEvaluator struct {
 	queries []policyQuery
+	// allowedClientCertIssuers are the compiled allowed_client_cert_issuers patterns
+	allowedClientCertIssuers []*regexp.Regexp
+	// policyChecksum is the checksum of the policy the queries were prepared for
+	policyChecksum uint64
 }
 
 // NewPolicyEvaluator creates a new PolicyEvaluator.
 func NewPolicyEvaluator(ctx context.Context, store *Store, configPolicy *config.Policy) (*PolicyEvaluator, error) {
-	e := new(PolicyEvaluator)
+	e := &PolicyEvaluator{policyChecksum: configPolicy.Checksum()}
+
+	var err error
+	e.allowedClientCertIssuers, err = configPolicy.AllowedClientCertIssuerRegexps()
+	if err != nil {
+		return nil, err
+	}
 
 	// generate the base rego script for the policy
 	ppl := configPolicy.ToPPL()
@@ -70,30 +105,42 @@ func NewPolicyEvaluator(ctx context.Context, store *Store, configPolicy *config.
 		return nil, err
 	}
 
-	scripts := []string{base}
+	scripts := []policyScript{{name: "", filename: "pomerium.policy", script: base}}
 
 	// add any custom rego
-	for _, sp := range configPolicy.SubPolicies {
-		for _, src := range sp.Rego {
+	for i, sp := range configPolicy.SubPolicies {
+		name := sp.Name
+		if name == "" {
+			name = sp.ID
+		}
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		for j, src := range sp.Rego {
 			if src == "" {
 				continue
 			}
 
-			scripts = append(scripts, src)
+			scripts = append(scripts, policyScript{
+				name:     name,
+				filename: fmt.Sprintf("pomerium.policy.%d.%d", i, j),
+				script:   src,
+			})
 		}
 	}
 
 	// for each script, create a rego and prepare a query.
-	for _, script := range scripts {
+	for _, ps := range scripts {
 		log.Debug(ctx).
-			Str("script", script).
+			Str("script", ps.script).
 			Str("from", configPolicy.From).
 			Interface("to", configPolicy.To).
 			Msg("authorize: rego script for policy evaluation")
 
+		script := ps.script
 		r := rego.New(
 			rego.Store(store),
-			rego.Module("pomerium.policy", script),
+			rego.Module(ps.filename, script),
 			rego.Query("result = data.pomerium.policy"),
 			getGoogleCloudServerlessHeadersRegoOption,
 			store.GetDataBrokerRecordOption(),
@@ -102,9 +149,10 @@ func NewPolicyEvaluator(ctx context.Context, store *Store, configPolicy *config.
 		q, err := r.PrepareForEval(ctx)
 		// if no package is in the src, add it
 		if err != nil && strings.Contains(err.Error(), "package expected") {
+			script = "package pomerium.policy\n\n" + script
 			r := rego.New(
 				rego.Store(store),
-				rego.Module("pomerium.policy", "package pomerium.policy\n\n"+script),
+				rego.Module(ps.filename, script),
 				rego.Query("result = data.pomerium.policy"),
 				getGoogleCloudServerlessHeadersRegoOption,
 				store.GetDataBrokerRecordOption(),
@@ -117,7 +165,10 @@ func NewPolicyEvaluator(ctx context.Context, store *Store, configPolicy *config.
 
 		e.queries = append(e.queries, policyQuery{
 			PreparedEvalQuery: q,
-			checksum:          fmt.Sprintf("%x", cryptutil.Hash("script", []byte(script))),
+			checksum:          fmt.Sprintf("%x", cryptutil.Hash("script", []byte(ps.script))),
+			name:              ps.name,
+			filename:          ps.filename,
+			script:            script,
 		})
 	}
 
@@ -126,10 +177,19 @@ func NewPolicyEvaluator(ctx context.Context, store *Store, configPolicy *config.
 
 // Evaluate evaluates the policy rego scripts.
 func (e *PolicyEvaluator) Evaluate(ctx context.Context, req *PolicyRequest) (*PolicyResponse, error) {
+	return e.evaluate(ctx, req)
+}
+
+// EvaluateWithCoverage evaluates the policy rego scripts and records the evaluated rego in the coverage.
+func (e *PolicyEvaluator) EvaluateWithCoverage(ctx context.Context, req *PolicyRequest, coverage *PolicyCoverage) (*PolicyResponse, error) {
+	return e.evaluate(ctx, req, rego.EvalQueryTracer(coverage.cover))
+}
+
+func (e *PolicyEvaluator) evaluate(ctx context.Context, req *PolicyRequest, options ...rego.EvalOption) (*PolicyResponse, error) {
 	res := new(PolicyResponse)
 	// run each query and merge the results
 	for _, query := range e.queries {
-		o, err := e.evaluateQuery(ctx, req, query)
+		o, err := e.evaluateQuery(ctx, req, query, options...)
 		if err != nil {
 			return nil, err
 		}
@@ -138,12 +198,12 @@ func (e *PolicyEvaluator) Evaluate(ctx context.Context, req *PolicyRequest) (*Po
 	return res, nil
 }
 
-func (e *PolicyEvaluator) evaluateQuery(ctx context.Context, req *PolicyRequest, query policyQuery) (*PolicyResponse, error) {
+func (e *PolicyEvaluator) evaluateQuery(ctx context.Context, req *PolicyRequest, query policyQuery, options ...rego.EvalOption) (*PolicyResponse, error) {
 	_, span := trace.StartSpan(ctx, "authorize.PolicyEvaluator.evaluateQuery")
 	defer span.End()
 	span.AddAttributes(octrace.StringAttribute("script_checksum", query.checksum))
 
-	rs, err := safeEval(ctx, query.PreparedEvalQuery, rego.EvalInput(req))
+	rs, err := safeEval(ctx, query.PreparedEvalQuery, append([]rego.EvalOption{rego.EvalInput(req)}, options...)...)
 	if err != nil {
 		return nil, fmt.Errorf("authorize: error evaluating policy.rego: %w", err)
 	}
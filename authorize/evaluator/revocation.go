@@ -0,0 +1,282 @@
+package evaluator
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+const (
+	// revocationDefaultTTL is how long revocation information is cached if it does not specify a next update
+	revocationDefaultTTL = time.Hour
+	// revocationStaleTTL is how long revocation information is cached if its next update is in the past
+	revocationStaleTTL = time.Minute
+	// revocationMaxResponseSize is the maximum size of a CRL or OCSP response
+	revocationMaxResponseSize = 10 << 20
+	revocationRequestTimeout  = 10 * time.Second
+)
+
+var (
+	crlCache       = newCRLCache()
+	ocspCache, _   = lru.New2Q(1000)
+	ocspFetches    singleflight.Group
+	revocationHTTP = &http.Client{Timeout: revocationRequestTimeout}
+)
+
+// A revocationChecker checks client certificates against certificate revocation lists and OCSP responders.
+type revocationChecker struct {
+	crls     []*pkix.CertificateList
+	crlURL   string
+	ocsp     bool
+	softFail bool
+}
+
+func newRevocationChecker(cfg *evaluatorConfig) (*revocationChecker, error) {
+	rc := &revocationChecker{
+		crlURL:   cfg.clientCRLURL,
+		ocsp:     cfg.clientOCSP,
+		softFail: cfg.clientRevocationSoftFail,
+	}
+	if len(cfg.clientCRL) > 0 {
+		crl, err := cryptutil.DecodeCRL(cfg.clientCRL)
+		if err != nil {
+			return nil, err
+		}
+		rc.crls = append(rc.crls, crl)
+	}
+	if len(rc.crls) == 0 && rc.crlURL == "" && !rc.ocsp {
+		return nil, nil
+	}
+	return rc, nil
+}
+
+// isRevoked returns true if cert, issued by issuer, has been revoked. If the revocation status can't be
+// determined the certificate is treated as revoked, unless soft fail is enabled.
+func (rc *revocationChecker) isRevoked(ctx context.Context, cert, issuer *x509.Certificate) bool {
+	// the client_crl setting may contain the CRLs of several CAs, so the CRLs of other issuers are skipped
+	for _, crl := range rc.crls {
+		if revoked, err := isRevokedByCRL(crl, cert, issuer); err == nil && revoked {
+			return true
+		}
+	}
+
+	if rc.crlURL != "" {
+		crl, err := crlCache.get(rc.crlURL)
+		if err != nil {
+			log.Warn(ctx).Err(err).Str("url", rc.crlURL).Msg("authorize: error fetching client certificate CRL")
+			if !rc.softFail {
+				return true
+			}
+		} else if revoked, err := isRevokedByCRL(crl, cert, issuer); err != nil {
+			log.Warn(ctx).Err(err).Str("url", rc.crlURL).Msg("authorize: invalid client certificate CRL")
+			if !rc.softFail {
+				return true
+			}
+		} else if revoked {
+			return true
+		}
+	}
+
+	if rc.ocsp && len(cert.OCSPServer) > 0 {
+		status, err := getOCSPStatus(cert, issuer)
+		if err != nil {
+			log.Warn(ctx).Err(err).Str("url", cert.OCSPServer[0]).Msg("authorize: error checking client certificate OCSP status")
+			if !rc.softFail {
+				return true
+			}
+		} else if status == ocsp.Revoked || (status == ocsp.Unknown && !rc.softFail) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isRevokedByCRL returns true if cert is in the crl. It returns an error if the crl wasn't signed by the issuer
+// of cert, as it can't say whether cert was revoked.
+func isRevokedByCRL(crl *pkix.CertificateList, cert, issuer *x509.Certificate) (bool, error) {
+	if err := issuer.CheckCRLSignature(crl); err != nil {
+		return false, fmt.Errorf("CRL not signed by the certificate issuer: %w", err)
+	}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type crlCacheEntry struct {
+	crl    *pkix.CertificateList
+	err    error
+	expiry time.Time
+}
+
+type crlCacheMap struct {
+	mu      sync.Mutex
+	entries map[string]crlCacheEntry
+	fetches singleflight.Group
+}
+
+func newCRLCache() *crlCacheMap {
+	return &crlCacheMap{entries: make(map[string]crlCacheEntry)}
+}
+
+// get returns the CRL at rawURL, fetching it if it isn't cached or the cached CRL has expired. If fetching
+// fails the previously fetched CRL is used until the next attempt. CRLs are fetched outside of the lock, so
+// that a slow CRL server doesn't block the checks against other CRLs, and concurrent checks share a fetch.
+func (c *crlCacheMap) get(rawURL string) (*pkix.CertificateList, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[rawURL]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expiry) {
+		return entry.crl, entry.err
+	}
+
+	v, _, _ := c.fetches.Do(rawURL, func() (interface{}, error) {
+		// the fetch is shared, so it isn't bound to the context of the check which started it
+		ctx, cancel := context.WithTimeout(context.Background(), revocationRequestTimeout)
+		defer cancel()
+		crl, err := fetchCRL(ctx, rawURL)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		now := time.Now()
+		entry := c.entries[rawURL]
+		if err != nil {
+			if entry.crl == nil {
+				entry.err = err
+			}
+			entry.expiry = now.Add(revocationStaleTTL)
+		} else {
+			entry = crlCacheEntry{
+				crl:    crl,
+				expiry: revocationExpiry(now, crl.TBSCertList.NextUpdate),
+			}
+		}
+		c.entries[rawURL] = entry
+		return entry, nil
+	})
+	entry = v.(crlCacheEntry)
+	return entry.crl, entry.err
+}
+
+func fetchCRL(ctx context.Context, rawURL string) (*pkix.CertificateList, error) {
+	bs, err := revocationGet(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(bs, []byte("-----BEGIN")) {
+		return cryptutil.DecodeCRL(bs)
+	}
+	return x509.ParseDERCRL(bs)
+}
+
+type ocspCacheEntry struct {
+	status int
+	expiry time.Time
+}
+
+// getOCSPStatus returns the OCSP status of cert from the first OCSP server listed in the certificate. Concurrent
+// checks of the same certificate share a request.
+func getOCSPStatus(cert, issuer *x509.Certificate) (int, error) {
+	cacheKey := ocspCacheKey{issuer: string(issuer.Raw), serial: cert.SerialNumber.String()}
+	if value, ok := ocspCache.Get(cacheKey); ok {
+		entry := value.(ocspCacheEntry)
+		if time.Now().Before(entry.expiry) {
+			return entry.status, nil
+		}
+	}
+
+	v, err, _ := ocspFetches.Do(cacheKey.issuer+"\n"+cacheKey.serial, func() (interface{}, error) {
+		// the request is shared, so it isn't bound to the context of the check which started it
+		ctx, cancel := context.WithTimeout(context.Background(), revocationRequestTimeout)
+		defer cancel()
+		return fetchOCSPStatus(ctx, cacheKey, cert, issuer)
+	})
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+	return v.(int), nil
+}
+
+func fetchOCSPStatus(ctx context.Context, cacheKey ocspCacheKey, cert, issuer *x509.Certificate) (int, error) {
+	now := time.Now()
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, cert.OCSPServer[0], bytes.NewReader(req))
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+	hreq.Header.Set("Content-Type", "application/ocsp-request")
+	hreq.Header.Set("Accept", "application/ocsp-response")
+	bs, err := revocationDo(hreq)
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+	res, err := ocsp.ParseResponseForCert(bs, cert, issuer)
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+
+	ocspCache.Add(cacheKey, ocspCacheEntry{
+		status: res.Status,
+		expiry: revocationExpiry(now, res.NextUpdate),
+	})
+	return res.Status, nil
+}
+
+type ocspCacheKey struct {
+	issuer string
+	serial string
+}
+
+func revocationGet(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return revocationDo(req)
+}
+
+func revocationDo(req *http.Request) ([]byte, error) {
+	res, err := revocationHTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return ioutil.ReadAll(io.LimitReader(res.Body, revocationMaxResponseSize))
+}
+
+func revocationExpiry(now, nextUpdate time.Time) time.Time {
+	switch {
+	case nextUpdate.IsZero():
+		return now.Add(revocationDefaultTTL)
+	case nextUpdate.Before(now):
+		// stale, so try again soon
+		return now.Add(revocationStaleTTL)
+	default:
+		return nextUpdate
+	}
+}
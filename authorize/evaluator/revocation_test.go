@@ -0,0 +1,269 @@
+package evaluator
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCertificateAuthority struct {
+	cert   *x509.Certificate
+	key    crypto.Signer
+	serial int64
+}
+
+func newTestCertificateAuthority(t *testing.T) *testCertificateAuthority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificateAuthority{cert: cert, key: key, serial: 1}
+}
+
+func (ca *testCertificateAuthority) issue(t *testing.T, ocspServer string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca.serial++
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if ocspServer != "" {
+		tpl.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func (ca *testCertificateAuthority) crl(t *testing.T, revoked ...*x509.Certificate) []byte {
+	t.Helper()
+	var revokedCerts []pkix.RevokedCertificate
+	for _, cert := range revoked {
+		revokedCerts = append(revokedCerts, pkix.RevokedCertificate{
+			SerialNumber:   cert.SerialNumber,
+			RevocationTime: time.Now(),
+		})
+	}
+	der, err := ca.cert.CreateCRL(rand.Reader, ca.key, revokedCerts, time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func TestRevocationChecker(t *testing.T) {
+	ctx := context.Background()
+	ca := newTestCertificateAuthority(t)
+
+	t.Run("crl", func(t *testing.T) {
+		revoked, good := ca.issue(t, ""), ca.issue(t, "")
+		rc, err := newRevocationChecker(&evaluatorConfig{clientCRL: ca.crl(t, revoked)})
+		require.NoError(t, err)
+		assert.True(t, rc.isRevoked(ctx, revoked, ca.cert))
+		assert.False(t, rc.isRevoked(ctx, good, ca.cert))
+
+		other := newTestCertificateAuthority(t)
+		assert.False(t, rc.isRevoked(ctx, other.issue(t, ""), other.cert),
+			"should ignore CRLs from other issuers")
+	})
+	t.Run("crl url", func(t *testing.T) {
+		revoked, good := ca.issue(t, ""), ca.issue(t, "")
+		crl := ca.crl(t, revoked)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(crl)
+		}))
+		defer srv.Close()
+
+		rc, err := newRevocationChecker(&evaluatorConfig{clientCRLURL: srv.URL})
+		require.NoError(t, err)
+		assert.True(t, rc.isRevoked(ctx, revoked, ca.cert))
+		assert.False(t, rc.isRevoked(ctx, good, ca.cert))
+	})
+	t.Run("crl url from other issuer", func(t *testing.T) {
+		crl := newTestCertificateAuthority(t).crl(t)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(crl)
+		}))
+		defer srv.Close()
+
+		cert := ca.issue(t, "")
+		rc, err := newRevocationChecker(&evaluatorConfig{clientCRLURL: srv.URL})
+		require.NoError(t, err)
+		assert.True(t, rc.isRevoked(ctx, cert, ca.cert), "should hard fail")
+
+		rc, err = newRevocationChecker(&evaluatorConfig{clientCRLURL: srv.URL, clientRevocationSoftFail: true})
+		require.NoError(t, err)
+		assert.False(t, rc.isRevoked(ctx, cert, ca.cert), "should soft fail")
+	})
+	t.Run("crl url concurrent", func(t *testing.T) {
+		crl := ca.crl(t)
+		var fetches int32
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			<-release
+			_, _ = w.Write(crl)
+		}))
+		defer slow.Close()
+		fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(crl)
+		}))
+		defer fast.Close()
+
+		cache := newCRLCache()
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := cache.get(slow.URL)
+				assert.NoError(t, err)
+			}()
+		}
+
+		// a slow CRL server shouldn't block fetching other CRLs
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&fetches) > 0 }, time.Second, time.Millisecond)
+		_, err := cache.get(fast.URL)
+		assert.NoError(t, err)
+
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&fetches), "should share a single fetch")
+	})
+	t.Run("crl url unavailable", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		cert := ca.issue(t, "")
+		rc, err := newRevocationChecker(&evaluatorConfig{clientCRLURL: srv.URL})
+		require.NoError(t, err)
+		assert.True(t, rc.isRevoked(ctx, cert, ca.cert), "should hard fail")
+
+		rc, err = newRevocationChecker(&evaluatorConfig{clientCRLURL: srv.URL, clientRevocationSoftFail: true})
+		require.NoError(t, err)
+		assert.False(t, rc.isRevoked(ctx, cert, ca.cert), "should soft fail")
+	})
+	t.Run("ocsp", func(t *testing.T) {
+		revokedSerials := map[string]bool{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			req, err := ocsp.ParseRequest(body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			status := ocsp.Good
+			if revokedSerials[req.SerialNumber.String()] {
+				status = ocsp.Revoked
+			}
+			res, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+				Status:       status,
+				SerialNumber: req.SerialNumber,
+				ThisUpdate:   time.Now(),
+				NextUpdate:   time.Now().Add(time.Hour),
+				RevokedAt:    time.Now(),
+			}, ca.key)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write(res)
+		}))
+		defer srv.Close()
+
+		revoked, good := ca.issue(t, srv.URL), ca.issue(t, srv.URL)
+		revokedSerials[revoked.SerialNumber.String()] = true
+
+		rc, err := newRevocationChecker(&evaluatorConfig{clientOCSP: true})
+		require.NoError(t, err)
+		assert.True(t, rc.isRevoked(ctx, revoked, ca.cert))
+		assert.False(t, rc.isRevoked(ctx, good, ca.cert))
+	})
+	t.Run("ocsp concurrent", func(t *testing.T) {
+		var requests int32
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			<-release
+			body, _ := ioutil.ReadAll(r.Body)
+			req, err := ocsp.ParseRequest(body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			res, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+				Status:       ocsp.Good,
+				SerialNumber: req.SerialNumber,
+				ThisUpdate:   time.Now(),
+				NextUpdate:   time.Now().Add(time.Hour),
+			}, ca.key)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write(res)
+		}))
+		defer srv.Close()
+
+		cert := ca.issue(t, srv.URL)
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				status, err := getOCSPStatus(cert, ca.cert)
+				assert.NoError(t, err)
+				assert.Equal(t, ocsp.Good, status)
+			}()
+		}
+
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&requests) > 0 }, time.Second, time.Millisecond)
+		// give the other checks time to join the request
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "should share a single request")
+	})
+	t.Run("disabled", func(t *testing.T) {
+		rc, err := newRevocationChecker(&evaluatorConfig{})
+		assert.NoError(t, err)
+		assert.Nil(t, rc)
+	})
+}
@@ -0,0 +1,54 @@
+package evaluator
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/sharedurl"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestEvaluator_SharedURL(t *testing.T) {
+	sharedKey := cryptutil.NewKey()
+	policies := []config.Policy{{
+		From:         "https://files.example.com",
+		To:           config.WeightedURLs{{URL: *mustParseURL("https://to.example.com")}},
+		AllowedUsers: []string{"user@example.com"},
+	}}
+	e, err := New(context.Background(), NewStoreFromProtos(math.MaxUint64), nil,
+		WithAuthenticateURL("https://authn.example.com"),
+		WithPolicies(policies),
+		WithSharedKey(sharedKey))
+	require.NoError(t, err)
+
+	eval := func(t *testing.T, method, rawURL string) *Result {
+		res, err := e.Evaluate(context.Background(), &Request{
+			Policy: &policies[0],
+			HTTP:   RequestHTTP{Method: method, URL: rawURL},
+		})
+		require.NoError(t, err)
+		return res
+	}
+
+	signed := sharedurl.Sign(sharedKey, mustParseURL("https://files.example.com/report.pdf"), time.Now().Add(time.Hour))
+	expired := sharedurl.Sign(sharedKey, mustParseURL("https://files.example.com/report.pdf"), time.Now().Add(-time.Hour))
+
+	assert.True(t, eval(t, http.MethodGet, signed.String()).Allow)
+	assert.False(t, eval(t, http.MethodPost, signed.String()).Allow)
+	assert.False(t, eval(t, http.MethodGet, expired.String()).Allow)
+	assert.False(t, eval(t, http.MethodGet, "https://files.example.com/report.pdf").Allow)
+
+	other := *signed
+	other.Path = "/other.pdf"
+	assert.False(t, eval(t, http.MethodGet, other.String()).Allow)
+
+	assert.True(t, IsSharedURLRequest(&Request{HTTP: RequestHTTP{URL: expired.String()}}))
+	assert.False(t, IsSharedURLRequest(&Request{HTTP: RequestHTTP{URL: "https://files.example.com/report.pdf"}}))
+}
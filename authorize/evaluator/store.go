@@ -88,6 +88,10 @@ type Store struct {
 	dataBrokerData *dataBrokerData
 
 	dataBrokerServerVersion, dataBrokerRecordVersion uint64
+
+	signingKey      atomic.Value
+	claimTransforms atomic.Value
+	policyBundle    atomic.Value
 }
 
 // NewStore creates a new Store.
@@ -151,10 +155,18 @@ func (s *Store) UpdateGoogleCloudServerlessAuthenticationServiceAccount(serviceA
 }
 
 // UpdateJWTClaimHeaders updates the jwt claim headers in the store.
-func (s *Store) UpdateJWTClaimHeaders(jwtClaimHeaders map[string]string) {
+func (s *Store) UpdateJWTClaimHeaders(jwtClaimHeaders config.JWTClaimHeaders) {
+	if jwtClaimHeaders == nil {
+		jwtClaimHeaders = config.JWTClaimHeaders{}
+	}
 	s.write("/jwt_claim_headers", jwtClaimHeaders)
 }
 
+// UpdateGroupsClaim updates the ID token claim which contains the user's groups in the store.
+func (s *Store) UpdateGroupsClaim(groupsClaim string) {
+	s.write("/groups_claim", groupsClaim)
+}
+
 // UpdateRoutePolicies updates the route policies in the store.
 func (s *Store) UpdateRoutePolicies(routePolicies []config.Policy) {
 	s.write("/route_policies", routePolicies)
@@ -174,10 +186,39 @@ func (s *Store) UpdateRecord(serverVersion uint64, record *databroker.Record) {
 	atomic.StoreUint64(&s.dataBrokerRecordVersion, record.GetVersion())
 }
 
-// UpdateSigningKey updates the signing key stored in the database. Signing operations
-// in rego use JWKs, so we take in that format.
+// UpdateSigningKey updates the signing key used to sign the JWT assertion. The JWT is signed outside of
+// rego, since rego doesn't support every signing algorithm (e.g. EdDSA).
 func (s *Store) UpdateSigningKey(signingKey *jose.JSONWebKey) {
-	s.write("/signing_key", signingKey)
+	s.signingKey.Store(signingKey)
+}
+
+// GetSigningKey returns the signing key used to sign the JWT assertion.
+func (s *Store) GetSigningKey() *jose.JSONWebKey {
+	signingKey, _ := s.signingKey.Load().(*jose.JSONWebKey)
+	return signingKey
+}
+
+// UpdateClaimTransforms updates the claim transforms applied to the JWT assertion.
+func (s *Store) UpdateClaimTransforms(claimTransforms config.ClaimTransforms) {
+	s.claimTransforms.Store(claimTransforms)
+}
+
+// GetClaimTransforms returns the claim transforms applied to the JWT assertion.
+func (s *Store) GetClaimTransforms() config.ClaimTransforms {
+	claimTransforms, _ := s.claimTransforms.Load().(config.ClaimTransforms)
+	return claimTransforms
+}
+
+// UpdatePolicyBundle updates the evaluator for the active policy bundle. A nil evaluator deactivates the
+// policy bundle.
+func (s *Store) UpdatePolicyBundle(policyBundle *PolicyEvaluator) {
+	s.policyBundle.Store(policyBundle)
+}
+
+// GetPolicyBundle returns the evaluator for the active policy bundle, if any.
+func (s *Store) GetPolicyBundle() *PolicyEvaluator {
+	policyBundle, _ := s.policyBundle.Load().(*PolicyEvaluator)
+	return policyBundle
 }
 
 func (s *Store) write(rawPath string, value interface{}) {
@@ -215,6 +256,28 @@ func (s *Store) writeTxn(txn storage.Transaction, rawPath string, value interfac
 	return s.Write(context.Background(), txn, op, p, value)
 }
 
+type contextRecordsKey struct{}
+
+// WithRecordData returns a new context with a record's data, which is used instead of the store's data when
+// evaluating with the context. This is used for records which aren't synced to the store.
+func WithRecordData(ctx context.Context, typeURL, id string, msg proto.Message) context.Context {
+	current, _ := ctx.Value(contextRecordsKey{}).(map[[2]string]proto.Message)
+	records := make(map[[2]string]proto.Message, len(current)+1)
+	for k, v := range current {
+		records[k] = v
+	}
+	records[[2]string{typeURL, id}] = msg
+	return context.WithValue(ctx, contextRecordsKey{}, records)
+}
+
+func getContextRecordData(ctx context.Context, typeURL, id string) proto.Message {
+	if ctx == nil {
+		return nil
+	}
+	records, _ := ctx.Value(contextRecordsKey{}).(map[[2]string]proto.Message)
+	return records[[2]string{typeURL, id}]
+}
+
 // GetDataBrokerRecordOption returns a function option that can retrieve databroker data.
 func (s *Store) GetDataBrokerRecordOption() func(*rego.Rego) {
 	return rego.Function2(&rego.Function{
@@ -234,7 +297,10 @@ func (s *Store) GetDataBrokerRecordOption() func(*rego.Rego) {
 			return nil, fmt.Errorf("invalid record id: %T", op2)
 		}
 
-		msg := s.GetRecordData(string(recordType), string(recordID))
+		msg := getContextRecordData(bctx.Context, string(recordType), string(recordID))
+		if msg == nil {
+			msg = s.GetRecordData(string(recordType), string(recordID))
+		}
 		if msg == nil {
 			return ast.NullTerm(), nil
 		}
@@ -0,0 +1,102 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+)
+
+const tenantIsolationDenialMsg = "Tenant mismatch"
+
+// applyTenantIsolation derives the tenant of an allowed request to a route with tenant isolation, and sets it
+// in the tenant id header sent to the upstream. The request is denied if its tenant can't be derived, the
+// subdomain and claim don't match, or the request already carries a different tenant id.
+func applyTenantIsolation(
+	ti *config.TenantIsolation,
+	req *Request,
+	claims map[string]interface{},
+	headers http.Header,
+	output *PolicyResponse,
+) error {
+	if !output.Allow || output.Deny != nil {
+		return nil
+	}
+
+	header := ti.GetHeader()
+	tenant, err := getTenant(ti, req, claims)
+	if err == nil {
+		if requested, ok := req.HTTP.Headers[header]; ok && requested != tenant {
+			err = fmt.Errorf("the %s header %q doesn't match the tenant %q", header, requested, tenant)
+		}
+	}
+	if err != nil {
+		output.Allow = false
+		output.Deny = &Denial{
+			Status:  http.StatusForbidden,
+			Message: tenantIsolationDenialMsg,
+			Code:    httputil.ErrorCodeTenantMismatch,
+		}
+		return err
+	}
+
+	headers.Set(header, tenant)
+	return nil
+}
+
+func getTenant(ti *config.TenantIsolation, req *Request, claims map[string]interface{}) (string, error) {
+	var claimTenants []string
+	if ti.Claim != "" {
+		claimTenants = getClaimStrings(claims[ti.Claim])
+		if len(claimTenants) == 0 {
+			return "", fmt.Errorf("missing %s claim", ti.Claim)
+		}
+	}
+
+	if !ti.Subdomain {
+		// a user who belongs to several tenants can only be isolated by the subdomain
+		if len(claimTenants) > 1 {
+			return "", fmt.Errorf("the %s claim has more than one tenant", ti.Claim)
+		}
+		return claimTenants[0], nil
+	}
+
+	tenant := req.HTTP.Subdomain
+	if tenant == "" {
+		return "", fmt.Errorf("missing subdomain")
+	}
+	if ti.Claim == "" {
+		return tenant, nil
+	}
+	for _, claimTenant := range claimTenants {
+		if claimTenant == tenant {
+			return tenant, nil
+		}
+	}
+	return "", fmt.Errorf("the subdomain %q isn't one of the tenants of the %s claim", tenant, ti.Claim)
+}
+
+// getClaimStrings returns the string values of a claim, which may be a single value or a list.
+func getClaimStrings(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		values = append(values, v)
+	case json.Number:
+		values = append(values, v.String())
+	case []interface{}:
+		for _, elem := range v {
+			values = append(values, getClaimStrings(elem)...)
+		}
+	}
+
+	var nonEmpty []string
+	for _, v := range values {
+		if v != "" {
+			nonEmpty = append(nonEmpty, v)
+		}
+	}
+	return nonEmpty
+}
@@ -0,0 +1,66 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+)
+
+func TestApplyTenantIsolation(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		ti         config.TenantIsolation
+		subdomain  string
+		claims     map[string]interface{}
+		headers    map[string]string
+		wantTenant string
+	}{
+		{"subdomain", config.TenantIsolation{Subdomain: true}, "acme", nil, nil, "acme"},
+		{"missing subdomain", config.TenantIsolation{Subdomain: true}, "", nil, nil, ""},
+		{"claim", config.TenantIsolation{Claim: "tenant"}, "", map[string]interface{}{"tenant": "acme"}, nil, "acme"},
+		{"numeric claim", config.TenantIsolation{Claim: "tenant"}, "", map[string]interface{}{"tenant": json.Number("42")}, nil, "42"},
+		{"missing claim", config.TenantIsolation{Claim: "tenant"}, "", map[string]interface{}{}, nil, ""},
+		{"ambiguous claim", config.TenantIsolation{Claim: "tenant"}, "", map[string]interface{}{"tenant": []interface{}{"acme", "globex"}}, nil, ""},
+		{"subdomain and claim", config.TenantIsolation{Subdomain: true, Claim: "tenant"}, "acme", map[string]interface{}{"tenant": []interface{}{"globex", "acme"}}, nil, "acme"},
+		{"cross tenant", config.TenantIsolation{Subdomain: true, Claim: "tenant"}, "globex", map[string]interface{}{"tenant": "acme"}, nil, ""},
+		{"matching header", config.TenantIsolation{Subdomain: true}, "acme", nil, map[string]string{"X-Tenant-Id": "acme"}, "acme"},
+		{"spoofed header", config.TenantIsolation{Subdomain: true}, "acme", nil, map[string]string{"X-Tenant-Id": "globex"}, ""},
+		{"custom header", config.TenantIsolation{Subdomain: true, Header: "x-org"}, "acme", nil, map[string]string{"X-Org": "globex"}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &Request{HTTP: RequestHTTP{Subdomain: tc.subdomain, Headers: tc.headers}}
+			headers := make(http.Header)
+			output := &PolicyResponse{Allow: true}
+			err := applyTenantIsolation(&tc.ti, req, tc.claims, headers, output)
+			if tc.wantTenant == "" {
+				assert.Error(t, err)
+				assert.False(t, output.Allow)
+				assert.Equal(t, &Denial{
+					Status:  http.StatusForbidden,
+					Message: tenantIsolationDenialMsg,
+					Code:    httputil.ErrorCodeTenantMismatch,
+				}, output.Deny)
+				assert.Empty(t, headers)
+			} else {
+				assert.NoError(t, err)
+				assert.True(t, output.Allow)
+				assert.Nil(t, output.Deny)
+				assert.Equal(t, tc.wantTenant, headers.Get(tc.ti.GetHeader()))
+			}
+		})
+	}
+
+	t.Run("denied", func(t *testing.T) {
+		headers := make(http.Header)
+		output := &PolicyResponse{}
+		err := applyTenantIsolation(&config.TenantIsolation{Subdomain: true}, &Request{}, nil, headers, output)
+		assert.NoError(t, err)
+		assert.Nil(t, output.Deny, "requests which aren't allowed should be left to the policy")
+		assert.Empty(t, headers)
+	})
+}
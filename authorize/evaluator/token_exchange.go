@@ -0,0 +1,182 @@
+package evaluator
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// tokenExchangeDefaultTTL is how long an issued token is cached if the response has no expires_in
+	tokenExchangeDefaultTTL = 5 * time.Minute
+	// tokenExchangeExpiryDelta is how long before its expiry an issued token is exchanged again
+	tokenExchangeExpiryDelta = 30 * time.Second
+	// tokenExchangeMaxResponseSize is the maximum size of a token exchange response
+	tokenExchangeMaxResponseSize = 1 << 20
+	tokenExchangeRequestTimeout  = 10 * time.Second
+)
+
+var (
+	tokenExchangeCache, _     = lru.New(10000)
+	tokenExchangeSingleflight singleflight.Group
+	tokenExchangeHTTP         = &http.Client{Timeout: tokenExchangeRequestTimeout}
+	tokenExchangeNow          = time.Now
+
+	tokenExchangeSubjectTokenTypes = map[string]string{
+		config.TokenExchangeSubjectTokenTypeAccessToken: "urn:ietf:params:oauth:token-type:access_token",
+		config.TokenExchangeSubjectTokenTypeIDToken:     "urn:ietf:params:oauth:token-type:id_token",
+	}
+)
+
+type tokenExchangeToken struct {
+	AccessToken string
+	TokenType   string
+	Expiry      time.Time
+}
+
+// getTokenExchangeHeader returns the header name and value of the token issued in exchange for the subject
+// token.
+func getTokenExchangeHeader(ctx context.Context, te *config.TokenExchange, subjectToken string) (string, string, error) {
+	header := te.GetHeader()
+	if subjectToken == "" {
+		// the header is still set so that a client cannot supply its own value
+		return header, "", nil
+	}
+
+	tok, err := exchangeToken(ctx, te, subjectToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	if header == "Authorization" {
+		tokenType := tok.TokenType
+		if tokenType == "" || strings.EqualFold(tokenType, "bearer") || strings.EqualFold(tokenType, "N_A") {
+			tokenType = "Bearer"
+		}
+		return header, tokenType + " " + tok.AccessToken, nil
+	}
+	return header, tok.AccessToken, nil
+}
+
+// exchangeToken exchanges the subject token for a new token. Issued tokens are cached until shortly before
+// they expire.
+func exchangeToken(ctx context.Context, te *config.TokenExchange, subjectToken string) (*tokenExchangeToken, error) {
+	bs, _ := json.Marshal(te)
+	key := hex.EncodeToString(cryptutil.Hash("token-exchange", append(bs, subjectToken...)))
+
+	if v, ok := tokenExchangeCache.Get(key); ok {
+		tok := v.(*tokenExchangeToken)
+		if tokenExchangeNow().Add(tokenExchangeExpiryDelta).Before(tok.Expiry) {
+			return tok, nil
+		}
+		tokenExchangeCache.Remove(key)
+	}
+
+	// the exchange is shared by concurrent callers, so it isn't canceled with the context of the one which
+	// started it. Callers stop waiting when their own context is canceled.
+	ch := tokenExchangeSingleflight.DoChan(key, func() (interface{}, error) {
+		ctx, clearTimeout := context.WithTimeout(context.Background(), tokenExchangeRequestTimeout)
+		defer clearTimeout()
+
+		tok, err := requestTokenExchange(ctx, te, subjectToken)
+		if err != nil {
+			return nil, err
+		}
+		tokenExchangeCache.Add(key, tok)
+		return tok, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*tokenExchangeToken), nil
+	}
+}
+
+func requestTokenExchange(ctx context.Context, te *config.TokenExchange, subjectToken string) (*tokenExchangeToken, error) {
+	form := url.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"subject_token":      {subjectToken},
+		"subject_token_type": {tokenExchangeSubjectTokenTypes[te.GetSubjectTokenType()]},
+	}
+	if te.RequestedTokenType != "" {
+		form.Set("requested_token_type", te.RequestedTokenType)
+	}
+	if te.Audience != "" {
+		form.Set("audience", te.Audience)
+	}
+	if te.Resource != "" {
+		form.Set("resource", te.Resource)
+	}
+	if len(te.Scopes) > 0 {
+		form.Set("scope", strings.Join(te.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, te.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if te.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(te.ClientID), url.QueryEscape(te.ClientSecret))
+	}
+
+	res, err := tokenExchangeHTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange request failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, tokenExchangeMaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading token exchange response: %w", err)
+	}
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &result)
+
+	if res.StatusCode != http.StatusOK {
+		if result.Error != "" {
+			return nil, fmt.Errorf("token exchange failed: %s: %s", result.Error, result.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token exchange failed with status code %d", res.StatusCode)
+	}
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange response is missing an access_token")
+	}
+
+	ttl := tokenExchangeDefaultTTL
+	if result.ExpiresIn > 0 {
+		ttl = time.Duration(result.ExpiresIn) * time.Second
+	}
+	return &tokenExchangeToken{
+		AccessToken: result.AccessToken,
+		TokenType:   result.TokenType,
+		Expiry:      tokenExchangeNow().Add(ttl),
+	}, nil
+}
@@ -0,0 +1,113 @@
+package evaluator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+func TestGetTokenExchangeHeader(t *testing.T) {
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		_ = r.ParseForm()
+		if r.Form.Get("subject_token") == "INVALID" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"bad token"}`))
+			return
+		}
+
+		clientID, clientSecret, _ := r.BasicAuth()
+		assert.Equal(t, "CLIENT_ID", clientID)
+		assert.Equal(t, "CLIENT_SECRET", clientSecret)
+		assert.Equal(t, tokenExchangeGrantType, r.Form.Get("grant_type"))
+		assert.Equal(t, "urn:ietf:params:oauth:token-type:access_token", r.Form.Get("subject_token_type"))
+		assert.Equal(t, "https://api.example.com", r.Form.Get("audience"))
+		assert.Equal(t, "read write", r.Form.Get("scope"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"EXCHANGED_` + r.Form.Get("subject_token") + `","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	te := &config.TokenExchange{
+		TokenURL:     srv.URL,
+		ClientID:     "CLIENT_ID",
+		ClientSecret: "CLIENT_SECRET",
+		Audience:     "https://api.example.com",
+		Scopes:       []string{"read", "write"},
+	}
+
+	t.Run("exchange", func(t *testing.T) {
+		name, value, err := getTokenExchangeHeader(context.Background(), te, "ACCESS_TOKEN")
+		require.NoError(t, err)
+		assert.Equal(t, "Authorization", name)
+		assert.Equal(t, "Bearer EXCHANGED_ACCESS_TOKEN", value)
+
+		_, _, err = getTokenExchangeHeader(context.Background(), te, "ACCESS_TOKEN")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), atomic.LoadInt64(&requests), "issued tokens should be cached")
+	})
+	t.Run("expired", func(t *testing.T) {
+		defer func() { tokenExchangeNow = time.Now }()
+		tokenExchangeNow = func() time.Time { return time.Now().Add(time.Hour) }
+
+		before := atomic.LoadInt64(&requests)
+		_, _, err := getTokenExchangeHeader(context.Background(), te, "ACCESS_TOKEN")
+		require.NoError(t, err)
+		assert.Equal(t, before+1, atomic.LoadInt64(&requests), "expired tokens should be exchanged again")
+	})
+	t.Run("custom header", func(t *testing.T) {
+		te := *te
+		te.Header = "x-upstream-token"
+		name, value, err := getTokenExchangeHeader(context.Background(), &te, "ACCESS_TOKEN")
+		require.NoError(t, err)
+		assert.Equal(t, "X-Upstream-Token", name)
+		assert.Equal(t, "EXCHANGED_ACCESS_TOKEN", value)
+	})
+	t.Run("no subject token", func(t *testing.T) {
+		name, value, err := getTokenExchangeHeader(context.Background(), te, "")
+		require.NoError(t, err)
+		assert.Equal(t, "Authorization", name)
+		assert.Empty(t, value)
+	})
+	t.Run("error", func(t *testing.T) {
+		_, _, err := getTokenExchangeHeader(context.Background(), te, "INVALID")
+		assert.EqualError(t, err, "token exchange failed: invalid_grant: bad token")
+	})
+}
+
+func TestExchangeToken_canceled(t *testing.T) {
+	var requests int64
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"EXCHANGED","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	te := &config.TokenExchange{TokenURL: srv.URL, ClientID: "CLIENT_ID", ClientSecret: "CLIENT_SECRET"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := exchangeToken(ctx, te, "CANCELED_ACCESS_TOKEN")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the exchange isn't canceled with the first caller's context, so its token is cached for later callers
+	close(release)
+	assert.Eventually(t, func() bool {
+		tok, err := exchangeToken(context.Background(), te, "CANCELED_ACCESS_TOKEN")
+		return err == nil && tok.AccessToken == "EXCHANGED"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&requests))
+}
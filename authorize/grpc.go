@@ -1,52 +1,94 @@
 package authorize
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io/ioutil"
+	"math"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	octrace "go.opencensus.io/trace"
 
 	"github.com/pomerium/pomerium/authorize/evaluator"
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/internal/telemetry/requestid"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
 )
 
 // Check implements the envoy auth server gRPC endpoint.
 func (a *Authorize) Check(ctx context.Context, in *envoy_service_auth_v3.CheckRequest) (out *envoy_service_auth_v3.CheckResponse, err error) {
-	ctx, span := trace.StartSpan(ctx, "authorize.grpc.Check")
+	// convert the incoming envoy-style http request into a go-style http request
+	hreq := getHTTPRequestFromCheckRequest(in)
+
+	// use envoy's request id, so that the authorize logs and the calls made for the check share it with the
+	// access log, the upstream and the response
+	if requestID := requestid.FromHTTPHeader(hreq.Header); requestID != "" {
+		ctx = requestid.WithValue(ctx, requestID)
+	}
+
+	ctx, span := startCheckSpan(ctx, hreq)
 	defer span.End()
+	defer func(start time.Time) {
+		metrics.RecordAuthorizeCheckDuration(ctx, time.Since(start))
+	}(time.Now())
 
 	state := a.state.Load()
 
-	// convert the incoming envoy-style http request into a go-style http request
-	hreq := getHTTPRequestFromCheckRequest(in)
-
 	isForwardAuth := a.isForwardAuth(in)
 	if isForwardAuth {
-		// update the incoming http request's uri to match the forwarded URI
-		fwdAuthURI := getForwardAuthURL(hreq)
-		in.Attributes.Request.Http.Scheme = fwdAuthURI.Scheme
-		in.Attributes.Request.Http.Host = fwdAuthURI.Host
-		in.Attributes.Request.Http.Path = fwdAuthURI.EscapedPath()
-		if fwdAuthURI.RawQuery != "" {
-			in.Attributes.Request.Http.Path += "?" + fwdAuthURI.RawQuery
+		opts := a.currentOptions.Load()
+		peerIP := net.ParseIP(in.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress())
+		// when trusted proxies are configured, forwarded headers from any other peer are ignored
+		if len(opts.ForwardAuthTrustedProxies) == 0 || opts.IsForwardAuthTrustedProxy(peerIP) {
+			// update the incoming http request's uri to match the forwarded URI
+			fwdAuthURI := getForwardAuthURL(hreq, getForwardAuthTrustedHops(hreq, peerIP, opts),
+				len(opts.ForwardAuthTrustedProxies) > 0)
+			in.Attributes.Request.Http.Scheme = fwdAuthURI.Scheme
+			in.Attributes.Request.Http.Host = fwdAuthURI.Host
+			in.Attributes.Request.Http.Path = fwdAuthURI.EscapedPath()
+			if fwdAuthURI.RawQuery != "" {
+				in.Attributes.Request.Http.Path += "?" + fwdAuthURI.RawQuery
+			}
+			if len(opts.ForwardAuthTrustedProxies) > 0 {
+				setCheckRequestSourceIP(in, getForwardAuthClientIP(hreq, peerIP, opts))
+				if method := getForwardAuthMethod(hreq, opts.ForwardAuthMethodHeader); method != "" {
+					in.Attributes.Request.Http.Method = method
+				}
+			}
 		}
 	}
 
-	rawJWT, _ := loadRawSession(hreq, a.currentOptions.Load(), state.encoder)
+	// the session cookie may be customized by the route
+	cookieOptions := a.currentOptions.Load().GetCookieOptions(a.getPolicyIndex().Match(getCheckRequestURL(in)))
+	rawJWT, _ := loadRawSession(hreq, cookieOptions, state.encoder)
 	sessionState, _ := loadSession(state.encoder, rawJWT)
 
-	s, u, err := a.forceSync(ctx, sessionState)
+	ctx, s, u, err := a.forceSync(ctx, sessionState)
 	if err != nil {
 		log.Warn(ctx).Err(err).Msg("clearing session due to force sync failed")
 		sessionState = nil
+	} else if _, ok := s.(*user.ServiceAccount); ok {
+		requestURL := getCheckRequestURL(in)
+		err = validateServiceAccountToken(sessionState, requestURL.Hostname())
+		if err != nil {
+			log.Warn(ctx).Err(err).Msg("clearing session due to invalid service account token")
+			sessionState = nil
+		}
 	}
 
 	req, err := a.getEvaluatorRequestFromCheckRequest(in, sessionState)
@@ -55,59 +97,300 @@ func (a *Authorize) Check(ctx context.Context, in *envoy_service_auth_v3.CheckRe
 		return nil, err
 	}
 
+	routeID := getRouteID(req.Policy)
+
 	// take the state lock here so we don't update while evaluating
 	a.stateLock.RLock()
+	evaluateStart := time.Now()
 	res, err := state.evaluator.Evaluate(ctx, req)
+	metrics.RecordAuthorizeEvaluation(ctx, routeID, time.Since(evaluateStart))
 	a.stateLock.RUnlock()
 	if err != nil {
 		log.Error(ctx).Err(err).Msg("error during OPA evaluation")
 		return nil, err
 	}
+	// the code of the error returned to denied requests
+	var errorCode httputil.ErrorCode
 	defer func() {
-		a.logAuthorizeCheck(ctx, in, out, res, s, u)
+		if out != nil && a.currentOptions.Load().AccessLogAuthorizeDecision {
+			md := getAuthorizeDecisionMetadata(res, s, u, routeID)
+			for k, v := range out.GetDynamicMetadata().GetFields() {
+				md.Fields[k] = v
+			}
+			out.DynamicMetadata = md
+		}
+		a.logAuthorizeCheck(ctx, in, out, res, errorCode, s, u)
+		if a.activity != nil {
+			a.activity.RecordCheck(ctx, in, out, res, routeID, s, u)
+		}
+		if a.decisionHook != nil && a.currentOptions.Load().DecisionHook != nil {
+			a.decisionHook.RecordCheck(ctx, in, out, res, routeID, s, u)
+		}
 	}()
 
 	denyStatusCode := int32(http.StatusForbidden)
 	denyStatusText := http.StatusText(http.StatusForbidden)
+	errorCode = httputil.ErrorCodeForbidden
 	if res.Deny != nil {
 		denyStatusCode = int32(res.Deny.Status)
 		denyStatusText = res.Deny.Message
+		errorCode = res.Deny.GetCode()
 	} else if res.Allow {
-		return a.okResponse(res), nil
+		var lease *concurrencyLease
+		if isForwardAuth {
+			setForwardAuthResponseHeaders(res.Headers, state.forwardAuthResponseHeaders)
+		} else {
+			// forward auth requests aren't proxied by envoy, so it couldn't release their leases
+			var ok bool
+			if lease, ok = a.acquireConcurrencyLease(ctx, req.Policy, s); !ok {
+				metrics.RecordAuthorizeDecision(ctx, routeID, metrics.AuthorizeDecisionDeny, "too many concurrent requests")
+				errorCode = httputil.ErrorCodeTooManyRequests
+				return a.deniedResponse(ctx, in, http.StatusTooManyRequests, errorCode, "Too many concurrent requests", nil)
+			}
+		}
+		errorCode = ""
+		metrics.RecordAuthorizeDecision(ctx, routeID, metrics.AuthorizeDecisionAllow, "allowed")
+		out = a.okResponse(ctx, res)
+		if lease != nil {
+			out.DynamicMetadata = lease.toMetadata()
+		}
+		return out, nil
+	}
+
+	// if we're logged in, or using client credentials or an API key, don't redirect, deny with forbidden
+	if req.Session.ID != "" || res.ClientCredentials != nil || res.APIKey != nil {
+		// deny messages are free text, so the reason is the error code, to keep the label's values bounded
+		reason := "unauthorized"
+		if res.Deny != nil {
+			reason = string(errorCode)
+		}
+		metrics.RecordAuthorizeDecision(ctx, routeID, metrics.AuthorizeDecisionDeny, reason)
+		return a.deniedResponse(ctx, in, denyStatusCode, errorCode, denyStatusText, nil)
 	}
 
+	// the verify endpoint is used by proxies which handle the sign in redirect themselves (nginx's auth_request,
+	// haproxy's auth-request), so a 401 is returned instead of a redirect. A 403 is only returned to users who
+	// are signed in, so that these proxies don't send them to sign in again.
 	if isForwardAuth && hreq.URL.Path == "/verify" {
-		return a.deniedResponse(ctx, in, http.StatusUnauthorized, "Unauthenticated", nil)
+		metrics.RecordAuthorizeDecision(ctx, routeID, metrics.AuthorizeDecisionDeny, "unauthenticated")
+		errorCode = httputil.ErrorCodeUnauthenticated
+		return a.deniedResponse(ctx, in, http.StatusUnauthorized, errorCode, "Unauthenticated", nil)
 	}
 
-	// if we're logged in, don't redirect, deny with forbidden
-	if req.Session.ID != "" {
-		return a.deniedResponse(ctx, in, denyStatusCode, denyStatusText, nil)
+	// services with an invalid client credentials token can't sign in, so they aren't redirected
+	if evaluator.GetClientCredentialsToken(req) != "" {
+		metrics.RecordAuthorizeDecision(ctx, routeID, metrics.AuthorizeDecisionDeny, "invalid client credentials")
+		errorCode = httputil.ErrorCodeInvalidClientCredentials
+		return a.deniedResponse(ctx, in, http.StatusUnauthorized, errorCode, "Unauthenticated", nil)
+	}
+	if evaluator.GetAPIKey(req) != "" {
+		metrics.RecordAuthorizeDecision(ctx, routeID, metrics.AuthorizeDecisionDeny, "invalid api key")
+		errorCode = httputil.ErrorCodeInvalidAPIKey
+		return a.deniedResponse(ctx, in, http.StatusUnauthorized, errorCode, "Unauthenticated", nil)
+	}
+	// shared URLs are for external parties, who can't sign in either
+	if evaluator.IsSharedURLRequest(req) {
+		metrics.RecordAuthorizeDecision(ctx, routeID, metrics.AuthorizeDecisionDeny, "invalid shared url")
+		errorCode = httputil.ErrorCodeInvalidSharedURL
+		return a.deniedResponse(ctx, in, http.StatusForbidden, errorCode, "Invalid or expired link", nil)
 	}
 
+	metrics.RecordAuthorizeDecision(ctx, routeID, metrics.AuthorizeDecisionDeny, "unauthenticated")
+	errorCode = httputil.ErrorCodeUnauthenticated
 	return a.requireLoginResponse(ctx, in)
 }
 
-func getForwardAuthURL(r *http.Request) *url.URL {
-	urqQuery := r.URL.Query().Get("uri")
-	u, _ := urlutil.ParseAndValidateURL(urqQuery)
-	if u == nil {
-		u = &url.URL{
-			Scheme: r.Header.Get(httputil.HeaderForwardedProto),
-			Host:   r.Header.Get(httputil.HeaderForwardedHost),
-			Path:   r.Header.Get(httputil.HeaderForwardedURI),
+// getRouteID returns the route id of a policy as used in metrics, or an empty string if there is no
+// policy.
+func getRouteID(policy *config.Policy) string {
+	if policy == nil {
+		return ""
+	}
+	id, err := policy.RouteID()
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatUint(id, 10)
+}
+
+// startCheckSpan starts the span for an authorize check. If envoy didn't propagate a trace context with
+// the check request, the trace context of the downstream request is used as the parent, so the
+// authorize span joins the client's trace.
+func startCheckSpan(ctx context.Context, hreq *http.Request) (context.Context, *octrace.Span) {
+	if !trace.HasRemoteParent(ctx) {
+		var format trace.HTTPFormat
+		if parent, ok := format.SpanContextFromRequest(hreq); ok {
+			return octrace.StartSpanWithRemoteParent(ctx, "authorize.grpc.Check", parent)
 		}
 	}
+	return trace.StartSpan(ctx, "authorize.grpc.Check")
+}
+
+// getForwardAuthURL returns the url of the request which is verified by forward auth. The uri query parameter
+// takes precedence over the X-Original-Url header, which takes precedence over the forwarded headers. The
+// X-Original-Url header is only used when it was sent by a trusted proxy, as it isn't appended to by proxies,
+// so a client's header can't be told apart from a proxy's.
+func getForwardAuthURL(r *http.Request, trustedHops int, trustOriginalURL bool) *url.URL {
+	if u, _ := urlutil.ParseAndValidateURL(r.URL.Query().Get("uri")); u != nil {
+		return u
+	}
+
+	u := getForwardedURL(r, trustedHops)
 	originalURL := r.Header.Get(httputil.HeaderOriginalURL)
-	if originalURL != "" {
+	if trustOriginalURL && originalURL != "" {
 		k, _ := urlutil.ParseAndValidateURL(originalURL)
 		if k != nil {
 			u = k
+		} else if ref, err := url.ParseRequestURI(originalURL); err == nil && ref.Host == "" {
+			// some proxies only send the path and query of the original request
+			u.Path, u.RawPath, u.RawQuery = ref.Path, ref.RawPath, ref.RawQuery
 		}
 	}
 	return u
 }
 
+// getForwardAuthMethod returns the method of the request which is verified by forward auth, from the header
+// configured for the trusted proxies. The method of a CORS preflight can't be forwarded, so that an OPTIONS
+// method header can't make a request satisfy cors_preflight.
+func getForwardAuthMethod(r *http.Request, headerName string) string {
+	if headerName == "" {
+		return ""
+	}
+	method := strings.ToUpper(strings.TrimSpace(r.Header.Get(headerName)))
+	if method == http.MethodOptions {
+		return ""
+	}
+	return method
+}
+
+// getForwardedURL returns the client-facing url of a request from the Forwarded and X-Forwarded-* headers. Every
+// proxy appends its values to the headers, so the values are taken from the last trustedHops values, which were
+// added by trusted proxies. Of those, the first is used, because it was added by the client-facing proxy.
+func getForwardedURL(r *http.Request, trustedHops int) *url.URL {
+	u := &url.URL{
+		Scheme: getTrustedHeaderValue(r.Header.Get(httputil.HeaderForwardedProto), trustedHops),
+		Host:   getTrustedHeaderValue(r.Header.Get(httputil.HeaderForwardedHost), trustedHops),
+	}
+	if elements := httputil.ParseForwarded(r.Header.Get(httputil.HeaderForwarded)); len(elements) > 0 {
+		element := elements[getTrustedIndex(len(elements), trustedHops)]
+		if element.Proto != "" {
+			u.Scheme = element.Proto
+		}
+		if element.Host != "" {
+			u.Host = element.Host
+		}
+	}
+	if uri := r.Header.Get(httputil.HeaderForwardedURI); uri != "" {
+		if ref, err := url.ParseRequestURI(uri); err == nil {
+			u.Path, u.RawPath, u.RawQuery = ref.Path, ref.RawPath, ref.RawQuery
+		} else {
+			u.Path = uri
+		}
+	}
+	return u
+}
+
+// getTrustedHeaderValue returns the first of the last trustedHops values of a comma-separated header.
+func getTrustedHeaderValue(value string, trustedHops int) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	values := strings.Split(value, ",")
+	return strings.TrimSpace(values[getTrustedIndex(len(values), trustedHops)])
+}
+
+func getTrustedIndex(n, trustedHops int) int {
+	if trustedHops >= n {
+		return 0
+	}
+	return n - trustedHops
+}
+
+// getForwardedHops returns the addresses in the forwarded headers, from the client to the last proxy. Obfuscated
+// and unknown addresses are nil.
+func getForwardedHops(r *http.Request) []net.IP {
+	var hops []net.IP
+	if value := r.Header.Get(httputil.HeaderForwarded); value != "" {
+		for _, element := range httputil.ParseForwarded(value) {
+			hops = append(hops, element.ForIP())
+		}
+	} else {
+		for _, node := range strings.Split(r.Header.Get(httputil.HeaderForwardedFor), ",") {
+			if strings.TrimSpace(node) != "" {
+				hops = append(hops, httputil.ParseNodeIP(node))
+			}
+		}
+	}
+	return hops
+}
+
+// getForwardAuthTrustedHops returns how many of the values of the forwarded headers were added by trusted
+// proxies. Starting with the peer, the forwarded addresses are walked back towards the client while they're
+// trusted proxies. Every value is trusted when no trusted proxies are configured.
+func getForwardAuthTrustedHops(r *http.Request, peerIP net.IP, options *config.Options) int {
+	if len(options.ForwardAuthTrustedProxies) == 0 {
+		return math.MaxInt32
+	}
+	if !options.IsForwardAuthTrustedProxy(peerIP) {
+		return 0
+	}
+
+	hops := getForwardedHops(r)
+	trustedHops := 1
+	for i := len(hops) - 1; i > 0; i-- {
+		// obfuscated and unknown addresses can't be walked past
+		if hops[i] == nil || !options.IsForwardAuthTrustedProxy(hops[i]) {
+			break
+		}
+		trustedHops++
+	}
+	return trustedHops
+}
+
+// getForwardAuthClientIP returns the IP of the client from the forwarded headers. Starting with the peer,
+// the forwarded addresses are walked back towards the client until an address which isn't a trusted proxy is
+// found.
+func getForwardAuthClientIP(r *http.Request, peerIP net.IP, options *config.Options) net.IP {
+	hops := getForwardedHops(r)
+	ip := peerIP
+	for i := len(hops) - 1; i >= 0 && options.IsForwardAuthTrustedProxy(ip); i-- {
+		// obfuscated and unknown addresses can't be walked past
+		if hops[i] == nil {
+			break
+		}
+		ip = hops[i]
+	}
+	return ip
+}
+
+// setCheckRequestSourceIP replaces the source address of the check request.
+func setCheckRequestSourceIP(in *envoy_service_auth_v3.CheckRequest, ip net.IP) {
+	if ip == nil {
+		return
+	}
+	if in.Attributes.Source == nil {
+		in.Attributes.Source = &envoy_service_auth_v3.AttributeContext_Peer{}
+	}
+	in.Attributes.Source.Address = &envoy_config_core_v3.Address{
+		Address: &envoy_config_core_v3.Address_SocketAddress{
+			SocketAddress: &envoy_config_core_v3.SocketAddress{
+				Address: ip.String(),
+			},
+		},
+	}
+}
+
+// setForwardAuthResponseHeaders sets the forward-auth response headers which weren't added by the evaluator
+// to an empty value. The verify endpoint returns these headers from the request, so this keeps a client from
+// supplying its own values.
+func setForwardAuthResponseHeaders(headers http.Header, names []string) {
+	for _, name := range names {
+		if _, ok := headers[name]; !ok {
+			headers[name] = []string{""}
+		}
+	}
+}
+
 // isForwardAuth returns if the current request is a forward auth route.
 func (a *Authorize) isForwardAuth(req *envoy_service_auth_v3.CheckRequest) bool {
 	opts := a.currentOptions.Load()
@@ -133,6 +416,7 @@ func (a *Authorize) getEvaluatorRequestFromCheckRequest(
 			URL:               requestURL.String(),
 			Headers:           getCheckRequestHeaders(in),
 			ClientCertificate: getPeerCertificate(in),
+			IP:                in.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress(),
 		},
 	}
 	if sessionState != nil {
@@ -141,19 +425,61 @@ func (a *Authorize) getEvaluatorRequestFromCheckRequest(
 		}
 	}
 	req.Policy = a.getMatchingPolicy(requestURL)
+	if req.Policy != nil {
+		req.HTTP.Subdomain = req.Policy.GetWildcardSubdomain(requestURL.Host)
+	}
+	if req.Policy != nil && req.Policy.AuthorizesRequestBody() {
+		req.HTTP.Body = in.GetAttributes().GetRequest().GetHttp().GetRawBody()
+	}
+	if req.Policy != nil && req.Policy.AuthorizeRequestBody {
+		req.HTTP.RequestBody = string(req.HTTP.Body)
+		if req.Policy.ParseRequestBodyJSON {
+			req.HTTP.JSONBody = getCheckRequestJSONBody(req.HTTP.Headers, req.HTTP.Body)
+		}
+	}
 	return req, nil
 }
 
-func (a *Authorize) getMatchingPolicy(requestURL url.URL) *config.Policy {
-	options := a.currentOptions.Load()
+// getCheckRequestJSONBody returns the parsed request body, or nil if it isn't JSON.
+func getCheckRequestJSONBody(headers map[string]string, body []byte) interface{} {
+	mediaType, _, err := mime.ParseMediaType(headers["Content-Type"])
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
 
-	for _, p := range options.GetAllPolicies() {
-		if p.Matches(requestURL) {
-			return &p
-		}
+	// numbers are kept as they are, so that large IDs don't lose precision
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return nil
 	}
+	return v
+}
 
-	return nil
+func (a *Authorize) getMatchingPolicy(requestURL url.URL) *config.Policy {
+	p := a.getPolicyIndex().Match(requestURL)
+	if p == nil {
+		return nil
+	}
+	policy := *p
+	return &policy
+}
+
+type policyIndexEntry struct {
+	options *config.Options
+	index   *config.PolicyIndex
+}
+
+// getPolicyIndex returns the policy index for the current options, which is rebuilt when the options change.
+func (a *Authorize) getPolicyIndex() *config.PolicyIndex {
+	options := a.currentOptions.Load()
+	if entry, ok := a.policyIndex.Load().(*policyIndexEntry); ok && entry.options == options {
+		return entry.index
+	}
+	entry := &policyIndexEntry{options: options, index: config.NewPolicyIndex(options.GetAllPolicies())}
+	a.policyIndex.Store(entry)
+	return entry.index
 }
 
 func getHTTPRequestFromCheckRequest(req *envoy_service_auth_v3.CheckRequest) *http.Request {
@@ -2,6 +2,10 @@ package authorize
 
 import (
 	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
 	"net/url"
 	"testing"
 
@@ -10,6 +14,7 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	octrace "go.opencensus.io/trace"
 	"google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
 
@@ -18,6 +23,7 @@ import (
 	"github.com/pomerium/pomerium/internal/encoding/jws"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
@@ -103,6 +109,48 @@ func Test_getEvaluatorRequest(t *testing.T) {
 	assert.Equal(t, expect, actual)
 }
 
+func Test_getEvaluatorRequestBody(t *testing.T) {
+	a := &Authorize{currentOptions: config.NewAtomicOptions(), state: newAtomicAuthorizeState(new(authorizeState))}
+	a.currentOptions.Store(&config.Options{
+		Policies: []config.Policy{{
+			Source:               &config.StringURL{URL: &url.URL{Host: "example.com"}},
+			AuthorizeRequestBody: true,
+			ParseRequestBodyJSON: true,
+		}},
+	})
+
+	getRequest := func(t *testing.T, contentType, body string) *evaluator.Request {
+		req, err := a.getEvaluatorRequestFromCheckRequest(&envoy_service_auth_v3.CheckRequest{
+			Attributes: &envoy_service_auth_v3.AttributeContext{
+				Request: &envoy_service_auth_v3.AttributeContext_Request{
+					Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+						Method:  "POST",
+						Headers: map[string]string{"content-type": contentType},
+						Path:    "/accounts",
+						Host:    "example.com",
+						Scheme:  "https",
+						RawBody: []byte(body),
+					},
+				},
+			},
+		}, nil)
+		require.NoError(t, err)
+		return req
+	}
+
+	req := getRequest(t, "application/json; charset=utf-8", `{"account_id":123456789012}`)
+	assert.Equal(t, `{"account_id":123456789012}`, req.HTTP.RequestBody)
+	assert.Equal(t, map[string]interface{}{"account_id": json.Number("123456789012")}, req.HTTP.JSONBody)
+
+	req = getRequest(t, "text/plain", `{"account_id":123456789012}`)
+	assert.Equal(t, `{"account_id":123456789012}`, req.HTTP.RequestBody)
+	assert.Nil(t, req.HTTP.JSONBody, "should only parse JSON content types")
+
+	req = getRequest(t, "application/json", `{"account_id":`)
+	assert.Equal(t, `{"account_id":`, req.HTTP.RequestBody)
+	assert.Nil(t, req.HTTP.JSONBody, "should ignore invalid JSON")
+}
+
 func Test_handleForwardAuth(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -258,6 +306,199 @@ func Test_handleForwardAuth(t *testing.T) {
 	}
 }
 
+func Test_getForwardAuthURL(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		rawURL           string
+		headers          map[string]string
+		trustedHops      int
+		trustOriginalURL bool
+		expect           string
+	}{
+		{"uri query", "https://forward-auth.example.com/verify?uri=https%3A%2F%2Fexample.com%2Fpath", nil, math.MaxInt32, false, "https://example.com/path"},
+		{"x-forwarded", "https://forward-auth.example.com/", map[string]string{
+			httputil.HeaderForwardedProto: "https",
+			httputil.HeaderForwardedHost:  "example.com",
+			httputil.HeaderForwardedURI:   "/path?q=1",
+		}, math.MaxInt32, false, "https://example.com/path?q=1"},
+		{"multi-hop x-forwarded", "https://forward-auth.example.com/", map[string]string{
+			httputil.HeaderForwardedProto: "https, http",
+			httputil.HeaderForwardedHost:  "example.com, lb.internal",
+			httputil.HeaderForwardedURI:   "/path",
+		}, math.MaxInt32, false, "https://example.com/path"},
+		{"x-forwarded from client", "https://forward-auth.example.com/", map[string]string{
+			httputil.HeaderForwardedProto: "http, https, http",
+			httputil.HeaderForwardedHost:  "evil.example.com, example.com, lb.internal",
+			httputil.HeaderForwardedURI:   "/path",
+		}, 2, false, "https://example.com/path"},
+		{"single trusted hop", "https://forward-auth.example.com/", map[string]string{
+			httputil.HeaderForwardedProto: "http, https",
+			httputil.HeaderForwardedHost:  "evil.example.com, example.com",
+		}, 1, false, "https://example.com"},
+		{"forwarded", "https://forward-auth.example.com/", map[string]string{
+			httputil.HeaderForwarded:      `for=192.0.2.60;proto=https;host="example.com", for=10.0.0.1;proto=http;host=lb.internal`,
+			httputil.HeaderForwardedProto: "http",
+			httputil.HeaderForwardedHost:  "lb.internal",
+			httputil.HeaderForwardedURI:   "/path",
+		}, math.MaxInt32, false, "https://example.com/path"},
+		{"forwarded from client", "https://forward-auth.example.com/", map[string]string{
+			httputil.HeaderForwarded: `for=192.0.2.60;proto=http;host=evil.example.com, for=192.0.2.60;proto=https;host="example.com", for=10.0.0.1;proto=http;host=lb.internal`,
+		}, 2, false, "https://example.com"},
+		{"original url", "https://forward-auth.example.com/", map[string]string{
+			httputil.HeaderForwardedProto: "https",
+			httputil.HeaderForwardedHost:  "other.example.com",
+			httputil.HeaderOriginalURL:    "https://example.com/path",
+		}, 1, true, "https://example.com/path"},
+		{"untrusted original url", "https://forward-auth.example.com/", map[string]string{
+			httputil.HeaderForwardedProto: "https",
+			httputil.HeaderForwardedHost:  "example.com",
+			httputil.HeaderOriginalURL:    "https://other.example.com/path",
+		}, math.MaxInt32, false, "https://example.com"},
+		{"original url with uri query", "https://forward-auth.example.com/verify?uri=https%3A%2F%2Fexample.com", map[string]string{
+			httputil.HeaderOriginalURL: "https://other.example.com/path",
+		}, 1, true, "https://example.com"},
+		{"relative original url", "https://forward-auth.example.com/", map[string]string{
+			httputil.HeaderForwardedProto: "https",
+			httputil.HeaderForwardedHost:  "example.com",
+			httputil.HeaderOriginalURL:    "/path?q=1",
+		}, 1, true, "https://example.com/path?q=1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, tc.rawURL, nil)
+			require.NoError(t, err)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tc.expect, getForwardAuthURL(r, tc.trustedHops, tc.trustOriginalURL).String())
+		})
+	}
+}
+
+func Test_getForwardAuthMethod(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		headerName string
+		headers    map[string]string
+		expect     string
+	}{
+		{"none", httputil.HeaderForwardedMethod, nil, ""},
+		{"not configured", "", map[string]string{httputil.HeaderForwardedMethod: "POST"}, ""},
+		{"x-forwarded-method", httputil.HeaderForwardedMethod, map[string]string{httputil.HeaderForwardedMethod: "post"}, "POST"},
+		{"x-original-method", httputil.HeaderOriginalMethod, map[string]string{httputil.HeaderOriginalMethod: "DELETE"}, "DELETE"},
+		{"other header", httputil.HeaderOriginalMethod, map[string]string{httputil.HeaderForwardedMethod: "PUT"}, ""},
+		{"options", httputil.HeaderForwardedMethod, map[string]string{httputil.HeaderForwardedMethod: "OPTIONS"}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "https://forward-auth.example.com/", nil)
+			require.NoError(t, err)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tc.expect, getForwardAuthMethod(r, tc.headerName))
+		})
+	}
+}
+
+func Test_getForwardAuthClientIP(t *testing.T) {
+	options := newForwardAuthTrustedProxiesOptions(t, "10.0.0.0/8")
+	for _, tc := range []struct {
+		name    string
+		peerIP  string
+		headers map[string]string
+		expect  string
+	}{
+		{"untrusted peer", "192.0.2.1", map[string]string{
+			httputil.HeaderForwardedFor: "203.0.113.1",
+		}, "192.0.2.1"},
+		{"x-forwarded-for", "10.0.0.2", map[string]string{
+			httputil.HeaderForwardedFor: "198.51.100.1, 203.0.113.1, 10.0.0.1, 10.0.0.2",
+		}, "203.0.113.1"},
+		{"all trusted", "10.0.0.2", map[string]string{
+			httputil.HeaderForwardedFor: "10.0.0.1",
+		}, "10.0.0.1"},
+		{"forwarded", "10.0.0.2", map[string]string{
+			httputil.HeaderForwarded:    `for="[2001:db8::1]:4711", for=10.0.0.1`,
+			httputil.HeaderForwardedFor: "198.51.100.1",
+		}, "2001:db8::1"},
+		{"obfuscated", "10.0.0.2", map[string]string{
+			httputil.HeaderForwarded: `for=203.0.113.1, for=_hidden, for=10.0.0.1`,
+		}, "10.0.0.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "https://forward-auth.example.com/", nil)
+			require.NoError(t, err)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tc.expect, getForwardAuthClientIP(r, net.ParseIP(tc.peerIP), options).String())
+		})
+	}
+}
+
+func Test_getForwardAuthTrustedHops(t *testing.T) {
+	options := newForwardAuthTrustedProxiesOptions(t, "10.0.0.0/8")
+	for _, tc := range []struct {
+		name    string
+		peerIP  string
+		headers map[string]string
+		expect  int
+	}{
+		{"untrusted peer", "192.0.2.1", map[string]string{
+			httputil.HeaderForwardedFor: "10.0.0.1",
+		}, 0},
+		{"no forwarded addresses", "10.0.0.2", nil, 1},
+		{"x-forwarded-for", "10.0.0.2", map[string]string{
+			httputil.HeaderForwardedFor: "198.51.100.1, 203.0.113.1, 10.0.0.1",
+		}, 2},
+		{"forwarded", "10.0.0.2", map[string]string{
+			httputil.HeaderForwarded: `for=203.0.113.1, for=10.0.0.1`,
+		}, 2},
+		{"obfuscated", "10.0.0.2", map[string]string{
+			httputil.HeaderForwarded: `for=203.0.113.1, for=10.0.0.3, for=_hidden`,
+		}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "https://forward-auth.example.com/", nil)
+			require.NoError(t, err)
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tc.expect, getForwardAuthTrustedHops(r, net.ParseIP(tc.peerIP), options))
+		})
+	}
+
+	t.Run("no trusted proxies", func(t *testing.T) {
+		r, err := http.NewRequest(http.MethodGet, "https://forward-auth.example.com/", nil)
+		require.NoError(t, err)
+		assert.Equal(t, math.MaxInt32, getForwardAuthTrustedHops(r, net.ParseIP("192.0.2.1"), &config.Options{}))
+	})
+}
+
+func newForwardAuthTrustedProxiesOptions(t *testing.T, cidrs ...string) *config.Options {
+	t.Helper()
+
+	options := config.NewDefaultOptions()
+	options.SharedKey = "80ldlrU2d7w+wVpKNfevk6fmb8otEx6CqOfshj2LwhQ="
+	options.CookieSecret = "OromP1gurwGWjQPYb1nNgSxtbVB5NnLzX6z5WOKr0Yw="
+	options.InsecureServer = true
+	options.ForwardAuthTrustedProxies = cidrs
+	require.NoError(t, options.Validate())
+	return options
+}
+
+func Test_setForwardAuthResponseHeaders(t *testing.T) {
+	headers := http.Header{
+		"X-Pomerium-Jwt-Assertion": {"JWT"},
+	}
+	setForwardAuthResponseHeaders(headers, (&config.Options{
+		JWTClaimsHeaders: config.NewJWTClaimHeaders("email"),
+	}).GetForwardAuthResponseHeaders())
+	assert.Equal(t, http.Header{
+		"X-Pomerium-Claim-Email":   {""},
+		"X-Pomerium-Jwt-Assertion": {"JWT"},
+	}, headers)
+}
+
 func Test_getEvaluatorRequestWithPortInHostHeader(t *testing.T) {
 	a := &Authorize{currentOptions: config.NewAtomicOptions(), state: newAtomicAuthorizeState(new(authorizeState))}
 	encoder, _ := jws.NewHS256Signer([]byte{0, 0, 0, 0})
@@ -412,3 +653,63 @@ func TestAuthorize_Check(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthorize_CheckRequestID(t *testing.T) {
+	opt := config.NewDefaultOptions()
+	opt.AuthenticateURLString = "https://authenticate.example.com"
+	opt.DataBrokerURLString = "https://databroker.example.com"
+	opt.SharedKey = "E8wWIMnihUx+AUfRegAQDNs8eRb3UrB5G3zlJW9XJDM="
+	a, err := New(&config.Config{Options: opt})
+	require.NoError(t, err)
+
+	res, err := a.Check(context.Background(), &envoy_service_auth_v3.CheckRequest{
+		Attributes: &envoy_service_auth_v3.AttributeContext{
+			Request: &envoy_service_auth_v3.AttributeContext_Request{
+				Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+					Method: "GET",
+					Headers: map[string]string{
+						"accept":       "application/json",
+						"x-request-id": "ENVOY-REQUEST-ID",
+					},
+					Path:   "/some/path",
+					Host:   "example.com",
+					Scheme: "https",
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, res.GetDeniedResponse().GetBody(), "ENVOY-REQUEST-ID",
+		"the error response should use envoy's request id")
+}
+
+func Test_startCheckSpan(t *testing.T) {
+	hreq, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	hreq.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	t.Run("downstream parent", func(t *testing.T) {
+		ctx, span := startCheckSpan(context.Background(), hreq)
+		defer span.End()
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID.String())
+
+		got := (&Authorize{}).okResponse(ctx, &evaluator.Result{Allow: true})
+		traceparent, _ := trace.SpanContextToW3CHeaders(span.SpanContext())
+		var found bool
+		for _, hdr := range got.GetOkResponse().GetHeaders() {
+			if hdr.GetHeader().GetKey() == "traceparent" {
+				found = true
+				assert.Equal(t, traceparent, hdr.GetHeader().GetValue())
+			}
+		}
+		assert.True(t, found, "should inject traceparent header")
+	})
+	t.Run("envoy parent", func(t *testing.T) {
+		ctx, parent := octrace.StartSpan(context.Background(), "envoy")
+		defer parent.End()
+		ctx = trace.ContextWithRemoteParent(ctx)
+
+		_, span := startCheckSpan(ctx, hreq)
+		defer span.End()
+		assert.Equal(t, parent.SpanContext().TraceID, span.SpanContext().TraceID)
+	})
+}
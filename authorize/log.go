@@ -2,12 +2,20 @@ package authorize
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry/requestid"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
@@ -19,56 +27,42 @@ import (
 func (a *Authorize) logAuthorizeCheck(
 	ctx context.Context,
 	in *envoy_service_auth_v3.CheckRequest, out *envoy_service_auth_v3.CheckResponse,
-	res *evaluator.Result, s sessionOrServiceAccount, u *user.User,
+	res *evaluator.Result, errorCode httputil.ErrorCode, s sessionOrServiceAccount, u *user.User,
 ) {
 	ctx, span := trace.StartSpan(ctx, "authorize.grpc.LogAuthorizeCheck")
 	defer span.End()
 
-	hdrs := getCheckRequestHeaders(in)
-	hattrs := in.GetAttributes().GetRequest().GetHttp()
-	evt := log.Info(ctx).Str("service", "authorize")
-	// request
-	evt = evt.Str("request-id", requestid.FromContext(ctx))
-	evt = evt.Str("check-request-id", hdrs["X-Request-Id"])
-	evt = evt.Str("method", hattrs.GetMethod())
-	evt = evt.Str("path", stripQueryString(hattrs.GetPath()))
-	evt = evt.Str("host", hattrs.GetHost())
-	evt = evt.Str("query", hattrs.GetQuery())
-
-	// session information
-	if s, ok := s.(*session.Session); ok {
-		evt = evt.Str("session-id", s.GetId())
-		if s.GetImpersonateEmail() != "" {
-			evt = evt.Str("impersonate-email", s.GetImpersonateEmail())
-		}
-		if len(s.GetImpersonateGroups()) > 0 {
-			evt = evt.Strs("impersonate-groups", s.GetImpersonateGroups())
-		}
-		if s.GetImpersonateUserId() != "" {
-			evt = evt.Str("impersonate-user-id", s.GetImpersonateUserId())
-		}
-	}
-	if sa, ok := s.(*user.ServiceAccount); ok {
-		evt = evt.Str("service-account-id", sa.GetId())
-	}
+	opts := a.currentOptions.Load()
+	entry := &authorizeLogEntry{
+		ctx:  ctx,
+		a:    a,
+		in:   in,
+		hdrs: getCheckRequestHeaders(in),
+		res:  res,
+		s:    s,
+		u:    u,
 
-	// result
-	if res != nil {
-		evt = evt.Bool("allow", res.Allow)
-		evt = evt.Interface("deny", res.Deny)
-		evt = evt.Str("user", u.GetId())
-		evt = evt.Str("email", u.GetEmail())
-		evt = evt.Uint64("databroker_server_version", res.DataBrokerServerVersion)
-		evt = evt.Uint64("databroker_record_version", res.DataBrokerRecordVersion)
+		errorCode: errorCode,
 	}
 
-	// potentially sensitive, only log if debug mode
-	if zerolog.GlobalLevel() <= zerolog.DebugLevel {
-		evt = evt.Interface("headers", hdrs)
+	// with the authorize decision in the envoy access log, allowed checks are logged by the control plane. Envoy
+	// doesn't add the metadata of denied checks to the access log, so those are still logged here.
+	if !opts.AccessLogAuthorizeDecision || out.GetStatus().GetCode() != int32(codes.OK) {
+		switch format := opts.GetAuthorizeLogFormat(); format {
+		case log.AuthorizeLogFormatCombined:
+			log.AccessInfo(ctx).Str("service", "authorize").Msg(entry.combinedLogLine(time.Now(), out))
+		default:
+			evt := log.AccessInfo(ctx).Str("service", "authorize")
+			if format == log.AuthorizeLogFormatECS {
+				evt = evt.Str("event.kind", "event").Str("event.action", "authorize-check")
+			}
+			for _, field := range opts.GetAuthorizeLogFields() {
+				evt = entry.populate(evt, format, field)
+			}
+			evt.Msg("authorize check")
+		}
 	}
 
-	evt.Msg("authorize check")
-
 	if enc := a.state.Load().auditEncryptor; enc != nil {
 		ctx, span := trace.StartSpan(ctx, "authorize.grpc.AuditAuthorizeCheck")
 		defer span.End()
@@ -86,13 +80,285 @@ func (a *Authorize) logAuthorizeCheck(
 			log.Warn(ctx).Err(err).Msg("authorize: error encrypting audit record")
 			return
 		}
-		log.Info(ctx).
+		log.AccessInfo(ctx).
 			Str("request-id", requestid.FromContext(ctx)).
 			EmbedObject(sealed).
 			Msg("audit log")
 	}
 }
 
+// getAuthorizeDecisionMetadata returns the envoy dynamic metadata used to add the authorize decision to the envoy
+// access log entry of a request. Envoy adds it to the log entry in the log.AuthorizeDecisionMetadataNamespace
+// namespace. Its fields are named like the authorize log fields.
+func getAuthorizeDecisionMetadata(
+	res *evaluator.Result, s sessionOrServiceAccount, u *user.User, routeID string,
+) *structpb.Struct {
+	fields := map[string]*structpb.Value{
+		string(log.AuthorizeLogFieldAllow): structpb.NewBoolValue(res.Allow),
+	}
+	if res.Deny != nil {
+		fields[string(log.AuthorizeLogFieldDeny)] = structpb.NewStructValue(&structpb.Struct{
+			Fields: map[string]*structpb.Value{
+				"status":  structpb.NewNumberValue(float64(res.Deny.Status)),
+				"message": structpb.NewStringValue(res.Deny.Message),
+			},
+		})
+	}
+	if routeID != "" {
+		fields[string(log.AuthorizeLogFieldRouteID)] = structpb.NewStringValue(routeID)
+	}
+	switch s := s.(type) {
+	case *session.Session:
+		fields[string(log.AuthorizeLogFieldSessionID)] = structpb.NewStringValue(s.GetId())
+	case *user.ServiceAccount:
+		fields[string(log.AuthorizeLogFieldServiceAccountID)] = structpb.NewStringValue(s.GetId())
+	}
+	if u.GetId() != "" {
+		fields[string(log.AuthorizeLogFieldUser)] = structpb.NewStringValue(u.GetId())
+	}
+	if u.GetEmail() != "" {
+		fields[string(log.AuthorizeLogFieldEmail)] = structpb.NewStringValue(u.GetEmail())
+	}
+
+	return &structpb.Struct{Fields: fields}
+}
+
+// An authorizeLogEntry holds the data logged for an authorize check.
+type authorizeLogEntry struct {
+	ctx  context.Context
+	a    *Authorize
+	in   *envoy_service_auth_v3.CheckRequest
+	hdrs map[string]string
+	res  *evaluator.Result
+	s    sessionOrServiceAccount
+	u    *user.User
+
+	errorCode httputil.ErrorCode
+	claims    map[string]interface{}
+}
+
+// populate adds a field to the log event.
+func (entry *authorizeLogEntry) populate(evt *zerolog.Event, format log.AuthorizeLogFormat, field log.AuthorizeLogField) *zerolog.Event {
+	name := authorizeLogFieldName(format, field)
+	hattrs := entry.in.GetAttributes().GetRequest().GetHttp()
+	sess, _ := entry.s.(*session.Session)
+
+	switch field {
+	// request
+	case log.AuthorizeLogFieldRequestID:
+		return evt.Str(name, requestid.FromContext(entry.ctx))
+	case log.AuthorizeLogFieldCheckRequestID:
+		return evt.Str(name, entry.hdrs["X-Request-Id"])
+	case log.AuthorizeLogFieldMethod:
+		return evt.Str(name, hattrs.GetMethod())
+	case log.AuthorizeLogFieldPath:
+		return evt.Str(name, stripQueryString(hattrs.GetPath()))
+	case log.AuthorizeLogFieldHost:
+		return evt.Str(name, hattrs.GetHost())
+	case log.AuthorizeLogFieldQuery:
+		return evt.Str(name, hattrs.GetQuery())
+	case log.AuthorizeLogFieldIP:
+		return evt.Str(name, entry.in.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress())
+	case log.AuthorizeLogFieldRouteID:
+		requestURL := getCheckRequestURL(entry.in)
+		if policy := entry.a.getMatchingPolicy(requestURL); policy != nil {
+			if id, err := policy.RouteID(); err == nil {
+				return evt.Str(name, strconv.FormatUint(id, 10))
+			}
+		}
+		return evt
+	// potentially sensitive, not logged by default unless in debug mode
+	case log.AuthorizeLogFieldHeaders:
+		return evt.Interface(name, entry.hdrs)
+
+	// session information
+	case log.AuthorizeLogFieldSessionID:
+		if sess != nil {
+			return evt.Str(name, sess.GetId())
+		}
+		return evt
+	case log.AuthorizeLogFieldImpersonateEmail:
+		if sess.GetImpersonateEmail() != "" {
+			return evt.Str(name, sess.GetImpersonateEmail())
+		}
+		return evt
+	case log.AuthorizeLogFieldImpersonateGroups:
+		if len(sess.GetImpersonateGroups()) > 0 {
+			return evt.Strs(name, sess.GetImpersonateGroups())
+		}
+		return evt
+	case log.AuthorizeLogFieldImpersonateUserID:
+		if sess.GetImpersonateUserId() != "" {
+			return evt.Str(name, sess.GetImpersonateUserId())
+		}
+		return evt
+	case log.AuthorizeLogFieldServiceAccountID:
+		if sa, ok := entry.s.(*user.ServiceAccount); ok {
+			return evt.Str(name, sa.GetId())
+		}
+		return evt
+
+	// error
+	case log.AuthorizeLogFieldErrorCode:
+		if entry.errorCode != "" {
+			return evt.Str(name, string(entry.errorCode))
+		}
+		return evt
+	}
+
+	// result
+	if entry.res == nil {
+		return evt
+	}
+	switch field {
+	case log.AuthorizeLogFieldAllow:
+		if format == log.AuthorizeLogFormatECS {
+			outcome := "failure"
+			if entry.res.Allow {
+				outcome = "success"
+			}
+			return evt.Str(name, outcome)
+		}
+		return evt.Bool(name, entry.res.Allow)
+	case log.AuthorizeLogFieldDeny:
+		return evt.Interface(name, entry.res.Deny)
+	case log.AuthorizeLogFieldUser:
+		return evt.Str(name, entry.u.GetId())
+	case log.AuthorizeLogFieldEmail:
+		return evt.Str(name, entry.u.GetEmail())
+	case log.AuthorizeLogFieldDataBrokerServerVersion:
+		return evt.Uint64(name, entry.res.DataBrokerServerVersion)
+	case log.AuthorizeLogFieldDataBrokerRecordVersion:
+		return evt.Uint64(name, entry.res.DataBrokerRecordVersion)
+	}
+
+	if header, ok := field.Header(); ok {
+		if value, ok := entry.hdrs[http.CanonicalHeaderKey(header)]; ok {
+			return evt.Str(name, value)
+		}
+		return evt
+	}
+	if claim, ok := field.Claim(); ok {
+		if value, ok := entry.getClaims()[claim]; ok {
+			return evt.Interface(name, value)
+		}
+		return evt
+	}
+	return evt
+}
+
+// getClaims returns the claims of the JWT assertion sent to the upstream.
+func (entry *authorizeLogEntry) getClaims() map[string]interface{} {
+	if entry.claims != nil {
+		return entry.claims
+	}
+
+	entry.claims = map[string]interface{}{}
+	rawJWT := entry.res.Headers.Get(httputil.HeaderPomeriumJWTAssertion)
+	if rawJWT == "" {
+		return entry.claims
+	}
+	token, err := jwt.ParseSigned(rawJWT)
+	if err != nil {
+		return entry.claims
+	}
+	// the JWT was signed by the authorize service itself, so there's no need to verify it
+	_ = token.UnsafeClaimsWithoutVerification(&entry.claims)
+	return entry.claims
+}
+
+// combinedLogLine returns the request as an Apache combined log line. The status is the one returned
+// by the authorize check, and the response size is unknown.
+func (entry *authorizeLogEntry) combinedLogLine(now time.Time, out *envoy_service_auth_v3.CheckResponse) string {
+	hattrs := entry.in.GetAttributes().GetRequest().GetHttp()
+
+	status := http.StatusOK
+	if code := out.GetDeniedResponse().GetStatus().GetCode(); code != 0 {
+		status = int(code)
+	} else if out.GetStatus().GetCode() != int32(codes.OK) {
+		status = http.StatusForbidden
+	}
+
+	protocol := hattrs.GetProtocol()
+	if protocol == "" {
+		protocol = "HTTP/1.1"
+	}
+
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d - "%s" "%s"`,
+		combinedLogValue(entry.in.GetAttributes().GetSource().GetAddress().GetSocketAddress().GetAddress()),
+		combinedLogValue(firstNonEmpty(entry.u.GetEmail(), entry.u.GetId())),
+		now.Format("02/Jan/2006:15:04:05 -0700"),
+		combinedLogQuote(hattrs.GetMethod()),
+		combinedLogQuote(hattrs.GetPath()),
+		combinedLogQuote(protocol),
+		status,
+		combinedLogQuote(combinedLogValue(entry.hdrs[httputil.HeaderReferrer])),
+		combinedLogQuote(combinedLogValue(entry.hdrs["User-Agent"])),
+	)
+}
+
+// ecsAuthorizeLogFieldNames maps authorize log fields to Elastic Common Schema field names. Fields
+// which have no equivalent are logged under pomerium.
+var ecsAuthorizeLogFieldNames = map[log.AuthorizeLogField]string{
+	log.AuthorizeLogFieldAllow:                   "event.outcome",
+	log.AuthorizeLogFieldCheckRequestID:          "pomerium.check_request_id",
+	log.AuthorizeLogFieldDataBrokerRecordVersion: "pomerium.databroker_record_version",
+	log.AuthorizeLogFieldDataBrokerServerVersion: "pomerium.databroker_server_version",
+	log.AuthorizeLogFieldDeny:                    "pomerium.deny",
+	log.AuthorizeLogFieldEmail:                   "user.email",
+	log.AuthorizeLogFieldErrorCode:               "error.code",
+	log.AuthorizeLogFieldHeaders:                 "http.request.headers",
+	log.AuthorizeLogFieldHost:                    "url.domain",
+	log.AuthorizeLogFieldImpersonateEmail:        "pomerium.impersonate_email",
+	log.AuthorizeLogFieldImpersonateGroups:       "pomerium.impersonate_groups",
+	log.AuthorizeLogFieldImpersonateUserID:       "pomerium.impersonate_user_id",
+	log.AuthorizeLogFieldIP:                      "source.ip",
+	log.AuthorizeLogFieldMethod:                  "http.request.method",
+	log.AuthorizeLogFieldPath:                    "url.path",
+	log.AuthorizeLogFieldQuery:                   "url.query",
+	log.AuthorizeLogFieldRequestID:               "http.request.id",
+	log.AuthorizeLogFieldRouteID:                 "pomerium.route_id",
+	log.AuthorizeLogFieldServiceAccountID:        "pomerium.service_account_id",
+	log.AuthorizeLogFieldSessionID:               "pomerium.session_id",
+	log.AuthorizeLogFieldUser:                    "user.id",
+}
+
+func authorizeLogFieldName(format log.AuthorizeLogFormat, field log.AuthorizeLogField) string {
+	if format != log.AuthorizeLogFormatECS {
+		return string(field)
+	}
+	if name, ok := ecsAuthorizeLogFieldNames[field]; ok {
+		return name
+	}
+	if header, ok := field.Header(); ok {
+		return "http.request.headers." + strings.ToLower(header)
+	}
+	if claim, ok := field.Claim(); ok {
+		return "pomerium.claims." + claim
+	}
+	return string(field)
+}
+
+func combinedLogValue(str string) string {
+	if str == "" {
+		return "-"
+	}
+	return str
+}
+
+func combinedLogQuote(str string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(str)
+}
+
+func firstNonEmpty(strs ...string) string {
+	for _, str := range strs {
+		if str != "" {
+			return str
+		}
+	}
+	return ""
+}
+
 func stripQueryString(str string) string {
 	if idx := strings.Index(str, "?"); idx != -1 {
 		str = str[:idx]
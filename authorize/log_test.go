@@ -0,0 +1,203 @@
+package authorize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	envoy_type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestAuthorize_logAuthorizeCheck(t *testing.T) {
+	var buf bytes.Buffer
+	original := log.Logger()
+	defer log.SetLogger(original)
+	l := zerolog.New(&buf)
+	log.SetLogger(&l)
+
+	in := &envoy_service_auth_v3.CheckRequest{
+		Attributes: &envoy_service_auth_v3.AttributeContext{
+			Source: &envoy_service_auth_v3.AttributeContext_Peer{
+				Address: &envoy_config_core_v3.Address{
+					Address: &envoy_config_core_v3.Address_SocketAddress{
+						SocketAddress: &envoy_config_core_v3.SocketAddress{Address: "192.0.2.1"},
+					},
+				},
+			},
+			Request: &envoy_service_auth_v3.AttributeContext_Request{
+				Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+					Method:   http.MethodGet,
+					Host:     "example.com",
+					Path:     "/some/path?a=b",
+					Query:    "a=b",
+					Protocol: "HTTP/2",
+					Headers: map[string]string{
+						"user-agent": "curl/7.0",
+						"x-custom":   "custom-value",
+					},
+				},
+			},
+		},
+	}
+	res := &evaluator.Result{Allow: true, Headers: http.Header{}}
+	s := &session.Session{Id: "SESSION_ID"}
+	u := &user.User{Id: "USER_ID", Email: "user@example.com"}
+
+	logCheck := func(t *testing.T, options *config.Options) map[string]interface{} {
+		buf.Reset()
+		a := &Authorize{currentOptions: config.NewAtomicOptions(), state: newAtomicAuthorizeState(new(authorizeState))}
+		a.currentOptions.Store(options)
+		a.logAuthorizeCheck(context.Background(), in, &envoy_service_auth_v3.CheckResponse{}, res, "", s, u)
+
+		var m map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+		return m
+	}
+
+	t.Run("default", func(t *testing.T) {
+		m := logCheck(t, &config.Options{})
+		assert.Equal(t, "authorize check", m["message"])
+		assert.Equal(t, "/some/path", m["path"])
+		assert.Equal(t, "SESSION_ID", m["session-id"])
+		assert.Equal(t, true, m["allow"])
+		assert.Equal(t, "user@example.com", m["email"])
+		assert.NotContains(t, m, "ip")
+	})
+	t.Run("fields", func(t *testing.T) {
+		m := logCheck(t, &config.Options{
+			AuthorizeLogFields: []string{"ip", "email", "headers.X-Custom", "headers.x-missing"},
+		})
+		assert.Equal(t, map[string]interface{}{
+			"level":            "info",
+			"service":          "authorize",
+			"message":          "authorize check",
+			"ip":               "192.0.2.1",
+			"email":            "user@example.com",
+			"headers.X-Custom": "custom-value",
+		}, m)
+	})
+	t.Run("claims", func(t *testing.T) {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: []byte("secret")}, nil)
+		require.NoError(t, err)
+		rawJWT, err := jwt.Signed(signer).Claims(map[string]interface{}{
+			"groups": []string{"admin", "dev"},
+		}).CompactSerialize()
+		require.NoError(t, err)
+		res.Headers.Set(httputil.HeaderPomeriumJWTAssertion, rawJWT)
+		defer res.Headers.Del(httputil.HeaderPomeriumJWTAssertion)
+
+		m := logCheck(t, &config.Options{
+			AuthorizeLogFields: []string{"claims.groups", "claims.missing"},
+		})
+		assert.Equal(t, []interface{}{"admin", "dev"}, m["claims.groups"])
+		assert.NotContains(t, m, "claims.missing")
+	})
+	t.Run("ecs", func(t *testing.T) {
+		m := logCheck(t, &config.Options{
+			AuthorizeLogFormat: "ecs",
+			AuthorizeLogFields: []string{"method", "user", "allow", "headers.user-agent"},
+		})
+		assert.Equal(t, map[string]interface{}{
+			"level":                           "info",
+			"service":                         "authorize",
+			"message":                         "authorize check",
+			"event.kind":                      "event",
+			"event.action":                    "authorize-check",
+			"http.request.method":             "GET",
+			"user.id":                         "USER_ID",
+			"event.outcome":                   "success",
+			"http.request.headers.user-agent": "curl/7.0",
+		}, m)
+	})
+	t.Run("combined", func(t *testing.T) {
+		m := logCheck(t, &config.Options{AuthorizeLogFormat: "combined"})
+		assert.Regexp(t,
+			regexp.MustCompile(`^192\.0\.2\.1 - user@example\.com \[.+\] "GET /some/path\?a=b HTTP/2" 200 - "-" "curl/7\.0"$`),
+			m["message"])
+	})
+	t.Run("access log authorize decision", func(t *testing.T) {
+		buf.Reset()
+		a := &Authorize{currentOptions: config.NewAtomicOptions(), state: newAtomicAuthorizeState(new(authorizeState))}
+		a.currentOptions.Store(&config.Options{AccessLogAuthorizeDecision: true})
+		a.logAuthorizeCheck(context.Background(), in, &envoy_service_auth_v3.CheckResponse{
+			Status: &status.Status{Code: int32(codes.OK)},
+		}, res, "", s, u)
+		assert.Empty(t, buf.String(), "allowed checks should be logged with the envoy access log")
+
+		a.logAuthorizeCheck(context.Background(), in, &envoy_service_auth_v3.CheckResponse{
+			Status: &status.Status{Code: int32(codes.PermissionDenied)},
+		}, res, httputil.ErrorCodeForbidden, s, u)
+		assert.Contains(t, buf.String(), "authorize check")
+		assert.Contains(t, buf.String(), `"error-code":"forbidden"`)
+	})
+}
+
+func TestAuthorizeLogEntry_combinedLogLine(t *testing.T) {
+	entry := &authorizeLogEntry{
+		in: &envoy_service_auth_v3.CheckRequest{
+			Attributes: &envoy_service_auth_v3.AttributeContext{
+				Request: &envoy_service_auth_v3.AttributeContext_Request{
+					Http: &envoy_service_auth_v3.AttributeContext_HttpRequest{
+						Method: http.MethodPost,
+						Path:   `/"quoted"`,
+					},
+				},
+			},
+		},
+		hdrs: map[string]string{"Referer": "https://example.com/"},
+	}
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	out := &envoy_service_auth_v3.CheckResponse{
+		HttpResponse: &envoy_service_auth_v3.CheckResponse_DeniedResponse{
+			DeniedResponse: &envoy_service_auth_v3.DeniedHttpResponse{
+				Status: &envoy_type_v3.HttpStatus{Code: envoy_type_v3.StatusCode_Found},
+			},
+		},
+	}
+	assert.Equal(t,
+		`- - - [04/Mar/2021:05:06:07 +0000] "POST /\"quoted\" HTTP/1.1" 302 - "https://example.com/" "-"`,
+		entry.combinedLogLine(now, out))
+}
+
+func TestGetAuthorizeDecisionMetadata(t *testing.T) {
+	md := getAuthorizeDecisionMetadata(
+		&evaluator.Result{Deny: &evaluator.Denial{Status: http.StatusForbidden, Message: "forbidden"}},
+		&session.Session{Id: "SESSION_ID"},
+		&user.User{Id: "USER_ID", Email: "user@example.com"},
+		"1234",
+	)
+	assert.Equal(t, map[string]interface{}{
+		"allow":      false,
+		"deny":       map[string]interface{}{"status": float64(http.StatusForbidden), "message": "forbidden"},
+		"route-id":   "1234",
+		"session-id": "SESSION_ID",
+		"user":       "USER_ID",
+		"email":      "user@example.com",
+	}, md.AsMap())
+
+	md = getAuthorizeDecisionMetadata(&evaluator.Result{Allow: true}, &user.ServiceAccount{Id: "SA_ID"}, nil, "")
+	assert.Equal(t, map[string]interface{}{
+		"allow":              true,
+		"service-account-id": "SA_ID",
+	}, md.AsMap())
+}
@@ -0,0 +1,262 @@
+package authorize
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/cespare/xxhash/v2"
+	"github.com/google/uuid"
+
+	"github.com/pomerium/pomerium/internal/activity"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	registrypb "github.com/pomerium/pomerium/pkg/grpc/registry"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// sessionPartitionVirtualNodes is the number of points each instance has on the hash ring, which evens out
+// the share of sessions each instance owns.
+const sessionPartitionVirtualNodes = 128
+
+// A sessionPartitioner assigns sessions to authorize instances with consistent hashing. Instances register
+// themselves in the databroker's service registry and watch it for the other instances. When partitioning
+// is disabled, or the other instances aren't known yet, every session is owned.
+type sessionPartitioner struct {
+	// endpoint uniquely identifies this instance in the registry
+	endpoint string
+
+	mu      sync.Mutex
+	enabled bool
+	// configChanged is signaled when partitioning is enabled or disabled
+	configChanged chan struct{}
+
+	ring atomic.Value // *sessionHashRing
+	// changed is signaled when the instances change, so sessions which are now owned are synced
+	changed chan struct{}
+}
+
+func newSessionPartitioner() *sessionPartitioner {
+	p := &sessionPartitioner{
+		endpoint:      "urn:uuid:" + uuid.New().String(),
+		configChanged: make(chan struct{}, 1),
+		changed:       make(chan struct{}, 1),
+	}
+	p.ring.Store((*sessionHashRing)(nil))
+	return p
+}
+
+// SetEnabled enables or disables session partitioning.
+func (p *sessionPartitioner) SetEnabled(enabled bool) {
+	p.mu.Lock()
+	changed := p.enabled != enabled
+	p.enabled = enabled
+	p.mu.Unlock()
+
+	if changed {
+		notify(p.configChanged)
+	}
+}
+
+func (p *sessionPartitioner) isEnabled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.enabled
+}
+
+// Owns returns true if this instance owns the session.
+func (p *sessionPartitioner) Owns(sessionID string) bool {
+	ring := p.ring.Load().(*sessionHashRing)
+	return ring == nil || ring.Get(sessionID) == p.endpoint
+}
+
+// OwnsRecord returns true if this instance should sync the record. Only session and service account records
+// are partitioned, and deletions are always synced. Activity records are only written by authorize and aren't
+// used by policies, so they're never synced.
+func (p *sessionPartitioner) OwnsRecord(record *databroker.Record) bool {
+	switch record.GetType() {
+	case grpcutil.GetTypeURL(new(session.Session)), grpcutil.GetTypeURL(new(user.ServiceAccount)):
+		return record.GetDeletedAt() != nil || p.Owns(record.GetId())
+	case activity.SessionRecordType, activity.DecisionRecordType:
+		return false
+	default:
+		return true
+	}
+}
+
+// Changed returns a channel which is signaled when the sessions owned by this instance change.
+func (p *sessionPartitioner) Changed() <-chan struct{} {
+	return p.changed
+}
+
+func (p *sessionPartitioner) setRing(ring *sessionHashRing) {
+	current := p.ring.Load().(*sessionHashRing)
+	if current.Equal(ring) {
+		return
+	}
+	p.ring.Store(ring)
+	notify(p.changed)
+}
+
+// Run registers this instance and watches the registry for the other instances while partitioning is enabled.
+func (p *sessionPartitioner) Run(ctx context.Context, getClient func() registrypb.RegistryClient) error {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = 0
+
+	for {
+		if !p.isEnabled() {
+			p.setRing(nil)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-p.configChanged:
+			}
+			continue
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		errc := make(chan error, 1)
+		go func() { errc <- p.watch(runCtx, getClient()) }()
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			return ctx.Err()
+		case <-p.configChanged:
+			cancel()
+			<-errc
+		case err := <-errc:
+			cancel()
+			log.Error(ctx).Err(err).Msg("authorize: error watching authorize instances")
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(bo.NextBackOff()):
+			}
+		}
+	}
+}
+
+func (p *sessionPartitioner) watch(ctx context.Context, client registrypb.RegistryClient) error {
+	svc := &registrypb.Service{Kind: registrypb.ServiceKind_AUTHORIZE, Endpoint: p.endpoint}
+	res, err := client.Report(ctx, &registrypb.RegisterRequest{Services: []*registrypb.Service{svc}})
+	if err != nil {
+		return err
+	}
+	go p.report(ctx, client, svc, res.GetCallBackAfter().AsDuration())
+
+	stream, err := client.Watch(ctx, &registrypb.ListRequest{
+		Kinds: []registrypb.ServiceKind{registrypb.ServiceKind_AUTHORIZE},
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		list, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		// this instance is always on the ring, even before its registration is seen
+		endpoints := []string{p.endpoint}
+		for _, svc := range list.GetServices() {
+			if svc.GetKind() == registrypb.ServiceKind_AUTHORIZE && svc.GetEndpoint() != p.endpoint {
+				endpoints = append(endpoints, svc.GetEndpoint())
+			}
+		}
+		log.Info(ctx).Int("instances", len(endpoints)).Msg("authorize: partitioning sessions")
+		p.setRing(newSessionHashRing(endpoints))
+	}
+}
+
+func (p *sessionPartitioner) report(ctx context.Context, client registrypb.RegistryClient, svc *registrypb.Service, after time.Duration) {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(after):
+		}
+
+		res, err := client.Report(ctx, &registrypb.RegisterRequest{Services: []*registrypb.Service{svc}})
+		if err != nil {
+			log.Error(ctx).Err(err).Msg("authorize: error registering instance")
+			after = bo.NextBackOff()
+			continue
+		}
+		bo.Reset()
+		after = res.GetCallBackAfter().AsDuration()
+	}
+}
+
+// A sessionHashRing is a consistent hash ring of authorize instances.
+type sessionHashRing struct {
+	endpoints []string
+	points    []uint64
+	owners    map[uint64]string
+}
+
+func newSessionHashRing(endpoints []string) *sessionHashRing {
+	ring := &sessionHashRing{
+		endpoints: append([]string(nil), endpoints...),
+		owners:    make(map[uint64]string, len(endpoints)*sessionPartitionVirtualNodes),
+	}
+	sort.Strings(ring.endpoints)
+	for _, endpoint := range ring.endpoints {
+		for i := 0; i < sessionPartitionVirtualNodes; i++ {
+			point := xxhash.Sum64String(endpoint + "#" + strconv.Itoa(i))
+			if _, ok := ring.owners[point]; ok {
+				continue
+			}
+			ring.owners[point] = endpoint
+			ring.points = append(ring.points, point)
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring
+}
+
+// Get returns the endpoint of the instance which owns the key.
+func (ring *sessionHashRing) Get(key string) string {
+	if len(ring.points) == 0 {
+		return ""
+	}
+	h := xxhash.Sum64String(key)
+	i := sort.Search(len(ring.points), func(i int) bool { return ring.points[i] >= h })
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.owners[ring.points[i]]
+}
+
+// Equal returns true if both rings have the same instances.
+func (ring *sessionHashRing) Equal(other *sessionHashRing) bool {
+	if ring == nil || other == nil {
+		return ring == other
+	}
+	if len(ring.endpoints) != len(other.endpoints) {
+		return false
+	}
+	for i := range ring.endpoints {
+		if ring.endpoints[i] != other.endpoints[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// notify sends on a buffered channel without blocking.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
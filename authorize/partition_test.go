@@ -0,0 +1,165 @@
+package authorize
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/activity"
+	"github.com/pomerium/pomerium/internal/registry/inmemory"
+	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	registrypb "github.com/pomerium/pomerium/pkg/grpc/registry"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestSessionHashRing(t *testing.T) {
+	ring := newSessionHashRing([]string{"a", "b", "c"})
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		counts[ring.Get(strconv.Itoa(i))]++
+	}
+	for _, endpoint := range []string{"a", "b", "c"} {
+		assert.InDelta(t, 1000, counts[endpoint], 300, "sessions should be spread evenly")
+	}
+
+	smaller := newSessionHashRing([]string{"c", "a"})
+	for i := 0; i < 3000; i++ {
+		key := strconv.Itoa(i)
+		if owner := ring.Get(key); owner != "b" {
+			assert.Equal(t, owner, smaller.Get(key), "only the sessions of the removed instance should move")
+		}
+	}
+
+	assert.True(t, newSessionHashRing([]string{"a", "b"}).Equal(newSessionHashRing([]string{"b", "a"})))
+	assert.False(t, ring.Equal(smaller))
+	assert.False(t, ring.Equal(nil))
+	assert.Empty(t, newSessionHashRing(nil).Get("key"))
+}
+
+func TestSessionPartitioner(t *testing.T) {
+	p := newSessionPartitioner()
+	assert.True(t, p.Owns("SESSION_ID"), "every session should be owned without a ring")
+
+	p.setRing(newSessionHashRing([]string{p.endpoint, "other"}))
+	select {
+	case <-p.Changed():
+	default:
+		t.Fatal("expected a change notification")
+	}
+	p.setRing(newSessionHashRing([]string{"other", p.endpoint}))
+	select {
+	case <-p.Changed():
+		t.Fatal("unexpected change notification")
+	default:
+	}
+
+	var owned, unowned string
+	for i := 0; owned == "" || unowned == ""; i++ {
+		if id := strconv.Itoa(i); p.Owns(id) {
+			owned = id
+		} else {
+			unowned = id
+		}
+	}
+	assert.True(t, p.OwnsRecord(newRecord(&session.Session{Id: owned})))
+	assert.False(t, p.OwnsRecord(newRecord(&session.Session{Id: unowned})))
+	assert.False(t, p.OwnsRecord(newRecord(&user.ServiceAccount{Id: unowned})))
+	assert.True(t, p.OwnsRecord(newRecord(&user.User{Id: unowned})), "only sessions should be partitioned")
+	assert.False(t, p.OwnsRecord(&databroker.Record{Type: activity.SessionRecordType, Id: owned}),
+		"activity records shouldn't be synced")
+	assert.False(t, p.OwnsRecord(&databroker.Record{Type: activity.DecisionRecordType, Id: owned}),
+		"activity records shouldn't be synced")
+
+	deleted := newRecord(&session.Session{Id: unowned})
+	deleted.DeletedAt = timestamppb.Now()
+	assert.True(t, p.OwnsRecord(deleted), "deletions should always be synced")
+}
+
+func TestSessionPartitioner_Run(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	li := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	registrypb.RegisterRegistryServer(srv, inmemory.New(ctx, time.Second))
+	go func() { _ = srv.Serve(li) }()
+	defer srv.Stop()
+
+	cc, err := grpc.DialContext(ctx, "bufnet", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return li.Dial() }))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+	client := registrypb.NewRegistryClient(cc)
+
+	p1, p2 := newSessionPartitioner(), newSessionPartitioner()
+	for _, p := range []*sessionPartitioner{p1, p2} {
+		p := p
+		p.SetEnabled(true)
+		go func() { _ = p.Run(ctx, func() registrypb.RegistryClient { return client }) }()
+	}
+
+	expect := newSessionHashRing([]string{p1.endpoint, p2.endpoint})
+	assert.Eventually(t, func() bool {
+		return expect.Equal(p1.ring.Load().(*sessionHashRing)) && expect.Equal(p2.ring.Load().(*sessionHashRing))
+	}, 5*time.Second, 10*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		id := strconv.Itoa(i)
+		assert.NotEqual(t, p1.Owns(id), p2.Owns(id), "each session should be owned by exactly one instance")
+	}
+
+	p1.SetEnabled(false)
+	assert.Eventually(t, func() bool {
+		return p1.ring.Load().(*sessionHashRing) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, p1.Owns("SESSION_ID"))
+}
+
+func TestAuthorize_forceSyncUnownedSession(t *testing.T) {
+	a, err := New(&config.Config{Options: &config.Options{
+		AuthenticateURLString: "https://authN.example.com",
+		DataBrokerURLString:   "https://databroker.example.com",
+		SharedKey:             "gXK6ggrlIW2HyKyUF9rUO4azrDgxhDPWqw9y+lJU7B8=",
+		Policies:              testPolicies(t),
+	}})
+	require.NoError(t, err)
+	a.partitioner.setRing(newSessionHashRing([]string{"other"}))
+
+	s := &session.Session{Id: "SESSION_ID", UserId: "USER_ID"}
+	a.store.UpdateRecord(0, newRecord(&user.User{Id: "USER_ID"}))
+	a.state.Load().dataBrokerClient = mockDataBrokerServiceClient{
+		get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+			if in.GetType() == newRecord(s).GetType() && in.GetId() == s.GetId() {
+				return &databroker.GetResponse{Record: newRecord(s)}, nil
+			}
+			return nil, status.Error(codes.NotFound, "not found")
+		},
+	}
+
+	ctx, actual, u, err := a.forceSync(context.Background(), &sessions.State{ID: "SESSION_ID"})
+	require.NoError(t, err)
+	assert.Equal(t, "SESSION_ID", actual.(*session.Session).GetId())
+	assert.Equal(t, "USER_ID", u.GetId())
+	assert.Nil(t, a.store.GetRecordData(newRecord(s).GetType(), "SESSION_ID"), "unowned sessions should not be cached")
+
+	rs, err := rego.New(
+		rego.Query(`x = get_databroker_record("type.googleapis.com/session.Session", "SESSION_ID").user_id`),
+		a.store.GetDataBrokerRecordOption(),
+	).Eval(ctx)
+	require.NoError(t, err)
+	require.Len(t, rs, 1)
+	assert.Equal(t, "USER_ID", rs[0].Bindings["x"])
+}
@@ -0,0 +1,79 @@
+package authorize
+
+import (
+	"context"
+	"time"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// A policyBundleSyncer periodically fetches the policy bundle and activates it once its signature has been
+// verified. If fetching or verifying a bundle fails, the previously activated bundle stays active.
+type policyBundleSyncer struct {
+	authorize *Authorize
+	// cfg is the policy bundle config the active bundle was fetched with
+	cfg  *config.PolicyBundle
+	etag string
+}
+
+func newPolicyBundleSyncer(authorize *Authorize) *policyBundleSyncer {
+	return &policyBundleSyncer{
+		authorize: authorize,
+	}
+}
+
+// Run runs the syncer. The bundle is fetched again at the polling interval and whenever the config changes.
+func (syncer *policyBundleSyncer) Run(ctx context.Context) error {
+	for {
+		interval := syncer.sync(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-syncer.authorize.policyBundleConfigChanged:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// sync fetches and activates the policy bundle, returning how long to wait before fetching it again.
+func (syncer *policyBundleSyncer) sync(ctx context.Context) time.Duration {
+	cfg := syncer.authorize.currentOptions.Load().PolicyBundle
+	if cfg == nil {
+		if syncer.cfg != nil {
+			log.Info(ctx).Msg("authorize: policy bundle removed")
+			syncer.authorize.store.UpdatePolicyBundle(nil)
+			syncer.cfg, syncer.etag = nil, ""
+		}
+		return config.DefaultPolicyBundlePollingInterval
+	}
+
+	etag := syncer.etag
+	if syncer.cfg == nil || *syncer.cfg != *cfg {
+		etag = ""
+	}
+
+	b, etag, err := evaluator.FetchPolicyBundle(ctx, cfg, etag)
+	if err != nil {
+		log.Error(ctx).Err(err).Str("url", cfg.URL).Msg("authorize: error fetching policy bundle")
+		return cfg.GetPollingInterval()
+	} else if b == nil {
+		// not modified
+		return cfg.GetPollingInterval()
+	}
+
+	pe, err := evaluator.NewPolicyBundleEvaluator(ctx, syncer.authorize.store, b)
+	if err != nil {
+		log.Error(ctx).Err(err).Str("url", cfg.URL).Msg("authorize: error activating policy bundle")
+		return cfg.GetPollingInterval()
+	}
+
+	syncer.authorize.store.UpdatePolicyBundle(pe)
+	syncer.cfg, syncer.etag = cfg, etag
+	log.Info(ctx).
+		Str("url", cfg.URL).
+		Str("revision", b.Manifest.Revision).
+		Msg("authorize: activated policy bundle")
+	return cfg.GetPollingInterval()
+}
@@ -0,0 +1,51 @@
+package authorize
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+)
+
+func TestPolicyBundleSyncer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	o := &config.Options{
+		AuthenticateURLString: "https://authN.example.com",
+		DataBrokerURLString:   "https://databroker.example.com",
+		SharedKey:             "gXK6ggrlIW2HyKyUF9rUO4azrDgxhDPWqw9y+lJU7B8=",
+		Policies:              testPolicies(t),
+	}
+	a, err := New(&config.Config{Options: o})
+	require.NoError(t, err)
+
+	active := new(evaluator.PolicyEvaluator)
+	a.store.UpdatePolicyBundle(active)
+
+	syncer := newPolicyBundleSyncer(a)
+	syncer.cfg = &config.PolicyBundle{URL: srv.URL}
+
+	o.PolicyBundle = &config.PolicyBundle{
+		URL:              srv.URL,
+		PollingInterval:  10 * time.Second,
+		VerificationKey:  "c2VjcmV0",
+		SigningAlgorithm: "HS256",
+	}
+	a.currentOptions.Store(o)
+	assert.Equal(t, 10*time.Second, syncer.sync(context.Background()))
+	assert.Same(t, active, a.store.GetPolicyBundle(), "should keep the active bundle when fetching fails")
+
+	o.PolicyBundle = nil
+	assert.Equal(t, config.DefaultPolicyBundlePollingInterval, syncer.sync(context.Background()))
+	assert.Nil(t, a.store.GetPolicyBundle(), "should remove the bundle when it's no longer configured")
+}
@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"net/http/httptest"
 
-	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/encoding"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/sessions"
@@ -16,9 +15,9 @@ import (
 	"github.com/pomerium/pomerium/internal/urlutil"
 )
 
-func loadRawSession(req *http.Request, options *config.Options, encoder encoding.MarshalUnmarshaler) ([]byte, error) {
+func loadRawSession(req *http.Request, cookieOptions cookie.Options, encoder encoding.MarshalUnmarshaler) ([]byte, error) {
 	var loaders []sessions.SessionLoader
-	cookieStore, err := getCookieStore(options, encoder)
+	cookieStore, err := getCookieStore(cookieOptions, encoder)
 	if err != nil {
 		return nil, err
 	}
@@ -49,15 +48,21 @@ func loadSession(encoder encoding.MarshalUnmarshaler, rawJWT []byte) (*sessions.
 	return &s, nil
 }
 
-func getCookieStore(options *config.Options, encoder encoding.MarshalUnmarshaler) (sessions.SessionStore, error) {
+// validateServiceAccountToken returns an error if a service account token has expired or is restricted to an
+// audience other than host. Tokens without an audience are unrestricted.
+func validateServiceAccountToken(ss *sessions.State, host string) error {
+	if ss.IsExpired() {
+		return errors.New("service account token expired")
+	}
+	if len(ss.Audience) > 0 && !ss.Audience.Contains(host) {
+		return fmt.Errorf("service account token not valid for %s", host)
+	}
+	return nil
+}
+
+func getCookieStore(cookieOptions cookie.Options, encoder encoding.MarshalUnmarshaler) (sessions.SessionStore, error) {
 	cookieStore, err := cookie.NewStore(func() cookie.Options {
-		return cookie.Options{
-			Name:     options.CookieName,
-			Domain:   options.CookieDomain,
-			Secure:   options.CookieSecure,
-			HTTPOnly: options.CookieHTTPOnly,
-			Expire:   options.CookieExpire,
-		}
+		return cookieOptions
 	}, encoder)
 	if err != nil {
 		return nil, err
@@ -4,8 +4,10 @@ import (
 	"net/url"
 	"regexp"
 	"testing"
+	"time"
 
 	envoy_service_auth_v3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/pomerium/pomerium/config"
@@ -14,7 +16,7 @@ import (
 )
 
 func TestLoadSession(t *testing.T) {
-	opts := config.NewDefaultOptions()
+	opts := config.NewDefaultOptions().GetCookieOptions(nil)
 	encoder, err := jws.NewHS256Signer(nil)
 	if !assert.NoError(t, err) {
 		return
@@ -100,3 +102,23 @@ func TestLoadSession(t *testing.T) {
 		assert.NotNil(t, sess)
 	})
 }
+
+func TestValidateServiceAccountToken(t *testing.T) {
+	expired := jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	valid := jwt.NewNumericDate(time.Now().Add(time.Minute))
+
+	assert.NoError(t, validateServiceAccountToken(&sessions.State{}, "from.example.com"),
+		"should allow tokens without an audience")
+	assert.NoError(t, validateServiceAccountToken(&sessions.State{
+		Audience: jwt.Audience{"from.example.com"},
+		Expiry:   valid,
+	}, "from.example.com"))
+	assert.Error(t, validateServiceAccountToken(&sessions.State{
+		Audience: jwt.Audience{"other.example.com"},
+		Expiry:   valid,
+	}, "from.example.com"), "should reject tokens for other routes")
+	assert.Error(t, validateServiceAccountToken(&sessions.State{
+		Audience: jwt.Audience{"from.example.com"},
+		Expiry:   expired,
+	}, "from.example.com"), "should reject expired tokens")
+}
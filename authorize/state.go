@@ -11,6 +11,7 @@ import (
 	"github.com/pomerium/pomerium/internal/encoding/jws"
 	"github.com/pomerium/pomerium/pkg/grpc"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	registrypb "github.com/pomerium/pomerium/pkg/grpc/registry"
 	"github.com/pomerium/pomerium/pkg/protoutil"
 )
 
@@ -19,10 +20,17 @@ type authorizeState struct {
 	evaluator        *evaluator.Evaluator
 	encoder          encoding.MarshalUnmarshaler
 	dataBrokerClient databroker.DataBrokerServiceClient
+	registryClient   registrypb.RegistryClient
 	auditEncryptor   *protoutil.Encryptor
+
+	forwardAuthResponseHeaders []string
 }
 
-func newAuthorizeStateFromConfig(cfg *config.Config, store *evaluator.Store) (*authorizeState, error) {
+func newAuthorizeStateFromConfig(
+	cfg *config.Config,
+	store *evaluator.Store,
+	previousState *authorizeState,
+) (*authorizeState, error) {
 	if err := validateOptions(cfg.Options); err != nil {
 		return nil, fmt.Errorf("authorize: bad options: %w", err)
 	}
@@ -31,7 +39,11 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *evaluator.Store) (*a
 
 	var err error
 
-	state.evaluator, err = newPolicyEvaluator(cfg.Options, store)
+	var previousEvaluator *evaluator.Evaluator
+	if previousState != nil {
+		previousEvaluator = previousState.evaluator
+	}
+	state.evaluator, err = newPolicyEvaluator(cfg.Options, store, previousEvaluator)
 	if err != nil {
 		return nil, fmt.Errorf("authorize: failed to update policy with options: %w", err)
 	}
@@ -46,6 +58,8 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *evaluator.Store) (*a
 		return nil, err
 	}
 
+	state.forwardAuthResponseHeaders = cfg.Options.GetForwardAuthResponseHeaders()
+
 	sharedKey, err := cfg.Options.GetSharedKey()
 	if err != nil {
 		return nil, err
@@ -56,13 +70,27 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *evaluator.Store) (*a
 		return nil, err
 	}
 
+	clientCert, err := cfg.Options.GetGRPCClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+
 	cc, err := grpc.GetGRPCClientConn(context.Background(), "databroker", &grpc.Options{
 		Addrs:                   urls,
 		OverrideCertificateName: cfg.Options.OverrideCertificateName,
 		CA:                      cfg.Options.CA,
 		CAFile:                  cfg.Options.CAFile,
+		ClientCertificate:       clientCert,
+		SPIREAgentSocket:        cfg.Options.SPIREAgentSocket,
+		InternalCA:              cfg.Options.GetInternalCA(),
 		RequestTimeout:          cfg.Options.GRPCClientTimeout,
 		ClientDNSRoundRobin:     cfg.Options.GRPCClientDNSRoundRobin,
+		PoolSize:                cfg.Options.GRPCClientPoolSize,
+		KeepaliveTime:           cfg.Options.GRPCClientKeepaliveTime,
+		KeepaliveTimeout:        cfg.Options.GRPCClientKeepaliveTimeout,
+		BackoffMaxDelay:         cfg.Options.GRPCClientBackoffMaxDelay,
+		CircuitBreakerThreshold: cfg.Options.GRPCClientCircuitBreakerThreshold,
+		CircuitBreakerTimeout:   cfg.Options.GRPCClientCircuitBreakerTimeout,
 		WithInsecure:            cfg.Options.GetGRPCInsecure(),
 		InstallationID:          cfg.Options.InstallationID,
 		ServiceName:             cfg.Options.Services,
@@ -72,6 +100,7 @@ func newAuthorizeStateFromConfig(cfg *config.Config, store *evaluator.Store) (*a
 		return nil, fmt.Errorf("authorize: error creating databroker connection: %w", err)
 	}
 	state.dataBrokerClient = databroker.NewDataBrokerServiceClient(cc)
+	state.registryClient = registrypb.NewRegistryClient(cc)
 
 	auditKey, err := cfg.Options.GetAuditKey()
 	if err != nil {
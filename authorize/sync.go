@@ -11,8 +11,10 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/pomerium/pomerium/authorize/evaluator"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/sessions"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
@@ -29,17 +31,34 @@ type sessionOrServiceAccount interface {
 }
 
 type dataBrokerSyncer struct {
-	*databroker.Syncer
 	authorize  *Authorize
 	signalOnce sync.Once
 }
 
 func newDataBrokerSyncer(authorize *Authorize) *dataBrokerSyncer {
-	syncer := &dataBrokerSyncer{
+	return &dataBrokerSyncer{
 		authorize: authorize,
 	}
-	syncer.Syncer = databroker.NewSyncer("authorize", syncer)
-	return syncer
+}
+
+// Run runs the syncer. When the sessions owned by this instance change, the records are synced again.
+func (syncer *dataBrokerSyncer) Run(ctx context.Context) error {
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-runCtx.Done():
+			case <-syncer.authorize.partitioner.Changed():
+				log.Info(ctx).Msg("authorize: session partitions changed, re-syncing")
+				cancel()
+			}
+		}()
+		err := databroker.NewSyncer("authorize", syncer).Run(runCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return err
+		}
+	}
 }
 
 func (syncer *dataBrokerSyncer) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
@@ -55,6 +74,9 @@ func (syncer *dataBrokerSyncer) ClearRecords(ctx context.Context) {
 func (syncer *dataBrokerSyncer) UpdateRecords(ctx context.Context, serverVersion uint64, records []*databroker.Record) {
 	syncer.authorize.stateLock.Lock()
 	for _, record := range records {
+		if !syncer.authorize.partitioner.OwnsRecord(record) {
+			continue
+		}
 		syncer.authorize.store.UpdateRecord(serverVersion, record)
 	}
 	syncer.authorize.stateLock.Unlock()
@@ -65,18 +87,44 @@ func (syncer *dataBrokerSyncer) UpdateRecords(ctx context.Context, serverVersion
 	})
 }
 
-func (a *Authorize) forceSync(ctx context.Context, ss *sessions.State) (sessionOrServiceAccount, *user.User, error) {
-	ctx, span := trace.StartSpan(ctx, "authorize.forceSync")
-	defer span.End()
+// forceSync returns the session and user for the session state. Sessions owned by another instance aren't
+// synced, so they're retrieved from the databroker and added to the returned context for evaluation.
+func (a *Authorize) forceSync(ctx context.Context, ss *sessions.State) (context.Context, sessionOrServiceAccount, *user.User, error) {
 	if ss == nil {
-		return nil, nil, nil
+		return ctx, nil, nil, nil
 	}
-	s := a.forceSyncSession(ctx, ss.ID)
+	if a.currentOptions.Load().StatelessSessions && len(ss.StatelessSession) > 0 {
+		return getStatelessSession(ctx, ss)
+	}
+
+	spanCtx, span := trace.StartSpan(ctx, "authorize.forceSync")
+	defer span.End()
+
+	s := a.forceSyncSession(spanCtx, ss.ID)
 	if s == nil {
-		return nil, nil, errors.New("session not found")
+		return ctx, nil, nil, errors.New("session not found")
+	}
+	if msg, ok := s.(proto.Message); ok && !a.partitioner.Owns(ss.ID) {
+		ctx = evaluator.WithRecordData(ctx, grpcutil.GetTypeURL(msg), ss.ID, msg)
+	}
+	u := a.forceSyncUser(spanCtx, s.GetUserId())
+	return ctx, s, u, nil
+}
+
+// getStatelessSession returns the session and user stored in the session state of a stateless session. They
+// aren't in the databroker, so they're added to the returned context for evaluation.
+func getStatelessSession(ctx context.Context, ss *sessions.State) (context.Context, sessionOrServiceAccount, *user.User, error) {
+	s, u := new(session.Session), new(user.User)
+	if _, err := ss.GetStateless(s, u); err != nil {
+		return ctx, nil, nil, err
+	}
+	if ss.IsExpired() || s.GetExpiresAt().AsTime().Before(time.Now()) {
+		return ctx, nil, nil, errors.New("session expired")
 	}
-	u := a.forceSyncUser(ctx, s.GetUserId())
-	return s, u, nil
+
+	ctx = evaluator.WithRecordData(ctx, grpcutil.GetTypeURL(s), s.GetId(), s)
+	ctx = evaluator.WithRecordData(ctx, grpcutil.GetTypeURL(u), u.GetId(), u)
+	return ctx, s, u, nil
 }
 
 func (a *Authorize) forceSyncSession(ctx context.Context, sessionID string) sessionOrServiceAccount {
@@ -88,13 +136,20 @@ func (a *Authorize) forceSyncSession(ctx context.Context, sessionID string) sess
 
 	s, ok := a.store.GetRecordData(grpcutil.GetTypeURL(new(session.Session)), sessionID).(*session.Session)
 	if ok {
+		metrics.RecordAuthorizeRecordCacheLookup(ctx, "session", true)
 		return s
 	}
 
 	sa, ok := a.store.GetRecordData(grpcutil.GetTypeURL(new(user.ServiceAccount)), sessionID).(*user.ServiceAccount)
 	if ok {
+		metrics.RecordAuthorizeRecordCacheLookup(ctx, "session", true)
 		return sa
 	}
+	metrics.RecordAuthorizeRecordCacheLookup(ctx, "session", false)
+
+	if !a.partitioner.Owns(sessionID) {
+		return a.getUnownedSession(ctx, sessionID)
+	}
 
 	// wait for the session to show up
 	record, err := a.waitForRecordSync(ctx, grpcutil.GetTypeURL(new(session.Session)), sessionID)
@@ -108,6 +163,29 @@ func (a *Authorize) forceSyncSession(ctx context.Context, sessionID string) sess
 	return s
 }
 
+// getUnownedSession retrieves a session, or service account, owned by another instance from the databroker.
+func (a *Authorize) getUnownedSession(ctx context.Context, sessionID string) sessionOrServiceAccount {
+	for _, s := range []sessionOrServiceAccount{new(session.Session), new(user.ServiceAccount)} {
+		msg := s.(proto.Message)
+		res, err := a.state.Load().dataBrokerClient.Get(ctx, &databroker.GetRequest{
+			Type: grpcutil.GetTypeURL(msg),
+			Id:   sessionID,
+		})
+		if status.Code(err) == codes.NotFound {
+			continue
+		} else if err != nil {
+			log.Error(ctx).Err(err).Str("id", sessionID).Msg("authorize: error retrieving session")
+			return nil
+		}
+		if err := res.GetRecord().GetData().UnmarshalTo(msg); err != nil {
+			log.Error(ctx).Err(err).Str("id", sessionID).Msg("authorize: invalid session record")
+			return nil
+		}
+		return s
+	}
+	return nil
+}
+
 func (a *Authorize) forceSyncUser(ctx context.Context, userID string) *user.User {
 	ctx, span := trace.StartSpan(ctx, "authorize.forceSyncUser")
 	defer span.End()
@@ -117,8 +195,10 @@ func (a *Authorize) forceSyncUser(ctx context.Context, userID string) *user.User
 
 	u, ok := a.store.GetRecordData(grpcutil.GetTypeURL(new(user.User)), userID).(*user.User)
 	if ok {
+		metrics.RecordAuthorizeRecordCacheLookup(ctx, "user", true)
 		return u
 	}
+	metrics.RecordAuthorizeRecordCacheLookup(ctx, "user", false)
 
 	// wait for the user to show up
 	record, err := a.waitForRecordSync(ctx, grpcutil.GetTypeURL(new(user.User)), userID)
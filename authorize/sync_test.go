@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/open-policy-agent/opa/rego"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
@@ -12,10 +13,13 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
 	"github.com/pomerium/pomerium/pkg/grpcutil"
 )
 
@@ -114,3 +118,55 @@ func newRecord(msg storableMessage) *databroker.Record {
 		Data:    any,
 	}
 }
+
+func TestAuthorize_forceSyncStatelessSession(t *testing.T) {
+	o := &config.Options{
+		AuthenticateURLString: "https://authN.example.com",
+		DataBrokerURLString:   "https://databroker.example.com",
+		SharedKey:             "gXK6ggrlIW2HyKyUF9rUO4azrDgxhDPWqw9y+lJU7B8=",
+		Policies:              testPolicies(t),
+		StatelessSessions:     true,
+	}
+	a, err := New(&config.Config{Options: o})
+	require.NoError(t, err)
+	a.currentOptions.Store(o)
+	a.state.Load().dataBrokerClient = mockDataBrokerServiceClient{
+		get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+			t.Error("stateless sessions should not be retrieved from the databroker")
+			return nil, status.Error(codes.NotFound, "not found")
+		},
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		ss := &sessions.State{ID: "SESSION_ID"}
+		require.NoError(t, ss.SetStateless(&session.Session{
+			Id:        "SESSION_ID",
+			UserId:    "USER_ID",
+			ExpiresAt: timestamppb.New(time.Now().Add(time.Hour)),
+		}, &user.User{Id: "USER_ID", Email: "user@example.com"}))
+
+		ctx, s, u, err := a.forceSync(context.Background(), ss)
+		require.NoError(t, err)
+		assert.Equal(t, "USER_ID", s.GetUserId())
+		assert.Equal(t, "user@example.com", u.GetEmail())
+
+		rs, err := rego.New(
+			rego.Query(`x = get_databroker_record("type.googleapis.com/user.User", "USER_ID").email`),
+			a.store.GetDataBrokerRecordOption(),
+		).Eval(ctx)
+		require.NoError(t, err)
+		require.Len(t, rs, 1)
+		assert.Equal(t, "user@example.com", rs[0].Bindings["x"])
+	})
+	t.Run("expired", func(t *testing.T) {
+		ss := &sessions.State{ID: "SESSION_ID"}
+		require.NoError(t, ss.SetStateless(&session.Session{
+			Id:        "SESSION_ID",
+			UserId:    "USER_ID",
+			ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour)),
+		}, &user.User{Id: "USER_ID"}))
+
+		_, _, _, err := a.forceSync(context.Background(), ss)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pomerium/pomerium/internal/admintoken"
+)
+
+var adminTokenCmdOptions struct {
+	expiresIn time.Duration
+}
+
+func init() {
+	flags := adminTokenCmd.Flags()
+	flags.DurationVar(&adminTokenCmdOptions.expiresIn, "expires-in", time.Hour,
+		"how long the token is valid for")
+	rootCmd.AddCommand(adminTokenCmd)
+}
+
+var adminTokenCmd = &cobra.Command{
+	Use:   "admin-token SUBJECT",
+	Short: "create an admin api token",
+	Long: `Create a bearer token for the admin API, which is valid until it expires. The token is signed with a key
+derived from the shared secret in the SHARED_SECRET environment variable. The subject identifies the holder of
+the token.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if adminTokenCmdOptions.expiresIn <= 0 {
+			return fmt.Errorf("invalid expires-in: %s", adminTokenCmdOptions.expiresIn)
+		}
+
+		sharedKey, err := base64.StdEncoding.DecodeString(os.Getenv("SHARED_SECRET"))
+		if err != nil || len(sharedKey) == 0 {
+			return fmt.Errorf("SHARED_SECRET must be set to the base64-encoded shared secret")
+		}
+
+		token, err := admintoken.Sign(sharedKey, args[0], time.Now().Add(adminTokenCmdOptions.expiresIn))
+		if err != nil {
+			return err
+		}
+		fmt.Println(token)
+		return nil
+	},
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var shareCmdOptions struct {
+	expiresIn   time.Duration
+	pomeriumURL string
+}
+
+func init() {
+	addTLSFlags(shareCmd)
+	flags := shareCmd.Flags()
+	flags.DurationVar(&shareCmdOptions.expiresIn, "expires-in", time.Hour,
+		"how long the shared url is valid for")
+	flags.StringVar(&shareCmdOptions.pomeriumURL, "pomerium-url", "",
+		"the URL of the pomerium server to create the shared url with, defaults to the url's origin")
+	rootCmd.AddCommand(shareCmd)
+}
+
+var shareCmd = &cobra.Command{
+	Use:   "share URL",
+	Short: "share a url",
+	Long: `Create a signed url which is valid without signing in until it expires, for sharing a download or dashboard
+with an external party. The url is created with the admin API, using the admin token in the POMERIUM_ADMIN_TOKEN
+environment variable, so that pomerium checks that the url belongs to a route.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		u, err := url.Parse(args[0])
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid url: %s", args[0])
+		}
+		if shareCmdOptions.expiresIn <= 0 {
+			return fmt.Errorf("invalid expires-in: %s", shareCmdOptions.expiresIn)
+		}
+
+		token := os.Getenv("POMERIUM_ADMIN_TOKEN")
+		if token == "" {
+			return fmt.Errorf("POMERIUM_ADMIN_TOKEN must be set to an admin token")
+		}
+
+		pomeriumURL := &url.URL{Scheme: u.Scheme, Host: u.Host}
+		if shareCmdOptions.pomeriumURL != "" {
+			pomeriumURL, err = url.Parse(shareCmdOptions.pomeriumURL)
+			if err != nil || pomeriumURL.Host == "" {
+				return fmt.Errorf("invalid pomerium URL: %s", shareCmdOptions.pomeriumURL)
+			}
+		}
+
+		sharedURL, err := createSharedURL(pomeriumURL, token, u, time.Now().Add(shareCmdOptions.expiresIn))
+		if err != nil {
+			return err
+		}
+		fmt.Println(sharedURL)
+		return nil
+	},
+}
+
+// createSharedURL creates a shared url with the admin API.
+func createSharedURL(pomeriumURL *url.URL, token string, u *url.URL, expiresAt time.Time) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"url":        u.String(),
+		"expires_at": expiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := pomeriumURL.ResolveReference(&url.URL{Path: "/.pomerium/admin/shared_urls"})
+	req, err := http.NewRequest(http.MethodPost, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: getTLSConfig()},
+		Timeout:   30 * time.Second,
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error creating shared url: %w", err)
+	}
+	defer res.Body.Close()
+
+	bs, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading shared url response: %w", err)
+	}
+	if res.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("error creating shared url: %s: %s", res.Status, bytes.TrimSpace(bs))
+	}
+
+	var created struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(bs, &created); err != nil || created.URL == "" {
+		return "", fmt.Errorf("invalid shared url response: %s", bytes.TrimSpace(bs))
+	}
+	return created.URL, nil
+}
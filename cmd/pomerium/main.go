@@ -5,6 +5,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/pomerium/pomerium/internal/cmd/pomerium"
 	"github.com/pomerium/pomerium/internal/envoy/files"
@@ -18,6 +19,19 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "routes" {
+		os.Exit(routes(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "dev-idp" {
+		os.Exit(devIDP(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "test-policies" {
+		os.Exit(testPolicies(os.Args[2:]))
+	}
+
 	flag.Parse()
 	if *versionFlag {
 		fmt.Println("pomerium:", version.FullVersion())
@@ -35,3 +49,95 @@ func main() {
 func run(ctx context.Context) error {
 	return pomerium.Run(ctx, *configFile)
 }
+
+// validate runs the validate subcommand, which checks the config without starting pomerium, and returns
+// the exit code.
+func validate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configFile := fs.String("config", "", "Specify configuration file location")
+	_ = fs.Parse(args)
+
+	if err := pomerium.Validate(context.Background(), *configFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println("config is valid")
+	return 0
+}
+
+// routes runs the routes subcommand, which exports or imports the routes of the config, and returns the exit
+// code.
+func routes(args []string) int {
+	usage := "usage: pomerium routes export|import [flags]"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("routes "+args[0], flag.ExitOnError)
+	configFile := fs.String("config", "", "Specify configuration file location")
+	switch args[0] {
+	case "export":
+		_ = fs.Parse(args[1:])
+		if err := pomerium.ExportRoutes(context.Background(), *configFile, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	case "import":
+		routesFile := fs.String("file", "", "The JSON or YAML file of the routes to import")
+		outputFile := fs.String("output", "", "The file the validated routes are written to, e.g. in the policy directory")
+		_ = fs.Parse(args[1:])
+		if *routesFile == "" {
+			fmt.Fprintln(os.Stderr, "-file is required")
+			return 2
+		}
+		if err := pomerium.ImportRoutes(context.Background(), *configFile, *routesFile, *outputFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if *outputFile == "" {
+			fmt.Println("routes are valid")
+		} else {
+			fmt.Println("routes imported to", *outputFile)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	return 0
+}
+
+// devIDP runs the dev-idp subcommand, which runs a local OpenID Connect provider for development, and returns
+// the exit code.
+func devIDP(args []string) int {
+	fs := flag.NewFlagSet("dev-idp", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8024", "The address the identity provider listens on")
+	usersFile := fs.String("users", "", "The JSON or YAML file of the users and client of the identity provider")
+	_ = fs.Parse(args)
+
+	if err := pomerium.RunDevIDP(context.Background(), *addr, *usersFile, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// testPolicies runs the test-policies subcommand, which runs policy tests against the routes of the config and
+// reports their rego coverage, and returns the exit code.
+func testPolicies(args []string) int {
+	fs := flag.NewFlagSet("test-policies", flag.ExitOnError)
+	configFile := fs.String("config", "", "Specify configuration file location")
+	testsFile := fs.String("tests", "", "The JSON or YAML file of the policy tests")
+	threshold := fs.Float64("coverage-threshold", 0, "The minimum rego coverage, in percent, of each tested sub policy")
+	_ = fs.Parse(args)
+	if *testsFile == "" {
+		fmt.Fprintln(os.Stderr, "-tests is required")
+		return 2
+	}
+
+	if err := pomerium.RunPolicyTests(context.Background(), *configFile, *testsFile, *threshold, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
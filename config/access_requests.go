@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// DefaultAccessRequestMaxDuration is the longest access may be granted for by default.
+const DefaultAccessRequestMaxDuration = 24 * time.Hour
+
+// AccessRequests lets users who are denied access to a route request it. Requests are sent to the
+// approvers, who grant time-limited access with the admin API.
+type AccessRequests struct {
+	// Approvers are the email addresses notified of access requests. Emails are sent with the smtp settings.
+	Approvers []string `mapstructure:"approvers" yaml:"approvers,omitempty" json:"approvers,omitempty"`
+	// WebhookURL is sent each access request with a JSON POST request.
+	WebhookURL string `mapstructure:"webhook_url" yaml:"webhook_url,omitempty" json:"webhook_url,omitempty"`
+	// MaxDuration is the longest access may be granted for. Defaults to 24 hours.
+	MaxDuration time.Duration `mapstructure:"max_duration" yaml:"max_duration,omitempty" json:"max_duration,omitempty"`
+}
+
+// GetMaxDuration returns the longest access may be granted for, which defaults to 24 hours.
+func (ar *AccessRequests) GetMaxDuration() time.Duration {
+	if ar.MaxDuration <= 0 {
+		return DefaultAccessRequestMaxDuration
+	}
+	return ar.MaxDuration
+}
+
+func (ar *AccessRequests) validate() error {
+	for _, approver := range ar.Approvers {
+		if !strings.Contains(approver, "@") {
+			return fmt.Errorf("invalid approver email: %q", approver)
+		}
+	}
+	if ar.WebhookURL != "" {
+		u, err := urlutil.ParseAndValidateURL(ar.WebhookURL)
+		if err != nil {
+			return fmt.Errorf("invalid webhook_url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("unsupported webhook_url scheme: %s", u.Scheme)
+		}
+	}
+	if ar.MaxDuration < 0 {
+		return errors.New("max_duration must not be negative")
+	}
+	return nil
+}
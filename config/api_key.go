@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultAPIKeyHeader is the default request header which contains an API key.
+const DefaultAPIKeyHeader = "X-Pomerium-Api-Key"
+
+// APIKey configures a route to accept the static API keys which are valid for it, for clients which can't sign
+// in, such as webhooks and monitoring probes. Keys are managed with the admin API.
+type APIKey struct {
+	// Header is the request header which contains the API key. It defaults to X-Pomerium-Api-Key.
+	Header string `mapstructure:"header" yaml:"header,omitempty" json:"header,omitempty"`
+}
+
+func (k *APIKey) validate() error {
+	if k.Header != "" && (strings.ContainsAny(k.Header, " :\r\n") || strings.EqualFold(k.Header, "Authorization")) {
+		return fmt.Errorf("invalid header: %q", k.Header)
+	}
+	return nil
+}
+
+// GetHeader returns the request header which contains the API key.
+func (k *APIKey) GetHeader() string {
+	if k.Header == "" {
+		return DefaultAPIKeyHeader
+	}
+	return http.CanonicalHeaderKey(k.Header)
+}
@@ -0,0 +1,12 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKey_GetHeader(t *testing.T) {
+	assert.Equal(t, "X-Pomerium-Api-Key", (&APIKey{}).GetHeader())
+	assert.Equal(t, "X-Webhook-Token", (&APIKey{Header: "x-webhook-token"}).GetHeader())
+}
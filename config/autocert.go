@@ -1,5 +1,7 @@
 package config
 
+import "fmt"
+
 // AutocertOptions contains the options to control the behavior of autocert.
 type AutocertOptions struct {
 	// Enable enables fully automated certificate management including issuance
@@ -23,4 +25,32 @@ type AutocertOptions struct {
 	// TLS certificates.
 	// defaults to $XDG_DATA_HOME/pomerium
 	Folder string `mapstructure:"autocert_dir" yaml:"autocert_dir,omitempty"`
+
+	// Storage specifies where autocert managed TLS certificates are stored. Either
+	// "file" (the default), which uses Folder, or "databroker", which shares the
+	// certificates with all the pomerium instances using the same databroker.
+	Storage string `mapstructure:"autocert_storage" yaml:"autocert_storage,omitempty"`
+}
+
+// Autocert storage types.
+const (
+	AutocertStorageFile       = "file"
+	AutocertStorageDataBroker = "databroker"
+)
+
+// ValidateAutocertStorage validates the autocert storage type.
+func ValidateAutocertStorage(value string, services string) error {
+	switch value {
+	case "", AutocertStorageFile:
+		return nil
+	case AutocertStorageDataBroker:
+		// certificates are obtained on startup, before the databroker service is running
+		if IsDataBroker(services) {
+			return fmt.Errorf("autocert_storage %s requires a separately deployed databroker service", value)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown autocert_storage: %s, known storage types are: %s, %s",
+		value, AutocertStorageFile, AutocertStorageDataBroker)
 }
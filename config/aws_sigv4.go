@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AWSSigV4 configures signing upstream requests with AWS Signature Version 4, so that AWS services which
+// require IAM authentication can be proxied. Credentials are loaded from the environment, a web identity
+// token (IRSA), the ECS container credentials endpoint or the EC2 instance metadata service.
+type AWSSigV4 struct {
+	// Service is the signing name of the service, e.g. execute-api, es or s3.
+	Service string `mapstructure:"service" yaml:"service" json:"service"`
+	// Region is the AWS region of the service, e.g. us-east-1.
+	Region string `mapstructure:"region" yaml:"region" json:"region"`
+}
+
+// SignsPayload returns true if the request body is part of the signature, which requires the body to be
+// buffered. Requests to S3 are signed with an unsigned payload instead.
+func (s *AWSSigV4) SignsPayload() bool {
+	return s.Service != "s3"
+}
+
+// GetUpstreamHost returns the host of the upstream request for the policy, which is part of the signature.
+func (s *AWSSigV4) GetUpstreamHost(p *Policy, requestHost string) string {
+	switch {
+	case p.HostRewrite != "":
+		return p.HostRewrite
+	case p.PreserveHostHeader || len(p.To) == 0:
+		return requestHost
+	default:
+		// envoy rewrites the host to the hostname of the upstream endpoint, which doesn't include the port
+		return p.To[0].URL.Hostname()
+	}
+}
+
+func (s *AWSSigV4) validate(p *Policy) error {
+	if s.Service == "" {
+		return errors.New("service is required")
+	}
+	if s.Region == "" {
+		return errors.New("region is required")
+	}
+
+	// the signature covers the host and path of the upstream request, so they must be known in advance
+	for i, u := range p.To {
+		if u.URL.Host != p.To[0].URL.Host {
+			return errors.New("all `to` urls must have the same host")
+		}
+		if u.URL.Path != "" && u.URL.Path != "/" {
+			return fmt.Errorf("`to` url %d must not have a path", i)
+		}
+	}
+	if p.PrefixRewrite != "" || p.RegexRewritePattern != "" {
+		return errors.New("path rewriting is not supported")
+	}
+	if p.HostRewriteHeader != "" || p.HostPathRegexRewritePattern != "" {
+		return errors.New("host rewriting from the request is not supported")
+	}
+
+	// these also set the authorization header
+	if p.IsForKubernetes() {
+		return errors.New("not supported with a kubernetes service account token")
+	}
+	if p.EnableGoogleCloudServerlessAuthentication {
+		return errors.New("not supported with google cloud serverless authentication")
+	}
+	if p.TokenExchange != nil && p.TokenExchange.GetHeader() == "Authorization" {
+		return errors.New("not supported with a token exchange which sets the authorization header")
+	}
+	return nil
+}
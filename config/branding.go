@@ -0,0 +1,128 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/pomerium/pomerium/internal/frontend"
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+var brandingColorRegexp = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// Branding customizes the pages served by pomerium, such as the user info and error pages.
+type Branding struct {
+	// LogoURL is the URL of the logo, which may be a data URL.
+	LogoURL string `mapstructure:"logo_url" yaml:"logo_url,omitempty" json:"logo_url,omitempty"`
+	// FaviconURL is the URL of the favicon, which may be a data URL.
+	FaviconURL string `mapstructure:"favicon_url" yaml:"favicon_url,omitempty" json:"favicon_url,omitempty"`
+	// PrimaryColor is the hex color of links and buttons.
+	PrimaryColor string `mapstructure:"primary_color" yaml:"primary_color,omitempty" json:"primary_color,omitempty"`
+	// BackgroundColor is the hex color of the page background.
+	BackgroundColor string `mapstructure:"background_color" yaml:"background_color,omitempty" json:"background_color,omitempty"`
+	// FooterLinks replace the links in the footer.
+	FooterLinks []BrandingLink `mapstructure:"footer_links" yaml:"footer_links,omitempty" json:"footer_links,omitempty"`
+	// TemplatesDirectory is a directory of templates which override the built-in templates of the same name.
+	TemplatesDirectory string `mapstructure:"templates_directory" yaml:"templates_directory,omitempty" json:"templates_directory,omitempty"`
+}
+
+// A BrandingLink is a link in the footer of pages.
+type BrandingLink struct {
+	Title string `mapstructure:"title" yaml:"title" json:"title"`
+	URL   string `mapstructure:"url" yaml:"url" json:"url"`
+}
+
+// GetTheme returns the frontend theme of the branding.
+func (b *Branding) GetTheme() *frontend.Theme {
+	if b == nil {
+		return nil
+	}
+
+	theme := &frontend.Theme{
+		LogoURL:            b.LogoURL,
+		FaviconURL:         b.FaviconURL,
+		PrimaryColor:       b.PrimaryColor,
+		BackgroundColor:    b.BackgroundColor,
+		TemplatesDirectory: b.TemplatesDirectory,
+	}
+	for _, link := range b.FooterLinks {
+		theme.FooterLinks = append(theme.FooterLinks, frontend.Link{Title: link.Title, URL: link.URL})
+	}
+	return theme
+}
+
+func (b *Branding) validate() error {
+	for _, u := range []struct {
+		name  string
+		value string
+	}{
+		{"logo_url", b.LogoURL},
+		{"favicon_url", b.FaviconURL},
+	} {
+		if u.value != "" && !isBrandingURL(u.value, "http", "https", "data") {
+			return fmt.Errorf("invalid %s: must be an http, https or data URL", u.name)
+		}
+	}
+	for _, c := range []struct {
+		name  string
+		value string
+	}{
+		{"primary_color", b.PrimaryColor},
+		{"background_color", b.BackgroundColor},
+	} {
+		if c.value != "" && !brandingColorRegexp.MatchString(c.value) {
+			return fmt.Errorf("invalid %s: must be a hex color, such as #6e43e8", c.name)
+		}
+	}
+	for _, link := range b.FooterLinks {
+		if link.Title == "" {
+			return errors.New("footer links must have a title")
+		}
+		if !isBrandingURL(link.URL, "http", "https", "mailto") {
+			return fmt.Errorf("invalid footer link url %q: must be an http, https or mailto URL", link.URL)
+		}
+	}
+	// the templates are loaded to report errors in the templates directory
+	if _, err := frontend.NewThemedTemplates(b.GetTheme()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func isBrandingURL(rawURL string, schemes ...string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// The BrandingManager sets the theme of the frontend templates based on options.
+type BrandingManager struct{}
+
+// NewBrandingManager creates a new BrandingManager.
+func NewBrandingManager(ctx context.Context, src Source) *BrandingManager {
+	mgr := &BrandingManager{}
+	src.OnConfigChange(ctx, mgr.OnConfigChange)
+	mgr.OnConfigChange(ctx, src.GetConfig())
+	return mgr
+}
+
+// OnConfigChange is called whenever configuration changes.
+func (mgr *BrandingManager) OnConfigChange(ctx context.Context, cfg *Config) {
+	if cfg == nil || cfg.Options == nil {
+		return
+	}
+
+	if err := frontend.SetTheme(cfg.Options.Branding.GetTheme()); err != nil {
+		log.Error(ctx).Err(err).Msg("config: failed to update branding")
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/frontend"
+)
+
+func TestBranding_Validate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.html"), []byte(`{{define "error.html"}}`), 0o600))
+
+	for _, tc := range []struct {
+		name     string
+		branding Branding
+		wantErr  bool
+	}{
+		{"good", Branding{
+			LogoURL:         "https://example.com/logo.png",
+			FaviconURL:      "data:image/png;base64,AAAA",
+			PrimaryColor:    "#6e43e8",
+			BackgroundColor: "#fff",
+			FooterLinks:     []BrandingLink{{Title: "Help", URL: "mailto:help@example.com"}},
+		}, false},
+		{"bad logo url", Branding{LogoURL: "javascript:alert(1)"}, true},
+		{"bad color", Branding{PrimaryColor: "red; background: url(x)"}, true},
+		{"bad footer link title", Branding{FooterLinks: []BrandingLink{{URL: "https://example.com"}}}, true},
+		{"bad footer link url", Branding{FooterLinks: []BrandingLink{{Title: "Help", URL: "/help"}}}, true},
+		{"bad templates directory", Branding{TemplatesDirectory: dir}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.branding.validate()
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBrandingManager(t *testing.T) {
+	defer func() { _ = frontend.SetTheme(nil) }()
+
+	options := NewDefaultOptions()
+	options.Branding = &Branding{
+		FooterLinks: []BrandingLink{{Title: "Help", URL: "https://help.example.com"}},
+	}
+	NewBrandingManager(context.Background(), NewStaticSource(&Config{Options: options}))
+
+	var buf bytes.Buffer
+	err := frontend.Templates().ExecuteTemplate(&buf, "footer.html", nil)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `<a href="https://help.example.com">Help</a>`)
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultCacheMaxBodySize is the default maximum size of cached response bodies.
+const DefaultCacheMaxBodySize = 1024 * 1024
+
+// Cache configures caching the responses of a route. Only responses which are cacheable according to their
+// Cache-Control header are cached.
+type Cache struct {
+	// MaxBodySize is the maximum size of response bodies which are cached, in bytes. Defaults to 1MiB.
+	MaxBodySize uint32 `mapstructure:"max_body_size" yaml:"max_body_size,omitempty" json:"max_body_size,omitempty"`
+	// TTL, if set, is the maximum time responses are cached for.
+	TTL time.Duration `mapstructure:"ttl" yaml:"ttl,omitempty" json:"ttl,omitempty"`
+}
+
+// GetMaxBodySize returns the maximum body size, or the default of 1MiB.
+func (c *Cache) GetMaxBodySize() uint32 {
+	if c.MaxBodySize == 0 {
+		return DefaultCacheMaxBodySize
+	}
+	return c.MaxBodySize
+}
+
+func (c *Cache) validate() error {
+	if c.TTL < 0 {
+		return errors.New("ttl must not be negative")
+	}
+	// the ttl is sent in the cache-control header, which is in seconds
+	if c.TTL != 0 && c.TTL < time.Second {
+		return errors.New("ttl must be at least a second")
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pomerium/pomerium/internal/identity"
+)
+
+// A ClaimTransform transforms the identity provider claims of sessions and the claims of the JWT assertion, so
+// that claims from identity providers with different claim shapes have the shape upstreams expect. Each
+// transform has exactly one of Rename, Concatenate, RegexExtract, Lowercase or Default. Nested claims are
+// separated by a ".".
+type ClaimTransform struct {
+	// Rename renames a claim to To.
+	Rename string `mapstructure:"rename" yaml:"rename,omitempty" json:"rename,omitempty"`
+	// Concatenate joins the values of claims with Separator into To.
+	Concatenate []string `mapstructure:"concatenate" yaml:"concatenate,omitempty" json:"concatenate,omitempty"`
+	// RegexExtract sets To to the first submatch of Pattern in a claim, or the whole match if Pattern has no
+	// submatches.
+	RegexExtract string `mapstructure:"regex_extract" yaml:"regex_extract,omitempty" json:"regex_extract,omitempty"`
+	// Lowercase lowercases a claim.
+	Lowercase string `mapstructure:"lowercase" yaml:"lowercase,omitempty" json:"lowercase,omitempty"`
+	// Default sets a claim to Value when it's missing.
+	Default string `mapstructure:"default" yaml:"default,omitempty" json:"default,omitempty"`
+
+	To        string `mapstructure:"to" yaml:"to,omitempty" json:"to,omitempty"`
+	Separator string `mapstructure:"separator" yaml:"separator,omitempty" json:"separator,omitempty"`
+	Pattern   string `mapstructure:"pattern" yaml:"pattern,omitempty" json:"pattern,omitempty"`
+	Value     string `mapstructure:"value" yaml:"value,omitempty" json:"value,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+func (t *ClaimTransform) validate() error {
+	n := 0
+	for _, set := range []bool{t.Rename != "", len(t.Concatenate) > 0, t.RegexExtract != "", t.Lowercase != "", t.Default != ""} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("exactly one of rename, concatenate, regex_extract, lowercase or default is required")
+	}
+
+	switch {
+	case t.Rename != "":
+		if t.To == "" {
+			return errors.New("rename requires to")
+		}
+	case len(t.Concatenate) > 0:
+		if t.To == "" {
+			return errors.New("concatenate requires to")
+		}
+	case t.RegexExtract != "":
+		if t.Pattern == "" {
+			return errors.New("regex_extract requires pattern")
+		}
+		var err error
+		t.pattern, err = regexp.Compile(t.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	case t.Default != "":
+		if t.Value == "" {
+			return errors.New("default requires value")
+		}
+	}
+	return nil
+}
+
+func (t *ClaimTransform) apply(claims identity.FlattenedClaims) {
+	switch {
+	case t.Rename != "":
+		if vs, ok := claims[t.Rename]; ok {
+			delete(claims, t.Rename)
+			claims[t.To] = vs
+		}
+	case len(t.Concatenate) > 0:
+		var parts []string
+		for _, name := range t.Concatenate {
+			for _, v := range claims[name] {
+				parts = append(parts, fmt.Sprint(v))
+			}
+		}
+		if len(parts) > 0 {
+			claims[t.To] = []interface{}{strings.Join(parts, t.Separator)}
+		}
+	case t.RegexExtract != "":
+		pattern := t.pattern
+		if pattern == nil {
+			pattern = regexp.MustCompile(t.Pattern)
+		}
+		var extracted []interface{}
+		for _, v := range claims[t.RegexExtract] {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			if m := pattern.FindStringSubmatch(s); len(m) > 1 {
+				extracted = append(extracted, m[1])
+			} else if len(m) == 1 {
+				extracted = append(extracted, m[0])
+			}
+		}
+		if len(extracted) > 0 {
+			to := t.To
+			if to == "" {
+				to = t.RegexExtract
+			}
+			claims[to] = extracted
+		}
+	case t.Lowercase != "":
+		for i, v := range claims[t.Lowercase] {
+			if s, ok := v.(string); ok {
+				claims[t.Lowercase][i] = strings.ToLower(s)
+			}
+		}
+	case t.Default != "":
+		if len(claims[t.Default]) == 0 {
+			claims[t.Default] = []interface{}{t.Value}
+		}
+	}
+}
+
+// ClaimTransforms are claim transforms which are applied in order.
+type ClaimTransforms []ClaimTransform
+
+func (ts ClaimTransforms) validate() error {
+	for i := range ts {
+		if err := ts[i].validate(); err != nil {
+			return fmt.Errorf("claim transform %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Apply applies the transforms to the claims.
+func (ts ClaimTransforms) Apply(claims identity.FlattenedClaims) {
+	for i := range ts {
+		ts[i].apply(claims)
+	}
+}
+
+// ApplyToMap applies the transforms to claims which are single values or lists of values, such as the claims of
+// a JWT. Claims which are single values stay single values.
+func (ts ClaimTransforms) ApplyToMap(claims map[string]interface{}) {
+	if len(ts) == 0 {
+		return
+	}
+
+	flattened := make(identity.FlattenedClaims, len(claims))
+	lists := make(map[string]bool)
+	for k, v := range claims {
+		switch v := v.(type) {
+		case []interface{}:
+			flattened[k] = append([]interface{}(nil), v...)
+			lists[k] = true
+		case nil:
+		default:
+			flattened[k] = []interface{}{v}
+		}
+	}
+
+	for i := range ts {
+		t := &ts[i]
+		switch {
+		case t.Rename != "":
+			if _, ok := flattened[t.Rename]; ok {
+				lists[t.To] = lists[t.Rename]
+			}
+		case t.RegexExtract != "" && t.To != "":
+			lists[t.To] = lists[t.RegexExtract]
+		}
+		t.apply(flattened)
+	}
+
+	for k, v := range claims {
+		if _, ok := flattened[k]; !ok && v != nil {
+			delete(claims, k)
+		}
+	}
+	for k, vs := range flattened {
+		if !lists[k] && len(vs) == 1 {
+			claims[k] = vs[0]
+		} else {
+			claims[k] = vs
+		}
+	}
+}
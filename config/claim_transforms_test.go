@@ -0,0 +1,90 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/internal/identity"
+)
+
+func TestClaimTransforms_Validate(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		transform ClaimTransform
+		expectErr bool
+	}{
+		{"rename", ClaimTransform{Rename: "a", To: "b"}, false},
+		{"rename without to", ClaimTransform{Rename: "a"}, true},
+		{"concatenate", ClaimTransform{Concatenate: []string{"a", "b"}, To: "c"}, false},
+		{"concatenate without to", ClaimTransform{Concatenate: []string{"a", "b"}}, true},
+		{"regex extract", ClaimTransform{RegexExtract: "a", Pattern: "^(.*)@"}, false},
+		{"regex extract without pattern", ClaimTransform{RegexExtract: "a"}, true},
+		{"regex extract with invalid pattern", ClaimTransform{RegexExtract: "a", Pattern: "("}, true},
+		{"lowercase", ClaimTransform{Lowercase: "a"}, false},
+		{"default", ClaimTransform{Default: "a", Value: "b"}, false},
+		{"default without value", ClaimTransform{Default: "a"}, true},
+		{"no operation", ClaimTransform{To: "b"}, true},
+		{"multiple operations", ClaimTransform{Rename: "a", Lowercase: "a", To: "b"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ClaimTransforms{tc.transform}.validate()
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClaimTransforms_Apply(t *testing.T) {
+	ts := ClaimTransforms{
+		{Rename: "realm_access.roles", To: "roles"},
+		{Concatenate: []string{"given_name", "family_name"}, Separator: " ", To: "name"},
+		{RegexExtract: "upn", Pattern: `^([^@]+)@`, To: "username"},
+		{Lowercase: "email"},
+		{Default: "tenant", Value: "default"},
+		{Default: "locale", Value: "en"},
+	}
+	assert.NoError(t, ts.validate())
+
+	claims := identity.FlattenedClaims{
+		"realm_access.roles": {"admin", "user"},
+		"given_name":         {"Jane"},
+		"family_name":        {"Doe"},
+		"upn":                {"jdoe@example.com"},
+		"email":              {"JDoe@Example.com"},
+		"locale":             {"fr"},
+	}
+	ts.Apply(claims)
+	assert.Equal(t, identity.FlattenedClaims{
+		"roles":       {"admin", "user"},
+		"given_name":  {"Jane"},
+		"family_name": {"Doe"},
+		"name":        {"Jane Doe"},
+		"upn":         {"jdoe@example.com"},
+		"username":    {"jdoe"},
+		"email":       {"jdoe@example.com"},
+		"tenant":      {"default"},
+		"locale":      {"fr"},
+	}, claims)
+}
+
+func TestClaimTransforms_ApplyToMap(t *testing.T) {
+	ts := ClaimTransforms{
+		{Rename: "grps", To: "groups"},
+		{Lowercase: "email"},
+	}
+	claims := map[string]interface{}{
+		"email": "JDoe@Example.com",
+		"grps":  []interface{}{"a"},
+		"sub":   nil,
+	}
+	ts.ApplyToMap(claims)
+	assert.Equal(t, map[string]interface{}{
+		"email":  "jdoe@example.com",
+		"groups": []interface{}{"a"},
+		"sub":    nil,
+	}, claims)
+}
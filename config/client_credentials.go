@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// ClientCredentials configures a route to accept bearer tokens issued by an identity provider with the OAuth 2.0
+// client credentials grant, so that services can call the route without a browser session.
+type ClientCredentials struct {
+	// Issuer is the expected issuer of tokens. It defaults to the identity provider URL.
+	Issuer string `mapstructure:"issuer" yaml:"issuer,omitempty" json:"issuer,omitempty"`
+	// JWKSURL is the JSON web key set used to verify tokens. It defaults to the jwks_uri in the issuer's
+	// OpenID configuration.
+	JWKSURL string `mapstructure:"jwks_url" yaml:"jwks_url,omitempty" json:"jwks_url,omitempty"`
+	// Audiences are the accepted audiences of tokens. They default to the route's hostname.
+	Audiences []string `mapstructure:"audiences" yaml:"audiences,omitempty" json:"audiences,omitempty"`
+	// AllowedScopes allows tokens with any of the scopes.
+	AllowedScopes []string `mapstructure:"allowed_scopes" yaml:"allowed_scopes,omitempty" json:"allowed_scopes,omitempty"`
+	// AllowedClientIDs allows tokens issued to any of the clients.
+	AllowedClientIDs []string `mapstructure:"allowed_client_ids" yaml:"allowed_client_ids,omitempty" json:"allowed_client_ids,omitempty"`
+}
+
+func (cc *ClientCredentials) validate() error {
+	if cc.Issuer != "" {
+		if _, err := urlutil.ParseAndValidateURL(cc.Issuer); err != nil {
+			return fmt.Errorf("invalid issuer: %w", err)
+		}
+	}
+	if cc.JWKSURL != "" {
+		if _, err := urlutil.ParseAndValidateURL(cc.JWKSURL); err != nil {
+			return fmt.Errorf("invalid jwks_url: %w", err)
+		}
+	}
+	for _, audience := range cc.Audiences {
+		if audience == "" {
+			return errors.New("audiences must not be empty")
+		}
+	}
+	for _, scope := range cc.AllowedScopes {
+		if scope == "" {
+			return errors.New("allowed_scopes must not be empty")
+		}
+	}
+	for _, clientID := range cc.AllowedClientIDs {
+		if clientID == "" {
+			return errors.New("allowed_client_ids must not be empty")
+		}
+	}
+	return nil
+}
+
+// GetIssuer returns the expected issuer of tokens, which defaults to the identity provider URL.
+func (cc *ClientCredentials) GetIssuer(providerURL string) string {
+	if cc.Issuer != "" {
+		return cc.Issuer
+	}
+	return providerURL
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CompressionAlgorithms are the supported response compression algorithms.
+var CompressionAlgorithms = []string{"brotli", "gzip"}
+
+// Compression configures compressing the responses of a route.
+type Compression struct {
+	// Algorithms are the compression algorithms: brotli and/or gzip. The client's Accept-Encoding header
+	// selects one, with earlier algorithms preferred on a tie. Defaults to gzip.
+	Algorithms []string `mapstructure:"algorithms" yaml:"algorithms,omitempty" json:"algorithms,omitempty"`
+	// ContentTypes are the content types of responses which are compressed. Defaults to Envoy's list of
+	// text based types.
+	ContentTypes []string `mapstructure:"content_types" yaml:"content_types,omitempty" json:"content_types,omitempty"`
+	// MinContentLength is the minimum size of responses which are compressed. Defaults to 30 bytes.
+	MinContentLength uint32 `mapstructure:"min_content_length" yaml:"min_content_length,omitempty" json:"min_content_length,omitempty"`
+}
+
+// GetAlgorithms returns the algorithms, or the default of gzip.
+func (c *Compression) GetAlgorithms() []string {
+	if len(c.Algorithms) == 0 {
+		return []string{"gzip"}
+	}
+	return c.Algorithms
+}
+
+func (c *Compression) validate() error {
+	seen := make(map[string]bool)
+	for _, algorithm := range c.Algorithms {
+		if !isCompressionAlgorithm(algorithm) {
+			return fmt.Errorf("unknown algorithm: %s", algorithm)
+		}
+		if seen[algorithm] {
+			return fmt.Errorf("duplicate algorithm: %s", algorithm)
+		}
+		seen[algorithm] = true
+	}
+	for _, contentType := range c.ContentTypes {
+		if contentType == "" {
+			return errors.New("content types must not be empty")
+		}
+	}
+	return nil
+}
+
+func isCompressionAlgorithm(algorithm string) bool {
+	for _, a := range CompressionAlgorithms {
+		if a == algorithm {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"io/ioutil"
+	"path/filepath"
 	"sync"
 
 	"github.com/fsnotify/fsnotify"
@@ -88,7 +89,8 @@ func (src *StaticSource) OnConfigChange(ctx context.Context, li ChangeListener)
 
 // A FileOrEnvironmentSource retrieves config options from a file or the environment.
 type FileOrEnvironmentSource struct {
-	configFile string
+	configFile       string
+	policyDirWatcher *fileutil.Watcher
 
 	mu     sync.RWMutex
 	config *Config
@@ -114,12 +116,22 @@ func NewFileOrEnvironmentSource(configFile, envoyVersion string) (*FileOrEnviron
 	metrics.SetConfigInfo(ctx, cfg.Options.Services, "local", cfg.Checksum(), true)
 
 	src := &FileOrEnvironmentSource{
-		configFile: configFile,
-		config:     cfg,
+		configFile:       configFile,
+		policyDirWatcher: fileutil.NewWatcher(),
+		config:           cfg,
 	}
 	options.viper.OnConfigChange(src.onConfigChange(ctx))
 	go options.viper.WatchConfig()
 
+	// reload when files are added to, changed in or removed from the policy directory
+	ch := src.policyDirWatcher.Bind()
+	go func() {
+		for range ch {
+			src.onConfigChange(ctx)(fsnotify.Event{})
+		}
+	}()
+	src.watchPolicyDir(options.PolicyDir)
+
 	return src, nil
 }
 
@@ -136,6 +148,7 @@ func (src *FileOrEnvironmentSource) onConfigChange(ctx context.Context) func(fsn
 			cfg = cfg.Clone()
 			cfg.Options = options
 			metrics.SetConfigInfo(ctx, cfg.Options.Services, "local", cfg.Checksum(), true)
+			src.watchPolicyDir(options.PolicyDir)
 		} else {
 			log.Error(ctx).Err(err).Msg("config: error updating config")
 			metrics.SetConfigInfo(ctx, cfg.Options.Services, "local", cfg.Checksum(), false)
@@ -146,6 +159,13 @@ func (src *FileOrEnvironmentSource) onConfigChange(ctx context.Context) func(fsn
 	}
 }
 
+func (src *FileOrEnvironmentSource) watchPolicyDir(dir string) {
+	src.policyDirWatcher.Clear()
+	if dir != "" {
+		src.policyDirWatcher.Add(filepath.Join(dir, "..."))
+	}
+}
+
 // GetConfig gets the config.
 func (src *FileOrEnvironmentSource) GetConfig() *Config {
 	src.mu.RLock()
@@ -217,12 +237,27 @@ func (src *FileWatcherSource) check(ctx context.Context, cfg *Config) {
 		cfg.Options.MetricsClientCAFile,
 		cfg.Options.MetricsCertificateFile,
 		cfg.Options.MetricsCertificateKeyFile,
+		cfg.Options.SigningKeyFile,
 	}
 
 	for _, pair := range cfg.Options.CertificateFiles {
 		fs = append(fs, pair.CertFile, pair.KeyFile)
 	}
 
+	for _, key := range cfg.Options.SigningKeys {
+		fs = append(fs, key.KeyFile)
+	}
+
+	for _, p := range cfg.Options.GetAllPolicies() {
+		fs = append(fs,
+			p.KubernetesServiceAccountTokenFile,
+			p.TLSClientCertFile,
+			p.TLSClientKeyFile,
+			p.TLSCustomCAFile,
+			p.TLSDownstreamClientCAFile,
+		)
+	}
+
 	for _, f := range fs {
 		_, _ = h.Write([]byte{0})
 		bs, err := ioutil.ReadFile(f)
@@ -234,7 +269,26 @@ func (src *FileWatcherSource) check(ctx context.Context, cfg *Config) {
 
 	// update the computed config
 	src.computedConfig = cfg.Clone()
+	src.computedConfig.Options.Policies = reloadPolicyFiles(ctx, cfg.Options.Policies)
+	src.computedConfig.Options.AdditionalPolicies = reloadPolicyFiles(ctx, cfg.Options.AdditionalPolicies)
 
 	// trigger a change
 	src.Trigger(ctx, src.computedConfig)
 }
+
+// reloadPolicyFiles returns a copy of the policies with the data loaded from files reloaded.
+func reloadPolicyFiles(ctx context.Context, policies []Policy) []Policy {
+	if policies == nil {
+		return nil
+	}
+
+	reloaded := make([]Policy, len(policies))
+	for i := range policies {
+		reloaded[i] = policies[i]
+		if err := reloaded[i].reloadFiles(); err != nil {
+			log.Warn(ctx).Err(err).Str("policy", policies[i].String()).Msg("config: failed to reload policy files")
+			reloaded[i] = policies[i]
+		}
+	}
+	return reloaded
+}
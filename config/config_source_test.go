@@ -65,3 +65,87 @@ func TestFileWatcherSource(t *testing.T) {
 		t.Error("expected OnConfigChange to be fired after triggering a change to the underlying source")
 	}
 }
+
+func TestFileWatcherSourcePolicyFiles(t *testing.T) {
+	tmpdir := t.TempDir()
+	tokenFile := filepath.Join(tmpdir, "token")
+	err := ioutil.WriteFile(tokenFile, []byte("TOKEN1"), 0o600)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	p := Policy{
+		From:                              "https://from.example.com",
+		To:                                mustParseWeightedURLs(t, "https://to.example.com"),
+		KubernetesServiceAccountTokenFile: tokenFile,
+	}
+	if !assert.NoError(t, p.Validate()) {
+		return
+	}
+
+	ssrc := NewStaticSource(&Config{
+		Options: &Options{
+			Policies: []Policy{p},
+		},
+	})
+
+	src := NewFileWatcherSource(ssrc)
+	ch := make(chan *Config, 10)
+	src.OnConfigChange(context.Background(), func(ctx context.Context, cfg *Config) {
+		ch <- cfg
+	})
+
+	err = ioutil.WriteFile(tokenFile, []byte("TOKEN2"), 0o600)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	select {
+	case cfg := <-ch:
+		assert.Equal(t, "TOKEN2", cfg.Options.Policies[0].KubernetesServiceAccountToken)
+	case <-time.After(time.Second):
+		t.Error("expected OnConfigChange to be fired after modifying a policy file")
+	}
+	assert.Equal(t, "TOKEN1", ssrc.GetConfig().Options.Policies[0].KubernetesServiceAccountToken,
+		"the underlying config should not be modified")
+}
+
+func TestFileOrEnvironmentSourcePolicyDir(t *testing.T) {
+	policyDir := t.TempDir()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	err := ioutil.WriteFile(configFile, []byte("insecure_server: true\npolicy_dir: "+policyDir+"\n"), 0o600)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	src, err := NewFileOrEnvironmentSource(configFile, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	ch := make(chan *Config, 10)
+	src.OnConfigChange(context.Background(), func(ctx context.Context, cfg *Config) {
+		ch <- cfg
+	})
+
+	err = ioutil.WriteFile(filepath.Join(policyDir, "routes.yaml"), []byte(`
+policy:
+  - from: https://from.example.com
+    to: https://to.example.com
+`), 0o600)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case cfg := <-ch:
+			if len(cfg.Options.Policies) == 1 {
+				assert.Equal(t, "https://from.example.com", cfg.Options.Policies[0].From)
+				return
+			}
+		case <-timeout:
+			t.Fatal("expected OnConfigChange to be fired after adding a file to the policy directory")
+		}
+	}
+}
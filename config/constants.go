@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
@@ -14,20 +15,24 @@ const (
 )
 
 var (
-	errKeysMustBeStrings          = errors.New("cannot convert nested map: all keys must be strings")
-	errZeroWeight                 = errors.New("zero load balancing weight not permitted")
-	errEndpointWeightsSpec        = errors.New("either no weights should be provided, or all endpoints must have non-zero weight specified")
-	errHostnameMustBeSpecified    = errors.New("endpoint hostname must be specified")
-	errSchemeMustBeSpecified      = errors.New("url scheme must be provided")
-	errEmptyUrls                  = errors.New("url list is empty")
-	errEitherToOrRedirectRequired = errors.New("policy should have either `to` or `redirect` defined")
+	errKeysMustBeStrings             = errors.New("cannot convert nested map: all keys must be strings")
+	errZeroWeight                    = errors.New("zero load balancing weight not permitted")
+	errEndpointWeightsSpec           = errors.New("either no weights should be provided, or all endpoints must have non-zero weight specified")
+	errHostnameMustBeSpecified       = errors.New("endpoint hostname must be specified")
+	errSchemeMustBeSpecified         = errors.New("url scheme must be provided")
+	errUnixSocketPathMustBeSpecified = errors.New("unix socket url must have a path and no host, e.g. unix:///var/run/app.sock")
+	errEmptyUrls                     = errors.New("url list is empty")
+	errEitherToOrRedirectRequired    = errors.New("policy should have either `to` or `redirect` defined")
 )
 
 var protoPartial = protojson.UnmarshalOptions{AllowPartial: true, DiscardUnknown: true}
 
 // ViperPolicyHooks are used to decode options and policy coming from YAML and env vars
-var ViperPolicyHooks = viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+var ViperPolicyHooks = viper.DecodeHook(policyDecodeHook)
+
+var policyDecodeHook = mapstructure.ComposeDecodeHookFunc(
 	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToTimeHookFunc(time.RFC3339),
 	mapstructure.StringToSliceHookFunc(","),
 	// decode policy including all protobuf-native notations - i.e. duration as `1s`
 	// https://developers.google.com/protocol-buffers/docs/proto3#json
@@ -36,4 +41,6 @@ var ViperPolicyHooks = viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
 	DecodePolicyBase64Hook(),
 	decodeJWTClaimHeadersHookFunc(),
 	decodeCodecTypeHookFunc(),
-))
+	decodeEnvoyOverridesHookFunc(),
+	decodePolicyRuleHookFunc(),
+)
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// A PolicyCookie overrides the global session cookie settings for a route, e.g. to scope the cookie to a
+// single domain of a multi-domain deployment, or to allow an app embedded in an iframe to send it.
+type PolicyCookie struct {
+	// Name is the name of the cookie. Defaults to cookie_name.
+	Name string `mapstructure:"name" yaml:"name,omitempty" json:"name,omitempty"`
+	// Domain is the domain attribute of the cookie. Defaults to cookie_domain.
+	Domain string `mapstructure:"domain" yaml:"domain,omitempty" json:"domain,omitempty"`
+	// Path is the path attribute of the cookie. Defaults to /.
+	Path string `mapstructure:"path" yaml:"path,omitempty" json:"path,omitempty"`
+	// SameSite is the SameSite attribute of the cookie: lax, strict or none. By default it isn't set.
+	SameSite string `mapstructure:"same_site" yaml:"same_site,omitempty" json:"same_site,omitempty"`
+	// Secure, if set, overrides cookie_secure.
+	Secure *bool `mapstructure:"secure" yaml:"secure,omitempty" json:"secure,omitempty"`
+}
+
+// GetCookieOptions returns the options of the session cookie for the route, or of the global session cookie if
+// the route is nil.
+func (o *Options) GetCookieOptions(p *Policy) cookie.Options {
+	opts := cookie.Options{
+		Name:     o.CookieName,
+		Domain:   o.CookieDomain,
+		Secure:   o.CookieSecure,
+		HTTPOnly: o.CookieHTTPOnly,
+		Expire:   o.CookieExpire,
+	}
+	if p == nil || p.Cookie == nil {
+		return opts
+	}
+
+	c := p.Cookie
+	if c.Name != "" {
+		opts.Name = c.Name
+	}
+	if c.Domain != "" {
+		opts.Domain = c.Domain
+	}
+	opts.Path = c.Path
+	opts.SameSite, _ = parseSameSite(c.SameSite)
+	if c.Secure != nil {
+		opts.Secure = *c.Secure
+	}
+	return opts
+}
+
+// GetCookieOptionsForHost returns the options of the session cookie for the routes of the host. Routes for the
+// same host share their cookie settings, so pomerium's own endpoints on the host, e.g. the callback which sets
+// the cookie, use them too. Hosts without a route use the global session cookie.
+func (o *Options) GetCookieOptionsForHost(host string) cookie.Options {
+	var wildcard *Policy
+	for _, p := range o.GetAllPolicies() {
+		p := p
+		if p.Source == nil {
+			continue
+		}
+		if p.Source.Host == host {
+			return o.GetCookieOptions(&p)
+		}
+		if _, ok := urlutil.MatchWildcardHost(p.Source.Host, host); ok && wildcard == nil {
+			wildcard = &p
+		}
+	}
+	return o.GetCookieOptions(wildcard)
+}
+
+func (o *Options) validateRouteCookies() error {
+	hosts := make(map[string]*PolicyCookie)
+	for _, p := range o.GetAllPolicies() {
+		if p.Cookie != nil {
+			if err := p.Cookie.validate(o); err != nil {
+				return fmt.Errorf("config: policy (%s) has an invalid cookie: %w", p.From, err)
+			}
+		}
+
+		if p.Source == nil {
+			continue
+		}
+		if c, ok := hosts[p.Source.Host]; ok && !reflect.DeepEqual(c, p.Cookie) {
+			return fmt.Errorf("config: routes for %s must use the same cookie settings", p.Source.Host)
+		}
+		hosts[p.Source.Host] = p.Cookie
+	}
+	return nil
+}
+
+func (c *PolicyCookie) validate(o *Options) error {
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+		return errors.New("path must start with /")
+	}
+	sameSite, err := parseSameSite(c.SameSite)
+	if err != nil {
+		return err
+	}
+	secure := o.CookieSecure
+	if c.Secure != nil {
+		secure = *c.Secure
+	}
+	if sameSite == http.SameSiteNoneMode && !secure {
+		return errors.New("same_site none requires a secure cookie")
+	}
+	return nil
+}
+
+func parseSameSite(sameSite string) (http.SameSite, error) {
+	switch strings.ToLower(sameSite) {
+	case "":
+		return 0, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("unknown same_site: %s", sameSite)
+}
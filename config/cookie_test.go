@@ -0,0 +1,99 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/sessions/cookie"
+)
+
+func TestOptions_GetCookieOptions(t *testing.T) {
+	secure := false
+	o := NewDefaultOptions()
+	o.CookieDomain = "example.com"
+	o.Policies = []Policy{
+		{From: "https://a.example.com", To: mustParseWeightedURLs(t, "https://a.internal")},
+		{From: "https://b.example.com", To: mustParseWeightedURLs(t, "https://b.internal"), Cookie: &PolicyCookie{
+			Name:     "_b",
+			Domain:   "b.example.com",
+			Path:     "/app",
+			SameSite: "None",
+			Secure:   &secure,
+		}},
+		{From: "https://*.c.example.com", To: mustParseWeightedURLs(t, "https://c.internal"), Cookie: &PolicyCookie{
+			SameSite: "strict",
+		}},
+	}
+	for i := range o.Policies {
+		require.NoError(t, o.Policies[i].Validate())
+	}
+
+	global := o.GetCookieOptions(nil)
+	assert.Equal(t, cookie.Options{
+		Name:     "_pomerium",
+		Domain:   "example.com",
+		Expire:   o.CookieExpire,
+		HTTPOnly: true,
+		Secure:   true,
+	}, global)
+	assert.Equal(t, global, o.GetCookieOptions(&o.Policies[0]))
+	assert.Equal(t, cookie.Options{
+		Name:     "_b",
+		Domain:   "b.example.com",
+		Path:     "/app",
+		SameSite: http.SameSiteNoneMode,
+		Expire:   o.CookieExpire,
+		HTTPOnly: true,
+	}, o.GetCookieOptions(&o.Policies[1]))
+
+	assert.Equal(t, global, o.GetCookieOptionsForHost("a.example.com"))
+	assert.Equal(t, "_b", o.GetCookieOptionsForHost("b.example.com").Name)
+	assert.Equal(t, http.SameSiteStrictMode, o.GetCookieOptionsForHost("tenant.c.example.com").SameSite)
+	assert.Equal(t, global, o.GetCookieOptionsForHost("d.example.com"))
+}
+
+func TestOptions_validateRouteCookies(t *testing.T) {
+	secure := false
+	for _, tc := range []struct {
+		name     string
+		policies []Policy
+		err      string
+	}{
+		{"valid", []Policy{
+			{From: "https://a.example.com", Path: "/x", Cookie: &PolicyCookie{Name: "_a", SameSite: "lax"}},
+			{From: "https://a.example.com", Path: "/y", Cookie: &PolicyCookie{Name: "_a", SameSite: "lax"}},
+			{From: "https://b.example.com"},
+		}, ""},
+		{"different cookies for a host", []Policy{
+			{From: "https://a.example.com", Path: "/x", Cookie: &PolicyCookie{Name: "_a"}},
+			{From: "https://a.example.com", Path: "/y"},
+		}, "config: routes for a.example.com must use the same cookie settings"},
+		{"invalid same site", []Policy{
+			{From: "https://a.example.com", Cookie: &PolicyCookie{SameSite: "sometimes"}},
+		}, "config: policy (https://a.example.com) has an invalid cookie: unknown same_site: sometimes"},
+		{"same site none without secure", []Policy{
+			{From: "https://a.example.com", Cookie: &PolicyCookie{SameSite: "none", Secure: &secure}},
+		}, "config: policy (https://a.example.com) has an invalid cookie: same_site none requires a secure cookie"},
+		{"relative path", []Policy{
+			{From: "https://a.example.com", Cookie: &PolicyCookie{Path: "app"}},
+		}, "config: policy (https://a.example.com) has an invalid cookie: path must start with /"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := NewDefaultOptions()
+			o.Policies = tc.policies
+			for i := range o.Policies {
+				o.Policies[i].To = mustParseWeightedURLs(t, "https://to.internal")
+				require.NoError(t, o.Policies[i].Validate())
+			}
+			err := o.validateRouteCookies()
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CORS configures Envoy's CORS filter for a route. Pre-flight requests are answered without a session.
+type CORS struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests, such as
+	// https://app.example.com, or * for any origin.
+	AllowedOrigins []string `mapstructure:"allowed_origins" yaml:"allowed_origins,omitempty" json:"allowed_origins,omitempty"`
+	// AllowedMethods are the methods allowed in cross-origin requests.
+	AllowedMethods []string `mapstructure:"allowed_methods" yaml:"allowed_methods,omitempty" json:"allowed_methods,omitempty"`
+	// AllowedHeaders are the request headers allowed in cross-origin requests.
+	AllowedHeaders []string `mapstructure:"allowed_headers" yaml:"allowed_headers,omitempty" json:"allowed_headers,omitempty"`
+	// ExposedHeaders are the response headers exposed to the origin.
+	ExposedHeaders []string `mapstructure:"exposed_headers" yaml:"exposed_headers,omitempty" json:"exposed_headers,omitempty"`
+	// AllowCredentials allows cross-origin requests to include credentials, such as cookies.
+	AllowCredentials bool `mapstructure:"allow_credentials" yaml:"allow_credentials,omitempty" json:"allow_credentials,omitempty"`
+	// MaxAge is how long the results of a pre-flight request may be cached by the browser.
+	MaxAge time.Duration `mapstructure:"max_age" yaml:"max_age,omitempty" json:"max_age,omitempty"`
+}
+
+func (c *CORS) validate() error {
+	if len(c.AllowedOrigins) == 0 {
+		return errors.New("allowed_origins is required")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			// browsers reject credentialed responses which allow any origin
+			if c.AllowCredentials {
+				return errors.New("allowed origin * is not allowed with allow_credentials")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return fmt.Errorf("invalid allowed origin %q: %w", origin, err)
+		}
+		if u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid allowed origin %q: must be a scheme and host", origin)
+		}
+	}
+	for _, method := range c.AllowedMethods {
+		if method == "" || strings.ContainsAny(method, " ,") {
+			return fmt.Errorf("invalid allowed method: %q", method)
+		}
+	}
+	for _, headers := range [][]string{c.AllowedHeaders, c.ExposedHeaders} {
+		for _, header := range headers {
+			if header == "" || strings.ContainsAny(header, " ,") {
+				return fmt.Errorf("invalid header: %q", header)
+			}
+		}
+	}
+	if c.MaxAge < 0 {
+		return errors.New("max_age must not be negative")
+	}
+	return nil
+}
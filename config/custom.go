@@ -21,27 +21,66 @@ import (
 	"github.com/pomerium/pomerium/internal/urlutil"
 )
 
+// A JWTClaimHeader describes how a claim is added to a request header.
+type JWTClaimHeader struct {
+	// Claim is the name of the claim. An empty claim removes the header.
+	Claim string `mapstructure:"claim" yaml:"claim" json:"claim"`
+	// Path selects a value nested in the claim, as a dot-separated list of keys.
+	Path string `mapstructure:"path" yaml:"path,omitempty" json:"path,omitempty"`
+	// Delimiter joins the values of an array claim. It defaults to a comma.
+	Delimiter string `mapstructure:"delimiter" yaml:"delimiter,omitempty" json:"delimiter,omitempty"`
+}
+
 // JWTClaimHeaders are headers to add to a request based on IDP claims.
-type JWTClaimHeaders map[string]string
+type JWTClaimHeaders map[string]JWTClaimHeader
 
 // NewJWTClaimHeaders creates a JWTClaimHeaders map from a slice of claims.
 func NewJWTClaimHeaders(claims ...string) JWTClaimHeaders {
 	hdrs := make(JWTClaimHeaders)
 	for _, claim := range claims {
 		k := httputil.PomeriumJWTHeaderName(claim)
-		hdrs[k] = claim
+		hdrs[k] = JWTClaimHeader{Claim: claim}
 	}
 	return hdrs
 }
 
+// Merge returns the headers overridden by the given headers. Headers whose claim is empty are removed.
+func (hdrs JWTClaimHeaders) Merge(overrides JWTClaimHeaders) JWTClaimHeaders {
+	merged := make(JWTClaimHeaders, len(hdrs)+len(overrides))
+	for k, v := range hdrs {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	for k, v := range merged {
+		if v.Claim == "" {
+			delete(merged, k)
+		}
+	}
+	return merged
+}
+
 // UnmarshalJSON unmarshals JSON data into the JWTClaimHeaders.
 func (hdrs *JWTClaimHeaders) UnmarshalJSON(data []byte) error {
 	var m map[string]interface{}
 	if json.Unmarshal(data, &m) == nil {
-		*hdrs = make(map[string]string)
+		*hdrs = make(JWTClaimHeaders)
 		for k, v := range m {
-			str := fmt.Sprint(v)
-			(*hdrs)[k] = str
+			if obj, ok := v.(map[string]interface{}); ok {
+				bs, _ := json.Marshal(obj)
+				var hdr JWTClaimHeader
+				if err := json.Unmarshal(bs, &hdr); err != nil {
+					return fmt.Errorf("invalid JWT claim header %s: %w", k, err)
+				}
+				(*hdrs)[k] = hdr
+				continue
+			}
+			if v == nil {
+				(*hdrs)[k] = JWTClaimHeader{}
+				continue
+			}
+			(*hdrs)[k] = JWTClaimHeader{Claim: fmt.Sprint(v)}
 		}
 		return nil
 	}
@@ -200,6 +239,12 @@ type WeightedURL struct {
 
 // Validate validates that the WeightedURL is valid.
 func (u *WeightedURL) Validate() error {
+	if urlutil.IsUnix(&u.URL) {
+		if u.URL.Host != "" || u.URL.Path == "" {
+			return errUnixSocketPathMustBeSpecified
+		}
+		return nil
+	}
 	if u.URL.Hostname() == "" {
 		return errHostnameMustBeSpecified
 	}
@@ -216,6 +261,19 @@ func ParseWeightedURL(dst string) (*WeightedURL, error) {
 		return nil, err
 	}
 
+	// upstreams listening on unix domain sockets don't have a host, e.g. unix:///var/run/app.sock
+	if strings.HasPrefix(to, "unix:") {
+		u, err := url.Parse(to)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", to, err)
+		}
+		wu := &WeightedURL{*u, w}
+		if err := wu.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", to, err)
+		}
+		return wu, nil
+	}
+
 	u, err := urlutil.ParseAndValidateURL(to)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", to, err)
@@ -237,6 +295,15 @@ func (u *WeightedURL) String() string {
 	return fmt.Sprintf("{url=%s, weight=%d}", str, u.LbWeight)
 }
 
+// MarshalYAML marshals the WeightedURL in the format of the config file, with its weight appended to the URL.
+func (u WeightedURL) MarshalYAML() (interface{}, error) {
+	str := u.URL.String()
+	if u.LbWeight == 0 {
+		return str, nil
+	}
+	return fmt.Sprintf("%s,%d", str, u.LbWeight), nil
+}
+
 // WeightedURLs is a slice of WeightedURLs.
 type WeightedURLs []WeightedURL
 
@@ -17,19 +17,29 @@ func TestJWTClaimHeaders_UnmarshalJSON(t *testing.T) {
 		var hdrs JWTClaimHeaders
 		err := json.Unmarshal([]byte(`{"x":"y"}`), &hdrs)
 		assert.NoError(t, err)
-		assert.Equal(t, JWTClaimHeaders{"x": "y"}, hdrs)
+		assert.Equal(t, JWTClaimHeaders{"x": {Claim: "y"}}, hdrs)
+	})
+	t.Run("nested object", func(t *testing.T) {
+		var hdrs JWTClaimHeaders
+		err := json.Unmarshal([]byte(`{"X-Remote-Country":{"claim":"address","path":"country"},"X-Remote-Groups":{"claim":"groups","delimiter":";"},"X-Removed":null}`), &hdrs)
+		assert.NoError(t, err)
+		assert.Equal(t, JWTClaimHeaders{
+			"X-Remote-Country": {Claim: "address", Path: "country"},
+			"X-Remote-Groups":  {Claim: "groups", Delimiter: ";"},
+			"X-Removed":        {},
+		}, hdrs)
 	})
 	t.Run("array", func(t *testing.T) {
 		var hdrs JWTClaimHeaders
 		err := json.Unmarshal([]byte(`["x", "y"]`), &hdrs)
 		assert.NoError(t, err)
-		assert.Equal(t, JWTClaimHeaders{"x-pomerium-claim-x": "x", "x-pomerium-claim-y": "y"}, hdrs)
+		assert.Equal(t, JWTClaimHeaders{"x-pomerium-claim-x": {Claim: "x"}, "x-pomerium-claim-y": {Claim: "y"}}, hdrs)
 	})
 	t.Run("string", func(t *testing.T) {
 		var hdrs JWTClaimHeaders
 		err := json.Unmarshal([]byte(`"x, y"`), &hdrs)
 		assert.NoError(t, err)
-		assert.Equal(t, JWTClaimHeaders{"x-pomerium-claim-x": "x", "x-pomerium-claim-y": "y"}, hdrs)
+		assert.Equal(t, JWTClaimHeaders{"x-pomerium-claim-x": {Claim: "x"}, "x-pomerium-claim-y": {Claim: "y"}}, hdrs)
 	})
 }
 
@@ -40,7 +50,21 @@ func TestJWTClaimHeaders_UnmarshalYAML(t *testing.T) {
 x: "y"
 `), &hdrs)
 		assert.NoError(t, err)
-		assert.Equal(t, JWTClaimHeaders{"x": "y"}, hdrs)
+		assert.Equal(t, JWTClaimHeaders{"x": {Claim: "y"}}, hdrs)
+	})
+	t.Run("nested object", func(t *testing.T) {
+		var hdrs JWTClaimHeaders
+		err := yaml.Unmarshal([]byte(`
+X-Remote-User: email
+X-Remote-Groups:
+  claim: groups
+  delimiter: ";"
+`), &hdrs)
+		assert.NoError(t, err)
+		assert.Equal(t, JWTClaimHeaders{
+			"X-Remote-User":   {Claim: "email"},
+			"X-Remote-Groups": {Claim: "groups", Delimiter: ";"},
+		}, hdrs)
 	})
 	t.Run("array", func(t *testing.T) {
 		var hdrs JWTClaimHeaders
@@ -49,16 +73,34 @@ x: "y"
 - "y"
 `), &hdrs)
 		assert.NoError(t, err)
-		assert.Equal(t, JWTClaimHeaders{"x-pomerium-claim-x": "x", "x-pomerium-claim-y": "y"}, hdrs)
+		assert.Equal(t, JWTClaimHeaders{"x-pomerium-claim-x": {Claim: "x"}, "x-pomerium-claim-y": {Claim: "y"}}, hdrs)
 	})
 	t.Run("string", func(t *testing.T) {
 		var hdrs JWTClaimHeaders
 		err := yaml.Unmarshal([]byte(`"x, y"`), &hdrs)
 		assert.NoError(t, err)
-		assert.Equal(t, JWTClaimHeaders{"x-pomerium-claim-x": "x", "x-pomerium-claim-y": "y"}, hdrs)
+		assert.Equal(t, JWTClaimHeaders{"x-pomerium-claim-x": {Claim: "x"}, "x-pomerium-claim-y": {Claim: "y"}}, hdrs)
 	})
 }
 
+func TestJWTClaimHeaders_Merge(t *testing.T) {
+	hdrs := JWTClaimHeaders{
+		"x-email":  {Claim: "email"},
+		"x-groups": {Claim: "groups"},
+	}
+	assert.Equal(t, JWTClaimHeaders{
+		"x-email":       {Claim: "email"},
+		"x-groups":      {Claim: "groups", Delimiter: ";"},
+		"x-remote-user": {Claim: "user"},
+	}, hdrs.Merge(JWTClaimHeaders{
+		"x-groups":      {Claim: "groups", Delimiter: ";"},
+		"x-remote-user": {Claim: "user"},
+	}))
+	assert.Equal(t, JWTClaimHeaders{
+		"x-groups": {Claim: "groups"},
+	}, hdrs.Merge(JWTClaimHeaders{"x-email": {}}))
+}
+
 func TestDecodeJWTClaimHeadersHookFunc(t *testing.T) {
 	var withClaims struct {
 		Claims JWTClaimHeaders `mapstructure:"claims"`
@@ -77,8 +119,8 @@ func TestDecodeJWTClaimHeadersHookFunc(t *testing.T) {
 		})
 		assert.NoError(t, err)
 		assert.Equal(t, JWTClaimHeaders{
-			"a": "b",
-			"c": "d",
+			"a": {Claim: "b"},
+			"c": {Claim: "d"},
 		}, withClaims.Claims)
 	})
 
@@ -92,9 +134,9 @@ func TestDecodeJWTClaimHeadersHookFunc(t *testing.T) {
 		})
 		assert.NoError(t, err)
 		assert.Equal(t, JWTClaimHeaders{
-			"x-pomerium-claim-a": "a",
-			"x-pomerium-claim-b": "b",
-			"x-pomerium-claim-c": "c",
+			"x-pomerium-claim-a": {Claim: "a"},
+			"x-pomerium-claim-b": {Claim: "b"},
+			"x-pomerium-claim-c": {Claim: "c"},
 		}, withClaims.Claims)
 	})
 }
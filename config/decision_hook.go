@@ -0,0 +1,47 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// DefaultDecisionHookTimeout is how long a decision hook may take to respond by default.
+const DefaultDecisionHookTimeout = 5 * time.Second
+
+// A DecisionHook is sent a summary of each authorization decision, e.g. so that an external risk engine can
+// detect impossible travel or a sudden burst of denied requests. The hook is called in the background and
+// doesn't delay the decision.
+type DecisionHook struct {
+	// URL is sent each decision summary with a JSON POST request.
+	URL string `mapstructure:"url" yaml:"url" json:"url"`
+	// AllowReauthenticate lets the hook respond with {"reauthenticate": true} to sign out the session of the
+	// decision, so the user has to sign in again.
+	AllowReauthenticate bool `mapstructure:"allow_reauthenticate" yaml:"allow_reauthenticate,omitempty" json:"allow_reauthenticate,omitempty"`
+	// Timeout is how long the hook may take to respond. Defaults to 5 seconds.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// GetTimeout returns how long the hook may take to respond, which defaults to 5 seconds.
+func (h *DecisionHook) GetTimeout() time.Duration {
+	if h.Timeout <= 0 {
+		return DefaultDecisionHookTimeout
+	}
+	return h.Timeout
+}
+
+func (h *DecisionHook) validate() error {
+	u, err := urlutil.ParseAndValidateURL(h.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	if h.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/protoutil"
+)
+
+// redactedValue replaces the value of secret options in a Diff.
+const redactedValue = "[redacted]"
+
+// A Diff describes the changes between two configurations.
+type Diff struct {
+	RoutesAdded    []string       `json:"routes_added,omitempty"`
+	RoutesRemoved  []string       `json:"routes_removed,omitempty"`
+	RoutesModified []string       `json:"routes_modified,omitempty"`
+	Options        []OptionChange `json:"options,omitempty"`
+}
+
+// An OptionChange is a change to the value of an option. The values of secret options are redacted.
+type OptionChange struct {
+	Name string      `json:"name"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// DiffConfig returns the changes from the old config to the new config. Routes are identified by the
+// requests they match, so a route whose from, prefix, path or regex changes is reported as removed
+// and added.
+func DiffConfig(oldCfg, newCfg *Config) *Diff {
+	diff := new(Diff)
+
+	oldPolicies := map[string]Policy{}
+	for _, p := range oldCfg.Options.GetAllPolicies() {
+		oldPolicies[policyMatchKey(&p)] = p
+	}
+	newPolicies := map[string]Policy{}
+	for _, p := range newCfg.Options.GetAllPolicies() {
+		p := p
+		key := policyMatchKey(&p)
+		newPolicies[key] = p
+
+		old, ok := oldPolicies[key]
+		switch {
+		case !ok:
+			diff.RoutesAdded = append(diff.RoutesAdded, p.String())
+		case !policiesEqual(&old, &p):
+			diff.RoutesModified = append(diff.RoutesModified, p.String())
+		}
+	}
+	for key, p := range oldPolicies {
+		if _, ok := newPolicies[key]; !ok {
+			diff.RoutesRemoved = append(diff.RoutesRemoved, p.String())
+		}
+	}
+	sort.Strings(diff.RoutesAdded)
+	sort.Strings(diff.RoutesRemoved)
+	sort.Strings(diff.RoutesModified)
+
+	secrets := map[string]bool{
+		"certificates": true,
+		"google_cloud_serverless_authentication_service_account": true,
+		"otlp_headers": true,
+		"signing_keys": true,
+	}
+	for name := range newCfg.Options.secretSettings() {
+		secrets[name] = true
+	}
+	diffOptions(diff, secrets, reflect.ValueOf(oldCfg.Options).Elem(), reflect.ValueOf(newCfg.Options).Elem())
+	sort.Slice(diff.Options, func(i, j int) bool {
+		return diff.Options[i].Name < diff.Options[j].Name
+	})
+
+	return diff
+}
+
+// IsEmpty returns true if nothing changed.
+func (diff *Diff) IsEmpty() bool {
+	return len(diff.RoutesAdded) == 0 &&
+		len(diff.RoutesRemoved) == 0 &&
+		len(diff.RoutesModified) == 0 &&
+		len(diff.Options) == 0
+}
+
+func diffOptions(diff *Diff, secrets map[string]bool, oldValue, newValue reflect.Value) {
+	for i := 0; i < newValue.NumField(); i++ {
+		field := newValue.Type().Field(i)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")
+		name := tag[0]
+		if len(tag) > 1 && tag[1] == "squash" {
+			diffOptions(diff, secrets, oldValue.Field(i), newValue.Field(i))
+			continue
+		}
+		// routes are compared separately
+		if name == "" || name == "-" || name == "policy" {
+			continue
+		}
+
+		oldField, newField := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		if reflect.DeepEqual(oldField, newField) || (isEmptyCollection(oldValue.Field(i)) && isEmptyCollection(newValue.Field(i))) {
+			continue
+		}
+		change := OptionChange{Name: name, Old: optionValue(oldField), New: optionValue(newField)}
+		if secrets[name] {
+			change.Old, change.New = redactedValue, redactedValue
+		}
+		diff.Options = append(diff.Options, change)
+	}
+}
+
+// isEmptyCollection returns true for nil and empty slices and maps, which are equivalent options.
+func isEmptyCollection(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return false
+}
+
+func optionValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Duration:
+		return v.String()
+	case *time.Duration:
+		if v == nil {
+			return nil
+		}
+		return v.String()
+	}
+	return v
+}
+
+func policiesEqual(p1, p2 *Policy) bool {
+	pb1, err1 := p1.ToProto()
+	pb2, err2 := p2.ToProto()
+	if err1 != nil || err2 != nil {
+		return reflect.DeepEqual(p1, p2)
+	}
+	return proto.Equal(pb1, pb2)
+}
+
+// The ChangeLogManager logs the changes made by every configuration reload. If an audit key is set,
+// the changes are also written to the audit log.
+type ChangeLogManager struct {
+	mu       sync.Mutex
+	prev     *Config
+	auditKey *PublicKeyEncryptionKeyOptions
+	auditor  *protoutil.Encryptor
+}
+
+// NewChangeLogManager creates a new ChangeLogManager.
+func NewChangeLogManager(ctx context.Context, src Source) *ChangeLogManager {
+	mgr := &ChangeLogManager{prev: src.GetConfig()}
+	src.OnConfigChange(ctx, mgr.OnConfigChange)
+	return mgr
+}
+
+// Close closes the change log manager.
+func (mgr *ChangeLogManager) Close() error {
+	return nil
+}
+
+// OnConfigChange is called whenever configuration changes.
+func (mgr *ChangeLogManager) OnConfigChange(ctx context.Context, cfg *Config) {
+	if cfg == nil || cfg.Options == nil {
+		return
+	}
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	prev := mgr.prev
+	mgr.prev = cfg
+	if prev == nil || prev.Options == nil {
+		return
+	}
+
+	diff := DiffConfig(prev, cfg)
+	if diff.IsEmpty() {
+		return
+	}
+
+	log.Info(ctx).
+		Strs("routes_added", diff.RoutesAdded).
+		Strs("routes_removed", diff.RoutesRemoved).
+		Strs("routes_modified", diff.RoutesModified).
+		Interface("options", diff.Options).
+		Msg("config: configuration changed")
+
+	mgr.audit(ctx, cfg, diff)
+}
+
+func (mgr *ChangeLogManager) audit(ctx context.Context, cfg *Config, diff *Diff) {
+	auditKey, err := cfg.Options.GetAuditKey()
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("config: invalid audit key")
+		return
+	} else if auditKey == nil {
+		mgr.auditKey, mgr.auditor = nil, nil
+		return
+	}
+	if mgr.auditor == nil || !reflect.DeepEqual(mgr.auditKey, cfg.Options.AuditKey) {
+		mgr.auditKey, mgr.auditor = cfg.Options.AuditKey, protoutil.NewEncryptor(auditKey)
+	}
+
+	bs, err := json.Marshal(diff)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("config: error encoding configuration change for the audit log")
+		return
+	}
+	var m map[string]interface{}
+	_ = json.Unmarshal(bs, &m)
+	record, err := structpb.NewStruct(m)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("config: error encoding configuration change for the audit log")
+		return
+	}
+	sealed, err := mgr.auditor.Encrypt(record)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("config: error encrypting audit record")
+		return
+	}
+	log.AccessInfo(ctx).
+		Str("event", "config-change").
+		EmbedObject(sealed).
+		Msg("audit log")
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffConfig(t *testing.T) {
+	newPolicy := func(from, to string) Policy {
+		p := Policy{From: from, To: mustParseWeightedURLs(t, to)}
+		require.NoError(t, p.Validate())
+		return p
+	}
+
+	oldCfg := &Config{Options: &Options{
+		SharedKey:              "OLD",
+		LogLevel:               "info",
+		DefaultUpstreamTimeout: 30 * time.Second,
+		Policies: []Policy{
+			newPolicy("https://a.example.com", "https://a.internal"),
+			newPolicy("https://b.example.com", "https://b.internal"),
+		},
+	}}
+	newCfg := &Config{Options: &Options{
+		SharedKey:              "NEW",
+		LogLevel:               "debug",
+		DefaultUpstreamTimeout: 30 * time.Second,
+		JWTClaimsHeaders:       JWTClaimHeaders{},
+		Policies: []Policy{
+			newPolicy("https://b.example.com", "https://b2.internal"),
+			newPolicy("https://c.example.com", "https://c.internal"),
+		},
+	}}
+
+	diff := DiffConfig(oldCfg, newCfg)
+	assert.Equal(t, []string{"https://c.example.com → https://c.internal"}, diff.RoutesAdded)
+	assert.Equal(t, []string{"https://a.example.com → https://a.internal"}, diff.RoutesRemoved)
+	assert.Equal(t, []string{"https://b.example.com → https://b2.internal"}, diff.RoutesModified)
+	assert.Equal(t, []OptionChange{
+		{Name: "log_level", Old: "info", New: "debug"},
+		{Name: "shared_secret", Old: redactedValue, New: redactedValue},
+	}, diff.Options)
+
+	assert.True(t, DiffConfig(newCfg, newCfg.Clone()).IsEmpty())
+
+	t.Run("signing keys", func(t *testing.T) {
+		rotated := newCfg.Clone()
+		rotated.Options.SigningKeys = []SigningKey{{Key: "PRIVATE_KEY"}}
+		diff := DiffConfig(newCfg, rotated)
+		assert.Equal(t, []OptionChange{
+			{Name: "signing_keys", Old: redactedValue, New: redactedValue},
+		}, diff.Options)
+	})
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	envoy_config_bootstrap_v3 "github.com/envoyproxy/go-control-plane/envoy/config/bootstrap/v3"
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_listener_v3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	// extension types which can be used in the typed_config of overrides, in addition to those Pomerium uses
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/compression/gzip/compressor/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/buffer/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/compressor/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/cors/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/csrf/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/header_to_metadata/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/lua/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ratelimit/v3"
+	_ "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/mitchellh/mapstructure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvoyOverrides are snippets of Envoy configuration which are merged with the configuration Pomerium
+// generates, so that Envoy features Pomerium doesn't configure can be used. Snippets are written in the
+// JSON (or YAML) representation of the Envoy v3 API and are merged with protobuf merge semantics: scalar
+// fields are replaced, messages are merged and lists are appended to.
+type EnvoyOverrides struct {
+	// Bootstrap is merged into the Envoy bootstrap configuration.
+	Bootstrap *envoy_config_bootstrap_v3.Bootstrap
+	// Listeners are merged into the generated listener with the same name, or added if there isn't one.
+	Listeners []*envoy_config_listener_v3.Listener
+	// Clusters are merged into the generated cluster with the same name, or added if there isn't one.
+	Clusters []*envoy_config_cluster_v3.Cluster
+	// HTTPFilters are added to the main listener before the router filter.
+	HTTPFilters []*envoy_http_connection_manager.HttpFilter
+}
+
+// unknown fields are rejected so that mistakes aren't silently ignored
+var envoyOverridesUnmarshalOptions = protojson.UnmarshalOptions{AllowPartial: true}
+
+func decodeEnvoyOverridesHookFunc() mapstructure.DecodeHookFunc {
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if t != reflect.TypeOf(EnvoyOverrides{}) {
+			return data, nil
+		}
+		// from an environment variable
+		if str, ok := data.(string); ok {
+			var raw interface{}
+			if err := yaml.Unmarshal([]byte(str), &raw); err != nil {
+				return nil, fmt.Errorf("invalid envoy_overrides: %w", err)
+			}
+			data = raw
+		}
+		return parseEnvoyOverrides(data)
+	}
+}
+
+func parseEnvoyOverrides(data interface{}) (*EnvoyOverrides, error) {
+	raw, err := serializable(data)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid envoy_overrides: expected an object")
+	}
+
+	o := new(EnvoyOverrides)
+	for k, v := range m {
+		switch k {
+		case "bootstrap":
+			o.Bootstrap = new(envoy_config_bootstrap_v3.Bootstrap)
+			err = parseEnvoyOverride(v, o.Bootstrap)
+		case "listeners":
+			err = parseEnvoyOverrideList(v, func() proto.Message {
+				li := new(envoy_config_listener_v3.Listener)
+				o.Listeners = append(o.Listeners, li)
+				return li
+			})
+		case "clusters":
+			err = parseEnvoyOverrideList(v, func() proto.Message {
+				c := new(envoy_config_cluster_v3.Cluster)
+				o.Clusters = append(o.Clusters, c)
+				return c
+			})
+		case "http_filters":
+			err = parseEnvoyOverrideList(v, func() proto.Message {
+				f := new(envoy_http_connection_manager.HttpFilter)
+				o.HTTPFilters = append(o.HTTPFilters, f)
+				return f
+			})
+		default:
+			err = errors.New("unknown field")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid envoy_overrides %s: %w", k, err)
+		}
+	}
+	return o, nil
+}
+
+func parseEnvoyOverrideList(v interface{}, next func() proto.Message) error {
+	items, ok := v.([]interface{})
+	if !ok {
+		return errors.New("expected a list")
+	}
+	for i, item := range items {
+		if err := parseEnvoyOverride(item, next()); err != nil {
+			return fmt.Errorf("%d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func parseEnvoyOverride(v interface{}, dst proto.Message) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.New("expected an object")
+	}
+	return parseJSONPB(m, dst, envoyOverridesUnmarshalOptions)
+}
+
+func (o *EnvoyOverrides) validate() error {
+	for i, li := range o.Listeners {
+		if li.GetName() == "" {
+			return fmt.Errorf("config: envoy_overrides listener %d: name is required", i)
+		}
+	}
+	for i, c := range o.Clusters {
+		if c.GetName() == "" {
+			return fmt.Errorf("config: envoy_overrides cluster %d: name is required", i)
+		}
+	}
+	for i, f := range o.HTTPFilters {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("config: envoy_overrides http filter %d: %w", i, err)
+		}
+	}
+	return nil
+}
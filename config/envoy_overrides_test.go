@@ -0,0 +1,87 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/testutil"
+)
+
+func TestDecodeEnvoyOverridesHookFunc(t *testing.T) {
+	decode := func(data interface{}) (*EnvoyOverrides, error) {
+		var dst struct {
+			Overrides *EnvoyOverrides `mapstructure:"envoy_overrides"`
+		}
+		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+			DecodeHook: decodeEnvoyOverridesHookFunc(),
+			Result:     &dst,
+		})
+		require.NoError(t, err)
+		err = decoder.Decode(map[string]interface{}{"envoy_overrides": data})
+		return dst.Overrides, err
+	}
+
+	t.Run("object", func(t *testing.T) {
+		o, err := decode(map[interface{}]interface{}{
+			"bootstrap": map[interface{}]interface{}{
+				"overload_manager": map[interface{}]interface{}{
+					"refresh_interval": "1s",
+				},
+			},
+			"clusters": []interface{}{
+				map[interface{}]interface{}{
+					"name":            "pomerium-authorize",
+					"connect_timeout": "5s",
+				},
+			},
+			"listeners": []interface{}{
+				map[interface{}]interface{}{
+					"name":                              "http-ingress",
+					"per_connection_buffer_limit_bytes": 1024,
+				},
+			},
+			"http_filters": []interface{}{
+				map[interface{}]interface{}{
+					"name": "envoy.filters.http.cors",
+					"typed_config": map[interface{}]interface{}{
+						"@type": "type.googleapis.com/envoy.extensions.filters.http.cors.v3.Cors",
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		testutil.AssertProtoJSONEqual(t, `{ "overloadManager": { "refreshInterval": "1s" } }`, o.Bootstrap)
+		testutil.AssertProtoJSONEqual(t, `[{ "name": "pomerium-authorize", "connectTimeout": "5s" }]`, o.Clusters)
+		testutil.AssertProtoJSONEqual(t, `[{ "name": "http-ingress", "perConnectionBufferLimitBytes": 1024 }]`, o.Listeners)
+		testutil.AssertProtoJSONEqual(t, `[{
+			"name": "envoy.filters.http.cors",
+			"typedConfig": { "@type": "type.googleapis.com/envoy.extensions.filters.http.cors.v3.Cors" }
+		}]`, o.HTTPFilters)
+		assert.NoError(t, o.validate())
+	})
+	t.Run("string", func(t *testing.T) {
+		o, err := decode(`{"clusters": [{"name": "example", "connect_timeout": "5s"}]}`)
+		require.NoError(t, err)
+		testutil.AssertProtoJSONEqual(t, `[{ "name": "example", "connectTimeout": "5s" }]`, o.Clusters)
+	})
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := decode(map[string]interface{}{"routes": []interface{}{}})
+		assert.Error(t, err)
+	})
+	t.Run("unknown field", func(t *testing.T) {
+		_, err := decode(map[string]interface{}{
+			"clusters": []interface{}{map[string]interface{}{"name": "example", "not_a_field": true}},
+		})
+		assert.Error(t, err)
+	})
+	t.Run("missing name", func(t *testing.T) {
+		o, err := decode(map[string]interface{}{
+			"clusters": []interface{}{map[string]interface{}{"connect_timeout": "5s"}},
+		})
+		require.NoError(t, err)
+		assert.Error(t, o.validate())
+	})
+}
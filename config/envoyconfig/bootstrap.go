@@ -52,8 +52,8 @@ func (b *Builder) BuildBootstrapLayeredRuntime() (*envoy_config_bootstrap_v3.Lay
 }
 
 // BuildBootstrapStaticResources builds the static resources for the envoy bootstrap. It includes the control plane
-// cluster.
-func (b *Builder) BuildBootstrapStaticResources() (*envoy_config_bootstrap_v3.Bootstrap_StaticResources, error) {
+// cluster and, if configured, the SPIRE agent cluster.
+func (b *Builder) BuildBootstrapStaticResources(cfg *config.Config) (*envoy_config_bootstrap_v3.Bootstrap_StaticResources, error) {
 	grpcAddr, err := parseAddress(b.localGRPCAddress)
 	if err != nil {
 		return nil, fmt.Errorf("envoyconfig: invalid local gRPC address: %w", err)
@@ -94,6 +94,9 @@ func (b *Builder) BuildBootstrapStaticResources() (*envoy_config_bootstrap_v3.Bo
 			controlPlaneCluster,
 		},
 	}
+	if cfg.Options.SPIREAgentSocket != "" {
+		staticCfg.Clusters = append(staticCfg.Clusters, buildSPIREAgentCluster(cfg.Options.SPIREAgentSocket))
+	}
 
 	return staticCfg, nil
 }
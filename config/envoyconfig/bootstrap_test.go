@@ -59,7 +59,7 @@ func TestBuilder_BuildBootstrapLayeredRuntime(t *testing.T) {
 func TestBuilder_BuildBootstrapStaticResources(t *testing.T) {
 	t.Run("valid", func(t *testing.T) {
 		b := New("localhost:1111", "localhost:2222", filemgr.NewManager(), nil)
-		staticCfg, err := b.BuildBootstrapStaticResources()
+		staticCfg, err := b.BuildBootstrapStaticResources(&config.Config{Options: &config.Options{}})
 		assert.NoError(t, err)
 		testutil.AssertProtoJSONEqual(t, `
 			{
@@ -89,9 +89,40 @@ func TestBuilder_BuildBootstrapStaticResources(t *testing.T) {
 			}
 		`, staticCfg)
 	})
+	t.Run("spire agent", func(t *testing.T) {
+		b := New("localhost:1111", "localhost:2222", filemgr.NewManager(), nil)
+		staticCfg, err := b.BuildBootstrapStaticResources(&config.Config{Options: &config.Options{
+			SPIREAgentSocket: "/run/spire/sockets/agent.sock",
+		}})
+		assert.NoError(t, err)
+		if assert.Len(t, staticCfg.Clusters, 2) {
+			testutil.AssertProtoJSONEqual(t, `
+				{
+					"name": "pomerium-spire-agent",
+					"type": "STATIC",
+					"connectTimeout": "5s",
+					"http2ProtocolOptions": {},
+					"loadAssignment": {
+						"clusterName": "pomerium-spire-agent",
+						"endpoints": [{
+							"lbEndpoints": [{
+								"endpoint": {
+									"address": {
+										"pipe": {
+											"path": "/run/spire/sockets/agent.sock"
+										}
+									}
+								}
+							}]
+						}]
+					}
+				}
+			`, staticCfg.Clusters[1])
+		}
+	})
 	t.Run("bad gRPC address", func(t *testing.T) {
 		b := New("xyz:zyx", "localhost:2222", filemgr.NewManager(), nil)
-		_, err := b.BuildBootstrapStaticResources()
+		_, err := b.BuildBootstrapStaticResources(&config.Config{Options: &config.Options{}})
 		assert.Error(t, err)
 	})
 }
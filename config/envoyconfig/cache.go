@@ -0,0 +1,76 @@
+package envoyconfig
+
+import (
+	"fmt"
+	"sort"
+
+	envoy_extensions_cache_simple_http_cache_v3alpha "github.com/envoyproxy/go-control-plane/envoy/extensions/cache/simple_http_cache/v3alpha"
+	envoy_extensions_filters_http_cache_v3alpha "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/cache/v3alpha"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoy_type_matcher_v3 "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/hashutil"
+)
+
+// getCacheID returns the id of the cache of a policy. Public routes have their own caches, since they're
+// checked before requests are authorized.
+func getCacheID(policy *config.Policy) string {
+	return fmt.Sprintf("%x", hashutil.MustHash(struct {
+		Cache  *config.Cache
+		Public bool
+	}{policy.Cache, policy.AllowPublicUnauthenticatedAccess}))
+}
+
+// buildCacheFilters builds the filters which cache the responses of policies with a cache, for either public or
+// other routes. The caches of public routes come before authorization, so that cached responses are served
+// without calling the authorize service.
+//
+// Envoy configures caches per listener, so there is a cache for each distinct cache of the policies. Requests
+// with an authorization header bypass a cache, so lua filters add one for the caches of other routes and remove
+// it afterwards.
+func buildCacheFilters(options *config.Options, public bool) []*envoy_http_connection_manager.HttpFilter {
+	if !config.IsProxy(options.Services) {
+		return nil
+	}
+
+	caches := make(map[string]*config.Cache)
+	for _, p := range options.GetAllPolicies() {
+		if p.Cache != nil && p.AllowPublicUnauthenticatedAccess == public {
+			caches[getCacheID(&p)] = p.Cache
+		}
+	}
+	if len(caches) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(caches))
+	for id := range caches {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var filters []*envoy_http_connection_manager.HttpFilter
+	for _, id := range ids {
+		filters = append(filters,
+			newLuaFilter(fmt.Sprintf(luascripts.CacheSelect, id)),
+			&envoy_http_connection_manager.HttpFilter{
+				Name: "envoy.filters.http.cache",
+				ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+					TypedConfig: marshalAny(buildCacheConfig(caches[id])),
+				},
+			})
+	}
+	filters = append(filters, newLuaFilter(luascripts.CacheRestore))
+	return filters
+}
+
+func buildCacheConfig(cache *config.Cache) *envoy_extensions_filters_http_cache_v3alpha.CacheConfig {
+	return &envoy_extensions_filters_http_cache_v3alpha.CacheConfig{
+		TypedConfig: marshalAny(&envoy_extensions_cache_simple_http_cache_v3alpha.SimpleHttpCacheConfig{}),
+		// compressed responses vary by the accept-encoding header
+		AllowedVaryHeaders: []*envoy_type_matcher_v3.StringMatcher{{
+			MatchPattern: &envoy_type_matcher_v3.StringMatcher_Exact{Exact: "accept-encoding"},
+		}},
+		MaxBodyBytes: cache.GetMaxBodySize(),
+	}
+}
@@ -0,0 +1,72 @@
+package envoyconfig
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
+	"github.com/pomerium/pomerium/internal/testutil"
+)
+
+func Test_buildCacheFilters(t *testing.T) {
+	cache := &config.Cache{MaxBodySize: 4096, TTL: time.Minute}
+	options := config.NewDefaultOptions()
+	options.Services = "proxy"
+	options.Policies = []config.Policy{
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:   "/a",
+			Cache:  cache,
+		},
+		{
+			Source:                           &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:                             "/b",
+			Cache:                            cache,
+			AllowPublicUnauthenticatedAccess: true,
+		},
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:   "/c",
+		},
+	}
+	id := getCacheID(&options.Policies[0])
+	publicID := getCacheID(&options.Policies[1])
+	assert.NotEqual(t, id, publicID, "public routes should have their own cache")
+
+	filters := buildCacheFilters(options, false)
+	require.Len(t, filters, 3)
+	testutil.AssertProtoJSONEqual(t, `{
+		"name": "envoy.filters.http.cache",
+		"typedConfig": {
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.cache.v3alpha.CacheConfig",
+			"typedConfig": {
+				"@type": "type.googleapis.com/envoy.extensions.cache.simple_http_cache.v3alpha.SimpleHttpCacheConfig"
+			},
+			"allowedVaryHeaders": [{ "exact": "accept-encoding" }],
+			"maxBodyBytes": 4096
+		}
+	}`, filters[1])
+	assert.Contains(t, filters[0].GetTypedConfig().String(), id)
+
+	filters = buildCacheFilters(options, true)
+	require.Len(t, filters, 3)
+	assert.Contains(t, filters[0].GetTypedConfig().String(), publicID)
+
+	b := &Builder{filemgr: filemgr.NewManager()}
+	routes, err := b.buildPolicyRoutes(options, config.MainListenerName, "example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 3)
+	fields := routes[0].GetMetadata().GetFilterMetadata()["envoy.filters.http.lua"].GetFields()
+	assert.Equal(t, id, fields["cache"].GetStringValue())
+	assert.Equal(t, float64(60), fields["cache_ttl"].GetNumberValue())
+	assert.NotContains(t, routes[2].GetMetadata().GetFilterMetadata()["envoy.filters.http.lua"].GetFields(), "cache")
+
+	options.Policies = options.Policies[2:]
+	assert.Empty(t, buildCacheFilters(options, false))
+	assert.Empty(t, buildCacheFilters(options, true))
+}
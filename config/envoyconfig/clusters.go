@@ -85,8 +85,16 @@ func (b *Builder) BuildClusters(ctx context.Context, cfg *config.Config) ([]*env
 				clusters = append(clusters, cluster)
 			}
 		}
+
+		extProcClusters, err := b.buildExtProcClusters(ctx, cfg.Options)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, extProcClusters...)
 	}
 
+	clusters = applyClusterOverrides(cfg.Options, clusters)
+
 	if err = validateClusters(clusters); err != nil {
 		return nil, err
 	}
@@ -176,6 +184,9 @@ func (b *Builder) buildInternalTransportSocket(ctx context.Context, options *con
 	if err != nil {
 		log.Error(ctx).Err(err).Msg("unable to enable certificate verification because no root CAs were found")
 	} else {
+		if internalCA := options.GetInternalCA(); len(internalCA) > 0 {
+			bs = append(append(bs, '\n'), internalCA...)
+		}
 		validationContext.TrustedCa = b.filemgr.BytesDataSource("ca.pem", bs)
 	}
 	tlsContext := &envoy_extensions_transport_sockets_tls_v3.UpstreamTlsContext{
@@ -187,6 +198,16 @@ func (b *Builder) buildInternalTransportSocket(ctx context.Context, options *con
 		},
 		Sni: sni,
 	}
+	// present the SVID to the other pomerium services so that they can verify this service's identity
+	if options.SPIREAgentSocket != "" {
+		tlsContext.CommonTlsContext.TlsCertificateSdsSecretConfigs = buildSPIRESVIDSdsSecretConfigs()
+	} else if cert, err := options.GetGRPCClientCertificate(); err != nil {
+		log.Error(ctx).Err(err).Msg("invalid grpc client certificate")
+	} else if cert != nil {
+		tlsContext.CommonTlsContext.TlsCertificates = []*envoy_extensions_transport_sockets_tls_v3.TlsCertificate{
+			b.envoyTLSCertificateFromGoTLSCertificate(ctx, cert),
+		}
+	}
 	tlsConfig := marshalAny(tlsContext)
 	return &envoy_config_core_v3.TransportSocket{
 		Name: "tls",
@@ -252,6 +273,19 @@ func (b *Builder) buildPolicyTransportSocket(
 		tlsContext.CommonTlsContext.TlsCertificates = append(tlsContext.CommonTlsContext.TlsCertificates,
 			b.envoyTLSCertificateFromGoTLSCertificate(ctx, policy.ClientCertificate))
 	}
+	if policy.TLSSPIFFEClientCertificate {
+		tlsContext.CommonTlsContext.TlsCertificateSdsSecretConfigs = buildSPIRESVIDSdsSecretConfigs()
+	}
+	if policy.TLSUpstreamSPIFFEID != "" {
+		tlsContext.CommonTlsContext.ValidationContextType = buildSPIREValidationContext(
+			&envoy_extensions_transport_sockets_tls_v3.CertificateValidationContext{
+				MatchSubjectAltNames: []*envoy_type_matcher_v3.StringMatcher{{
+					MatchPattern: &envoy_type_matcher_v3.StringMatcher_Exact{
+						Exact: policy.TLSUpstreamSPIFFEID,
+					},
+				}},
+			})
+	}
 
 	tlsConfig := marshalAny(tlsContext)
 	return &envoy_config_core_v3.TransportSocket{
@@ -284,7 +318,7 @@ func (b *Builder) buildPolicyValidationContext(
 	} else if policy.TLSCustomCA != "" {
 		bs, err := base64.StdEncoding.DecodeString(policy.TLSCustomCA)
 		if err != nil {
-			log.Error(ctx).Err(err).Msg("invalid custom CA certificate")
+			return nil, fmt.Errorf("invalid custom CA certificate: %w", err)
 		}
 		validationContext.TrustedCa = b.filemgr.BytesDataSource("custom-ca.pem", bs)
 	} else {
@@ -402,11 +436,15 @@ func (b *Builder) buildLbEndpoints(endpoints []Endpoint) ([]*envoy_config_endpoi
 		if e.url.Hostname() == "localhost" {
 			u.Host = strings.Replace(e.url.Host, "localhost", "127.0.0.1", -1)
 		}
+		addr := u.Host
+		if urlutil.IsUnix(&u) {
+			addr = "unix://" + u.Path
+		}
 
 		lbe := &envoy_config_endpoint_v3.LbEndpoint{
 			HostIdentifier: &envoy_config_endpoint_v3.LbEndpoint_Endpoint{
 				Endpoint: &envoy_config_endpoint_v3.Endpoint{
-					Address: buildAddress(u.Host, defaultPort),
+					Address: buildAddress(addr, defaultPort),
 				},
 			},
 			LoadBalancingWeight: e.loadBalancerWeight,
@@ -476,9 +514,12 @@ func validateClusterNamesUnique(clusters []*envoy_config_cluster_v3.Cluster) err
 }
 
 func getClusterDiscoveryType(lbEndpoints []*envoy_config_endpoint_v3.LbEndpoint) *envoy_config_cluster_v3.Cluster_Type {
-	// for IPs we use a static discovery type, otherwise we use DNS
+	// for IPs and unix domain sockets we use a static discovery type, otherwise we use DNS
 	allIP := true
 	for _, lbe := range lbEndpoints {
+		if lbe.GetEndpoint().GetAddress().GetPipe() != nil {
+			continue
+		}
 		if net.ParseIP(urlutil.StripPort(lbe.GetEndpoint().GetAddress().GetSocketAddress().GetAddress())) == nil {
 			allIP = false
 		}
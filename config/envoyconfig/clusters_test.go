@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/types/known/wrapperspb"
@@ -245,6 +246,52 @@ func Test_buildPolicyTransportSocket(t *testing.T) {
 			}
 		`, ts)
 	})
+	t.Run("invalid custom ca", func(t *testing.T) {
+		_, err := b.buildPolicyTransportSocket(ctx, o1, &config.Policy{
+			To:          mustParseWeightedURLs(t, "https://example.com"),
+			TLSCustomCA: "!",
+		}, *mustParseURL(t, "https://example.com"))
+		assert.Error(t, err)
+	})
+	t.Run("spiffe", func(t *testing.T) {
+		ts, err := b.buildPolicyTransportSocket(ctx, o1, &config.Policy{
+			To:                         mustParseWeightedURLs(t, "https://example.com"),
+			TLSSPIFFEClientCertificate: true,
+			TLSUpstreamSPIFFEID:        "spiffe://example.com/upstream",
+		}, *mustParseURL(t, "https://example.com"))
+		require.NoError(t, err)
+		var tlsContext envoy_extensions_transport_sockets_tls_v3.UpstreamTlsContext
+		require.NoError(t, ts.GetTypedConfig().UnmarshalTo(&tlsContext))
+		sdsConfig := `{
+			"resourceApiVersion": "V3",
+			"apiConfigSource": {
+				"apiType": "GRPC",
+				"transportApiVersion": "V3",
+				"grpcServices": [{
+					"envoyGrpc": { "clusterName": "pomerium-spire-agent" }
+				}]
+			}
+		}`
+		testutil.AssertProtoJSONEqual(t, `
+			[{
+				"name": "default",
+				"sdsConfig": `+sdsConfig+`
+			}]
+		`, tlsContext.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs())
+		testutil.AssertProtoJSONEqual(t, `
+			{
+				"defaultValidationContext": {
+					"matchSubjectAltNames": [{
+						"exact": "spiffe://example.com/upstream"
+					}]
+				},
+				"validationContextSdsSecretConfig": {
+					"name": "ROOTCA",
+					"sdsConfig": `+sdsConfig+`
+				}
+			}
+		`, tlsContext.GetCommonTlsContext().GetCombinedValidationContext())
+	})
 	t.Run("options custom ca", func(t *testing.T) {
 		ts, err := b.buildPolicyTransportSocket(ctx, o2, &config.Policy{
 			To: mustParseWeightedURLs(t, "https://example.com"),
@@ -749,6 +796,32 @@ func Test_buildCluster(t *testing.T) {
 			}
 		`, cluster)
 	})
+	t.Run("unix", func(t *testing.T) {
+		endpoints, err := b.buildPolicyEndpoints(ctx, o1, &config.Policy{
+			To: mustParseWeightedURLs(t, "unix:///var/run/app.sock"),
+		})
+		require.NoError(t, err)
+		cluster := newDefaultEnvoyClusterConfig()
+		err = b.buildCluster(cluster, "example", endpoints, false)
+		require.NoErrorf(t, err, "cluster %+v", cluster)
+		assert.Equal(t, envoy_config_cluster_v3.Cluster_STATIC, cluster.GetType())
+		testutil.AssertProtoJSONEqual(t, `
+			{
+				"clusterName": "example",
+				"endpoints": [{
+					"lbEndpoints": [{
+						"endpoint": {
+							"address": {
+								"pipe": {
+									"path": "/var/run/app.sock"
+								}
+							}
+						}
+					}]
+				}]
+			}
+		`, cluster.GetLoadAssignment())
+	})
 	t.Run("outlier", func(t *testing.T) {
 		endpoints, err := b.buildPolicyEndpoints(ctx, o1, &config.Policy{
 			To: mustParseWeightedURLs(t, "http://example.com"),
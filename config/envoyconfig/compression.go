@@ -0,0 +1,100 @@
+package envoyconfig
+
+import (
+	"fmt"
+	"sort"
+
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_extensions_compression_brotli_compressor_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/compression/brotli/compressor/v3"
+	envoy_extensions_compression_gzip_compressor_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/compression/gzip/compressor/v3"
+	envoy_extensions_filters_http_compressor_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/compressor/v3"
+	envoy_extensions_filters_http_lua_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/lua/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/hashutil"
+)
+
+func getCompressionID(compression *config.Compression) string {
+	return fmt.Sprintf("%x", hashutil.MustHash(compression))
+}
+
+// buildCompressionFilters builds the filters which compress the responses of policies with compression.
+//
+// Envoy configures compressors per listener, so there are compressors for each distinct compression of the
+// policies. Compressors only compress a response if the request has an accept-encoding header, so lua
+// filters remove it for the compressors of other routes, and restore it for the upstream afterwards.
+func buildCompressionFilters(options *config.Options) []*envoy_http_connection_manager.HttpFilter {
+	if !config.IsProxy(options.Services) {
+		return nil
+	}
+
+	compressions := make(map[string]*config.Compression)
+	for _, p := range options.GetAllPolicies() {
+		if p.Compression != nil {
+			compressions[getCompressionID(p.Compression)] = p.Compression
+		}
+	}
+	if len(compressions) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(compressions))
+	for id := range compressions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	filters := []*envoy_http_connection_manager.HttpFilter{
+		newLuaFilter(luascripts.CompressionSave),
+	}
+	for _, id := range ids {
+		filters = append(filters, newLuaFilter(fmt.Sprintf(luascripts.CompressionSelect, id)))
+		for _, algorithm := range compressions[id].GetAlgorithms() {
+			filters = append(filters, &envoy_http_connection_manager.HttpFilter{
+				Name: "envoy.filters.http.compressor",
+				ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+					TypedConfig: marshalAny(buildCompressor(compressions[id], algorithm)),
+				},
+			})
+		}
+	}
+	filters = append(filters, newLuaFilter(luascripts.CompressionRestore))
+	return filters
+}
+
+func buildCompressor(compression *config.Compression, algorithm string) *envoy_extensions_filters_http_compressor_v3.Compressor {
+	library := &envoy_config_core_v3.TypedExtensionConfig{}
+	switch algorithm {
+	case "brotli":
+		library.Name = "envoy.compression.brotli.compressor"
+		library.TypedConfig = marshalAny(&envoy_extensions_compression_brotli_compressor_v3.Brotli{})
+	default:
+		library.Name = "envoy.compression.gzip.compressor"
+		library.TypedConfig = marshalAny(&envoy_extensions_compression_gzip_compressor_v3.Gzip{})
+	}
+
+	common := &envoy_extensions_filters_http_compressor_v3.Compressor_CommonDirectionConfig{
+		ContentType: compression.ContentTypes,
+	}
+	if compression.MinContentLength > 0 {
+		common.MinContentLength = wrapperspb.UInt32(compression.MinContentLength)
+	}
+	return &envoy_extensions_filters_http_compressor_v3.Compressor{
+		CompressorLibrary: library,
+		ResponseDirectionConfig: &envoy_extensions_filters_http_compressor_v3.Compressor_ResponseDirectionConfig{
+			CommonConfig: common,
+		},
+	}
+}
+
+func newLuaFilter(code string) *envoy_http_connection_manager.HttpFilter {
+	return &envoy_http_connection_manager.HttpFilter{
+		Name: "envoy.filters.http.lua",
+		ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+			TypedConfig: marshalAny(&envoy_extensions_filters_http_lua_v3.Lua{
+				InlineCode: code,
+			}),
+		},
+	}
+}
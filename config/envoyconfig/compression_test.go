@@ -0,0 +1,77 @@
+package envoyconfig
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
+	"github.com/pomerium/pomerium/internal/testutil"
+)
+
+func Test_buildCompressionFilters(t *testing.T) {
+	compression := &config.Compression{
+		Algorithms:       []string{"brotli", "gzip"},
+		ContentTypes:     []string{"application/json"},
+		MinContentLength: 1024,
+	}
+	options := config.NewDefaultOptions()
+	options.Services = "proxy"
+	options.Policies = []config.Policy{
+		{
+			Source:      &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:        "/a",
+			Compression: compression,
+		},
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:   "/b",
+		},
+	}
+	id := getCompressionID(compression)
+
+	filters := buildCompressionFilters(options)
+	require.Len(t, filters, 5)
+	testutil.AssertProtoJSONEqual(t, `[
+		{
+			"name": "envoy.filters.http.compressor",
+			"typedConfig": {
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor",
+				"compressorLibrary": {
+					"name": "envoy.compression.brotli.compressor",
+					"typedConfig": { "@type": "type.googleapis.com/envoy.extensions.compression.brotli.compressor.v3.Brotli" }
+				},
+				"responseDirectionConfig": {
+					"commonConfig": { "contentType": ["application/json"], "minContentLength": 1024 }
+				}
+			}
+		},
+		{
+			"name": "envoy.filters.http.compressor",
+			"typedConfig": {
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.compressor.v3.Compressor",
+				"compressorLibrary": {
+					"name": "envoy.compression.gzip.compressor",
+					"typedConfig": { "@type": "type.googleapis.com/envoy.extensions.compression.gzip.compressor.v3.Gzip" }
+				},
+				"responseDirectionConfig": {
+					"commonConfig": { "contentType": ["application/json"], "minContentLength": 1024 }
+				}
+			}
+		}
+	]`, filters[2:4])
+	assert.Contains(t, filters[1].GetTypedConfig().String(), id)
+
+	b := &Builder{filemgr: filemgr.NewManager()}
+	routes, err := b.buildPolicyRoutes(options, config.MainListenerName, "example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	assert.Equal(t, id, routes[0].GetMetadata().GetFilterMetadata()["envoy.filters.http.lua"].GetFields()["compression"].GetStringValue())
+	assert.NotContains(t, routes[1].GetMetadata().GetFilterMetadata()["envoy.filters.http.lua"].GetFields(), "compression")
+
+	options.Policies = options.Policies[1:]
+	assert.Empty(t, buildCompressionFilters(options))
+}
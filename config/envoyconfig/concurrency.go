@@ -0,0 +1,17 @@
+package envoyconfig
+
+import (
+	"github.com/pomerium/pomerium/config"
+)
+
+// hasConcurrencyLimits returns true if any route limits the concurrent requests of a user. The control plane
+// releases the lease authorize acquires on one of those requests when envoy logs the completed request, so the
+// access logs are sent to it whatever the proxy log level.
+func hasConcurrencyLimits(options *config.Options) bool {
+	for _, p := range options.GetAllPolicies() {
+		if p.MaxConcurrentRequestsPerUser > 0 {
+			return true
+		}
+	}
+	return false
+}
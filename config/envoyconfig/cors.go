@@ -0,0 +1,74 @@
+package envoyconfig
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoy_extensions_filters_http_cors_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/cors/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoy_type_matcher_v3 "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+// buildCORSFilter builds the CORS filter, which applies the cors policies of the routes. It answers pre-flight
+// requests itself, so it comes before authorization.
+func buildCORSFilter(options *config.Options) *envoy_http_connection_manager.HttpFilter {
+	if !hasCORSPolicy(options) {
+		return nil
+	}
+
+	return &envoy_http_connection_manager.HttpFilter{
+		Name: "envoy.filters.http.cors",
+		ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+			TypedConfig: marshalAny(&envoy_extensions_filters_http_cors_v3.Cors{}),
+		},
+	}
+}
+
+func buildCORSPolicy(cors *config.CORS) *envoy_config_route_v3.CorsPolicy {
+	policy := &envoy_config_route_v3.CorsPolicy{
+		AllowMethods:     strings.Join(cors.AllowedMethods, ","),
+		AllowHeaders:     strings.Join(cors.AllowedHeaders, ","),
+		ExposeHeaders:    strings.Join(cors.ExposedHeaders, ","),
+		AllowCredentials: wrapperspb.Bool(cors.AllowCredentials),
+	}
+	for _, origin := range cors.AllowedOrigins {
+		matcher := &envoy_type_matcher_v3.StringMatcher{}
+		if origin == "*" {
+			matcher.MatchPattern = &envoy_type_matcher_v3.StringMatcher_SafeRegex{
+				SafeRegex: &envoy_type_matcher_v3.RegexMatcher{
+					EngineType: &envoy_type_matcher_v3.RegexMatcher_GoogleRe2{
+						GoogleRe2: &envoy_type_matcher_v3.RegexMatcher_GoogleRE2{},
+					},
+					Regex: ".*",
+				},
+			}
+		} else {
+			// the origin header never has a trailing slash
+			matcher.MatchPattern = &envoy_type_matcher_v3.StringMatcher_Exact{
+				Exact: strings.TrimSuffix(origin, "/"),
+			}
+		}
+		policy.AllowOriginStringMatch = append(policy.AllowOriginStringMatch, matcher)
+	}
+	if cors.MaxAge > 0 {
+		policy.MaxAge = strconv.FormatInt(int64(cors.MaxAge/time.Second), 10)
+	}
+	return policy
+}
+
+func hasCORSPolicy(options *config.Options) bool {
+	if !config.IsProxy(options.Services) {
+		return false
+	}
+	for _, p := range options.GetAllPolicies() {
+		if p.CORS != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package envoyconfig
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
+	"github.com/pomerium/pomerium/internal/testutil"
+)
+
+func Test_buildCORS(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.Services = "proxy"
+	options.Policies = []config.Policy{
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			To:     mustParseWeightedURLs(t, "https://to.example.com"),
+			Path:   "/a",
+			CORS: &config.CORS{
+				AllowedOrigins:   []string{"https://app.example.com/", "https://admin.example.com"},
+				AllowedMethods:   []string{"GET", "POST"},
+				AllowedHeaders:   []string{"Content-Type", "X-Requested-With"},
+				ExposedHeaders:   []string{"X-Request-Id"},
+				AllowCredentials: true,
+				MaxAge:           10 * time.Minute,
+			},
+		},
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			To:     mustParseWeightedURLs(t, "https://to.example.com"),
+			Path:   "/b",
+			CORS:   &config.CORS{AllowedOrigins: []string{"*"}},
+		},
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			To:     mustParseWeightedURLs(t, "https://to.example.com"),
+			Path:   "/c",
+		},
+	}
+
+	testutil.AssertProtoJSONEqual(t, `{
+		"name": "envoy.filters.http.cors",
+		"typedConfig": {
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.cors.v3.Cors"
+		}
+	}`, buildCORSFilter(options))
+
+	b := &Builder{filemgr: filemgr.NewManager()}
+	routes, err := b.buildPolicyRoutes(options, config.MainListenerName, "example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 3)
+	testutil.AssertProtoJSONEqual(t, `{
+		"allowOriginStringMatch": [
+			{ "exact": "https://app.example.com" },
+			{ "exact": "https://admin.example.com" }
+		],
+		"allowMethods": "GET,POST",
+		"allowHeaders": "Content-Type,X-Requested-With",
+		"exposeHeaders": "X-Request-Id",
+		"maxAge": "600",
+		"allowCredentials": true
+	}`, routes[0].GetRoute().GetCors())
+	testutil.AssertProtoJSONEqual(t, `{
+		"allowOriginStringMatch": [
+			{ "safeRegex": { "googleRe2": {}, "regex": ".*" } }
+		],
+		"allowCredentials": false
+	}`, routes[1].GetRoute().GetCors())
+	assert.Nil(t, routes[2].GetRoute().GetCors())
+
+	options.Policies = options.Policies[2:]
+	assert.Nil(t, buildCORSFilter(options))
+}
@@ -32,6 +32,7 @@ import (
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 )
 
@@ -76,18 +77,7 @@ func newDefaultEnvoyClusterConfig() *envoy_config_cluster_v3.Cluster {
 }
 
 func buildAccessLogs(options *config.Options) []*envoy_config_accesslog_v3.AccessLog {
-	lvl := options.ProxyLogLevel
-	if lvl == "" {
-		lvl = options.LogLevel
-	}
-	if lvl == "" {
-		lvl = "debug"
-	}
-
-	switch lvl {
-	case "trace", "debug", "info":
-	default:
-		// don't log access requests for levels > info
+	if !options.IsProxyAccessLogEnabled() && !hasConcurrencyLimits(options) {
 		return nil
 	}
 
@@ -110,7 +100,15 @@ func buildAccessLogs(options *config.Options) []*envoy_config_accesslog_v3.Acces
 	}}
 }
 
+// buildAddress builds the address of a listener or an endpoint. Addresses starting with unix:// are unix domain
+// sockets.
 func buildAddress(hostport string, defaultPort int) *envoy_config_core_v3.Address {
+	if path, ok := urlutil.UnixSocketPath(hostport); ok {
+		return &envoy_config_core_v3.Address{
+			Address: &envoy_config_core_v3.Address_Pipe{Pipe: &envoy_config_core_v3.Pipe{Path: path}},
+		}
+	}
+
 	host, strport, err := net.SplitHostPort(hostport)
 	if err != nil {
 		host = hostport
@@ -136,6 +134,14 @@ func buildAddress(hostport string, defaultPort int) *envoy_config_core_v3.Addres
 	}
 }
 
+func buildUDPAddress(hostport string, defaultPort int) *envoy_config_core_v3.Address {
+	addr := buildAddress(hostport, defaultPort)
+	if sa := addr.GetSocketAddress(); sa != nil {
+		sa.Protocol = envoy_config_core_v3.SocketAddress_UDP
+	}
+	return addr
+}
+
 func (b *Builder) envoyTLSCertificateFromGoTLSCertificate(
 	ctx context.Context,
 	cert *tls.Certificate,
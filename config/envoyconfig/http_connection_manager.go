@@ -1,12 +1,16 @@
 package envoyconfig
 
 import (
+	"errors"
+	"net/http"
+
 	envoy_config_accesslog_v3 "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
 )
 
 func (b *Builder) buildVirtualHost(
@@ -15,8 +19,9 @@ func (b *Builder) buildVirtualHost(
 	domain string,
 ) (*envoy_config_route_v3.VirtualHost, error) {
 	vh := &envoy_config_route_v3.VirtualHost{
-		Name:    name,
-		Domains: []string{domain},
+		Name:                 name,
+		Domains:              []string{domain},
+		TypedPerFilterConfig: buildVirtualHostRouteFilterConfig(options),
 	}
 
 	// these routes match /.pomerium/... and similar paths
@@ -47,13 +52,74 @@ func (b *Builder) buildLocalReplyConfig(
 	}
 
 	return &envoy_http_connection_manager.LocalReplyConfig{
-		Mappers: []*envoy_http_connection_manager.ResponseMapper{{
-			Filter: &envoy_config_accesslog_v3.AccessLogFilter{
-				FilterSpecifier: &envoy_config_accesslog_v3.AccessLogFilter_ResponseFlagFilter{
-					ResponseFlagFilter: &envoy_config_accesslog_v3.ResponseFlagFilter{},
+		Mappers: []*envoy_http_connection_manager.ResponseMapper{
+			{
+				// requests which fail because the authorize service can't be reached get a branded error page
+				Filter: &envoy_config_accesslog_v3.AccessLogFilter{
+					FilterSpecifier: &envoy_config_accesslog_v3.AccessLogFilter_AndFilter{
+						AndFilter: &envoy_config_accesslog_v3.AndFilter{
+							Filters: []*envoy_config_accesslog_v3.AccessLogFilter{
+								{
+									FilterSpecifier: &envoy_config_accesslog_v3.AccessLogFilter_StatusCodeFilter{
+										StatusCodeFilter: &envoy_config_accesslog_v3.StatusCodeFilter{
+											Comparison: &envoy_config_accesslog_v3.ComparisonFilter{
+												Op: envoy_config_accesslog_v3.ComparisonFilter_EQ,
+												Value: &envoy_config_core_v3.RuntimeUInt32{
+													DefaultValue: http.StatusServiceUnavailable,
+													RuntimeKey:   "pomerium.authorize_unavailable_status",
+												},
+											},
+										},
+									},
+								},
+								{
+									FilterSpecifier: &envoy_config_accesslog_v3.AccessLogFilter_ResponseFlagFilter{
+										ResponseFlagFilter: &envoy_config_accesslog_v3.ResponseFlagFilter{
+											Flags: []string{"UAEX"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				Body: &envoy_config_core_v3.DataSource{
+					Specifier: &envoy_config_core_v3.DataSource_InlineString{
+						InlineString: authorizeUnavailablePage,
+					},
+				},
+				BodyFormatOverride: &envoy_config_core_v3.SubstitutionFormatString{
+					Format: &envoy_config_core_v3.SubstitutionFormatString_TextFormatSource{
+						TextFormatSource: &envoy_config_core_v3.DataSource{
+							Specifier: &envoy_config_core_v3.DataSource_InlineString{
+								InlineString: "%LOCAL_REPLY_BODY%",
+							},
+						},
+					},
+					ContentType: "text/html; charset=UTF-8",
+				},
+				HeadersToAdd: headers,
+			},
+			{
+				Filter: &envoy_config_accesslog_v3.AccessLogFilter{
+					FilterSpecifier: &envoy_config_accesslog_v3.AccessLogFilter_ResponseFlagFilter{
+						ResponseFlagFilter: &envoy_config_accesslog_v3.ResponseFlagFilter{},
+					},
 				},
+				HeadersToAdd: headers,
 			},
-			HeadersToAdd: headers,
-		}},
+		},
 	}
 }
+
+// authorizeUnavailablePage is the error page returned when the authorize service can't be reached.
+var authorizeUnavailablePage = func() string {
+	page, err := (&httputil.HTTPError{
+		Status: http.StatusServiceUnavailable,
+		Err:    errors.New("the authorization service is unavailable, please try again later"),
+	}).RenderHTML()
+	if err != nil {
+		panic(err)
+	}
+	return string(page)
+}()
@@ -5,8 +5,10 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
 	"sort"
+	"strings"
 	"time"
 
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
@@ -16,7 +18,9 @@ import (
 	envoy_extensions_filters_http_lua_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/lua/v3"
 	envoy_extensions_filters_listener_proxy_protocol_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/listener/proxy_protocol/v3"
 	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoy_extensions_transport_sockets_quic_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/quic/v3"
 	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	envoy_type_matcher_v3 "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	envoy_type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
@@ -27,16 +31,27 @@ import (
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/hashutil"
+	"github.com/pomerium/pomerium/internal/internalca"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 )
 
-const listenerBufferLimit uint32 = 32 * 1024
+const (
+	listenerBufferLimit uint32 = 32 * 1024
+	// defaultAuthorizeMaxRequestBytes is the maximum size of a request body which is sent with the check request,
+	// for routes without a max_request_body_size
+	defaultAuthorizeMaxRequestBytes uint32 = 1024 * 1024
+	// altSvcMaxAge is how long clients remember that HTTP/3 is available, in seconds
+	altSvcMaxAge = 24 * 60 * 60
+)
 
 var (
-	disableExtAuthz *any.Any
-	tlsParams       = &envoy_extensions_transport_sockets_tls_v3.TlsParameters{
+	disableExtAuthz            *any.Any
+	disableExtAuthzRequestBody *any.Any
+	enableExtAuthzRequestBody  *any.Any
+	tlsParams                  = &envoy_extensions_transport_sockets_tls_v3.TlsParameters{
 		CipherSuites: []string{
 			"ECDHE-ECDSA-AES256-GCM-SHA384",
 			"ECDHE-RSA-AES256-GCM-SHA384",
@@ -47,6 +62,8 @@ var (
 		},
 		TlsMinimumProtocolVersion: envoy_extensions_transport_sockets_tls_v3.TlsParameters_TLSv1_2,
 	}
+	// http3ALPNProtocols are the ALPN protocols of the QUIC listener
+	http3ALPNProtocols = []string{"h3", "h3-29"}
 )
 
 func init() {
@@ -55,6 +72,18 @@ func init() {
 			Disabled: true,
 		},
 	})
+	disableExtAuthzRequestBody = marshalAny(&envoy_extensions_filters_http_ext_authz_v3.ExtAuthzPerRoute{
+		Override: &envoy_extensions_filters_http_ext_authz_v3.ExtAuthzPerRoute_CheckSettings{
+			CheckSettings: &envoy_extensions_filters_http_ext_authz_v3.CheckSettings{
+				DisableRequestBodyBuffering: true,
+			},
+		},
+	})
+	enableExtAuthzRequestBody = marshalAny(&envoy_extensions_filters_http_ext_authz_v3.ExtAuthzPerRoute{
+		Override: &envoy_extensions_filters_http_ext_authz_v3.ExtAuthzPerRoute_CheckSettings{
+			CheckSettings: &envoy_extensions_filters_http_ext_authz_v3.CheckSettings{},
+		},
+	})
 }
 
 // BuildListeners builds envoy listeners from the given config.
@@ -67,6 +96,24 @@ func (b *Builder) BuildListeners(ctx context.Context, cfg *config.Config) ([]*en
 			return nil, err
 		}
 		listeners = append(listeners, li)
+
+		if cfg.Options.GetCodecType() == config.CodecTypeHTTP3 && !cfg.Options.InsecureServer {
+			li, err := b.buildMainQUICListener(ctx, cfg)
+			if err != nil {
+				return nil, err
+			}
+			listeners = append(listeners, li)
+		}
+	}
+
+	if config.IsProxy(cfg.Options.Services) {
+		for _, l := range cfg.Options.Listeners {
+			li, err := b.buildHTTPListener(ctx, cfg, l.Name, l.Address)
+			if err != nil {
+				return nil, err
+			}
+			listeners = append(listeners, li)
+		}
 	}
 
 	if config.IsAuthorize(cfg.Options.Services) || config.IsDataBroker(cfg.Options.Services) {
@@ -85,10 +132,19 @@ func (b *Builder) BuildListeners(ctx context.Context, cfg *config.Config) ([]*en
 		listeners = append(listeners, li)
 	}
 
-	return listeners, nil
+	return applyListenerOverrides(cfg.Options, listeners), nil
 }
 
 func (b *Builder) buildMainListener(ctx context.Context, cfg *config.Config) (*envoy_config_listener_v3.Listener, error) {
+	return b.buildHTTPListener(ctx, cfg, config.MainListenerName, cfg.Options.Addr)
+}
+
+// buildHTTPListener builds the listener serving the routes of the named HTTP listener on the given address.
+func (b *Builder) buildHTTPListener(
+	ctx context.Context,
+	cfg *config.Config,
+	name, addr string,
+) (*envoy_config_listener_v3.Listener, error) {
 	listenerFilters := []*envoy_config_listener_v3.ListenerFilter{}
 	if cfg.Options.UseProxyProtocol {
 		proxyCfg := marshalAny(&envoy_extensions_filters_listener_proxy_protocol_v3.ProxyProtocol{})
@@ -101,18 +157,13 @@ func (b *Builder) buildMainListener(ctx context.Context, cfg *config.Config) (*e
 	}
 
 	if cfg.Options.InsecureServer {
-		allDomains, err := getAllRouteableDomains(cfg.Options, cfg.Options.Addr)
+		filter, err := b.buildMainHTTPConnectionManagerFilter(cfg.Options, name, "", false)
 		if err != nil {
 			return nil, err
 		}
 
-		filter, err := b.buildMainHTTPConnectionManagerFilter(cfg.Options, allDomains, "")
-		if err != nil {
-			return nil, err
-		}
-
-		li := newEnvoyListener("http-ingress")
-		li.Address = buildAddress(cfg.Options.Addr, 80)
+		li := newEnvoyListener(getHTTPListenerName("http-ingress", name))
+		li.Address = buildAddress(addr, 80)
 		li.ListenerFilters = listenerFilters
 		li.FilterChains = []*envoy_config_listener_v3.FilterChain{{
 			Filters: []*envoy_config_listener_v3.Filter{
@@ -130,9 +181,9 @@ func (b *Builder) buildMainListener(ctx context.Context, cfg *config.Config) (*e
 		},
 	})
 
-	chains, err := b.buildFilterChains(cfg.Options, cfg.Options.Addr,
+	chains, err := b.buildFilterChains(cfg.Options, addr,
 		func(tlsDomain string, httpDomains []string) (*envoy_config_listener_v3.FilterChain, error) {
-			filter, err := b.buildMainHTTPConnectionManagerFilter(cfg.Options, httpDomains, tlsDomain)
+			filter, err := b.buildMainHTTPConnectionManagerFilter(cfg.Options, name, tlsDomain, false)
 			if err != nil {
 				return nil, err
 			}
@@ -160,13 +211,57 @@ func (b *Builder) buildMainListener(ctx context.Context, cfg *config.Config) (*e
 		return nil, err
 	}
 
-	li := newEnvoyListener("https-ingress")
-	li.Address = buildAddress(cfg.Options.Addr, 443)
+	li := newEnvoyListener(getHTTPListenerName("https-ingress", name))
+	li.Address = buildAddress(addr, 443)
 	li.ListenerFilters = listenerFilters
 	li.FilterChains = chains
 	return li, nil
 }
 
+// buildMainQUICListener builds the listener which serves HTTP/3 over QUIC on the UDP port of the main listener.
+func (b *Builder) buildMainQUICListener(ctx context.Context, cfg *config.Config) (*envoy_config_listener_v3.Listener, error) {
+	chains, err := b.buildFilterChains(cfg.Options, cfg.Options.Addr,
+		func(tlsDomain string, httpDomains []string) (*envoy_config_listener_v3.FilterChain, error) {
+			filter, err := b.buildMainHTTPConnectionManagerFilter(cfg.Options, config.MainListenerName, tlsDomain, true)
+			if err != nil {
+				return nil, err
+			}
+			filterChain := &envoy_config_listener_v3.FilterChain{
+				Filters: []*envoy_config_listener_v3.Filter{filter},
+			}
+			if tlsDomain != "*" {
+				filterChain.FilterChainMatch = &envoy_config_listener_v3.FilterChainMatch{
+					ServerNames: []string{tlsDomain},
+				}
+			}
+			tlsContext := b.buildDownstreamTLSContext(ctx, cfg, tlsDomain)
+			if tlsContext != nil {
+				tlsContext.CommonTlsContext.AlpnProtocols = http3ALPNProtocols
+				quicConfig := marshalAny(&envoy_extensions_transport_sockets_quic_v3.QuicDownstreamTransport{
+					DownstreamTlsContext: tlsContext,
+				})
+				filterChain.TransportSocket = &envoy_config_core_v3.TransportSocket{
+					Name: "envoy.transport_sockets.quic",
+					ConfigType: &envoy_config_core_v3.TransportSocket_TypedConfig{
+						TypedConfig: quicConfig,
+					},
+				}
+			}
+			return filterChain, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	li := newEnvoyListener("quic-ingress")
+	li.Address = buildUDPAddress(cfg.Options.Addr, 443)
+	li.UdpListenerConfig = &envoy_config_listener_v3.UdpListenerConfig{
+		QuicOptions: &envoy_config_listener_v3.QuicProtocolOptions{},
+	}
+	li.FilterChains = chains
+	return li, nil
+}
+
 func (b *Builder) buildMetricsListener(cfg *config.Config) (*envoy_config_listener_v3.Listener, error) {
 	filter, err := b.buildMetricsHTTPConnectionManagerFilter()
 	if err != nil {
@@ -250,45 +345,106 @@ func (b *Builder) buildFilterChains(
 	options *config.Options, addr string,
 	callback func(tlsDomain string, httpDomains []string) (*envoy_config_listener_v3.FilterChain, error),
 ) ([]*envoy_config_listener_v3.FilterChain, error) {
-	allDomains, err := getAllRouteableDomains(options, addr)
+	var chains []*envoy_config_listener_v3.FilterChain
+	err := visitTLSDomains(options, addr, func(tlsDomain string, httpDomains []string) error {
+		chain, err := callback(tlsDomain, httpDomains)
+		if err != nil {
+			return err
+		}
+		chains = append(chains, chain)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return chains, nil
+}
+
+// visitTLSDomains calls the callback with each TLS domain served on the address, and the domains routed for it,
+// followed by "*" and all the routeable domains.
+func visitTLSDomains(
+	options *config.Options, addr string,
+	callback func(tlsDomain string, httpDomains []string) error,
+) error {
+	allDomains, err := getAllRouteableDomains(options, addr)
+	if err != nil {
+		return err
+	}
 
 	tlsDomains, err := getAllTLSDomains(options, addr)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var chains []*envoy_config_listener_v3.FilterChain
 	for _, domain := range tlsDomains {
 		routeableDomains, err := getRouteableDomainsForTLSDomain(options, addr, domain)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// first we match on SNI
-		chain, err := callback(domain, routeableDomains)
-		if err != nil {
-			return nil, err
+		if err := callback(domain, routeableDomains); err != nil {
+			return err
 		}
-		chains = append(chains, chain)
 	}
 
 	// if there are no SNI matches we match on HTTP host
-	chain, err := callback("*", allDomains)
-	if err != nil {
-		return nil, err
+	return callback("*", allDomains)
+}
+
+// BuildRouteConfigurations builds the route configurations of the main HTTP connection managers of the listeners
+// built by BuildListeners. They're served by RDS, rather than inlined in the listeners, so that changing a route
+// only updates its route configuration instead of updating, and draining, the listeners.
+func (b *Builder) BuildRouteConfigurations(ctx context.Context, cfg *config.Config) ([]*envoy_config_route_v3.RouteConfiguration, error) {
+	var routeConfigurations []*envoy_config_route_v3.RouteConfiguration
+	add := func(listener, addr string) error {
+		if cfg.Options.InsecureServer {
+			allDomains, err := getAllRouteableDomains(cfg.Options, addr)
+			if err != nil {
+				return err
+			}
+			rc, err := b.buildMainRouteConfiguration(cfg.Options, listener, allDomains, "")
+			if err != nil {
+				return err
+			}
+			routeConfigurations = append(routeConfigurations, rc)
+			return nil
+		}
+
+		// the QUIC listener shares the route configurations of the main listener
+		return visitTLSDomains(cfg.Options, addr, func(tlsDomain string, httpDomains []string) error {
+			rc, err := b.buildMainRouteConfiguration(cfg.Options, listener, httpDomains, tlsDomain)
+			if err != nil {
+				return err
+			}
+			routeConfigurations = append(routeConfigurations, rc)
+			return nil
+		})
 	}
-	chains = append(chains, chain)
-	return chains, nil
+
+	if config.IsAuthenticate(cfg.Options.Services) || config.IsProxy(cfg.Options.Services) {
+		if err := add(config.MainListenerName, cfg.Options.Addr); err != nil {
+			return nil, err
+		}
+	}
+	if config.IsProxy(cfg.Options.Services) {
+		for _, l := range cfg.Options.Listeners {
+			if err := add(l.Name, l.Address); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return routeConfigurations, nil
 }
 
-func (b *Builder) buildMainHTTPConnectionManagerFilter(
+// buildMainRouteConfiguration builds the route configuration of the named HTTP listener for the given domains,
+// and TLS domain.
+func (b *Builder) buildMainRouteConfiguration(
 	options *config.Options,
+	listener string,
 	domains []string,
 	tlsDomain string,
-) (*envoy_config_listener_v3.Filter, error) {
+) (*envoy_config_route_v3.RouteConfiguration, error) {
 	authorizeURLs, err := options.GetAuthorizeURLs()
 	if err != nil {
 		return nil, err
@@ -306,7 +462,7 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 			return nil, err
 		}
 
-		if options.Addr == options.GetGRPCAddr() {
+		if listener == config.MainListenerName && options.Addr == options.GetGRPCAddr() {
 			// if this is a gRPC service domain and we're supposed to handle that, add those routes
 			if (config.IsAuthorize(options.Services) && hostsMatchDomain(authorizeURLs, domain)) ||
 				(config.IsDataBroker(options.Services) && hostsMatchDomain(dataBrokerURLs, domain)) {
@@ -320,7 +476,7 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 
 		// if we're the proxy, add all the policy routes
 		if config.IsProxy(options.Services) {
-			rs, err := b.buildPolicyRoutes(options, domain)
+			rs, err := b.buildPolicyRoutes(options, listener, domain)
 			if err != nil {
 				return nil, err
 			}
@@ -338,6 +494,23 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 	}
 	virtualHosts = append(virtualHosts, vh)
 
+	rc, err := b.buildRouteConfiguration(getMainRouteConfigurationName(listener, tlsDomain), virtualHosts)
+	if err != nil {
+		return nil, err
+	}
+	if listener == config.MainListenerName && options.GetCodecType() == config.CodecTypeHTTP3 {
+		// advertise HTTP/3 to clients connecting over TCP, and keep advertising it over QUIC
+		rc.ResponseHeadersToAdd = append(rc.ResponseHeadersToAdd, mkEnvoyHeader("alt-svc", getAltSvc(options.Addr)))
+	}
+	return rc, nil
+}
+
+func (b *Builder) buildMainHTTPConnectionManagerFilter(
+	options *config.Options,
+	listener string,
+	tlsDomain string,
+	quic bool,
+) (*envoy_config_listener_v3.Filter, error) {
 	var grpcClientTimeout *durationpb.Duration
 	if options.GRPCClientTimeout != 0 {
 		grpcClientTimeout = durationpb.New(options.GRPCClientTimeout)
@@ -345,27 +518,12 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 		grpcClientTimeout = durationpb.New(30 * time.Second)
 	}
 
-	extAuthZ := marshalAny(&envoy_extensions_filters_http_ext_authz_v3.ExtAuthz{
-		StatusOnError: &envoy_type_v3.HttpStatus{
-			Code: envoy_type_v3.StatusCode_InternalServerError,
-		},
-		Services: &envoy_extensions_filters_http_ext_authz_v3.ExtAuthz_GrpcService{
-			GrpcService: &envoy_config_core_v3.GrpcService{
-				Timeout: grpcClientTimeout,
-				TargetSpecifier: &envoy_config_core_v3.GrpcService_EnvoyGrpc_{
-					EnvoyGrpc: &envoy_config_core_v3.GrpcService_EnvoyGrpc{
-						ClusterName: "pomerium-authorize",
-					},
-				},
-			},
-		},
-		IncludePeerCertificate: true,
-		TransportApiVersion:    envoy_config_core_v3.ApiVersion_V3,
-	})
-
 	extAuthzSetCookieLua := marshalAny(&envoy_extensions_filters_http_lua_v3.Lua{
 		InlineCode: luascripts.ExtAuthzSetCookie,
 	})
+	revokeSessionLua := marshalAny(&envoy_extensions_filters_http_lua_v3.Lua{
+		InlineCode: luascripts.RevokeSession,
+	})
 	cleanUpstreamLua := marshalAny(&envoy_extensions_filters_http_lua_v3.Lua{
 		InlineCode: luascripts.CleanUpstream,
 	})
@@ -376,23 +534,44 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 		InlineCode: luascripts.RewriteHeaders,
 	})
 
-	filters := []*envoy_http_connection_manager.HttpFilter{
-		{
-			Name: "envoy.filters.http.lua",
-			ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
-				TypedConfig: removeImpersonateHeadersLua,
-			},
+	var filters []*envoy_http_connection_manager.HttpFilter
+	// the request id is replaced before anything reads it, so that it's the same in every log
+	if options.GetRequestIDPolicy() == config.RequestIDPolicyOverride {
+		filters = append(filters, newLuaFilter(luascripts.OverrideRequestID))
+	}
+	filters = append(filters, &envoy_http_connection_manager.HttpFilter{
+		Name: "envoy.filters.http.lua",
+		ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+			TypedConfig: removeImpersonateHeadersLua,
 		},
+	})
+	// rate limited and oversized requests are rejected, pre-flight requests answered, and cached responses of
+	// public routes served, before they're authorized
+	if f := buildLocalRateLimitFilter(options); f != nil {
+		filters = append(filters, f)
+	}
+	if f := buildMaxRequestBodySizeFilter(options); f != nil {
+		filters = append(filters, f)
+	}
+	if f := buildCORSFilter(options); f != nil {
+		filters = append(filters, f)
+	}
+	filters = append(filters, buildCacheFilters(options, true)...)
+	filters = append(filters, buildExtAuthzFilters(options, grpcClientTimeout)...)
+	if f := buildBufferFilter(options); f != nil {
+		filters = append(filters, f)
+	}
+	filters = append(filters, []*envoy_http_connection_manager.HttpFilter{
 		{
-			Name: "envoy.filters.http.ext_authz",
+			Name: "envoy.filters.http.lua",
 			ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
-				TypedConfig: extAuthZ,
+				TypedConfig: extAuthzSetCookieLua,
 			},
 		},
 		{
 			Name: "envoy.filters.http.lua",
 			ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
-				TypedConfig: extAuthzSetCookieLua,
+				TypedConfig: revokeSessionLua,
 			},
 		},
 		{
@@ -407,7 +586,7 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 				TypedConfig: rewriteHeadersLua,
 			},
 		},
-	}
+	}...)
 	if tlsDomain != "" && tlsDomain != "*" {
 		fixMisdirectedLua := marshalAny(&envoy_extensions_filters_http_lua_v3.Lua{
 			InlineCode: fmt.Sprintf(luascripts.FixMisdirected, tlsDomain),
@@ -419,6 +598,10 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 			},
 		})
 	}
+	filters = append(filters, buildCacheFilters(options, false)...)
+	filters = append(filters, buildCompressionFilters(options)...)
+	filters = append(filters, buildRouteFilters(options)...)
+	filters = append(filters, getHTTPFilterOverrides(options)...)
 	filters = append(filters, &envoy_http_connection_manager.HttpFilter{
 		Name: "envoy.filters.http.router",
 	})
@@ -428,19 +611,32 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 		maxStreamDuration = ptypes.DurationProto(options.WriteTimeout)
 	}
 
-	rc, err := b.buildRouteConfiguration("main", virtualHosts)
+	codecType := options.GetCodecType()
+	if codecType == config.CodecTypeHTTP3 && (listener != config.MainListenerName || !quic) {
+		// HTTP/3 is only served over QUIC on the main listener's port
+		codecType = config.CodecTypeAuto
+	}
+	tracingProvider, err := b.buildTracingHTTP(options)
 	if err != nil {
 		return nil, err
 	}
-	tracingProvider, err := buildTracingHTTP(options)
+	tracingCustomTags, err := buildTracingCustomTags(options)
 	if err != nil {
 		return nil, err
 	}
 	tc := marshalAny(&envoy_http_connection_manager.HttpConnectionManager{
-		CodecType:  options.GetCodecType().ToEnvoy(),
+		CodecType:  codecType.ToEnvoy(),
 		StatPrefix: "ingress",
-		RouteSpecifier: &envoy_http_connection_manager.HttpConnectionManager_RouteConfig{
-			RouteConfig: rc,
+		RouteSpecifier: &envoy_http_connection_manager.HttpConnectionManager_Rds{
+			Rds: &envoy_http_connection_manager.Rds{
+				ConfigSource: &envoy_config_core_v3.ConfigSource{
+					ResourceApiVersion: envoy_config_core_v3.ApiVersion_V3,
+					ConfigSourceSpecifier: &envoy_config_core_v3.ConfigSource_Ads{
+						Ads: &envoy_config_core_v3.AggregatedConfigSource{},
+					},
+				},
+				RouteConfigName: getMainRouteConfigurationName(listener, tlsDomain),
+			},
 		},
 		HttpFilters: filters,
 		AccessLog:   buildAccessLogs(options),
@@ -450,14 +646,18 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 		},
 		RequestTimeout: ptypes.DurationProto(options.ReadTimeout),
 		Tracing: &envoy_http_connection_manager.HttpConnectionManager_Tracing{
-			RandomSampling: &envoy_type_v3.Percent{Value: options.TracingSampleRate * 100},
+			RandomSampling: &envoy_type_v3.Percent{Value: getTracingSamplePercent(options)},
 			Provider:       tracingProvider,
+			CustomTags:     tracingCustomTags,
 		},
 		// See https://www.envoyproxy.io/docs/envoy/latest/configuration/http/http_conn_man/headers#x-forwarded-for
 		UseRemoteAddress:  &wrappers.BoolValue{Value: true},
 		SkipXffAppend:     options.SkipXffAppend,
 		XffNumTrustedHops: options.XffNumTrustedHops,
 		LocalReplyConfig:  b.buildLocalReplyConfig(options),
+		// See https://www.envoyproxy.io/docs/envoy/latest/configuration/http/http_conn_man/headers#x-request-id
+		PreserveExternalRequestId:    options.GetRequestIDPolicy() == config.RequestIDPolicyTrust,
+		AlwaysSetRequestIdInResponse: true,
 	})
 
 	return &envoy_config_listener_v3.Filter{
@@ -468,14 +668,143 @@ func (b *Builder) buildMainHTTPConnectionManagerFilter(
 	}, nil
 }
 
+// buildExtAuthzFilters builds the ext_authz filters which send check requests to the authorize service.
+// If the authorize service can't be reached requests fail with a 503. When routes are marked to fail open,
+// a lua filter stores the route's failure mode in the dynamic metadata and a second ext_authz filter,
+// which allows requests on error, handles the requests for those routes.
+//
+// When routes authorize the request body, or sign it with AWS SigV4, the body is buffered, up to the largest
+// max_request_body_size of those routes, and sent with the check request. Every virtual host disables the
+// buffering, so the request bodies of every other route, including pomerium's own, are streamed to the
+// upstream without waiting for the check request.
+func buildExtAuthzFilters(options *config.Options, grpcClientTimeout *durationpb.Duration) []*envoy_http_connection_manager.HttpFilter {
+	var withRequestBody *envoy_extensions_filters_http_ext_authz_v3.BufferSettings
+	if hasAuthorizeRequestBodyPolicy(options) {
+		withRequestBody = &envoy_extensions_filters_http_ext_authz_v3.BufferSettings{
+			MaxRequestBytes: getAuthorizeMaxRequestBytes(options),
+			PackAsBytes:     true,
+		}
+	}
+	newExtAuthz := func() *envoy_extensions_filters_http_ext_authz_v3.ExtAuthz {
+		return &envoy_extensions_filters_http_ext_authz_v3.ExtAuthz{
+			StatusOnError: &envoy_type_v3.HttpStatus{
+				Code: envoy_type_v3.StatusCode_ServiceUnavailable,
+			},
+			Services: &envoy_extensions_filters_http_ext_authz_v3.ExtAuthz_GrpcService{
+				GrpcService: &envoy_config_core_v3.GrpcService{
+					Timeout: grpcClientTimeout,
+					TargetSpecifier: &envoy_config_core_v3.GrpcService_EnvoyGrpc_{
+						EnvoyGrpc: &envoy_config_core_v3.GrpcService_EnvoyGrpc{
+							ClusterName: "pomerium-authorize",
+						},
+					},
+				},
+			},
+			IncludePeerCertificate: true,
+			TransportApiVersion:    envoy_config_core_v3.ApiVersion_V3,
+			WithRequestBody:        withRequestBody,
+		}
+	}
+
+	if !hasAuthorizeFailOpenPolicy(options) {
+		return []*envoy_http_connection_manager.HttpFilter{{
+			Name: "envoy.filters.http.ext_authz",
+			ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+				TypedConfig: marshalAny(newExtAuthz()),
+			},
+		}}
+	}
+
+	failureModeMatcher := func(mode string) *envoy_type_matcher_v3.MetadataMatcher {
+		return &envoy_type_matcher_v3.MetadataMatcher{
+			Filter: "envoy.filters.http.lua",
+			Path: []*envoy_type_matcher_v3.MetadataMatcher_PathSegment{{
+				Segment: &envoy_type_matcher_v3.MetadataMatcher_PathSegment_Key{
+					Key: "authorize_failure_mode",
+				},
+			}},
+			Value: &envoy_type_matcher_v3.ValueMatcher{
+				MatchPattern: &envoy_type_matcher_v3.ValueMatcher_StringMatch{
+					StringMatch: &envoy_type_matcher_v3.StringMatcher{
+						MatchPattern: &envoy_type_matcher_v3.StringMatcher_Exact{
+							Exact: mode,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	failClosed := newExtAuthz()
+	failClosed.FilterEnabledMetadata = failureModeMatcher("closed")
+	failOpen := newExtAuthz()
+	failOpen.FilterEnabledMetadata = failureModeMatcher("open")
+	failOpen.FailureModeAllow = true
+
+	// both filters use the same name, so routes which disable ext_authz disable both of them
+	return []*envoy_http_connection_manager.HttpFilter{
+		{
+			Name: "envoy.filters.http.lua",
+			ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+				TypedConfig: marshalAny(&envoy_extensions_filters_http_lua_v3.Lua{
+					InlineCode: luascripts.AuthorizeFailureMode,
+				}),
+			},
+		},
+		{
+			Name: "envoy.filters.http.ext_authz",
+			ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+				TypedConfig: marshalAny(failClosed),
+			},
+		},
+		{
+			Name: "envoy.filters.http.ext_authz",
+			ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+				TypedConfig: marshalAny(failOpen),
+			},
+		},
+	}
+}
+
+func hasAuthorizeFailOpenPolicy(options *config.Options) bool {
+	for _, p := range options.GetAllPolicies() {
+		if p.AuthorizeFailOpen {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAuthorizeRequestBodyPolicy(options *config.Options) bool {
+	for _, p := range options.GetAllPolicies() {
+		if p.AuthorizesRequestBody() {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *Builder) buildMetricsHTTPConnectionManagerFilter() (*envoy_config_listener_v3.Filter, error) {
 	rc, err := b.buildRouteConfiguration("metrics", []*envoy_config_route_v3.VirtualHost{{
 		Name:    "metrics",
 		Domains: []string{"*"},
+		// only the metrics and debug endpoints are served, not the user facing endpoints of the control plane
 		Routes: []*envoy_config_route_v3.Route{{
 			Name: "metrics",
 			Match: &envoy_config_route_v3.RouteMatch{
-				PathSpecifier: &envoy_config_route_v3.RouteMatch_Prefix{Prefix: "/"},
+				PathSpecifier: &envoy_config_route_v3.RouteMatch_Path{Path: "/metrics"},
+			},
+			Action: &envoy_config_route_v3.Route_Route{
+				Route: &envoy_config_route_v3.RouteAction{
+					ClusterSpecifier: &envoy_config_route_v3.RouteAction_Cluster{
+						Cluster: "pomerium-control-plane-http",
+					},
+				},
+			},
+		}, {
+			Name: "debug",
+			Match: &envoy_config_route_v3.RouteMatch{
+				PathSpecifier: &envoy_config_route_v3.RouteMatch_Prefix{Prefix: "/debug/"},
 			},
 			Action: &envoy_config_route_v3.Route_Route{
 				Route: &envoy_config_route_v3.RouteAction{
@@ -515,6 +844,11 @@ func (b *Builder) buildGRPCListener(ctx context.Context, cfg *config.Config) (*e
 		return nil, err
 	}
 
+	clientCAValidationContext, err := b.buildGRPCClientCAValidationContext(cfg.Options)
+	if err != nil {
+		return nil, err
+	}
+
 	if cfg.Options.GetGRPCInsecure() {
 		li := newEnvoyListener("grpc-ingress")
 		li.Address = buildAddress(cfg.Options.GetGRPCAddr(), 80)
@@ -538,6 +872,16 @@ func (b *Builder) buildGRPCListener(ctx context.Context, cfg *config.Config) (*e
 			}
 			tlsContext := b.buildDownstreamTLSContext(ctx, cfg, tlsDomain)
 			if tlsContext != nil {
+				// require the client certificates of the other pomerium services when a gRPC client CA is
+				// configured, or their SVIDs when a SPIRE agent is
+				if clientCAValidationContext != nil {
+					tlsContext.RequireClientCertificate = wrapperspb.Bool(true)
+					tlsContext.CommonTlsContext.ValidationContextType = clientCAValidationContext
+				} else if cfg.Options.SPIREAgentSocket != "" {
+					tlsContext.RequireClientCertificate = wrapperspb.Bool(true)
+					tlsContext.CommonTlsContext.ValidationContextType = buildSPIREValidationContext(
+						&envoy_extensions_transport_sockets_tls_v3.CertificateValidationContext{})
+				}
 				tlsConfig := marshalAny(tlsContext)
 				filterChain.TransportSocket = &envoy_config_core_v3.TransportSocket{
 					Name: "tls",
@@ -552,6 +896,16 @@ func (b *Builder) buildGRPCListener(ctx context.Context, cfg *config.Config) (*e
 		return nil, err
 	}
 
+	if cfg.Options.InternalCA && config.IsDataBroker(cfg.Options.Services) {
+		chain, err := b.buildInternalCABootstrapFilterChain(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if chain != nil {
+			chains = append(chains, chain)
+		}
+	}
+
 	tlsInspectorCfg := marshalAny(new(emptypb.Empty))
 	li := newEnvoyListener("grpc-ingress")
 	li.Address = buildAddress(cfg.Options.GetGRPCAddr(), 443)
@@ -565,11 +919,114 @@ func (b *Builder) buildGRPCListener(ctx context.Context, cfg *config.Config) (*e
 	return li, nil
 }
 
+// buildInternalCABootstrapFilterChain returns the filter chain the other services use to request their
+// certificates from the internal CA of the databroker. It doesn't require client certificates, so it only
+// routes to the bootstrap service, which authenticates requests itself.
+func (b *Builder) buildInternalCABootstrapFilterChain(
+	ctx context.Context,
+	cfg *config.Config,
+) (*envoy_config_listener_v3.FilterChain, error) {
+	tlsContext := b.buildDownstreamTLSContext(ctx, cfg, internalca.BootstrapServerName)
+	if tlsContext == nil {
+		return nil, nil
+	}
+	tlsContext.CommonTlsContext.ValidationContextType = nil
+
+	rc, err := b.buildRouteConfiguration("internal-ca-bootstrap", []*envoy_config_route_v3.VirtualHost{{
+		Name:    "internal-ca-bootstrap",
+		Domains: []string{"*"},
+		Routes: []*envoy_config_route_v3.Route{{
+			Name: "internal-ca-bootstrap",
+			Match: &envoy_config_route_v3.RouteMatch{
+				PathSpecifier: &envoy_config_route_v3.RouteMatch_Prefix{Prefix: "/" + internalca.BootstrapServiceName + "/"},
+				Grpc:          &envoy_config_route_v3.RouteMatch_GrpcRouteMatchOptions{},
+			},
+			Action: &envoy_config_route_v3.Route_Route{
+				Route: &envoy_config_route_v3.RouteAction{
+					ClusterSpecifier: &envoy_config_route_v3.RouteAction_Cluster{
+						Cluster: "pomerium-control-plane-grpc",
+					},
+				},
+			},
+		}},
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	tc := marshalAny(&envoy_http_connection_manager.HttpConnectionManager{
+		CodecType:  envoy_http_connection_manager.HttpConnectionManager_AUTO,
+		StatPrefix: "grpc_internal_ca_bootstrap",
+		RequestTimeout: &durationpb.Duration{
+			Seconds: 15,
+		},
+		RouteSpecifier: &envoy_http_connection_manager.HttpConnectionManager_RouteConfig{
+			RouteConfig: rc,
+		},
+		HttpFilters: []*envoy_http_connection_manager.HttpFilter{{
+			Name: "envoy.filters.http.router",
+		}},
+	})
+	return &envoy_config_listener_v3.FilterChain{
+		FilterChainMatch: &envoy_config_listener_v3.FilterChainMatch{
+			ServerNames: []string{internalca.BootstrapServerName},
+		},
+		Filters: []*envoy_config_listener_v3.Filter{{
+			Name: "envoy.filters.network.http_connection_manager",
+			ConfigType: &envoy_config_listener_v3.Filter_TypedConfig{
+				TypedConfig: tc,
+			},
+		}},
+		TransportSocket: &envoy_config_core_v3.TransportSocket{
+			Name: "tls",
+			ConfigType: &envoy_config_core_v3.TransportSocket_TypedConfig{
+				TypedConfig: marshalAny(tlsContext),
+			},
+		},
+	}, nil
+}
+
+// buildGRPCClientCAValidationContext returns the validation context for the client certificates presented to the
+// gRPC listener by the other pomerium services, or nil if client certificates aren't required.
+func (b *Builder) buildGRPCClientCAValidationContext(
+	options *config.Options,
+) (*envoy_extensions_transport_sockets_tls_v3.CommonTlsContext_ValidationContext, error) {
+	vc := &envoy_extensions_transport_sockets_tls_v3.CertificateValidationContext{
+		TrustChainVerification: envoy_extensions_transport_sockets_tls_v3.CertificateValidationContext_VERIFY_TRUST_CHAIN,
+	}
+	switch {
+	case options.GRPCClientCA != "":
+		bs, err := base64.StdEncoding.DecodeString(options.GRPCClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("xds: invalid grpc_client_ca: %w", err)
+		}
+		vc.TrustedCa = b.filemgr.BytesDataSource("grpc_client_ca.pem", bs)
+	case options.GRPCClientCAFile != "":
+		vc.TrustedCa = b.filemgr.FileDataSource(options.GRPCClientCAFile)
+	case options.InternalCA:
+		vc.TrustedCa = b.filemgr.BytesDataSource("internal_ca.pem", options.GetInternalCA())
+	default:
+		return nil, nil
+	}
+	return &envoy_extensions_transport_sockets_tls_v3.CommonTlsContext_ValidationContext{
+		ValidationContext: vc,
+	}, nil
+}
+
 func (b *Builder) buildGRPCHTTPConnectionManagerFilter() (*envoy_config_listener_v3.Filter, error) {
 	rc, err := b.buildRouteConfiguration("grpc", []*envoy_config_route_v3.VirtualHost{{
 		Name:    "grpc",
 		Domains: []string{"*"},
 		Routes: []*envoy_config_route_v3.Route{{
+			// envoy's own spans are sent to the agent trace service directly, it isn't served to clients
+			Name: "grpc-agent-trace",
+			Match: &envoy_config_route_v3.RouteMatch{
+				PathSpecifier: &envoy_config_route_v3.RouteMatch_Prefix{Prefix: trace.AgentTraceServicePath},
+			},
+			Action: &envoy_config_route_v3.Route_DirectResponse{
+				DirectResponse: &envoy_config_route_v3.DirectResponseAction{Status: http.StatusNotFound},
+			},
+		}, {
 			Name: "grpc",
 			Match: &envoy_config_route_v3.RouteMatch{
 				PathSpecifier: &envoy_config_route_v3.RouteMatch_Prefix{Prefix: "/"},
@@ -602,6 +1059,11 @@ func (b *Builder) buildGRPCHTTPConnectionManagerFilter() (*envoy_config_listener
 		RequestTimeout: &durationpb.Duration{
 			Seconds: 15,
 		},
+		// pass the subject of the client certificate to the databroker, which uses it to identify the service
+		ForwardClientCertDetails: envoy_http_connection_manager.HttpConnectionManager_SANITIZE_SET,
+		SetCurrentClientCertDetails: &envoy_http_connection_manager.HttpConnectionManager_SetCurrentClientCertDetails{
+			Subject: &wrapperspb.BoolValue{Value: true},
+		},
 		RouteSpecifier: &envoy_http_connection_manager.HttpConnectionManager_RouteConfig{
 			RouteConfig: rc,
 		},
@@ -623,6 +1085,8 @@ func (b *Builder) buildRouteConfiguration(name string, virtualHosts []*envoy_con
 		VirtualHosts: virtualHosts,
 		// disable cluster validation since the order of LDS/CDS updates isn't guaranteed
 		ValidateClusters: &wrappers.BoolValue{Value: false},
+		// route headers override the global headers of the virtual host
+		MostSpecificHeaderMutationsWins: true,
 	}, nil
 }
 
@@ -762,13 +1226,16 @@ func getAllRouteableDomains(options *config.Options, addr string) ([]string, err
 			}
 		}
 	}
-	if config.IsProxy(options.Services) && addr == options.Addr {
+	if listener, ok := options.GetListenerName(addr); ok && config.IsProxy(options.Services) {
 		for _, policy := range options.GetAllPolicies() {
+			if !policy.IsServedByListener(listener) {
+				continue
+			}
 			for _, h := range urlutil.GetDomainsForURL(*policy.Source.URL) {
 				lookup[h] = struct{}{}
 			}
 		}
-		if forwardAuthURL != nil {
+		if forwardAuthURL != nil && addr == options.Addr {
 			for _, h := range urlutil.GetDomainsForURL(*forwardAuthURL) {
 				lookup[h] = struct{}{}
 			}
@@ -854,6 +1321,39 @@ func getPoliciesForDomain(options *config.Options, domain string) []config.Polic
 	return policies
 }
 
+// getMainRouteConfigurationName returns the name of the route configuration of the named HTTP listener for the
+// TLS domain.
+func getMainRouteConfigurationName(listener, tlsDomain string) string {
+	name := getHTTPListenerName("main", listener)
+	if tlsDomain != "" {
+		name += "-" + tlsDomain
+	}
+	return name
+}
+
+// getHTTPListenerName returns the envoy listener name of the named HTTP listener. The main listener keeps the
+// unsuffixed name, so existing envoy_overrides continue to apply to it.
+func getHTTPListenerName(prefix, name string) string {
+	if name == config.MainListenerName {
+		return prefix
+	}
+	return prefix + "-" + name
+}
+
+// getAltSvc returns the Alt-Svc header value which advertises HTTP/3 on the port of the given address. The final
+// version and the last draft version of HTTP/3 are advertised, because clients still use either of them.
+func getAltSvc(addr string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "" {
+		port = "443"
+	}
+	var vs []string
+	for _, proto := range http3ALPNProtocols {
+		vs = append(vs, fmt.Sprintf(`%s=":%s"; ma=%d`, proto, port, altSvcMaxAge))
+	}
+	return strings.Join(vs, ", ")
+}
+
 // newEnvoyListener creates envoy listener with certain default values
 func newEnvoyListener(name string) *envoy_config_listener_v3.Listener {
 	return &envoy_config_listener_v3.Listener{
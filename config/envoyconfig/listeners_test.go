@@ -2,13 +2,23 @@ package envoyconfig
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoy_extensions_filters_http_lua_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/lua/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoy_extensions_transport_sockets_quic_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/quic/v3"
+	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
@@ -55,6 +65,7 @@ func Test_buildMetricsHTTPConnectionManagerFilter(t *testing.T) {
 				}],
 				"routeConfig": {
 					"name": "metrics",
+					"mostSpecificHeaderMutationsWins": true,
 					"validateClusters": false,
 					"virtualHosts": [{
 						"name": "metrics",
@@ -62,7 +73,15 @@ func Test_buildMetricsHTTPConnectionManagerFilter(t *testing.T) {
 						"routes": [{
 							"name": "metrics",
 							"match": {
-								"prefix": "/"
+								"path": "/metrics"
+							},
+							"route": {
+								"cluster": "pomerium-control-plane-http"
+							}
+						}, {
+							"name": "debug",
+							"match": {
+								"prefix": "/debug/"
 							},
 							"route": {
 								"cluster": "pomerium-control-plane-http"
@@ -113,7 +132,7 @@ func Test_buildMainHTTPConnectionManagerFilter(t *testing.T) {
 	options := config.NewDefaultOptions()
 	options.SkipXffAppend = true
 	options.XffNumTrustedHops = 1
-	filter, err := b.buildMainHTTPConnectionManagerFilter(options, []string{"example.com"}, "*")
+	filter, err := b.buildMainHTTPConnectionManagerFilter(options, config.MainListenerName, "*", false)
 	require.NoError(t, err)
 	testutil.AssertProtoJSONEqual(t, `{
 		"name": "envoy.filters.network.http_connection_manager",
@@ -157,7 +176,7 @@ func Test_buildMainHTTPConnectionManagerFilter(t *testing.T) {
 						},
 						"includePeerCertificate": true,
 						"statusOnError": {
-							"code": "InternalServerError"
+							"code": "ServiceUnavailable"
 						},
 						"transportApiVersion": "V3"
 					}
@@ -173,7 +192,14 @@ func Test_buildMainHTTPConnectionManagerFilter(t *testing.T) {
 					"name": "envoy.filters.http.lua",
 					"typedConfig": {
 						"@type": "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua",
-						"inlineCode": "function remove_pomerium_cookie(cookie_name, cookie)\n    -- lua doesn't support optional capture groups\n    -- so we replace twice to handle pomerium=xyz at the end of the string\n    cookie = cookie:gsub(cookie_name .. \"=[^;]+; \", \"\")\n    cookie = cookie:gsub(cookie_name .. \"=[^;]+\", \"\")\n    return cookie\nend\n\nfunction has_prefix(str, prefix)\n    return str ~= nil and str:sub(1, #prefix) == prefix\nend\n\nfunction envoy_on_request(request_handle)\n    local headers = request_handle:headers()\n    local metadata = request_handle:metadata()\n\n    local remove_cookie_name = metadata:get(\"remove_pomerium_cookie\")\n    if remove_cookie_name then\n        local cookie = headers:get(\"cookie\")\n        if cookie ~= nil then\n            newcookie = remove_pomerium_cookie(remove_cookie_name, cookie)\n            headers:replace(\"cookie\", newcookie)\n        end\n    end\n\n    local remove_authorization = metadata:get(\"remove_pomerium_authorization\")\n    if remove_authorization then\n        local authorization = headers:get(\"authorization\")\n        local authorization_prefix = \"Pomerium \"\n        if has_prefix(authorization, authorization_prefix) then\n            headers:remove(\"authorization\")\n        end\n    end\nend\n\nfunction envoy_on_response(response_handle)\n\nend\n"
+						"inlineCode": "function envoy_on_request(request_handle)\n    local headers = request_handle:headers()\n    local metadata = request_handle:metadata()\n    local dynamic_meta = request_handle:streamInfo():dynamicMetadata()\n\n    -- store the credentials before they are removed from the upstream request\n    -- so the session can be found if the upstream revokes it\n    if metadata:get(\"allow_upstream_session_revocation\") then\n        dynamic_meta:set(\"envoy.filters.http.lua\", \"pomerium_revoke_session\",\n                         {\n            authority = headers:get(\":authority\"),\n            cookie = headers:get(\"cookie\"),\n            authorization = headers:get(\"authorization\")\n        })\n    end\nend\n\nfunction envoy_on_response(response_handle)\n    local headers = response_handle:headers()\n    local metadata = response_handle:metadata()\n\n    local revoke = headers:get(\"x-pomerium-revoke-session\")\n    if revoke == nil then\n        return\n    end\n    headers:remove(\"x-pomerium-revoke-session\")\n\n    if not metadata:get(\"allow_upstream_session_revocation\") or revoke:lower() ~= \"true\" then\n        return\n    end\n\n    local dynamic_meta = response_handle:streamInfo():dynamicMetadata()\n    local tbl = dynamic_meta:get(\"envoy.filters.http.lua\")\n    if tbl == nil or tbl[\"pomerium_revoke_session\"] == nil then\n        return\n    end\n    local req = tbl[\"pomerium_revoke_session\"]\n\n    local call_headers = {\n        [\":method\"] = \"POST\",\n        [\":path\"] = \"/.pomerium/revoke_session\",\n        [\":authority\"] = req.authority\n    }\n    if req.cookie ~= nil then\n        call_headers[\"cookie\"] = req.cookie\n    end\n    if req.authorization ~= nil then\n        call_headers[\"authorization\"] = req.authorization\n    end\n\n    local call_response_headers, _ = response_handle:httpCall(\n                                         \"pomerium-control-plane-http\",\n                                         call_headers, \"\", 5000)\n    if call_response_headers ~= nil and call_response_headers[\"set-cookie\"] ~=\n        nil then\n        headers:add(\"set-cookie\", call_response_headers[\"set-cookie\"])\n    end\nend\n"
+					}
+				},
+				{
+					"name": "envoy.filters.http.lua",
+					"typedConfig": {
+						"@type": "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua",
+						"inlineCode": "function remove_pomerium_cookie(cookie_name, cookie)\n    -- lua doesn't support optional capture groups\n    -- so we replace twice to handle pomerium=xyz at the end of the string\n    cookie = cookie:gsub(cookie_name .. \"=[^;]+; \", \"\")\n    cookie = cookie:gsub(cookie_name .. \"=[^;]+\", \"\")\n    return cookie\nend\n\nfunction has_prefix(str, prefix)\n    return str ~= nil and str:sub(1, #prefix) == prefix\nend\n\n-- shared url parameters are only meant for the authorize service, so they're removed from the query\nfunction remove_shared_url_params(path)\n    local i = path:find(\"?\", 1, true)\n    if i == nil or path:find(\"pomerium_shared_\", i, true) == nil then\n        return path\n    end\n\n    local params = {}\n    for param in path:sub(i + 1):gmatch(\"[^&]+\") do\n        if not has_prefix(param, \"pomerium_shared_\") then\n            table.insert(params, param)\n        end\n    end\n    if #params == 0 then\n        return path:sub(1, i - 1)\n    end\n    return path:sub(1, i) .. table.concat(params, \"&\")\nend\n\nfunction envoy_on_request(request_handle)\n    local headers = request_handle:headers()\n    local metadata = request_handle:metadata()\n\n    local path = headers:get(\":path\")\n    if path ~= nil then\n        local newpath = remove_shared_url_params(path)\n        if newpath ~= path then\n            headers:replace(\":path\", newpath)\n        end\n    end\n\n    local remove_cookie_name = metadata:get(\"remove_pomerium_cookie\")\n    if remove_cookie_name then\n        local cookie = headers:get(\"cookie\")\n        if cookie ~= nil then\n            newcookie = remove_pomerium_cookie(remove_cookie_name, cookie)\n            headers:replace(\"cookie\", newcookie)\n        end\n    end\n\n    local remove_authorization = metadata:get(\"remove_pomerium_authorization\")\n    if remove_authorization then\n        local authorization = headers:get(\"authorization\")\n        local authorization_prefix = \"Pomerium \"\n        if has_prefix(authorization, authorization_prefix) then\n            headers:remove(\"authorization\")\n        end\n    end\nend\n\nfunction envoy_on_response(response_handle)\n\nend\n"
 					}
 				},
 				{
@@ -188,305 +214,80 @@ func Test_buildMainHTTPConnectionManagerFilter(t *testing.T) {
 				}
 			],
 			"requestTimeout": "30s",
-			"routeConfig": {
-				"name": "main",
-				"virtualHosts": [
+			"rds": {
+				"configSource": {
+					"ads": {},
+					"resourceApiVersion": "V3"
+				},
+				"routeConfigName": "main-*"
+			},
+			"statPrefix": "ingress",
+			"tracing": {
+				"randomSampling": {
+					"value": 0.01
+				}
+			},
+			"useRemoteAddress": true,
+			"skipXffAppend": true,
+			"xffNumTrustedHops": 1,
+			"alwaysSetRequestIdInResponse": true,
+			"localReplyConfig":{
+				"mappers":[
 					{
-						"name": "example.com",
-						"domains": ["example.com"],
-						"responseHeadersToAdd": [{
-							"append": false,
-							"header": {
-								"key": "Strict-Transport-Security",
-								"value": "max-age=31536000; includeSubDomains; preload"
-							}
-						},
-						{
-							"append": false,
-							"header": {
-								"key": "X-Frame-Options",
-								"value": "SAMEORIGIN"
-							}
-						},
-						{
-							"append": false,
-							"header": {
-								"key": "X-XSS-Protection",
-								"value": "1; mode=block"
-							}
-						}],
-						"routes": [
-							{
-								"name": "pomerium-path-/.pomerium/jwt",
-								"match": {
-									"path": "/.pomerium/jwt"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								}
-							},
-							{
-								"name": "pomerium-path-/ping",
-								"match": {
-									"path": "/ping"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
-							},
-							{
-								"name": "pomerium-path-/healthz",
-								"match": {
-									"path": "/healthz"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
-							},
-							{
-								"name": "pomerium-path-/.pomerium",
-								"match": {
-									"path": "/.pomerium"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
-							},
-							{
-								"name": "pomerium-prefix-/.pomerium/",
-								"match": {
-									"prefix": "/.pomerium/"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
-							},
-							{
-								"name": "pomerium-path-/.well-known/pomerium",
-								"match": {
-									"path": "/.well-known/pomerium"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
-							},
-							{
-								"name": "pomerium-prefix-/.well-known/pomerium/",
-								"match": {
-									"prefix": "/.well-known/pomerium/"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
-							},
-							{
-								"name": "pomerium-path-/robots.txt",
-								"match": {
-									"path": "/robots.txt"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
+						"filter":{
+							"andFilter":{
+								"filters":[
+									{
+										"statusCodeFilter":{
+											"comparison":{
+												"value":{
+													"defaultValue":503,
+													"runtimeKey":"pomerium.authorize_unavailable_status"
+												}
+											}
+										}
+									},
+									{
+										"responseFlagFilter":{
+											"flags":["UAEX"]
+										}
 									}
-								}
-							}
-						]
-					},
-					{
-						"name": "catch-all",
-						"domains": ["*"],
-						"responseHeadersToAdd": [{
-							"append": false,
-							"header": {
-								"key": "Strict-Transport-Security",
-								"value": "max-age=31536000; includeSubDomains; preload"
+								]
 							}
 						},
-						{
-							"append": false,
-							"header": {
-								"key": "X-Frame-Options",
-								"value": "SAMEORIGIN"
-							}
+						"body":{
+							"inlineString":`+jsonString(t, authorizeUnavailablePage)+`
 						},
-						{
-							"append": false,
-							"header": {
-								"key": "X-XSS-Protection",
-								"value": "1; mode=block"
-							}
-						}],
-						"routes": [
-							{
-								"name": "pomerium-path-/.pomerium/jwt",
-								"match": {
-									"path": "/.pomerium/jwt"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								}
-							},
-							{
-								"name": "pomerium-path-/ping",
-								"match": {
-									"path": "/ping"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
-							},
-							{
-								"name": "pomerium-path-/healthz",
-								"match": {
-									"path": "/healthz"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
-							},
-							{
-								"name": "pomerium-path-/.pomerium",
-								"match": {
-									"path": "/.pomerium"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
-							},
-							{
-								"name": "pomerium-prefix-/.pomerium/",
-								"match": {
-									"prefix": "/.pomerium/"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
-								}
+						"bodyFormatOverride":{
+							"textFormatSource":{
+								"inlineString":"%LOCAL_REPLY_BODY%"
 							},
+							"contentType":"text/html; charset=UTF-8"
+						},
+						"headersToAdd":[
 							{
-								"name": "pomerium-path-/.well-known/pomerium",
-								"match": {
-									"path": "/.well-known/pomerium"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
+								"append":false,
+								"header":{
+									"key":"Strict-Transport-Security",
+									"value":"max-age=31536000; includeSubDomains; preload"
 								}
 							},
 							{
-								"name": "pomerium-prefix-/.well-known/pomerium/",
-								"match": {
-									"prefix": "/.well-known/pomerium/"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
+								"append":false,
+								"header":{
+									"key":"X-Frame-Options",
+									"value":"SAMEORIGIN"
 								}
 							},
 							{
-								"name": "pomerium-path-/robots.txt",
-								"match": {
-									"path": "/robots.txt"
-								},
-								"route": {
-									"cluster": "pomerium-control-plane-http"
-								},
-								"typedPerFilterConfig": {
-									"envoy.filters.http.ext_authz": {
-										"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
-										"disabled": true
-									}
+								"append":false,
+								"header":{
+									"key":"X-XSS-Protection",
+									"value":"1; mode=block"
 								}
 							}
 						]
-					}
-				],
-				"validateClusters": false
-			},
-			"statPrefix": "ingress",
-			"tracing": {
-				"randomSampling": {
-					"value": 0.01
-				}
-			},
-			"useRemoteAddress": true,
-			"skipXffAppend": true,
-			"xffNumTrustedHops": 1,
-			"localReplyConfig":{
-				"mappers":[
+					},
 					{
 						"filter":{
 							"responseFlagFilter":{}
@@ -521,6 +322,514 @@ func Test_buildMainHTTPConnectionManagerFilter(t *testing.T) {
 	}`, filter)
 }
 
+func Test_buildMainHTTPConnectionManagerFilterRequestIDPolicy(t *testing.T) {
+	b := New("local-grpc", "local-http", nil, nil)
+
+	for _, tc := range []struct {
+		policy   string
+		preserve bool
+		override bool
+	}{
+		{"", false, false},
+		{config.RequestIDPolicyGenerate, false, false},
+		{config.RequestIDPolicyTrust, true, false},
+		{config.RequestIDPolicyOverride, false, true},
+	} {
+		options := config.NewDefaultOptions()
+		options.RequestIDPolicy = tc.policy
+		filter, err := b.buildMainHTTPConnectionManagerFilter(options, config.MainListenerName, "*", false)
+		require.NoError(t, err)
+
+		var hcm envoy_http_connection_manager.HttpConnectionManager
+		require.NoError(t, filter.GetTypedConfig().UnmarshalTo(&hcm))
+		assert.Equal(t, tc.preserve, hcm.GetPreserveExternalRequestId(), tc.policy)
+		assert.True(t, hcm.GetAlwaysSetRequestIdInResponse(), tc.policy)
+
+		var first envoy_extensions_filters_http_lua_v3.Lua
+		require.NoError(t, hcm.GetHttpFilters()[0].GetTypedConfig().UnmarshalTo(&first))
+		assert.Equal(t, tc.override, first.GetInlineCode() == luascripts.OverrideRequestID, tc.policy)
+	}
+}
+
+func Test_buildMainRouteConfiguration(t *testing.T) {
+	b := New("local-grpc", "local-http", nil, nil)
+
+	options := config.NewDefaultOptions()
+	rc, err := b.buildMainRouteConfiguration(options, config.MainListenerName, []string{"example.com"}, "*")
+	require.NoError(t, err)
+	testutil.AssertProtoJSONEqual(t, `{
+		"name": "main-*",
+		"virtualHosts": [
+			{
+				"name": "example.com",
+				"domains": ["example.com"],
+				"responseHeadersToAdd": [{
+					"append": false,
+					"header": {
+						"key": "Strict-Transport-Security",
+						"value": "max-age=31536000; includeSubDomains; preload"
+					}
+				},
+				{
+					"append": false,
+					"header": {
+						"key": "X-Frame-Options",
+						"value": "SAMEORIGIN"
+					}
+				},
+				{
+					"append": false,
+					"header": {
+						"key": "X-XSS-Protection",
+						"value": "1; mode=block"
+					}
+				}],
+				"routes": [
+					{
+						"name": "pomerium-path-/.pomerium/jwt",
+						"match": {
+							"path": "/.pomerium/jwt"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						}
+					},
+					{
+						"name": "pomerium-path-/.pomerium/userinfo",
+						"match": {
+							"path": "/.pomerium/userinfo"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						}
+					},
+					{
+						"name": "pomerium-path-/ping",
+						"match": {
+							"path": "/ping"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/healthz",
+						"match": {
+							"path": "/healthz"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/readyz",
+						"match": {
+							"path": "/readyz"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/.pomerium",
+						"match": {
+							"path": "/.pomerium"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-prefix-/.pomerium/",
+						"match": {
+							"prefix": "/.pomerium/"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/.well-known/pomerium",
+						"match": {
+							"path": "/.well-known/pomerium"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-prefix-/.well-known/pomerium/",
+						"match": {
+							"prefix": "/.well-known/pomerium/"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/robots.txt",
+						"match": {
+							"path": "/robots.txt"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					}
+				]
+			},
+			{
+				"name": "catch-all",
+				"domains": ["*"],
+				"responseHeadersToAdd": [{
+					"append": false,
+					"header": {
+						"key": "Strict-Transport-Security",
+						"value": "max-age=31536000; includeSubDomains; preload"
+					}
+				},
+				{
+					"append": false,
+					"header": {
+						"key": "X-Frame-Options",
+						"value": "SAMEORIGIN"
+					}
+				},
+				{
+					"append": false,
+					"header": {
+						"key": "X-XSS-Protection",
+						"value": "1; mode=block"
+					}
+				}],
+				"routes": [
+					{
+						"name": "pomerium-path-/.pomerium/jwt",
+						"match": {
+							"path": "/.pomerium/jwt"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						}
+					},
+					{
+						"name": "pomerium-path-/.pomerium/userinfo",
+						"match": {
+							"path": "/.pomerium/userinfo"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						}
+					},
+					{
+						"name": "pomerium-path-/ping",
+						"match": {
+							"path": "/ping"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/healthz",
+						"match": {
+							"path": "/healthz"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/readyz",
+						"match": {
+							"path": "/readyz"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/.pomerium",
+						"match": {
+							"path": "/.pomerium"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-prefix-/.pomerium/",
+						"match": {
+							"prefix": "/.pomerium/"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/.well-known/pomerium",
+						"match": {
+							"path": "/.well-known/pomerium"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-prefix-/.well-known/pomerium/",
+						"match": {
+							"prefix": "/.well-known/pomerium/"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					},
+					{
+						"name": "pomerium-path-/robots.txt",
+						"match": {
+							"path": "/robots.txt"
+						},
+						"route": {
+							"cluster": "pomerium-control-plane-http"
+						},
+						"typedPerFilterConfig": {
+							"envoy.filters.http.ext_authz": {
+								"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+								"disabled": true
+							}
+						}
+					}
+				]
+			}
+		],
+		"mostSpecificHeaderMutationsWins": true,
+		"validateClusters": false
+	}`, rc)
+}
+
+func Test_buildExtAuthzFilters(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.Policies = []config.Policy{
+		{From: "https://public.example.com", AllowPublicUnauthenticatedAccess: true, AuthorizeFailOpen: true},
+		{From: "https://private.example.com"},
+	}
+	filters := buildExtAuthzFilters(options, durationpb.New(10*time.Second))
+	testutil.AssertProtoJSONEqual(t, `[
+		{
+			"name": "envoy.filters.http.lua",
+			"typedConfig": {
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua",
+				"inlineCode": `+jsonString(t, luascripts.AuthorizeFailureMode)+`
+			}
+		},
+		{
+			"name": "envoy.filters.http.ext_authz",
+			"typedConfig": {
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz",
+				"filterEnabledMetadata": {
+					"filter": "envoy.filters.http.lua",
+					"path": [{"key": "authorize_failure_mode"}],
+					"value": {"stringMatch": {"exact": "closed"}}
+				},
+				"grpcService": {
+					"envoyGrpc": {
+						"clusterName": "pomerium-authorize"
+					},
+					"timeout": "10s"
+				},
+				"includePeerCertificate": true,
+				"statusOnError": {
+					"code": "ServiceUnavailable"
+				},
+				"transportApiVersion": "V3"
+			}
+		},
+		{
+			"name": "envoy.filters.http.ext_authz",
+			"typedConfig": {
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz",
+				"failureModeAllow": true,
+				"filterEnabledMetadata": {
+					"filter": "envoy.filters.http.lua",
+					"path": [{"key": "authorize_failure_mode"}],
+					"value": {"stringMatch": {"exact": "open"}}
+				},
+				"grpcService": {
+					"envoyGrpc": {
+						"clusterName": "pomerium-authorize"
+					},
+					"timeout": "10s"
+				},
+				"includePeerCertificate": true,
+				"statusOnError": {
+					"code": "ServiceUnavailable"
+				},
+				"transportApiVersion": "V3"
+			}
+		}
+	]`, filters)
+}
+
+func Test_buildExtAuthzFiltersWithRequestBody(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.Policies = []config.Policy{
+		{From: "https://api.example.com", AWSSigV4: &config.AWSSigV4{Service: "execute-api", Region: "us-east-1"}},
+	}
+	filters := buildExtAuthzFilters(options, durationpb.New(10*time.Second))
+	testutil.AssertProtoJSONEqual(t, `[
+		{
+			"name": "envoy.filters.http.ext_authz",
+			"typedConfig": {
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthz",
+				"grpcService": {
+					"envoyGrpc": {
+						"clusterName": "pomerium-authorize"
+					},
+					"timeout": "10s"
+				},
+				"includePeerCertificate": true,
+				"statusOnError": {
+					"code": "ServiceUnavailable"
+				},
+				"transportApiVersion": "V3",
+				"withRequestBody": {
+					"maxRequestBytes": 1048576,
+					"packAsBytes": true
+				}
+			}
+		}
+	]`, filters)
+}
+
+func Test_extAuthzRequestBodyPerRoute(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.Services = "proxy"
+	options.Policies = []config.Policy{
+		{
+			Source:   &config.StringURL{URL: &url.URL{Scheme: "https", Host: "api.example.com"}},
+			AWSSigV4: &config.AWSSigV4{Service: "execute-api", Region: "us-east-1"},
+		},
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "upload.example.com"}},
+		},
+	}
+
+	testutil.AssertProtoJSONEqual(t, `{ "typedPerFilterConfig": {
+		"envoy.filters.http.ext_authz": {
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+			"checkSettings": { "disableRequestBodyBuffering": true }
+		}
+	} }`, &envoy_config_route_v3.VirtualHost{TypedPerFilterConfig: buildVirtualHostRouteFilterConfig(options)})
+
+	b := &Builder{filemgr: filemgr.NewManager()}
+	routes, err := b.buildPolicyRoutes(options, config.MainListenerName, "api.example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	testutil.AssertProtoJSONEqual(t, `{ "typedPerFilterConfig": {
+		"envoy.filters.http.ext_authz": {
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_authz.v3.ExtAuthzPerRoute",
+			"checkSettings": {}
+		}
+	} }`, &envoy_config_route_v3.Route{TypedPerFilterConfig: routes[0].TypedPerFilterConfig})
+
+	routes, err = b.buildPolicyRoutes(options, config.MainListenerName, "upload.example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	assert.Empty(t, routes[0].TypedPerFilterConfig, "the upload should be streamed")
+
+	options.Policies = options.Policies[1:]
+	assert.Nil(t, buildVirtualHostRouteFilterConfig(options))
+}
+
 func Test_buildDownstreamTLSContext(t *testing.T) {
 	b := New("local-grpc", "local-http", filemgr.NewManager(), nil)
 
@@ -710,6 +1019,74 @@ func Test_buildDownstreamTLSContext(t *testing.T) {
 	})
 }
 
+func Test_buildInternalCABootstrapFilterChain(t *testing.T) {
+	b := New("local-grpc", "local-http", filemgr.NewManager(), nil)
+
+	chain, err := b.buildInternalCABootstrapFilterChain(context.Background(), &config.Config{Options: &config.Options{
+		Cert:          aExampleComCert,
+		Key:           aExampleComKey,
+		ClientCA:      base64.StdEncoding.EncodeToString([]byte("CA")),
+		InternalCA:    true,
+		Services:      config.ServiceDataBroker,
+		InternalCAKey: "KEY",
+	}})
+	require.NoError(t, err)
+	require.NotNil(t, chain)
+	assert.Equal(t, []string{"pomerium-internal-ca-bootstrap"}, chain.GetFilterChainMatch().GetServerNames())
+
+	tlsContext := new(envoy_extensions_transport_sockets_tls_v3.DownstreamTlsContext)
+	require.NoError(t, chain.GetTransportSocket().GetTypedConfig().UnmarshalTo(tlsContext))
+	assert.Nil(t, tlsContext.GetCommonTlsContext().GetValidationContextType(), "should not validate client certificates")
+	assert.Nil(t, tlsContext.GetRequireClientCertificate())
+
+	hcm := new(envoy_http_connection_manager.HttpConnectionManager)
+	require.NoError(t, chain.GetFilters()[0].GetTypedConfig().UnmarshalTo(hcm))
+	routes := hcm.GetRouteConfig().GetVirtualHosts()[0].GetRoutes()
+	if assert.Len(t, routes, 1) {
+		assert.Equal(t, "/pomerium.internalca.Bootstrap/", routes[0].GetMatch().GetPrefix())
+	}
+}
+
+func Test_buildGRPCClientCAValidationContext(t *testing.T) {
+	b := New("local-grpc", "local-http", filemgr.NewManager(), nil)
+
+	vc, err := b.buildGRPCClientCAValidationContext(&config.Options{})
+	assert.NoError(t, err)
+	assert.Nil(t, vc)
+
+	vc, err = b.buildGRPCClientCAValidationContext(&config.Options{GRPCClientCAFile: "/etc/pomerium/grpc-client-ca.pem"})
+	assert.NoError(t, err)
+	testutil.AssertProtoJSONEqual(t, `{
+		"trustedCa": {
+			"filename": "/etc/pomerium/grpc-client-ca.pem"
+		}
+	}`, vc.ValidationContext)
+
+	_, err = b.buildGRPCClientCAValidationContext(&config.Options{GRPCClientCA: "%"})
+	assert.Error(t, err)
+}
+
+func Test_buildGRPCListenerSPIRE(t *testing.T) {
+	b := New("local-grpc", "local-http", filemgr.NewManager(), nil)
+
+	li, err := b.buildGRPCListener(context.Background(), &config.Config{Options: &config.Options{
+		Cert:             aExampleComCert,
+		Key:              aExampleComKey,
+		Services:         config.ServiceAuthorize,
+		SPIREAgentSocket: "/run/spire/sockets/agent.sock",
+	}})
+	require.NoError(t, err)
+	require.NotEmpty(t, li.GetFilterChains())
+
+	for _, chain := range li.GetFilterChains() {
+		tlsContext := new(envoy_extensions_transport_sockets_tls_v3.DownstreamTlsContext)
+		require.NoError(t, chain.GetTransportSocket().GetTypedConfig().UnmarshalTo(tlsContext))
+		assert.True(t, tlsContext.GetRequireClientCertificate().GetValue(), "should require svids")
+		assert.Equal(t, "ROOTCA", tlsContext.GetCommonTlsContext().GetCombinedValidationContext().
+			GetValidationContextSdsSecretConfig().GetName())
+	}
+}
+
 func Test_getAllDomains(t *testing.T) {
 	options := &config.Options{
 		Addr:                  "127.0.0.1:9000",
@@ -774,6 +1151,90 @@ func Test_getAllDomains(t *testing.T) {
 	})
 }
 
+func Test_additionalListeners(t *testing.T) {
+	b := New("local-grpc", "local-http", filemgr.NewManager(), nil)
+	cfg := &config.Config{Options: &config.Options{
+		Addr:                  "127.0.0.1:9000",
+		GRPCAddr:              "127.0.0.1:9001",
+		Services:              "all",
+		InsecureServer:        true,
+		AuthenticateURLString: "https://authenticate.example.com",
+		Listeners:             []config.Listener{{Name: "internal", Address: "127.0.0.1:9002"}},
+		Policies: []config.Policy{
+			{Source: &config.StringURL{URL: mustParseURL(t, "https://a.example.com")}},
+			{Source: &config.StringURL{URL: mustParseURL(t, "https://b.example.com")}, Listeners: []string{"internal"}},
+			{Source: &config.StringURL{URL: mustParseURL(t, "https://c.example.com")}, Listeners: []string{"main", "internal"}},
+		},
+	}}
+
+	t.Run("routable domains", func(t *testing.T) {
+		actual, err := getAllRouteableDomains(cfg.Options, "127.0.0.1:9000")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"a.example.com",
+			"a.example.com:443",
+			"authenticate.example.com",
+			"authenticate.example.com:443",
+			"c.example.com",
+			"c.example.com:443",
+		}, actual)
+
+		actual, err = getAllRouteableDomains(cfg.Options, "127.0.0.1:9002")
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"b.example.com",
+			"b.example.com:443",
+			"c.example.com",
+			"c.example.com:443",
+		}, actual)
+	})
+	t.Run("policy routes", func(t *testing.T) {
+		routes, err := b.buildPolicyRoutes(cfg.Options, "internal", "a.example.com")
+		require.NoError(t, err)
+		assert.Empty(t, routes)
+
+		routes, err = b.buildPolicyRoutes(cfg.Options, "internal", "b.example.com")
+		require.NoError(t, err)
+		if assert.Len(t, routes, 1) {
+			assert.Equal(t, "policy-1", routes[0].GetName())
+		}
+	})
+	t.Run("listeners", func(t *testing.T) {
+		listeners, err := b.BuildListeners(context.Background(), cfg)
+		require.NoError(t, err)
+		var names []string
+		for _, li := range listeners {
+			names = append(names, li.GetName())
+		}
+		assert.Equal(t, []string{"http-ingress", "http-ingress-internal", "grpc-ingress"}, names)
+		testutil.AssertProtoJSONEqual(t, `{
+			"socketAddress": {
+				"address": "127.0.0.1",
+				"ipv4Compat": true,
+				"portValue": 9002
+			}
+		}`, listeners[1].GetAddress())
+	})
+	t.Run("route configurations", func(t *testing.T) {
+		routeConfigurations, err := b.BuildRouteConfigurations(context.Background(), cfg)
+		require.NoError(t, err)
+		var names []string
+		for _, rc := range routeConfigurations {
+			names = append(names, rc.GetName())
+		}
+		assert.Equal(t, []string{"main", "main-internal"}, names)
+		var virtualHosts []string
+		for _, vh := range routeConfigurations[1].GetVirtualHosts() {
+			virtualHosts = append(virtualHosts, vh.GetName())
+		}
+		assert.Equal(t, []string{
+			"b.example.com", "b.example.com:443",
+			"c.example.com", "c.example.com:443",
+			"catch-all",
+		}, virtualHosts)
+	})
+}
+
 func Test_hostMatchesDomain(t *testing.T) {
 	assert.True(t, hostMatchesDomain(mustParseURL(t, "http://example.com"), "example.com"))
 	assert.True(t, hostMatchesDomain(mustParseURL(t, "http://example.com"), "example.com:80"))
@@ -792,6 +1253,7 @@ func Test_buildRouteConfiguration(t *testing.T) {
 	assert.Equal(t, "test-route-configuration", routeConfig.GetName())
 	assert.Equal(t, virtualHosts, routeConfig.GetVirtualHosts())
 	assert.False(t, routeConfig.GetValidateClusters().GetValue())
+	assert.True(t, routeConfig.GetMostSpecificHeaderMutationsWins())
 }
 
 func Test_requireProxyProtocol(t *testing.T) {
@@ -820,3 +1282,91 @@ func Test_requireProxyProtocol(t *testing.T) {
 		assert.Len(t, li.GetListenerFilters(), 0)
 	})
 }
+
+func Test_buildMainQUICListener(t *testing.T) {
+	b := New("local-grpc", "local-http", filemgr.NewManager(), nil)
+	cfg := &config.Config{Options: &config.Options{
+		Addr:      ":8443",
+		Cert:      aExampleComCert,
+		Key:       aExampleComKey,
+		Services:  config.ServiceProxy,
+		CodecType: config.CodecTypeHTTP3,
+	}}
+
+	li, err := b.buildMainQUICListener(context.Background(), cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "quic-ingress", li.GetName())
+	assert.Equal(t, envoy_config_core_v3.SocketAddress_UDP, li.GetAddress().GetSocketAddress().GetProtocol())
+	assert.Equal(t, uint32(8443), li.GetAddress().GetSocketAddress().GetPortValue())
+	assert.NotNil(t, li.GetUdpListenerConfig().GetQuicOptions())
+	require.NotEmpty(t, li.GetFilterChains())
+	for _, chain := range li.GetFilterChains() {
+		assert.Equal(t, "envoy.transport_sockets.quic", chain.GetTransportSocket().GetName())
+
+		var transport envoy_extensions_transport_sockets_quic_v3.QuicDownstreamTransport
+		require.NoError(t, chain.GetTransportSocket().GetTypedConfig().UnmarshalTo(&transport))
+		assert.Equal(t, []string{"h3", "h3-29"}, transport.GetDownstreamTlsContext().GetCommonTlsContext().GetAlpnProtocols())
+
+		var hcm envoy_http_connection_manager.HttpConnectionManager
+		require.NoError(t, chain.GetFilters()[0].GetTypedConfig().UnmarshalTo(&hcm))
+		assert.Equal(t, envoy_http_connection_manager.HttpConnectionManager_HTTP3, hcm.GetCodecType())
+	}
+
+	t.Run("tcp", func(t *testing.T) {
+		filter, err := b.buildMainHTTPConnectionManagerFilter(cfg.Options, config.MainListenerName, "*", false)
+		require.NoError(t, err)
+
+		var hcm envoy_http_connection_manager.HttpConnectionManager
+		require.NoError(t, filter.GetTypedConfig().UnmarshalTo(&hcm))
+		assert.Equal(t, envoy_http_connection_manager.HttpConnectionManager_AUTO, hcm.GetCodecType())
+		assert.Equal(t, "main-*", hcm.GetRds().GetRouteConfigName())
+	})
+	t.Run("alt-svc", func(t *testing.T) {
+		rc, err := b.buildMainRouteConfiguration(cfg.Options, config.MainListenerName, []string{"example.com"}, "*")
+		require.NoError(t, err)
+		testutil.AssertProtoJSONEqual(t, `[{
+			"append": false,
+			"header": {
+				"key": "alt-svc",
+				"value": "h3=\":8443\"; ma=86400, h3-29=\":8443\"; ma=86400"
+			}
+		}]`, rc.GetResponseHeadersToAdd())
+	})
+	t.Run("route configurations", func(t *testing.T) {
+		routeConfigurations, err := b.BuildRouteConfigurations(context.Background(), cfg)
+		require.NoError(t, err)
+		names := map[string]bool{}
+		for _, rc := range routeConfigurations {
+			names[rc.GetName()] = true
+		}
+		for _, chain := range li.GetFilterChains() {
+			var hcm envoy_http_connection_manager.HttpConnectionManager
+			require.NoError(t, chain.GetFilters()[0].GetTypedConfig().UnmarshalTo(&hcm))
+			assert.True(t, names[hcm.GetRds().GetRouteConfigName()],
+				"the QUIC listener should share the route configurations of the main listener")
+		}
+	})
+	t.Run("insecure", func(t *testing.T) {
+		listeners, err := b.BuildListeners(context.Background(), &config.Config{Options: &config.Options{
+			Services:       config.ServiceProxy,
+			InsecureServer: true,
+			CodecType:      config.CodecTypeHTTP3,
+		}})
+		require.NoError(t, err)
+		for _, li := range listeners {
+			assert.NotEqual(t, "quic-ingress", li.GetName())
+		}
+	})
+}
+
+func Test_getAltSvc(t *testing.T) {
+	assert.Equal(t, `h3=":443"; ma=86400, h3-29=":443"; ma=86400`, getAltSvc(":443"))
+	assert.Equal(t, `h3=":8443"; ma=86400, h3-29=":8443"; ma=86400`, getAltSvc("127.0.0.1:8443"))
+	assert.Equal(t, `h3=":443"; ma=86400, h3-29=":443"; ma=86400`, getAltSvc(""))
+}
+
+func jsonString(t *testing.T, str string) string {
+	bs, err := json.Marshal(str)
+	require.NoError(t, err)
+	return string(bs)
+}
@@ -0,0 +1,72 @@
+package envoyconfig
+
+import (
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_extensions_filters_http_local_ratelimit_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoy_type_v3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+const (
+	localRateLimitFilterName = "envoy.filters.http.local_ratelimit"
+	localRateLimitStatPrefix = "local_rate_limit"
+)
+
+// buildLocalRateLimitFilter builds the local rate limit filter. It has no token bucket of its own, so only
+// routes with a local_rate_limit are limited.
+func buildLocalRateLimitFilter(options *config.Options) *envoy_http_connection_manager.HttpFilter {
+	if !hasLocalRateLimitPolicy(options) {
+		return nil
+	}
+
+	return &envoy_http_connection_manager.HttpFilter{
+		Name: localRateLimitFilterName,
+		ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+			TypedConfig: marshalAny(&envoy_extensions_filters_http_local_ratelimit_v3.LocalRateLimit{
+				StatPrefix: localRateLimitStatPrefix,
+			}),
+		},
+	}
+}
+
+// buildLocalRateLimitPerRoute builds the per-route config which limits the rate of requests to the policy's route.
+func buildLocalRateLimitPerRoute(policy *config.Policy) *any.Any {
+	// the filter is disabled unless enabled and enforced by the route
+	always := func(key string) *envoy_config_core_v3.RuntimeFractionalPercent {
+		return &envoy_config_core_v3.RuntimeFractionalPercent{
+			DefaultValue: &envoy_type_v3.FractionalPercent{
+				Numerator:   100,
+				Denominator: envoy_type_v3.FractionalPercent_HUNDRED,
+			},
+			RuntimeKey: key,
+		}
+	}
+
+	return marshalAny(&envoy_extensions_filters_http_local_ratelimit_v3.LocalRateLimit{
+		StatPrefix: localRateLimitStatPrefix,
+		TokenBucket: &envoy_type_v3.TokenBucket{
+			MaxTokens:     policy.LocalRateLimit.GetBurst(),
+			TokensPerFill: wrapperspb.UInt32(policy.LocalRateLimit.RequestsPerUnit),
+			FillInterval:  durationpb.New(policy.LocalRateLimit.GetUnit()),
+		},
+		FilterEnabled:  always("local_rate_limit_enabled"),
+		FilterEnforced: always("local_rate_limit_enforced"),
+	})
+}
+
+func hasLocalRateLimitPolicy(options *config.Options) bool {
+	if !config.IsProxy(options.Services) {
+		return false
+	}
+	for _, p := range options.GetAllPolicies() {
+		if p.LocalRateLimit != nil {
+			return true
+		}
+	}
+	return false
+}
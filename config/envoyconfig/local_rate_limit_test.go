@@ -0,0 +1,67 @@
+package envoyconfig
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
+	"github.com/pomerium/pomerium/internal/testutil"
+)
+
+func Test_buildLocalRateLimit(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.Services = "proxy"
+	options.Policies = []config.Policy{
+		{
+			Source:         &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:           "/a",
+			LocalRateLimit: &config.LocalRateLimit{RequestsPerUnit: 10, Unit: time.Minute, Burst: 20},
+		},
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:   "/b",
+		},
+	}
+
+	testutil.AssertProtoJSONEqual(t, `{
+		"name": "envoy.filters.http.local_ratelimit",
+		"typedConfig": {
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit",
+			"statPrefix": "local_rate_limit"
+		}
+	}`, buildLocalRateLimitFilter(options))
+
+	b := &Builder{filemgr: filemgr.NewManager()}
+	routes, err := b.buildPolicyRoutes(options, config.MainListenerName, "example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	testutil.AssertProtoJSONEqual(t, `{ "typedPerFilterConfig": {
+		"envoy.filters.http.local_ratelimit": {
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit",
+			"statPrefix": "local_rate_limit",
+			"tokenBucket": {
+				"maxTokens": 20,
+				"tokensPerFill": 10,
+				"fillInterval": "60s"
+			},
+			"filterEnabled": {
+				"defaultValue": { "numerator": 100 },
+				"runtimeKey": "local_rate_limit_enabled"
+			},
+			"filterEnforced": {
+				"defaultValue": { "numerator": 100 },
+				"runtimeKey": "local_rate_limit_enforced"
+			}
+		}
+	} }`, &envoy_config_route_v3.Route{TypedPerFilterConfig: routes[0].TypedPerFilterConfig})
+	assert.Empty(t, routes[1].TypedPerFilterConfig)
+
+	options.Policies = options.Policies[1:]
+	assert.Nil(t, buildLocalRateLimitFilter(options))
+}
@@ -9,19 +9,37 @@ import (
 var luaFS embed.FS
 
 var luascripts struct {
+	AuthorizeFailureMode     string
+	CacheRestore             string
+	CacheSelect              string
+	CompressionRestore       string
+	CompressionSave          string
+	CompressionSelect        string
 	ExtAuthzSetCookie        string
+	MaxRequestBodySize       string
 	CleanUpstream            string
+	OverrideRequestID        string
 	RemoveImpersonateHeaders string
 	RewriteHeaders           string
+	RevokeSession            string
 	FixMisdirected           string
 }
 
 func init() {
 	fileToField := map[string]*string{
+		"luascripts/authorize-failure-mode.lua":     &luascripts.AuthorizeFailureMode,
+		"luascripts/cache-restore.lua":              &luascripts.CacheRestore,
+		"luascripts/cache-select.lua":               &luascripts.CacheSelect,
 		"luascripts/clean-upstream.lua":             &luascripts.CleanUpstream,
+		"luascripts/compression-restore.lua":        &luascripts.CompressionRestore,
+		"luascripts/compression-save.lua":           &luascripts.CompressionSave,
+		"luascripts/compression-select.lua":         &luascripts.CompressionSelect,
 		"luascripts/ext-authz-set-cookie.lua":       &luascripts.ExtAuthzSetCookie,
+		"luascripts/max-request-body-size.lua":      &luascripts.MaxRequestBodySize,
+		"luascripts/override-request-id.lua":        &luascripts.OverrideRequestID,
 		"luascripts/remove-impersonate-headers.lua": &luascripts.RemoveImpersonateHeaders,
 		"luascripts/rewrite-headers.lua":            &luascripts.RewriteHeaders,
+		"luascripts/revoke-session.lua":             &luascripts.RevokeSession,
 		"luascripts/fix-misdirected.lua":            &luascripts.FixMisdirected,
 	}
 
@@ -65,6 +65,31 @@ func TestLuaFixMisdirected(t *testing.T) {
 	})
 }
 
+func TestLuaFixMisdirectedWildcard(t *testing.T) {
+	run := func(t *testing.T, authority string) string {
+		L := lua.NewState()
+		defer L.Close()
+
+		require.NoError(t, L.DoString(fmt.Sprintf(luascripts.FixMisdirected, "*.apps.example.com")))
+
+		headers := map[string]string{":status": "404"}
+		dynamicMetadata := map[string]map[string]interface{}{
+			"envoy.filters.http.lua": {"request.authority": authority},
+		}
+		handle := newLuaResponseHandle(L, headers, map[string]interface{}{}, dynamicMetadata)
+		require.NoError(t, L.CallByParam(lua.P{
+			Fn:      L.GetGlobal("envoy_on_response"),
+			NRet:    0,
+			Protect: true,
+		}, handle))
+		return headers[":status"]
+	}
+
+	assert.Equal(t, "404", run(t, "tenant.apps.example.com"))
+	assert.Equal(t, "421", run(t, "tenant.example.com"))
+	assert.Equal(t, "421", run(t, "apps.example.com"))
+}
+
 func TestLuaRewriteHeaders(t *testing.T) {
 	L := lua.NewState()
 	defer L.Close()
@@ -104,6 +129,280 @@ func TestLuaRewriteHeaders(t *testing.T) {
 	assert.Equal(t, "https://frontend/one/some/uri/", headers["Location"])
 }
 
+func TestLuaCleanUpstream(t *testing.T) {
+	run := func(t *testing.T, path string) string {
+		L := lua.NewState()
+		defer L.Close()
+
+		require.NoError(t, L.DoString(luascripts.CleanUpstream))
+
+		headers := map[string]string{":path": path}
+		handle := newLuaResponseHandle(L, headers, map[string]interface{}{}, nil)
+		require.NoError(t, L.CallByParam(lua.P{
+			Fn:      L.GetGlobal("envoy_on_request"),
+			NRet:    0,
+			Protect: true,
+		}, handle))
+		return headers[":path"]
+	}
+
+	assert.Equal(t, "/report.pdf", run(t, "/report.pdf"))
+	assert.Equal(t, "/report.pdf?download=1", run(t, "/report.pdf?download=1"))
+	assert.Equal(t, "/report.pdf", run(t,
+		"/report.pdf?pomerium_shared_expiry=1622592000&pomerium_shared_signature=abc"))
+	assert.Equal(t, "/report.pdf?download=1&format=csv", run(t,
+		"/report.pdf?download=1&pomerium_shared_expiry=1622592000&format=csv&pomerium_shared_signature=abc"))
+}
+
+func TestLuaOverrideRequestID(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	bs, err := luaFS.ReadFile("luascripts/override-request-id.lua")
+	require.NoError(t, err)
+	require.NoError(t, L.DoString(string(bs)))
+
+	ids := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		headers := map[string]string{"x-request-id": "CLIENT"}
+		handle := newLuaResponseHandle(L, headers, map[string]interface{}{}, nil)
+		require.NoError(t, L.CallByParam(lua.P{
+			Fn:      L.GetGlobal("envoy_on_request"),
+			NRet:    0,
+			Protect: true,
+		}, handle))
+		assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, headers["x-request-id"])
+		ids[headers["x-request-id"]] = true
+	}
+	assert.Len(t, ids, 100, "request ids should be unique")
+}
+
+func TestLuaRevokeSession(t *testing.T) {
+	run := func(t *testing.T, allow bool, revoke string) (responseHeaders map[string]string, calls []map[string]interface{}) {
+		L := lua.NewState()
+		defer L.Close()
+
+		bs, err := luaFS.ReadFile("luascripts/revoke-session.lua")
+		require.NoError(t, err)
+		require.NoError(t, L.DoString(string(bs)))
+
+		metadata := map[string]interface{}{
+			"allow_upstream_session_revocation": allow,
+		}
+		dynamicMetadata := map[string]map[string]interface{}{}
+
+		requestHeaders := map[string]string{
+			":authority": "from.example.com",
+			"cookie":     "_pomerium=SESSION; other=1",
+		}
+		handle := newLuaResponseHandle(L, requestHeaders, metadata, dynamicMetadata)
+		require.NoError(t, L.CallByParam(lua.P{
+			Fn:      L.GetGlobal("envoy_on_request"),
+			NRet:    0,
+			Protect: true,
+		}, handle))
+
+		responseHeaders = map[string]string{
+			"x-pomerium-revoke-session": revoke,
+		}
+		handle = newLuaResponseHandle(L, responseHeaders, metadata, dynamicMetadata)
+		L.SetField(handle, "httpCall", L.NewFunction(func(L *lua.LState) int {
+			_ = L.CheckTable(1)
+			assert.Equal(t, "pomerium-control-plane-http", L.CheckString(2))
+			calls = append(calls, fromLua(L, L.CheckTable(3)).(map[string]interface{}))
+			L.Push(toLua(L, map[string]interface{}{
+				":status":    "204",
+				"set-cookie": "_pomerium=; Max-Age=0",
+			}))
+			L.Push(lua.LString(""))
+			return 2
+		}))
+		require.NoError(t, L.CallByParam(lua.P{
+			Fn:      L.GetGlobal("envoy_on_response"),
+			NRet:    0,
+			Protect: true,
+		}, handle))
+		return responseHeaders, calls
+	}
+
+	t.Run("revoke", func(t *testing.T) {
+		responseHeaders, calls := run(t, true, "true")
+		assert.Equal(t, []map[string]interface{}{{
+			":method":    "POST",
+			":path":      "/.pomerium/revoke_session",
+			":authority": "from.example.com",
+			"cookie":     "_pomerium=SESSION; other=1",
+		}}, calls)
+		assert.Equal(t, map[string]string{
+			"set-cookie": "_pomerium=; Max-Age=0",
+		}, responseHeaders)
+	})
+	t.Run("not allowed", func(t *testing.T) {
+		responseHeaders, calls := run(t, false, "true")
+		assert.Empty(t, calls)
+		assert.Empty(t, responseHeaders, "the header should be removed")
+	})
+	t.Run("false", func(t *testing.T) {
+		_, calls := run(t, true, "false")
+		assert.Empty(t, calls)
+	})
+}
+
+func TestLuaAuthorizeFailureMode(t *testing.T) {
+	run := func(t *testing.T, metadata map[string]interface{}) string {
+		L := lua.NewState()
+		defer L.Close()
+
+		bs, err := luaFS.ReadFile("luascripts/authorize-failure-mode.lua")
+		require.NoError(t, err)
+		require.NoError(t, L.DoString(string(bs)))
+
+		dynamicMetadata := map[string]map[string]interface{}{}
+		handle := newLuaResponseHandle(L, map[string]string{}, metadata, dynamicMetadata)
+		require.NoError(t, L.CallByParam(lua.P{
+			Fn:      L.GetGlobal("envoy_on_request"),
+			NRet:    0,
+			Protect: true,
+		}, handle))
+		return dynamicMetadata["envoy.filters.http.lua"]["authorize_failure_mode"].(string)
+	}
+
+	assert.Equal(t, "open", run(t, map[string]interface{}{"authorize_fail_open": true}))
+	assert.Equal(t, "closed", run(t, map[string]interface{}{"authorize_fail_open": false}))
+	assert.Equal(t, "closed", run(t, map[string]interface{}{}), "routes without metadata should fail closed")
+}
+
+func TestLuaCompression(t *testing.T) {
+	run := func(t *testing.T, code string, headers map[string]string, metadata map[string]interface{}) {
+		L := lua.NewState()
+		defer L.Close()
+
+		err := L.DoString(code)
+		require.NoError(t, err)
+
+		handle := newLuaResponseHandle(L, headers, metadata, nil)
+		err = L.CallByParam(lua.P{
+			Fn:      L.GetGlobal("envoy_on_request"),
+			NRet:    0,
+			Protect: true,
+		}, handle)
+		require.NoError(t, err)
+	}
+
+	t.Run("route", func(t *testing.T) {
+		headers := map[string]string{"accept-encoding": "br, gzip"}
+		metadata := map[string]interface{}{"compression": "a"}
+		run(t, luascripts.CompressionSave, headers, metadata)
+		run(t, fmt.Sprintf(luascripts.CompressionSelect, "b"), headers, metadata)
+		assert.NotContains(t, headers, "accept-encoding", "should hide the header from other compressors")
+		run(t, fmt.Sprintf(luascripts.CompressionSelect, "a"), headers, metadata)
+		assert.Equal(t, "br, gzip", headers["accept-encoding"])
+		run(t, luascripts.CompressionRestore, headers, metadata)
+		assert.Equal(t, map[string]string{"accept-encoding": "br, gzip"}, headers)
+	})
+	t.Run("no accept-encoding", func(t *testing.T) {
+		headers := map[string]string{"x-pomerium-accept-encoding": "gzip"}
+		metadata := map[string]interface{}{"compression": "a"}
+		run(t, luascripts.CompressionSave, headers, metadata)
+		run(t, fmt.Sprintf(luascripts.CompressionSelect, "a"), headers, metadata)
+		run(t, luascripts.CompressionRestore, headers, metadata)
+		assert.Empty(t, headers, "should ignore the saved header from the client")
+	})
+}
+
+func TestLuaCache(t *testing.T) {
+	run := func(t *testing.T, code, fn string, headers map[string]string, metadata map[string]interface{}) {
+		L := lua.NewState()
+		defer L.Close()
+
+		err := L.DoString(code)
+		require.NoError(t, err)
+
+		handle := newLuaResponseHandle(L, headers, metadata, nil)
+		err = L.CallByParam(lua.P{
+			Fn:      L.GetGlobal(fn),
+			NRet:    0,
+			Protect: true,
+		}, handle)
+		require.NoError(t, err)
+	}
+
+	t.Run("route", func(t *testing.T) {
+		headers := map[string]string{}
+		metadata := map[string]interface{}{"cache": "b"}
+		run(t, fmt.Sprintf(luascripts.CacheSelect, "a"), "envoy_on_request", headers, metadata)
+		assert.Equal(t, "x-pomerium-cache-bypass", headers["authorization"], "should bypass other caches")
+		run(t, fmt.Sprintf(luascripts.CacheSelect, "b"), "envoy_on_request", headers, metadata)
+		assert.NotContains(t, headers, "authorization")
+		run(t, fmt.Sprintf(luascripts.CacheSelect, "c"), "envoy_on_request", headers, metadata)
+		run(t, luascripts.CacheRestore, "envoy_on_request", headers, metadata)
+		assert.Empty(t, headers)
+	})
+	t.Run("authorization", func(t *testing.T) {
+		headers := map[string]string{"authorization": "Bearer TOKEN"}
+		metadata := map[string]interface{}{"cache": "b"}
+		run(t, fmt.Sprintf(luascripts.CacheSelect, "a"), "envoy_on_request", headers, metadata)
+		run(t, fmt.Sprintf(luascripts.CacheSelect, "b"), "envoy_on_request", headers, metadata)
+		run(t, luascripts.CacheRestore, "envoy_on_request", headers, metadata)
+		assert.Equal(t, map[string]string{"authorization": "Bearer TOKEN"}, headers)
+	})
+	t.Run("ttl", func(t *testing.T) {
+		for _, tc := range []struct {
+			cacheControl string
+			expect       string
+		}{
+			{"public, max-age=3600", "public, max-age=3600, s-maxage=60"},
+			{"public, max-age=3600, s-maxage=600", "public, max-age=3600, s-maxage=60"},
+			{"public, max-age=30", "public, max-age=30"},
+			{"private, max-age=3600", "private, max-age=3600"},
+			{"no-store", "no-store"},
+		} {
+			headers := map[string]string{"cache-control": tc.cacheControl}
+			metadata := map[string]interface{}{"cache": "a", "cache_ttl": float64(60)}
+			run(t, luascripts.CacheRestore, "envoy_on_response", headers, metadata)
+			assert.Equal(t, tc.expect, headers["cache-control"], tc.cacheControl)
+		}
+	})
+}
+
+func TestLuaMaxRequestBodySize(t *testing.T) {
+	run := func(t *testing.T, headers map[string]string, metadata map[string]interface{}) string {
+		L := lua.NewState()
+		defer L.Close()
+
+		require.NoError(t, L.DoString(luascripts.MaxRequestBodySize))
+
+		var status string
+		handle := newLuaType(L, map[string]lua.LGFunction{
+			"headers": func(L *lua.LState) int {
+				L.Push(newLuaHeaders(L, headers))
+				return 1
+			},
+			"metadata": func(L *lua.LState) int {
+				L.Push(newLuaMetadata(L, metadata))
+				return 1
+			},
+			"respond": func(L *lua.LState) int {
+				status = L.CheckTable(2).RawGetString(":status").String()
+				return 0
+			},
+		})
+		require.NoError(t, L.CallByParam(lua.P{
+			Fn:      L.GetGlobal("envoy_on_request"),
+			NRet:    0,
+			Protect: true,
+		}, handle))
+		return status
+	}
+
+	metadata := map[string]interface{}{"max_request_body_size": float64(1024)}
+	assert.Equal(t, "413", run(t, map[string]string{"content-length": "1025"}, metadata))
+	assert.Empty(t, run(t, map[string]string{"content-length": "1024"}, metadata))
+	assert.Empty(t, run(t, map[string]string{}, metadata), "requests without a content-length should be allowed")
+	assert.Empty(t, run(t, map[string]string{"content-length": "1025"}, map[string]interface{}{}),
+		"routes without a limit should be allowed")
+}
+
 func newLuaResponseHandle(L *lua.LState,
 	headers map[string]string,
 	metadata map[string]interface{},
@@ -148,6 +447,23 @@ func newLuaHeaders(L *lua.LState, headers map[string]string) lua.LValue {
 
 			headers[key] = value
 
+			return 0
+		},
+		"add": func(L *lua.LState) int {
+			_ = L.CheckTable(1)
+			key := L.CheckString(2)
+			value := L.CheckString(3)
+
+			headers[key] = value
+
+			return 0
+		},
+		"remove": func(L *lua.LState) int {
+			_ = L.CheckTable(1)
+			key := L.CheckString(2)
+
+			delete(headers, key)
+
 			return 0
 		},
 	})
@@ -0,0 +1,16 @@
+function envoy_on_request(request_handle)
+    local metadata = request_handle:metadata()
+    local dynamic_meta = request_handle:streamInfo():dynamicMetadata()
+
+    -- the ext_authz filters are enabled based on the failure mode, so it must
+    -- always be set
+    local failure_mode = "closed"
+    if metadata:get("authorize_fail_open") then
+        failure_mode = "open"
+    end
+    dynamic_meta:set("envoy.filters.http.lua", "authorize_failure_mode",
+                     failure_mode)
+end
+
+function envoy_on_response(response_handle)
+end
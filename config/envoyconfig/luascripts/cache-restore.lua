@@ -0,0 +1,45 @@
+function envoy_on_request(request_handle)
+    local headers = request_handle:headers()
+
+    if headers:get("authorization") == "x-pomerium-cache-bypass" then
+        headers:remove("authorization")
+    end
+end
+
+function is_cacheable(cache_control)
+    cache_control = cache_control:lower()
+    return not (cache_control:find("no-store", 1, true) or
+        cache_control:find("no-cache", 1, true) or
+        cache_control:find("private", 1, true))
+end
+
+-- the ttl limits how long responses are cached for with s-maxage, which only applies to shared caches
+function envoy_on_response(response_handle)
+    local headers = response_handle:headers()
+    local metadata = response_handle:metadata()
+
+    local ttl = metadata:get("cache_ttl")
+    local cache_control = headers:get("cache-control")
+    if ttl == nil or cache_control == nil or not is_cacheable(cache_control) then
+        return
+    end
+
+    local lower = cache_control:lower()
+    local max_age = lower:match("s%-maxage=(%d+)") or lower:match("max%-age=(%d+)")
+    if max_age ~= nil then
+        max_age = tonumber(max_age)
+    end
+    if max_age == nil or max_age <= ttl then
+        return
+    end
+
+    local directives = {}
+    for directive in cache_control:gmatch("[^,]+") do
+        directive = directive:match("^%s*(.-)%s*$")
+        if directive:lower():sub(1, 9) ~= "s-maxage=" then
+            table.insert(directives, directive)
+        end
+    end
+    table.insert(directives, "s-maxage=" .. math.floor(ttl))
+    headers:replace("cache-control", table.concat(directives, ", "))
+end
@@ -0,0 +1,18 @@
+-- requests with an authorization header bypass the cache which follows, so one is added for other routes
+function envoy_on_request(request_handle)
+    local headers = request_handle:headers()
+    local metadata = request_handle:metadata()
+
+    local authorization = headers:get("authorization")
+    if metadata:get("cache") == "%s" then
+        if authorization == "x-pomerium-cache-bypass" then
+            headers:remove("authorization")
+        end
+    elseif authorization == nil then
+        headers:replace("authorization", "x-pomerium-cache-bypass")
+    end
+end
+
+function envoy_on_response(response_handle)
+
+end
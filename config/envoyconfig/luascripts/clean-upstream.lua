@@ -10,10 +10,37 @@ function has_prefix(str, prefix)
     return str ~= nil and str:sub(1, #prefix) == prefix
 end
 
+-- shared url parameters are only meant for the authorize service, so they're removed from the query
+function remove_shared_url_params(path)
+    local i = path:find("?", 1, true)
+    if i == nil or path:find("pomerium_shared_", i, true) == nil then
+        return path
+    end
+
+    local params = {}
+    for param in path:sub(i + 1):gmatch("[^&]+") do
+        if not has_prefix(param, "pomerium_shared_") then
+            table.insert(params, param)
+        end
+    end
+    if #params == 0 then
+        return path:sub(1, i - 1)
+    end
+    return path:sub(1, i) .. table.concat(params, "&")
+end
+
 function envoy_on_request(request_handle)
     local headers = request_handle:headers()
     local metadata = request_handle:metadata()
 
+    local path = headers:get(":path")
+    if path ~= nil then
+        local newpath = remove_shared_url_params(path)
+        if newpath ~= path then
+            headers:replace(":path", newpath)
+        end
+    end
+
     local remove_cookie_name = metadata:get("remove_pomerium_cookie")
     if remove_cookie_name then
         local cookie = headers:get("cookie")
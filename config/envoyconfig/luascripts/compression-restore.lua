@@ -0,0 +1,13 @@
+function envoy_on_request(request_handle)
+    local headers = request_handle:headers()
+
+    local accept_encoding = headers:get("x-pomerium-accept-encoding")
+    if accept_encoding ~= nil then
+        headers:replace("accept-encoding", accept_encoding)
+        headers:remove("x-pomerium-accept-encoding")
+    end
+end
+
+function envoy_on_response(response_handle)
+
+end
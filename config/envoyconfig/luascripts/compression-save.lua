@@ -0,0 +1,14 @@
+-- the accept-encoding header is only shown to the compressors of the route, so it's saved before them
+function envoy_on_request(request_handle)
+    local headers = request_handle:headers()
+
+    headers:remove("x-pomerium-accept-encoding")
+    local accept_encoding = headers:get("accept-encoding")
+    if accept_encoding ~= nil then
+        headers:replace("x-pomerium-accept-encoding", accept_encoding)
+    end
+end
+
+function envoy_on_response(response_handle)
+
+end
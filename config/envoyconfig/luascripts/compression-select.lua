@@ -0,0 +1,16 @@
+function envoy_on_request(request_handle)
+    local headers = request_handle:headers()
+    local metadata = request_handle:metadata()
+
+    -- the compressors which follow only compress responses if the request has an accept-encoding header
+    local accept_encoding = headers:get("x-pomerium-accept-encoding")
+    if accept_encoding ~= nil and metadata:get("compression") == "%s" then
+        headers:replace("accept-encoding", accept_encoding)
+    else
+        headers:remove("accept-encoding")
+    end
+end
+
+function envoy_on_response(response_handle)
+
+end
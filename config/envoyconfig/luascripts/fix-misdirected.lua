@@ -20,6 +20,14 @@ function envoy_on_response(response_handle)
     local authority = filter_meta["request.authority"]
     local expected_authority = "%s"
 
+    -- a wildcard domain expects any of its subdomains
+    if authority ~= nil and string.sub(expected_authority, 1, 2) == "*." then
+        local suffix = string.sub(expected_authority, 2)
+        if #authority > #suffix and string.sub(authority, -#suffix) == suffix then
+            authority = expected_authority
+        end
+    end
+
     -- if we got a 404 (no route found) and the authority header doesn't match
     -- assume we've coalesced http/2 connections and return a 421
     if headers:get(":status") == "404" and authority ~= expected_authority then
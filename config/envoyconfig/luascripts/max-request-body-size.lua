@@ -0,0 +1,16 @@
+-- requests which declare a body larger than the route allows are rejected before they're authorized or proxied
+function envoy_on_request(request_handle)
+    local metadata = request_handle:metadata()
+    local max_request_body_size = metadata:get("max_request_body_size")
+    if max_request_body_size == nil then
+        return
+    end
+
+    local content_length = request_handle:headers():get("content-length")
+    if content_length ~= nil and tonumber(content_length) > max_request_body_size then
+        request_handle:respond({[":status"] = "413"}, "Payload Too Large")
+    end
+end
+
+function envoy_on_response(response_handle)
+end
@@ -0,0 +1,21 @@
+local seeded = false
+
+local function new_request_id()
+    if not seeded then
+        -- the address of a new table differs between envoy workers, which are seeded at the same time
+        local address = tonumber(string.sub(tostring({}), -8), 16) or 0
+        math.randomseed(os.time() + address)
+        seeded = true
+    end
+    return (string.gsub("xxxxxxxx-xxxx-4xxx-yxxx-xxxxxxxxxxxx", "[xy]", function(c)
+        local v = (c == "x") and math.random(0, 15) or math.random(8, 11)
+        return string.format("%x", v)
+    end))
+end
+
+function envoy_on_request(request_handle)
+    request_handle:headers():replace("x-request-id", new_request_id())
+end
+
+function envoy_on_response(response_handle)
+end
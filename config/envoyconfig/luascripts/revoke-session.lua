@@ -0,0 +1,58 @@
+function envoy_on_request(request_handle)
+    local headers = request_handle:headers()
+    local metadata = request_handle:metadata()
+    local dynamic_meta = request_handle:streamInfo():dynamicMetadata()
+
+    -- store the credentials before they are removed from the upstream request
+    -- so the session can be found if the upstream revokes it
+    if metadata:get("allow_upstream_session_revocation") then
+        dynamic_meta:set("envoy.filters.http.lua", "pomerium_revoke_session",
+                         {
+            authority = headers:get(":authority"),
+            cookie = headers:get("cookie"),
+            authorization = headers:get("authorization")
+        })
+    end
+end
+
+function envoy_on_response(response_handle)
+    local headers = response_handle:headers()
+    local metadata = response_handle:metadata()
+
+    local revoke = headers:get("x-pomerium-revoke-session")
+    if revoke == nil then
+        return
+    end
+    headers:remove("x-pomerium-revoke-session")
+
+    if not metadata:get("allow_upstream_session_revocation") or revoke:lower() ~= "true" then
+        return
+    end
+
+    local dynamic_meta = response_handle:streamInfo():dynamicMetadata()
+    local tbl = dynamic_meta:get("envoy.filters.http.lua")
+    if tbl == nil or tbl["pomerium_revoke_session"] == nil then
+        return
+    end
+    local req = tbl["pomerium_revoke_session"]
+
+    local call_headers = {
+        [":method"] = "POST",
+        [":path"] = "/.pomerium/revoke_session",
+        [":authority"] = req.authority
+    }
+    if req.cookie ~= nil then
+        call_headers["cookie"] = req.cookie
+    end
+    if req.authorization ~= nil then
+        call_headers["authorization"] = req.authorization
+    end
+
+    local call_response_headers, _ = response_handle:httpCall(
+                                         "pomerium-control-plane-http",
+                                         call_headers, "", 5000)
+    if call_response_headers ~= nil and call_response_headers["set-cookie"] ~=
+        nil then
+        headers:add("set-cookie", call_response_headers["set-cookie"])
+    end
+end
@@ -0,0 +1,59 @@
+package envoyconfig
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+)
+
+const (
+	defaultMaintenanceMessage    = "this application is down for maintenance, please try again later"
+	defaultMaintenanceRetryAfter = 5 * time.Minute
+)
+
+// buildMaintenanceDirectResponseAction builds the action which responds to the requests of a route in
+// maintenance with the maintenance page. Envoy serves it once the request is authorized, without proxying it.
+func buildMaintenanceDirectResponseAction(policy *config.Policy) (*envoy_config_route_v3.DirectResponseAction, error) {
+	message := policy.MaintenanceMessage
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	page, err := (&httputil.HTTPError{
+		Status: http.StatusServiceUnavailable,
+		Code:   httputil.ErrorCodeMaintenance,
+		Err:    errors.New(message),
+	}).RenderHTML()
+	if err != nil {
+		return nil, err
+	}
+
+	return &envoy_config_route_v3.DirectResponseAction{
+		Status: http.StatusServiceUnavailable,
+		Body: &envoy_config_core_v3.DataSource{
+			Specifier: &envoy_config_core_v3.DataSource_InlineString{
+				InlineString: string(page),
+			},
+		},
+	}, nil
+}
+
+// getMaintenanceResponseHeaders returns the headers of the maintenance responses of a route.
+func getMaintenanceResponseHeaders(policy *config.Policy) []*envoy_config_core_v3.HeaderValueOption {
+	retryAfter := policy.MaintenanceRetryAfter
+	if retryAfter == 0 {
+		retryAfter = defaultMaintenanceRetryAfter
+	}
+	return toEnvoyHeaders(map[string]string{
+		"Content-Type":                  "text/html; charset=UTF-8",
+		"Retry-After":                   strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))),
+		httputil.HeaderPomeriumResponse: "true",
+	})
+}
@@ -0,0 +1,53 @@
+package envoyconfig
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
+)
+
+func Test_buildMaintenanceRoutes(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.Policies = []config.Policy{
+		{
+			Source:                &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:                  "/a",
+			Maintenance:           true,
+			MaintenanceMessage:    "back soon",
+			MaintenanceRetryAfter: 90 * time.Second,
+		},
+		{
+			Source:      &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:        "/b",
+			Maintenance: true,
+		},
+	}
+
+	b := &Builder{filemgr: filemgr.NewManager()}
+	routes, err := b.buildPolicyRoutes(options, config.MainListenerName, "example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+
+	getHeader := func(i int, name string) string {
+		for _, hdr := range routes[i].GetResponseHeadersToAdd() {
+			if hdr.GetHeader().GetKey() == name {
+				return hdr.GetHeader().GetValue()
+			}
+		}
+		return ""
+	}
+
+	assert.Equal(t, uint32(503), routes[0].GetDirectResponse().GetStatus())
+	assert.Contains(t, routes[0].GetDirectResponse().GetBody().GetInlineString(), "back soon")
+	assert.Equal(t, "90", getHeader(0, "Retry-After"))
+	assert.Equal(t, "text/html; charset=UTF-8", getHeader(0, "Content-Type"))
+
+	assert.Contains(t, routes[1].GetDirectResponse().GetBody().GetInlineString(), defaultMaintenanceMessage)
+	assert.Equal(t, "300", getHeader(1, "Retry-After"))
+}
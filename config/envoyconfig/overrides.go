@@ -0,0 +1,69 @@
+package envoyconfig
+
+import (
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_listener_v3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+// applyClusterOverrides merges the envoy_overrides clusters into the generated clusters with the same name and
+// adds the rest.
+func applyClusterOverrides(options *config.Options, clusters []*envoy_config_cluster_v3.Cluster) []*envoy_config_cluster_v3.Cluster {
+	if options.EnvoyOverrides == nil {
+		return clusters
+	}
+
+	byName := make(map[string]*envoy_config_cluster_v3.Cluster, len(clusters))
+	for _, cluster := range clusters {
+		byName[cluster.GetName()] = cluster
+	}
+	for _, override := range options.EnvoyOverrides.Clusters {
+		if cluster, ok := byName[override.GetName()]; ok {
+			proto.Merge(cluster, override)
+			continue
+		}
+		cluster := proto.Clone(override).(*envoy_config_cluster_v3.Cluster)
+		byName[cluster.GetName()] = cluster
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
+
+// applyListenerOverrides merges the envoy_overrides listeners into the generated listeners with the same name and
+// adds the rest.
+func applyListenerOverrides(options *config.Options, listeners []*envoy_config_listener_v3.Listener) []*envoy_config_listener_v3.Listener {
+	if options.EnvoyOverrides == nil {
+		return listeners
+	}
+
+	byName := make(map[string]*envoy_config_listener_v3.Listener, len(listeners))
+	for _, li := range listeners {
+		byName[li.GetName()] = li
+	}
+	for _, override := range options.EnvoyOverrides.Listeners {
+		if li, ok := byName[override.GetName()]; ok {
+			proto.Merge(li, override)
+			continue
+		}
+		li := proto.Clone(override).(*envoy_config_listener_v3.Listener)
+		byName[li.GetName()] = li
+		listeners = append(listeners, li)
+	}
+	return listeners
+}
+
+// getHTTPFilterOverrides returns copies of the envoy_overrides http filters.
+func getHTTPFilterOverrides(options *config.Options) []*envoy_http_connection_manager.HttpFilter {
+	if options.EnvoyOverrides == nil {
+		return nil
+	}
+
+	filters := make([]*envoy_http_connection_manager.HttpFilter, 0, len(options.EnvoyOverrides.HTTPFilters))
+	for _, f := range options.EnvoyOverrides.HTTPFilters {
+		filters = append(filters, proto.Clone(f).(*envoy_http_connection_manager.HttpFilter))
+	}
+	return filters
+}
@@ -0,0 +1,68 @@
+package envoyconfig
+
+import (
+	"testing"
+	"time"
+
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_listener_v3 "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/testutil"
+)
+
+func Test_applyClusterOverrides(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.EnvoyOverrides = &config.EnvoyOverrides{
+		Clusters: []*envoy_config_cluster_v3.Cluster{
+			{Name: "a", ConnectTimeout: durationpb.New(5 * time.Second)},
+			{Name: "c", ConnectTimeout: durationpb.New(time.Second)},
+		},
+	}
+
+	clusters := applyClusterOverrides(options, []*envoy_config_cluster_v3.Cluster{
+		{Name: "a", ConnectTimeout: durationpb.New(10 * time.Second), PerConnectionBufferLimitBytes: wrapperspb.UInt32(1024)},
+		{Name: "b"},
+	})
+	testutil.AssertProtoJSONEqual(t, `[
+		{ "name": "a", "connectTimeout": "5s", "perConnectionBufferLimitBytes": 1024 },
+		{ "name": "b" },
+		{ "name": "c", "connectTimeout": "1s" }
+	]`, clusters)
+
+	// the overrides themselves must not be modified
+	clusters[2].ConnectTimeout = durationpb.New(time.Minute)
+	assert.Equal(t, time.Second, options.EnvoyOverrides.Clusters[1].GetConnectTimeout().AsDuration())
+}
+
+func Test_applyListenerOverrides(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.EnvoyOverrides = &config.EnvoyOverrides{
+		Listeners: []*envoy_config_listener_v3.Listener{
+			{Name: "http-ingress", PerConnectionBufferLimitBytes: wrapperspb.UInt32(1024)},
+		},
+	}
+
+	listeners := applyListenerOverrides(options, []*envoy_config_listener_v3.Listener{
+		{Name: "http-ingress", StatPrefix: "ingress"},
+	})
+	testutil.AssertProtoJSONEqual(t, `[
+		{ "name": "http-ingress", "statPrefix": "ingress", "perConnectionBufferLimitBytes": 1024 }
+	]`, listeners)
+}
+
+func Test_getHTTPFilterOverrides(t *testing.T) {
+	options := config.NewDefaultOptions()
+	assert.Empty(t, getHTTPFilterOverrides(options))
+
+	options.EnvoyOverrides = &config.EnvoyOverrides{
+		HTTPFilters: []*envoy_http_connection_manager.HttpFilter{
+			{Name: "envoy.filters.http.cors"},
+		},
+	}
+	testutil.AssertProtoJSONEqual(t, `[{ "name": "envoy.filters.http.cors" }]`, getHTTPFilterOverrides(options))
+}
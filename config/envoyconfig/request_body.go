@@ -0,0 +1,97 @@
+package envoyconfig
+
+import (
+	envoy_extensions_filters_http_buffer_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/buffer/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+const bufferFilterName = "envoy.filters.http.buffer"
+
+var disableBuffer = marshalAny(&envoy_extensions_filters_http_buffer_v3.BufferPerRoute{
+	Override: &envoy_extensions_filters_http_buffer_v3.BufferPerRoute_Disabled{
+		Disabled: true,
+	},
+})
+
+// buildMaxRequestBodySizeFilter builds the lua filter which rejects requests with a content-length larger than
+// the max_request_body_size of their route. It runs before the request is authorized.
+func buildMaxRequestBodySizeFilter(options *config.Options) *envoy_http_connection_manager.HttpFilter {
+	if !config.IsProxy(options.Services) {
+		return nil
+	}
+	for _, p := range options.GetAllPolicies() {
+		if p.MaxRequestBodySize > 0 {
+			return newLuaFilter(luascripts.MaxRequestBodySize)
+		}
+	}
+	return nil
+}
+
+// buildBufferFilter builds the filter which buffers the request bodies of routes with buffer_request_body. The
+// filter is disabled for every virtual host, and enabled with the route's limit for the routes which use it.
+// Requests with a larger body are rejected with a 413.
+func buildBufferFilter(options *config.Options) *envoy_http_connection_manager.HttpFilter {
+	maxRequestBytes := getMaxBufferedRequestBodySize(options)
+	if maxRequestBytes == 0 {
+		return nil
+	}
+
+	return &envoy_http_connection_manager.HttpFilter{
+		Name: bufferFilterName,
+		ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+			TypedConfig: marshalAny(&envoy_extensions_filters_http_buffer_v3.Buffer{
+				MaxRequestBytes: wrapperspb.UInt32(maxRequestBytes),
+			}),
+		},
+	}
+}
+
+// buildBufferPerRoute builds the per-route config which buffers the request bodies of the policy's route.
+func buildBufferPerRoute(policy *config.Policy) *any.Any {
+	return marshalAny(&envoy_extensions_filters_http_buffer_v3.BufferPerRoute{
+		Override: &envoy_extensions_filters_http_buffer_v3.BufferPerRoute_Buffer{
+			Buffer: &envoy_extensions_filters_http_buffer_v3.Buffer{
+				MaxRequestBytes: wrapperspb.UInt32(policy.MaxRequestBodySize),
+			},
+		},
+	})
+}
+
+// getMaxBufferedRequestBodySize returns the largest max_request_body_size of the routes which buffer request
+// bodies, or 0 if no route does.
+func getMaxBufferedRequestBodySize(options *config.Options) uint32 {
+	if !config.IsProxy(options.Services) {
+		return 0
+	}
+	var size uint32
+	for _, p := range options.GetAllPolicies() {
+		if p.BufferRequestBody && p.MaxRequestBodySize > size {
+			size = p.MaxRequestBodySize
+		}
+	}
+	return size
+}
+
+// getAuthorizeMaxRequestBytes returns the size of the request bodies buffered for the check requests of routes
+// which authorize the request body: the largest max_request_body_size of those routes, or 1MiB for
+// routes without one. Larger requests are rejected with a 413, rather than authorized with a truncated body.
+func getAuthorizeMaxRequestBytes(options *config.Options) uint32 {
+	var size uint32
+	for _, p := range options.GetAllPolicies() {
+		if !p.AuthorizesRequestBody() {
+			continue
+		}
+		limit := p.MaxRequestBodySize
+		if limit == 0 {
+			limit = defaultAuthorizeMaxRequestBytes
+		}
+		if limit > size {
+			size = limit
+		}
+	}
+	return size
+}
@@ -0,0 +1,90 @@
+package envoyconfig
+
+import (
+	"net/url"
+	"testing"
+
+	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
+	"github.com/pomerium/pomerium/internal/testutil"
+)
+
+func Test_buildRequestBodyFilters(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.Services = "proxy"
+	options.Policies = []config.Policy{
+		{
+			Source:             &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:               "/a",
+			MaxRequestBodySize: 1024,
+			BufferRequestBody:  true,
+		},
+		{
+			Source:             &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:               "/b",
+			MaxRequestBodySize: 4096,
+		},
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:   "/c",
+		},
+	}
+
+	assert.NotNil(t, buildMaxRequestBodySizeFilter(options))
+	testutil.AssertProtoJSONEqual(t, `{
+		"name": "envoy.filters.http.buffer",
+		"typedConfig": {
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.Buffer",
+			"maxRequestBytes": 1024
+		}
+	}`, buildBufferFilter(options))
+	testutil.AssertProtoJSONEqual(t, `{ "typedPerFilterConfig": {
+		"envoy.filters.http.buffer": {
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.BufferPerRoute",
+			"disabled": true
+		}
+	} }`, &envoy_config_route_v3.VirtualHost{TypedPerFilterConfig: buildVirtualHostRouteFilterConfig(options)})
+
+	b := &Builder{filemgr: filemgr.NewManager()}
+	routes, err := b.buildPolicyRoutes(options, config.MainListenerName, "example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 3)
+	testutil.AssertProtoJSONEqual(t, `{ "typedPerFilterConfig": {
+		"envoy.filters.http.buffer": {
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.buffer.v3.BufferPerRoute",
+			"buffer": { "maxRequestBytes": 1024 }
+		}
+	} }`, &envoy_config_route_v3.Route{TypedPerFilterConfig: routes[0].TypedPerFilterConfig})
+	assert.Equal(t, float64(4096), routes[1].GetMetadata().GetFilterMetadata()["envoy.filters.http.lua"].
+		GetFields()["max_request_body_size"].GetNumberValue())
+	assert.Empty(t, routes[1].TypedPerFilterConfig)
+	assert.NotContains(t, routes[2].GetMetadata().GetFilterMetadata()["envoy.filters.http.lua"].GetFields(),
+		"max_request_body_size")
+
+	options.Policies = options.Policies[2:]
+	assert.Nil(t, buildMaxRequestBodySizeFilter(options))
+	assert.Nil(t, buildBufferFilter(options))
+	assert.Nil(t, buildVirtualHostRouteFilterConfig(options))
+}
+
+func Test_getAuthorizeMaxRequestBytes(t *testing.T) {
+	options := config.NewDefaultOptions()
+	options.Policies = []config.Policy{
+		{AWSSigV4: &config.AWSSigV4{Service: "execute-api"}, MaxRequestBodySize: 512},
+	}
+	assert.Equal(t, uint32(512), getAuthorizeMaxRequestBytes(options))
+
+	options.Policies = append(options.Policies, config.Policy{AWSSigV4: &config.AWSSigV4{Service: "execute-api"}})
+	assert.Equal(t, defaultAuthorizeMaxRequestBytes, getAuthorizeMaxRequestBytes(options))
+
+	options.Policies = append(options.Policies, config.Policy{AWSSigV4: &config.AWSSigV4{Service: "s3"}, MaxRequestBodySize: 8 * 1024 * 1024})
+	assert.Equal(t, defaultAuthorizeMaxRequestBytes, getAuthorizeMaxRequestBytes(options),
+		"routes which don't sign the payload should be ignored")
+
+	options.Policies = append(options.Policies, config.Policy{AuthorizeRequestBody: true, MaxRequestBodySize: 4 * 1024 * 1024})
+	assert.Equal(t, uint32(4*1024*1024), getAuthorizeMaxRequestBytes(options))
+}
@@ -0,0 +1,226 @@
+package envoyconfig
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/cespare/xxhash/v2"
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_extensions_filters_http_ext_proc_v3alpha "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3alpha"
+	envoy_extensions_filters_http_lua_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/lua/v3"
+	envoy_http_connection_manager "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/hashutil"
+)
+
+// Route filters run the lua_script and ext_proc of policies. Since Envoy only configures filters per listener,
+// the filters are added to the main listener and enabled for the routes which use them with per-route
+// configuration. Filters are given their own names, so that the per-route configuration doesn't apply to
+// Pomerium's other filters.
+const (
+	routeLuaFilterName           = "pomerium.filters.http.route_lua"
+	routeExtProcFilterNamePrefix = "pomerium.filters.http.ext_proc."
+	extProcClusterNamePrefix     = "pomerium-ext-proc-"
+
+	// routeLuaDefaultCode runs for routes without a lua_script
+	routeLuaDefaultCode = "function envoy_on_request(request_handle)\nend\n"
+)
+
+var disableExtProc = marshalAny(&envoy_extensions_filters_http_ext_proc_v3alpha.ExtProcPerRoute{
+	Override: &envoy_extensions_filters_http_ext_proc_v3alpha.ExtProcPerRoute_Disabled{
+		Disabled: true,
+	},
+})
+
+func getRouteLuaSourceCodeName(script string) string {
+	return fmt.Sprintf("lua-%x", xxhash.Sum64String(script))
+}
+
+func getExtProcFilterName(extProc *config.ExtProc) string {
+	return fmt.Sprintf("%s%x", routeExtProcFilterNamePrefix, hashutil.MustHash(extProc))
+}
+
+func getExtProcClusterName(extProc *config.ExtProc) string {
+	return fmt.Sprintf("%s%x", extProcClusterNamePrefix, xxhash.Sum64String(extProc.URL))
+}
+
+// getExtProcs returns the distinct ext_procs of the policies, keyed by filter name.
+func getExtProcs(options *config.Options) map[string]*config.ExtProc {
+	extProcs := make(map[string]*config.ExtProc)
+	for _, p := range options.GetAllPolicies() {
+		if p.ExtProc != nil {
+			extProcs[getExtProcFilterName(p.ExtProc)] = p.ExtProc
+		}
+	}
+	return extProcs
+}
+
+// buildRouteFilters builds the http filters which run the lua scripts and ext_procs of policies.
+func buildRouteFilters(options *config.Options) []*envoy_http_connection_manager.HttpFilter {
+	if !config.IsProxy(options.Services) {
+		return nil
+	}
+
+	var filters []*envoy_http_connection_manager.HttpFilter
+
+	sourceCodes := make(map[string]*envoy_config_core_v3.DataSource)
+	for _, p := range options.GetAllPolicies() {
+		if p.LuaScript != "" {
+			sourceCodes[getRouteLuaSourceCodeName(p.LuaScript)] = &envoy_config_core_v3.DataSource{
+				Specifier: &envoy_config_core_v3.DataSource_InlineString{InlineString: p.LuaScript},
+			}
+		}
+	}
+	if len(sourceCodes) > 0 {
+		filters = append(filters, &envoy_http_connection_manager.HttpFilter{
+			Name: routeLuaFilterName,
+			ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+				TypedConfig: marshalAny(&envoy_extensions_filters_http_lua_v3.Lua{
+					InlineCode:  routeLuaDefaultCode,
+					SourceCodes: sourceCodes,
+				}),
+			},
+		})
+	}
+
+	extProcs := getExtProcs(options)
+	names := make([]string, 0, len(extProcs))
+	for name := range extProcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		filters = append(filters, &envoy_http_connection_manager.HttpFilter{
+			Name: name,
+			ConfigType: &envoy_http_connection_manager.HttpFilter_TypedConfig{
+				TypedConfig: marshalAny(buildExtProc(extProcs[name])),
+			},
+		})
+	}
+
+	return filters
+}
+
+func buildExtProc(extProc *config.ExtProc) *envoy_extensions_filters_http_ext_proc_v3alpha.ExternalProcessor {
+	cfg := &envoy_extensions_filters_http_ext_proc_v3alpha.ExternalProcessor{
+		GrpcService: &envoy_config_core_v3.GrpcService{
+			TargetSpecifier: &envoy_config_core_v3.GrpcService_EnvoyGrpc_{
+				EnvoyGrpc: &envoy_config_core_v3.GrpcService_EnvoyGrpc{
+					ClusterName: getExtProcClusterName(extProc),
+				},
+			},
+		},
+		FailureModeAllow: extProc.FailureModeAllow,
+		ProcessingMode: &envoy_extensions_filters_http_ext_proc_v3alpha.ProcessingMode{
+			RequestBodyMode:  getExtProcBodyMode(extProc.RequestBodyMode),
+			ResponseBodyMode: getExtProcBodyMode(extProc.ResponseBodyMode),
+		},
+	}
+	if extProc.Timeout > 0 {
+		cfg.MessageTimeout = durationpb.New(extProc.Timeout)
+	}
+	return cfg
+}
+
+func getExtProcBodyMode(mode string) envoy_extensions_filters_http_ext_proc_v3alpha.ProcessingMode_BodySendMode {
+	switch mode {
+	case "streamed":
+		return envoy_extensions_filters_http_ext_proc_v3alpha.ProcessingMode_STREAMED
+	case "buffered":
+		return envoy_extensions_filters_http_ext_proc_v3alpha.ProcessingMode_BUFFERED
+	case "buffered_partial":
+		return envoy_extensions_filters_http_ext_proc_v3alpha.ProcessingMode_BUFFERED_PARTIAL
+	default:
+		return envoy_extensions_filters_http_ext_proc_v3alpha.ProcessingMode_NONE
+	}
+}
+
+// buildVirtualHostRouteFilterConfig returns the per-filter config which disables the ext_procs, the request
+// body buffering and the ext_authz request body for the routes of a virtual host. Routes which use them
+// override it.
+func buildVirtualHostRouteFilterConfig(options *config.Options) map[string]*any.Any {
+	if !config.IsProxy(options.Services) {
+		return nil
+	}
+
+	extProcs := getExtProcs(options)
+	buffered := getMaxBufferedRequestBodySize(options) > 0
+	authorizeBody := hasAuthorizeRequestBodyPolicy(options)
+	if len(extProcs) == 0 && !buffered && !authorizeBody {
+		return nil
+	}
+
+	cfg := make(map[string]*any.Any, len(extProcs)+2)
+	for name := range extProcs {
+		cfg[name] = disableExtProc
+	}
+	if buffered {
+		cfg[bufferFilterName] = disableBuffer
+	}
+	if authorizeBody {
+		cfg["envoy.filters.http.ext_authz"] = disableExtAuthzRequestBody
+	}
+	return cfg
+}
+
+// addPolicyRouteFilterConfig enables the lua script and ext_proc of the policy for its route.
+func addPolicyRouteFilterConfig(policy *config.Policy, cfg map[string]*any.Any) map[string]*any.Any {
+	if policy.LuaScript == "" && policy.ExtProc == nil {
+		return cfg
+	}
+	if cfg == nil {
+		cfg = make(map[string]*any.Any)
+	}
+	if policy.LuaScript != "" {
+		cfg[routeLuaFilterName] = marshalAny(&envoy_extensions_filters_http_lua_v3.LuaPerRoute{
+			Override: &envoy_extensions_filters_http_lua_v3.LuaPerRoute_Name{
+				Name: getRouteLuaSourceCodeName(policy.LuaScript),
+			},
+		})
+	}
+	if policy.ExtProc != nil {
+		cfg[getExtProcFilterName(policy.ExtProc)] = marshalAny(&envoy_extensions_filters_http_ext_proc_v3alpha.ExtProcPerRoute{
+			Override: &envoy_extensions_filters_http_ext_proc_v3alpha.ExtProcPerRoute_Overrides{
+				Overrides: &envoy_extensions_filters_http_ext_proc_v3alpha.ExtProcOverrides{},
+			},
+		})
+	}
+	return cfg
+}
+
+// buildExtProcClusters builds a cluster for each ext_proc service.
+func (b *Builder) buildExtProcClusters(ctx context.Context, options *config.Options) ([]*envoy_config_cluster_v3.Cluster, error) {
+	var clusters []*envoy_config_cluster_v3.Cluster
+	seen := make(map[string]bool)
+	for _, extProc := range getExtProcs(options) {
+		name := getExtProcClusterName(extProc)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		u, err := extProc.GetURL()
+		if err != nil {
+			return nil, fmt.Errorf("invalid ext_proc url: %w", err)
+		}
+		// an empty policy verifies the service's certificate with the default certificate authorities
+		ts, err := b.buildPolicyTransportSocket(ctx, options, &config.Policy{}, *u)
+		if err != nil {
+			return nil, err
+		}
+
+		cluster := newDefaultEnvoyClusterConfig()
+		cluster.DnsLookupFamily = config.GetEnvoyDNSLookupFamily(options.DNSLookupFamily)
+		if err := b.buildCluster(cluster, name, []Endpoint{NewEndpoint(u, ts, 1)}, true); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].GetName() < clusters[j].GetName() })
+	return clusters, nil
+}
@@ -0,0 +1,113 @@
+package envoyconfig
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
+	"github.com/pomerium/pomerium/internal/testutil"
+)
+
+func Test_buildRouteFilters(t *testing.T) {
+	extProc := &config.ExtProc{
+		URL:              "http://ext-proc.example.com:9000",
+		Timeout:          time.Second,
+		FailureModeAllow: true,
+		RequestBodyMode:  "buffered",
+	}
+	options := config.NewDefaultOptions()
+	options.Services = "proxy"
+	options.Policies = []config.Policy{
+		{
+			Source:    &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:      "/a",
+			LuaScript: "function envoy_on_request(request_handle) end",
+		},
+		{
+			Source:  &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:    "/b",
+			ExtProc: extProc,
+		},
+		{
+			Source: &config.StringURL{URL: &url.URL{Scheme: "https", Host: "example.com"}},
+			Path:   "/c",
+		},
+	}
+	luaName := getRouteLuaSourceCodeName(options.Policies[0].LuaScript)
+	extProcName := getExtProcFilterName(extProc)
+	clusterName := getExtProcClusterName(extProc)
+
+	t.Run("filters", func(t *testing.T) {
+		testutil.AssertProtoJSONEqual(t, `[
+			{
+				"name": "pomerium.filters.http.route_lua",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.extensions.filters.http.lua.v3.Lua",
+					"inlineCode": "function envoy_on_request(request_handle)\nend\n",
+					"sourceCodes": {
+						"`+luaName+`": { "inlineString": "function envoy_on_request(request_handle) end" }
+					}
+				}
+			},
+			{
+				"name": "`+extProcName+`",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_proc.v3alpha.ExternalProcessor",
+					"failureModeAllow": true,
+					"grpcService": { "envoyGrpc": { "clusterName": "`+clusterName+`" } },
+					"messageTimeout": "1s",
+					"processingMode": { "requestBodyMode": "BUFFERED" }
+				}
+			}
+		]`, buildRouteFilters(options))
+	})
+	t.Run("virtual host", func(t *testing.T) {
+		testutil.AssertProtoJSONEqual(t, `{ "typedPerFilterConfig": {
+			"`+extProcName+`": {
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_proc.v3alpha.ExtProcPerRoute",
+				"disabled": true
+			}
+		} }`, &envoy_config_route_v3.VirtualHost{TypedPerFilterConfig: buildVirtualHostRouteFilterConfig(options)})
+	})
+	t.Run("routes", func(t *testing.T) {
+		b := &Builder{filemgr: filemgr.NewManager()}
+		routes, err := b.buildPolicyRoutes(options, config.MainListenerName, "example.com")
+		require.NoError(t, err)
+		require.Len(t, routes, 3)
+		testutil.AssertProtoJSONEqual(t, `{ "typedPerFilterConfig": {
+			"pomerium.filters.http.route_lua": {
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.lua.v3.LuaPerRoute",
+				"name": "`+luaName+`"
+			}
+		} }`, &envoy_config_route_v3.Route{TypedPerFilterConfig: routes[0].TypedPerFilterConfig})
+		testutil.AssertProtoJSONEqual(t, `{ "typedPerFilterConfig": {
+			"`+extProcName+`": {
+				"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_proc.v3alpha.ExtProcPerRoute",
+				"overrides": {}
+			}
+		} }`, &envoy_config_route_v3.Route{TypedPerFilterConfig: routes[1].TypedPerFilterConfig})
+		assert.Empty(t, routes[2].TypedPerFilterConfig)
+	})
+	t.Run("clusters", func(t *testing.T) {
+		b := &Builder{filemgr: filemgr.NewManager()}
+		clusters, err := b.buildExtProcClusters(context.Background(), options)
+		require.NoError(t, err)
+		if assert.Len(t, clusters, 1) {
+			assert.Equal(t, clusterName, clusters[0].GetName())
+			assert.Nil(t, clusters[0].GetTransportSocket())
+		}
+	})
+	t.Run("not proxy", func(t *testing.T) {
+		options := *options
+		options.Services = "authenticate"
+		assert.Empty(t, buildRouteFilters(&options))
+		assert.Empty(t, buildVirtualHostRouteFilterConfig(&options))
+	})
+}
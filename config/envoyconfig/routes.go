@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"sort"
+	"time"
 
 	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_config_route_v3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
@@ -63,6 +64,11 @@ func (b *Builder) buildPomeriumHTTPRoutes(options *config.Options, domain string
 			return nil, err
 		}
 		routes = append(routes, r)
+		r, err = b.buildControlPlanePathRoute("/.pomerium/userinfo", true)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
 
 		// disable ext_authz and passthrough to proxy handlers
 		r, err = b.buildControlPlanePathRoute("/ping", false)
@@ -75,6 +81,11 @@ func (b *Builder) buildPomeriumHTTPRoutes(options *config.Options, domain string
 			return nil, err
 		}
 		routes = append(routes, r)
+		r, err = b.buildControlPlanePathRoute("/readyz", false)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
 		r, err = b.buildControlPlanePathRoute("/.pomerium", false)
 		if err != nil {
 			return nil, err
@@ -259,31 +270,45 @@ func getClusterStatsName(policy *config.Policy) string {
 	return ""
 }
 
-func (b *Builder) buildPolicyRoutes(options *config.Options, domain string) ([]*envoy_config_route_v3.Route, error) {
+func (b *Builder) buildPolicyRoutes(
+	options *config.Options,
+	listener string,
+	domain string,
+) ([]*envoy_config_route_v3.Route, error) {
 	var routes []*envoy_config_route_v3.Route
 
 	for i, p := range options.GetAllPolicies() {
 		policy := p
-		if !hostMatchesDomain(policy.Source.URL, domain) {
+		if !hostMatchesDomain(policy.Source.URL, domain) || !policy.IsServedByListener(listener) {
 			continue
 		}
 
 		match := mkRouteMatch(&policy)
 		envoyRoute := &envoy_config_route_v3.Route{
-			Name:                   fmt.Sprintf("policy-%d", i),
-			Match:                  match,
-			Metadata:               &envoy_config_core_v3.Metadata{},
-			RequestHeadersToAdd:    toEnvoyHeaders(policy.SetRequestHeaders),
-			RequestHeadersToRemove: getRequestHeadersToRemove(options, &policy),
-			ResponseHeadersToAdd:   toEnvoyHeaders(policy.SetResponseHeaders),
-		}
-		if policy.Redirect != nil {
+			Name:                    fmt.Sprintf("policy-%d", i),
+			Match:                   match,
+			Metadata:                &envoy_config_core_v3.Metadata{},
+			RequestHeadersToAdd:     toEnvoyHeaders(policy.SetRequestHeaders),
+			RequestHeadersToRemove:  getRequestHeadersToRemove(options, &policy),
+			ResponseHeadersToAdd:    toEnvoyHeaders(getResponseHeadersToSet(&policy)),
+			ResponseHeadersToRemove: getResponseHeadersToRemove(&policy),
+		}
+		switch {
+		case policy.Maintenance:
+			action, err := buildMaintenanceDirectResponseAction(&policy)
+			if err != nil {
+				return nil, err
+			}
+			envoyRoute.Action = &envoy_config_route_v3.Route_DirectResponse{DirectResponse: action}
+			envoyRoute.ResponseHeadersToAdd = append(envoyRoute.ResponseHeadersToAdd,
+				getMaintenanceResponseHeaders(&policy)...)
+		case policy.Redirect != nil:
 			action, err := b.buildPolicyRouteRedirectAction(policy.Redirect)
 			if err != nil {
 				return nil, err
 			}
 			envoyRoute.Action = &envoy_config_route_v3.Route_Redirect{Redirect: action}
-		} else {
+		default:
 			action, err := b.buildPolicyRouteRouteAction(options, &policy)
 			if err != nil {
 				return nil, err
@@ -294,6 +319,18 @@ func (b *Builder) buildPolicyRoutes(options *config.Options, domain string) ([]*
 		luaMetadata := map[string]*structpb.Value{
 			"rewrite_response_headers": getRewriteHeadersMetadata(policy.RewriteResponseHeaders),
 		}
+		if policy.Cache != nil {
+			luaMetadata["cache"] = structpb.NewStringValue(getCacheID(&policy))
+			if policy.Cache.TTL > 0 {
+				luaMetadata["cache_ttl"] = structpb.NewNumberValue(float64(policy.Cache.TTL / time.Second))
+			}
+		}
+		if policy.Compression != nil {
+			luaMetadata["compression"] = structpb.NewStringValue(getCompressionID(policy.Compression))
+		}
+		if policy.MaxRequestBodySize > 0 {
+			luaMetadata["max_request_body_size"] = structpb.NewNumberValue(float64(policy.MaxRequestBodySize))
+		}
 
 		// disable authentication entirely when the proxy is fronting authenticate
 		isFrontingAuthenticate, err := isProxyFrontingAuthenticate(options, domain)
@@ -305,9 +342,16 @@ func (b *Builder) buildPolicyRoutes(options *config.Options, domain string) ([]*
 				"envoy.filters.http.ext_authz": disableExtAuthz,
 			}
 		} else {
+			// only routes which authorize the request body need it buffered for the check request, the virtual
+			// host disables it for every other route
+			if policy.AuthorizesRequestBody() {
+				envoyRoute.TypedPerFilterConfig = map[string]*any.Any{
+					"envoy.filters.http.ext_authz": enableExtAuthzRequestBody,
+				}
+			}
 			luaMetadata["remove_pomerium_cookie"] = &structpb.Value{
 				Kind: &structpb.Value_StringValue{
-					StringValue: options.CookieName,
+					StringValue: options.GetCookieOptions(&policy).Name,
 				},
 			}
 			luaMetadata["remove_pomerium_authorization"] = &structpb.Value{
@@ -320,6 +364,16 @@ func (b *Builder) buildPolicyRoutes(options *config.Options, domain string) ([]*
 					BoolValue: policy.IsForKubernetes(),
 				},
 			}
+			luaMetadata["allow_upstream_session_revocation"] = &structpb.Value{
+				Kind: &structpb.Value_BoolValue{
+					BoolValue: policy.AllowUpstreamSessionRevocation,
+				},
+			}
+			luaMetadata["authorize_fail_open"] = &structpb.Value{
+				Kind: &structpb.Value_BoolValue{
+					BoolValue: policy.AuthorizeFailOpen,
+				},
+			}
 		}
 
 		if policy.IsForKubernetes() {
@@ -339,6 +393,19 @@ func (b *Builder) buildPolicyRoutes(options *config.Options, domain string) ([]*
 		envoyRoute.Metadata.FilterMetadata = map[string]*structpb.Struct{
 			"envoy.filters.http.lua": {Fields: luaMetadata},
 		}
+		envoyRoute.TypedPerFilterConfig = addPolicyRouteFilterConfig(&policy, envoyRoute.TypedPerFilterConfig)
+		if policy.LocalRateLimit != nil {
+			if envoyRoute.TypedPerFilterConfig == nil {
+				envoyRoute.TypedPerFilterConfig = make(map[string]*any.Any)
+			}
+			envoyRoute.TypedPerFilterConfig[localRateLimitFilterName] = buildLocalRateLimitPerRoute(&policy)
+		}
+		if policy.BufferRequestBody {
+			if envoyRoute.TypedPerFilterConfig == nil {
+				envoyRoute.TypedPerFilterConfig = make(map[string]*any.Any)
+			}
+			envoyRoute.TypedPerFilterConfig[bufferFilterName] = buildBufferPerRoute(&policy)
+		}
 
 		routes = append(routes, envoyRoute)
 	}
@@ -416,10 +483,14 @@ func (b *Builder) buildPolicyRouteRouteAction(options *config.Options, policy *c
 		HostRewriteSpecifier: &envoy_config_route_v3.RouteAction_AutoHostRewrite{
 			AutoHostRewrite: &wrappers.BoolValue{Value: !policy.PreserveHostHeader},
 		},
-		Timeout:       routeTimeout,
-		IdleTimeout:   idleTimeout,
-		PrefixRewrite: prefixRewrite,
-		RegexRewrite:  regexRewrite,
+		Timeout:           routeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxStreamDuration: getRouteMaxStreamDuration(policy),
+		PrefixRewrite:     prefixRewrite,
+		RegexRewrite:      regexRewrite,
+	}
+	if policy.CORS != nil {
+		action.Cors = buildCORSPolicy(policy.CORS)
 	}
 	setHostRewriteOptions(policy, action)
 	return action, nil
@@ -481,9 +552,19 @@ func getRequestHeadersToRemove(options *config.Options, policy *config.Policy) [
 		requestHeadersToRemove = append(requestHeadersToRemove,
 			httputil.HeaderPomeriumJWTAssertion,
 			httputil.HeaderPomeriumJWTAssertionFor)
+		// headers disabled on the route are removed too, so that clients cannot set them
 		for headerName := range options.JWTClaimsHeaders {
 			requestHeadersToRemove = append(requestHeadersToRemove, headerName)
 		}
+		for headerName := range policy.JWTClaimsHeaders {
+			if _, ok := options.JWTClaimsHeaders[headerName]; !ok {
+				requestHeadersToRemove = append(requestHeadersToRemove, headerName)
+			}
+		}
+	}
+	// API keys are only for pomerium, so they aren't passed to the upstream
+	if policy.APIKey != nil {
+		requestHeadersToRemove = append(requestHeadersToRemove, policy.APIKey.GetHeader())
 	}
 	// remove these headers to prevent a user from re-proxying requests through the control plane
 	requestHeadersToRemove = append(requestHeadersToRemove,
@@ -493,6 +574,29 @@ func getRequestHeadersToRemove(options *config.Options, policy *config.Policy) [
 	return requestHeadersToRemove
 }
 
+// getResponseHeadersToSet returns the response headers set by the policy. Its set_response_headers take
+// precedence over its security headers.
+func getResponseHeadersToSet(policy *config.Policy) map[string]string {
+	if policy.SecurityHeaders == nil {
+		return policy.SetResponseHeaders
+	}
+
+	headers, _ := policy.SecurityHeaders.GetHeaders()
+	for k, v := range policy.SetResponseHeaders {
+		headers[k] = v
+	}
+	return headers
+}
+
+func getResponseHeadersToRemove(policy *config.Policy) []string {
+	if policy.SecurityHeaders == nil {
+		return nil
+	}
+
+	_, remove := policy.SecurityHeaders.GetHeaders()
+	return remove
+}
+
 func getRouteTimeout(options *config.Options, policy *config.Policy) *durationpb.Duration {
 	var routeTimeout *durationpb.Duration
 	if policy.UpstreamTimeout != nil {
@@ -516,6 +620,17 @@ func getRouteIdleTimeout(policy *config.Policy) *durationpb.Duration {
 	return idleTimeout
 }
 
+// getRouteMaxStreamDuration returns the max stream duration of the route, which overrides the max stream
+// duration of the listener (the global write timeout).
+func getRouteMaxStreamDuration(policy *config.Policy) *envoy_config_route_v3.RouteAction_MaxStreamDuration {
+	if policy.MaxStreamDuration == nil {
+		return nil
+	}
+	return &envoy_config_route_v3.RouteAction_MaxStreamDuration{
+		MaxStreamDuration: durationpb.New(*policy.MaxStreamDuration),
+	}
+}
+
 func shouldDisableStreamIdleTimeout(policy *config.Policy) bool {
 	return policy.AllowWebsockets ||
 		urlutil.IsTCP(policy.Source.URL) ||
@@ -535,7 +650,7 @@ func getRewriteOptions(policy *config.Policy) (prefixRewrite string, regexRewrit
 			},
 			Substitution: policy.RegexRewriteSubstitution,
 		}
-	} else if len(policy.To) > 0 && policy.To[0].URL.Path != "" {
+	} else if len(policy.To) > 0 && policy.To[0].URL.Path != "" && !urlutil.IsUnix(&policy.To[0].URL) {
 		prefixRewrite = policy.To[0].URL.Path
 	}
 
@@ -89,8 +89,10 @@ func Test_buildPomeriumHTTPRoutes(t *testing.T) {
 
 		testutil.AssertProtoJSONEqual(t, `[
 			`+routeString("path", "/.pomerium/jwt", true)+`,
+			`+routeString("path", "/.pomerium/userinfo", true)+`,
 			`+routeString("path", "/ping", false)+`,
 			`+routeString("path", "/healthz", false)+`,
+			`+routeString("path", "/readyz", false)+`,
 			`+routeString("path", "/.pomerium", false)+`,
 			`+routeString("prefix", "/.pomerium/", false)+`,
 			`+routeString("path", "/.well-known/pomerium", false)+`,
@@ -127,8 +129,10 @@ func Test_buildPomeriumHTTPRoutes(t *testing.T) {
 
 		testutil.AssertProtoJSONEqual(t, `[
 			`+routeString("path", "/.pomerium/jwt", true)+`,
+			`+routeString("path", "/.pomerium/userinfo", true)+`,
 			`+routeString("path", "/ping", false)+`,
 			`+routeString("path", "/healthz", false)+`,
+			`+routeString("path", "/readyz", false)+`,
 			`+routeString("path", "/.pomerium", false)+`,
 			`+routeString("prefix", "/.pomerium/", false)+`,
 			`+routeString("path", "/.well-known/pomerium", false)+`,
@@ -155,8 +159,10 @@ func Test_buildPomeriumHTTPRoutes(t *testing.T) {
 
 		testutil.AssertProtoJSONEqual(t, `[
 			`+routeString("path", "/.pomerium/jwt", true)+`,
+			`+routeString("path", "/.pomerium/userinfo", true)+`,
 			`+routeString("path", "/ping", false)+`,
 			`+routeString("path", "/healthz", false)+`,
+			`+routeString("path", "/readyz", false)+`,
 			`+routeString("path", "/.pomerium", false)+`,
 			`+routeString("prefix", "/.pomerium/", false)+`,
 			`+routeString("path", "/.well-known/pomerium", false)+`,
@@ -227,18 +233,20 @@ func TestTimeouts(t *testing.T) {
 	}
 
 	testCases := []struct {
-		upstream, idle  string
-		allowWebsockets bool
-		expect          string
+		upstream, idle, maxStream string
+		allowWebsockets           bool
+		expect                    string
 	}{
-		{"", "", false, `"timeout": "3s"`},
-		{"", "", true, `"timeout": "0s", "idleTimeout": "0s"`},
-		{"5s", "", true, `"timeout": "5s", "idleTimeout": "0s"`},
-		{"", "0s", false, `"timeout": "3s","idleTimeout": "0s"`},
-		{"", "5s", false, `"timeout": "3s","idleTimeout": "5s"`},
-		{"5s", "", false, `"timeout": "5s"`},
-		{"5s", "4s", false, `"timeout": "5s","idleTimeout": "4s"`},
-		{"0s", "4s", false, `"timeout": "0s","idleTimeout": "4s"`},
+		{"", "", "", false, `"timeout": "3s"`},
+		{"", "", "", true, `"timeout": "0s", "idleTimeout": "0s"`},
+		{"5s", "", "", true, `"timeout": "5s", "idleTimeout": "0s"`},
+		{"", "0s", "", false, `"timeout": "3s","idleTimeout": "0s"`},
+		{"", "5s", "", false, `"timeout": "3s","idleTimeout": "5s"`},
+		{"5s", "", "", false, `"timeout": "5s"`},
+		{"5s", "4s", "", false, `"timeout": "5s","idleTimeout": "4s"`},
+		{"0s", "4s", "", false, `"timeout": "0s","idleTimeout": "4s"`},
+		{"", "", "1h", false, `"timeout": "3s","maxStreamDuration": {"maxStreamDuration": "3600s"}`},
+		{"", "", "0s", false, `"timeout": "3s","maxStreamDuration": {"maxStreamDuration": "0s"}`},
 	}
 
 	for _, tc := range testCases {
@@ -248,13 +256,14 @@ func TestTimeouts(t *testing.T) {
 			DefaultUpstreamTimeout: time.Second * 3,
 			Policies: []config.Policy{
 				{
-					Source:          &config.StringURL{URL: mustParseURL(t, "https://example.com")},
-					Path:            "/test",
-					UpstreamTimeout: getDuration(tc.upstream),
-					IdleTimeout:     getDuration(tc.idle),
-					AllowWebsockets: tc.allowWebsockets,
+					Source:            &config.StringURL{URL: mustParseURL(t, "https://example.com")},
+					Path:              "/test",
+					UpstreamTimeout:   getDuration(tc.upstream),
+					IdleTimeout:       getDuration(tc.idle),
+					MaxStreamDuration: getDuration(tc.maxStream),
+					AllowWebsockets:   tc.allowWebsockets,
 				}},
-		}, "example.com")
+		}, config.MainListenerName, "example.com")
 		if !assert.NoError(t, err, "%v", tc) || !assert.Len(t, routes, 1, tc) || !assert.NotNil(t, routes[0].GetRoute(), "%v", tc) {
 			continue
 		}
@@ -344,7 +353,7 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				UpstreamTimeout:     &ten,
 			},
 		},
-	}, "example.com")
+	}, config.MainListenerName, "example.com")
 	require.NoError(t, err)
 
 	testutil.AssertProtoJSONEqual(t, `
@@ -357,6 +366,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -386,6 +397,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -416,6 +429,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -455,6 +470,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -484,6 +501,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -514,6 +533,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -543,6 +564,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -573,6 +596,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -610,7 +635,7 @@ func Test_buildPolicyRoutes(t *testing.T) {
 					PassIdentityHeaders: true,
 				},
 			},
-		}, "authenticate.example.com")
+		}, config.MainListenerName, "authenticate.example.com")
 		require.NoError(t, err)
 
 		testutil.AssertProtoJSONEqual(t, `
@@ -666,7 +691,7 @@ func Test_buildPolicyRoutes(t *testing.T) {
 					UpstreamTimeout:     &ten,
 				},
 			},
-		}, "example.com:22")
+		}, config.MainListenerName, "example.com:22")
 		require.NoError(t, err)
 
 		testutil.AssertProtoJSONEqual(t, `
@@ -679,6 +704,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -710,6 +737,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -743,15 +772,15 @@ func Test_buildPolicyRoutes(t *testing.T) {
 			Services:               "proxy",
 			CookieName:             "pomerium",
 			DefaultUpstreamTimeout: time.Second * 3,
-			JWTClaimsHeaders: map[string]string{
-				"x-email": "email",
+			JWTClaimsHeaders: config.JWTClaimHeaders{
+				"x-email": {Claim: "email"},
 			},
 			Policies: []config.Policy{
 				{
 					Source: &config.StringURL{URL: mustParseURL(t, "https://from.example.com")},
 				},
 			},
-		}, "from.example.com")
+		}, config.MainListenerName, "from.example.com")
 		require.NoError(t, err)
 
 		testutil.AssertProtoJSONEqual(t, `
@@ -764,6 +793,8 @@ func Test_buildPolicyRoutes(t *testing.T) {
 					"metadata": {
 						"filterMetadata": {
 							"envoy.filters.http.lua": {
+								"allow_upstream_session_revocation": false,
+								"authorize_fail_open": false,
 								"remove_impersonate_headers": false,
 								"remove_pomerium_authorization": true,
 								"remove_pomerium_cookie": "pomerium",
@@ -841,7 +872,7 @@ func Test_buildPolicyRoutesRewrite(t *testing.T) {
 				HostPathRegexRewriteSubstitution: "\\1",
 			},
 		},
-	}, "example.com")
+	}, config.MainListenerName, "example.com")
 	require.NoError(t, err)
 
 	testutil.AssertProtoJSONEqual(t, `
@@ -854,6 +885,8 @@ func Test_buildPolicyRoutesRewrite(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -884,6 +917,8 @@ func Test_buildPolicyRoutesRewrite(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -914,6 +949,8 @@ func Test_buildPolicyRoutesRewrite(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -950,6 +987,8 @@ func Test_buildPolicyRoutesRewrite(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -980,6 +1019,8 @@ func Test_buildPolicyRoutesRewrite(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -1010,6 +1051,8 @@ func Test_buildPolicyRoutesRewrite(t *testing.T) {
 				"metadata": {
 					"filterMetadata": {
 						"envoy.filters.http.lua": {
+							"allow_upstream_session_revocation": false,
+							"authorize_fail_open": false,
 							"remove_impersonate_headers": false,
 							"remove_pomerium_authorization": true,
 							"remove_pomerium_cookie": "pomerium",
@@ -1042,6 +1085,35 @@ func Test_buildPolicyRoutesRewrite(t *testing.T) {
 	`, routes)
 }
 
+func Test_buildPolicyRoutesSecurityHeaders(t *testing.T) {
+	csp := "default-src 'self'"
+	empty := ""
+	options := config.NewDefaultOptions()
+	options.Policies = []config.Policy{{
+		Source: &config.StringURL{URL: mustParseURL(t, "https://example.com")},
+		SecurityHeaders: &config.SecurityHeaders{
+			ContentSecurityPolicy: &csp,
+			XFrameOptions:         &empty,
+		},
+		SetResponseHeaders: map[string]string{"Referrer-Policy": "no-referrer"},
+	}}
+
+	b := &Builder{filemgr: filemgr.NewManager()}
+	routes, err := b.buildPolicyRoutes(options, config.MainListenerName, "example.com")
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	testutil.AssertProtoJSONEqual(t, `{
+		"responseHeadersToAdd": [
+			{ "append": false, "header": { "key": "Content-Security-Policy", "value": "default-src 'self'" } },
+			{ "append": false, "header": { "key": "Referrer-Policy", "value": "no-referrer" } }
+		],
+		"responseHeadersToRemove": ["X-Frame-Options"]
+	}`, &envoy_config_route_v3.Route{
+		ResponseHeadersToAdd:    routes[0].ResponseHeadersToAdd,
+		ResponseHeadersToRemove: routes[0].ResponseHeadersToRemove,
+	})
+}
+
 func Test_buildPolicyRouteRedirectAction(t *testing.T) {
 	b := &Builder{filemgr: filemgr.NewManager()}
 	t.Run("HTTPSRedirect", func(t *testing.T) {
@@ -0,0 +1,88 @@
+package envoyconfig
+
+import (
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_config_endpoint_v3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	spireAgentClusterName = "pomerium-spire-agent"
+	// these are the default secret names served by the SPIRE agent's SDS API
+	spireSVIDSecretName   = "default"
+	spireBundleSecretName = "ROOTCA"
+)
+
+// buildSPIREAgentCluster builds a static cluster for the SPIRE agent's SDS API listening on the given unix socket.
+func buildSPIREAgentCluster(socketPath string) *envoy_config_cluster_v3.Cluster {
+	return &envoy_config_cluster_v3.Cluster{
+		Name: spireAgentClusterName,
+		ConnectTimeout: &durationpb.Duration{
+			Seconds: 5,
+		},
+		ClusterDiscoveryType: &envoy_config_cluster_v3.Cluster_Type{
+			Type: envoy_config_cluster_v3.Cluster_STATIC,
+		},
+		LoadAssignment: &envoy_config_endpoint_v3.ClusterLoadAssignment{
+			ClusterName: spireAgentClusterName,
+			Endpoints: []*envoy_config_endpoint_v3.LocalityLbEndpoints{{
+				LbEndpoints: []*envoy_config_endpoint_v3.LbEndpoint{{
+					HostIdentifier: &envoy_config_endpoint_v3.LbEndpoint_Endpoint{
+						Endpoint: &envoy_config_endpoint_v3.Endpoint{
+							Address: &envoy_config_core_v3.Address{
+								Address: &envoy_config_core_v3.Address_Pipe{
+									Pipe: &envoy_config_core_v3.Pipe{Path: socketPath},
+								},
+							},
+						},
+					},
+				}},
+			}},
+		},
+		Http2ProtocolOptions: &envoy_config_core_v3.Http2ProtocolOptions{},
+	}
+}
+
+func buildSPIRESdsSecretConfig(name string) *envoy_extensions_transport_sockets_tls_v3.SdsSecretConfig {
+	return &envoy_extensions_transport_sockets_tls_v3.SdsSecretConfig{
+		Name: name,
+		SdsConfig: &envoy_config_core_v3.ConfigSource{
+			ResourceApiVersion: envoy_config_core_v3.ApiVersion_V3,
+			ConfigSourceSpecifier: &envoy_config_core_v3.ConfigSource_ApiConfigSource{
+				ApiConfigSource: &envoy_config_core_v3.ApiConfigSource{
+					ApiType:             envoy_config_core_v3.ApiConfigSource_GRPC,
+					TransportApiVersion: envoy_config_core_v3.ApiVersion_V3,
+					GrpcServices: []*envoy_config_core_v3.GrpcService{{
+						TargetSpecifier: &envoy_config_core_v3.GrpcService_EnvoyGrpc_{
+							EnvoyGrpc: &envoy_config_core_v3.GrpcService_EnvoyGrpc{
+								ClusterName: spireAgentClusterName,
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// buildSPIRESVIDSdsSecretConfigs returns the SDS secret configs for the X.509 SVID of this workload.
+func buildSPIRESVIDSdsSecretConfigs() []*envoy_extensions_transport_sockets_tls_v3.SdsSecretConfig {
+	return []*envoy_extensions_transport_sockets_tls_v3.SdsSecretConfig{
+		buildSPIRESdsSecretConfig(spireSVIDSecretName),
+	}
+}
+
+// buildSPIREValidationContext returns a validation context which verifies the peer certificate using the SPIRE trust
+// bundle combined with the subject alt name matchers of the default validation context.
+func buildSPIREValidationContext(
+	defaultValidationContext *envoy_extensions_transport_sockets_tls_v3.CertificateValidationContext,
+) *envoy_extensions_transport_sockets_tls_v3.CommonTlsContext_CombinedValidationContext {
+	return &envoy_extensions_transport_sockets_tls_v3.CommonTlsContext_CombinedValidationContext{
+		CombinedValidationContext: &envoy_extensions_transport_sockets_tls_v3.CommonTlsContext_CombinedCertificateValidationContext{
+			DefaultValidationContext:         defaultValidationContext,
+			ValidationContextSdsSecretConfig: buildSPIRESdsSecretConfig(spireBundleSecretName),
+		},
+	}
+}
@@ -3,10 +3,13 @@ package envoyconfig
 import (
 	"fmt"
 	"net"
+	"sort"
 
 	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	envoy_config_endpoint_v3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	envoy_config_trace_v3 "github.com/envoyproxy/go-control-plane/envoy/config/trace/v3"
+	envoy_type_tracing_v3 "github.com/envoyproxy/go-control-plane/envoy/type/tracing/v3"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/durationpb"
 
@@ -94,7 +97,7 @@ func buildTracingCluster(options *config.Options) (*envoy_config_cluster_v3.Clus
 	}
 }
 
-func buildTracingHTTP(options *config.Options) (*envoy_config_trace_v3.Tracing_Http, error) {
+func (b *Builder) buildTracingHTTP(options *config.Options) (*envoy_config_trace_v3.Tracing_Http, error) {
 	tracingOptions, err := config.NewTracingOptions(options)
 	if err != nil {
 		return nil, fmt.Errorf("invalid tracing config: %w", err)
@@ -128,7 +131,74 @@ func buildTracingHTTP(options *config.Options) (*envoy_config_trace_v3.Tracing_H
 				TypedConfig: tracingTC,
 			},
 		}, nil
+	case trace.OTLPTracingProviderName:
+		// envoy doesn't support OTLP, so its spans are sent to the agent trace service of the control plane,
+		// which exports them with pomerium's own
+		tracingTC, _ := anypb.New(&envoy_config_trace_v3.OpenCensusConfig{
+			OcagentExporterEnabled: true,
+			OcagentGrpcService: &envoy_config_core_v3.GrpcService{
+				TargetSpecifier: &envoy_config_core_v3.GrpcService_GoogleGrpc_{
+					GoogleGrpc: &envoy_config_core_v3.GrpcService_GoogleGrpc{
+						TargetUri:  b.localGRPCAddress,
+						StatPrefix: "oc_agent",
+					},
+				},
+			},
+			IncomingTraceContext: []envoy_config_trace_v3.OpenCensusConfig_TraceContext{
+				envoy_config_trace_v3.OpenCensusConfig_TRACE_CONTEXT,
+				envoy_config_trace_v3.OpenCensusConfig_B3,
+			},
+			OutgoingTraceContext: []envoy_config_trace_v3.OpenCensusConfig_TraceContext{
+				envoy_config_trace_v3.OpenCensusConfig_TRACE_CONTEXT,
+				envoy_config_trace_v3.OpenCensusConfig_B3,
+			},
+		})
+		return &envoy_config_trace_v3.Tracing_Http{
+			Name: "envoy.tracers.opencensus",
+			ConfigType: &envoy_config_trace_v3.Tracing_Http_TypedConfig{
+				TypedConfig: tracingTC,
+			},
+		}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// getTracingSamplePercent returns the percentage of requests envoy samples, according to the tracing sampler.
+func getTracingSamplePercent(options *config.Options) float64 {
+	switch options.TracingSampler {
+	case trace.AlwaysSampler:
+		return 100
+	case trace.NeverSampler:
+		return 0
 	default:
+		return options.TracingSampleRate * 100
+	}
+}
+
+// buildTracingCustomTags returns the tags envoy adds to every span. For Datadog, these are the same
+// global tags pomerium adds to its own spans.
+func buildTracingCustomTags(options *config.Options) ([]*envoy_type_tracing_v3.CustomTag, error) {
+	tracingOptions, err := config.NewTracingOptions(options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracing config: %w", err)
+	}
+	if tracingOptions.Provider != trace.DatadogTracingProviderName {
 		return nil, nil
 	}
+
+	tags := trace.DatadogGlobalTags(tracingOptions)
+	var customTags []*envoy_type_tracing_v3.CustomTag
+	for k, v := range tags {
+		customTags = append(customTags, &envoy_type_tracing_v3.CustomTag{
+			Tag: k,
+			Type: &envoy_type_tracing_v3.CustomTag_Literal_{
+				Literal: &envoy_type_tracing_v3.CustomTag_Literal{Value: fmt.Sprint(v)},
+			},
+		})
+	}
+	sort.Slice(customTags, func(i, j int) bool {
+		return customTags[i].Tag < customTags[j].Tag
+	})
+	return customTags, nil
 }
@@ -3,9 +3,11 @@ package envoyconfig
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/config/envoyconfig/filemgr"
 	"github.com/pomerium/pomerium/internal/testutil"
 )
 
@@ -98,8 +100,9 @@ func TestBuildTracingCluster(t *testing.T) {
 }
 
 func TestBuildTracingHTTP(t *testing.T) {
+	b := New("local-grpc", "local-http", filemgr.NewManager(), nil)
 	t.Run("datadog", func(t *testing.T) {
-		h, err := buildTracingHTTP(&config.Options{
+		h, err := b.buildTracingHTTP(&config.Options{
 			TracingProvider: "datadog",
 		})
 		require.NoError(t, err)
@@ -114,8 +117,25 @@ func TestBuildTracingHTTP(t *testing.T) {
 			}
 		`, h)
 	})
+	t.Run("datadog service", func(t *testing.T) {
+		h, err := b.buildTracingHTTP(&config.Options{
+			TracingProvider:       "datadog",
+			TracingDatadogService: "edge-proxy",
+		})
+		require.NoError(t, err)
+		testutil.AssertProtoJSONEqual(t, `
+			{
+				"name": "envoy.tracers.datadog",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.config.trace.v3.DatadogConfig",
+					"collectorCluster": "datadog-apm",
+					"serviceName": "edge-proxy"
+				}
+			}
+		`, h)
+	})
 	t.Run("zipkin", func(t *testing.T) {
-		h, err := buildTracingHTTP(&config.Options{
+		h, err := b.buildTracingHTTP(&config.Options{
 			TracingProvider: "zipkin",
 			ZipkinEndpoint:  "https://example.com/api/v2/spans",
 		})
@@ -132,4 +152,69 @@ func TestBuildTracingHTTP(t *testing.T) {
 			}
 		`, h)
 	})
+	t.Run("otlp", func(t *testing.T) {
+		h, err := b.buildTracingHTTP(&config.Options{
+			TracingProvider:     "otlp",
+			TracingOTLPEndpoint: "http://collector:4318",
+		})
+		require.NoError(t, err)
+		testutil.AssertProtoJSONEqual(t, `
+			{
+				"name": "envoy.tracers.opencensus",
+				"typedConfig": {
+					"@type": "type.googleapis.com/envoy.config.trace.v3.OpenCensusConfig",
+					"ocagentExporterEnabled": true,
+					"ocagentGrpcService": {
+						"googleGrpc": {
+							"targetUri": "local-grpc",
+							"statPrefix": "oc_agent"
+						}
+					},
+					"incomingTraceContext": ["TRACE_CONTEXT", "B3"],
+					"outgoingTraceContext": ["TRACE_CONTEXT", "B3"]
+				}
+			}
+		`, h)
+	})
+}
+
+func TestGetTracingSamplePercent(t *testing.T) {
+	for _, tc := range []struct {
+		sampler string
+		expect  float64
+	}{
+		{"", 25},
+		{"probability", 25},
+		{"always", 100},
+		{"never", 0},
+	} {
+		assert.Equal(t, tc.expect, getTracingSamplePercent(&config.Options{
+			TracingSampler:    tc.sampler,
+			TracingSampleRate: 0.25,
+		}), tc.sampler)
+	}
+}
+
+func TestBuildTracingCustomTags(t *testing.T) {
+	t.Run("datadog", func(t *testing.T) {
+		tags, err := buildTracingCustomTags(&config.Options{
+			TracingProvider:    "datadog",
+			TracingDatadogEnv:  "prod",
+			TracingDatadogTags: map[string]string{"team": "infra", "version": "1.2.3"},
+		})
+		require.NoError(t, err)
+		testutil.AssertProtoJSONEqual(t, `[
+			{ "tag": "env", "literal": { "value": "prod" } },
+			{ "tag": "team", "literal": { "value": "infra" } },
+			{ "tag": "version", "literal": { "value": "1.2.3" } }
+		]`, tags)
+	})
+	t.Run("zipkin", func(t *testing.T) {
+		tags, err := buildTracingCustomTags(&config.Options{
+			TracingProvider: "zipkin",
+			ZipkinEndpoint:  "https://example.com/api/v2/spans",
+		})
+		require.NoError(t, err)
+		assert.Nil(t, tags)
+	})
 }
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// ExtProc configures an external processing gRPC service, which can inspect and modify the requests and
+// responses of a route. See https://www.envoyproxy.io/docs/envoy/latest/api-v3/service/ext_proc/v3alpha/external_processor.proto
+type ExtProc struct {
+	// URL is the address of the service, e.g. http://ext-proc.example.com:9000. https uses TLS.
+	URL string `mapstructure:"url" yaml:"url" json:"url"`
+	// Timeout is the timeout for each message sent to the service.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// FailureModeAllow, if set, continues processing the request when the service fails.
+	FailureModeAllow bool `mapstructure:"failure_mode_allow" yaml:"failure_mode_allow,omitempty" json:"failure_mode_allow,omitempty"`
+	// RequestBodyMode is how the request body is sent to the service: none, streamed, buffered or
+	// buffered_partial. Defaults to none.
+	RequestBodyMode string `mapstructure:"request_body_mode" yaml:"request_body_mode,omitempty" json:"request_body_mode,omitempty"`
+	// ResponseBodyMode is how the response body is sent to the service, like RequestBodyMode.
+	ResponseBodyMode string `mapstructure:"response_body_mode" yaml:"response_body_mode,omitempty" json:"response_body_mode,omitempty"`
+}
+
+// ExtProcBodyModes are the valid request and response body modes.
+var ExtProcBodyModes = []string{"none", "streamed", "buffered", "buffered_partial"}
+
+// GetURL returns the parsed URL of the service.
+func (e *ExtProc) GetURL() (*url.URL, error) {
+	return urlutil.ParseAndValidateURL(e.URL)
+}
+
+func (e *ExtProc) validate() error {
+	if e.URL == "" {
+		return errors.New("url is required")
+	}
+	u, err := e.GetURL()
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	if e.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	for _, mode := range []string{e.RequestBodyMode, e.ResponseBodyMode} {
+		if mode != "" && !isExtProcBodyMode(mode) {
+			return fmt.Errorf("unknown body mode: %s", mode)
+		}
+	}
+	return nil
+}
+
+func isExtProcBodyMode(mode string) bool {
+	for _, m := range ExtProcBodyModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// External authorizer modes.
+const (
+	// ExternalAuthorizerModeRequireBoth allows a request when both the route's policy and the external
+	// authorizer allow it.
+	ExternalAuthorizerModeRequireBoth = "require_both"
+	// ExternalAuthorizerModeEither allows a request when either the route's policy or the external authorizer
+	// allows it.
+	ExternalAuthorizerModeEither = "either"
+)
+
+// ExternalAuthorizer delegates the authorization of a route's requests to an external policy decision point.
+// It's called with the same input as the route's policy, and its verdict is combined with the policy's.
+type ExternalAuthorizer struct {
+	// URL is the address of the authorizer. http and https URLs are called with a JSON POST request, grpc
+	// and grpcs URLs with a gRPC request.
+	URL string `mapstructure:"url" yaml:"url" json:"url"`
+	// Mode is how the authorizer's verdict is combined with the route's policy: require_both or either.
+	// Defaults to require_both.
+	Mode string `mapstructure:"mode" yaml:"mode,omitempty" json:"mode,omitempty"`
+	// Timeout is the timeout for each call to the authorizer.
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// GetURL returns the parsed URL of the authorizer.
+func (ea *ExternalAuthorizer) GetURL() (*url.URL, error) {
+	return urlutil.ParseAndValidateURL(ea.URL)
+}
+
+// GetMode returns the mode of the authorizer, which defaults to require_both.
+func (ea *ExternalAuthorizer) GetMode() string {
+	if ea.Mode == "" {
+		return ExternalAuthorizerModeRequireBoth
+	}
+	return ea.Mode
+}
+
+func (ea *ExternalAuthorizer) validate() error {
+	if ea.URL == "" {
+		return errors.New("url is required")
+	}
+	u, err := ea.GetURL()
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "grpc", "grpcs":
+	default:
+		return fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	switch ea.GetMode() {
+	case ExternalAuthorizerModeRequireBoth, ExternalAuthorizerModeEither:
+	default:
+		return fmt.Errorf("unknown mode: %s", ea.Mode)
+	}
+	if ea.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	return nil
+}
@@ -17,6 +17,8 @@ const (
 	StorageRedisName = "redis"
 	// StorageInMemoryName is the name of the in-memory storage backend
 	StorageInMemoryName = "memory"
+	// StoragePluginName is the name of the storage backend served by an external plugin
+	StoragePluginName = "plugin"
 )
 
 // IsValidService checks to see if a service is a valid service mode
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/internalca"
+)
+
+// loadInternalCertificate gets the certificate of this service from the internal CA, and records when the options
+// should be loaded again to renew it. The databroker holds the CA key and issues its own certificate, the other
+// services request theirs from the databroker.
+func (o *Options) loadInternalCertificate(ctx context.Context) error {
+	o.internalCAPEM, o.internalCertificate, o.internalCARefreshAt = nil, nil, time.Time{}
+	if !o.InternalCA {
+		return nil
+	}
+
+	names, err := o.getInternalCertificateNames()
+	if err != nil {
+		return err
+	}
+
+	if IsDataBroker(o.Services) {
+		key, err := o.GetInternalCAKey()
+		if err != nil {
+			return fmt.Errorf("config: invalid internal_ca_key: %w", err)
+		}
+		ca, err := internalca.Get(key)
+		if err != nil {
+			return err
+		}
+		cert, renewAt, err := ca.GetCertificate(o.Services, names)
+		if err != nil {
+			return err
+		}
+		o.internalCAPEM = ca.PEM()
+		o.internalCertificate = cert
+		o.internalCARefreshAt = renewAt
+		return nil
+	}
+
+	sharedKey, err := o.GetSharedKey()
+	if err != nil {
+		return fmt.Errorf("config: internal_ca requires a shared secret: %w", err)
+	}
+	dataBrokerURLs, err := o.GetDataBrokerURLs()
+	if err != nil {
+		return err
+	}
+	cert, caPEM, renewAt, err := internalca.Bootstrap(ctx, dataBrokerURLs, sharedKey, o.Services, names)
+	if err != nil {
+		return err
+	}
+	o.internalCAPEM = caPEM
+	o.internalCertificate = cert
+	o.internalCARefreshAt = renewAt
+	return nil
+}
+
+// getInternalCertificateNames returns the names the other services use to connect to this service. Only the
+// authorize and databroker services are connected to, so the certificates of the other services are only used as
+// client certificates.
+func (o *Options) getInternalCertificateNames() ([]string, error) {
+	var urls []*url.URL
+	if IsAuthorize(o.Services) {
+		authorizeURLs, err := o.GetAuthorizeURLs()
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, authorizeURLs...)
+	}
+	if IsDataBroker(o.Services) {
+		dataBrokerURLs, err := o.GetDataBrokerURLs()
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, dataBrokerURLs...)
+	}
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, u := range urls {
+		add(u.Hostname())
+	}
+	add(o.OverrideCertificateName)
+	return names, nil
+}
+
+// GetInternalCA returns the PEM encoded certificate of the internal CA, or nil if it isn't enabled.
+func (o *Options) GetInternalCA() []byte {
+	return o.internalCAPEM
+}
+
+// getRefreshAt returns when the options should be loaded again, because secrets loaded from Vault or the
+// certificate issued by the internal CA expire. It's zero if they don't need to be loaded again.
+func (o *Options) getRefreshAt() time.Time {
+	switch {
+	case o.vaultRefreshAt.IsZero():
+		return o.internalCARefreshAt
+	case o.internalCARefreshAt.IsZero():
+		return o.vaultRefreshAt
+	}
+	return minTime(o.vaultRefreshAt, o.internalCARefreshAt)
+}
+
+func isServerCertificate(cert *tls.Certificate) bool {
+	return cert.Leaf != nil && (len(cert.Leaf.DNSNames) > 0 || len(cert.Leaf.IPAddresses) > 0)
+}
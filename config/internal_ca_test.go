@@ -0,0 +1,131 @@
+package config
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/pomerium/pomerium/internal/internalca"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestOptions_loadInternalCertificate(t *testing.T) {
+	ctx := context.Background()
+	sharedKey := cryptutil.NewBase64Key()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	caKey := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+
+	newOptions := func(services string) *Options {
+		o := NewDefaultOptions()
+		o.Services = services
+		o.SharedKey = sharedKey
+		o.InternalCA = true
+		o.DataBrokerURLString = "https://databroker.internal:5443"
+		o.AuthorizeURLString = "https://authorize.internal:5443"
+		if IsDataBroker(services) {
+			o.InternalCAKey = caKey
+		}
+		return o
+	}
+
+	t.Run("databroker", func(t *testing.T) {
+		o := newOptions(ServiceDataBroker)
+		require.NoError(t, o.loadInternalCertificate(ctx))
+		assert.False(t, o.getRefreshAt().IsZero())
+
+		certs, err := o.GetCertificates()
+		require.NoError(t, err)
+		if assert.Len(t, certs, 1) {
+			assert.Equal(t, "databroker", certs[0].Leaf.Subject.CommonName)
+			assert.Equal(t, []string{"databroker.internal"}, certs[0].Leaf.DNSNames)
+		}
+
+		pool := x509.NewCertPool()
+		require.True(t, pool.AppendCertsFromPEM(o.GetInternalCA()))
+		_, err = certs[0].Leaf.Verify(x509.VerifyOptions{
+			DNSName:   "databroker.internal",
+			Roots:     pool,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		assert.NoError(t, err)
+	})
+	t.Run("proxy", func(t *testing.T) {
+		databroker := newOptions(ServiceDataBroker)
+		require.NoError(t, databroker.loadInternalCertificate(ctx))
+		certs, err := databroker.GetCertificates()
+		require.NoError(t, err)
+		caKeyPEM, err := databroker.GetInternalCAKey()
+		require.NoError(t, err)
+		ca, err := internalca.Get(caKeyPEM)
+		require.NoError(t, err)
+
+		li, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{certs[0]},
+			MinVersion:   tls.VersionTLS12,
+		})))
+		bootstrap := internalca.NewBootstrapServer(func(service string) bool { return service == ServiceProxy })
+		bootstrap.Update(ca, mustDecodeBase64(t, sharedKey))
+		bootstrap.Register(srv)
+		go func() { _ = srv.Serve(li) }()
+		defer srv.Stop()
+
+		o := newOptions(ServiceProxy)
+		o.DataBrokerURLString = "https://" + li.Addr().String()
+		require.NoError(t, o.loadInternalCertificate(ctx))
+		assert.Equal(t, databroker.GetInternalCA(), o.GetInternalCA())
+
+		certs, err = o.GetCertificates()
+		require.NoError(t, err)
+		assert.Empty(t, certs, "proxy certificates should only be used as client certificates")
+
+		cert, err := o.GetGRPCClientCertificate()
+		require.NoError(t, err)
+		if assert.NotNil(t, cert) {
+			assert.Equal(t, "proxy", cert.Leaf.Subject.CommonName)
+		}
+		assert.True(t, o.RequireGRPCClientCertificates())
+	})
+	t.Run("disabled", func(t *testing.T) {
+		o := newOptions(ServiceProxy)
+		o.InternalCA = false
+		require.NoError(t, o.loadInternalCertificate(ctx))
+		assert.Nil(t, o.GetInternalCA())
+		assert.True(t, o.getRefreshAt().IsZero())
+	})
+	t.Run("missing shared secret", func(t *testing.T) {
+		o := newOptions(ServiceProxy)
+		o.SharedKey = ""
+		assert.Error(t, o.loadInternalCertificate(ctx))
+	})
+	t.Run("missing key", func(t *testing.T) {
+		o := newOptions(ServiceDataBroker)
+		o.InternalCAKey = ""
+		assert.Error(t, o.loadInternalCertificate(ctx))
+	})
+}
+
+func mustDecodeBase64(t *testing.T, s string) []byte {
+	t.Helper()
+
+	bs, err := base64.StdEncoding.DecodeString(s)
+	require.NoError(t, err)
+	return bs
+}
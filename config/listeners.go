@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+)
+
+// MainListenerName is the name of the listener serving on the address option. Routes without listeners are only
+// served by it.
+const MainListenerName = "main"
+
+// A Listener is an additional HTTP listener, e.g. an internal-only port alongside the internet-facing one. It only
+// serves the routes which list it in their listeners.
+type Listener struct {
+	// Name is the name routes reference the listener by.
+	Name string `mapstructure:"name" yaml:"name"`
+	// Address is the host and port the listener serves HTTP requests from.
+	Address string `mapstructure:"address" yaml:"address"`
+}
+
+// GetListenerName returns the name of the HTTP listener serving on the given address. It returns false if no HTTP
+// listener serves on the address.
+func (o *Options) GetListenerName(addr string) (string, bool) {
+	if addr == o.Addr {
+		return MainListenerName, true
+	}
+	for _, li := range o.Listeners {
+		if li.Address == addr {
+			return li.Name, true
+		}
+	}
+	return "", false
+}
+
+// IsServedByListener returns true if the route is served by the named listener.
+func (p *Policy) IsServedByListener(name string) bool {
+	if len(p.Listeners) == 0 {
+		return name == MainListenerName
+	}
+	for _, li := range p.Listeners {
+		if li == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Options) validateListeners() error {
+	names := map[string]struct{}{MainListenerName: {}}
+	addrs := map[string]struct{}{o.Addr: {}, o.GetGRPCAddr(): {}}
+	for i, li := range o.Listeners {
+		if li.Name == "" {
+			return fmt.Errorf("config: listener %d must have a name", i)
+		}
+		if _, ok := names[li.Name]; ok {
+			return fmt.Errorf("config: duplicate listener name: %s", li.Name)
+		}
+		names[li.Name] = struct{}{}
+
+		if li.Address == "" {
+			return fmt.Errorf("config: listener %s must have an address", li.Name)
+		}
+		if _, ok := addrs[li.Address]; ok {
+			return fmt.Errorf("config: listener %s address is already in use: %s", li.Name, li.Address)
+		}
+		addrs[li.Address] = struct{}{}
+	}
+
+	for _, p := range o.GetAllPolicies() {
+		for _, name := range p.Listeners {
+			if _, ok := names[name]; !ok {
+				return fmt.Errorf("config: policy (%s) references unknown listener: %s", p.From, name)
+			}
+		}
+	}
+	return nil
+}
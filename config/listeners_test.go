@@ -0,0 +1,66 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_IsServedByListener(t *testing.T) {
+	p := &Policy{}
+	assert.True(t, p.IsServedByListener(MainListenerName))
+	assert.False(t, p.IsServedByListener("internal"))
+
+	p.Listeners = []string{"internal"}
+	assert.False(t, p.IsServedByListener(MainListenerName))
+	assert.True(t, p.IsServedByListener("internal"))
+
+	p.Listeners = []string{MainListenerName, "internal"}
+	assert.True(t, p.IsServedByListener(MainListenerName))
+	assert.True(t, p.IsServedByListener("internal"))
+}
+
+func TestOptions_GetListenerName(t *testing.T) {
+	o := &Options{
+		Addr:      ":443",
+		Listeners: []Listener{{Name: "internal", Address: "10.0.0.1:8443"}},
+	}
+
+	name, ok := o.GetListenerName(":443")
+	assert.True(t, ok)
+	assert.Equal(t, MainListenerName, name)
+
+	name, ok = o.GetListenerName("10.0.0.1:8443")
+	assert.True(t, ok)
+	assert.Equal(t, "internal", name)
+
+	_, ok = o.GetListenerName(":5443")
+	assert.False(t, ok)
+}
+
+func TestOptions_validateListeners(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		listeners []Listener
+		policies  []Policy
+		err       string
+	}{
+		{"valid", []Listener{{Name: "internal", Address: "10.0.0.1:8443"}}, []Policy{{From: "https://a.example.com", Listeners: []string{MainListenerName, "internal"}}}, ""},
+		{"missing name", []Listener{{Address: "10.0.0.1:8443"}}, nil, "config: listener 0 must have a name"},
+		{"main name", []Listener{{Name: MainListenerName, Address: "10.0.0.1:8443"}}, nil, "config: duplicate listener name: main"},
+		{"duplicate name", []Listener{{Name: "internal", Address: "10.0.0.1:8443"}, {Name: "internal", Address: "10.0.0.2:8443"}}, nil, "config: duplicate listener name: internal"},
+		{"missing address", []Listener{{Name: "internal"}}, nil, "config: listener internal must have an address"},
+		{"main address", []Listener{{Name: "internal", Address: ":443"}}, nil, "config: listener internal address is already in use: :443"},
+		{"unknown listener", nil, []Policy{{From: "https://a.example.com", Listeners: []string{"internal"}}}, "config: policy (https://a.example.com) references unknown listener: internal"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &Options{Addr: ":443", Listeners: tc.listeners, Policies: tc.policies}
+			err := o.validateListeners()
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// minLocalRateLimitUnit is the shortest unit Envoy supports.
+const minLocalRateLimitUnit = 50 * time.Millisecond
+
+// LocalRateLimit configures rate limiting the requests to a route with a token bucket. The limit is local to
+// each Envoy instance, and applies to all requests, whether they are authenticated or not.
+type LocalRateLimit struct {
+	// RequestsPerUnit is the number of requests allowed per unit.
+	RequestsPerUnit uint32 `mapstructure:"requests_per_unit" yaml:"requests_per_unit" json:"requests_per_unit"`
+	// Unit is the interval the requests are allowed in. Defaults to a second.
+	Unit time.Duration `mapstructure:"unit" yaml:"unit,omitempty" json:"unit,omitempty"`
+	// Burst is the maximum number of requests allowed at once. Defaults to RequestsPerUnit.
+	Burst uint32 `mapstructure:"burst" yaml:"burst,omitempty" json:"burst,omitempty"`
+}
+
+// GetUnit returns the unit, or the default of a second.
+func (l *LocalRateLimit) GetUnit() time.Duration {
+	if l.Unit == 0 {
+		return time.Second
+	}
+	return l.Unit
+}
+
+// GetBurst returns the burst, or the default of the requests per unit.
+func (l *LocalRateLimit) GetBurst() uint32 {
+	if l.Burst == 0 {
+		return l.RequestsPerUnit
+	}
+	return l.Burst
+}
+
+func (l *LocalRateLimit) validate() error {
+	if l.RequestsPerUnit == 0 {
+		return errors.New("requests_per_unit is required")
+	}
+	if l.Unit != 0 && l.Unit < minLocalRateLimitUnit {
+		return errors.New("unit must be at least 50ms")
+	}
+	if l.Burst != 0 && l.Burst < l.RequestsPerUnit {
+		return errors.New("burst must be at least requests_per_unit")
+	}
+	return nil
+}
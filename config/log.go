@@ -2,14 +2,54 @@ package config
 
 import (
 	"context"
+	"io"
+	"os"
 	"sync"
 
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/log/sink"
 )
 
 // The LogManager configures logging based on options.
 type LogManager struct {
 	mu sync.Mutex
+
+	output          logSink
+	accessOutput    logSink
+	prevSinkOptions sink.Options
+
+	// the loggers write to these, rather than to the sinks, so that a sink is only closed once nothing
+	// writes to it anymore
+	outputWriter       swapWriter
+	accessOutputWriter swapWriter
+}
+
+// A logSink is a log sink and the output it was created from.
+type logSink struct {
+	output string
+	w      io.WriteCloser
+}
+
+// A swapWriter is a writer whose underlying writer can be swapped. Once swap returns, no write to the
+// previous writer is in progress.
+type swapWriter struct {
+	mu sync.RWMutex
+	w  io.Writer
+}
+
+func (sw *swapWriter) Write(p []byte) (int, error) {
+	sw.mu.RLock()
+	defer sw.mu.RUnlock()
+	if sw.w == nil {
+		return os.Stdout.Write(p)
+	}
+	return sw.w.Write(p)
+}
+
+func (sw *swapWriter) swap(w io.Writer) {
+	sw.mu.Lock()
+	sw.w = w
+	sw.mu.Unlock()
 }
 
 // NewLogManager creates a new LogManager.
@@ -20,9 +60,27 @@ func NewLogManager(ctx context.Context, src Source) *LogManager {
 	return mgr
 }
 
-// Close closes the log manager.
+// Close closes the log manager. Logs are written to stdout again.
 func (mgr *LogManager) Close() error {
-	return nil
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	log.SetAccessOutput(nil)
+	log.SetOutput(nil)
+	log.DisableDebug()
+	mgr.accessOutputWriter.swap(nil)
+	mgr.outputWriter.swap(nil)
+
+	var err error
+	for _, s := range []*logSink{&mgr.output, &mgr.accessOutput} {
+		if s.w != nil {
+			if closeErr := s.w.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+		*s = logSink{}
+	}
+	return err
 }
 
 // OnConfigChange is called whenever configuration changes.
@@ -34,6 +92,8 @@ func (mgr *LogManager) OnConfigChange(ctx context.Context, cfg *Config) {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
+	mgr.updateOutputs(ctx, cfg.Options)
+
 	if cfg.Options.Debug {
 		log.EnableDebug()
 	} else {
@@ -44,3 +104,60 @@ func (mgr *LogManager) OnConfigChange(ctx context.Context, cfg *Config) {
 		log.SetLevel(cfg.Options.LogLevel)
 	}
 }
+
+func (mgr *LogManager) updateOutputs(ctx context.Context, options *Options) {
+	sinkOptions := options.GetLogSinkOptions()
+	sinkOptionsChanged := sinkOptions != mgr.prevSinkOptions
+	mgr.prevSinkOptions = sinkOptions
+
+	var closers []io.Closer
+
+	if output := options.LogOutput; mgr.output.w == nil || output != mgr.output.output || sinkOptionsChanged {
+		w, err := sink.New(output, sinkOptions)
+		if err != nil {
+			log.Error(ctx).Err(err).Str("output", output).Msg("config: error creating log output")
+		} else {
+			if mgr.output.w != nil {
+				closers = append(closers, mgr.output.w)
+			}
+			mgr.output = logSink{output: output, w: w}
+			if sink.IsStdout(output) {
+				// the debug logger only pretty prints to stdout itself
+				mgr.outputWriter.swap(nil)
+				log.SetOutput(nil)
+			} else {
+				mgr.outputWriter.swap(w)
+				log.SetOutput(&mgr.outputWriter)
+			}
+		}
+	}
+
+	if output := options.GetAccessLogOutput(); output != mgr.accessOutput.output || sinkOptionsChanged {
+		var w io.WriteCloser
+		var err error
+		if output != "" {
+			w, err = sink.New(output, sinkOptions)
+		}
+		if err != nil {
+			log.Error(ctx).Err(err).Str("output", output).Msg("config: error creating access log output")
+		} else {
+			if mgr.accessOutput.w != nil {
+				closers = append(closers, mgr.accessOutput.w)
+			}
+			mgr.accessOutput = logSink{output: output, w: w}
+			if w == nil {
+				// access logs are written with the application logs
+				mgr.accessOutputWriter.swap(&mgr.outputWriter)
+				log.SetAccessOutput(nil)
+			} else {
+				mgr.accessOutputWriter.swap(w)
+				log.SetAccessOutput(&mgr.accessOutputWriter)
+			}
+		}
+	}
+
+	// the previous outputs are closed once nothing writes to them anymore
+	for _, c := range closers {
+		_ = c.Close()
+	}
+}
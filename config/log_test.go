@@ -0,0 +1,72 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+func TestLogManager(t *testing.T) {
+	dir := t.TempDir()
+	appLog := filepath.Join(dir, "pomerium.log")
+	accessLog := filepath.Join(dir, "access.log")
+
+	ctx := context.Background()
+	src := NewStaticSource(&Config{Options: &Options{
+		LogOutput:       appLog,
+		AccessLogOutput: accessLog,
+	}})
+	mgr := NewLogManager(ctx, src)
+
+	log.Info(ctx).Msg("application message")
+	log.AccessInfo(ctx).Msg("access message")
+
+	src.SetConfig(ctx, &Config{Options: &Options{
+		LogOutput:       appLog,
+		AccessLogOutput: appLog,
+	}})
+	log.AccessInfo(ctx).Msg("second access message")
+	require.NoError(t, mgr.Close())
+	log.Info(ctx).Msg("after close")
+
+	bs, err := ioutil.ReadFile(appLog)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "application message")
+	assert.Contains(t, string(bs), "second access message")
+	assert.NotContains(t, string(bs), `"access message"`)
+	assert.NotContains(t, string(bs), "after close")
+
+	bs, err = ioutil.ReadFile(accessLog)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), `"access message"`)
+	assert.NotContains(t, string(bs), "application message")
+}
+
+func TestLogManager_swap(t *testing.T) {
+	dir := t.TempDir()
+	oldLog := filepath.Join(dir, "old.log")
+	newLog := filepath.Join(dir, "new.log")
+
+	ctx := context.Background()
+	src := NewStaticSource(&Config{Options: &Options{LogOutput: oldLog}})
+	mgr := NewLogManager(ctx, src)
+	defer func() { _ = mgr.Close() }()
+
+	// a logger created before the change keeps writing, to the new output, after the old one is closed
+	l := log.Logger().With().Logger()
+	src.SetConfig(ctx, &Config{Options: &Options{LogOutput: newLog}})
+	l.Info().Msg("message from an earlier logger")
+
+	bs, err := ioutil.ReadFile(newLog)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "message from an earlier logger")
+	bs, err = ioutil.ReadFile(oldLog)
+	require.NoError(t, err)
+	assert.NotContains(t, string(bs), "message from an earlier logger")
+}
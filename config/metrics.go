@@ -4,12 +4,17 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/middleware"
 	"github.com/pomerium/pomerium/internal/telemetry"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/internal/telemetry/otlp"
+	"github.com/pomerium/pomerium/internal/urlutil"
 
 	"github.com/rs/zerolog"
 )
@@ -21,7 +26,12 @@ type MetricsManager struct {
 	serviceName    string
 	addr           string
 	basicAuth      string
+	bearerToken    string
 	handler        http.Handler
+
+	otlpOptions  *otlp.Options
+	otlpInterval time.Duration
+	stopOTLP     func()
 }
 
 // NewMetricsManager creates a new MetricsManager.
@@ -36,8 +46,15 @@ func NewMetricsManager(ctx context.Context, src Source) *MetricsManager {
 	return mgr
 }
 
-// Close closes any underlying http server.
+// Close closes any underlying http server and stops pushing metrics.
 func (mgr *MetricsManager) Close() error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if mgr.stopOTLP != nil {
+		mgr.stopOTLP()
+		mgr.stopOTLP = nil
+	}
 	return nil
 }
 
@@ -48,6 +65,7 @@ func (mgr *MetricsManager) OnConfigChange(ctx context.Context, cfg *Config) {
 
 	mgr.updateInfo(cfg)
 	mgr.updateServer(cfg)
+	mgr.updateOTLP(cfg)
 }
 
 func (mgr *MetricsManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -80,12 +98,14 @@ func (mgr *MetricsManager) updateInfo(cfg *Config) {
 func (mgr *MetricsManager) updateServer(cfg *Config) {
 	if cfg.Options.MetricsAddr == mgr.addr &&
 		cfg.Options.MetricsBasicAuth == mgr.basicAuth &&
+		cfg.Options.MetricsBearerToken == mgr.bearerToken &&
 		cfg.Options.InstallationID == mgr.installationID {
 		return
 	}
 
 	mgr.addr = cfg.Options.MetricsAddr
 	mgr.basicAuth = cfg.Options.MetricsBasicAuth
+	mgr.bearerToken = cfg.Options.MetricsBearerToken
 	mgr.installationID = cfg.Options.InstallationID
 	mgr.handler = nil
 
@@ -100,9 +120,71 @@ func (mgr *MetricsManager) updateServer(cfg *Config) {
 		return
 	}
 
-	if username, password, ok := cfg.Options.GetMetricsBasicAuth(); ok {
-		handler = middleware.RequireBasicAuth(username, password)(handler)
+	mgr.handler = RequireMetricsAuth(cfg.Options)(handler)
+}
+
+// RequireMetricsAuth returns middleware which requires the metrics basic auth or bearer token, when either
+// is set. It protects every endpoint served on the metrics address.
+func RequireMetricsAuth(options *Options) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		username, password, hasBasicAuth := options.GetMetricsBasicAuth()
+		switch {
+		case !hasBasicAuth && options.MetricsBearerToken == "":
+			return next
+		case options.MetricsBearerToken == "":
+			return middleware.RequireBasicAuth(username, password)(next)
+		case !hasBasicAuth:
+			return middleware.RequireBearerToken(options.MetricsBearerToken)(next)
+		}
+
+		basic := middleware.RequireBasicAuth(username, password)(next)
+		bearer := middleware.RequireBearerToken(options.MetricsBearerToken)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+				bearer.ServeHTTP(w, r)
+				return
+			}
+			basic.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (mgr *MetricsManager) updateOTLP(cfg *Config) {
+	var opts *otlp.Options
+	if cfg.Options.MetricsOTLPEndpoint != "" {
+		endpoint, err := urlutil.ParseAndValidateURL(cfg.Options.MetricsOTLPEndpoint)
+		if err != nil {
+			log.Error(context.TODO()).Err(err).Msg("metrics: invalid otlp endpoint url")
+			return
+		}
+		opts = &otlp.Options{
+			Endpoint:           endpoint,
+			Headers:            cfg.Options.OTLPHeaders,
+			ServiceName:        telemetry.ServiceName(cfg.Options.Services),
+			ResourceAttributes: cfg.Options.OTLPResourceAttributes,
+		}
+	}
+	interval := cfg.Options.MetricsOTLPInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if reflect.DeepEqual(opts, mgr.otlpOptions) && interval == mgr.otlpInterval {
+		return
+	}
+
+	if mgr.stopOTLP != nil {
+		mgr.stopOTLP()
+		mgr.stopOTLP = nil
+	}
+	mgr.otlpOptions, mgr.otlpInterval = opts, interval
+	if opts == nil {
+		return
 	}
 
-	mgr.handler = handler
+	stop, err := metrics.StartOTLPExporter(*opts, interval)
+	if err != nil {
+		log.Error(context.TODO()).Err(err).Msg("metrics: failed to start otlp exporter")
+		return
+	}
+	mgr.stopOTLP = stop
 }
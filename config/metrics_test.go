@@ -59,3 +59,32 @@ func TestMetricsManagerBasicAuth(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, res.StatusCode)
 }
+
+func TestRequireMetricsAuth(t *testing.T) {
+	handler := RequireMetricsAuth(&Options{
+		MetricsBasicAuth:   base64.StdEncoding.EncodeToString([]byte("x:y")),
+		MetricsBearerToken: "TOKEN",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		expect        int
+	}{
+		{"none", "", http.StatusUnauthorized},
+		{"basic auth", "Basic " + base64.StdEncoding.EncodeToString([]byte("x:y")), http.StatusOK},
+		{"invalid basic auth", "Basic " + base64.StdEncoding.EncodeToString([]byte("x:z")), http.StatusUnauthorized},
+		{"bearer token", "Bearer TOKEN", http.StatusOK},
+		{"invalid bearer token", "Bearer OTHER", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tc.expect, w.Code)
+		})
+	}
+}
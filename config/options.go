@@ -8,17 +8,22 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/go-jose/go-jose/v3"
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 
+	"github.com/pomerium/pomerium/internal/deprecation"
 	"github.com/pomerium/pomerium/internal/directory/azure"
 	"github.com/pomerium/pomerium/internal/directory/github"
 	"github.com/pomerium/pomerium/internal/directory/gitlab"
@@ -26,8 +31,11 @@ import (
 	"github.com/pomerium/pomerium/internal/directory/okta"
 	"github.com/pomerium/pomerium/internal/directory/onelogin"
 	"github.com/pomerium/pomerium/internal/hashutil"
+	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/internalca"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/log/sink"
 	"github.com/pomerium/pomerium/internal/telemetry"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/internal/urlutil"
@@ -71,6 +79,36 @@ type Options struct {
 	// Possible options are "info","warn", and "error". Defaults to the value of `LogLevel`.
 	ProxyLogLevel string `mapstructure:"proxy_log_level" yaml:"proxy_log_level,omitempty"`
 
+	// LogOutput is where application logs are written: stdout, stderr, the absolute path of a file,
+	// syslog://host:port, syslog+tcp://host:port or kafka://host:port/topic. Defaults to stdout.
+	LogOutput string `mapstructure:"log_output" yaml:"log_output,omitempty"`
+
+	// AccessLogOutput is where access and audit logs are written. It supports the same outputs as
+	// LogOutput. Defaults to the value of `LogOutput`.
+	AccessLogOutput string `mapstructure:"access_log_output" yaml:"access_log_output,omitempty"`
+
+	// LogFileMaxSize is the size in megabytes after which a log file is rotated. If 0, log files aren't
+	// rotated by size.
+	LogFileMaxSize int `mapstructure:"log_file_max_size" yaml:"log_file_max_size,omitempty"`
+
+	// LogFileMaxAge is the age after which a log file is rotated. If 0, log files aren't rotated by age.
+	LogFileMaxAge time.Duration `mapstructure:"log_file_max_age" yaml:"log_file_max_age,omitempty"`
+
+	// LogFileMaxBackups is the number of rotated log files to keep. If 0, all of them are kept.
+	LogFileMaxBackups int `mapstructure:"log_file_max_backups" yaml:"log_file_max_backups,omitempty"`
+
+	// AuthorizeLogFields are the fields logged for every authorize check. A single request header or
+	// JWT claim is logged with headers.<name> or claims.<name>. Defaults to log.DefaultAuthorizeLogFields.
+	AuthorizeLogFields []string `mapstructure:"authorize_log_fields" yaml:"authorize_log_fields,omitempty"`
+
+	// AuthorizeLogFormat is the format of the authorize check logs.
+	// Possible options are "json", "ecs" and "combined". Defaults to "json".
+	AuthorizeLogFormat string `mapstructure:"authorize_log_format" yaml:"authorize_log_format,omitempty"`
+
+	// AccessLogAuthorizeDecision adds the authorize decision to the envoy access log record of each request,
+	// so allowed authorize checks aren't logged separately.
+	AccessLogAuthorizeDecision bool `mapstructure:"access_log_authorize_decision" yaml:"access_log_authorize_decision,omitempty"`
+
 	// SharedKey is the shared secret authorization key used to mutually authenticate
 	// requests between services.
 	SharedKey string `mapstructure:"shared_secret" yaml:"shared_secret,omitempty"`
@@ -83,6 +121,9 @@ type Options struct {
 	// HTTPS requests. If empty, ":443" (localhost:443) is used.
 	Addr string `mapstructure:"address" yaml:"address,omitempty"`
 
+	// Listeners are additional HTTP listeners, which serve the routes assigned to them.
+	Listeners []Listener `mapstructure:"listeners" yaml:"listeners,omitempty"`
+
 	// InsecureServer when enabled disables all transport security.
 	// In this mode, Pomerium is susceptible to man-in-the-middle attacks.
 	// This should be used only for testing.
@@ -114,6 +155,18 @@ type Options struct {
 	// Policies define per-route configuration and access control policies.
 	Policies   []Policy `mapstructure:"policy"`
 	PolicyFile string   `mapstructure:"policy_file" yaml:"policy_file,omitempty"`
+	// PolicyDir is a directory of YAML or JSON files whose policy is added to Policies.
+	PolicyDir string `mapstructure:"policy_dir" yaml:"policy_dir,omitempty"`
+	// PolicySets are named access rules which routes reference by name with policy_sets.
+	PolicySets map[string]SubPolicy `mapstructure:"policy_sets" yaml:"policy_sets,omitempty"`
+	// PolicyBundle is a signed OPA bundle of Rego policies which are evaluated for every route.
+	PolicyBundle *PolicyBundle `mapstructure:"policy_bundle" yaml:"policy_bundle,omitempty"`
+
+	// SMTP is the mail server used to send emails, such as access request notifications to approvers.
+	SMTP *SMTP `mapstructure:"smtp" yaml:"smtp,omitempty"`
+
+	// DecisionHook, if set, is sent a summary of each authorization decision.
+	DecisionHook *DecisionHook `mapstructure:"decision_hook" yaml:"decision_hook,omitempty"`
 
 	// AdditionalPolicies are any additional policies added to the options.
 	AdditionalPolicies []Policy `yaml:"-"`
@@ -139,6 +192,11 @@ type Options struct {
 	CookieHTTPOnly bool          `mapstructure:"cookie_http_only" yaml:"cookie_http_only,omitempty"`
 	CookieExpire   time.Duration `mapstructure:"cookie_expire" yaml:"cookie_expire,omitempty"`
 
+	// StatelessSessions stores sessions, including the user's claims, in the session cookie instead of the
+	// databroker, so that requests are authorized without looking up the session. Stateless sessions can't be
+	// refreshed or revoked, and expire after CookieExpire.
+	StatelessSessions bool `mapstructure:"stateless_sessions" yaml:"stateless_sessions,omitempty"`
+
 	// Identity provider configuration variables as specified by RFC6749
 	// https://openid.net/specs/openid-connect-basic-1_0.html#RFC6749
 	ClientID       string   `mapstructure:"idp_client_id" yaml:"idp_client_id,omitempty"`
@@ -147,10 +205,18 @@ type Options struct {
 	ProviderURL    string   `mapstructure:"idp_provider_url" yaml:"idp_provider_url,omitempty"`
 	Scopes         []string `mapstructure:"idp_scopes" yaml:"idp_scopes,omitempty"`
 	ServiceAccount string   `mapstructure:"idp_service_account" yaml:"idp_service_account,omitempty"`
+	// GroupsClaim is the ID token claim which contains the user's groups. They're used for policy when the
+	// user has no directory record, so group policies work without directory sync.
+	GroupsClaim string `mapstructure:"idp_groups_claim" yaml:"idp_groups_claim,omitempty"`
+	// ClaimTransforms transform the identity provider claims of sessions and the JWT assertion.
+	ClaimTransforms ClaimTransforms `mapstructure:"claim_transforms" yaml:"claim_transforms,omitempty"`
 	// Identity provider refresh directory interval/timeout settings.
 	RefreshDirectoryTimeout  time.Duration `mapstructure:"idp_refresh_directory_timeout" yaml:"idp_refresh_directory_timeout,omitempty"`
 	RefreshDirectoryInterval time.Duration `mapstructure:"idp_refresh_directory_interval" yaml:"idp_refresh_directory_interval,omitempty"`
 	QPS                      float64       `mapstructure:"idp_qps" yaml:"idp_qps"`
+	// IdPOutageGracePeriod is how long sessions are kept, and extended if they expire, while the identity
+	// provider is unreachable. Zero disables the grace period.
+	IdPOutageGracePeriod time.Duration `mapstructure:"idp_outage_grace_period" yaml:"idp_outage_grace_period,omitempty"`
 
 	// RequestParams are custom request params added to the signin request as
 	// part of an Oauth2 code flow.
@@ -158,6 +224,17 @@ type Options struct {
 	// https://www.iana.org/assignments/oauth-parameters/oauth-parameters.xhtml
 	// https://openid.net/specs/openid-connect-basic-1_0.html#RequestParameters
 	RequestParams map[string]string `mapstructure:"idp_request_params" yaml:"idp_request_params,omitempty"`
+	// PKCE enables Proof Key for Code Exchange with the S256 method for OpenID Connect providers.
+	PKCE bool `mapstructure:"idp_pkce" yaml:"idp_pkce,omitempty"`
+	// PushedAuthorizationRequests sends the parameters of authorization requests to the OpenID Connect
+	// provider's pushed authorization request endpoint, rather than in the sign in url.
+	PushedAuthorizationRequests bool `mapstructure:"idp_pushed_authorization_requests" yaml:"idp_pushed_authorization_requests,omitempty"`
+	// SignedRequestObjects signs the parameters of authorization requests to OpenID Connect providers as a
+	// request object, with the active signing key.
+	SignedRequestObjects bool `mapstructure:"idp_signed_request_objects" yaml:"idp_signed_request_objects,omitempty"`
+	// SignInRateLimit, if set, locks client IP addresses and identities out of signing in after repeated
+	// failures.
+	SignInRateLimit *SignInRateLimit `mapstructure:"sign_in_rate_limit" yaml:"sign_in_rate_limit,omitempty"`
 
 	// AuthorizeURLString is the routable destination of the authorize service's
 	// gRPC endpoint. NOTE: As many load balancers do not support
@@ -165,20 +242,35 @@ type Options struct {
 	AuthorizeURLString  string   `mapstructure:"authorize_service_url" yaml:"authorize_service_url,omitempty"`
 	AuthorizeURLStrings []string `mapstructure:"authorize_service_urls" yaml:"authorize_service_urls,omitempty"`
 
+	// AuthorizeSessionPartitioning partitions sessions between authorize instances, so that each instance
+	// only caches its share of sessions.
+	AuthorizeSessionPartitioning bool `mapstructure:"authorize_session_partitioning" yaml:"authorize_session_partitioning,omitempty"`
+
 	// Settings to enable custom behind-the-ingress service communication
 	OverrideCertificateName string `mapstructure:"override_certificate_name" yaml:"override_certificate_name,omitempty"`
 	CA                      string `mapstructure:"certificate_authority" yaml:"certificate_authority,omitempty"`
 	CAFile                  string `mapstructure:"certificate_authority_file" yaml:"certificate_authority_file,omitempty"`
 
+	// SPIREAgentSocket is the path to the unix socket of a SPIRE agent's secret discovery service. When set,
+	// X.509 SVIDs and trust bundles are fetched from the agent and rotated automatically.
+	SPIREAgentSocket string `mapstructure:"spire_agent_socket" yaml:"spire_agent_socket,omitempty"`
+
 	// SigningKey is the private key used to add a JWT-signature to upstream requests.
 	// https://www.pomerium.io/docs/topics/getting-users-identity.html
 	SigningKey          string `mapstructure:"signing_key" yaml:"signing_key,omitempty"`
+	SigningKeyFile      string `mapstructure:"signing_key_file" yaml:"signing_key_file,omitempty"`
 	SigningKeyAlgorithm string `mapstructure:"signing_key_algorithm" yaml:"signing_key_algorithm,omitempty"`
+	// SigningKeys are additional signing keys, used to rotate the signing key without breaking upstream
+	// validators.
+	SigningKeys []SigningKey `mapstructure:"signing_keys" yaml:"signing_keys,omitempty"`
 
 	HeadersEnv string `yaml:",omitempty"`
 	// SetResponseHeaders to set on all proxied requests. Add a 'disable' key map to turn off.
 	SetResponseHeaders map[string]string `yaml:",omitempty"`
 
+	// Branding customizes the pages served by pomerium.
+	Branding *Branding `mapstructure:"branding" yaml:"branding,omitempty"`
+
 	// List of JWT claims to insert as x-pomerium-claim-* headers on proxied requests
 	JWTClaimsHeaders JWTClaimHeaders `mapstructure:"jwt_claims_headers" yaml:"jwt_claims_headers,omitempty"`
 
@@ -187,10 +279,16 @@ type Options struct {
 
 	DefaultUpstreamTimeout time.Duration `mapstructure:"default_upstream_timeout" yaml:"default_upstream_timeout,omitempty"`
 
+	// DrainTimeout is how long in-flight requests may complete after a config change replaces the listeners or
+	// clusters serving them.
+	DrainTimeout time.Duration `mapstructure:"drain_timeout" yaml:"drain_timeout,omitempty"`
+
 	// Address/Port to bind to for prometheus metrics
 	MetricsAddr string `mapstructure:"metrics_address" yaml:"metrics_address,omitempty"`
 	// - require basic auth for prometheus metrics, base64 encoded user:pass string
 	MetricsBasicAuth string `mapstructure:"metrics_basic_auth" yaml:"metrics_basic_auth,omitempty"`
+	// - require a bearer token for prometheus metrics and the debug endpoints
+	MetricsBearerToken string `mapstructure:"metrics_bearer_token" yaml:"metrics_bearer_token,omitempty"`
 	// - TLS options
 	MetricsCertificate        string `mapstructure:"metrics_certificate" yaml:"metrics_certificate,omitempty"`
 	MetricsCertificateKey     string `mapstructure:"metrics_certificate_key" yaml:"metrics_certificate_key,omitempty"`
@@ -205,6 +303,12 @@ type Options struct {
 
 	// Datadog tracing address
 	TracingDatadogAddress string `mapstructure:"tracing_datadog_address" yaml:"tracing_datadog_address,omitempty"`
+	// TracingDatadogService overrides the Datadog service name, which defaults to the pomerium service name.
+	TracingDatadogService string `mapstructure:"tracing_datadog_service" yaml:"tracing_datadog_service,omitempty"`
+	// TracingDatadogEnv is the Datadog env tag of all spans.
+	TracingDatadogEnv string `mapstructure:"tracing_datadog_env" yaml:"tracing_datadog_env,omitempty"`
+	// TracingDatadogTags are added to all spans.
+	TracingDatadogTags map[string]string `mapstructure:"tracing_datadog_tags" yaml:"tracing_datadog_tags,omitempty"`
 
 	//  Jaeger
 	//
@@ -221,6 +325,24 @@ type Options struct {
 	TracingJaegerAgentEndpoint string `mapstructure:"tracing_jaeger_agent_endpoint" yaml:"tracing_jaeger_agent_endpoint,omitempty"`
 	ZipkinEndpoint             string `mapstructure:"tracing_zipkin_endpoint" yaml:"tracing_zipkin_endpoint"`
 
+	// OpenTelemetry
+	//
+	// TracingOTLPEndpoint is the base URL of the OTLP/HTTP receiver of an OpenTelemetry collector.
+	// Example: http://otel-collector:4318
+	TracingOTLPEndpoint string `mapstructure:"tracing_otlp_endpoint" yaml:"tracing_otlp_endpoint,omitempty"`
+	// MetricsOTLPEndpoint is the base URL of the OTLP/HTTP receiver metrics are pushed to.
+	MetricsOTLPEndpoint string `mapstructure:"metrics_otlp_endpoint" yaml:"metrics_otlp_endpoint,omitempty"`
+	// MetricsOTLPInterval is how often metrics are pushed.
+	MetricsOTLPInterval time.Duration `mapstructure:"metrics_otlp_interval" yaml:"metrics_otlp_interval,omitempty"`
+	// OTLPHeaders are added to every request sent to the collector, for example for authentication.
+	OTLPHeaders map[string]string `mapstructure:"otlp_headers" yaml:"otlp_headers,omitempty"`
+	// OTLPResourceAttributes are added to the resource of all exported spans and metrics.
+	OTLPResourceAttributes map[string]string `mapstructure:"otlp_resource_attributes" yaml:"otlp_resource_attributes,omitempty"`
+
+	// TracingSampler is the sampler used to decide which traces are sampled: always, never or
+	// probability, which samples tracing_sample_rate of traces.
+	TracingSampler string `mapstructure:"tracing_sampler" yaml:"tracing_sampler,omitempty"`
+
 	// GRPC Service Settings
 
 	// GRPCAddr specifies the host and port on which the server should serve
@@ -231,9 +353,50 @@ type Options struct {
 	// If running in all-in-one mode, defaults to true.
 	GRPCInsecure bool `mapstructure:"grpc_insecure" yaml:"grpc_insecure,omitempty"`
 
+	// GRPCClientCertificate is the certificate presented to the gRPC APIs of the other services. Its common
+	// name is the name of the service, such as "proxy".
+	GRPCClientCertificate        string `mapstructure:"grpc_client_certificate" yaml:"grpc_client_certificate,omitempty"`
+	GRPCClientCertificateKey     string `mapstructure:"grpc_client_certificate_key" yaml:"grpc_client_certificate_key,omitempty"`
+	GRPCClientCertificateFile    string `mapstructure:"grpc_client_certificate_file" yaml:"grpc_client_certificate_file,omitempty"`
+	GRPCClientCertificateKeyFile string `mapstructure:"grpc_client_certificate_key_file" yaml:"grpc_client_certificate_key_file,omitempty"`
+	// GRPCClientCA is the certificate authority the client certificates of the other services are verified
+	// against. When set, the gRPC listener requires client certificates, and the databroker only allows each
+	// service the methods and record types it needs.
+	GRPCClientCA     string `mapstructure:"grpc_client_ca" yaml:"grpc_client_ca,omitempty"`
+	GRPCClientCAFile string `mapstructure:"grpc_client_ca_file" yaml:"grpc_client_ca_file,omitempty"`
+
+	// InternalCA enables a certificate authority run by the databroker, which issues the short-lived
+	// certificates the services use to authenticate to each other instead of static gRPC certificates.
+	InternalCA bool `mapstructure:"internal_ca" yaml:"internal_ca,omitempty"`
+	// InternalCAKey is the base64 encoded PEM private key of the internal CA. It's only given to the
+	// databroker, the other services request their certificates from it.
+	InternalCAKey     string `mapstructure:"internal_ca_key" yaml:"internal_ca_key,omitempty"`
+	InternalCAKeyFile string `mapstructure:"internal_ca_key_file" yaml:"internal_ca_key_file,omitempty"`
+	// internalCAPEM is the PEM encoded internal CA certificate, internalCertificate the certificate it issued
+	// to this service, and internalCARefreshAt is when the options should be loaded again to renew it.
+	internalCAPEM       []byte
+	internalCertificate *tls.Certificate
+	internalCARefreshAt time.Time
+
 	GRPCClientTimeout       time.Duration `mapstructure:"grpc_client_timeout" yaml:"grpc_client_timeout,omitempty"`
 	GRPCClientDNSRoundRobin bool          `mapstructure:"grpc_client_dns_roundrobin" yaml:"grpc_client_dns_roundrobin,omitempty"`
 
+	// GRPCClientPoolSize is the number of connections made to each gRPC service address.
+	GRPCClientPoolSize int `mapstructure:"grpc_client_pool_size" yaml:"grpc_client_pool_size,omitempty"`
+	// GRPCClientKeepaliveTime is the time after which an idle gRPC client connection is pinged.
+	GRPCClientKeepaliveTime time.Duration `mapstructure:"grpc_client_keepalive_time" yaml:"grpc_client_keepalive_time,omitempty"`
+	// GRPCClientKeepaliveTimeout is how long to wait for a keepalive ping to be acknowledged.
+	GRPCClientKeepaliveTimeout time.Duration `mapstructure:"grpc_client_keepalive_timeout" yaml:"grpc_client_keepalive_timeout,omitempty"`
+	// GRPCClientBackoffMaxDelay is the maximum delay between attempts to reconnect to a gRPC service.
+	GRPCClientBackoffMaxDelay time.Duration `mapstructure:"grpc_client_backoff_max_delay" yaml:"grpc_client_backoff_max_delay,omitempty"`
+	// GRPCClientCircuitBreakerThreshold is the number of consecutive failed gRPC calls after which calls fail
+	// immediately for GRPCClientCircuitBreakerTimeout.
+	GRPCClientCircuitBreakerThreshold int           `mapstructure:"grpc_client_circuit_breaker_threshold" yaml:"grpc_client_circuit_breaker_threshold,omitempty"`
+	GRPCClientCircuitBreakerTimeout   time.Duration `mapstructure:"grpc_client_circuit_breaker_timeout" yaml:"grpc_client_circuit_breaker_timeout,omitempty"`
+
+	// EnvoyOverrides are snippets of Envoy configuration merged with the generated configuration.
+	EnvoyOverrides *EnvoyOverrides `mapstructure:"envoy_overrides" yaml:"-" json:"-"`
+
 	// GRPCServerMaxConnectionAge sets MaxConnectionAge in the grpc ServerParameters used to create GRPC Services
 	GRPCServerMaxConnectionAge time.Duration `mapstructure:"grpc_server_max_connection_age" yaml:"grpc_server_max_connection_age,omitempty"`
 	// GRPCServerMaxConnectionAgeGrace sets MaxConnectionAgeGrace in the grpc ServerParameters used to create GRPC Services
@@ -246,19 +409,63 @@ type Options struct {
 	// with an external server or service. Pomerium can be configured to accept
 	// these requests with this switch
 	ForwardAuthURLString string `mapstructure:"forward_auth_url" yaml:"forward_auth_url,omitempty"`
+	// ForwardAuthResponseHeaders are the headers returned by the forward-auth verify endpoint, so that the
+	// fronting proxy can copy them to the upstream. Defaults to the JWT assertion and the JWT claim headers.
+	ForwardAuthResponseHeaders []string `mapstructure:"forward_auth_response_headers" yaml:"forward_auth_response_headers,omitempty"`
+	// ForwardAuthTrustedProxies are the CIDRs of the proxies in front of the forward-auth endpoint. When set,
+	// forwarded headers are only used from these proxies, and the client IP is the last untrusted address in
+	// the forwarded headers.
+	ForwardAuthTrustedProxies []string `mapstructure:"forward_auth_trusted_proxies" yaml:"forward_auth_trusted_proxies,omitempty"`
+	// forwardAuthTrustedProxyNets are the parsed ForwardAuthTrustedProxies, set by Validate.
+	forwardAuthTrustedProxyNets []*net.IPNet
+	// ForwardAuthMethodHeader is the header the trusted proxies send the method of the original request in,
+	// such as X-Forwarded-Method or X-Original-Method. It's ignored unless trusted proxies are set.
+	ForwardAuthMethodHeader string `mapstructure:"forward_auth_method_header" yaml:"forward_auth_method_header,omitempty"`
 
 	// DataBrokerURLString is the routable destination of the databroker service's gRPC endpiont.
 	DataBrokerURLString  string   `mapstructure:"databroker_service_url" yaml:"databroker_service_url,omitempty"`
 	DataBrokerURLStrings []string `mapstructure:"databroker_service_urls" yaml:"databroker_service_urls,omitempty"`
 	// DataBrokerStorageType is the storage backend type that databroker will use.
-	// Supported type: memory, redis
+	// Supported type: memory, redis, plugin
 	DataBrokerStorageType string `mapstructure:"databroker_storage_type" yaml:"databroker_storage_type,omitempty"`
 	// DataBrokerStorageConnectionString is the data source name for storage backend.
 	DataBrokerStorageConnectionString string `mapstructure:"databroker_storage_connection_string" yaml:"databroker_storage_connection_string,omitempty"`
+	DataBrokerStorageCert             string `mapstructure:"databroker_storage_cert" yaml:"databroker_storage_cert,omitempty"`
+	DataBrokerStorageCertKey          string `mapstructure:"databroker_storage_key" yaml:"databroker_storage_key,omitempty"`
 	DataBrokerStorageCertFile         string `mapstructure:"databroker_storage_cert_file" yaml:"databroker_storage_cert_file,omitempty"`
 	DataBrokerStorageCertKeyFile      string `mapstructure:"databroker_storage_key_file" yaml:"databroker_storage_key_file,omitempty"`
+	DataBrokerStorageCA               string `mapstructure:"databroker_storage_ca" yaml:"databroker_storage_ca,omitempty"`
 	DataBrokerStorageCAFile           string `mapstructure:"databroker_storage_ca_file" yaml:"databroker_storage_ca_file,omitempty"`
 	DataBrokerStorageCertSkipVerify   bool   `mapstructure:"databroker_storage_tls_skip_verify" yaml:"databroker_storage_tls_skip_verify,omitempty"`
+	// DataBrokerStorageTLS enables TLS for the storage connection, even if the connection string doesn't.
+	DataBrokerStorageTLS bool `mapstructure:"databroker_storage_tls" yaml:"databroker_storage_tls,omitempty"`
+	// DataBrokerStorageUsername and DataBrokerStoragePassword are used to authenticate to the storage backend,
+	// overriding those of the connection string.
+	DataBrokerStorageUsername string `mapstructure:"databroker_storage_username" yaml:"databroker_storage_username,omitempty"`
+	DataBrokerStoragePassword string `mapstructure:"databroker_storage_password" yaml:"databroker_storage_password,omitempty"`
+	// DataBrokerStorageDB is the database index of the storage backend, overriding that of the connection string
+	// if non-zero.
+	DataBrokerStorageDB int `mapstructure:"databroker_storage_db" yaml:"databroker_storage_db,omitempty"`
+	// DataBrokerStorageSentinelMaster is the name of the master monitored by redis sentinel, overriding that of
+	// the connection string.
+	DataBrokerStorageSentinelMaster string `mapstructure:"databroker_storage_sentinel_master" yaml:"databroker_storage_sentinel_master,omitempty"`
+	// DataBrokerStorageSnapshotFile is the file the in-memory storage is restored from on startup, and saved to
+	// every DataBrokerStorageSnapshotInterval. If empty, in-memory storage isn't saved.
+	DataBrokerStorageSnapshotFile     string        `mapstructure:"databroker_storage_snapshot_file" yaml:"databroker_storage_snapshot_file,omitempty"`
+	DataBrokerStorageSnapshotInterval time.Duration `mapstructure:"databroker_storage_snapshot_interval" yaml:"databroker_storage_snapshot_interval,omitempty"`
+	// DataBrokerStoragePlugin is the path of the executable serving the storage backend when the storage type
+	// is plugin. The connection string is passed to it.
+	DataBrokerStoragePlugin string `mapstructure:"databroker_storage_plugin" yaml:"databroker_storage_plugin,omitempty"`
+
+	// DataBrokerCDCURL is the URL of a NATS (nats://) or Kafka (kafka://) server that databroker record
+	// changes are published to. If empty, record changes are not published.
+	DataBrokerCDCURL string `mapstructure:"databroker_cdc_url" yaml:"databroker_cdc_url,omitempty"`
+	// DataBrokerCDCTopic is the Kafka topic or NATS subject that record changes are published to.
+	DataBrokerCDCTopic string `mapstructure:"databroker_cdc_topic" yaml:"databroker_cdc_topic,omitempty"`
+	// DataBrokerCDCRecordTypes restricts the published record changes to the given record types.
+	DataBrokerCDCRecordTypes []string `mapstructure:"databroker_cdc_record_types" yaml:"databroker_cdc_record_types,omitempty"`
+	// DataBrokerCDCFormat is the format of the published record changes, record or cloudevents.
+	DataBrokerCDCFormat string `mapstructure:"databroker_cdc_format" yaml:"databroker_cdc_format,omitempty"`
 
 	// ClientCA is the base64-encoded certificate authority to validate client mTLS certificates against.
 	ClientCA string `mapstructure:"client_ca" yaml:"client_ca,omitempty"`
@@ -268,6 +475,15 @@ type Options struct {
 	ClientCRL string `mapstructure:"client_crl" yaml:"client_crl,omitempty"`
 	// ClientCRLFile points to a file that contains the certificate revocation list for client mTLS certificates.
 	ClientCRLFile string `mapstructure:"client_crl_file" yaml:"client_crl_file,omitempty"`
+	// ClientCRLURL is the URL of a certificate revocation list for client mTLS certificates. It is fetched
+	// periodically by the authorize service.
+	ClientCRLURL string `mapstructure:"client_crl_url" yaml:"client_crl_url,omitempty"`
+	// ClientOCSP enables checking the revocation status of client mTLS certificates with the OCSP responder
+	// listed in the certificate.
+	ClientOCSP bool `mapstructure:"client_ocsp" yaml:"client_ocsp,omitempty"`
+	// ClientRevocationSoftFail accepts client mTLS certificates whose revocation status can't be determined,
+	// because the CRL URL or OCSP responder is unavailable.
+	ClientRevocationSoftFail bool `mapstructure:"client_revocation_soft_fail" yaml:"client_revocation_soft_fail,omitempty"`
 
 	// GoogleCloudServerlessAuthenticationServiceAccount is the service account to use for GCP serverless authentication.
 	// If unset, the GCP metadata server will be used to query for identity tokens.
@@ -286,6 +502,9 @@ type Options struct {
 	// XffNumTrustedHops determines the trusted client address from x-forwarded-for addresses.
 	// see https://www.envoyproxy.io/docs/envoy/latest/configuration/http/http_conn_man/headers.html?highlight=xff_num_trusted_hops#x-forwarded-for
 	XffNumTrustedHops uint32 `mapstructure:"xff_num_trusted_hops" yaml:"xff_num_trusted_hops,omitempty" json:"xff_num_trusted_hops,omitempty"`
+	// RequestIDPolicy determines whether the x-request-id sent by clients is kept or replaced: generate,
+	// trust or override. Defaults to generate.
+	RequestIDPolicy string `mapstructure:"request_id_policy" yaml:"request_id_policy,omitempty" json:"request_id_policy,omitempty"`
 
 	// Envoy bootstrap admin options. These do not support dynamic updates.
 	EnvoyAdminAccessLogPath string `mapstructure:"envoy_admin_access_log_path" yaml:"envoy_admin_access_log_path"`
@@ -295,6 +514,55 @@ type Options struct {
 	// ProgrammaticRedirectDomainWhitelist restricts the allowed redirect URLs when using programmatic login.
 	ProgrammaticRedirectDomainWhitelist []string `mapstructure:"programmatic_redirect_domain_whitelist" yaml:"programmatic_redirect_domain_whitelist,omitempty" json:"programmatic_redirect_domain_whitelist,omitempty"` //nolint
 
+	// RedirectAllowlist is a list of additional hostnames that sign in and sign out flows may redirect to.
+	// Entries starting with "*." match any subdomain.
+	RedirectAllowlist []string `mapstructure:"redirect_allowlist" yaml:"redirect_allowlist,omitempty"`
+
+	// KubernetesController enables generating routes from Kubernetes Ingress and Policy resources.
+	KubernetesController bool `mapstructure:"kubernetes_controller" yaml:"kubernetes_controller,omitempty"`
+	// KubernetesIngressClass is the ingress class handled by the controller. Defaults to "pomerium".
+	KubernetesIngressClass string `mapstructure:"kubernetes_ingress_class" yaml:"kubernetes_ingress_class,omitempty"`
+	// KubernetesNamespaces restricts the controller to the given namespaces. All namespaces are watched
+	// when empty.
+	KubernetesNamespaces []string `mapstructure:"kubernetes_namespaces" yaml:"kubernetes_namespaces,omitempty"`
+	// KubernetesAllowedAnnotations are the route settings ingress annotations may set in addition to the
+	// safe ones, such as allow_public_unauthenticated_access.
+	KubernetesAllowedAnnotations []string `mapstructure:"kubernetes_allowed_annotations" yaml:"kubernetes_allowed_annotations,omitempty"`
+
+	// ConsulAddress is the address of the Consul agent used to load configuration from Consul KV,
+	// e.g. http://127.0.0.1:8500.
+	ConsulAddress string `mapstructure:"consul_address" yaml:"consul_address,omitempty"`
+	// ConsulKey is the Consul KV key holding the configuration. Its value uses the config file format
+	// and is merged over the local config file.
+	ConsulKey string `mapstructure:"consul_key" yaml:"consul_key,omitempty"`
+	// ConsulToken is the ACL token used for Consul requests.
+	ConsulToken string `mapstructure:"consul_token" yaml:"consul_token,omitempty"`
+	// ConsulTokenFile is a file containing the ACL token used for Consul requests.
+	ConsulTokenFile string `mapstructure:"consul_token_file" yaml:"consul_token_file,omitempty"`
+
+	// VaultAddress is the address of the Vault server used to load secrets, e.g. https://vault:8200.
+	VaultAddress string `mapstructure:"vault_address" yaml:"vault_address,omitempty"`
+	// VaultToken is the token used for Vault requests.
+	VaultToken string `mapstructure:"vault_token" yaml:"vault_token,omitempty"`
+	// VaultTokenFile is a file containing the token used for Vault requests, such as a Vault agent sink.
+	VaultTokenFile string `mapstructure:"vault_token_file" yaml:"vault_token_file,omitempty"`
+	// VaultSecrets maps settings to KV version 2 secrets in the form <mount>/<path>#<key>.
+	VaultSecrets map[string]string `mapstructure:"vault_secrets" yaml:"vault_secrets,omitempty"`
+	// VaultPKIRole is a PKI secrets engine role in the form <mount>/<role> used to issue the server
+	// certificate.
+	VaultPKIRole string `mapstructure:"vault_pki_role" yaml:"vault_pki_role,omitempty"`
+	// VaultPKICommonName is the common name of the certificate issued from VaultPKIRole.
+	VaultPKICommonName string `mapstructure:"vault_pki_common_name" yaml:"vault_pki_common_name,omitempty"`
+	// VaultPKIAltNames are additional DNS names of the certificate issued from VaultPKIRole.
+	VaultPKIAltNames []string `mapstructure:"vault_pki_alt_names" yaml:"vault_pki_alt_names,omitempty"`
+	// vaultRefreshAt is when secrets loaded from Vault should be loaded again.
+	vaultRefreshAt time.Time
+	// vaultSecrets are the values loaded from Vault, which are reused by options merged from these options.
+	vaultSecrets *vaultSecrets
+	// resolvedSecrets are the values of the secret references, which are reused by options merged from
+	// these options.
+	resolvedSecrets map[string]string
+
 	// CodecType is the codec to use for downstream connections.
 	CodecType CodecType `mapstructure:"codec_type" yaml:"codec_type"`
 
@@ -317,6 +585,7 @@ var defaultOptions = Options{
 	CookieExpire:           14 * time.Hour,
 	CookieName:             "_pomerium",
 	DefaultUpstreamTimeout: 30 * time.Second,
+	DrainTimeout:           30 * time.Second,
 	SetResponseHeaders: map[string]string{
 		"X-Frame-Options":           "SAMEORIGIN",
 		"X-XSS-Protection":          "1; mode=block",
@@ -342,6 +611,8 @@ var defaultOptions = Options{
 		Folder: dataDir(),
 	},
 	DataBrokerStorageType:               "memory",
+	DataBrokerStorageSnapshotInterval:   time.Minute,
+	DataBrokerCDCTopic:                  "pomerium.databroker",
 	SkipXffAppend:                       false,
 	XffNumTrustedHops:                   0,
 	EnvoyAdminAccessLogPath:             os.DevNull,
@@ -374,6 +645,31 @@ func newOptionsFromConfig(configFile string) (*Options, error) {
 }
 
 func optionsFromViper(configFile string) (*Options, error) {
+	return optionsFromViperWithData(configFile, nil, "", nil)
+}
+
+// MergeConfigData builds new options from the same config file and environment as o, with data merged
+// over the config file. data uses the config file format given by configType, such as "yaml" or "json".
+func (o *Options) MergeConfigData(data []byte, configType string) (*Options, error) {
+	var configFile string
+	if o.viper != nil {
+		configFile = o.viper.ConfigFileUsed()
+	}
+	merged, err := optionsFromViperWithData(configFile, data, configType, o)
+	if err != nil {
+		return nil, err
+	}
+	serviceName := telemetry.ServiceName(merged.Services)
+	metrics.AddPolicyCountCallback(serviceName, func() int64 {
+		return int64(len(merged.GetAllPolicies()))
+	})
+
+	return merged, nil
+}
+
+// optionsFromViperWithData builds options from the config file and environment, with data merged over the
+// config file. Secrets resolved or loaded from Vault for prev, if it isn't nil, are reused.
+func optionsFromViperWithData(configFile string, data []byte, configType string, prev *Options) (*Options, error) {
 	// start a copy of the default options
 	o := NewDefaultOptions()
 	v := o.viper
@@ -390,6 +686,23 @@ func optionsFromViper(configFile string) (*Options, error) {
 		}
 	}
 
+	var dataViper *viper.Viper
+	if data != nil {
+		v.SetConfigType(configType)
+		if err := v.MergeConfig(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("failed to merge config: %w", err)
+		}
+		dataViper = viper.New()
+		dataViper.SetConfigType(configType)
+		if err := dataViper.ReadConfig(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("failed to merge config: %w", err)
+		}
+	}
+
+	if err := expandConfigValues(v, dataViper); err != nil {
+		return nil, err
+	}
+
 	var metadata mapstructure.Metadata
 	if err := v.Unmarshal(o, ViperPolicyHooks, func(c *mapstructure.DecoderConfig) { c.Metadata = &metadata }); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
@@ -399,6 +712,18 @@ func optionsFromViper(configFile string) (*Options, error) {
 	// This is necessary because v.Unmarshal will overwrite .viper field.
 	o.viper = v
 
+	if err := o.resolveSecrets(context.Background(), prev); err != nil {
+		return nil, err
+	}
+
+	if err := o.loadVaultSecrets(context.Background(), prev); err != nil {
+		return nil, err
+	}
+
+	if err := o.loadInternalCertificate(context.Background()); err != nil {
+		return nil, err
+	}
+
 	if err := o.Validate(); err != nil {
 		return nil, fmt.Errorf("validation error %w", err)
 	}
@@ -425,18 +750,31 @@ func (o *Options) parsePolicy() error {
 	if err := o.viper.UnmarshalKey("policy", &policies, ViperPolicyHooks); err != nil {
 		return err
 	}
+	if o.PolicyDir != "" {
+		dirPolicies, err := loadPolicyDir(o.PolicyDir, policies)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, dirPolicies...)
+	}
 	if len(policies) != 0 {
 		o.Policies = policies
 	}
 	// Finish initializing policies
 	for i := range o.Policies {
 		p := &o.Policies[i]
+		if err := p.applyPolicySets(o.PolicySets); err != nil {
+			return err
+		}
 		if err := p.Validate(); err != nil {
 			return err
 		}
 	}
 	for i := range o.AdditionalPolicies {
 		p := &o.AdditionalPolicies[i]
+		if err := p.applyPolicySets(o.PolicySets); err != nil {
+			return err
+		}
 		if err := p.Validate(); err != nil {
 			return err
 		}
@@ -477,7 +815,7 @@ func (o *Options) parseHeaders(ctx context.Context) error {
 	}
 
 	if o.viperIsSet("headers") {
-		log.Warn(ctx).Msg("config: headers has been renamed to set_response_headers, it will be removed in v0.16")
+		deprecation.Record(ctx, deprecation.HeadersOption)
 	}
 
 	// option was renamed from `headers` to `set_response_headers`. Both config settings are supported.
@@ -541,10 +879,30 @@ func (o *Options) Validate() error {
 
 	switch o.DataBrokerStorageType {
 	case StorageInMemoryName:
+		if o.DataBrokerStorageSnapshotFile != "" && o.DataBrokerStorageSnapshotInterval <= 0 {
+			return errors.New("config: databroker storage snapshot interval must be positive")
+		}
+		// snapshots are encrypted, so they can't be restored with a shared secret generated at runtime
+		if o.DataBrokerStorageSnapshotFile != "" && o.SharedKey == "" {
+			return errors.New("config: databroker storage snapshots require a shared secret")
+		}
 	case StorageRedisName:
+		if o.DataBrokerStorageSnapshotFile != "" {
+			return errors.New("config: databroker storage snapshots are only supported by in-memory storage")
+		}
 		if o.DataBrokerStorageConnectionString == "" {
 			return errors.New("config: missing databroker storage backend dsn")
 		}
+		if o.DataBrokerStorageDB < 0 {
+			return errors.New("config: databroker storage db must not be negative")
+		}
+	case StoragePluginName:
+		if o.DataBrokerStorageSnapshotFile != "" {
+			return errors.New("config: databroker storage snapshots are only supported by in-memory storage")
+		}
+		if o.DataBrokerStoragePlugin == "" {
+			return errors.New("config: missing databroker storage plugin")
+		}
 	default:
 		return errors.New("config: unknown databroker storage backend type")
 	}
@@ -561,6 +919,29 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if o.ConsulAddress != "" {
+		_, err := urlutil.ParseAndValidateURL(o.ConsulAddress)
+		if err != nil {
+			return fmt.Errorf("config: bad consul_address %s : %w", o.ConsulAddress, err)
+		}
+		if o.ConsulKey == "" {
+			return errors.New("config: consul_key is required when consul_address is set")
+		}
+		if o.ConsulToken != "" && o.ConsulTokenFile != "" {
+			return errors.New("config: specified both `consul_token` and `consul_token_file`")
+		}
+	}
+
+	if o.VaultAddress != "" {
+		_, err := urlutil.ParseAndValidateURL(o.VaultAddress)
+		if err != nil {
+			return fmt.Errorf("config: bad vault_address %s : %w", o.VaultAddress, err)
+		}
+		if o.VaultToken != "" && o.VaultTokenFile != "" {
+			return errors.New("config: specified both `vault_token` and `vault_token_file`")
+		}
+	}
+
 	if o.SignOutRedirectURLString != "" {
 		_, err := urlutil.ParseAndValidateURL(o.SignOutRedirectURLString)
 		if err != nil {
@@ -582,6 +963,32 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if o.DataBrokerCDCURL != "" {
+		u, err := url.Parse(o.DataBrokerCDCURL)
+		if err != nil {
+			return fmt.Errorf("config: bad databroker cdc url %s : %w", o.DataBrokerCDCURL, err)
+		}
+		switch u.Scheme {
+		case "nats", "kafka":
+			if o.DataBrokerCDCTopic == "" {
+				return errors.New("config: databroker cdc topic is required")
+			}
+		case "http", "https":
+		default:
+			return fmt.Errorf("config: unsupported databroker cdc url scheme: %s", u.Scheme)
+		}
+	}
+
+	if err := ValidateRequestIDPolicy(o.RequestIDPolicy); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+
+	switch o.DataBrokerCDCFormat {
+	case "", "record", "cloudevents":
+	default:
+		return fmt.Errorf("config: unsupported databroker cdc format: %s", o.DataBrokerCDCFormat)
+	}
+
 	if o.ForwardAuthURLString != "" {
 		_, err := urlutil.ParseAndValidateURL(o.ForwardAuthURLString)
 		if err != nil {
@@ -589,6 +996,18 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	o.forwardAuthTrustedProxyNets = nil
+	for _, cidr := range o.ForwardAuthTrustedProxies {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("config: invalid forward_auth_trusted_proxies cidr %q: %w", cidr, err)
+		}
+		o.forwardAuthTrustedProxyNets = append(o.forwardAuthTrustedProxyNets, ipNet)
+	}
+	if o.ForwardAuthMethodHeader != "" && len(o.ForwardAuthTrustedProxies) == 0 {
+		return errors.New("config: forward_auth_method_header requires forward_auth_trusted_proxies")
+	}
+
 	if o.PolicyFile != "" {
 		return errors.New("config: policy file setting is deprecated")
 	}
@@ -629,6 +1048,13 @@ func (o *Options) Validate() error {
 		hasCert = true
 	}
 
+	if o.DataBrokerStorageCert != "" || o.DataBrokerStorageCertKey != "" {
+		_, err := cryptutil.CertificateFromBase64(o.DataBrokerStorageCert, o.DataBrokerStorageCertKey)
+		if err != nil {
+			return fmt.Errorf("config: bad databroker cert base64: %w", err)
+		}
+	}
+
 	if o.DataBrokerStorageCertFile != "" || o.DataBrokerStorageCertKeyFile != "" {
 		_, err := cryptutil.CertificateFromFile(o.DataBrokerStorageCertFile, o.DataBrokerStorageCertKeyFile)
 		if err != nil {
@@ -636,6 +1062,12 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if o.DataBrokerStorageCA != "" {
+		if _, err := base64.StdEncoding.DecodeString(o.DataBrokerStorageCA); err != nil {
+			return fmt.Errorf("config: bad databroker ca base64: %w", err)
+		}
+	}
+
 	if o.DataBrokerStorageCAFile != "" {
 		if _, err := os.Stat(o.DataBrokerStorageCAFile); err != nil {
 			return fmt.Errorf("config: bad databroker ca file: %w", err)
@@ -669,13 +1101,90 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if o.ClientCRLURL != "" {
+		_, err := urlutil.ParseAndValidateURL(o.ClientCRLURL)
+		if err != nil {
+			return fmt.Errorf("config: bad client crl url %s : %w", o.ClientCRLURL, err)
+		}
+	}
+
+	if err := o.validateSigningKeys(); err != nil {
+		return err
+	}
+
+	if err := o.validateListeners(); err != nil {
+		return err
+	}
+
+	if err := o.validateRouteCookies(); err != nil {
+		return err
+	}
+
+	if err := o.ClaimTransforms.validate(); err != nil {
+		return fmt.Errorf("config: invalid claim_transforms: %w", err)
+	}
+
+	if o.PolicyBundle != nil {
+		if err := o.PolicyBundle.validate(); err != nil {
+			return fmt.Errorf("config: invalid policy_bundle: %w", err)
+		}
+	}
+
+	if o.DecisionHook != nil {
+		if err := o.DecisionHook.validate(); err != nil {
+			return fmt.Errorf("config: invalid decision_hook: %w", err)
+		}
+	}
+
+	if o.SignInRateLimit != nil {
+		if err := o.SignInRateLimit.validate(); err != nil {
+			return fmt.Errorf("config: invalid sign_in_rate_limit: %w", err)
+		}
+	}
+
+	if o.SMTP != nil {
+		if err := o.SMTP.validate(); err != nil {
+			return fmt.Errorf("config: invalid smtp: %w", err)
+		}
+	} else {
+		for _, p := range o.GetAllPolicies() {
+			if p.AccessRequests != nil && len(p.AccessRequests.Approvers) > 0 {
+				return fmt.Errorf("config: smtp is required to notify access request approvers for %s", p.From)
+			}
+		}
+	}
+
 	// if no service account was defined, there should not be any policies that
 	// assert group membership (except for azure which can be derived from the client
-	// id, secret and provider url)
-	if o.ServiceAccount == "" && o.Provider != "azure" {
+	// id, secret and provider url, or when groups come from an id token claim)
+	if o.ServiceAccount == "" && o.GroupsClaim == "" && o.Provider != "azure" {
 		for _, p := range o.GetAllPolicies() {
 			if len(p.AllowedGroups) != 0 {
-				return fmt.Errorf("config: `allowed_groups` requires `idp_service_account`")
+				return fmt.Errorf("config: `allowed_groups` requires `idp_service_account` or `idp_groups_claim`")
+			}
+		}
+	}
+
+	if o.SPIREAgentSocket == "" {
+		for _, p := range o.GetAllPolicies() {
+			if p.TLSSPIFFEClientCertificate || p.TLSUpstreamSPIFFEID != "" {
+				return fmt.Errorf("config: `tls_spiffe_client_certificate` and `tls_upstream_spiffe_id` require `spire_agent_socket`")
+			}
+		}
+	}
+
+	if o.ProviderURL == "" {
+		for _, p := range o.GetAllPolicies() {
+			if p.ClientCredentials != nil && p.ClientCredentials.Issuer == "" {
+				return fmt.Errorf("config: `client_credentials` requires an `issuer` or `idp_provider_url`")
+			}
+		}
+	}
+
+	if o.ClientCA == "" && o.ClientCAFile == "" {
+		for _, p := range o.GetAllPolicies() {
+			if p.TLSDownstreamClientCA == "" && (len(p.AllowedClientCertSANs) != 0 || len(p.AllowedClientCertIssuers) != 0) {
+				return fmt.Errorf("config: `allowed_client_cert_sans` and `allowed_client_cert_issuers` require `client_ca` or `tls_downstream_client_ca`")
 			}
 		}
 	}
@@ -688,6 +1197,13 @@ func (o *Options) Validate() error {
 			"`insecure_server` or manually provided certificates to start")
 	}
 
+	if o.CodecType == CodecTypeHTTP3 && o.InsecureServer {
+		return fmt.Errorf("config: codec_type http3 requires TLS, and can't be used with `insecure_server`")
+	}
+	if _, ok := urlutil.UnixSocketPath(o.Addr); ok && o.CodecType == CodecTypeHTTP3 {
+		return fmt.Errorf("config: codec_type http3 can't be used with a unix socket address")
+	}
+
 	switch o.Provider {
 	case azure.Name, github.Name, gitlab.Name, google.Name, okta.Name, onelogin.Name:
 		if len(o.Scopes) > 0 {
@@ -696,10 +1212,59 @@ func (o *Options) Validate() error {
 	default:
 	}
 
+	if err := sink.Validate(o.LogOutput); err != nil {
+		return fmt.Errorf("config: invalid log_output: %w", err)
+	}
+	if err := sink.Validate(o.AccessLogOutput); err != nil {
+		return fmt.Errorf("config: invalid access_log_output: %w", err)
+	}
+	if o.LogFileMaxSize < 0 || o.LogFileMaxAge < 0 || o.LogFileMaxBackups < 0 {
+		return errors.New("config: log_file_max_size, log_file_max_age and log_file_max_backups must not be negative")
+	}
+	if o.DrainTimeout < 0 {
+		return errors.New("config: drain_timeout must not be negative")
+	}
+	if o.IdPOutageGracePeriod < 0 {
+		return errors.New("config: idp_outage_grace_period must not be negative")
+	}
+	if o.EnvoyOverrides != nil {
+		if err := o.EnvoyOverrides.validate(); err != nil {
+			return err
+		}
+	}
+	if o.Branding != nil {
+		if err := o.Branding.validate(); err != nil {
+			return fmt.Errorf("config: invalid branding: %w", err)
+		}
+	}
+
+	if o.GRPCClientPoolSize < 0 || o.GRPCClientKeepaliveTime < 0 || o.GRPCClientKeepaliveTimeout < 0 ||
+		o.GRPCClientBackoffMaxDelay < 0 || o.GRPCClientCircuitBreakerThreshold < 0 || o.GRPCClientCircuitBreakerTimeout < 0 {
+		return errors.New("config: grpc_client_pool_size, grpc_client_keepalive_time, grpc_client_keepalive_timeout, " +
+			"grpc_client_backoff_max_delay, grpc_client_circuit_breaker_threshold and " +
+			"grpc_client_circuit_breaker_timeout must not be negative")
+	}
+
+	for _, field := range o.GetAuthorizeLogFields() {
+		if err := field.Validate(); err != nil {
+			return fmt.Errorf("config: invalid authorize_log_fields: %w", err)
+		}
+	}
+
+	if _, err := log.ParseAuthorizeLogFormat(o.AuthorizeLogFormat); err != nil {
+		return fmt.Errorf("config: invalid authorize_log_format: %w", err)
+	}
+
 	if err := ValidateDNSLookupFamily(o.DNSLookupFamily); err != nil {
 		return fmt.Errorf("config: %w", err)
 	}
 
+	if o.AutocertOptions.Enable {
+		if err := ValidateAutocertStorage(o.AutocertOptions.Storage, o.Services); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+
 	if o.MetricsAddr != "" {
 		if err := ValidateMetricsAddress(o.MetricsAddr); err != nil {
 			return fmt.Errorf("config: invalid metrics_addr: %w", err)
@@ -732,6 +1297,47 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	if _, err := o.GetGRPCClientCertificate(); err != nil {
+		return fmt.Errorf("config: invalid grpc_client_certificate: %w", err)
+	}
+
+	if o.InternalCA && (IsAll(o.Services) || o.GetGRPCInsecure()) {
+		return fmt.Errorf("config: internal_ca requires TLS, and can't be used with grpc_insecure or in all-in-one mode")
+	}
+	if o.InternalCAKey != "" || o.InternalCAKeyFile != "" {
+		if !o.InternalCA || !IsDataBroker(o.Services) {
+			return fmt.Errorf("config: internal_ca_key must only be set on the databroker, when internal_ca is enabled")
+		}
+		key, err := o.GetInternalCAKey()
+		if err != nil {
+			return fmt.Errorf("config: invalid internal_ca_key: %w", err)
+		}
+		if _, err := internalca.ParseKey(key); err != nil {
+			return fmt.Errorf("config: invalid internal_ca_key: %w", err)
+		}
+	} else if o.InternalCA && IsDataBroker(o.Services) {
+		return fmt.Errorf("config: internal_ca requires internal_ca_key or internal_ca_key_file on the databroker")
+	}
+
+	if o.RequireGRPCClientCertificates() {
+		if o.GetGRPCInsecure() {
+			return fmt.Errorf("config: grpc_client_ca requires TLS, and can't be used with grpc_insecure or in all-in-one mode")
+		}
+		if o.GetGRPCAddr() == o.Addr {
+			return fmt.Errorf("config: grpc_client_ca and internal_ca require a grpc_address different from the address")
+		}
+		if o.GRPCClientCA != "" {
+			if _, err := base64.StdEncoding.DecodeString(o.GRPCClientCA); err != nil {
+				return fmt.Errorf("config: bad grpc_client_ca base64: %w", err)
+			}
+		}
+		if o.GRPCClientCAFile != "" {
+			if _, err := ioutil.ReadFile(o.GRPCClientCAFile); err != nil {
+				return fmt.Errorf("config: bad grpc_client_ca_file: %w", err)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -798,6 +1404,51 @@ func (o *Options) GetForwardAuthURL() (*url.URL, error) {
 	return urlutil.ParseAndValidateURL(rawurl)
 }
 
+// GetForwardAuthResponseHeaders returns the canonical names of the headers returned by the forward-auth
+// verify endpoint. By default, these are the JWT assertion header and the JWT claim headers of any route.
+func (o *Options) GetForwardAuthResponseHeaders() []string {
+	names := o.ForwardAuthResponseHeaders
+	if len(names) == 0 {
+		names = []string{httputil.HeaderPomeriumJWTAssertion}
+		policies := o.GetAllPolicies()
+		if len(policies) == 0 {
+			policies = []Policy{{}}
+		}
+		for _, p := range policies {
+			for k := range o.JWTClaimsHeaders.Merge(p.JWTClaimsHeaders) {
+				names = append(names, k)
+			}
+		}
+	}
+
+	seen := make(map[string]struct{}, len(names))
+	headers := make([]string, 0, len(names))
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+// IsForwardAuthTrustedProxy returns true if the ip is one of the forward-auth trusted proxies. The proxies are
+// parsed by Validate, so it's always false for options which haven't been validated.
+func (o *Options) IsForwardAuthTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range o.forwardAuthTrustedProxyNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetGRPCAddr gets the gRPC address.
 func (o *Options) GetGRPCAddr() string {
 	// to avoid port collision when running on localhost
@@ -815,6 +1466,28 @@ func (o *Options) GetGRPCInsecure() bool {
 	return o.GRPCInsecure
 }
 
+// GetKubernetesIngressClass gets the ingress class handled by the Kubernetes controller.
+func (o *Options) GetKubernetesIngressClass() string {
+	if o.KubernetesIngressClass == "" {
+		return "pomerium"
+	}
+	return o.KubernetesIngressClass
+}
+
+// IsProxyAccessLogEnabled returns true if the requests proxied by envoy are logged, which they aren't for proxy
+// log levels above info.
+func (o *Options) IsProxyAccessLogEnabled() bool {
+	lvl := o.ProxyLogLevel
+	if lvl == "" {
+		lvl = o.LogLevel
+	}
+	switch lvl {
+	case "", "trace", "debug", "info":
+		return true
+	}
+	return false
+}
+
 // GetSignOutRedirectURL gets the SignOutRedirectURL.
 func (o *Options) GetSignOutRedirectURL() (*url.URL, error) {
 	rawurl := o.SignOutRedirectURLString
@@ -836,6 +1509,23 @@ func (o *Options) GetMetricsCertificate() (*tls.Certificate, error) {
 	return nil, nil
 }
 
+// GetGRPCClientCertificate returns the certificate presented to the gRPC APIs of the other services. `nil`
+// will be returned if there is no certificate.
+func (o *Options) GetGRPCClientCertificate() (*tls.Certificate, error) {
+	if o.GRPCClientCertificate != "" && o.GRPCClientCertificateKey != "" {
+		return cryptutil.CertificateFromBase64(o.GRPCClientCertificate, o.GRPCClientCertificateKey)
+	}
+	if o.GRPCClientCertificateFile != "" && o.GRPCClientCertificateKeyFile != "" {
+		return cryptutil.CertificateFromFile(o.GRPCClientCertificateFile, o.GRPCClientCertificateKeyFile)
+	}
+	return o.internalCertificate, nil
+}
+
+// RequireGRPCClientCertificates returns true if the gRPC listener requires client certificates.
+func (o *Options) RequireGRPCClientCertificates() bool {
+	return o.GRPCClientCA != "" || o.GRPCClientCAFile != "" || o.InternalCA
+}
+
 // GetOauthOptions gets the oauth.Options for the given config options.
 func (o *Options) GetOauthOptions() (oauth.Options, error) {
 	redirectURL, err := o.GetAuthenticateURL()
@@ -898,9 +1588,79 @@ func (o *Options) GetClientCA() ([]byte, error) {
 	return nil, nil
 }
 
+// GetClientCRL returns the PEM-encoded client certificate revocation list.
+func (o *Options) GetClientCRL() ([]byte, error) {
+	if o.ClientCRL != "" {
+		return base64.StdEncoding.DecodeString(o.ClientCRL)
+	}
+	if o.ClientCRLFile != "" {
+		return ioutil.ReadFile(o.ClientCRLFile)
+	}
+	return nil, nil
+}
+
+// GetInternalCAKey returns the PEM encoded private key of the internal CA, or nil if it isn't set.
+func (o *Options) GetInternalCAKey() ([]byte, error) {
+	if o.InternalCAKey != "" {
+		return base64.StdEncoding.DecodeString(o.InternalCAKey)
+	}
+	if o.InternalCAKeyFile != "" {
+		return ioutil.ReadFile(o.InternalCAKeyFile)
+	}
+	return nil, nil
+}
+
+// GetSigningKey gets the base64 encoded signing key, reading it from the signing key file if set.
+func (o *Options) GetSigningKey() (string, error) {
+	if o.SigningKeyFile != "" {
+		bs, err := ioutil.ReadFile(o.SigningKeyFile)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(bs), nil
+	}
+	return o.SigningKey, nil
+}
+
+// GetSigningKeyAlgorithm returns the algorithm of the signing key, which defaults to ES256.
+func (o *Options) GetSigningKeyAlgorithm() jose.SignatureAlgorithm {
+	if o.SigningKeyAlgorithm == "" {
+		return jose.ES256
+	}
+	return jose.SignatureAlgorithm(o.SigningKeyAlgorithm)
+}
+
+// GetPublicJWKS returns the public keys which verify the JWTs signed with the signing keys, including keys
+// which are not active yet. The key set is empty if no signing key is set.
+func (o *Options) GetPublicJWKS() (*jose.JSONWebKeySet, error) {
+	jwks := new(jose.JSONWebKeySet)
+	signingKeys, err := o.GetSigningKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key: %w", err)
+	}
+
+	for _, signingKey := range signingKeys {
+		decodedCert, err := base64.StdEncoding.DecodeString(signingKey.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode signing key: %w", err)
+		}
+		jwk, err := cryptutil.PublicJWKFromBytes(decodedCert, jose.SignatureAlgorithm(signingKey.Algorithm))
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert jwks: %w", err)
+		}
+		if len(jwks.Key(jwk.KeyID)) == 0 {
+			jwks.Keys = append(jwks.Keys, *jwk)
+		}
+	}
+	return jwks, nil
+}
+
 // GetDataBrokerCertificate gets the optional databroker certificate. This method will return nil if no certificate is
 // specified.
 func (o *Options) GetDataBrokerCertificate() (*tls.Certificate, error) {
+	if o.DataBrokerStorageCert != "" && o.DataBrokerStorageCertKey != "" {
+		return cryptutil.CertificateFromBase64(o.DataBrokerStorageCert, o.DataBrokerStorageCertKey)
+	}
 	if o.DataBrokerStorageCertFile == "" || o.DataBrokerStorageCertKeyFile == "" {
 		return nil, nil
 	}
@@ -934,6 +1694,10 @@ func (o *Options) GetCertificates() ([]tls.Certificate, error) {
 		}
 		certs = append(certs, *cert)
 	}
+	// the internal certificate is last so that it's only used for other domains if there are no other certificates
+	if o.internalCertificate != nil && isServerCertificate(o.internalCertificate) {
+		certs = append(certs, *o.internalCertificate)
+	}
 	return certs, nil
 }
 
@@ -941,7 +1705,8 @@ func (o *Options) GetCertificates() ([]tls.Certificate, error) {
 func (o *Options) GetSharedKey() ([]byte, error) {
 	sharedKey := o.SharedKey
 	// mutual auth between services on the same host can be generated at runtime
-	if IsAll(o.Services) && o.SharedKey == "" && o.DataBrokerStorageType == StorageInMemoryName {
+	if IsAll(o.Services) && o.SharedKey == "" && o.DataBrokerStorageType == StorageInMemoryName &&
+		o.DataBrokerStorageSnapshotFile == "" {
 		sharedKey = randomSharedKey
 	}
 	if sharedKey == "" {
@@ -969,6 +1734,42 @@ func (o *Options) GetSetResponseHeaders() map[string]string {
 	return o.SetResponseHeaders
 }
 
+// GetLogSinkOptions gets the options of the log sinks.
+func (o *Options) GetLogSinkOptions() sink.Options {
+	return sink.Options{
+		FileMaxSize:    int64(o.LogFileMaxSize) * 1024 * 1024,
+		FileMaxAge:     o.LogFileMaxAge,
+		FileMaxBackups: o.LogFileMaxBackups,
+	}
+}
+
+// GetAccessLogOutput gets the access log output. It's empty if access logs are written with the
+// application logs.
+func (o *Options) GetAccessLogOutput() string {
+	if o.AccessLogOutput == o.LogOutput {
+		return ""
+	}
+	return o.AccessLogOutput
+}
+
+// GetAuthorizeLogFields gets the authorize log fields.
+func (o *Options) GetAuthorizeLogFields() []log.AuthorizeLogField {
+	if o.AuthorizeLogFields == nil {
+		return log.DefaultAuthorizeLogFields()
+	}
+	fields := make([]log.AuthorizeLogField, 0, len(o.AuthorizeLogFields))
+	for _, field := range o.AuthorizeLogFields {
+		fields = append(fields, log.AuthorizeLogField(strings.TrimSpace(field)))
+	}
+	return fields
+}
+
+// GetAuthorizeLogFormat gets the authorize log format.
+func (o *Options) GetAuthorizeLogFormat() log.AuthorizeLogFormat {
+	format, _ := log.ParseAuthorizeLogFormat(o.AuthorizeLogFormat)
+	return format
+}
+
 // GetQPS gets the QPS.
 func (o *Options) GetQPS() float64 {
 	if o.QPS < 1 {
@@ -1165,7 +1966,10 @@ func (o *Options) ApplySettings(ctx context.Context, settings *config.Settings)
 		o.SetResponseHeaders = settings.SetResponseHeaders
 	}
 	if len(settings.JwtClaimsHeaders) > 0 {
-		o.JWTClaimsHeaders = settings.GetJwtClaimsHeaders()
+		o.JWTClaimsHeaders = make(JWTClaimHeaders, len(settings.JwtClaimsHeaders))
+		for k, v := range settings.GetJwtClaimsHeaders() {
+			o.JWTClaimsHeaders[k] = JWTClaimHeader{Claim: v}
+		}
 	}
 	if settings.RefreshCooldown != nil {
 		o.RefreshCooldown = settings.GetRefreshCooldown().AsDuration()
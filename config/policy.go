@@ -3,10 +3,12 @@ package config
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"os"
 	"regexp"
@@ -14,6 +16,7 @@ import (
 	"time"
 
 	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	"github.com/mitchellh/mapstructure"
 	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/pomerium/pomerium/internal/hashutil"
@@ -24,25 +27,34 @@ import (
 	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
 )
 
+// ConcurrencyLeasePrefix is the prefix of the names of the databroker leases which limit the concurrent requests
+// of users to routes.
+const ConcurrencyLeasePrefix = "pomerium/concurrency/"
+
 // Policy contains route specific configuration and access settings.
 type Policy struct {
 	From string       `mapstructure:"from" yaml:"from"`
-	To   WeightedURLs `mapstructure:"to" yaml:"to"`
+	To   WeightedURLs `mapstructure:"to" yaml:"to,omitempty"`
 
 	// LbWeights are optional load balancing weights applied to endpoints specified in To
 	// this field exists for compatibility with mapstructure
 	LbWeights []uint32 `mapstructure:"_to_weights,omitempty" json:"-" yaml:"-"`
 
 	// Redirect is used for a redirect action instead of `To`
-	Redirect *PolicyRedirect `mapstructure:"redirect" yaml:"redirect"`
+	Redirect *PolicyRedirect `mapstructure:"redirect" yaml:"redirect,omitempty"`
 
 	// Identity related policy
 	AllowedUsers     []string                 `mapstructure:"allowed_users" yaml:"allowed_users,omitempty" json:"allowed_users,omitempty"`
 	AllowedGroups    []string                 `mapstructure:"allowed_groups" yaml:"allowed_groups,omitempty" json:"allowed_groups,omitempty"`
 	AllowedDomains   []string                 `mapstructure:"allowed_domains" yaml:"allowed_domains,omitempty" json:"allowed_domains,omitempty"`
 	AllowedIDPClaims identity.FlattenedClaims `mapstructure:"allowed_idp_claims" yaml:"allowed_idp_claims,omitempty" json:"allowed_idp_claims,omitempty"`
+	// Allow is a rule with nested and, or, not and nor conditionals, which also allows access to the route.
+	Allow *PolicyRule `mapstructure:"allow" yaml:"allow,omitempty" json:"allow,omitempty"`
+
+	Source *StringURL `yaml:"-" json:"source,omitempty" hash:"ignore"`
 
-	Source *StringURL `yaml:",omitempty" json:"source,omitempty" hash:"ignore"`
+	// Listeners are the names of the listeners which serve the route. If empty, only the main listener serves it.
+	Listeners []string `mapstructure:"listeners" yaml:"listeners,omitempty" json:"listeners,omitempty"`
 
 	// Additional route matching options
 	Prefix string `mapstructure:"prefix" yaml:"prefix,omitempty" json:"prefix,omitempty"`
@@ -63,13 +75,28 @@ type Policy struct {
 	// Allow unauthenticated HTTP OPTIONS requests as per the CORS spec
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/CORS#Preflighted_requests
 	CORSAllowPreflight bool `mapstructure:"cors_allow_preflight" yaml:"cors_allow_preflight,omitempty"`
+	// CORS, if set, adds CORS headers to the route's responses and answers pre-flight requests, which are
+	// allowed without a session.
+	CORS *CORS `mapstructure:"cors" yaml:"cors,omitempty" json:"cors,omitempty"`
 
 	// Allow any public request to access this route. **Bypasses authentication**
 	AllowPublicUnauthenticatedAccess bool `mapstructure:"allow_public_unauthenticated_access" yaml:"allow_public_unauthenticated_access,omitempty"`
 
+	// AuthorizeFailOpen allows requests to a public route when the authorize service is unreachable,
+	// instead of failing with a 503. Only allowed for routes with AllowPublicUnauthenticatedAccess.
+	AuthorizeFailOpen bool `mapstructure:"authorize_fail_open" yaml:"authorize_fail_open,omitempty"`
+
 	// Allow any authenticated user
 	AllowAnyAuthenticatedUser bool `mapstructure:"allow_any_authenticated_user" yaml:"allow_any_authenticated_user,omitempty"`
 
+	// HealthCheckPaths are paths which are always allowed without a session so that load balancers can
+	// probe the upstream's health endpoints. **Bypasses authentication** for matching requests.
+	HealthCheckPaths []HealthCheckPath `mapstructure:"health_check_paths" yaml:"health_check_paths,omitempty" json:"health_check_paths,omitempty"`
+
+	// AllowUpstreamSessionRevocation allows the upstream to revoke the current session by responding with the
+	// X-Pomerium-Revoke-Session: true header.
+	AllowUpstreamSessionRevocation bool `mapstructure:"allow_upstream_session_revocation" yaml:"allow_upstream_session_revocation,omitempty" json:"allow_upstream_session_revocation,omitempty"` //nolint
+
 	// UpstreamTimeout is the route specific timeout. Must be less than the global
 	// timeout. If unset, route will fallback to the proxy's DefaultUpstreamTimeout.
 	UpstreamTimeout *time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty"`
@@ -79,6 +106,23 @@ type Policy struct {
 	// see https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/route/v3/route_components.proto#envoy-v3-api-field-config-route-v3-routeaction-idle-timeout
 	IdleTimeout *time.Duration `mapstructure:"idle_timeout" yaml:"idle_timeout,omitempty"`
 
+	// MaxStreamDuration is the maximum duration of the route's requests, including streaming responses. It
+	// overrides the global write timeout, so that slow routes don't require raising it for every route. A value
+	// of zero disables it for the route.
+	MaxStreamDuration *time.Duration `mapstructure:"max_stream_duration" yaml:"max_stream_duration,omitempty" json:"max_stream_duration,omitempty"`
+
+	// MaxRequestBodySize, if set, is the maximum size of the route's request bodies, in bytes. Larger requests are
+	// rejected with a 413 Payload Too Large.
+	MaxRequestBodySize uint32 `mapstructure:"max_request_body_size" yaml:"max_request_body_size,omitempty" json:"max_request_body_size,omitempty"`
+	// BufferRequestBody buffers the whole request body before it's proxied, instead of streaming it to the
+	// upstream. Requires MaxRequestBodySize.
+	BufferRequestBody bool `mapstructure:"buffer_request_body" yaml:"buffer_request_body,omitempty" json:"buffer_request_body,omitempty"`
+	// AuthorizeRequestBody sends the request body, up to MaxRequestBodySize or 1MiB, with the authorization
+	// check, so that policies can authorize requests by their payload.
+	AuthorizeRequestBody bool `mapstructure:"authorize_request_body" yaml:"authorize_request_body,omitempty" json:"authorize_request_body,omitempty"`
+	// ParseRequestBodyJSON parses JSON request bodies for the policy. Requires AuthorizeRequestBody.
+	ParseRequestBodyJSON bool `mapstructure:"parse_request_body_json" yaml:"parse_request_body_json,omitempty" json:"parse_request_body_json,omitempty"`
+
 	// Enable proxying of websocket connections by removing the default timeout handler.
 	// Caution: Enabling this feature could result in abuse via DOS attacks.
 	AllowWebsockets bool `mapstructure:"allow_websockets"  yaml:"allow_websockets,omitempty"`
@@ -110,13 +154,29 @@ type Policy struct {
 	TLSClientKey      string           `mapstructure:"tls_client_key" yaml:"tls_client_key,omitempty"`
 	TLSClientCertFile string           `mapstructure:"tls_client_cert_file" yaml:"tls_client_cert_file,omitempty"`
 	TLSClientKeyFile  string           `mapstructure:"tls_client_key_file" yaml:"tls_client_key_file,omitempty"`
-	ClientCertificate *tls.Certificate `yaml:",omitempty" hash:"ignore"`
+	ClientCertificate *tls.Certificate `yaml:"-" hash:"ignore"`
+
+	// TLSSPIFFEClientCertificate presents the X.509 SVID obtained from the SPIRE agent as the client
+	// certificate to the upstream host.
+	TLSSPIFFEClientCertificate bool `mapstructure:"tls_spiffe_client_certificate" yaml:"tls_spiffe_client_certificate,omitempty"`
+	// TLSUpstreamSPIFFEID is the SPIFFE ID the upstream host's certificate must have. The certificate is
+	// verified using the trust bundle obtained from the SPIRE agent.
+	TLSUpstreamSPIFFEID string `mapstructure:"tls_upstream_spiffe_id" yaml:"tls_upstream_spiffe_id,omitempty"`
 
 	// TLSDownstreamClientCA defines the root certificate to use with a given route to verify
 	// downstream client certificates (e.g. from a user's browser).
 	TLSDownstreamClientCA     string `mapstructure:"tls_downstream_client_ca" yaml:"tls_downstream_client_ca,omitempty"`
 	TLSDownstreamClientCAFile string `mapstructure:"tls_downstream_client_ca_file" yaml:"tls_downstream_client_ca_file,omitempty"`
 
+	// AllowedClientCertSANs restricts the downstream client certificates accepted for the route to those
+	// with a matching subject alternative name (DNS name, email address, URI or IP address). DNS names
+	// starting with "*." match any subdomain.
+	AllowedClientCertSANs []string `mapstructure:"allowed_client_cert_sans" yaml:"allowed_client_cert_sans,omitempty"`
+	// AllowedClientCertIssuers restricts the downstream client certificates accepted for the route to those
+	// whose issuer distinguished name (e.g. "CN=Example CA,O=Example") fully matches one of the regular
+	// expressions.
+	AllowedClientCertIssuers []string `mapstructure:"allowed_client_cert_issuers" yaml:"allowed_client_cert_issuers,omitempty"`
+
 	// SetRequestHeaders adds a collection of headers to the upstream request
 	// in the form of key value pairs. Note bene, this will overwrite the
 	// value of any existing value of a given header key.
@@ -143,6 +203,75 @@ type Policy struct {
 	//
 	PassIdentityHeaders bool `mapstructure:"pass_identity_headers" yaml:"pass_identity_headers,omitempty"`
 
+	// JWTClaimsHeaders overrides the global JWT claim headers for the route. Headers are matched by name, and
+	// a header with an empty claim is not added to requests for the route.
+	JWTClaimsHeaders JWTClaimHeaders `mapstructure:"jwt_claims_headers" yaml:"jwt_claims_headers,omitempty"`
+
+	// FeatureFlags are key/value pairs added to the signed JWT assertion as the `feature_flags` claim, so that
+	// upstream applications can vary their behavior per route.
+	FeatureFlags map[string]string `mapstructure:"feature_flags" yaml:"feature_flags,omitempty"`
+
+	// IDPAccessTokenHeader, if set, is the name of a request header the user's identity provider access token
+	// is passed to the upstream in, so that it can call the identity provider's APIs on behalf of the user.
+	IDPAccessTokenHeader string `mapstructure:"idp_access_token_header" yaml:"idp_access_token_header,omitempty"`
+	// IDPIDTokenHeader, if set, is the name of a request header the user's identity provider ID token is
+	// passed to the upstream in.
+	IDPIDTokenHeader string `mapstructure:"idp_id_token_header" yaml:"idp_id_token_header,omitempty"`
+
+	// ClientCredentials, if set, accepts bearer tokens issued to services by the identity provider with the
+	// OAuth 2.0 client credentials grant.
+	ClientCredentials *ClientCredentials `mapstructure:"client_credentials" yaml:"client_credentials,omitempty" json:"client_credentials,omitempty"`
+
+	// APIKey, if set, accepts the API keys which are valid for the route.
+	APIKey *APIKey `mapstructure:"api_key" yaml:"api_key,omitempty" json:"api_key,omitempty"`
+
+	// TokenExchange, if set, exchanges the user's identity provider token for a token scoped to the upstream,
+	// which is added to upstream requests.
+	TokenExchange *TokenExchange `mapstructure:"token_exchange" yaml:"token_exchange,omitempty" json:"token_exchange,omitempty"`
+
+	// AWSSigV4, if set, signs upstream requests with AWS Signature Version 4.
+	AWSSigV4 *AWSSigV4 `mapstructure:"aws_sigv4" yaml:"aws_sigv4,omitempty" json:"aws_sigv4,omitempty"`
+
+	// Cache, if set, caches the route's responses.
+	Cache *Cache `mapstructure:"cache" yaml:"cache,omitempty" json:"cache,omitempty"`
+
+	// Compression, if set, compresses the route's responses.
+	Compression *Compression `mapstructure:"compression" yaml:"compression,omitempty" json:"compression,omitempty"`
+
+	// Cookie, if set, overrides the session cookie settings for the route.
+	Cookie *PolicyCookie `mapstructure:"cookie" yaml:"cookie,omitempty" json:"cookie,omitempty"`
+
+	// Maintenance, if set, responds to the route's requests with a 503 maintenance page, once they're
+	// authorized, instead of proxying them to the upstream.
+	Maintenance bool `mapstructure:"maintenance" yaml:"maintenance,omitempty" json:"maintenance,omitempty"`
+	// MaintenanceMessage is the message of the maintenance page.
+	MaintenanceMessage string `mapstructure:"maintenance_message" yaml:"maintenance_message,omitempty" json:"maintenance_message,omitempty"`
+	// MaintenanceRetryAfter is the Retry-After of the maintenance responses. Defaults to 5 minutes.
+	MaintenanceRetryAfter time.Duration `mapstructure:"maintenance_retry_after" yaml:"maintenance_retry_after,omitempty" json:"maintenance_retry_after,omitempty"`
+
+	// LocalRateLimit, if set, limits the rate of requests to the route.
+	LocalRateLimit *LocalRateLimit `mapstructure:"local_rate_limit" yaml:"local_rate_limit,omitempty" json:"local_rate_limit,omitempty"`
+
+	// MaxConcurrentRequestsPerUser, if set, limits the number of simultaneous requests of each user to the
+	// route. Further requests are rejected with a 429.
+	MaxConcurrentRequestsPerUser uint32 `mapstructure:"max_concurrent_requests_per_user" yaml:"max_concurrent_requests_per_user,omitempty" json:"max_concurrent_requests_per_user,omitempty"`
+
+	// LuaScript, if set, is a Lua script which Envoy runs for the route's requests and responses. The script
+	// defines envoy_on_request and/or envoy_on_response functions.
+	LuaScript string `mapstructure:"lua_script" yaml:"lua_script,omitempty" json:"lua_script,omitempty"`
+	// ExtProc, if set, sends the route's requests and responses to an external processing service.
+	ExtProc *ExtProc `mapstructure:"ext_proc" yaml:"ext_proc,omitempty" json:"ext_proc,omitempty"`
+
+	// ExternalAuthorizer, if set, delegates the authorization of the route's requests to an external service.
+	ExternalAuthorizer *ExternalAuthorizer `mapstructure:"external_authorizer" yaml:"external_authorizer,omitempty" json:"external_authorizer,omitempty"`
+
+	// TenantIsolation, if set, derives the tenant of the route's requests and sends it to the upstream in a
+	// header.
+	TenantIsolation *TenantIsolation `mapstructure:"tenant_isolation" yaml:"tenant_isolation,omitempty" json:"tenant_isolation,omitempty"`
+
+	// AccessRequests, if set, lets users who are denied access to the route request it from approvers.
+	AccessRequests *AccessRequests `mapstructure:"access_requests" yaml:"access_requests,omitempty" json:"access_requests,omitempty"`
+
 	// KubernetesServiceAccountToken is the kubernetes token to use for upstream requests.
 	KubernetesServiceAccountToken string `mapstructure:"kubernetes_service_account_token" yaml:"kubernetes_service_account_token,omitempty"`
 	// KubernetesServiceAccountTokenFile contains the kubernetes token to use for upstream requests.
@@ -151,8 +280,14 @@ type Policy struct {
 	// EnableGoogleCloudServerlessAuthentication adds "Authorization: Bearer ID_TOKEN" headers
 	// to upstream requests.
 	EnableGoogleCloudServerlessAuthentication bool `mapstructure:"enable_google_cloud_serverless_authentication" yaml:"enable_google_cloud_serverless_authentication,omitempty"` //nolint
+	// GoogleCloudServerlessAuthenticationAudience overrides the audience of the Google identity token, which
+	// defaults to the upstream's hostname. Services behind Identity-Aware Proxy expect the IAP client ID.
+	GoogleCloudServerlessAuthenticationAudience string `mapstructure:"google_cloud_serverless_authentication_audience" yaml:"google_cloud_serverless_authentication_audience,omitempty"` //nolint
 
 	SubPolicies []SubPolicy `mapstructure:"sub_policies" yaml:"sub_policies,omitempty" json:"sub_policies,omitempty"`
+	// PolicySets are the names of the top-level policy sets whose access rules are added to the route as
+	// sub policies.
+	PolicySets []string `mapstructure:"policy_sets" yaml:"policy_sets,omitempty" json:"policy_sets,omitempty"`
 
 	EnvoyOpts *envoy_config_cluster_v3.Cluster `mapstructure:"_envoy_opts" yaml:"-" json:"-"`
 
@@ -161,6 +296,72 @@ type Policy struct {
 
 	// SetResponseHeaders sets response headers.
 	SetResponseHeaders map[string]string `mapstructure:"set_response_headers" yaml:"set_response_headers,omitempty"`
+
+	// SecurityHeaders, if set, overrides the global security headers of the route's responses.
+	SecurityHeaders *SecurityHeaders `mapstructure:"security_headers" yaml:"security_headers,omitempty" json:"security_headers,omitempty"`
+}
+
+// GetWildcardSubdomain returns the subdomain of the request host matched by the wildcard of the route's from url,
+// e.g. tenant for tenant.apps.example.com and https://*.apps.example.com. It returns an empty string for routes
+// without a wildcard.
+func (p *Policy) GetWildcardSubdomain(host string) string {
+	if p.Source == nil {
+		return ""
+	}
+	subdomain, _ := urlutil.MatchWildcardHost(p.Source.Host, host)
+	return subdomain
+}
+
+func (p *Policy) validateTimeouts() error {
+	for _, timeout := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"timeout", p.UpstreamTimeout},
+		{"idle_timeout", p.IdleTimeout},
+		{"max_stream_duration", p.MaxStreamDuration},
+	} {
+		if timeout.value != nil && *timeout.value < 0 {
+			return fmt.Errorf("config: %s must not be negative", timeout.name)
+		}
+	}
+	// the stream is reset once its max duration is reached, so a longer timeout would never be reached
+	if p.UpstreamTimeout != nil && *p.UpstreamTimeout > 0 &&
+		p.MaxStreamDuration != nil && *p.MaxStreamDuration > 0 &&
+		*p.UpstreamTimeout > *p.MaxStreamDuration {
+		return fmt.Errorf("config: timeout must not be longer than max_stream_duration")
+	}
+	return nil
+}
+
+// validateHostRewrite checks that at most one of the options controlling the upstream Host header is set, since
+// only one of them can take effect.
+func (p *Policy) validateHostRewrite() error {
+	var set []string
+	if p.PreserveHostHeader {
+		set = append(set, "preserve_host_header")
+	}
+	if p.HostRewrite != "" {
+		set = append(set, "host_rewrite")
+	}
+	if p.HostRewriteHeader != "" {
+		set = append(set, "host_rewrite_header")
+	}
+	if p.HostPathRegexRewritePattern != "" {
+		set = append(set, "host_path_regex_rewrite_pattern")
+	}
+	if len(set) > 1 {
+		return fmt.Errorf("config: policy (%s) can only set one of %s", p.From, strings.Join(set, ", "))
+	}
+
+	if p.HostPathRegexRewritePattern != "" {
+		if _, err := regexp.Compile(p.HostPathRegexRewritePattern); err != nil {
+			return fmt.Errorf("config: invalid host_path_regex_rewrite_pattern: %w", err)
+		}
+	} else if p.HostPathRegexRewriteSubstitution != "" {
+		return fmt.Errorf("config: host_path_regex_rewrite_substitution requires host_path_regex_rewrite_pattern")
+	}
+	return nil
 }
 
 // RewriteHeader is a policy configuration option to rewrite an HTTP header.
@@ -170,6 +371,54 @@ type RewriteHeader struct {
 	Value  string `mapstructure:"value" yaml:"value,omitempty" json:"value,omitempty"`
 }
 
+// HealthCheckPath is a policy configuration option to allow unauthenticated requests to a health check
+// endpoint. Requests are only allowed if they match the path exactly and, when set, use one of the methods
+// and come from one of the source CIDRs.
+type HealthCheckPath struct {
+	Path        string   `mapstructure:"path" yaml:"path" json:"path"`
+	Methods     []string `mapstructure:"methods" yaml:"methods,omitempty" json:"methods,omitempty"`
+	SourceCIDRs []string `mapstructure:"source_cidrs" yaml:"source_cidrs,omitempty" json:"source_cidrs,omitempty"`
+}
+
+// Matches returns true if the request method, path and source IP match the health check path.
+func (hcp *HealthCheckPath) Matches(method, path string, sourceIP net.IP) bool {
+	if path != hcp.Path {
+		return false
+	}
+
+	if len(hcp.Methods) > 0 {
+		found := false
+		for _, m := range hcp.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(hcp.SourceCIDRs) > 0 {
+		if sourceIP == nil {
+			return false
+		}
+		found := false
+		for _, cidr := range hcp.SourceCIDRs {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err == nil && ipNet.Contains(sourceIP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
 // A SubPolicy is a protobuf Policy within a protobuf Route.
 type SubPolicy struct {
 	ID               string                   `mapstructure:"id" yaml:"id" json:"id"`
@@ -193,6 +442,24 @@ type PolicyRedirect struct {
 	StripQuery     *bool   `mapstructure:"strip_query" yaml:"strip_query,omitempty" json:"strip_query,omitempty"`
 }
 
+// NewPolicyFromMap creates a new Policy from route settings using the same keys and notations as a
+// `policy` entry in the config file.
+func NewPolicyFromMap(m map[string]interface{}) (*Policy, error) {
+	p := new(Policy)
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       policyDecodeHook,
+		WeaklyTypedInput: true,
+		Result:           p,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(m); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 // NewPolicyFromProto creates a new Policy from a protobuf policy config route.
 func NewPolicyFromProto(pb *configpb.Route) (*Policy, error) {
 	var timeout *time.Duration
@@ -402,6 +669,16 @@ func (p *Policy) Validate() error {
 		return fmt.Errorf("config: policy source url (%s) contains a path, but it should be set using the path field instead",
 			source.String())
 	}
+	if strings.Contains(source.Host, "*") {
+		if !urlutil.IsWildcardHost(source.Host) || strings.Count(source.Host, "*") > 1 {
+			return fmt.Errorf("config: policy source url (%s) may only contain a wildcard as its first label",
+				source.String())
+		}
+		if source.Scheme != "http" && source.Scheme != "https" {
+			return fmt.Errorf("config: policy source url (%s) can only contain a wildcard for http and https",
+				source.String())
+		}
+	}
 	if source.Scheme == "http" {
 		log.Warn(context.Background()).Msgf("config: policy source url (%s) uses HTTP but only HTTPS is supported",
 			source.String())
@@ -413,10 +690,19 @@ func (p *Policy) Validate() error {
 		return errEitherToOrRedirectRequired
 	}
 
+	unixCount := 0
 	for _, u := range p.To {
 		if err = u.Validate(); err != nil {
 			return fmt.Errorf("config: %s: %w", u.URL.String(), err)
 		}
+		if urlutil.IsUnix(&u.URL) {
+			unixCount++
+		}
+	}
+	// unix domain sockets and hostnames can't be used in the same cluster, since one is static and the other is
+	// resolved with DNS
+	if unixCount > 0 && unixCount != len(p.To) {
+		return fmt.Errorf("config: policy (%s) can't have both unix socket and network destinations", source.String())
 	}
 
 	// Only allow public access if no other whitelists are in place
@@ -424,11 +710,131 @@ func (p *Policy) Validate() error {
 		return fmt.Errorf("config: policy route marked as public but contains whitelists")
 	}
 
+	// Only fail open for public routes, since a request can't be authorized without the authorize service
+	if p.AuthorizeFailOpen && !p.AllowPublicUnauthenticatedAccess {
+		return fmt.Errorf("config: policy route marked to fail open but is not public")
+	}
+
 	// Only allow any authenticated user if no other whitelists are in place
 	if p.AllowAnyAuthenticatedUser && (p.AllowedDomains != nil || p.AllowedGroups != nil || p.AllowedUsers != nil) {
 		return fmt.Errorf("config: policy route marked accessible for any authenticated user but contains whitelists")
 	}
 
+	if p.IDPAccessTokenHeader != "" && strings.EqualFold(p.IDPAccessTokenHeader, p.IDPIDTokenHeader) {
+		return fmt.Errorf("config: policy passes the identity provider access and id tokens in the same header")
+	}
+
+	if err := p.validateHostRewrite(); err != nil {
+		return err
+	}
+
+	if p.BufferRequestBody && p.MaxRequestBodySize == 0 {
+		return fmt.Errorf("config: buffer_request_body requires max_request_body_size")
+	}
+	if p.ParseRequestBodyJSON && !p.AuthorizeRequestBody {
+		return fmt.Errorf("config: parse_request_body_json requires authorize_request_body")
+	}
+	if p.MaintenanceRetryAfter < 0 {
+		return fmt.Errorf("config: maintenance_retry_after must not be negative")
+	}
+	if err := p.validateTimeouts(); err != nil {
+		return err
+	}
+
+	if p.GoogleCloudServerlessAuthenticationAudience != "" && !p.EnableGoogleCloudServerlessAuthentication {
+		return fmt.Errorf("config: google_cloud_serverless_authentication_audience requires enable_google_cloud_serverless_authentication")
+	}
+
+	if p.AWSSigV4 != nil {
+		if err := p.AWSSigV4.validate(p); err != nil {
+			return fmt.Errorf("config: invalid aws_sigv4: %w", err)
+		}
+	}
+
+	if p.SecurityHeaders != nil {
+		if err := p.SecurityHeaders.validate(); err != nil {
+			return fmt.Errorf("config: invalid security_headers: %w", err)
+		}
+	}
+
+	if p.CORS != nil {
+		if err := p.CORS.validate(); err != nil {
+			return fmt.Errorf("config: invalid cors: %w", err)
+		}
+	}
+
+	if p.Cache != nil {
+		if err := p.Cache.validate(); err != nil {
+			return fmt.Errorf("config: invalid cache: %w", err)
+		}
+	}
+
+	if p.Compression != nil {
+		if err := p.Compression.validate(); err != nil {
+			return fmt.Errorf("config: invalid compression: %w", err)
+		}
+	}
+
+	if p.LocalRateLimit != nil {
+		if err := p.LocalRateLimit.validate(); err != nil {
+			return fmt.Errorf("config: invalid local_rate_limit: %w", err)
+		}
+	}
+
+	if p.ExtProc != nil {
+		if err := p.ExtProc.validate(); err != nil {
+			return fmt.Errorf("config: invalid ext_proc: %w", err)
+		}
+	}
+
+	if p.ExternalAuthorizer != nil {
+		if err := p.ExternalAuthorizer.validate(); err != nil {
+			return fmt.Errorf("config: invalid external_authorizer: %w", err)
+		}
+	}
+
+	if p.TenantIsolation != nil {
+		if err := p.TenantIsolation.validate(p); err != nil {
+			return fmt.Errorf("config: invalid tenant_isolation: %w", err)
+		}
+	}
+
+	if p.AccessRequests != nil {
+		if err := p.AccessRequests.validate(); err != nil {
+			return fmt.Errorf("config: invalid access_requests: %w", err)
+		}
+	}
+
+	if p.ClientCredentials != nil {
+		if err := p.ClientCredentials.validate(); err != nil {
+			return fmt.Errorf("config: invalid client_credentials: %w", err)
+		}
+	}
+
+	if p.APIKey != nil {
+		if err := p.APIKey.validate(); err != nil {
+			return fmt.Errorf("config: invalid api_key: %w", err)
+		}
+	}
+
+	if p.Allow != nil {
+		if err := p.Allow.validate(); err != nil {
+			return fmt.Errorf("config: invalid allow: %w", err)
+		}
+	}
+
+	for _, aic := range p.AllAllowedIDPClaims() {
+		if err := validateAllowedIDPClaims(aic); err != nil {
+			return fmt.Errorf("config: invalid allowed_idp_claims: %w", err)
+		}
+	}
+
+	if p.TokenExchange != nil {
+		if err := p.TokenExchange.Validate(); err != nil {
+			return fmt.Errorf("config: invalid token exchange: %w", err)
+		}
+	}
+
 	if (p.TLSClientCert == "" && p.TLSClientKey != "") || (p.TLSClientCert != "" && p.TLSClientKey == "") ||
 		(p.TLSClientCertFile == "" && p.TLSClientKeyFile != "") || (p.TLSClientCertFile != "" && p.TLSClientKeyFile == "") {
 		return fmt.Errorf("config: client certificate key and cert both must be non-empty")
@@ -446,6 +852,27 @@ func (p *Policy) Validate() error {
 		}
 	}
 
+	if p.ClientCertificate != nil {
+		p.checkClientCertificate()
+	}
+
+	if p.TLSSPIFFEClientCertificate && p.ClientCertificate != nil {
+		return fmt.Errorf("config: specified both `tls_spiffe_client_certificate` and a client certificate")
+	}
+
+	if p.TLSUpstreamSPIFFEID != "" {
+		if !strings.HasPrefix(p.TLSUpstreamSPIFFEID, "spiffe://") {
+			return fmt.Errorf("config: invalid `tls_upstream_spiffe_id`: %s", p.TLSUpstreamSPIFFEID)
+		}
+		if p.TLSCustomCA != "" || p.TLSCustomCAFile != "" || p.TLSSkipVerify {
+			return fmt.Errorf("config: `tls_upstream_spiffe_id` cannot be used with a custom ca or `tls_skip_verify`")
+		}
+	}
+
+	if p.TLSCustomCA != "" && p.TLSCustomCAFile != "" {
+		return fmt.Errorf("config: specified both `tls_custom_ca` and `tls_custom_ca_file`")
+	}
+
 	if p.TLSCustomCA != "" {
 		_, err := base64.StdEncoding.DecodeString(p.TLSCustomCA)
 		if err != nil {
@@ -454,7 +881,7 @@ func (p *Policy) Validate() error {
 	} else if p.TLSCustomCAFile != "" {
 		_, err := os.Stat(p.TLSCustomCAFile)
 		if err != nil {
-			return fmt.Errorf("config: couldn't load client ca file: %w", err)
+			return fmt.Errorf("config: couldn't load custom ca file: %w", err)
 		}
 	}
 
@@ -473,6 +900,21 @@ func (p *Policy) Validate() error {
 		p.TLSDownstreamClientCA = base64.StdEncoding.EncodeToString(bs)
 	}
 
+	for _, hcp := range p.HealthCheckPaths {
+		if !strings.HasPrefix(hcp.Path, "/") {
+			return fmt.Errorf("config: invalid health_check_paths path %q, must start with /", hcp.Path)
+		}
+		for _, cidr := range hcp.SourceCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("config: invalid health_check_paths source cidr %q: %w", cidr, err)
+			}
+		}
+	}
+
+	if _, err := p.AllowedClientCertIssuerRegexps(); err != nil {
+		return err
+	}
+
 	if p.KubernetesServiceAccountTokenFile != "" {
 		if p.KubernetesServiceAccountToken != "" {
 			return fmt.Errorf("config: specified both `kubernetes_service_account_token_file` and `kubernetes_service_account_token`")
@@ -492,6 +934,65 @@ func (p *Policy) Validate() error {
 	return nil
 }
 
+// reloadFiles reloads the data loaded from files referenced by the policy so that changes to those files
+// are picked up without restarting. The policy must already be valid.
+func (p *Policy) reloadFiles() error {
+	if p.TLSClientCertFile != "" && p.TLSClientKeyFile != "" {
+		cert, err := cryptutil.CertificateFromFile(p.TLSClientCertFile, p.TLSClientKeyFile)
+		if err != nil {
+			return fmt.Errorf("config: couldn't load client cert file %w", err)
+		}
+		p.ClientCertificate = cert
+	}
+
+	if p.TLSDownstreamClientCAFile != "" {
+		bs, err := ioutil.ReadFile(p.TLSDownstreamClientCAFile)
+		if err != nil {
+			return fmt.Errorf("config: couldn't load downstream client ca: %w", err)
+		}
+		p.TLSDownstreamClientCA = base64.StdEncoding.EncodeToString(bs)
+	}
+
+	if p.KubernetesServiceAccountTokenFile != "" {
+		token, err := ioutil.ReadFile(p.KubernetesServiceAccountTokenFile)
+		if err != nil {
+			return fmt.Errorf("config: failed to load kubernetes service account token: %w", err)
+		}
+		p.KubernetesServiceAccountToken = string(token)
+	}
+
+	return nil
+}
+
+// checkClientCertificate warns about client certificate configurations that can never be used
+// to authenticate to the upstream.
+func (p *Policy) checkClientCertificate() {
+	hasTLSDestination := false
+	for _, u := range p.To {
+		if u.URL.Scheme == "https" {
+			hasTLSDestination = true
+		}
+	}
+	if !hasTLSDestination {
+		log.Warn(context.Background()).Msgf("config: policy (%s) has a client certificate but no https destinations, it will not be used",
+			p.Source.String())
+	}
+
+	if len(p.ClientCertificate.Certificate) == 0 {
+		return
+	}
+	leaf, err := x509.ParseCertificate(p.ClientCertificate.Certificate[0])
+	if err != nil {
+		return
+	}
+	if now := time.Now(); now.After(leaf.NotAfter) || now.Before(leaf.NotBefore) {
+		log.Warn(context.Background()).
+			Time("not_before", leaf.NotBefore).
+			Time("not_after", leaf.NotAfter).
+			Msgf("config: policy (%s) client certificate is not currently valid", p.Source.String())
+	}
+}
+
 // Checksum returns the xxhash hash for the policy.
 func (p *Policy) Checksum() uint64 {
 	return hashutil.MustHash(p)
@@ -542,7 +1043,9 @@ func (p *Policy) Matches(requestURL url.URL) bool {
 	}
 
 	if p.Source.Host != requestURL.Host {
-		return false
+		if _, ok := urlutil.MatchWildcardHost(p.Source.Host, requestURL.Host); !ok {
+			return false
+		}
 	}
 
 	if p.Prefix != "" {
@@ -567,11 +1070,41 @@ func (p *Policy) Matches(requestURL url.URL) bool {
 	return true
 }
 
+// IsHealthCheck returns true if the request matches one of the policy's health check paths.
+func (p *Policy) IsHealthCheck(method string, requestURL url.URL, sourceIP net.IP) bool {
+	for i := range p.HealthCheckPaths {
+		if p.HealthCheckPaths[i].Matches(method, requestURL.Path, sourceIP) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsForKubernetes returns true if the policy is for kubernetes.
 func (p *Policy) IsForKubernetes() bool {
 	return p.KubernetesServiceAccountTokenFile != "" || p.KubernetesServiceAccountToken != ""
 }
 
+// AuthorizesRequestBody returns true if the request body is sent with the authorization check, either because
+// the policy authorizes it or because it's signed with AWS SigV4.
+func (p *Policy) AuthorizesRequestBody() bool {
+	return p.AuthorizeRequestBody || (p.AWSSigV4 != nil && p.AWSSigV4.SignsPayload())
+}
+
+// AllowedClientCertIssuerRegexps compiles the allowed_client_cert_issuers patterns, each of which must match
+// the entire issuer.
+func (p *Policy) AllowedClientCertIssuerRegexps() ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, issuer := range p.AllowedClientCertIssuers {
+		// the pattern must be valid on its own, so that it can't close the anchoring group
+		if _, err := regexp.Compile(issuer); err != nil {
+			return nil, fmt.Errorf("config: invalid allowed_client_cert_issuers pattern %q: %w", issuer, err)
+		}
+		res = append(res, regexp.MustCompile("^(?:"+issuer+")$"))
+	}
+	return res, nil
+}
+
 // AllAllowedDomains returns all the allowed domains.
 func (p *Policy) AllAllowedDomains() []string {
 	var ads []string
@@ -606,6 +1139,33 @@ func (p *Policy) AllAllowedIDPClaims() []identity.FlattenedClaims {
 	return aics
 }
 
+// validateAllowedIDPClaims validates the string matchers (e.g. `starts_with: eng-`) in allowed IDP claims. Other
+// values are matched exactly.
+func validateAllowedIDPClaims(claims identity.FlattenedClaims) error {
+	for k, vs := range claims {
+		for _, v := range vs {
+			matcher, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if len(matcher) == 0 {
+				return fmt.Errorf("%s: empty string matcher", k)
+			}
+			for op, operand := range matcher {
+				switch op {
+				case "contains", "ends_with", "is", "starts_with":
+				default:
+					return fmt.Errorf("%s: unknown string matcher operator: %s", k, op)
+				}
+				if _, ok := operand.(string); !ok {
+					return fmt.Errorf("%s: %s requires a string", k, op)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // AllAllowedUsers returns all the allowed users.
 func (p *Policy) AllAllowedUsers() []string {
 	var aus []string
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/open-policy-agent/opa/keys"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// DefaultPolicyBundlePollingInterval is how often policy bundles are fetched by default.
+const DefaultPolicyBundlePollingInterval = time.Minute
+
+// PolicyBundle is a signed OPA bundle whose Rego policies are evaluated for every route, in addition to
+// each route's own policy. Bundles are only activated when their signature is verified.
+type PolicyBundle struct {
+	// URL is the address of the bundle, such as an OPA bundle server endpoint.
+	URL string `mapstructure:"url" yaml:"url" json:"url"`
+	// PollingInterval is how often the bundle is fetched. Defaults to one minute.
+	PollingInterval time.Duration `mapstructure:"polling_interval" yaml:"polling_interval,omitempty" json:"polling_interval,omitempty"`
+	// VerificationKey is the base64-encoded public key, or the secret for HMAC algorithms, which signed
+	// the bundle.
+	VerificationKey string `mapstructure:"verification_key" yaml:"verification_key,omitempty" json:"verification_key,omitempty"`
+	// VerificationKeyFile is a file containing the verification key.
+	VerificationKeyFile string `mapstructure:"verification_key_file" yaml:"verification_key_file,omitempty" json:"verification_key_file,omitempty"`
+	// SigningAlgorithm is the algorithm the bundle is signed with. Defaults to RS256.
+	SigningAlgorithm string `mapstructure:"signing_algorithm" yaml:"signing_algorithm,omitempty" json:"signing_algorithm,omitempty"`
+	// Scope is the scope the bundle's signature must have, if any.
+	Scope string `mapstructure:"scope" yaml:"scope,omitempty" json:"scope,omitempty"`
+}
+
+// GetPollingInterval returns the polling interval of the bundle, which defaults to one minute.
+func (pb *PolicyBundle) GetPollingInterval() time.Duration {
+	if pb.PollingInterval <= 0 {
+		return DefaultPolicyBundlePollingInterval
+	}
+	return pb.PollingInterval
+}
+
+// GetSigningAlgorithm returns the signing algorithm of the bundle, which defaults to RS256.
+func (pb *PolicyBundle) GetSigningAlgorithm() string {
+	if pb.SigningAlgorithm == "" {
+		return "RS256"
+	}
+	return pb.SigningAlgorithm
+}
+
+// GetVerificationKey returns the verification key, reading it from the verification key file if set.
+func (pb *PolicyBundle) GetVerificationKey() (string, error) {
+	if pb.VerificationKeyFile != "" {
+		bs, err := ioutil.ReadFile(pb.VerificationKeyFile)
+		if err != nil {
+			return "", err
+		}
+		return string(bs), nil
+	}
+	bs, err := base64.StdEncoding.DecodeString(pb.VerificationKey)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+func (pb *PolicyBundle) validate() error {
+	if pb.URL == "" {
+		return errors.New("url is required")
+	}
+	u, err := urlutil.ParseAndValidateURL(pb.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	if pb.PollingInterval < 0 {
+		return errors.New("polling_interval must not be negative")
+	}
+	if pb.VerificationKey == "" && pb.VerificationKeyFile == "" {
+		return errors.New("verification_key or verification_key_file is required")
+	}
+	key, err := pb.GetVerificationKey()
+	if err != nil {
+		return fmt.Errorf("invalid verification key: %w", err)
+	}
+	if key == "" {
+		return errors.New("verification key is empty")
+	}
+	if !keys.IsSupportedAlgorithm(pb.GetSigningAlgorithm()) {
+		return fmt.Errorf("unsupported signing_algorithm: %s", pb.SigningAlgorithm)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// loadPolicyDir loads the policy of every YAML or JSON file in dir and its subdirectories. Files are loaded
+// in lexical order of their path. An error is returned if a route matches the same requests as a route in
+// another file or in configPolicies.
+func loadPolicyDir(dir string, configPolicies []Policy) ([]Policy, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+			if !info.IsDir() {
+				files = append(files, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading policy_dir: %w", err)
+	}
+
+	sources := map[string]string{}
+	for i := range configPolicies {
+		sources[policyMatchKey(&configPolicies[i])] = "the config file"
+	}
+
+	var policies []Policy
+	for _, file := range files {
+		v := viper.New()
+		v.SetConfigFile(file)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("error reading policy file %s: %w", file, err)
+		}
+		if err := expandConfigValues(v, nil); err != nil {
+			return nil, fmt.Errorf("error reading policy file %s: %w", file, err)
+		}
+		var filePolicies []Policy
+		if err := v.UnmarshalKey("policy", &filePolicies, ViperPolicyHooks); err != nil {
+			return nil, fmt.Errorf("error parsing policy file %s: %w", file, err)
+		}
+
+		for i := range filePolicies {
+			key := policyMatchKey(&filePolicies[i])
+			if other, ok := sources[key]; ok {
+				return nil, fmt.Errorf("route %s in %s conflicts with a route in %s",
+					filePolicies[i].From, file, other)
+			}
+			sources[key] = file
+		}
+		policies = append(policies, filePolicies...)
+	}
+	return policies, nil
+}
+
+// policyMatchKey returns a key which is the same for policies which match the same requests.
+func policyMatchKey(p *Policy) string {
+	return strings.Join([]string{strings.TrimSuffix(p.From, "/"), p.Prefix, p.Path, p.Regex}, "\x00")
+}
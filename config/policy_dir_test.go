@@ -0,0 +1,93 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, contents string) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0o600))
+	}
+	writeFile("b.yaml", `
+policy:
+  - from: https://b.example.com
+    to: https://to.example.com
+`)
+	writeFile("a/routes.yml", `
+policy:
+  - from: https://a1.example.com
+    to: https://to.example.com
+  - from: https://a2.example.com
+    to: https://to.example.com
+`)
+	writeFile("README.md", "ignored")
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(`
+insecure_server: true
+policy_dir: `+dir+`
+policy:
+  - from: https://config.example.com
+    to: https://to.example.com
+`), 0o600))
+
+	o, err := optionsFromViper(configFile)
+	require.NoError(t, err)
+	var froms []string
+	for _, p := range o.GetAllPolicies() {
+		froms = append(froms, p.From)
+	}
+	assert.Equal(t, []string{
+		"https://config.example.com",
+		"https://a1.example.com",
+		"https://a2.example.com",
+		"https://b.example.com",
+	}, froms)
+	require.NoError(t, o.Validate())
+	assert.Len(t, o.Policies, 4, "validating again should not duplicate routes")
+
+	t.Run("conflict", func(t *testing.T) {
+		writeFile("c.yaml", `
+policy:
+  - from: https://a2.example.com/
+    to: https://other.example.com
+`)
+		defer os.Remove(filepath.Join(dir, "c.yaml"))
+
+		_, err := optionsFromViper(configFile)
+		assert.Contains(t, err.Error(), "route https://a2.example.com/ in "+filepath.Join(dir, "c.yaml")+
+			" conflicts with a route in "+filepath.Join(dir, "a/routes.yml"))
+	})
+	t.Run("conflict with config", func(t *testing.T) {
+		writeFile("c.yaml", `
+policy:
+  - from: https://config.example.com
+    to: https://other.example.com
+`)
+		defer os.Remove(filepath.Join(dir, "c.yaml"))
+
+		_, err := optionsFromViper(configFile)
+		assert.Contains(t, err.Error(), "conflicts with a route in the config file")
+	})
+	t.Run("prefix", func(t *testing.T) {
+		writeFile("c.yaml", `
+policy:
+  - from: https://config.example.com
+    prefix: /admin
+    to: https://other.example.com
+`)
+		defer os.Remove(filepath.Join(dir, "c.yaml"))
+
+		_, err := optionsFromViper(configFile)
+		assert.NoError(t, err, "routes with different prefixes should not conflict")
+	})
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gopkg.in/yaml.v3"
+)
+
+// MarshalPolicies marshals the policies as a JSON document with the same keys as the config file and the
+// policies under the policy key, which is the format of the files in a policy directory. The rules of
+// policy sets aren't included, as the policies reference them by name.
+func MarshalPolicies(policies []Policy) ([]byte, error) {
+	routes := make([]interface{}, 0, len(policies))
+	for i := range policies {
+		route, err := marshalPolicy(&policies[i])
+		if err != nil {
+			return nil, fmt.Errorf("config: error marshaling policy (%s): %w", policies[i].From, err)
+		}
+		routes = append(routes, route)
+	}
+	return json.MarshalIndent(map[string]interface{}{"policy": routes}, "", "  ")
+}
+
+func marshalPolicy(policy *Policy) (map[string]interface{}, error) {
+	p := *policy
+	p.SubPolicies = nil
+	for _, sp := range policy.SubPolicies {
+		if !strings.HasPrefix(sp.ID, policySetSubPolicyIDPrefix) {
+			p.SubPolicies = append(p.SubPolicies, sp)
+		}
+	}
+
+	// the fields are marshaled through YAML, whose tags match the config file
+	bs, err := yaml.Marshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	route := map[string]interface{}{}
+	if err := yaml.Unmarshal(bs, &route); err != nil {
+		return nil, err
+	}
+
+	// the envoy cluster options are set in the route itself
+	if p.EnvoyOpts != nil {
+		bs, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(p.EnvoyOpts)
+		if err != nil {
+			return nil, err
+		}
+		var opts map[string]interface{}
+		if err := json.Unmarshal(bs, &opts); err != nil {
+			return nil, err
+		}
+		for k, v := range opts {
+			if _, ok := route[k]; !ok {
+				route[k] = v
+			}
+		}
+	}
+	return route, nil
+}
+
+// UnmarshalPolicies unmarshals the policies of a document in the format of the files in a policy directory,
+// and validates them. The configType is the format of the document, either json or yaml.
+func UnmarshalPolicies(data []byte, configType string, policySets map[string]SubPolicy) ([]Policy, error) {
+	v := viper.New()
+	v.SetConfigType(configType)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("config: error reading policy: %w", err)
+	}
+	if err := expandConfigValues(v, nil); err != nil {
+		return nil, err
+	}
+	var policies []Policy
+	if err := v.UnmarshalKey("policy", &policies, ViperPolicyHooks); err != nil {
+		return nil, fmt.Errorf("config: error parsing policy: %w", err)
+	}
+
+	matchKeys := map[string]struct{}{}
+	for i := range policies {
+		p := &policies[i]
+		if err := p.applyPolicySets(policySets); err != nil {
+			return nil, err
+		}
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		key := policyMatchKey(p)
+		if _, ok := matchKeys[key]; ok {
+			return nil, fmt.Errorf("config: policy (%s) matches the same requests as another policy", p.From)
+		}
+		matchKeys[key] = struct{}{}
+	}
+	return policies, nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalPolicies(t *testing.T) {
+	policySets := map[string]SubPolicy{
+		"admins": {AllowedUsers: []string{"admin@example.com"}},
+	}
+	policies, err := UnmarshalPolicies([]byte(`
+policy:
+  - from: https://a.example.com
+    to: ["http://a1.internal,10", "http://a2.internal,20"]
+    timeout: 30s
+    allowed_domains: [example.com]
+    allow:
+      or:
+        - email:
+            is: user@example.com
+    policy_sets: [admins]
+    cors:
+      allowed_origins: ["https://app.example.com"]
+    local_rate_limit:
+      requests_per_unit: 10
+    set_request_headers:
+      X-Custom: value
+    lb_policy: MAGLEV
+    max_concurrent_requests_per_user: 2
+  - from: https://b.example.com
+    path: /old
+    redirect:
+      host_redirect: c.example.com
+  - from: https://d.example.com
+    to: http://d.internal
+    allow_public_unauthenticated_access: true
+    maintenance: true
+    maintenance_retry_after: 10m
+`), "yaml", policySets)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+	assert.Len(t, policies[0].SubPolicies, 1, "the policy set should be applied")
+
+	bs, err := MarshalPolicies(policies)
+	require.NoError(t, err)
+	assert.NotContains(t, string(bs), "admin@example.com", "policy set rules should be referenced by name")
+
+	roundTripped, err := UnmarshalPolicies(bs, "json", policySets)
+	require.NoError(t, err)
+	require.Len(t, roundTripped, len(policies))
+	for i := range policies {
+		assert.Equal(t, policies[i].Checksum(), roundTripped[i].Checksum(), "policy %s", policies[i].From)
+	}
+}
+
+func TestUnmarshalPolicies(t *testing.T) {
+	_, err := UnmarshalPolicies([]byte(`{"policy": [{"from": "https://a.example.com"}]}`), "json", nil)
+	assert.Error(t, err, "a policy without to or redirect should be rejected")
+
+	_, err = UnmarshalPolicies([]byte(`{"policy": [
+		{"from": "https://a.example.com", "to": "http://a.internal"},
+		{"from": "https://a.example.com/", "to": "http://b.internal"}
+	]}`), "json", nil)
+	assert.Error(t, err, "duplicate policies should be rejected")
+
+	_, err = UnmarshalPolicies([]byte(`{"policy": [
+		{"from": "https://a.example.com", "to": "http://a.internal", "policy_sets": ["unknown"]}
+	]}`), "json", nil)
+	assert.Error(t, err, "unknown policy sets should be rejected")
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A PolicyIndex finds the policy which matches a request without checking every policy. Policies are
+// indexed by host, and within a host by exact path and by path prefix. Like checking Policy.Matches in
+// order, the first matching policy is returned. As with envoy's virtual hosts, wildcard hosts are only
+// used if no policy has the exact host, and the longest matching wildcard is used.
+type PolicyIndex struct {
+	policies []Policy
+	regexes  []*regexp.Regexp
+	hosts    map[string]*policyHostIndex
+}
+
+type policyHostIndex struct {
+	paths    map[string][]int
+	prefixes policyPrefixTrie
+	// any holds the policies which match any path, other than by regex
+	any []int
+}
+
+// policyPrefixTrie is a byte-wise trie of path prefixes.
+type policyPrefixTrie struct {
+	policies []int
+	children map[byte]*policyPrefixTrie
+}
+
+// NewPolicyIndex creates a new PolicyIndex for the policies.
+func NewPolicyIndex(policies []Policy) *PolicyIndex {
+	idx := &PolicyIndex{
+		policies: policies,
+		regexes:  make([]*regexp.Regexp, len(policies)),
+		hosts:    make(map[string]*policyHostIndex),
+	}
+	for i := range policies {
+		p := &policies[i]
+		if p.Source == nil {
+			continue
+		}
+		if p.Regex != "" {
+			// an invalid regex matches everything, as with Policy.Matches
+			idx.regexes[i], _ = regexp.Compile(p.Regex)
+		}
+
+		h, ok := idx.hosts[p.Source.Host]
+		if !ok {
+			h = &policyHostIndex{paths: make(map[string][]int)}
+			idx.hosts[p.Source.Host] = h
+		}
+		switch {
+		case p.Path != "":
+			h.paths[p.Path] = append(h.paths[p.Path], i)
+		case p.Prefix != "":
+			h.prefixes.add(p.Prefix, i)
+		default:
+			h.any = append(h.any, i)
+		}
+	}
+	return idx
+}
+
+// Match returns the first policy which matches the request URL, or nil if no policy matches.
+func (idx *PolicyIndex) Match(requestURL url.URL) *Policy {
+	if idx == nil {
+		return nil
+	}
+	h, ok := idx.lookupHost(requestURL.Host)
+	if !ok {
+		return nil
+	}
+
+	candidates := append([]int(nil), h.any...)
+	candidates = append(candidates, h.paths[requestURL.Path]...)
+	candidates = h.prefixes.appendMatches(candidates, requestURL.Path)
+	sort.Ints(candidates)
+
+	for _, i := range candidates {
+		if idx.matches(i, requestURL) {
+			return &idx.policies[i]
+		}
+	}
+	return nil
+}
+
+func (idx *PolicyIndex) lookupHost(host string) (*policyHostIndex, bool) {
+	if h, ok := idx.hosts[host]; ok {
+		return h, true
+	}
+	// the wildcard must match at least one character, so the first label is always part of it
+	for i := 1; i < len(host); i++ {
+		if host[i] != '.' {
+			continue
+		}
+		if h, ok := idx.hosts["*"+host[i:]]; ok {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+func (idx *PolicyIndex) matches(i int, requestURL url.URL) bool {
+	p := &idx.policies[i]
+	if p.Prefix != "" && !strings.HasPrefix(requestURL.Path, p.Prefix) {
+		return false
+	}
+	if p.Path != "" && requestURL.Path != p.Path {
+		return false
+	}
+	if re := idx.regexes[i]; re != nil && !re.MatchString(requestURL.String()) {
+		return false
+	}
+	return true
+}
+
+func (t *policyPrefixTrie) add(prefix string, policy int) {
+	for i := 0; i < len(prefix); i++ {
+		if t.children == nil {
+			t.children = make(map[byte]*policyPrefixTrie)
+		}
+		child, ok := t.children[prefix[i]]
+		if !ok {
+			child = new(policyPrefixTrie)
+			t.children[prefix[i]] = child
+		}
+		t = child
+	}
+	t.policies = append(t.policies, policy)
+}
+
+// appendMatches appends the policies of every prefix of the path.
+func (t *policyPrefixTrie) appendMatches(dst []int, path string) []int {
+	dst = append(dst, t.policies...)
+	for i := 0; i < len(path); i++ {
+		child, ok := t.children[path[i]]
+		if !ok {
+			break
+		}
+		t = child
+		dst = append(dst, t.policies...)
+	}
+	return dst
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyIndex(t *testing.T) {
+	t.Parallel()
+
+	from := func(host string) *StringURL {
+		return &StringURL{URL: &url.URL{Scheme: "https", Host: host}}
+	}
+	policies := []Policy{
+		{Source: from("a.example.com"), Prefix: "/api/v1"},
+		{Source: from("a.example.com"), Path: "/api/health"},
+		{Source: from("a.example.com"), Prefix: "/api"},
+		{Source: from("a.example.com"), Regex: `^https://a\.example\.com/admin/[0-9]+$`},
+		{Source: from("a.example.com"), Prefix: "/admin"},
+		{Source: from("a.example.com")},
+		{Source: from("b.example.com"), Prefix: "/"},
+		{Source: from("b.example.com"), Path: "/exact"},
+		{Source: from("c.example.com:8443")},
+	}
+	idx := NewPolicyIndex(policies)
+
+	for _, tc := range []struct {
+		url    string
+		expect int
+	}{
+		{"https://a.example.com/api/v1/users", 0},
+		{"https://a.example.com/api/health", 1},
+		{"https://a.example.com/api/v2", 2},
+		{"https://a.example.com/admin/123", 3},
+		{"https://a.example.com/admin/abc", 4},
+		{"https://a.example.com/other", 5},
+		{"https://b.example.com/exact", 6},
+		{"https://c.example.com:8443/", 8},
+		{"https://c.example.com/", -1},
+		{"https://d.example.com/", -1},
+	} {
+		tc := tc
+		t.Run(tc.url, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			require.NoError(t, err)
+
+			var expect *Policy
+			if tc.expect >= 0 {
+				expect = &policies[tc.expect]
+			}
+			assert.Equal(t, expect, idx.Match(*u))
+
+			// the index must agree with checking every policy in order
+			var linear *Policy
+			for i := range policies {
+				if policies[i].Matches(*u) {
+					linear = &policies[i]
+					break
+				}
+			}
+			assert.Equal(t, linear, idx.Match(*u))
+		})
+	}
+
+	t.Run("wildcard", func(t *testing.T) {
+		policies := []Policy{
+			{Source: from("*.example.com")},
+			{Source: from("*.apps.example.com"), Prefix: "/api"},
+			{Source: from("a.apps.example.com"), Prefix: "/admin"},
+		}
+		idx := NewPolicyIndex(policies)
+
+		for _, tc := range []struct {
+			url    string
+			expect int
+		}{
+			{"https://b.example.com/", 0},
+			{"https://tenant.apps.example.com/api/users", 1},
+			{"https://a.tenant.apps.example.com/api/users", 1},
+			// the longest wildcard is used, like envoy's virtual hosts
+			{"https://tenant.apps.example.com/other", -1},
+			// the exact host is used, even though the wildcards are listed first
+			{"https://a.apps.example.com/admin", 2},
+			{"https://a.apps.example.com/api/users", -1},
+			{"https://example.com/", -1},
+		} {
+			u, err := url.Parse(tc.url)
+			require.NoError(t, err)
+
+			var expect *Policy
+			if tc.expect >= 0 {
+				expect = &policies[tc.expect]
+			}
+			assert.Equal(t, expect, idx.Match(*u), tc.url)
+		}
+	})
+	t.Run("nil", func(t *testing.T) {
+		var idx *PolicyIndex
+		assert.Nil(t, idx.Match(url.URL{Host: "a.example.com"}))
+	})
+}
+
+func BenchmarkPolicyIndex(b *testing.B) {
+	var policies []Policy
+	for i := 0; i < 10000; i++ {
+		policies = append(policies, Policy{
+			Source: &StringURL{URL: &url.URL{Scheme: "https", Host: fmt.Sprintf("%d.example.com", i)}},
+			Prefix: "/api",
+		})
+	}
+	idx := NewPolicyIndex(policies)
+	u := url.URL{Scheme: "https", Host: "9999.example.com", Path: "/api/users"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if idx.Match(u) == nil {
+			b.Fatal("expected a match")
+		}
+	}
+}
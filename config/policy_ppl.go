@@ -24,7 +24,7 @@ func (p *Policy) ToPPL() *parser.Policy {
 				Data: parser.Boolean(true),
 			})
 	}
-	if p.CORSAllowPreflight {
+	if p.CORSAllowPreflight || p.CORS != nil {
 		allowRule.Or = append(allowRule.Or,
 			parser.Criterion{
 				Name: "cors_preflight",
@@ -90,8 +90,40 @@ func (p *Policy) ToPPL() *parser.Policy {
 				},
 			})
 	}
+	if p.APIKey != nil {
+		allowRule.Or = append(allowRule.Or,
+			parser.Criterion{
+				Name: "api_key",
+			})
+	}
+	if p.ClientCredentials != nil {
+		for _, scope := range p.ClientCredentials.AllowedScopes {
+			allowRule.Or = append(allowRule.Or,
+				parser.Criterion{
+					Name: "scope",
+					Data: parser.Object{
+						"has": parser.String(scope),
+					},
+				})
+		}
+		for _, clientID := range p.ClientCredentials.AllowedClientIDs {
+			allowRule.Or = append(allowRule.Or,
+				parser.Criterion{
+					Name: "client_id",
+					Data: parser.Object{
+						"is": parser.String(clientID),
+					},
+				})
+		}
+	}
 	ppl.Rules = append(ppl.Rules, allowRule)
 
+	if p.Allow != nil {
+		rule := p.Allow.Rule
+		rule.Action = parser.ActionAllow
+		ppl.Rules = append(ppl.Rules, rule)
+	}
+
 	denyRule := parser.Rule{Action: parser.ActionDeny}
 	denyRule.Or = append(denyRule.Or,
 		parser.Criterion{
@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/pomerium/pomerium/pkg/policy"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
 )
 
 func TestPolicy_ToPPL(t *testing.T) {
@@ -563,6 +564,12 @@ else = v {
 	v != null
 }
 
+else = v {
+	data.groups_claim != ""
+	v = session.claims[data.groups_claim]
+	v != null
+}
+
 else = [] {
 	true
 }
@@ -606,3 +613,55 @@ else = value {
 }
 `, str)
 }
+
+func TestPolicy_ToPPL_CORS(t *testing.T) {
+	ppl := (&Policy{
+		CORS: &CORS{AllowedOrigins: []string{"https://app.example.com"}},
+	}).ToPPL()
+	require.NotEmpty(t, ppl.Rules)
+	assert.Contains(t, ppl.Rules[0].Or, parser.Criterion{
+		Name: "cors_preflight",
+		Data: parser.Boolean(true),
+	}, "pre-flight requests should be allowed without a session")
+}
+
+func TestPolicy_ToPPL_ClientCredentials(t *testing.T) {
+	ppl := (&Policy{
+		ClientCredentials: &ClientCredentials{
+			AllowedScopes:    []string{"api:read"},
+			AllowedClientIDs: []string{"CLIENT_ID"},
+		},
+	}).ToPPL()
+	require.NotEmpty(t, ppl.Rules)
+	assert.Contains(t, ppl.Rules[0].Or, parser.Criterion{
+		Name: "scope",
+		Data: parser.Object{"has": parser.String("api:read")},
+	})
+	assert.Contains(t, ppl.Rules[0].Or, parser.Criterion{
+		Name: "client_id",
+		Data: parser.Object{"is": parser.String("CLIENT_ID")},
+	})
+}
+
+func TestPolicy_ToPPL_APIKey(t *testing.T) {
+	ppl := (&Policy{APIKey: &APIKey{}}).ToPPL()
+	require.NotEmpty(t, ppl.Rules)
+	assert.Contains(t, ppl.Rules[0].Or, parser.Criterion{Name: "api_key"})
+}
+
+func TestPolicy_ToPPL_Allow(t *testing.T) {
+	allow := &PolicyRule{Rule: parser.Rule{
+		And: []parser.Criterion{
+			{Name: "domain", Data: parser.Object{"is": parser.String("example.com")}},
+			{Name: "not", Data: parser.Array{parser.Object{"source_ip": parser.String("10.0.0.0/8")}}},
+		},
+	}}
+	ppl := (&Policy{Allow: allow}).ToPPL()
+	assert.Contains(t, ppl.Rules, parser.Rule{
+		Action: parser.ActionAllow,
+		And:    allow.And,
+	})
+
+	_, err := policy.GenerateRegoFromPolicy(ppl)
+	assert.NoError(t, err)
+}
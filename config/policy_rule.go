@@ -0,0 +1,92 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/pomerium/pomerium/pkg/policy"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+// A PolicyRule is an allow rule written in Pomerium Policy Language. Its "and", "or", "not" and "nor"
+// conditionals may be nested, so that rules which can't be expressed with the implicitly OR'ed allowed_*
+// options don't need custom rego.
+type PolicyRule struct {
+	parser.Rule
+}
+
+// NewPolicyRuleFromValue creates a new PolicyRule from the body of an allow rule.
+func NewPolicyRuleFromValue(v parser.Value) (*PolicyRule, error) {
+	rules, err := parser.RulesFromObject(parser.Object{string(parser.ActionAllow): v})
+	if err != nil {
+		return nil, err
+	}
+	return &PolicyRule{Rule: rules[0]}, nil
+}
+
+// validate checks that the rule's criteria are known and their data is valid by generating its rego.
+func (r *PolicyRule) validate() error {
+	rule := r.Rule
+	rule.Action = parser.ActionAllow
+	_, err := policy.GenerateRegoFromPolicy(&parser.Policy{Rules: []parser.Rule{rule}})
+	return err
+}
+
+// MarshalJSON marshals the body of the rule as JSON.
+func (r *PolicyRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Rule.ToJSON().(parser.Object)[string(parser.ActionAllow)])
+}
+
+// UnmarshalJSON unmarshals the body of a rule from JSON.
+func (r *PolicyRule) UnmarshalJSON(data []byte) error {
+	v, err := parser.ParseValue(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	pr, err := NewPolicyRuleFromValue(v)
+	if err != nil {
+		return err
+	}
+	*r = *pr
+	return nil
+}
+
+// MarshalYAML marshals the body of the rule as YAML.
+func (r *PolicyRule) MarshalYAML() (interface{}, error) {
+	bs, err := r.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	err = json.Unmarshal(bs, &v)
+	return v, err
+}
+
+func decodePolicyRuleHookFunc() mapstructure.DecodeHookFunc {
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if t != reflect.TypeOf(PolicyRule{}) {
+			return data, nil
+		}
+		raw, err := serializable(data)
+		if err != nil {
+			return nil, err
+		}
+		bs, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		v, err := parser.ParseValue(bytes.NewReader(bs))
+		if err != nil {
+			return nil, err
+		}
+		pr, err := NewPolicyRuleFromValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow rule: %w", err)
+		}
+		return pr, nil
+	}
+}
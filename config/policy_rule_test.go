@@ -0,0 +1,62 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+func TestPolicyRule_FromConfig(t *testing.T) {
+	o, err := optionsFromViperWithData("", []byte(`
+insecure_server: true
+policy:
+  - from: https://from.example.com
+    to: https://to.example.com
+    allow:
+      and:
+        - domain:
+            is: example.com
+        - or:
+            - source_ip: 10.0.0.0/8
+            - group:
+                has: admins
+`), "yaml", nil)
+	require.NoError(t, err)
+	require.Len(t, o.Policies, 1)
+	assert.Equal(t, &PolicyRule{Rule: parser.Rule{
+		Action: parser.ActionAllow,
+		And: []parser.Criterion{
+			{Name: "domain", Data: parser.Object{"is": parser.String("example.com")}},
+			{Name: "or", Data: parser.Array{
+				parser.Object{"source_ip": parser.String("10.0.0.0/8")},
+				parser.Object{"group": parser.Object{"has": parser.String("admins")}},
+			}},
+		},
+	}}, o.Policies[0].Allow)
+
+	_, err = optionsFromViperWithData("", []byte(`
+insecure_server: true
+policy:
+  - from: https://from.example.com
+    to: https://to.example.com
+    allow:
+      xor: []
+`), "yaml", nil)
+	assert.Error(t, err)
+}
+
+func TestPolicyRule_JSON(t *testing.T) {
+	raw := `{"or":[{"user":{"is":"alice"}},{"and":[{"domain":{"is":"example.com"}},{"source_ip":"10.0.0.0/8"}]}]}`
+
+	var r PolicyRule
+	require.NoError(t, json.Unmarshal([]byte(raw), &r))
+	assert.Len(t, r.Or, 2)
+
+	bs, err := json.Marshal(&r)
+	require.NoError(t, err)
+	assert.JSONEq(t, raw, string(bs))
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// policySetSubPolicyIDPrefix is the prefix of the ids of the sub policies added to routes for their policy sets.
+const policySetSubPolicyIDPrefix = "policy_set/"
+
+// applyPolicySets replaces the sub policies added for the route's policy sets with the current policy sets, so
+// that changes to a policy set apply to every route which references it when the config is reloaded.
+func (p *Policy) applyPolicySets(policySets map[string]SubPolicy) error {
+	var sps []SubPolicy
+	for _, sp := range p.SubPolicies {
+		if !strings.HasPrefix(sp.ID, policySetSubPolicyIDPrefix) {
+			sps = append(sps, sp)
+		}
+	}
+	for _, name := range p.PolicySets {
+		ps, ok := policySets[name]
+		if !ok {
+			return fmt.Errorf("config: policy (%s) references unknown policy set: %s", p.From, name)
+		}
+		ps.ID = policySetSubPolicyIDPrefix + name
+		ps.Name = name
+		sps = append(sps, ps)
+	}
+	p.SubPolicies = sps
+	return nil
+}
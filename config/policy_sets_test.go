@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicySets(t *testing.T) {
+	o, err := optionsFromViperWithData("", []byte(`
+insecure_server: true
+idp_service_account: SERVICE_ACCOUNT
+policy_sets:
+  admins:
+    allowed_groups: [admins]
+  oncall:
+    allowed_users: [alice@example.com]
+    allowed_domains: [sre.example.com]
+policy:
+  - from: https://a.example.com
+    to: https://to.example.com
+    policy_sets: [admins, oncall]
+  - from: https://b.example.com
+    to: https://to.example.com
+    allowed_users: [bob@example.com]
+    policy_sets: [admins]
+`), "yaml", nil)
+	require.NoError(t, err)
+	require.Len(t, o.Policies, 2)
+	assert.Equal(t, []string{"admins"}, o.Policies[0].AllAllowedGroups())
+	assert.Equal(t, []string{"alice@example.com"}, o.Policies[0].AllAllowedUsers())
+	assert.Equal(t, []string{"sre.example.com"}, o.Policies[0].AllAllowedDomains())
+	assert.Equal(t, []string{"admins"}, o.Policies[1].AllAllowedGroups())
+	assert.Equal(t, []string{"bob@example.com"}, o.Policies[1].AllAllowedUsers())
+
+	t.Run("reload", func(t *testing.T) {
+		o.PolicySets["admins"] = SubPolicy{AllowedGroups: []string{"superusers"}}
+		require.NoError(t, o.Validate())
+		assert.Equal(t, []string{"superusers"}, o.Policies[0].AllAllowedGroups())
+		assert.Equal(t, []string{"superusers"}, o.Policies[1].AllAllowedGroups())
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, err := optionsFromViperWithData("", []byte(`
+insecure_server: true
+policy:
+  - from: https://a.example.com
+    to: https://to.example.com
+    policy_sets: [admins]
+`), "yaml", nil)
+		assert.Error(t, err)
+	})
+}
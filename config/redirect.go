@@ -0,0 +1,48 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// IsRedirectAllowed returns true if the sign in and sign out flows may redirect to u. Redirects are allowed to
+// the hosts of routes, the authenticate service, forward auth and the sign out redirect URL, and to the hosts
+// in the redirect allowlist.
+func (o *Options) IsRedirectAllowed(u *url.URL) bool {
+	if u == nil || !(u.Scheme == "http" || u.Scheme == "https") {
+		return false
+	}
+
+	hostname := u.Hostname()
+	for _, allowed := range o.getRedirectHostnames() {
+		if isHostnameMatch(allowed, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Options) getRedirectHostnames() []string {
+	var hostnames []string
+	for _, p := range o.GetAllPolicies() {
+		if p.Source != nil {
+			hostnames = append(hostnames, p.Source.Hostname())
+		}
+	}
+	for _, f := range []func() (*url.URL, error){o.GetAuthenticateURL, o.GetForwardAuthURL, o.GetSignOutRedirectURL} {
+		if u, err := f(); err == nil && u != nil {
+			hostnames = append(hostnames, u.Hostname())
+		}
+	}
+	return append(hostnames, o.RedirectAllowlist...)
+}
+
+func isHostnameMatch(pattern, hostname string) bool {
+	pattern, hostname = strings.ToLower(urlutil.StripPort(pattern)), strings.ToLower(hostname)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(hostname, pattern[1:])
+	}
+	return pattern == hostname
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions_IsRedirectAllowed(t *testing.T) {
+	o := NewDefaultOptions()
+	o.AuthenticateURLString = "https://authenticate.example.com"
+	o.SignOutRedirectURLString = "https://signed-out.example.com/bye"
+	o.Policies = []Policy{{From: "https://from.example.com", To: mustParseWeightedURLs(t, "https://to.example.com")}}
+	o.RedirectAllowlist = []string{"extra.example.com:8443", "*.apps.example.com"}
+	o.InsecureServer = true
+	require.NoError(t, o.Validate())
+
+	for _, tc := range []struct {
+		url    string
+		expect bool
+	}{
+		{"https://from.example.com/path?q=1", true},
+		{"https://FROM.example.com", true},
+		{"http://from.example.com:8080", true},
+		{"https://to.example.com", false},
+		{"https://authenticate.example.com/.pomerium", true},
+		{"https://signed-out.example.com", true},
+		{"https://extra.example.com", true},
+		{"https://a.apps.example.com", true},
+		{"https://a.b.apps.example.com", true},
+		{"https://apps.example.com", false},
+		{"https://evilapps.example.com", false},
+		{"https://from.example.com.evil.example", false},
+		{"javascript://from.example.com/%0aalert(1)", false},
+		{"//from.example.com", false},
+	} {
+		u, err := url.Parse(tc.url)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expect, o.IsRedirectAllowed(u), tc.url)
+	}
+	assert.False(t, o.IsRedirectAllowed(nil))
+}
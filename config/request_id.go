@@ -0,0 +1,32 @@
+package config
+
+import "fmt"
+
+// Request id policies.
+const (
+	// RequestIDPolicyGenerate generates the x-request-id of requests from external clients, and keeps the
+	// one of requests from internal addresses. It's the default.
+	RequestIDPolicyGenerate = "generate"
+	// RequestIDPolicyTrust keeps the x-request-id sent by any client, and generates one if there is none.
+	RequestIDPolicyTrust = "trust"
+	// RequestIDPolicyOverride always replaces the x-request-id with a generated one, even for requests from
+	// internal addresses.
+	RequestIDPolicyOverride = "override"
+)
+
+// ValidateRequestIDPolicy validates the request id policy.
+func ValidateRequestIDPolicy(policy string) error {
+	switch policy {
+	case "", RequestIDPolicyGenerate, RequestIDPolicyTrust, RequestIDPolicyOverride:
+		return nil
+	}
+	return fmt.Errorf("unknown request id policy: %s", policy)
+}
+
+// GetRequestIDPolicy returns the request id policy, which defaults to generate.
+func (o *Options) GetRequestIDPolicy() string {
+	if o.RequestIDPolicy == "" {
+		return RequestIDPolicyGenerate
+	}
+	return o.RequestIDPolicy
+}
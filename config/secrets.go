@@ -0,0 +1,135 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/aws"
+)
+
+// A SecretResolver resolves a reference to a secret stored outside of the config to its value.
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, ref string) (string, error)
+}
+
+// The SecretResolverFunc type is an adapter to allow the use of ordinary functions as secret resolvers.
+type SecretResolverFunc func(ctx context.Context, ref string) (string, error)
+
+// ResolveSecret calls f(ctx, ref).
+func (f SecretResolverFunc) ResolveSecret(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+const (
+	// secretsTimeout is how long resolving the secret settings may take.
+	secretsTimeout = 30 * time.Second
+	// awsRequestTimeout is how long a request to the AWS APIs may take.
+	awsRequestTimeout = 10 * time.Second
+)
+
+var secretResolvers = struct {
+	sync.RWMutex
+	m map[string]SecretResolver
+}{
+	m: func() map[string]SecretResolver {
+		awsClient := aws.NewClient(&http.Client{Timeout: awsRequestTimeout})
+		return map[string]SecretResolver{
+			"aws-sm":  SecretResolverFunc(awsClient.ResolveSecretsManagerSecret),
+			"aws-kms": SecretResolverFunc(awsClient.ResolveKMSSecret),
+		}
+	}(),
+}
+
+// RegisterSecretResolver registers a resolver for secret settings whose value starts with <scheme>://.
+// The resolver is passed the rest of the value.
+func RegisterSecretResolver(scheme string, resolver SecretResolver) {
+	secretResolvers.Lock()
+	secretResolvers.m[scheme] = resolver
+	secretResolvers.Unlock()
+}
+
+// secretSettings returns the settings which may be given as secret references.
+func (o *Options) secretSettings() map[string]*string {
+	settings := map[string]*string{
+		"shared_secret":                        &o.SharedKey,
+		"cookie_secret":                        &o.CookieSecret,
+		"idp_client_secret":                    &o.ClientSecret,
+		"idp_service_account":                  &o.ServiceAccount,
+		"certificate":                          &o.Cert,
+		"certificate_key":                      &o.Key,
+		"signing_key":                          &o.SigningKey,
+		"metrics_basic_auth":                   &o.MetricsBasicAuth,
+		"metrics_bearer_token":                 &o.MetricsBearerToken,
+		"metrics_certificate_key":              &o.MetricsCertificateKey,
+		"grpc_client_certificate_key":          &o.GRPCClientCertificateKey,
+		"internal_ca_key":                      &o.InternalCAKey,
+		"databroker_storage_connection_string": &o.DataBrokerStorageConnectionString,
+		"databroker_storage_key":               &o.DataBrokerStorageCertKey,
+		"databroker_storage_password":          &o.DataBrokerStoragePassword,
+		"consul_token":                         &o.ConsulToken,
+		"vault_token":                          &o.VaultToken,
+	}
+	for i := range o.CertificateFiles {
+		settings[fmt.Sprintf("certificates[%d].cert", i)] = &o.CertificateFiles[i].CertFile
+		settings[fmt.Sprintf("certificates[%d].key", i)] = &o.CertificateFiles[i].KeyFile
+	}
+	for i := range o.SigningKeys {
+		settings[fmt.Sprintf("signing_keys[%d].key", i)] = &o.SigningKeys[i].Key
+	}
+	return settings
+}
+
+// resolveSecrets replaces secret settings given as <scheme>://<ref> with the value of the secret, using
+// the resolver registered for the scheme. The values resolved for prev are reused, so that merging config
+// data doesn't resolve the same secrets again.
+func (o *Options) resolveSecrets(ctx context.Context, prev *Options) error {
+	secretResolvers.RLock()
+	defer secretResolvers.RUnlock()
+
+	ctx, clearTimeout := context.WithTimeout(ctx, secretsTimeout)
+	defer clearTimeout()
+
+	resolved := map[string]string{}
+	for name, ptr := range o.secretSettings() {
+		idx := strings.Index(*ptr, "://")
+		if idx <= 0 {
+			continue
+		}
+		resolver, ok := secretResolvers.m[(*ptr)[:idx]]
+		if !ok {
+			continue
+		}
+		value, ok := resolved[*ptr]
+		if !ok && prev != nil {
+			value, ok = prev.resolvedSecrets[*ptr]
+		}
+		if !ok {
+			var err error
+			value, err = resolver.ResolveSecret(ctx, (*ptr)[idx+len("://"):])
+			if err != nil {
+				return fmt.Errorf("config: error resolving %s: %w", name, err)
+			}
+		}
+		resolved[*ptr] = value
+
+		// certificates are base64 encoded in the config, but usually stored as PEM
+		if isCertificateSetting(name) {
+			value = pemToBase64(value)
+		}
+		*ptr = value
+	}
+	o.resolvedSecrets = resolved
+	return nil
+}
+
+func isCertificateSetting(name string) bool {
+	switch name {
+	case "certificate", "certificate_key", "metrics_certificate_key":
+		return true
+	}
+	return strings.HasPrefix(name, "certificates[")
+}
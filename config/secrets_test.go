@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_resolveSecrets(t *testing.T) {
+	var resolved int
+	RegisterSecretResolver("test", SecretResolverFunc(func(ctx context.Context, ref string) (string, error) {
+		resolved++
+		switch ref {
+		case "shared-secret":
+			return "SHARED_SECRET", nil
+		case "cert":
+			return "-----BEGIN CERTIFICATE-----\n", nil
+		}
+		return "", errors.New("not found")
+	}))
+
+	t.Run("ok", func(t *testing.T) {
+		o := NewDefaultOptions()
+		o.SharedKey = "test://shared-secret"
+		o.ClientSecret = "CLIENT_SECRET"
+		o.Cert = "test://cert"
+		o.CertificateFiles = []certificateFilePair{{CertFile: "test://cert", KeyFile: "key.pem"}}
+		o.DataBrokerStorageConnectionString = "redis://localhost:6379"
+		assert.NoError(t, o.resolveSecrets(context.Background(), nil))
+		assert.Equal(t, "SHARED_SECRET", o.SharedKey)
+		assert.Equal(t, "CLIENT_SECRET", o.ClientSecret, "literal values should be kept")
+		assert.Equal(t, "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCg==", o.Cert, "certificates should be base64 encoded")
+		assert.Equal(t, "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCg==", o.CertificateFiles[0].CertFile)
+		assert.Equal(t, "key.pem", o.CertificateFiles[0].KeyFile)
+		assert.Equal(t, "redis://localhost:6379", o.DataBrokerStorageConnectionString,
+			"unregistered schemes should be ignored")
+	})
+	t.Run("reused", func(t *testing.T) {
+		prev := NewDefaultOptions()
+		prev.SharedKey = "test://shared-secret"
+		prev.Cert = "test://cert"
+		assert.NoError(t, prev.resolveSecrets(context.Background(), nil))
+
+		resolved = 0
+		o := NewDefaultOptions()
+		o.SharedKey = "test://shared-secret"
+		o.CookieSecret = "test://shared-secret"
+		o.Cert = "test://cert"
+		assert.NoError(t, o.resolveSecrets(context.Background(), prev))
+		assert.Equal(t, 0, resolved, "should reuse the values resolved for prev")
+		assert.Equal(t, "SHARED_SECRET", o.SharedKey)
+		assert.Equal(t, "SHARED_SECRET", o.CookieSecret)
+		assert.Equal(t, "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCg==", o.Cert)
+
+		o = NewDefaultOptions()
+		o.SharedKey = "test://cert"
+		assert.NoError(t, o.resolveSecrets(context.Background(), nil))
+		assert.Equal(t, 1, resolved)
+	})
+	t.Run("error", func(t *testing.T) {
+		o := NewDefaultOptions()
+		o.CookieSecret = "test://missing"
+		assert.EqualError(t, o.resolveSecrets(context.Background(), nil), "config: error resolving cookie_secret: not found")
+	})
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// SecurityHeaders overrides the global security headers of a route's responses. A nil header keeps the global
+// value, if any, and an empty header removes it.
+type SecurityHeaders struct {
+	// StrictTransportSecurity is the Strict-Transport-Security header.
+	StrictTransportSecurity *string `mapstructure:"strict_transport_security" yaml:"strict_transport_security,omitempty" json:"strict_transport_security,omitempty"`
+	// ContentSecurityPolicy is the Content-Security-Policy header.
+	ContentSecurityPolicy *string `mapstructure:"content_security_policy" yaml:"content_security_policy,omitempty" json:"content_security_policy,omitempty"`
+	// XFrameOptions is the X-Frame-Options header.
+	XFrameOptions *string `mapstructure:"x_frame_options" yaml:"x_frame_options,omitempty" json:"x_frame_options,omitempty"`
+	// ReferrerPolicy is the Referrer-Policy header.
+	ReferrerPolicy *string `mapstructure:"referrer_policy" yaml:"referrer_policy,omitempty" json:"referrer_policy,omitempty"`
+}
+
+// GetHeaders returns the headers to set and the headers to remove.
+func (h *SecurityHeaders) GetHeaders() (set map[string]string, remove []string) {
+	set = make(map[string]string)
+	for _, header := range []struct {
+		name  string
+		value *string
+	}{
+		{"Content-Security-Policy", h.ContentSecurityPolicy},
+		{"Referrer-Policy", h.ReferrerPolicy},
+		{"Strict-Transport-Security", h.StrictTransportSecurity},
+		{"X-Frame-Options", h.XFrameOptions},
+	} {
+		switch {
+		case header.value == nil:
+		case *header.value == "":
+			remove = append(remove, header.name)
+		default:
+			set[header.name] = *header.value
+		}
+	}
+	return set, remove
+}
+
+func (h *SecurityHeaders) validate() error {
+	for _, value := range []*string{h.StrictTransportSecurity, h.ContentSecurityPolicy, h.XFrameOptions, h.ReferrerPolicy} {
+		if value != nil && strings.ContainsAny(*value, "\r\n") {
+			return errors.New("headers must not contain newlines")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// Defaults of the sign in rate limit.
+const (
+	DefaultSignInRateLimitMaxFailures = 5
+	DefaultSignInRateLimitLockout     = time.Minute
+	DefaultSignInRateLimitMaxLockout  = time.Hour
+)
+
+// A SignInRateLimit throttles sign ins to the authenticate service. Once a client IP address or identity fails
+// to sign in MaxFailures times in a row, it's locked out of signing in for the lockout, which doubles with each
+// further failure up to the max lockout. Failures are tracked by each authenticate instance, and forgotten
+// after a successful sign in or once the max lockout passes without a failure.
+type SignInRateLimit struct {
+	// MaxFailures is the number of failed sign ins before a lockout. Defaults to 5.
+	MaxFailures uint32 `mapstructure:"max_failures" yaml:"max_failures,omitempty" json:"max_failures,omitempty"`
+	// Lockout is the duration of the first lockout. Defaults to a minute.
+	Lockout time.Duration `mapstructure:"lockout" yaml:"lockout,omitempty" json:"lockout,omitempty"`
+	// MaxLockout is the longest duration of a lockout. Defaults to an hour.
+	MaxLockout time.Duration `mapstructure:"max_lockout" yaml:"max_lockout,omitempty" json:"max_lockout,omitempty"`
+}
+
+// GetMaxFailures returns the number of failed sign ins before a lockout, which defaults to 5.
+func (l *SignInRateLimit) GetMaxFailures() uint32 {
+	if l.MaxFailures == 0 {
+		return DefaultSignInRateLimitMaxFailures
+	}
+	return l.MaxFailures
+}
+
+// GetLockout returns the duration of a lockout after the given number of consecutive failures, or 0 if there
+// haven't been enough failures for a lockout.
+func (l *SignInRateLimit) GetLockout(failures uint32) time.Duration {
+	maxFailures := l.GetMaxFailures()
+	if failures < maxFailures {
+		return 0
+	}
+
+	lockout, maxLockout := l.Lockout, l.GetMaxLockout()
+	if lockout <= 0 {
+		lockout = DefaultSignInRateLimitLockout
+	}
+	for i := maxFailures; i < failures && lockout < maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > maxLockout {
+		lockout = maxLockout
+	}
+	return lockout
+}
+
+// GetMaxLockout returns the longest duration of a lockout, which defaults to an hour.
+func (l *SignInRateLimit) GetMaxLockout() time.Duration {
+	if l.MaxLockout <= 0 {
+		return DefaultSignInRateLimitMaxLockout
+	}
+	return l.MaxLockout
+}
+
+func (l *SignInRateLimit) validate() error {
+	if l.Lockout < 0 || l.MaxLockout < 0 {
+		return errors.New("lockout must not be negative")
+	}
+	if l.Lockout > 0 && l.MaxLockout > 0 && l.Lockout > l.MaxLockout {
+		return errors.New("lockout must not be longer than max_lockout")
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+// A SigningKey is a private key used to sign the JWT assertion added to upstream requests. Every configured
+// signing key is published in the JWKS, but only the active one is used to sign, so that upstream validators
+// learn about a new key before it is used.
+type SigningKey struct {
+	// Key is the base64 encoded PEM private key.
+	Key string `mapstructure:"key" yaml:"key,omitempty"`
+	// KeyFile is a file containing the PEM private key.
+	KeyFile string `mapstructure:"key_file" yaml:"key_file,omitempty"`
+	// Algorithm is the signing algorithm, which defaults to ES256.
+	Algorithm string `mapstructure:"algorithm" yaml:"algorithm,omitempty"`
+	// NotBefore is when the key becomes the active signing key. The active signing key is the key with the
+	// most recent not before time which has passed.
+	NotBefore *time.Time `mapstructure:"not_before" yaml:"not_before,omitempty"`
+}
+
+// GetSigningKeys returns every configured signing key: the signing key (or signing key file) first, followed by
+// the signing keys. The returned keys have their key files read and their algorithm set.
+func (o *Options) GetSigningKeys() ([]SigningKey, error) {
+	var keys []SigningKey
+
+	signingKey, err := o.GetSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	if signingKey != "" {
+		keys = append(keys, SigningKey{Key: signingKey, Algorithm: string(o.GetSigningKeyAlgorithm())})
+	}
+
+	for _, key := range o.SigningKeys {
+		if key.KeyFile != "" {
+			bs, err := ioutil.ReadFile(key.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			key.Key = base64.StdEncoding.EncodeToString(bs)
+			key.KeyFile = ""
+		}
+		if key.Algorithm == "" {
+			key.Algorithm = string(jose.ES256)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// GetActiveSigningKey returns the signing key used to sign JWTs at the given time, or nil if no signing key is
+// active.
+func (o *Options) GetActiveSigningKey(now time.Time) (*SigningKey, error) {
+	keys, err := o.GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var active *SigningKey
+	for i := range keys {
+		key := &keys[i]
+		if key.NotBefore != nil && key.NotBefore.After(now) {
+			continue
+		}
+		if active == nil || notBefore(key).After(notBefore(active)) {
+			active = key
+		}
+	}
+	return active, nil
+}
+
+// GetNextSigningKeyRotation returns when the active signing key next changes. It returns false if no rotation is
+// scheduled.
+func (o *Options) GetNextSigningKeyRotation(now time.Time) (time.Time, bool) {
+	var next time.Time
+	for _, key := range o.SigningKeys {
+		if key.NotBefore == nil || !key.NotBefore.After(now) {
+			continue
+		}
+		if next.IsZero() || key.NotBefore.Before(next) {
+			next = *key.NotBefore
+		}
+	}
+	return next, !next.IsZero()
+}
+
+func notBefore(key *SigningKey) time.Time {
+	if key.NotBefore == nil {
+		return time.Time{}
+	}
+	return *key.NotBefore
+}
+
+func (o *Options) validateSigningKeys() error {
+	if o.SigningKey != "" && o.SigningKeyFile != "" {
+		return fmt.Errorf("config: specified both `signing_key` and `signing_key_file`")
+	}
+	if o.SigningKeyFile != "" {
+		if _, err := os.Stat(o.SigningKeyFile); err != nil {
+			return fmt.Errorf("config: couldn't load signing key file: %w", err)
+		}
+	}
+
+	for i, key := range o.SigningKeys {
+		if (key.Key == "") == (key.KeyFile == "") {
+			return fmt.Errorf("config: signing key %d must specify exactly one of `key` or `key_file`", i)
+		}
+		if key.KeyFile != "" {
+			if _, err := os.Stat(key.KeyFile); err != nil {
+				return fmt.Errorf("config: couldn't load signing key file: %w", err)
+			}
+		}
+	}
+
+	keys, err := o.GetSigningKeys()
+	if err != nil {
+		return fmt.Errorf("config: invalid signing key: %w", err)
+	}
+	for _, key := range keys {
+		bs, err := base64.StdEncoding.DecodeString(key.Key)
+		if err != nil {
+			return fmt.Errorf("config: signing key is not base64 encoded: %w", err)
+		}
+		if _, err := cryptutil.PrivateJWKFromBytes(bs, jose.SignatureAlgorithm(key.Algorithm)); err != nil {
+			return fmt.Errorf("config: invalid signing key: %w", err)
+		}
+	}
+	if o.SignedRequestObjects && len(keys) == 0 {
+		return fmt.Errorf("config: idp_signed_request_objects requires a signing key")
+	}
+	return nil
+}
+
+// GetActiveSigningJWK returns the private JSON web key of the signing key used to sign JWTs at the given time,
+// or nil if no signing key is active.
+func (o *Options) GetActiveSigningJWK(now time.Time) (*jose.JSONWebKey, error) {
+	key, err := o.GetActiveSigningKey(now)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	bs, err := base64.StdEncoding.DecodeString(key.Key)
+	if err != nil {
+		return nil, fmt.Errorf("config: signing key is not base64 encoded: %w", err)
+	}
+	return cryptutil.PrivateJWKFromBytes(bs, jose.SignatureAlgorithm(key.Algorithm))
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func newTestSigningKey(t *testing.T) string {
+	t.Helper()
+	key, err := cryptutil.NewSigningKey()
+	require.NoError(t, err)
+	bs, err := cryptutil.EncodePrivateKey(key)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(bs)
+}
+
+func TestOptions_GetActiveSigningKey(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	k1, k2, k3 := newTestSigningKey(t), newTestSigningKey(t), newTestSigningKey(t)
+
+	o := NewDefaultOptions()
+	key, err := o.GetActiveSigningKey(now)
+	require.NoError(t, err)
+	assert.Nil(t, key)
+
+	o.SigningKey = k1
+	o.SigningKeys = []SigningKey{
+		{Key: k2, NotBefore: &past},
+		{Key: k3, NotBefore: &future},
+	}
+	key, err = o.GetActiveSigningKey(now)
+	require.NoError(t, err)
+	assert.Equal(t, k2, key.Key)
+	assert.Equal(t, "ES256", key.Algorithm)
+
+	key, err = o.GetActiveSigningKey(future)
+	require.NoError(t, err)
+	assert.Equal(t, k3, key.Key)
+
+	next, ok := o.GetNextSigningKeyRotation(now)
+	assert.True(t, ok)
+	assert.Equal(t, future, next)
+	_, ok = o.GetNextSigningKeyRotation(future)
+	assert.False(t, ok)
+
+	jwks, err := o.GetPublicJWKS()
+	require.NoError(t, err)
+	assert.Len(t, jwks.Keys, 3)
+}
+
+func TestOptions_GetActiveSigningJWK(t *testing.T) {
+	now := time.Now()
+
+	o := NewDefaultOptions()
+	jwk, err := o.GetActiveSigningJWK(now)
+	require.NoError(t, err)
+	assert.Nil(t, jwk)
+
+	o.SigningKeys = []SigningKey{{Key: newTestSigningKey(t)}}
+	jwk, err = o.GetActiveSigningJWK(now)
+	require.NoError(t, err)
+	require.NotNil(t, jwk)
+	assert.False(t, jwk.IsPublic())
+	assert.Equal(t, "ES256", jwk.Algorithm)
+	assert.NotEmpty(t, jwk.KeyID)
+}
+
+func TestOptions_validateSigningKeys(t *testing.T) {
+	key := newTestSigningKey(t)
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	bs, _ := base64.StdEncoding.DecodeString(key)
+	require.NoError(t, os.WriteFile(keyFile, bs, 0o600))
+
+	for _, tc := range []struct {
+		name    string
+		keys    []SigningKey
+		wantErr bool
+	}{
+		{"key", []SigningKey{{Key: key}}, false},
+		{"key file", []SigningKey{{KeyFile: keyFile}}, false},
+		{"both", []SigningKey{{Key: key, KeyFile: keyFile}}, true},
+		{"neither", []SigningKey{{Algorithm: "ES256"}}, true},
+		{"missing file", []SigningKey{{KeyFile: filepath.Join(t.TempDir(), "missing.pem")}}, true},
+		{"invalid key", []SigningKey{{Key: "not-a-key"}}, true},
+		{"wrong algorithm", []SigningKey{{Key: key, Algorithm: "EdDSA"}}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := NewDefaultOptions()
+			o.SigningKeys = tc.keys
+			err := o.validateSigningKeys()
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestOptions_validateSigningKeys_SignedRequestObjects(t *testing.T) {
+	o := NewDefaultOptions()
+	o.SignedRequestObjects = true
+	assert.Error(t, o.validateSigningKeys())
+
+	o.SigningKeys = []SigningKey{{Key: newTestSigningKey(t)}}
+	assert.NoError(t, o.validateSigningKeys())
+}
+
+func TestOptions_SigningKeysFromConfig(t *testing.T) {
+	key := newTestSigningKey(t)
+	o, err := optionsFromViperWithData("", []byte(`
+insecure_server: true
+signing_keys:
+  - key: `+key+`
+    algorithm: ES256
+    not_before: 2021-06-01T00:00:00Z
+`), "yaml", nil)
+	require.NoError(t, err)
+	notBefore := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []SigningKey{{Key: key, Algorithm: "ES256", NotBefore: &notBefore}}, o.SigningKeys)
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// envReferencePattern matches ${ENV_VAR} references, and $${ which escapes a literal ${.
+var envReferencePattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// fileReferencePrefix is the prefix of settings whose value is loaded from a file.
+const fileReferencePrefix = "file://"
+
+// expandConfigValues replaces ${ENV_VAR} in every string setting with the value of the environment
+// variable, and replaces settings given as file:///path with the contents of the file. Values from the
+// merged config data, if not nil, aren't expanded, so that a remote config store such as Consul cannot read
+// the local environment and files.
+func expandConfigValues(v, data *viper.Viper) error {
+	for _, key := range v.AllKeys() {
+		var dataValue interface{}
+		if data != nil && data.IsSet(key) {
+			dataValue = data.Get(key)
+		}
+		value, changed, err := expandConfigValue(v.Get(key), dataValue)
+		if err != nil {
+			return fmt.Errorf("config: error expanding %s: %w", key, err)
+		}
+		if changed {
+			v.Set(key, value)
+		}
+	}
+	return nil
+}
+
+// expandConfigValue expands the value, except for the parts equal to the corresponding parts of dataValue.
+func expandConfigValue(value, dataValue interface{}) (interface{}, bool, error) {
+	if dataValue != nil && reflect.DeepEqual(value, dataValue) {
+		return value, false, nil
+	}
+
+	switch value := value.(type) {
+	case string:
+		return expandConfigString(value)
+	case []interface{}:
+		var changed bool
+		out := make([]interface{}, len(value))
+		for i, elem := range value {
+			expanded, elemChanged, err := expandConfigValue(elem, nil)
+			if err != nil {
+				return nil, false, err
+			}
+			out[i], changed = expanded, changed || elemChanged
+		}
+		return out, changed, nil
+	case map[string]interface{}:
+		dataMap, _ := dataValue.(map[string]interface{})
+		var changed bool
+		out := make(map[string]interface{}, len(value))
+		for k, elem := range value {
+			expanded, elemChanged, err := expandConfigValue(elem, dataMap[k])
+			if err != nil {
+				return nil, false, err
+			}
+			out[k], changed = expanded, changed || elemChanged
+		}
+		return out, changed, nil
+	case map[interface{}]interface{}:
+		dataMap, _ := dataValue.(map[interface{}]interface{})
+		var changed bool
+		out := make(map[interface{}]interface{}, len(value))
+		for k, elem := range value {
+			expanded, elemChanged, err := expandConfigValue(elem, dataMap[k])
+			if err != nil {
+				return nil, false, err
+			}
+			out[k], changed = expanded, changed || elemChanged
+		}
+		return out, changed, nil
+	}
+	return value, false, nil
+}
+
+func expandConfigString(value string) (interface{}, bool, error) {
+	if strings.HasPrefix(value, fileReferencePrefix) {
+		bs, err := ioutil.ReadFile(strings.TrimPrefix(value, fileReferencePrefix))
+		if err != nil {
+			return nil, false, err
+		}
+		return strings.TrimSuffix(string(bs), "\n"), true, nil
+	}
+
+	if !strings.Contains(value, "${") {
+		return value, false, nil
+	}
+	var err error
+	expanded := envReferencePattern.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		name := ref[len("${") : len(ref)-len("}")]
+		envValue, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return envValue
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return expanded, true, nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandConfigValues(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "client-secret")
+	require.NoError(t, ioutil.WriteFile(secretFile, []byte("CLIENT_SECRET\n"), 0o600))
+
+	os.Setenv("TEST_EXPAND_DOMAIN", "example.com")
+	defer os.Unsetenv("TEST_EXPAND_DOMAIN")
+
+	configFile := filepath.Join(dir, "config.yaml")
+	writeConfig := func(contents string) {
+		require.NoError(t, ioutil.WriteFile(configFile, []byte(contents), 0o600))
+	}
+	writeConfig(`
+insecure_server: true
+authenticate_service_url: https://authenticate.${TEST_EXPAND_DOMAIN}
+idp_client_secret: file://` + secretFile + `
+jwt_claims_headers:
+  x-literal: $${TEST_EXPAND_DOMAIN}
+policy:
+  - from: https://from.${TEST_EXPAND_DOMAIN}
+    to: https://to.${TEST_EXPAND_DOMAIN}
+`)
+
+	o, err := optionsFromViper(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, "https://authenticate.example.com", o.AuthenticateURLString)
+	assert.Equal(t, "CLIENT_SECRET", o.ClientSecret)
+	assert.Equal(t, "${TEST_EXPAND_DOMAIN}", o.JWTClaimsHeaders["x-literal"].Claim)
+	if assert.Len(t, o.Policies, 1) {
+		assert.Equal(t, "https://from.example.com", o.Policies[0].From)
+		assert.Equal(t, "https://to.example.com", o.Policies[0].To[0].URL.String())
+	}
+
+	t.Run("reload", func(t *testing.T) {
+		os.Setenv("TEST_EXPAND_DOMAIN", "example.org")
+		o, err := optionsFromViper(configFile)
+		require.NoError(t, err)
+		assert.Equal(t, "https://authenticate.example.org", o.AuthenticateURLString)
+		os.Setenv("TEST_EXPAND_DOMAIN", "example.com")
+	})
+	t.Run("merged data", func(t *testing.T) {
+		o, err := optionsFromViperWithData(configFile, []byte(`
+idp_client_id: file://`+secretFile+`
+jwt_claims_headers:
+  x-domain: ${TEST_EXPAND_DOMAIN}
+`), "yaml", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "https://authenticate.example.com", o.AuthenticateURLString,
+			"values from the config file should be expanded")
+		assert.Equal(t, "file://"+secretFile, o.ClientID, "values from merged data shouldn't be expanded")
+		assert.Equal(t, "${TEST_EXPAND_DOMAIN}", o.JWTClaimsHeaders["x-domain"].Claim)
+		assert.Equal(t, "${TEST_EXPAND_DOMAIN}", o.JWTClaimsHeaders["x-literal"].Claim,
+			"values from the config file should be expanded when merged with data")
+	})
+	t.Run("missing environment variable", func(t *testing.T) {
+		writeConfig(`
+insecure_server: true
+authenticate_service_url: https://authenticate.${TEST_EXPAND_MISSING}
+`)
+		_, err := optionsFromViper(configFile)
+		assert.Error(t, err)
+	})
+	t.Run("missing file", func(t *testing.T) {
+		writeConfig(`
+insecure_server: true
+idp_client_secret: file://` + filepath.Join(dir, "missing") + `
+`)
+		_, err := optionsFromViper(configFile)
+		assert.Error(t, err)
+	})
+}
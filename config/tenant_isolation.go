@@ -0,0 +1,46 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// DefaultTenantIsolationHeader is the header the tenant id is sent to the upstream in by default.
+const DefaultTenantIsolationHeader = "X-Tenant-ID"
+
+// TenantIsolation derives the tenant of a route's requests from the subdomain matched by the route's wildcard,
+// from a claim of the user, or from both, in which case they have to match. Requests whose tenant can't be
+// derived, or which already carry a different tenant id header, are denied. The tenant id header of allowed
+// requests is replaced, so the upstream can rely on it.
+type TenantIsolation struct {
+	// Subdomain derives the tenant from the subdomain matched by the wildcard of the route's from url.
+	Subdomain bool `mapstructure:"subdomain" yaml:"subdomain,omitempty" json:"subdomain,omitempty"`
+	// Claim derives the tenant from a claim of the user, as found in the JWT assertion.
+	Claim string `mapstructure:"claim" yaml:"claim,omitempty" json:"claim,omitempty"`
+	// Header is the header the tenant id is sent to the upstream in. Defaults to X-Tenant-ID.
+	Header string `mapstructure:"header" yaml:"header,omitempty" json:"header,omitempty"`
+}
+
+// GetHeader returns the header the tenant id is sent to the upstream in, which defaults to X-Tenant-ID.
+func (t *TenantIsolation) GetHeader() string {
+	if t.Header == "" {
+		return http.CanonicalHeaderKey(DefaultTenantIsolationHeader)
+	}
+	return http.CanonicalHeaderKey(t.Header)
+}
+
+func (t *TenantIsolation) validate(p *Policy) error {
+	if !t.Subdomain && t.Claim == "" {
+		return errors.New("subdomain or claim is required")
+	}
+	if t.Subdomain && (p.Source == nil || !urlutil.IsWildcardHost(p.Source.Host)) {
+		return errors.New("subdomain requires a wildcard from url")
+	}
+	if strings.ContainsAny(t.Header, " :\r\n") {
+		return errors.New("invalid header name")
+	}
+	return nil
+}
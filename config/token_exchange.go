@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+// Token exchange subject token types.
+const (
+	TokenExchangeSubjectTokenTypeAccessToken = "access_token"
+	TokenExchangeSubjectTokenTypeIDToken     = "id_token"
+)
+
+// TokenExchange configures an OAuth 2.0 token exchange (RFC 8693) in which the user's identity provider token
+// is exchanged for a token scoped to the upstream, which is then added to upstream requests.
+type TokenExchange struct {
+	// TokenURL is the token endpoint of the identity provider or security token service.
+	TokenURL string `mapstructure:"token_url" yaml:"token_url" json:"token_url"`
+	// ClientID and ClientSecret, if set, authenticate the exchange request with HTTP basic auth.
+	ClientID     string `mapstructure:"client_id" yaml:"client_id,omitempty" json:"client_id,omitempty"`
+	ClientSecret string `mapstructure:"client_secret" yaml:"client_secret,omitempty" json:"client_secret,omitempty"`
+	// SubjectTokenType is the session token that is exchanged, either access_token (the default) or id_token.
+	SubjectTokenType string `mapstructure:"subject_token_type" yaml:"subject_token_type,omitempty" json:"subject_token_type,omitempty"`
+	// RequestedTokenType is an optional token type URI for the issued token.
+	RequestedTokenType string `mapstructure:"requested_token_type" yaml:"requested_token_type,omitempty" json:"requested_token_type,omitempty"`
+	// Audience, Resource and Scopes describe where and how the issued token will be used.
+	Audience string   `mapstructure:"audience" yaml:"audience,omitempty" json:"audience,omitempty"`
+	Resource string   `mapstructure:"resource" yaml:"resource,omitempty" json:"resource,omitempty"`
+	Scopes   []string `mapstructure:"scopes" yaml:"scopes,omitempty" json:"scopes,omitempty"`
+	// Header is the request header the issued token is added to. It defaults to Authorization, in which case
+	// the token is prefixed by its token type.
+	Header string `mapstructure:"header" yaml:"header,omitempty" json:"header,omitempty"`
+}
+
+// Validate checks that the token exchange is valid.
+func (te *TokenExchange) Validate() error {
+	if _, err := urlutil.ParseAndValidateURL(te.TokenURL); err != nil {
+		return fmt.Errorf("invalid token_url: %w", err)
+	}
+	switch te.SubjectTokenType {
+	case "", TokenExchangeSubjectTokenTypeAccessToken, TokenExchangeSubjectTokenTypeIDToken:
+	default:
+		return fmt.Errorf("unsupported subject_token_type: %s", te.SubjectTokenType)
+	}
+	if te.ClientSecret != "" && te.ClientID == "" {
+		return fmt.Errorf("client_secret requires a client_id")
+	}
+	return nil
+}
+
+// GetSubjectTokenType returns the session token that is exchanged.
+func (te *TokenExchange) GetSubjectTokenType() string {
+	if te.SubjectTokenType == "" {
+		return TokenExchangeSubjectTokenTypeAccessToken
+	}
+	return te.SubjectTokenType
+}
+
+// GetHeader returns the request header the issued token is added to.
+func (te *TokenExchange) GetHeader() string {
+	if te.Header == "" {
+		return "Authorization"
+	}
+	return http.CanonicalHeaderKey(te.Header)
+}
@@ -23,12 +23,21 @@ func NewTracingOptions(o *Options) (*TracingOptions, error) {
 		Provider:            o.TracingProvider,
 		Service:             telemetry.ServiceName(o.Services),
 		JaegerAgentEndpoint: o.TracingJaegerAgentEndpoint,
+		Sampler:             o.TracingSampler,
 		SampleRate:          o.TracingSampleRate,
 	}
+	if _, err := trace.GetSampler(o.TracingSampler, o.TracingSampleRate); err != nil {
+		return nil, fmt.Errorf("config: invalid tracing sampler: %w", err)
+	}
 
 	switch o.TracingProvider {
 	case trace.DatadogTracingProviderName:
 		tracingOpts.DatadogAddress = o.TracingDatadogAddress
+		tracingOpts.DatadogEnv = o.TracingDatadogEnv
+		tracingOpts.DatadogTags = o.TracingDatadogTags
+		if o.TracingDatadogService != "" {
+			tracingOpts.Service = o.TracingDatadogService
+		}
 	case trace.JaegerTracingProviderName:
 		if o.TracingJaegerCollectorEndpoint != "" {
 			jaegerCollectorEndpoint, err := urlutil.ParseAndValidateURL(o.TracingJaegerCollectorEndpoint)
@@ -38,6 +47,18 @@ func NewTracingOptions(o *Options) (*TracingOptions, error) {
 			tracingOpts.JaegerCollectorEndpoint = jaegerCollectorEndpoint
 			tracingOpts.JaegerAgentEndpoint = o.TracingJaegerAgentEndpoint
 		}
+	case trace.OTLPTracingProviderName:
+		endpoint := o.TracingOTLPEndpoint
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		otlpEndpoint, err := urlutil.ParseAndValidateURL(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("config: invalid otlp endpoint url: %w", err)
+		}
+		tracingOpts.OTLPEndpoint = otlpEndpoint
+		tracingOpts.OTLPHeaders = o.OTLPHeaders
+		tracingOpts.ResourceAttributes = o.OTLPResourceAttributes
 	case trace.ZipkinTracingProviderName:
 		zipkinEndpoint, err := urlutil.ParseAndValidateURL(o.ZipkinEndpoint)
 		if err != nil {
@@ -28,6 +28,12 @@ func Test_NewTracingOptions(t *testing.T) {
 			&TracingOptions{Provider: "datadog", Service: "pomerium"},
 			false,
 		},
+		{
+			"datadog_tags",
+			&Options{TracingProvider: "datadog", TracingDatadogService: "edge", TracingDatadogEnv: "prod", TracingDatadogTags: map[string]string{"team": "infra"}},
+			&TracingOptions{Provider: "datadog", Service: "edge", DatadogEnv: "prod", DatadogTags: map[string]string{"team": "infra"}},
+			false,
+		},
 		{
 			"jaeger_good",
 			&Options{TracingProvider: "jaeger", TracingJaegerAgentEndpoint: "foo", TracingJaegerCollectorEndpoint: "http://foo", Services: ServiceAll},
@@ -52,6 +58,24 @@ func Test_NewTracingOptions(t *testing.T) {
 			nil,
 			true,
 		},
+		{
+			"otlp_good",
+			&Options{TracingProvider: "otlp", TracingOTLPEndpoint: "http://collector:4318", TracingSampler: "always", OTLPHeaders: map[string]string{"x-api-key": "KEY"}, OTLPResourceAttributes: map[string]string{"deployment.environment": "prod"}},
+			&TracingOptions{Provider: "otlp", OTLPEndpoint: &url.URL{Scheme: "http", Host: "collector:4318"}, OTLPHeaders: map[string]string{"x-api-key": "KEY"}, ResourceAttributes: map[string]string{"deployment.environment": "prod"}, Sampler: "always", Service: "pomerium"},
+			false,
+		},
+		{
+			"otlp_default_endpoint",
+			&Options{TracingProvider: "otlp"},
+			&TracingOptions{Provider: "otlp", OTLPEndpoint: &url.URL{Scheme: "http", Host: "localhost:4318"}, Service: "pomerium"},
+			false,
+		},
+		{
+			"bad_sampler",
+			&Options{TracingProvider: "otlp", TracingSampler: "sometimes"},
+			nil,
+			true,
+		},
 		{
 			"noprovider",
 			&Options{},
@@ -0,0 +1,332 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/pomerium/pomerium/internal/hashutil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/internal/vault"
+)
+
+const (
+	// vaultKVRefreshInterval is how often KV secrets are reloaded so that rotated values are picked up.
+	vaultKVRefreshInterval = time.Hour
+	// vaultTimeout is how long loading the secrets and certificate from Vault may take.
+	vaultTimeout = 30 * time.Second
+)
+
+// vaultSecretSettings are the settings which may be loaded from Vault KV secrets.
+var vaultSecretSettings = map[string]func(o *Options, value string){
+	"shared_secret":     func(o *Options, value string) { o.SharedKey = value },
+	"cookie_secret":     func(o *Options, value string) { o.CookieSecret = value },
+	"idp_client_secret": func(o *Options, value string) { o.ClientSecret = value },
+	"certificate":       func(o *Options, value string) { o.Cert = pemToBase64(value) },
+	"certificate_key":   func(o *Options, value string) { o.Key = pemToBase64(value) },
+}
+
+// loadVaultSecrets replaces the settings in VaultSecrets with their values from Vault and adds a
+// certificate issued from VaultPKIRole. The values loaded for prev are reused, if its Vault settings are the
+// same and they don't need to be loaded again yet, so that merging config data doesn't make Vault requests.
+func (o *Options) loadVaultSecrets(ctx context.Context, prev *Options) error {
+	if len(o.VaultSecrets) == 0 && o.VaultPKIRole == "" {
+		return nil
+	}
+
+	settingsHash := o.getVaultSettingsHash()
+	secrets := (*vaultSecrets)(nil)
+	if prev != nil && prev.vaultSecrets != nil && prev.vaultSecrets.settingsHash == settingsHash &&
+		time.Now().Before(prev.vaultSecrets.refreshAt) {
+		secrets = prev.vaultSecrets
+	} else {
+		ctx, clearTimeout := context.WithTimeout(ctx, vaultTimeout)
+		defer clearTimeout()
+
+		var err error
+		secrets, err = o.fetchVaultSecrets(ctx)
+		if err != nil {
+			return err
+		}
+		secrets.settingsHash = settingsHash
+	}
+
+	for setting, value := range secrets.values {
+		vaultSecretSettings[setting](o, value)
+	}
+	if secrets.certificate != nil {
+		o.CertificateFiles = append(o.CertificateFiles, *secrets.certificate)
+	}
+	o.vaultSecrets = secrets
+	o.vaultRefreshAt = secrets.refreshAt
+	return nil
+}
+
+// vaultSecrets are the values loaded from Vault for the Vault settings with the given hash.
+type vaultSecrets struct {
+	settingsHash uint64
+	values       map[string]string
+	certificate  *certificateFilePair
+	// refreshAt is when the token should be renewed and the values loaded again
+	refreshAt time.Time
+}
+
+func (o *Options) getVaultSettingsHash() uint64 {
+	return hashutil.MustHash(struct {
+		Address, Token, TokenFile string
+		Secrets                   map[string]string
+		PKIRole, PKICommonName    string
+		PKIAltNames               []string
+	}{
+		o.VaultAddress, o.VaultToken, o.VaultTokenFile,
+		o.VaultSecrets,
+		o.VaultPKIRole, o.VaultPKICommonName,
+		o.VaultPKIAltNames,
+	})
+}
+
+// fetchVaultSecrets renews the Vault token, loads the values of the settings in VaultSecrets and issues a
+// certificate from VaultPKIRole.
+func (o *Options) fetchVaultSecrets(ctx context.Context) (*vaultSecrets, error) {
+	if o.VaultAddress == "" {
+		return nil, errors.New("config: vault_address is required when vault_secrets or vault_pki_role is set")
+	}
+	address, err := urlutil.ParseAndValidateURL(o.VaultAddress)
+	if err != nil {
+		return nil, fmt.Errorf("config: bad vault_address %s : %w", o.VaultAddress, err)
+	}
+	client := vault.NewClient(address, o.VaultToken, o.VaultTokenFile, http.DefaultClient)
+
+	now := time.Now()
+	secrets := &vaultSecrets{
+		values:    map[string]string{},
+		refreshAt: now.Add(vaultKVRefreshInterval),
+	}
+
+	info, err := client.LookupSelf(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("config: error looking up vault token: %w", err)
+	}
+	if info.Renewable {
+		info, err = client.RenewSelf(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("config: error renewing vault token: %w", err)
+		}
+	}
+	// a TTL of 0 means the token never expires
+	if info.TTL > 0 {
+		secrets.refreshAt = minTime(secrets.refreshAt, now.Add(info.TTL/2))
+	}
+
+	// sort the settings so errors are deterministic
+	settings := make([]string, 0, len(o.VaultSecrets))
+	for setting := range o.VaultSecrets {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+
+	kvs := map[string]map[string]interface{}{}
+	for _, setting := range settings {
+		if _, ok := vaultSecretSettings[setting]; !ok {
+			return nil, fmt.Errorf("config: vault_secrets: %s cannot be loaded from vault", setting)
+		}
+		mount, secretPath, key, err := parseVaultSecretReference(o.VaultSecrets[setting])
+		if err != nil {
+			return nil, fmt.Errorf("config: vault_secrets: bad reference for %s: %w", setting, err)
+		}
+
+		data, ok := kvs[mount+"/"+secretPath]
+		if !ok {
+			data, err = client.ReadKV(ctx, mount, secretPath)
+			if err != nil {
+				return nil, fmt.Errorf("config: error loading %s from vault: %w", setting, err)
+			}
+			kvs[mount+"/"+secretPath] = data
+		}
+		value, ok := data[key].(string)
+		if !ok {
+			return nil, fmt.Errorf("config: error loading %s from vault: key %s not found in %s/%s",
+				setting, key, mount, secretPath)
+		}
+		secrets.values[setting] = value
+	}
+
+	if o.VaultPKIRole != "" {
+		idx := strings.LastIndex(o.VaultPKIRole, "/")
+		if idx <= 0 || idx == len(o.VaultPKIRole)-1 {
+			return nil, fmt.Errorf("config: vault_pki_role must be in the form <mount>/<role>: %s", o.VaultPKIRole)
+		}
+		if o.VaultPKICommonName == "" {
+			return nil, errors.New("config: vault_pki_common_name is required when vault_pki_role is set")
+		}
+		cert, err := client.IssueCertificate(ctx, o.VaultPKIRole[:idx], o.VaultPKIRole[idx+1:],
+			o.VaultPKICommonName, o.VaultPKIAltNames)
+		if err != nil {
+			return nil, fmt.Errorf("config: error issuing certificate from vault: %w", err)
+		}
+		secrets.certificate = &certificateFilePair{
+			CertFile: pemToBase64(cert.Certificate),
+			KeyFile:  pemToBase64(cert.PrivateKey),
+		}
+		// renew the certificate after two thirds of its lifetime
+		secrets.refreshAt = minTime(secrets.refreshAt, now.Add(cert.Expiration.Sub(now)*2/3))
+	}
+
+	return secrets, nil
+}
+
+// parseVaultSecretReference parses a reference in the form <mount>/<path>#<key>.
+func parseVaultSecretReference(ref string) (mount, secretPath, key string, err error) {
+	idx := strings.LastIndex(ref, "#")
+	if idx < 0 {
+		return "", "", "", errors.New("missing #<key>")
+	}
+	ref, key = ref[:idx], ref[idx+1:]
+	parts := strings.SplitN(strings.Trim(ref, "/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || key == "" {
+		return "", "", "", errors.New("expected <mount>/<path>#<key>")
+	}
+	return parts[0], parts[1], key, nil
+}
+
+// pemToBase64 base64 encodes PEM data so it can be used like the base64 certificate settings. Other
+// values are assumed to already be base64 encoded.
+func pemToBase64(value string) string {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	return value
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// VaultSource is a config source which reloads the underlying config before the secrets loaded from
+// Vault, or the certificate issued by the internal CA, expire. It should wrap the file or environment source.
+type VaultSource struct {
+	mu             sync.RWMutex
+	computedConfig *Config
+	refreshAt      time.Time
+	backoff        *backoff.ExponentialBackOff
+	reset          chan struct{}
+
+	ChangeDispatcher
+}
+
+// NewVaultSource creates a new VaultSource.
+func NewVaultSource(ctx context.Context, underlying Source, listeners ...ChangeListener) *VaultSource {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxInterval = time.Minute
+	bo.MaxElapsedTime = 0
+
+	src := &VaultSource{
+		backoff: bo,
+		reset:   make(chan struct{}, 1),
+	}
+	for _, li := range listeners {
+		src.OnConfigChange(ctx, li)
+	}
+	underlying.OnConfigChange(ctx, func(ctx context.Context, cfg *Config) {
+		src.update(cfg)
+		src.Trigger(ctx, cfg)
+	})
+	src.update(underlying.GetConfig())
+	go src.run(ctx)
+	return src
+}
+
+// GetConfig gets the current config.
+func (src *VaultSource) GetConfig() *Config {
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+
+	return src.computedConfig
+}
+
+func (src *VaultSource) update(cfg *Config) {
+	src.mu.Lock()
+	src.computedConfig = cfg
+	src.refreshAt = cfg.Options.getRefreshAt()
+	src.backoff.Reset()
+	src.mu.Unlock()
+
+	select {
+	case src.reset <- struct{}{}:
+	default:
+	}
+}
+
+func (src *VaultSource) run(ctx context.Context) {
+	for {
+		src.mu.RLock()
+		refreshAt := src.refreshAt
+		src.mu.RUnlock()
+
+		var refresh <-chan time.Time
+		var timer *time.Timer
+		if !refreshAt.IsZero() {
+			timer = time.NewTimer(time.Until(refreshAt))
+			refresh = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-src.reset:
+		case <-refresh:
+			src.refresh(ctx)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (src *VaultSource) refresh(ctx context.Context) {
+	src.mu.RLock()
+	current := src.computedConfig
+	src.mu.RUnlock()
+
+	// the secrets are loaded without holding the lock, so that getting the config isn't blocked by Vault
+	cfg := current.Clone()
+	options, err := cfg.Options.MergeConfigData(nil, "")
+
+	src.mu.Lock()
+	if src.computedConfig != current {
+		// the underlying config changed while the secrets were loaded
+		src.mu.Unlock()
+		return
+	}
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("config: error reloading secrets from vault")
+		metrics.SetConfigInfo(ctx, cfg.Options.Services, "vault", cfg.Checksum(), false)
+		src.refreshAt = time.Now().Add(src.backoff.NextBackOff())
+		src.mu.Unlock()
+		return
+	}
+	cfg.Options = options
+	metrics.SetConfigInfo(ctx, cfg.Options.Services, "vault", cfg.Checksum(), true)
+	src.computedConfig = cfg
+	src.refreshAt = options.getRefreshAt()
+	src.backoff.Reset()
+	src.mu.Unlock()
+
+	log.Info(ctx).Msg("config: secrets and certificates reloaded, reconfiguring...")
+	src.Trigger(ctx, cfg)
+}
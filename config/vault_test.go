@@ -0,0 +1,223 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault is a fake Vault server with a single KV version 2 secret and a PKI role.
+type fakeVault struct {
+	mu        sync.Mutex
+	tokenTTL  int64
+	secret    map[string]interface{}
+	certTTL   time.Duration
+	issued    int
+	renewed   int
+	cert, key string
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != "TOKEN" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"errors": ["permission denied"]}`)
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var res interface{}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/auth/token/lookup-self":
+		res = map[string]interface{}{"data": map[string]interface{}{"ttl": v.tokenTTL, "renewable": true}}
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/token/renew-self":
+		v.renewed++
+		res = map[string]interface{}{"auth": map[string]interface{}{"lease_duration": v.tokenTTL, "renewable": true}}
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/pomerium":
+		res = map[string]interface{}{"data": map[string]interface{}{"data": v.secret}}
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/pki/issue/pomerium":
+		var req struct {
+			CommonName string `json:"common_name"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.CommonName != "*.example.com" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		v.issued++
+		res = map[string]interface{}{"data": map[string]interface{}{
+			"certificate": v.cert,
+			"ca_chain":    []string{},
+			"private_key": v.key,
+			"expiration":  time.Now().Add(v.certTTL).Unix(),
+		}}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors": []}`)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func newFakeVault(t *testing.T) *fakeVault {
+	cert, err := ioutil.ReadFile("testdata/example-cert.pem")
+	require.NoError(t, err)
+	key, err := ioutil.ReadFile("testdata/example-key.pem")
+	require.NoError(t, err)
+	return &fakeVault{
+		tokenTTL: 3600,
+		secret: map[string]interface{}{
+			"shared_secret": "YixWi1MYh77NMECGGIJQevoonYtVF+ZPRkQZrrmeRqM=",
+			"cookie_secret": "OqJfHAblE6PI7jR3fo/4TEXPhB0Ggx0X+AKUMl9StbU=",
+			"client_secret": "CLIENT_SECRET",
+		},
+		certTTL: 24 * time.Hour,
+		cert:    string(cert),
+		key:     string(key),
+	}
+}
+
+func TestOptions_loadVaultSecrets(t *testing.T) {
+	fv := newFakeVault(t)
+	srv := httptest.NewServer(fv)
+	defer srv.Close()
+
+	newOptions := func() *Options {
+		o := NewDefaultOptions()
+		o.VaultAddress = srv.URL
+		o.VaultToken = "TOKEN"
+		o.VaultSecrets = map[string]string{
+			"shared_secret":     "secret/pomerium#shared_secret",
+			"cookie_secret":     "secret/pomerium#cookie_secret",
+			"idp_client_secret": "secret/pomerium#client_secret",
+		}
+		o.VaultPKIRole = "pki/pomerium"
+		o.VaultPKICommonName = "*.example.com"
+		return o
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		o := newOptions()
+		require.NoError(t, o.loadVaultSecrets(context.Background(), nil))
+		assert.Equal(t, "YixWi1MYh77NMECGGIJQevoonYtVF+ZPRkQZrrmeRqM=", o.SharedKey)
+		assert.Equal(t, "OqJfHAblE6PI7jR3fo/4TEXPhB0Ggx0X+AKUMl9StbU=", o.CookieSecret)
+		assert.Equal(t, "CLIENT_SECRET", o.ClientSecret)
+		if assert.Len(t, o.CertificateFiles, 1) {
+			assert.Equal(t, base64.StdEncoding.EncodeToString([]byte(fv.cert)), o.CertificateFiles[0].CertFile)
+		}
+		certs, err := o.GetCertificates()
+		assert.NoError(t, err)
+		assert.Len(t, certs, 1)
+		assert.Equal(t, 1, fv.issued)
+		assert.Equal(t, 1, fv.renewed)
+		assert.WithinDuration(t, time.Now().Add(30*time.Minute), o.vaultRefreshAt, time.Minute, "should renew at half the token ttl")
+	})
+	t.Run("short lived certificate", func(t *testing.T) {
+		fv.certTTL = 3 * time.Minute
+		defer func() { fv.certTTL = 24 * time.Hour }()
+
+		o := newOptions()
+		require.NoError(t, o.loadVaultSecrets(context.Background(), nil))
+		assert.WithinDuration(t, time.Now().Add(2*time.Minute), o.vaultRefreshAt, 5*time.Second)
+	})
+	t.Run("reused", func(t *testing.T) {
+		prev := newOptions()
+		require.NoError(t, prev.loadVaultSecrets(context.Background(), nil))
+		issued := fv.issued
+
+		o := newOptions()
+		require.NoError(t, o.loadVaultSecrets(context.Background(), prev))
+		assert.Equal(t, issued, fv.issued, "should reuse the secrets loaded for the same settings")
+		assert.Equal(t, "YixWi1MYh77NMECGGIJQevoonYtVF+ZPRkQZrrmeRqM=", o.SharedKey)
+		assert.Len(t, o.CertificateFiles, 1)
+		assert.Equal(t, prev.vaultRefreshAt, o.vaultRefreshAt)
+
+		o = newOptions()
+		o.VaultPKIAltNames = []string{"example.com"}
+		require.NoError(t, o.loadVaultSecrets(context.Background(), prev))
+		assert.Equal(t, issued+1, fv.issued, "should load the secrets again when the settings change")
+
+		prev.vaultSecrets.refreshAt = time.Now().Add(-time.Second)
+		o = newOptions()
+		require.NoError(t, o.loadVaultSecrets(context.Background(), prev))
+		assert.Equal(t, issued+2, fv.issued, "should load the secrets again when they should be refreshed")
+	})
+	t.Run("bad token", func(t *testing.T) {
+		o := newOptions()
+		o.VaultToken = "WRONG"
+		assert.EqualError(t, o.loadVaultSecrets(context.Background(), nil),
+			"config: error looking up vault token: vault: unexpected status code for /v1/auth/token/lookup-self: 403 permission denied")
+	})
+	t.Run("missing key", func(t *testing.T) {
+		o := newOptions()
+		o.VaultSecrets = map[string]string{"shared_secret": "secret/pomerium#missing"}
+		assert.Error(t, o.loadVaultSecrets(context.Background(), nil))
+	})
+	t.Run("unsupported setting", func(t *testing.T) {
+		o := newOptions()
+		o.VaultSecrets = map[string]string{"authenticate_service_url": "secret/pomerium#shared_secret"}
+		assert.Error(t, o.loadVaultSecrets(context.Background(), nil))
+	})
+	t.Run("bad reference", func(t *testing.T) {
+		o := newOptions()
+		o.VaultSecrets = map[string]string{"shared_secret": "secret/pomerium"}
+		assert.Error(t, o.loadVaultSecrets(context.Background(), nil))
+	})
+	t.Run("missing address", func(t *testing.T) {
+		o := newOptions()
+		o.VaultAddress = ""
+		assert.Error(t, o.loadVaultSecrets(context.Background(), nil))
+	})
+}
+
+func TestVaultSource(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer clearTimeout()
+
+	fv := newFakeVault(t)
+	fv.tokenTTL = 2
+	srv := httptest.NewServer(fv)
+	defer srv.Close()
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(fmt.Sprintf(`
+insecure_server: true
+vault_address: %s
+vault_token: TOKEN
+vault_secrets:
+  shared_secret: secret/pomerium#shared_secret
+`, srv.URL)), 0o600))
+
+	underlying, err := NewFileOrEnvironmentSource(configFile, "")
+	require.NoError(t, err)
+	assert.Equal(t, "YixWi1MYh77NMECGGIJQevoonYtVF+ZPRkQZrrmeRqM=", underlying.GetConfig().Options.SharedKey)
+
+	changes := make(chan *Config, 10)
+	NewVaultSource(ctx, underlying, func(ctx context.Context, cfg *Config) {
+		changes <- cfg
+	})
+
+	// rotate the secret, it should be reloaded when the token is renewed
+	fv.mu.Lock()
+	fv.secret["shared_secret"] = "OqJfHAblE6PI7jR3fo/4TEXPhB0Ggx0X+AKUMl9StbU="
+	fv.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("expected config to be reloaded")
+	case cfg := <-changes:
+		assert.Equal(t, "OqJfHAblE6PI7jR3fo/4TEXPhB0Ggx0X+AKUMl9StbU=", cfg.Options.SharedKey)
+	}
+}
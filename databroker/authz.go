@@ -0,0 +1,241 @@
+package databroker
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/autocert"
+	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/events"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// metadataKeyClientCertificate is the header envoy uses to forward the details of the client certificate
+// presented to the gRPC listener.
+const metadataKeyClientCertificate = "x-forwarded-client-cert"
+
+// permissions are the databroker methods and record types a service is allowed to use.
+type permissions struct {
+	// all is true if the service may read and write every record type.
+	all bool
+	// get are the record types which may be read by id, query the types which may also be listed and synced.
+	get, query map[string]bool
+	// put are the record types which may be written, del the types whose records may only be deleted.
+	put, del map[string]bool
+}
+
+var (
+	fullPermissions = &permissions{all: true}
+	// proxyPermissions only give the proxy the records it needs, so that a compromised proxy can't read the
+	// sessions and users of every user. Sessions are read by the user info endpoint and deleted on sign out.
+	proxyPermissions = &permissions{
+		get: map[string]bool{
+			grpcutil.GetTypeURL(new(session.Session)): true,
+		},
+		query: map[string]bool{
+			grpcutil.GetTypeURL(new(configpb.Config)): true,
+			autocert.StorageRecordType:                true,
+		},
+		put: map[string]bool{
+			grpcutil.GetTypeURL(new(events.EnvoyConfigurationEvent)): true,
+			autocert.StorageRecordType:                               true,
+		},
+		del: map[string]bool{
+			grpcutil.GetTypeURL(new(session.Session)): true,
+		},
+	}
+)
+
+func (p *permissions) canGet(recordType string) bool {
+	return p.all || p.get[recordType] || p.query[recordType]
+}
+
+func (p *permissions) canQuery(recordType string) bool {
+	return p.all || p.query[recordType]
+}
+
+func (p *permissions) canPut(record *databrokerpb.Record) bool {
+	if p.all || p.put[record.GetType()] {
+		return true
+	}
+	return p.del[record.GetType()] && record.GetDeletedAt() != nil
+}
+
+func (p *permissions) canSetOptions(recordType string) bool {
+	return p.all || p.put[recordType]
+}
+
+// getPermissions returns the permissions of the service making the request.
+func (srv *dataBrokerServer) getPermissions(ctx context.Context) (*permissions, error) {
+	service, err := srv.getService(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	// clients which don't identify themselves predate per-service permissions
+	case service == "":
+		return fullPermissions, nil
+	case service == config.ServiceProxy:
+		return proxyPermissions, nil
+	case config.IsValidService(service):
+		return fullPermissions, nil
+	}
+	return nil, status.Errorf(codes.PermissionDenied, "unknown service: %q", service)
+}
+
+// getService returns the name of the service making the request. When client certificates are required, the
+// service is the common name of the client certificate, and the subject of the signed JWT must match it.
+func (srv *dataBrokerServer) getService(ctx context.Context) (string, error) {
+	if isLocalCall(ctx) {
+		return config.ServiceDataBroker, nil
+	}
+
+	subject, err := grpcutil.GetSignedJWTSubject(ctx, srv.sharedKey.Load().([]byte))
+	if err != nil {
+		return "", err
+	}
+
+	if required, _ := srv.requireClientCertificates.Load().(bool); !required {
+		return subject, nil
+	}
+
+	commonName := getClientCertificateCommonName(ctx)
+	if commonName == "" {
+		return "", status.Error(codes.Unauthenticated, "client certificate required")
+	}
+	if subject != commonName {
+		return "", status.Errorf(codes.Unauthenticated,
+			"JWT subject %q does not match client certificate common name %q", subject, commonName)
+	}
+	return commonName, nil
+}
+
+func permissionDenied(method, recordType string) error {
+	return status.Errorf(codes.PermissionDenied, "%s of %s records is not allowed", method, recordType)
+}
+
+// getClientCertificateCommonName returns the common name of the client certificate forwarded by envoy, or "" if
+// there isn't one.
+func getClientCertificateCommonName(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(metadataKeyClientCertificate)
+	if len(values) == 0 {
+		return ""
+	}
+
+	subject := parseForwardedClientCert(values[0])["Subject"]
+	for _, rdn := range strings.Split(subject, ",") {
+		if strings.HasPrefix(rdn, "CN=") {
+			return strings.TrimPrefix(rdn, "CN=")
+		}
+	}
+	return ""
+}
+
+// parseForwardedClientCert parses the key/value pairs of the first element of an x-forwarded-client-cert
+// header, such as `Hash=abc;Subject="CN=proxy,O=Example"`. Envoy sets a single element since it sanitizes the
+// header.
+func parseForwardedClientCert(header string) map[string]string {
+	pairs := make(map[string]string)
+	var key string
+	var cur strings.Builder
+	inKey, inQuotes := true, false
+	finish := func() {
+		if !inKey {
+			pairs[key] = cur.String()
+		}
+		key, inKey = "", true
+		cur.Reset()
+	}
+	for i := 0; i < len(header); i++ {
+		c := header[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(header):
+			i++
+			cur.WriteByte(header[i])
+		case c == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && c == ',':
+			finish()
+			return pairs
+		case !inQuotes && c == ';':
+			finish()
+		case !inQuotes && inKey && c == '=':
+			key, inKey = cur.String(), false
+			cur.Reset()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	finish()
+	return pairs
+}
+
+type localCallContextKey struct{}
+
+// isLocalCall returns true if the request was made to the local gRPC server, which is only reachable from the
+// databroker process.
+func isLocalCall(ctx context.Context) bool {
+	local, _ := ctx.Value(localCallContextKey{}).(bool)
+	return local
+}
+
+type localServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss localServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+// localUnaryServerInterceptor marks requests made to the local gRPC server.
+func localUnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(context.WithValue(ctx, localCallContextKey{}, true), req)
+}
+
+// localStreamServerInterceptor marks streams opened on the local gRPC server.
+func localStreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, localServerStream{
+		ServerStream: ss,
+		ctx:          context.WithValue(ss.Context(), localCallContextKey{}, true),
+	})
+}
+
+// filteredSyncServer only sends the records of the types which may be queried.
+type filteredSyncServer struct {
+	databrokerpb.DataBrokerService_SyncServer
+	permissions *permissions
+}
+
+func (stream filteredSyncServer) Send(res *databrokerpb.SyncResponse) error {
+	if !stream.permissions.canQuery(res.GetRecord().GetType()) {
+		return nil
+	}
+	return stream.DataBrokerService_SyncServer.Send(res)
+}
+
+// filteredSyncLatestServer only sends the records of the types which may be queried.
+type filteredSyncLatestServer struct {
+	databrokerpb.DataBrokerService_SyncLatestServer
+	permissions *permissions
+}
+
+func (stream filteredSyncLatestServer) Send(res *databrokerpb.SyncLatestResponse) error {
+	if res.GetRecord() != nil && !stream.permissions.canQuery(res.GetRecord().GetType()) {
+		return nil
+	}
+	return stream.DataBrokerService_SyncLatestServer.Send(res)
+}
@@ -0,0 +1,171 @@
+package databroker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+func TestParseForwardedClientCert(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"Hash":    "abc",
+		"Subject": `CN=proxy,O="Example; Inc"`,
+	}, parseForwardedClientCert(`Hash=abc;Subject="CN=proxy,O=\"Example; Inc\"",Hash=def;Subject="CN=authorize"`))
+	assert.Equal(t, map[string]string{}, parseForwardedClientCert(""))
+}
+
+func TestDataBrokerServer_getService(t *testing.T) {
+	key := cryptutil.NewKey()
+	srv := &dataBrokerServer{}
+	srv.sharedKey.Store(key)
+
+	t.Run("jwt", func(t *testing.T) {
+		srv.requireClientCertificates.Store(false)
+
+		service, err := srv.getService(incomingServiceContext(t, key, "proxy", ""))
+		assert.NoError(t, err)
+		assert.Equal(t, "proxy", service)
+
+		_, err = srv.getService(incomingServiceContext(t, cryptutil.NewKey(), "proxy", ""))
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+	t.Run("client certificate", func(t *testing.T) {
+		srv.requireClientCertificates.Store(true)
+
+		service, err := srv.getService(incomingServiceContext(t, key, "proxy", `Hash=abc;Subject="CN=proxy,O=Example"`))
+		assert.NoError(t, err)
+		assert.Equal(t, "proxy", service)
+
+		_, err = srv.getService(incomingServiceContext(t, key, "proxy", ""))
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "missing certificate")
+
+		_, err = srv.getService(incomingServiceContext(t, key, "authorize", `Hash=abc;Subject="CN=proxy"`))
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "mismatched JWT")
+
+		_, err = srv.getService(incomingServiceContext(t, key, "", `Hash=abc;Subject="CN=proxy"`))
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), "legacy JWT")
+	})
+	t.Run("local", func(t *testing.T) {
+		srv.requireClientCertificates.Store(true)
+
+		service, err := srv.getService(context.WithValue(context.Background(), localCallContextKey{}, true))
+		assert.NoError(t, err)
+		assert.Equal(t, "databroker", service)
+	})
+}
+
+func TestDataBrokerServer_permissions(t *testing.T) {
+	key := cryptutil.NewKey()
+	srv := &dataBrokerServer{server: internal_databroker.New()}
+	srv.sharedKey.Store(key)
+	srv.requireClientCertificates.Store(true)
+
+	authorizeCtx := incomingServiceContext(t, key, "authorize", `Hash=abc;Subject="CN=authorize"`)
+	proxyCtx := incomingServiceContext(t, key, "proxy", `Hash=def;Subject="CN=proxy"`)
+
+	sessionData, _ := anypb.New(&session.Session{Id: "SESSION_ID"})
+	userData, _ := anypb.New(&user.User{Id: "USER_ID"})
+	configData, _ := anypb.New(&configpb.Config{Name: "CONFIG"})
+	for _, record := range []*databroker.Record{
+		{Type: sessionData.GetTypeUrl(), Id: "SESSION_ID", Data: sessionData},
+		{Type: userData.GetTypeUrl(), Id: "USER_ID", Data: userData},
+		{Type: configData.GetTypeUrl(), Id: "CONFIG", Data: configData},
+	} {
+		_, err := srv.Put(authorizeCtx, &databroker.PutRequest{Record: record})
+		require.NoError(t, err)
+	}
+
+	t.Run("get", func(t *testing.T) {
+		_, err := srv.Get(proxyCtx, &databroker.GetRequest{Type: sessionData.GetTypeUrl(), Id: "SESSION_ID"})
+		assert.NoError(t, err)
+		_, err = srv.Get(proxyCtx, &databroker.GetRequest{Type: userData.GetTypeUrl(), Id: "USER_ID"})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = srv.Get(authorizeCtx, &databroker.GetRequest{Type: userData.GetTypeUrl(), Id: "USER_ID"})
+		assert.NoError(t, err)
+	})
+	t.Run("query", func(t *testing.T) {
+		_, err := srv.Query(proxyCtx, &databroker.QueryRequest{Type: configData.GetTypeUrl()})
+		assert.NoError(t, err)
+		_, err = srv.Query(proxyCtx, &databroker.QueryRequest{Type: sessionData.GetTypeUrl()})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+	t.Run("put", func(t *testing.T) {
+		_, err := srv.Put(proxyCtx, &databroker.PutRequest{Record: &databroker.Record{
+			Type: sessionData.GetTypeUrl(), Id: "OTHER_SESSION_ID", Data: sessionData,
+		}})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		_, err = srv.Put(proxyCtx, &databroker.PutRequest{Record: &databroker.Record{
+			Type: sessionData.GetTypeUrl(), Id: "OTHER_SESSION_ID", Data: sessionData, DeletedAt: timestamppb.Now(),
+		}})
+		assert.NoError(t, err)
+		_, err = srv.SetOptions(proxyCtx, &databroker.SetOptionsRequest{Type: userData.GetTypeUrl()})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+	t.Run("sync latest", func(t *testing.T) {
+		stream := &syncLatestServer{ctx: proxyCtx}
+		err := srv.SyncLatest(&databroker.SyncLatestRequest{}, stream)
+		assert.NoError(t, err)
+		if assert.Len(t, stream.records, 1) {
+			assert.Equal(t, configData.GetTypeUrl(), stream.records[0].GetType())
+		}
+
+		err = srv.SyncLatest(&databroker.SyncLatestRequest{Type: userData.GetTypeUrl()}, &syncLatestServer{ctx: proxyCtx})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		stream = &syncLatestServer{ctx: authorizeCtx}
+		err = srv.SyncLatest(&databroker.SyncLatestRequest{}, stream)
+		assert.NoError(t, err)
+		assert.Len(t, stream.records, 3)
+	})
+}
+
+type syncLatestServer struct {
+	databroker.DataBrokerService_SyncLatestServer
+	ctx     context.Context
+	records []*databroker.Record
+}
+
+func (stream *syncLatestServer) Context() context.Context {
+	return stream.ctx
+}
+
+func (stream *syncLatestServer) Send(res *databroker.SyncLatestResponse) error {
+	if res.GetRecord() != nil {
+		stream.records = append(stream.records, res.GetRecord())
+	}
+	return nil
+}
+
+// incomingServiceContext returns the context of a request made by the given service, with the client certificate
+// details forwarded by envoy.
+func incomingServiceContext(t *testing.T, key []byte, service, clientCert string) context.Context {
+	var ctx context.Context
+	err := grpcutil.WithUnarySignedServiceJWT(key, service)(context.Background(), "", nil, nil, nil,
+		func(outgoing context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+			ctx = outgoing
+			return nil
+		})
+	require.NoError(t, err)
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if clientCert != "" {
+		md.Set(metadataKeyClientCertificate, clientCert)
+	}
+	return metadata.NewIncomingContext(context.Background(), md)
+}
@@ -14,10 +14,12 @@ import (
 	"google.golang.org/grpc/metadata"
 
 	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/cdc"
 	"github.com/pomerium/pomerium/internal/directory"
 	"github.com/pomerium/pomerium/internal/envoy/files"
 	"github.com/pomerium/pomerium/internal/identity"
 	"github.com/pomerium/pomerium/internal/identity/manager"
+	"github.com/pomerium/pomerium/internal/internalca"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry"
 	"github.com/pomerium/pomerium/internal/version"
@@ -41,6 +43,13 @@ type DataBroker struct {
 
 	mu                sync.Mutex
 	directoryProvider directory.Provider
+
+	internalCABootstrap *internalca.BootstrapServer
+
+	cdcPublisher *cdc.Publisher
+	cdcSink      cdc.Sink
+	cdcURL       string
+	cdcTopic     string
 }
 
 // New creates a new databroker service.
@@ -62,15 +71,15 @@ func New(cfg *config.Config) (*DataBroker, error) {
 	// No metrics handler because we have one in the control plane.  Add one
 	// if we no longer register with that grpc Server
 	localGRPCServer := grpc.NewServer(
-		grpc.StreamInterceptor(si),
-		grpc.UnaryInterceptor(ui),
+		grpc.ChainStreamInterceptor(si, localStreamServerInterceptor),
+		grpc.ChainUnaryInterceptor(ui, localUnaryServerInterceptor),
 	)
 
 	clientStatsHandler := telemetry.NewGRPCClientStatsHandler(cfg.Options.Services)
 	clientDialOptions := []grpc.DialOption{
 		grpc.WithInsecure(),
-		grpc.WithChainUnaryInterceptor(clientStatsHandler.UnaryInterceptor, grpcutil.WithUnarySignedJWT(sharedKey)),
-		grpc.WithChainStreamInterceptor(grpcutil.WithStreamSignedJWT(sharedKey)),
+		grpc.WithChainUnaryInterceptor(clientStatsHandler.UnaryInterceptor, grpcutil.WithUnarySignedServiceJWT(sharedKey, config.ServiceDataBroker)),
+		grpc.WithChainStreamInterceptor(grpcutil.WithStreamSignedServiceJWT(sharedKey, config.ServiceDataBroker)),
 		grpc.WithStatsHandler(clientStatsHandler.Handler),
 	}
 
@@ -96,6 +105,7 @@ func New(cfg *config.Config) (*DataBroker, error) {
 		localGRPCConnection:          localGRPCConnection,
 		deprecatedCacheClusterDomain: dataBrokerURLs[0].Hostname(),
 		dataBrokerStorageType:        cfg.Options.DataBrokerStorageType,
+		internalCABootstrap:          internalca.NewBootstrapServer(isInternalCAClient),
 	}
 	c.Register(c.localGRPCServer)
 
@@ -122,6 +132,7 @@ func (c *DataBroker) Register(grpcServer *grpc.Server) {
 	databroker.RegisterDataBrokerServiceServer(grpcServer, c.dataBrokerServer)
 	directory.RegisterDirectoryServiceServer(grpcServer, c)
 	registry.RegisterRegistryServer(grpcServer, c.dataBrokerServer)
+	c.internalCABootstrap.Register(grpcServer)
 }
 
 // Run runs the databroker components.
@@ -138,6 +149,9 @@ func (c *DataBroker) Run(ctx context.Context) error {
 	eg.Go(func() error {
 		return c.manager.Run(ctx)
 	})
+	eg.Go(func() error {
+		return c.cdcPublisher.Run(ctx)
+	})
 	return eg.Wait()
 }
 
@@ -146,6 +160,10 @@ func (c *DataBroker) update(cfg *config.Config) error {
 		return fmt.Errorf("databroker: bad option: %w", err)
 	}
 
+	if err := c.updateInternalCA(cfg); err != nil {
+		return err
+	}
+
 	oauthOptions, err := cfg.Options.GetOauthOptions()
 	if err != nil {
 		return fmt.Errorf("databroker: invalid oauth options: %w", err)
@@ -176,6 +194,8 @@ func (c *DataBroker) update(cfg *config.Config) error {
 		manager.WithDataBrokerClient(dataBrokerClient),
 		manager.WithGroupRefreshInterval(cfg.Options.RefreshDirectoryInterval),
 		manager.WithGroupRefreshTimeout(cfg.Options.RefreshDirectoryTimeout),
+		manager.WithClaimsTransform(cfg.Options.ClaimTransforms.Apply),
+		manager.WithIdPOutageGracePeriod(cfg.Options.IdPOutageGracePeriod),
 	}
 
 	if c.manager == nil {
@@ -184,6 +204,46 @@ func (c *DataBroker) update(cfg *config.Config) error {
 		c.manager.UpdateConfig(options...)
 	}
 
+	return c.updateCDC(cfg, dataBrokerClient)
+}
+
+func (c *DataBroker) updateCDC(cfg *config.Config, dataBrokerClient databroker.DataBrokerServiceClient) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	oldSink := c.cdcSink
+	if cfg.Options.DataBrokerCDCURL != c.cdcURL || cfg.Options.DataBrokerCDCTopic != c.cdcTopic {
+		var sink cdc.Sink
+		if cfg.Options.DataBrokerCDCURL != "" {
+			var err error
+			sink, err = cdc.NewSink(cfg.Options.DataBrokerCDCURL, cfg.Options.DataBrokerCDCTopic)
+			if err != nil {
+				return fmt.Errorf("databroker: failed to create cdc sink: %w", err)
+			}
+		}
+		c.cdcSink = sink
+		c.cdcURL = cfg.Options.DataBrokerCDCURL
+		c.cdcTopic = cfg.Options.DataBrokerCDCTopic
+	}
+
+	options := []cdc.Option{
+		cdc.WithDataBrokerClient(dataBrokerClient),
+		cdc.WithSink(c.cdcSink),
+		cdc.WithRecordTypes(cfg.Options.DataBrokerCDCRecordTypes),
+		cdc.WithFormat(cfg.Options.DataBrokerCDCFormat),
+	}
+	if c.cdcPublisher == nil {
+		c.cdcPublisher = cdc.New(options...)
+	} else {
+		c.cdcPublisher.UpdateConfig(options...)
+	}
+
+	// close the previous sink once the publisher no longer uses it
+	if oldSink != nil && oldSink != c.cdcSink {
+		if err := oldSink.Close(); err != nil {
+			log.Warn(context.TODO()).Err(err).Msg("databroker: error closing cdc sink")
+		}
+	}
 	return nil
 }
 
@@ -199,3 +259,36 @@ func validate(o *config.Options) error {
 	}
 	return nil
 }
+
+// updateInternalCA updates the CA the bootstrap service issues the certificates of the other services from.
+func (c *DataBroker) updateInternalCA(cfg *config.Config) error {
+	if !cfg.Options.InternalCA {
+		c.internalCABootstrap.Update(nil, nil)
+		return nil
+	}
+
+	key, err := cfg.Options.GetInternalCAKey()
+	if err != nil {
+		return fmt.Errorf("databroker: invalid internal_ca_key: %w", err)
+	}
+	ca, err := internalca.Get(key)
+	if err != nil {
+		return fmt.Errorf("databroker: invalid internal CA: %w", err)
+	}
+	sharedKey, err := cfg.Options.GetSharedKey()
+	if err != nil {
+		return fmt.Errorf("databroker: invalid shared key: %w", err)
+	}
+	c.internalCABootstrap.Update(ca, sharedKey)
+	return nil
+}
+
+// isInternalCAClient returns true if the service may request a certificate from the internal CA. The databroker
+// issues its own certificates, so a certificate for it can't be requested.
+func isInternalCAClient(service string) bool {
+	switch service {
+	case config.ServiceAuthenticate, config.ServiceAuthorize, config.ServiceProxy:
+		return true
+	}
+	return false
+}
@@ -11,13 +11,13 @@ import (
 	"github.com/pomerium/pomerium/internal/databroker"
 	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
 	registrypb "github.com/pomerium/pomerium/pkg/grpc/registry"
-	"github.com/pomerium/pomerium/pkg/grpcutil"
 )
 
 // A dataBrokerServer implements the data broker service interface.
 type dataBrokerServer struct {
-	server    *databroker.Server
-	sharedKey atomic.Value
+	server                    *databroker.Server
+	sharedKey                 atomic.Value
+	requireClientCertificates atomic.Value
 }
 
 // newDataBrokerServer creates a new databroker service server.
@@ -40,9 +40,16 @@ func (srv *dataBrokerServer) getOptions(cfg *config.Config) []databroker.ServerO
 		databroker.WithGetSharedKey(cfg.Options.GetSharedKey),
 		databroker.WithStorageType(cfg.Options.DataBrokerStorageType),
 		databroker.WithStorageConnectionString(cfg.Options.DataBrokerStorageConnectionString),
+		databroker.WithStorageCA(cfg.Options.DataBrokerStorageCA),
 		databroker.WithStorageCAFile(cfg.Options.DataBrokerStorageCAFile),
 		databroker.WithStorageCertificate(cert),
 		databroker.WithStorageCertSkipVerify(cfg.Options.DataBrokerStorageCertSkipVerify),
+		databroker.WithStorageRequireTLS(cfg.Options.DataBrokerStorageTLS),
+		databroker.WithStorageAuth(cfg.Options.DataBrokerStorageUsername, cfg.Options.DataBrokerStoragePassword),
+		databroker.WithStorageDB(cfg.Options.DataBrokerStorageDB),
+		databroker.WithStorageSentinelMaster(cfg.Options.DataBrokerStorageSentinelMaster),
+		databroker.WithStorageSnapshot(cfg.Options.DataBrokerStorageSnapshotFile, cfg.Options.DataBrokerStorageSnapshotInterval),
+		databroker.WithStoragePlugin(cfg.Options.DataBrokerStoragePlugin),
 	}
 }
 
@@ -52,91 +59,119 @@ func (srv *dataBrokerServer) setKey(cfg *config.Config) {
 		bs = make([]byte, 0)
 	}
 	srv.sharedKey.Store(bs)
+	srv.requireClientCertificates.Store(cfg.Options.RequireGRPCClientCertificates())
 }
 
 // Databroker functions
 
 func (srv *dataBrokerServer) AcquireLease(ctx context.Context, req *databrokerpb.AcquireLeaseRequest) (*databrokerpb.AcquireLeaseResponse, error) {
-	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+	if _, err := srv.getPermissions(ctx); err != nil {
 		return nil, err
 	}
 	return srv.server.AcquireLease(ctx, req)
 }
 
 func (srv *dataBrokerServer) Get(ctx context.Context, req *databrokerpb.GetRequest) (*databrokerpb.GetResponse, error) {
-	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+	perms, err := srv.getPermissions(ctx)
+	if err != nil {
 		return nil, err
 	}
+	if !perms.canGet(req.GetType()) {
+		return nil, permissionDenied("get", req.GetType())
+	}
 	return srv.server.Get(ctx, req)
 }
 
 func (srv *dataBrokerServer) Query(ctx context.Context, req *databrokerpb.QueryRequest) (*databrokerpb.QueryResponse, error) {
-	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+	perms, err := srv.getPermissions(ctx)
+	if err != nil {
 		return nil, err
 	}
+	if !perms.canQuery(req.GetType()) {
+		return nil, permissionDenied("query", req.GetType())
+	}
 	return srv.server.Query(ctx, req)
 }
 
 func (srv *dataBrokerServer) Put(ctx context.Context, req *databrokerpb.PutRequest) (*databrokerpb.PutResponse, error) {
-	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+	perms, err := srv.getPermissions(ctx)
+	if err != nil {
 		return nil, err
 	}
+	if !perms.canPut(req.GetRecord()) {
+		return nil, permissionDenied("put", req.GetRecord().GetType())
+	}
 	return srv.server.Put(ctx, req)
 }
 
 func (srv *dataBrokerServer) ReleaseLease(ctx context.Context, req *databrokerpb.ReleaseLeaseRequest) (*emptypb.Empty, error) {
-	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+	if _, err := srv.getPermissions(ctx); err != nil {
 		return nil, err
 	}
 	return srv.server.ReleaseLease(ctx, req)
 }
 
 func (srv *dataBrokerServer) RenewLease(ctx context.Context, req *databrokerpb.RenewLeaseRequest) (*emptypb.Empty, error) {
-	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+	if _, err := srv.getPermissions(ctx); err != nil {
 		return nil, err
 	}
 	return srv.server.RenewLease(ctx, req)
 }
 
 func (srv *dataBrokerServer) SetOptions(ctx context.Context, req *databrokerpb.SetOptionsRequest) (*databrokerpb.SetOptionsResponse, error) {
-	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+	perms, err := srv.getPermissions(ctx)
+	if err != nil {
 		return nil, err
 	}
+	if !perms.canSetOptions(req.GetType()) {
+		return nil, permissionDenied("set options", req.GetType())
+	}
 	return srv.server.SetOptions(ctx, req)
 }
 
 func (srv *dataBrokerServer) Sync(req *databrokerpb.SyncRequest, stream databrokerpb.DataBrokerService_SyncServer) error {
-	if err := grpcutil.RequireSignedJWT(stream.Context(), srv.sharedKey.Load().([]byte)); err != nil {
+	perms, err := srv.getPermissions(stream.Context())
+	if err != nil {
 		return err
 	}
+	if !perms.all {
+		stream = filteredSyncServer{DataBrokerService_SyncServer: stream, permissions: perms}
+	}
 	return srv.server.Sync(req, stream)
 }
 
 func (srv *dataBrokerServer) SyncLatest(req *databrokerpb.SyncLatestRequest, stream databrokerpb.DataBrokerService_SyncLatestServer) error {
-	if err := grpcutil.RequireSignedJWT(stream.Context(), srv.sharedKey.Load().([]byte)); err != nil {
+	perms, err := srv.getPermissions(stream.Context())
+	if err != nil {
 		return err
 	}
+	if req.GetType() != "" && !perms.canQuery(req.GetType()) {
+		return permissionDenied("sync", req.GetType())
+	}
+	if !perms.all {
+		stream = filteredSyncLatestServer{DataBrokerService_SyncLatestServer: stream, permissions: perms}
+	}
 	return srv.server.SyncLatest(req, stream)
 }
 
 // Registry functions
 
 func (srv *dataBrokerServer) Report(ctx context.Context, req *registrypb.RegisterRequest) (*registrypb.RegisterResponse, error) {
-	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+	if _, err := srv.getPermissions(ctx); err != nil {
 		return nil, err
 	}
 	return srv.server.Report(ctx, req)
 }
 
 func (srv *dataBrokerServer) List(ctx context.Context, req *registrypb.ListRequest) (*registrypb.ServiceList, error) {
-	if err := grpcutil.RequireSignedJWT(ctx, srv.sharedKey.Load().([]byte)); err != nil {
+	if _, err := srv.getPermissions(ctx); err != nil {
 		return nil, err
 	}
 	return srv.server.List(ctx, req)
 }
 
 func (srv *dataBrokerServer) Watch(req *registrypb.ListRequest, stream registrypb.Registry_WatchServer) error {
-	if err := grpcutil.RequireSignedJWT(stream.Context(), srv.sharedKey.Load().([]byte)); err != nil {
+	if _, err := srv.getPermissions(stream.Context()); err != nil {
 		return err
 	}
 	return srv.server.Watch(req, stream)
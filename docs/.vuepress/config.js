@@ -129,6 +129,7 @@ module.exports = {
             "topics/tcp-support",
             "topics/single-sign-out",
             "topics/load-balancing",
+            "topics/route-admin-api",
           ],
         },
         {
@@ -11,6 +11,7 @@ require (
 	github.com/btcsuite/btcutil v1.0.2
 	github.com/caddyserver/certmagic v0.14.1
 	github.com/cenkalti/backoff/v4 v4.1.1
+	github.com/census-instrumentation/opencensus-proto v0.2.1
 	github.com/cespare/xxhash/v2 v2.1.1
 	github.com/client9/misspell v0.3.4
 	github.com/coreos/go-oidc/v3 v3.0.0
@@ -39,6 +40,7 @@ require (
 	github.com/mitchellh/hashstructure/v2 v2.0.2
 	github.com/mitchellh/mapstructure v1.4.1
 	github.com/natefinch/atomic v0.0.0-20200526193002-18c0533a5b09
+	github.com/nats-io/nats.go v1.11.0
 	github.com/onsi/gocleanup v0.0.0-20140331211545-c1a5478700b5
 	github.com/open-policy-agent/opa v0.30.2
 	github.com/openzipkin/zipkin-go v0.2.5
@@ -53,6 +55,7 @@ require (
 	github.com/rs/cors v1.8.0
 	github.com/rs/zerolog v1.23.0
 	github.com/scylladb/go-set v1.0.2
+	github.com/segmentio/kafka-go v0.4.17
 	github.com/shirou/gopsutil/v3 v3.21.6
 	github.com/skratchdot/open-golang v0.0.0-20200116055534-eef842397966
 	github.com/spf13/cobra v1.2.1
@@ -0,0 +1,92 @@
+// Package accessrequest contains the requests users make for access to routes they've been denied. Requests
+// are stored in the databroker and approved with the admin API, which grants time-limited access to the route.
+package accessrequest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// RecordType is the databroker record type of access requests. Records are stored as JSON.
+const RecordType = "pomerium.io/AccessRequest"
+
+// A Status is the status of an access request.
+type Status string
+
+// Statuses
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusDenied   Status = "denied"
+)
+
+// An AccessRequest is a user's request for access to a route.
+type AccessRequest struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Email  string `json:"email,omitempty"`
+	// Route is the hostname of the route.
+	Route     string    `json:"route"`
+	Reason    string    `json:"reason,omitempty"`
+	Status    Status    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is when approved access ends.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// ID returns the id of a user's access request for a route. Each user has at most one request per route, so
+// requesting access again replaces the previous request.
+func ID(userID, route string) string {
+	return hex.EncodeToString(cryptutil.Hash("access_request", []byte(userID+"|"+route)))
+}
+
+// GrantsAccess returns true if the request is approved for the user and route hostname at the given time.
+func (r *AccessRequest) GrantsAccess(userID, hostname string, now time.Time) bool {
+	if r.Status != StatusApproved || r.UserID != userID || r.Route != hostname {
+		return false
+	}
+	return r.ExpiresAt != nil && now.Before(*r.ExpiresAt)
+}
+
+// ToRecord converts the access request into a databroker record.
+func (r *AccessRequest) ToRecord() (*databroker.Record, error) {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := anypb.New(wrapperspb.Bytes(bs))
+	if err != nil {
+		return nil, err
+	}
+	return &databroker.Record{
+		Type: RecordType,
+		Id:   r.ID,
+		Data: data,
+	}, nil
+}
+
+// FromRecord returns the access request stored in a databroker record.
+func FromRecord(record *databroker.Record) (*AccessRequest, error) {
+	var value wrapperspb.BytesValue
+	if err := record.GetData().UnmarshalTo(&value); err != nil {
+		return nil, fmt.Errorf("accessrequest: error decoding record: %w", err)
+	}
+	return FromBytes(value.GetValue())
+}
+
+// FromBytes returns the access request stored as JSON.
+func FromBytes(bs []byte) (*AccessRequest, error) {
+	var r AccessRequest
+	if err := json.Unmarshal(bs, &r); err != nil {
+		return nil, fmt.Errorf("accessrequest: error decoding access request: %w", err)
+	}
+	return &r, nil
+}
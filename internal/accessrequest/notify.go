@@ -0,0 +1,102 @@
+package accessrequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+var webhookHTTP = &http.Client{}
+
+// sendMail is swapped in tests.
+var sendMail = smtp.SendMail
+
+// Notify sends a new access request to the approvers and webhook of the route's access request settings.
+func Notify(ctx context.Context, smtpOptions *config.SMTP, settings *config.AccessRequests, r *AccessRequest) error {
+	if settings.WebhookURL != "" {
+		if err := notifyWebhook(ctx, settings.WebhookURL, r); err != nil {
+			return err
+		}
+	}
+	if len(settings.Approvers) > 0 {
+		if smtpOptions == nil {
+			return fmt.Errorf("accessrequest: smtp is required to notify approvers")
+		}
+		if err := notifyApprovers(smtpOptions, settings.Approvers, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func notifyWebhook(ctx context.Context, webhookURL string, r *AccessRequest) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := webhookHTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("accessrequest: error calling webhook: %w", err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("accessrequest: unexpected webhook response status: %d", res.StatusCode)
+	}
+	return nil
+}
+
+func notifyApprovers(smtpOptions *config.SMTP, approvers []string, r *AccessRequest) error {
+	u, err := smtpOptions.GetURL()
+	if err != nil {
+		return fmt.Errorf("accessrequest: invalid smtp url: %w", err)
+	}
+
+	var auth smtp.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		host, _, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			host = u.Host
+		}
+		auth = smtp.PlainAuth("", u.User.Username(), password, host)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Host, "25")
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", smtpOptions.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(approvers, ", "))
+	fmt.Fprintf(&msg, "Subject: Access request for %s\r\n", r.Route)
+	msg.WriteString("\r\n")
+	fmt.Fprintf(&msg, "%s has requested access to %s.\r\n\r\n", r.requester(), r.Route)
+	if r.Reason != "" {
+		fmt.Fprintf(&msg, "Reason: %s\r\n\r\n", r.Reason)
+	}
+	fmt.Fprintf(&msg, "Approve or deny the request with the admin API using the request id %s.\r\n", r.ID)
+
+	if err := sendMail(addr, auth, smtpOptions.From, approvers, []byte(msg.String())); err != nil {
+		return fmt.Errorf("accessrequest: error sending email: %w", err)
+	}
+	return nil
+}
+
+func (r *AccessRequest) requester() string {
+	if r.Email != "" {
+		return r.Email
+	}
+	return r.UserID
+}
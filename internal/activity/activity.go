@@ -0,0 +1,107 @@
+// Package activity contains the records authorize keeps about recent traffic, so that operations dashboards
+// can see when sessions were last used and which requests were denied without scraping the access logs.
+package activity
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+const (
+	// SessionRecordType is the databroker record type of session activity. Records are stored as JSON, with the
+	// session id as their id.
+	SessionRecordType = "pomerium.io/SessionActivity"
+	// DecisionRecordType is the databroker record type of deny decisions. Records are stored as JSON.
+	DecisionRecordType = "pomerium.io/AuthorizeDecision"
+)
+
+// Capacities of the activity record types. The databroker drops the oldest records once they're exceeded.
+const (
+	SessionCapacity  = 10000
+	DecisionCapacity = 1000
+)
+
+// SessionActivity records when a session was last used.
+type SessionActivity struct {
+	SessionID string    `json:"session_id"`
+	UserID    string    `json:"user_id,omitempty"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// A Decision is a request which was denied by authorize.
+type Decision struct {
+	ID string `json:"id"`
+	// RequestID is the id of the request in the access logs.
+	RequestID string    `json:"request_id,omitempty"`
+	Time      time.Time `json:"time"`
+	Route     string    `json:"route,omitempty"`
+	// Method and URL are the request's, the URL without its query.
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	SessionID string `json:"session_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Status    int    `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ToRecord converts the session activity into a databroker record.
+func (s *SessionActivity) ToRecord() (*databroker.Record, error) {
+	return toRecord(SessionRecordType, s.SessionID, s)
+}
+
+// ToRecord converts the decision into a databroker record.
+func (d *Decision) ToRecord() (*databroker.Record, error) {
+	return toRecord(DecisionRecordType, d.ID, d)
+}
+
+// SessionFromRecord returns the session activity stored in a databroker record.
+func SessionFromRecord(record *databroker.Record) (*SessionActivity, error) {
+	var s SessionActivity
+	if err := fromRecord(record, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DecisionFromRecord returns the decision stored in a databroker record.
+func DecisionFromRecord(record *databroker.Record) (*Decision, error) {
+	var d Decision
+	if err := fromRecord(record, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func toRecord(recordType, id string, v interface{}) (*databroker.Record, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	data, err := anypb.New(wrapperspb.Bytes(bs))
+	if err != nil {
+		return nil, err
+	}
+	return &databroker.Record{
+		Type: recordType,
+		Id:   id,
+		Data: data,
+	}, nil
+}
+
+func fromRecord(record *databroker.Record, v interface{}) error {
+	var value wrapperspb.BytesValue
+	if err := record.GetData().UnmarshalTo(&value); err != nil {
+		return fmt.Errorf("activity: error decoding record: %w", err)
+	}
+	if err := json.Unmarshal(value.GetValue(), v); err != nil {
+		return fmt.Errorf("activity: error decoding %s: %w", record.GetType(), err)
+	}
+	return nil
+}
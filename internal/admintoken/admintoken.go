@@ -0,0 +1,105 @@
+// Package admintoken contains the bearer tokens which authenticate requests to the admin API. They're
+// signed with a key derived from the shared secret, so that the tokens of sessions, service accounts and
+// the internal services, which are signed with the shared secret itself, aren't valid admin tokens.
+package admintoken
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+// Issuer and Audience are the issuer and audience of admin tokens.
+const (
+	Issuer   = "pomerium-admin"
+	Audience = "pomerium-admin"
+)
+
+var (
+	// ErrInvalid indicates that a token isn't a valid admin token.
+	ErrInvalid = errors.New("admintoken: invalid token")
+	// ErrExpired indicates that an admin token has expired.
+	ErrExpired = errors.New("admintoken: expired")
+)
+
+// sessionClaims are claims of session tokens. A token with any of them is rejected, even if it's
+// otherwise valid.
+var sessionClaims = []string{"programmatic", "pomerium_session", "pomerium_user", "oid", "ver"}
+
+// Claims are the claims of an admin token.
+type Claims struct {
+	jwt.Claims
+	// Admin grants access to the admin API. It must be true.
+	Admin bool `json:"pomerium_admin"`
+}
+
+// Sign returns an admin token for the subject, which is valid until the expiry.
+func Sign(sharedKey []byte, subject string, expiry time.Time) (string, error) {
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: signingKey(sharedKey)},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return jwt.Signed(sig).Claims(Claims{
+		Claims: jwt.Claims{
+			Issuer:   Issuer,
+			Subject:  subject,
+			Audience: jwt.Audience{Audience},
+			Expiry:   jwt.NewNumericDate(expiry),
+			IssuedAt: jwt.NewNumericDate(now),
+		},
+		Admin: true,
+	}).CompactSerialize()
+}
+
+// Verify returns the claims of an admin token, or an error if it isn't a valid admin token at the given time.
+func Verify(sharedKey []byte, rawToken string, now time.Time) (*Claims, error) {
+	tok, err := jwt.ParseSigned(rawToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	for _, header := range tok.Headers {
+		if header.Algorithm != string(jose.HS256) {
+			return nil, fmt.Errorf("%w: unsupported algorithm %s", ErrInvalid, header.Algorithm)
+		}
+	}
+
+	var claims Claims
+	var raw map[string]json.RawMessage
+	if err := tok.Claims(signingKey(sharedKey), &claims, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	for _, name := range sessionClaims {
+		if _, ok := raw[name]; ok {
+			return nil, fmt.Errorf("%w: session token", ErrInvalid)
+		}
+	}
+	if !claims.Admin {
+		return nil, fmt.Errorf("%w: missing admin grant", ErrInvalid)
+	}
+	if claims.Expiry == nil {
+		return nil, fmt.Errorf("%w: missing expiry", ErrInvalid)
+	}
+	err = claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:   Issuer,
+		Audience: jwt.Audience{Audience},
+		Time:     now,
+	}, 0)
+	if errors.Is(err, jwt.ErrExpired) {
+		return nil, ErrExpired
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	return &claims, nil
+}
+
+func signingKey(sharedKey []byte) []byte {
+	return cryptutil.Hash("admin_token", sharedKey)
+}
@@ -0,0 +1,75 @@
+package admintoken
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestAdminToken(t *testing.T) {
+	key := cryptutil.NewKey()
+	now := time.Now()
+
+	token, err := Sign(key, "ci", now.Add(time.Hour))
+	require.NoError(t, err)
+
+	claims, err := Verify(key, token, now)
+	require.NoError(t, err)
+	assert.Equal(t, "ci", claims.Subject)
+	assert.True(t, claims.Admin)
+
+	_, err = Verify(key, token, now.Add(2*time.Hour))
+	assert.ErrorIs(t, err, ErrExpired)
+	_, err = Verify(cryptutil.NewKey(), token, now)
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	sign := func(signingKey []byte, claims interface{}) string {
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: signingKey}, nil)
+		require.NoError(t, err)
+		raw, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+		require.NoError(t, err)
+		return raw
+	}
+	valid := jwt.Claims{
+		Issuer:   Issuer,
+		Audience: jwt.Audience{Audience},
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+
+	t.Run("shared secret", func(t *testing.T) {
+		_, err := Verify(key, sign(key, Claims{Claims: valid, Admin: true}), now)
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+	t.Run("missing grant", func(t *testing.T) {
+		_, err := Verify(key, sign(signingKey(key), Claims{Claims: valid}), now)
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+	t.Run("wrong audience", func(t *testing.T) {
+		c := valid
+		c.Audience = jwt.Audience{"authenticate.example.com"}
+		_, err := Verify(key, sign(signingKey(key), Claims{Claims: c, Admin: true}), now)
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+	t.Run("missing expiry", func(t *testing.T) {
+		c := valid
+		c.Expiry = nil
+		_, err := Verify(key, sign(signingKey(key), Claims{Claims: c, Admin: true}), now)
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+	t.Run("session", func(t *testing.T) {
+		_, err := Verify(key, sign(signingKey(key), map[string]interface{}{
+			"iss":            Issuer,
+			"aud":            Audience,
+			"exp":            now.Add(time.Hour).Unix(),
+			"pomerium_admin": true,
+			"programmatic":   false,
+		}), now)
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+}
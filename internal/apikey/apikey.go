@@ -0,0 +1,92 @@
+// Package apikey contains the static API keys accepted by routes for clients which can't sign in, such as
+// webhooks and monitoring probes. Keys are stored in the databroker by their hash, so the keys themselves are
+// only known to their clients.
+package apikey
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// RecordType is the databroker record type of API keys. Records are stored as JSON, with the hash of the key
+// as their id.
+const RecordType = "pomerium.io/APIKey"
+
+// An APIKey is an API key which is valid for some routes.
+type APIKey struct {
+	// ID is the hash of the key.
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Routes are the hostnames of the routes the key is valid for.
+	Routes    []string   `json:"routes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// New returns a new random key.
+func New() string {
+	return base64.RawURLEncoding.EncodeToString(cryptutil.NewKey())
+}
+
+// Hash returns the hash of a key, which is the id of its record. Keys are random, so they don't need a slow
+// password hash.
+func Hash(key string) string {
+	return hex.EncodeToString(cryptutil.Hash("api_key", []byte(key)))
+}
+
+// IsValidFor returns true if the API key is valid for the route hostname at the given time.
+func (k *APIKey) IsValidFor(hostname string, now time.Time) bool {
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return false
+	}
+	for _, route := range k.Routes {
+		if route == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+// ToRecord converts the API key into a databroker record.
+func (k *APIKey) ToRecord() (*databroker.Record, error) {
+	bs, err := json.Marshal(k)
+	if err != nil {
+		return nil, err
+	}
+	data, err := anypb.New(wrapperspb.Bytes(bs))
+	if err != nil {
+		return nil, err
+	}
+	return &databroker.Record{
+		Type: RecordType,
+		Id:   k.ID,
+		Data: data,
+	}, nil
+}
+
+// FromRecord returns the API key stored in a databroker record.
+func FromRecord(record *databroker.Record) (*APIKey, error) {
+	var value wrapperspb.BytesValue
+	if err := record.GetData().UnmarshalTo(&value); err != nil {
+		return nil, fmt.Errorf("apikey: error decoding record: %w", err)
+	}
+	return FromBytes(value.GetValue())
+}
+
+// FromBytes returns the API key stored as JSON.
+func FromBytes(bs []byte) (*APIKey, error) {
+	var k APIKey
+	if err := json.Unmarshal(bs, &k); err != nil {
+		return nil, fmt.Errorf("apikey: error decoding api key: %w", err)
+	}
+	return &k, nil
+}
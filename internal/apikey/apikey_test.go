@@ -0,0 +1,40 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKey(t *testing.T) {
+	key := New()
+	assert.NotEqual(t, key, New())
+	assert.Equal(t, Hash(key), Hash(key))
+	assert.NotEqual(t, Hash(key), Hash(New()))
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	k := &APIKey{
+		ID:        Hash(key),
+		Name:      "webhook",
+		Routes:    []string{"hooks.example.com"},
+		CreatedAt: now.UTC().Truncate(time.Second),
+		ExpiresAt: &expiresAt,
+	}
+	assert.True(t, k.IsValidFor("hooks.example.com", now))
+	assert.False(t, k.IsValidFor("other.example.com", now))
+	assert.False(t, k.IsValidFor("hooks.example.com", expiresAt))
+
+	record, err := k.ToRecord()
+	require.NoError(t, err)
+	assert.Equal(t, RecordType, record.GetType())
+	assert.Equal(t, k.ID, record.GetId())
+
+	decoded, err := FromRecord(record)
+	require.NoError(t, err)
+	assert.Equal(t, k.ID, decoded.ID)
+	assert.Equal(t, k.Routes, decoded.Routes)
+	assert.True(t, k.ExpiresAt.Equal(*decoded.ExpiresAt))
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"sort"
 	"sync"
@@ -18,7 +19,11 @@ import (
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/proxyprotocol"
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
 var (
@@ -40,11 +45,13 @@ type Manager struct {
 	src          config.Source
 	acmeTemplate certmagic.ACMEManager
 
-	mu        sync.RWMutex
-	config    *config.Config
-	certmagic *certmagic.Config
-	acmeMgr   atomic.Value
-	srv       *http.Server
+	mu                sync.RWMutex
+	config            *config.Config
+	certmagic         *certmagic.Config
+	acmeMgr           atomic.Value
+	srv               *http.Server
+	srvProxyProtocol  bool
+	dataBrokerStorage *dataBrokerStorage
 
 	*ocspCache
 
@@ -71,22 +78,19 @@ func newManager(ctx context.Context,
 	}
 
 	certmagicConfig := certmagic.NewDefault()
-	// set certmagic default storage cache, otherwise cert renewal loop will be based off
-	// certmagic's own default location
-	certmagicConfig.Storage = &certmagic.FileStorage{
-		Path: src.GetConfig().Options.AutocertOptions.Folder,
-	}
 
 	logger := log.ZapLogger().With(zap.String("service", "autocert"))
 	certmagicConfig.Logger = logger
 	acmeTemplate.Logger = logger
 
 	mgr := &Manager{
-		src:          src,
-		acmeTemplate: acmeTemplate,
-		certmagic:    certmagicConfig,
-		ocspCache:    ocspRespCache,
+		src:               src,
+		acmeTemplate:      acmeTemplate,
+		certmagic:         certmagicConfig,
+		ocspCache:         ocspRespCache,
+		dataBrokerStorage: newDataBrokerStorage(),
 	}
+
 	err = mgr.update(ctx, src.GetConfig())
 	if err != nil {
 		return nil, err
@@ -124,7 +128,6 @@ func newManager(ctx context.Context,
 func (mgr *Manager) getCertMagicConfig(cfg *config.Config) (*certmagic.Config, error) {
 	mgr.certmagic.MustStaple = cfg.Options.AutocertOptions.MustStaple
 	mgr.certmagic.OnDemand = nil // disable on-demand
-	mgr.certmagic.Storage = &certmagic.FileStorage{Path: cfg.Options.AutocertOptions.Folder}
 	certs, err := cfg.AllCertificates()
 	if err != nil {
 		return nil, err
@@ -147,6 +150,56 @@ func (mgr *Manager) getCertMagicConfig(cfg *config.Config) (*certmagic.Config, e
 	return mgr.certmagic, nil
 }
 
+// getStorage returns the storage of the certificates. The databroker storage uses the databroker connection shared
+// with the other services, so it's only looked up when the config changes, rather than on every renewal check.
+func (mgr *Manager) getStorage(ctx context.Context, cfg *config.Config) (certmagic.Storage, error) {
+	if !cfg.Options.AutocertOptions.Enable || cfg.Options.AutocertOptions.Storage != config.AutocertStorageDataBroker {
+		return &certmagic.FileStorage{Path: cfg.Options.AutocertOptions.Folder}, nil
+	}
+
+	sharedKey, err := cfg.Options.GetSharedKey()
+	if err != nil {
+		return nil, err
+	}
+
+	urls, err := cfg.Options.GetDataBrokerURLs()
+	if err != nil {
+		return nil, err
+	}
+
+	clientCert, err := cfg.Options.GetGRPCClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	cc, err := grpc.GetGRPCClientConn(ctx, "databroker", &grpc.Options{
+		Addrs:                   urls,
+		OverrideCertificateName: cfg.Options.OverrideCertificateName,
+		CA:                      cfg.Options.CA,
+		CAFile:                  cfg.Options.CAFile,
+		ClientCertificate:       clientCert,
+		SPIREAgentSocket:        cfg.Options.SPIREAgentSocket,
+		InternalCA:              cfg.Options.GetInternalCA(),
+		RequestTimeout:          cfg.Options.GRPCClientTimeout,
+		ClientDNSRoundRobin:     cfg.Options.GRPCClientDNSRoundRobin,
+		PoolSize:                cfg.Options.GRPCClientPoolSize,
+		KeepaliveTime:           cfg.Options.GRPCClientKeepaliveTime,
+		KeepaliveTimeout:        cfg.Options.GRPCClientKeepaliveTimeout,
+		BackoffMaxDelay:         cfg.Options.GRPCClientBackoffMaxDelay,
+		CircuitBreakerThreshold: cfg.Options.GRPCClientCircuitBreakerThreshold,
+		CircuitBreakerTimeout:   cfg.Options.GRPCClientCircuitBreakerTimeout,
+		WithInsecure:            cfg.Options.GetGRPCInsecure(),
+		InstallationID:          cfg.Options.InstallationID,
+		ServiceName:             cfg.Options.Services,
+		SignedJWTKey:            sharedKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("autocert: error creating databroker connection: %w", err)
+	}
+	mgr.dataBrokerStorage.setClient(databroker.NewDataBrokerServiceClient(cc))
+	return mgr.dataBrokerStorage, nil
+}
+
 func (mgr *Manager) renewConfigCerts(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, renewalTimeout)
 	defer cancel()
@@ -211,6 +264,14 @@ func (mgr *Manager) update(ctx context.Context, cfg *config.Config) error {
 	defer mgr.mu.Unlock()
 	defer func() { mgr.config = cfg }()
 
+	// set certmagic default storage cache, otherwise cert renewal loop will be based off
+	// certmagic's own default location
+	storage, err := mgr.getStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	mgr.certmagic.Storage = storage
+
 	mgr.updateServer(ctx, cfg)
 	return mgr.updateAutocert(ctx, cfg)
 }
@@ -285,7 +346,7 @@ func (mgr *Manager) updateAutocert(ctx context.Context, cfg *config.Config) erro
 func (mgr *Manager) updateServer(ctx context.Context, cfg *config.Config) {
 	if mgr.srv != nil {
 		// nothing to do if the address hasn't changed
-		if mgr.srv.Addr == cfg.Options.HTTPRedirectAddr {
+		if mgr.srv.Addr == cfg.Options.HTTPRedirectAddr && mgr.srvProxyProtocol == cfg.Options.UseProxyProtocol {
 			return
 		}
 		// close immediately, don't care about the error
@@ -308,14 +369,30 @@ func (mgr *Manager) updateServer(ctx context.Context, cfg *config.Config) {
 			redirect.ServeHTTP(w, r)
 		}),
 	}
+	useProxyProtocol := cfg.Options.UseProxyProtocol
 	go func() {
 		log.Info(ctx).Str("addr", hsrv.Addr).Msg("starting http redirect server")
-		err := hsrv.ListenAndServe()
+		err := serveHTTPRedirect(hsrv, useProxyProtocol)
 		if err != nil {
 			log.Error(ctx).Err(err).Msg("failed to run http redirect server")
 		}
 	}()
 	mgr.srv = hsrv
+	mgr.srvProxyProtocol = useProxyProtocol
+}
+
+// serveHTTPRedirect runs the http redirect server. Like the main listener, it requires the PROXY protocol if
+// use_proxy_protocol is set, so it can be behind the same load balancer.
+func serveHTTPRedirect(hsrv *http.Server, useProxyProtocol bool) error {
+	if !useProxyProtocol {
+		return hsrv.ListenAndServe()
+	}
+
+	li, err := net.Listen("tcp", hsrv.Addr)
+	if err != nil {
+		return err
+	}
+	return hsrv.Serve(proxyprotocol.NewListener(li, proxyprotocol.DefaultHeaderTimeout))
 }
 
 func (mgr *Manager) handleHTTPChallenge(w http.ResponseWriter, r *http.Request) bool {
@@ -344,6 +421,10 @@ func sourceHostnames(cfg *config.Config) []string {
 
 	dedupe := map[string]struct{}{}
 	for _, p := range policies {
+		// wildcard certificates can't be obtained with the HTTP and TLS-ALPN challenges
+		if urlutil.IsWildcardHost(p.Source.Host) {
+			continue
+		}
 		dedupe[p.Source.Hostname()] = struct{}{}
 	}
 	if cfg.Options.AuthenticateURLString != "" {
@@ -0,0 +1,306 @@
+package autocert
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// StorageRecordType is the databroker record type of the certificates and other files stored by autocert.
+const StorageRecordType = "pomerium.io/AutocertStorage"
+
+const (
+	dataBrokerStorageLeaseTTL   = time.Minute
+	dataBrokerStorageQueryLimit = 100
+	dataBrokerStorageTimeout    = time.Second * 30
+)
+
+// dataBrokerStorage implements certmagic.Storage using the databroker so that certificates can be shared by
+// multiple pomerium instances. Locks are implemented using databroker leases.
+type dataBrokerStorage struct {
+	mu     sync.Mutex
+	client databroker.DataBrokerServiceClient
+	leases map[string]context.CancelFunc
+}
+
+var _ certmagic.Storage = (*dataBrokerStorage)(nil)
+
+func newDataBrokerStorage() *dataBrokerStorage {
+	return &dataBrokerStorage{
+		leases: make(map[string]context.CancelFunc),
+	}
+}
+
+func (s *dataBrokerStorage) setClient(client databroker.DataBrokerServiceClient) {
+	s.mu.Lock()
+	s.client = client
+	s.mu.Unlock()
+}
+
+func (s *dataBrokerStorage) getClient() databroker.DataBrokerServiceClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client
+}
+
+// Lock acquires the lock for key, blocking until it is acquired or ctx is canceled.
+func (s *dataBrokerStorage) Lock(ctx context.Context, key string) error {
+	name := "autocert-" + key
+	for {
+		res, err := s.getClient().AcquireLease(ctx, &databroker.AcquireLeaseRequest{
+			Name:     name,
+			Duration: durationpb.New(dataBrokerStorageLeaseTTL),
+		})
+		if err == nil {
+			s.keepLease(key, name, res.GetId())
+			return nil
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		} else if status.Code(err) != codes.AlreadyExists {
+			return fmt.Errorf("autocert: error acquiring lock for %s: %w", key, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(dataBrokerStorageLeaseTTL / 10):
+		}
+	}
+}
+
+// keepLease renews the lease in the background until the key is unlocked.
+func (s *dataBrokerStorage) keepLease(key, name, leaseID string) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.leases[key] = func() {
+		cancel()
+		<-done
+	}
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer func() {
+			_, _ = s.getClient().ReleaseLease(context.Background(), &databroker.ReleaseLeaseRequest{
+				Name: name,
+				Id:   leaseID,
+			})
+		}()
+
+		ticker := time.NewTicker(dataBrokerStorageLeaseTTL / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			_, err := s.getClient().RenewLease(ctx, &databroker.RenewLeaseRequest{
+				Name:     name,
+				Id:       leaseID,
+				Duration: durationpb.New(dataBrokerStorageLeaseTTL),
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Warn(ctx).Err(err).Str("key", key).Msg("autocert: error renewing lock")
+			}
+		}
+	}()
+}
+
+// Unlock releases the lock for key.
+func (s *dataBrokerStorage) Unlock(key string) error {
+	s.mu.Lock()
+	release, ok := s.leases[key]
+	delete(s.leases, key)
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("autocert: %s is not locked", key)
+	}
+	release()
+	return nil
+}
+
+// Store stores value at key.
+func (s *dataBrokerStorage) Store(key string, value []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dataBrokerStorageTimeout)
+	defer cancel()
+
+	data, err := anypb.New(wrapperspb.Bytes(value))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.getClient().Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{
+			Type: StorageRecordType,
+			Id:   key,
+			Data: data,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("autocert: error storing %s: %w", key, err)
+	}
+	return nil
+}
+
+// Load retrieves the value at key.
+func (s *dataBrokerStorage) Load(key string) ([]byte, error) {
+	record, err := s.get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var value wrapperspb.BytesValue
+	if err := record.GetData().UnmarshalTo(&value); err != nil {
+		return nil, fmt.Errorf("autocert: error decoding %s: %w", key, err)
+	}
+	return value.GetValue(), nil
+}
+
+// Delete deletes key.
+func (s *dataBrokerStorage) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dataBrokerStorageTimeout)
+	defer cancel()
+
+	if !s.Exists(key) {
+		return certmagic.ErrNotExist(fmt.Errorf("autocert: %s not found", key))
+	}
+
+	data, _ := anypb.New(new(wrapperspb.BytesValue))
+	_, err := s.getClient().Put(ctx, &databroker.PutRequest{
+		Record: &databroker.Record{
+			Type:      StorageRecordType,
+			Id:        key,
+			Data:      data,
+			DeletedAt: timestamppb.Now(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("autocert: error deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+// Exists returns true if the key exists.
+func (s *dataBrokerStorage) Exists(key string) bool {
+	_, err := s.get(key)
+	return err == nil
+}
+
+// List returns all keys that match prefix. If recursive is false, only the keys directly under prefix are returned.
+func (s *dataBrokerStorage) List(prefix string, recursive bool) ([]string, error) {
+	keys, err := s.listAll()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	seen := map[string]struct{}{}
+	var matched []string
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix+"/") {
+			continue
+		}
+		if !recursive {
+			// only return the first path element below the prefix
+			rest := strings.TrimPrefix(key, prefix+"/")
+			key = path.Join(prefix, strings.SplitN(rest, "/", 2)[0])
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		matched = append(matched, key)
+	}
+	if len(matched) == 0 {
+		return nil, certmagic.ErrNotExist(fmt.Errorf("autocert: %s not found", prefix))
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// Stat returns information about key.
+func (s *dataBrokerStorage) Stat(key string) (certmagic.KeyInfo, error) {
+	record, err := s.get(key)
+	if err == nil {
+		var value wrapperspb.BytesValue
+		_ = record.GetData().UnmarshalTo(&value)
+		return certmagic.KeyInfo{
+			Key:        key,
+			Modified:   record.GetModifiedAt().AsTime(),
+			Size:       int64(len(value.GetValue())),
+			IsTerminal: true,
+		}, nil
+	}
+
+	// the key may be a "directory" containing other keys
+	if _, listErr := s.List(key, false); listErr == nil {
+		return certmagic.KeyInfo{
+			Key:        key,
+			IsTerminal: false,
+		}, nil
+	}
+	return certmagic.KeyInfo{}, err
+}
+
+func (s *dataBrokerStorage) get(key string) (*databroker.Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dataBrokerStorageTimeout)
+	defer cancel()
+
+	res, err := s.getClient().Get(ctx, &databroker.GetRequest{
+		Type: StorageRecordType,
+		Id:   key,
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, certmagic.ErrNotExist(fmt.Errorf("autocert: %s not found", key))
+	} else if err != nil {
+		return nil, fmt.Errorf("autocert: error loading %s: %w", key, err)
+	}
+	return res.GetRecord(), nil
+}
+
+func (s *dataBrokerStorage) listAll() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dataBrokerStorageTimeout)
+	defer cancel()
+
+	var keys []string
+	for offset := int64(0); ; offset += dataBrokerStorageQueryLimit {
+		res, err := s.getClient().Query(ctx, &databroker.QueryRequest{
+			Type:   StorageRecordType,
+			Offset: offset,
+			Limit:  dataBrokerStorageQueryLimit,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("autocert: error listing keys: %w", err)
+		}
+		for _, record := range res.GetRecords() {
+			if record.GetDeletedAt() == nil {
+				keys = append(keys, record.GetId())
+			}
+		}
+		if offset+dataBrokerStorageQueryLimit >= res.GetTotalCount() {
+			break
+		}
+	}
+	return keys, nil
+}
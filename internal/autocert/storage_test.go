@@ -0,0 +1,98 @@
+package autocert
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+func newTestDataBrokerStorage(t *testing.T) *dataBrokerStorage {
+	t.Helper()
+
+	li := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	databroker.RegisterDataBrokerServiceServer(srv, internal_databroker.New())
+	go func() { _ = srv.Serve(li) }()
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.Dial("bufnet", grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return li.Dial()
+	}), grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = cc.Close() })
+
+	s := newDataBrokerStorage()
+	s.setClient(databroker.NewDataBrokerServiceClient(cc))
+	return s
+}
+
+func TestDataBrokerStorage(t *testing.T) {
+	s := newTestDataBrokerStorage(t)
+
+	_, err := s.Load("certificates/example.com/example.com.crt")
+	assert.Implements(t, (*certmagic.ErrNotExist)(nil), err)
+	assert.False(t, s.Exists("certificates/example.com/example.com.crt"))
+
+	require.NoError(t, s.Store("certificates/example.com/example.com.crt", []byte("CERT")))
+	require.NoError(t, s.Store("certificates/example.com/example.com.key", []byte("KEY")))
+	require.NoError(t, s.Store("certificates/example.org/example.org.crt", []byte("CERT")))
+
+	value, err := s.Load("certificates/example.com/example.com.crt")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("CERT"), value)
+	assert.True(t, s.Exists("certificates/example.com/example.com.crt"))
+
+	info, err := s.Stat("certificates/example.com/example.com.key")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), info.Size)
+	assert.True(t, info.IsTerminal)
+
+	info, err = s.Stat("certificates/example.com")
+	assert.NoError(t, err)
+	assert.False(t, info.IsTerminal)
+
+	keys, err := s.List("certificates", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"certificates/example.com", "certificates/example.org"}, keys)
+
+	keys, err = s.List("certificates", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"certificates/example.com/example.com.crt",
+		"certificates/example.com/example.com.key",
+		"certificates/example.org/example.org.crt",
+	}, keys)
+
+	require.NoError(t, s.Delete("certificates/example.org/example.org.crt"))
+	assert.False(t, s.Exists("certificates/example.org/example.org.crt"))
+	_, err = s.List("certificates/example.org", true)
+	assert.Error(t, err)
+}
+
+func TestDataBrokerStorageLock(t *testing.T) {
+	s := newTestDataBrokerStorage(t)
+
+	ctx := context.Background()
+	require.NoError(t, s.Lock(ctx, "example.com"))
+
+	// a second lock for the same key blocks until the first is released
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Lock(timeoutCtx, "example.com"), context.DeadlineExceeded)
+
+	require.NoError(t, s.Unlock("example.com"))
+	require.NoError(t, s.Lock(ctx, "example.com"))
+	require.NoError(t, s.Unlock("example.com"))
+
+	assert.Error(t, s.Unlock("example.com"))
+}
@@ -0,0 +1,168 @@
+// Package aws contains a minimal client for the AWS Secrets Manager and KMS APIs.
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Client is a minimal AWS API client which can get Secrets Manager secrets and decrypt KMS ciphertext.
+//
+// Credentials are loaded from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables, or from the instance's IAM role. The region is loaded from AWS_REGION or
+// AWS_DEFAULT_REGION.
+type Client struct {
+	httpClient  *http.Client
+	metadataURL string
+	endpoint    func(service, region string) string
+
+	mu    sync.Mutex
+	creds *Credentials
+}
+
+// NewClient creates a new Client.
+func NewClient(httpClient *http.Client) *Client {
+	return &Client{
+		httpClient:  httpClient,
+		metadataURL: defaultMetadataURL,
+		endpoint: func(service, region string) string {
+			return "https://" + service + "." + region + ".amazonaws.com/"
+		},
+	}
+}
+
+// ResolveSecretsManagerSecret gets a secret from Secrets Manager. ref is the name or ARN of the secret,
+// optionally followed by #<key> to get a key of a JSON secret.
+func (c *Client) ResolveSecretsManagerSecret(ctx context.Context, ref string) (string, error) {
+	secretID, key := ref, ""
+	if idx := strings.LastIndex(ref, "#"); idx >= 0 {
+		secretID, key = ref[:idx], ref[idx+1:]
+	}
+
+	region := ""
+	// arn:aws:secretsmanager:<region>:<account>:secret:<name>
+	if parts := strings.SplitN(secretID, ":", 5); len(parts) == 5 && parts[0] == "arn" {
+		region = parts[3]
+	}
+
+	var res struct {
+		SecretString string `json:"SecretString"`
+	}
+	err := c.do(ctx, "secretsmanager", region, "secretsmanager.GetSecretValue", map[string]interface{}{
+		"SecretId": secretID,
+	}, &res)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return res.SecretString, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(res.SecretString), &values); err != nil {
+		return "", fmt.Errorf("aws: secret %s is not a json object: %w", secretID, err)
+	}
+	value, ok := values[key].(string)
+	if !ok {
+		return "", fmt.Errorf("aws: key %s not found in secret %s", key, secretID)
+	}
+	return value, nil
+}
+
+// ResolveKMSSecret decrypts base64 encoded KMS ciphertext, such as the output of `aws kms encrypt`.
+func (c *Client) ResolveKMSSecret(ctx context.Context, ref string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(ref)
+	if err != nil {
+		return "", fmt.Errorf("aws: invalid kms ciphertext: %w", err)
+	}
+
+	var res struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	err = c.do(ctx, "kms", "", "TrentService.Decrypt", map[string]interface{}{
+		"CiphertextBlob": ciphertext,
+	}, &res)
+	if err != nil {
+		return "", err
+	}
+	return string(res.Plaintext), nil
+}
+
+func (c *Client) do(ctx context.Context, service, region, target string, body, dst interface{}) error {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return errors.New("aws: no region set, set AWS_REGION")
+	}
+
+	creds, err := c.getCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint(service, region), bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signRequest(req, reqBody, creds, region, service, time.Now())
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var errRes struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&errRes)
+		return fmt.Errorf("aws: unexpected status code for %s: %d %s %s",
+			target, res.StatusCode, errRes.Type, errRes.Message)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return fmt.Errorf("aws: error decoding %s: %w", target, err)
+	}
+	return nil
+}
+
+func (c *Client) getCredentials(ctx context.Context) (*Credentials, error) {
+	if creds := credentialsFromEnvironment(); creds != nil {
+		return creds, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// refresh instance role credentials a few minutes before they expire
+	if c.creds != nil && time.Until(c.creds.Expiration) > 5*time.Minute {
+		return c.creds, nil
+	}
+	creds, err := credentialsFromMetadata(ctx, c.httpClient, c.metadataURL)
+	if err != nil {
+		return nil, err
+	}
+	c.creds = creds
+	return creds, nil
+}
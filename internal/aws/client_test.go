@@ -0,0 +1,110 @@
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ACCESS_KEY/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.GetSecretValue":
+			switch req["SecretId"] {
+			case "pomerium/shared-secret":
+				fmt.Fprint(w, `{"SecretString": "SHARED_SECRET"}`)
+			case "pomerium/idp":
+				fmt.Fprint(w, `{"SecretString": "{\"client_secret\": \"CLIENT_SECRET\"}"}`)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"__type": "ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."}`)
+			}
+		case "TrentService.Decrypt":
+			ciphertext, _ := base64.StdEncoding.DecodeString(req["CiphertextBlob"].(string))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"Plaintext": []byte(strings.TrimPrefix(string(ciphertext), "encrypted:")),
+			})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	for k, v := range map[string]string{
+		"AWS_ACCESS_KEY_ID":     "ACCESS_KEY",
+		"AWS_SECRET_ACCESS_KEY": "SECRET_KEY",
+		"AWS_REGION":            "us-east-1",
+	} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	c := NewClient(srv.Client())
+	c.endpoint = func(service, region string) string { return srv.URL }
+
+	ctx := context.Background()
+	value, err := c.ResolveSecretsManagerSecret(ctx, "pomerium/shared-secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "SHARED_SECRET", value)
+
+	value, err = c.ResolveSecretsManagerSecret(ctx, "pomerium/idp#client_secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "CLIENT_SECRET", value)
+
+	_, err = c.ResolveSecretsManagerSecret(ctx, "pomerium/missing")
+	assert.EqualError(t, err, "aws: unexpected status code for secretsmanager.GetSecretValue: 400 "+
+		"ResourceNotFoundException Secrets Manager can't find the specified secret.")
+
+	value, err = c.ResolveKMSSecret(ctx, base64.StdEncoding.EncodeToString([]byte("encrypted:COOKIE_SECRET")))
+	assert.NoError(t, err)
+	assert.Equal(t, "COOKIE_SECRET", value)
+}
+
+func TestCredentialsFromMetadata(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			assert.Equal(t, http.MethodPut, r.Method)
+			fmt.Fprint(w, "TOKEN")
+			return
+		}
+		if r.Header.Get("X-Aws-Ec2-Metadata-Token") != "TOKEN" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "pomerium-role\n")
+		case "/latest/meta-data/iam/security-credentials/pomerium-role":
+			fmt.Fprint(w, `{"AccessKeyId": "ACCESS_KEY", "SecretAccessKey": "SECRET_KEY", "Token": "SESSION_TOKEN", "Expiration": "2030-01-01T00:00:00Z"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	creds, err := credentialsFromMetadata(context.Background(), srv.Client(), srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, &Credentials{
+		AccessKeyID:     "ACCESS_KEY",
+		SecretAccessKey: "SECRET_KEY",
+		SessionToken:    "SESSION_TOKEN",
+		Expiration:      time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, creds)
+}
@@ -0,0 +1,101 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultMetadataURL is the URL of the EC2 instance metadata service.
+const defaultMetadataURL = "http://169.254.169.254"
+
+// Credentials are AWS credentials used to sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// credentialsFromEnvironment loads credentials from the standard AWS environment variables.
+func credentialsFromEnvironment() *Credentials {
+	creds := &Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil
+	}
+	return creds
+}
+
+// credentialsFromMetadata loads the credentials of the instance's IAM role from the EC2 instance metadata
+// service, using IMDSv2.
+func credentialsFromMetadata(ctx context.Context, httpClient *http.Client, metadataURL string) (*Credentials, error) {
+	get := func(method, path string, headers map[string]string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, method, metadataURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		bs, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status code for %s: %d", path, res.StatusCode)
+		}
+		return bs, nil
+	}
+
+	token, err := get(http.MethodPut, "/latest/api/token", map[string]string{
+		"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": "60",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("aws: error getting instance metadata token: %w", err)
+	}
+	headers := map[string]string{"X-Aws-Ec2-Metadata-Token": string(token)}
+
+	roles, err := get(http.MethodGet, "/latest/meta-data/iam/security-credentials/", headers)
+	if err != nil {
+		return nil, fmt.Errorf("aws: error getting instance role: %w", err)
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, errors.New("aws: instance has no iam role")
+	}
+
+	bs, err := get(http.MethodGet, "/latest/meta-data/iam/security-credentials/"+role, headers)
+	if err != nil {
+		return nil, fmt.Errorf("aws: error getting instance role credentials: %w", err)
+	}
+	var res struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(bs, &res); err != nil {
+		return nil, fmt.Errorf("aws: error decoding instance role credentials: %w", err)
+	}
+	return &Credentials{
+		AccessKeyID:     res.AccessKeyID,
+		SecretAccessKey: res.SecretAccessKey,
+		SessionToken:    res.Token,
+		Expiration:      res.Expiration,
+	}, nil
+}
@@ -0,0 +1,207 @@
+// Package cdc contains a change data capture publisher which publishes databroker record changes to an
+// external message bus.
+package cdc
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// A Publisher publishes databroker record changes to a sink. Only changes made after the publisher starts
+// are published, the records that exist at the time of the initial sync are not.
+type Publisher struct {
+	cfg     *atomicConfig
+	updated chan struct{}
+
+	// inSnapshot is true when the next call to UpdateRecords contains the initial sync
+	inSnapshot bool
+	// known are the ids of the existing records, used to tell created from updated records in CloudEvents
+	known map[string]struct{}
+}
+
+// New creates a new Publisher.
+func New(options ...Option) *Publisher {
+	p := &Publisher{
+		cfg:     newAtomicConfig(newConfig()),
+		updated: make(chan struct{}, 1),
+	}
+	p.UpdateConfig(options...)
+	return p
+}
+
+func withLog(ctx context.Context) context.Context {
+	return log.WithContext(ctx, func(c zerolog.Context) zerolog.Context {
+		return c.Str("service", "databroker_cdc")
+	})
+}
+
+// UpdateConfig updates the publisher with the new options.
+func (p *Publisher) UpdateConfig(options ...Option) {
+	p.cfg.Store(newConfig(options...))
+	select {
+	case p.updated <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs the publisher. This method blocks until an error occurs or the given context is canceled.
+func (p *Publisher) Run(ctx context.Context) error {
+	leaser := databroker.NewLeaser("databroker_cdc", time.Second*30, p)
+	return leaser.Run(ctx)
+}
+
+// RunLeased runs the publisher when a lease is acquired.
+func (p *Publisher) RunLeased(ctx context.Context) error {
+	ctx = withLog(ctx)
+
+	// wait for a sink to be configured
+	for p.cfg.Load().sink == nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.updated:
+		}
+	}
+
+	return databroker.NewSyncer("databroker_cdc", p).Run(ctx)
+}
+
+// GetDataBrokerServiceClient gets the databroker client.
+func (p *Publisher) GetDataBrokerServiceClient() databroker.DataBrokerServiceClient {
+	return p.cfg.Load().dataBrokerClient
+}
+
+// ClearRecords is called by the syncer before the initial sync.
+func (p *Publisher) ClearRecords(ctx context.Context) {
+	p.inSnapshot = true
+	p.known = make(map[string]struct{})
+}
+
+// UpdateRecords publishes the changed records.
+func (p *Publisher) UpdateRecords(ctx context.Context, serverVersion uint64, records []*databroker.Record) {
+	cfg := p.cfg.Load()
+
+	if p.inSnapshot {
+		p.inSnapshot = false
+		for _, record := range records {
+			p.isCreated(cfg, record)
+		}
+		return
+	}
+
+	for _, record := range records {
+		if !cfg.isRecordTypeEnabled(record.GetType()) {
+			continue
+		}
+		created := p.isCreated(cfg, record)
+		if cfg.sink == nil {
+			continue
+		}
+
+		msg, err := cfg.newMessage(serverVersion, record, created)
+		if err != nil {
+			log.Error(ctx).Err(err).Str("record_type", record.GetType()).Str("record_id", record.GetId()).
+				Msg("cdc: error encoding record")
+			continue
+		}
+
+		err = cfg.sink.Publish(ctx, msg)
+		if err != nil {
+			log.Error(ctx).Err(err).Str("record_type", record.GetType()).Str("record_id", record.GetId()).
+				Msg("cdc: error publishing record")
+		}
+	}
+}
+
+// isCreated returns true if the record didn't exist before the change, and records whether it exists after the
+// change. Only the records published as CloudEvents are tracked.
+func (p *Publisher) isCreated(cfg *config, record *databroker.Record) bool {
+	if cfg.format != FormatCloudEvents || !cfg.isRecordTypeEnabled(record.GetType()) {
+		return false
+	}
+	if p.known == nil {
+		p.known = make(map[string]struct{})
+	}
+
+	key := record.GetType() + "/" + record.GetId()
+	_, exists := p.known[key]
+	if record.GetDeletedAt() != nil {
+		delete(p.known, key)
+	} else {
+		p.known[key] = struct{}{}
+	}
+	return !exists
+}
+
+func (cfg *config) newMessage(serverVersion uint64, record *databroker.Record, created bool) (*Message, error) {
+	if cfg.format == FormatCloudEvents {
+		return newCloudEventMessage(serverVersion, record, created)
+	}
+
+	value, err := marshalRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Key:         record.GetId(),
+		ContentType: recordContentType,
+		Value:       value,
+	}, nil
+}
+
+// marshalRecord returns the JSON encoded record, without the tokens of sessions.
+func marshalRecord(record *databroker.Record) ([]byte, error) {
+	if record.GetData() != nil {
+		msg, err := record.GetData().UnmarshalNew()
+		if err != nil {
+			return nil, err
+		}
+		if redactData(msg) {
+			data, err := anypb.New(msg)
+			if err != nil {
+				return nil, err
+			}
+			record = proto.Clone(record).(*databroker.Record)
+			record.Data = data
+		}
+	}
+	return protojson.Marshal(record)
+}
+
+// redactData removes the OAuth and ID tokens of sessions from record data, so they aren't sent to consumers. It
+// returns true if the data was changed.
+func redactData(msg proto.Message) bool {
+	s, ok := msg.(*session.Session)
+	if !ok || (s.OauthToken == nil && s.GetIdToken().GetRaw() == "") {
+		return false
+	}
+	s.OauthToken = nil
+	if s.IdToken != nil {
+		s.IdToken.Raw = ""
+	}
+	return true
+}
+
+// isRecordTypeEnabled returns true if changes to the record type are published. If no record types are
+// configured, only the changes to identity records are published.
+func (cfg *config) isRecordTypeEnabled(recordType string) bool {
+	if len(cfg.recordTypes) == 0 {
+		_, ok := identityRecordTypes[recordType]
+		return ok
+	}
+	for _, t := range cfg.recordTypes {
+		if t == recordType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+type mockSink struct {
+	mu           sync.Mutex
+	keys         []string
+	contentTypes []string
+	messages     [][]byte
+}
+
+func (s *mockSink) Publish(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, msg.Key)
+	s.contentTypes = append(s.contentTypes, msg.ContentType)
+	s.messages = append(s.messages, msg.Value)
+	return nil
+}
+
+func (s *mockSink) Close() error {
+	return nil
+}
+
+func newRecord(t *testing.T, id string, msg proto.Message) *databroker.Record {
+	t.Helper()
+	data, err := anypb.New(msg)
+	require.NoError(t, err)
+	return &databroker.Record{
+		Type: data.GetTypeUrl(),
+		Id:   id,
+		Data: data,
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	ctx := context.Background()
+	sessionRecord := newRecord(t, "S1", &session.Session{Id: "S1", UserId: "U1"})
+	userRecord := newRecord(t, "U1", &user.User{Id: "U1", Email: "u1@example.com"})
+
+	t.Run("skips initial sync", func(t *testing.T) {
+		sink := new(mockSink)
+		p := New(WithSink(sink))
+		p.ClearRecords(ctx)
+		p.UpdateRecords(ctx, 1, []*databroker.Record{sessionRecord, userRecord})
+		assert.Empty(t, sink.keys)
+
+		p.UpdateRecords(ctx, 1, []*databroker.Record{sessionRecord})
+		assert.Equal(t, []string{"S1"}, sink.keys)
+
+		var msg map[string]interface{}
+		require.NoError(t, json.Unmarshal(sink.messages[0], &msg))
+		assert.Equal(t, sessionRecord.GetType(), msg["type"])
+		assert.Equal(t, "U1", msg["data"].(map[string]interface{})["userId"])
+	})
+	t.Run("record", func(t *testing.T) {
+		sink := new(mockSink)
+		p := New(WithSink(sink))
+		configRecord := newRecord(t, "C1", &user.User{Id: "C1"})
+		configRecord.Type = "type.googleapis.com/pomerium.config.Config"
+		withTokens := newRecord(t, "S2", &session.Session{
+			Id:         "S2",
+			UserId:     "U1",
+			IdToken:    &session.IDToken{Subject: "U1", Raw: "ID_TOKEN"},
+			OauthToken: &session.OAuthToken{AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"},
+		})
+		p.UpdateRecords(ctx, 1, []*databroker.Record{configRecord, withTokens})
+
+		assert.Equal(t, []string{"S2"}, sink.keys, "should only publish identity records by default")
+		assert.NotContains(t, string(sink.messages[0]), "TOKEN", "should not publish tokens")
+
+		var msg map[string]interface{}
+		require.NoError(t, json.Unmarshal(sink.messages[0], &msg))
+		assert.Equal(t, "U1", msg["data"].(map[string]interface{})["userId"])
+		s := new(session.Session)
+		require.NoError(t, withTokens.GetData().UnmarshalTo(s))
+		assert.Equal(t, "ACCESS_TOKEN", s.GetOauthToken().GetAccessToken(), "should not modify the synced record")
+	})
+	t.Run("filters record types", func(t *testing.T) {
+		sink := new(mockSink)
+		p := New(WithSink(sink), WithRecordTypes([]string{userRecord.GetType()}))
+		p.UpdateRecords(ctx, 1, []*databroker.Record{sessionRecord, userRecord})
+		assert.Equal(t, []string{"U1"}, sink.keys)
+	})
+	t.Run("cloudevents", func(t *testing.T) {
+		sink := new(mockSink)
+		p := New(WithSink(sink), WithFormat(FormatCloudEvents))
+		p.ClearRecords(ctx)
+		p.UpdateRecords(ctx, 1, []*databroker.Record{userRecord})
+
+		configRecord := newRecord(t, "C1", &user.User{Id: "C1"})
+		configRecord.Type = "type.googleapis.com/pomerium.config.Config"
+		created := newRecord(t, "S2", &session.Session{
+			Id:         "S2",
+			UserId:     "U1",
+			IdToken:    &session.IDToken{Subject: "U1", Raw: "ID_TOKEN"},
+			OauthToken: &session.OAuthToken{AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"},
+		})
+		created.Version = 7
+		created.ModifiedAt = timestamppb.New(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+		deleted := newRecord(t, "S2", &session.Session{Id: "S2"})
+		deleted.DeletedAt = timestamppb.Now()
+		p.UpdateRecords(ctx, 1, []*databroker.Record{created, userRecord, configRecord, deleted})
+
+		assert.Equal(t, []string{"S2", "U1", "S2"}, sink.keys, "should only publish identity records by default")
+		assert.Equal(t, cloudEventsContentType, sink.contentTypes[0])
+
+		var evt map[string]interface{}
+		require.NoError(t, json.Unmarshal(sink.messages[0], &evt))
+		assert.Equal(t, "1.0", evt["specversion"])
+		assert.Equal(t, "1-7", evt["id"])
+		assert.Equal(t, "/pomerium/databroker", evt["source"])
+		assert.Equal(t, "com.pomerium.session.created", evt["type"])
+		assert.Equal(t, "S2", evt["subject"])
+		assert.Equal(t, "2021-06-01T12:00:00Z", evt["time"])
+		assert.Equal(t, "application/json", evt["datacontenttype"])
+		assert.NotContains(t, string(sink.messages[0]), "TOKEN", "should not publish tokens")
+		assert.Equal(t, "U1", evt["data"].(map[string]interface{})["userId"])
+
+		for i, typ := range []string{"com.pomerium.user.updated", "com.pomerium.session.deleted"} {
+			require.NoError(t, json.Unmarshal(sink.messages[i+1], &evt))
+			assert.Equal(t, typ, evt["type"])
+		}
+	})
+	t.Run("no sink", func(t *testing.T) {
+		p := New()
+		assert.NotPanics(t, func() {
+			p.UpdateRecords(ctx, 1, []*databroker.Record{sessionRecord})
+		})
+	})
+}
+
+func TestNewSink(t *testing.T) {
+	for _, tc := range []struct {
+		name, url, topic string
+		expectErr        bool
+	}{
+		{"kafka", "kafka://kafka-1:9092,kafka-2:9092", "pomerium", false},
+		{"missing topic", "kafka://kafka-1:9092", "", true},
+		{"missing host", "kafka://", "pomerium", true},
+		{"unsupported scheme", "amqp://rabbitmq:5672", "pomerium", true},
+		{"webhook", "https://siem.example.com/events", "", false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			sink, err := NewSink(tc.url, tc.topic)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, sink.Close())
+		})
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var contentType, body, username string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		username, _, _ = r.BasicAuth()
+		bs, _ := ioutil.ReadAll(r.Body)
+		body = string(bs)
+		if body == "FAIL" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	u.User = url.UserPassword("pomerium", "SECRET")
+	sink, err := NewSink(u.String(), "")
+	require.NoError(t, err)
+	defer func() { _ = sink.Close() }()
+
+	err = sink.Publish(context.Background(), &Message{Key: "S1", ContentType: cloudEventsContentType, Value: []byte("{}")})
+	assert.NoError(t, err)
+	assert.Equal(t, cloudEventsContentType, contentType)
+	assert.Equal(t, "{}", body)
+	assert.Equal(t, "pomerium", username)
+
+	err = sink.Publish(context.Background(), &Message{Key: "S1", ContentType: cloudEventsContentType, Value: []byte("FAIL")})
+	assert.Error(t, err)
+}
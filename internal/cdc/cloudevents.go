@@ -0,0 +1,114 @@
+package cdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// Supported message formats.
+const (
+	// FormatRecord publishes each changed databroker record as JSON.
+	FormatRecord = "record"
+	// FormatCloudEvents publishes a CloudEvent for each created, updated or deleted record.
+	FormatCloudEvents = "cloudevents"
+)
+
+const (
+	recordContentType      = "application/json"
+	cloudEventsContentType = "application/cloudevents+json"
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsSource      = "/pomerium/databroker"
+	cloudEventsTypePrefix  = "com.pomerium."
+)
+
+// identityRecordTypes are the record types published by default, and the names used in their CloudEvent types.
+var identityRecordTypes = map[string]string{
+	grpcutil.GetTypeURL(new(session.Session)):     "session",
+	grpcutil.GetTypeURL(new(user.User)):           "user",
+	grpcutil.GetTypeURL(new(user.ServiceAccount)): "service_account",
+}
+
+// A cloudEvent is a CloudEvent in the JSON event format, see
+// https://github.com/cloudevents/spec/blob/v1.0.1/json-format.md.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// newCloudEventMessage returns the CloudEvent message for a changed record. created is true if the record didn't
+// exist before the change.
+func newCloudEventMessage(serverVersion uint64, record *databroker.Record, created bool) (*Message, error) {
+	action := "updated"
+	switch {
+	case record.GetDeletedAt() != nil:
+		action = "deleted"
+	case created:
+		action = "created"
+	}
+
+	evt := cloudEvent{
+		SpecVersion: cloudEventsSpecVersion,
+		ID:          fmt.Sprintf("%d-%d", serverVersion, record.GetVersion()),
+		Source:      cloudEventsSource,
+		Type:        cloudEventsTypePrefix + getCloudEventRecordName(record.GetType()) + "." + action,
+		Subject:     record.GetId(),
+	}
+	if record.GetModifiedAt() != nil {
+		evt.Time = record.GetModifiedAt().AsTime().Format(time.RFC3339Nano)
+	}
+	if record.GetData() != nil {
+		data, err := marshalCloudEventData(record)
+		if err != nil {
+			return nil, err
+		}
+		evt.DataContentType = recordContentType
+		evt.Data = data
+	}
+
+	value, err := json.Marshal(evt)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Key:         record.GetId(),
+		ContentType: cloudEventsContentType,
+		Value:       value,
+	}, nil
+}
+
+// getCloudEventRecordName returns the name of a record type used in event types, e.g. session for sessions and
+// directory.user for directory users.
+func getCloudEventRecordName(recordType string) string {
+	if name, ok := identityRecordTypes[recordType]; ok {
+		return name
+	}
+	return strings.ToLower(recordType[strings.LastIndex(recordType, "/")+1:])
+}
+
+// marshalCloudEventData returns the JSON encoded record data. The OAuth and ID tokens of sessions are removed, so
+// they aren't sent to consumers.
+func marshalCloudEventData(record *databroker.Record) ([]byte, error) {
+	msg, err := record.GetData().UnmarshalNew()
+	if err != nil {
+		// types this build doesn't know about are published as is
+		return protojson.Marshal(record.GetData())
+	}
+
+	redactData(msg)
+	return protojson.Marshal(msg)
+}
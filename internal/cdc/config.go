@@ -0,0 +1,73 @@
+package cdc
+
+import (
+	"sync/atomic"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type config struct {
+	dataBrokerClient databroker.DataBrokerServiceClient
+	sink             Sink
+	recordTypes      []string
+	format           string
+}
+
+func newConfig(options ...Option) *config {
+	cfg := new(config)
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// An Option customizes the configuration used for the publisher.
+type Option func(*config)
+
+// WithDataBrokerClient sets the databroker client in the config.
+func WithDataBrokerClient(dataBrokerClient databroker.DataBrokerServiceClient) Option {
+	return func(cfg *config) {
+		cfg.dataBrokerClient = dataBrokerClient
+	}
+}
+
+// WithSink sets the sink record changes are published to. If nil, no changes are published.
+func WithSink(sink Sink) Option {
+	return func(cfg *config) {
+		cfg.sink = sink
+	}
+}
+
+// WithRecordTypes restricts the published changes to the given record types. If empty, changes
+// to all record types are published.
+func WithRecordTypes(recordTypes []string) Option {
+	return func(cfg *config) {
+		cfg.recordTypes = recordTypes
+	}
+}
+
+// WithFormat sets the format of the published messages, FormatRecord or FormatCloudEvents. If empty,
+// FormatRecord is used.
+func WithFormat(format string) Option {
+	return func(cfg *config) {
+		cfg.format = format
+	}
+}
+
+type atomicConfig struct {
+	value atomic.Value
+}
+
+func newAtomicConfig(cfg *config) *atomicConfig {
+	ac := new(atomicConfig)
+	ac.Store(cfg)
+	return ac
+}
+
+func (ac *atomicConfig) Load() *config {
+	return ac.value.Load().(*config)
+}
+
+func (ac *atomicConfig) Store(cfg *config) {
+	ac.value.Store(cfg)
+}
@@ -0,0 +1,155 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+const webhookRequestTimeout = 10 * time.Second
+
+// A Message is a record change published to a sink.
+type Message struct {
+	// Key is the key used to partition messages, the record id.
+	Key string
+	// ContentType is the media type of the value.
+	ContentType string
+	Value       []byte
+}
+
+// A Sink is a message bus record changes are published to.
+type Sink interface {
+	// Publish publishes a message.
+	Publish(ctx context.Context, msg *Message) error
+	// Close closes the sink.
+	Close() error
+}
+
+// NewSink creates a new Sink from a URL. Supported schemes are nats://, kafka://, and http:// or https:// for
+// webhooks. Multiple NATS or Kafka servers can be given as a comma-separated list of hosts, e.g.
+// kafka://kafka-1:9092,kafka-2:9092. The topic isn't used by webhooks.
+func NewSink(rawURL, topic string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("cdc: invalid url: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("cdc: invalid url, no host: %s", rawURL)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return newWebhookSink(u), nil
+	}
+
+	if topic == "" {
+		return nil, fmt.Errorf("cdc: topic is required")
+	}
+	switch u.Scheme {
+	case "nats":
+		return newNATSSink(u, topic)
+	case "kafka":
+		return newKafkaSink(u, topic), nil
+	default:
+		return nil, fmt.Errorf("cdc: unsupported url scheme: %s", u.Scheme)
+	}
+}
+
+type natsSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func newNATSSink(u *url.URL, subject string) (*natsSink, error) {
+	servers := make([]string, 0)
+	for _, host := range strings.Split(u.Host, ",") {
+		servers = append(servers, (&url.URL{Scheme: u.Scheme, User: u.User, Host: host}).String())
+	}
+	conn, err := nats.Connect(strings.Join(servers, ","),
+		nats.Name("pomerium"),
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true))
+	if err != nil {
+		return nil, fmt.Errorf("cdc: error connecting to nats: %w", err)
+	}
+	return &natsSink{conn: conn, subject: subject}, nil
+}
+
+// Publish publishes the value to the subject. NATS has no message keys, so the key is ignored.
+func (s *natsSink) Publish(ctx context.Context, msg *Message) error {
+	return s.conn.Publish(s.subject, msg.Value)
+}
+
+func (s *natsSink) Close() error {
+	return s.conn.Drain()
+}
+
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSink(u *url.URL, topic string) *kafkaSink {
+	return &kafkaSink{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(strings.Split(u.Host, ",")...),
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+		},
+	}
+}
+
+func (s *kafkaSink) Publish(ctx context.Context, msg *Message) error {
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(msg.Key),
+		Value:   msg.Value,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte(msg.ContentType)}},
+	})
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+// A webhookSink posts each message to a URL. Credentials in the URL are sent using basic auth.
+type webhookSink struct {
+	client *http.Client
+	url    string
+}
+
+func newWebhookSink(u *url.URL) *webhookSink {
+	return &webhookSink{
+		client: &http.Client{Timeout: webhookRequestTimeout},
+		url:    u.String(),
+	}
+}
+
+func (s *webhookSink) Publish(ctx context.Context, msg *Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(msg.Value))
+	if err != nil {
+		return fmt.Errorf("cdc: error creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", msg.ContentType)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cdc: error calling webhook: %w", err)
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("cdc: unexpected status code from webhook: %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,75 @@
+package pomerium
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/testidp"
+)
+
+// defaultDevIDPUser is the user the development identity provider signs in when no users are configured.
+var defaultDevIDPUser = testidp.User{
+	ID:     "dev-user",
+	Email:  "dev-user@example.com",
+	Name:   "Dev User",
+	Groups: []string{"admins"},
+}
+
+// RunDevIDP runs a local OpenID Connect provider for development until it's interrupted. Its users, and the
+// credentials of its client, are loaded from usersFile. Without a users file, it signs in a single default
+// user, and accepts any client. The settings which configure pomerium to use it are written to w.
+func RunDevIDP(ctx context.Context, addr, usersFile string, w io.Writer) error {
+	options := &testidp.Options{Users: []testidp.User{defaultDevIDPUser}}
+	if usersFile != "" {
+		var err error
+		options, err = testidp.LoadOptions(usersFile)
+		if err != nil {
+			return err
+		}
+	}
+	idp, err := testidp.New(*options)
+	if err != nil {
+		return err
+	}
+
+	li, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	issuer := options.Issuer
+	if issuer == "" {
+		issuer = "http://" + li.Addr().String()
+	}
+	clientID, clientSecret := options.ClientID, options.ClientSecret
+	if clientID == "" {
+		clientID, clientSecret = "pomerium", "pomerium"
+	}
+	_, _ = fmt.Fprintf(w, `the development identity provider is listening on %s. NEVER use it in production.
+
+idp_provider: oidc
+idp_provider_url: %s
+idp_client_id: %s
+idp_client_secret: %s
+`, li.Addr(), issuer, clientID, clientSecret)
+
+	srv := &http.Server{Handler: idp, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	if err := srv.Serve(li); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
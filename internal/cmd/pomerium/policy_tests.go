@@ -0,0 +1,208 @@
+package pomerium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/envoy/files"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+// policyTests are the policy tests of a tests file. The users and sessions are the databroker records the
+// policies are evaluated against.
+type policyTests struct {
+	Users    []json.RawMessage `json:"users"`
+	Sessions []json.RawMessage `json:"sessions"`
+	Tests    []policyTest      `json:"tests"`
+}
+
+// A policyTest is a request, and whether the policy of the route it matches should allow it.
+type policyTest struct {
+	Name  string                   `json:"name"`
+	Input *evaluator.PolicyRequest `json:"input"`
+	Allow bool                     `json:"allow"`
+}
+
+// RunPolicyTests runs the policy tests of testsFile, a JSON or YAML document, against the routes of the
+// configuration, and writes the result of each test and the rego coverage of each tested route to w. An error
+// is returned if any test fails, or if the coverage of a tested route's sub policy is below the threshold, a
+// percentage between 0 and 100.
+func RunPolicyTests(ctx context.Context, configFile, testsFile string, threshold float64, w io.Writer) error {
+	src, err := config.NewFileOrEnvironmentSource(configFile, files.FullVersion())
+	if err != nil {
+		return err
+	}
+
+	tests, err := readPolicyTests(testsFile)
+	if err != nil {
+		return err
+	}
+	store, err := newPolicyTestStore(tests)
+	if err != nil {
+		return err
+	}
+
+	type testedRoute struct {
+		policy    *config.Policy
+		evaluator *evaluator.PolicyEvaluator
+		coverage  *evaluator.PolicyCoverage
+	}
+	var routes []*testedRoute
+	routesByPolicy := map[int]*testedRoute{}
+	policies := src.GetConfig().Options.GetAllPolicies()
+
+	var errs *multierror.Error
+	for i, tc := range tests.Tests {
+		name := tc.Name
+		if name == "" {
+			name = fmt.Sprintf("test %d", i+1)
+		}
+
+		idx, err := findPolicyForTest(policies, tc)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%s: %w", name, err))
+			fmt.Fprintf(w, "FAIL\t%s: %s\n", name, err)
+			continue
+		}
+
+		route, ok := routesByPolicy[idx]
+		if !ok {
+			p := policies[idx]
+			e, err := evaluator.NewPolicyEvaluator(ctx, store, &p)
+			if err != nil {
+				return fmt.Errorf("route %s: %w", p.String(), err)
+			}
+			route = &testedRoute{policy: &p, evaluator: e, coverage: evaluator.NewPolicyCoverage()}
+			routesByPolicy[idx] = route
+			routes = append(routes, route)
+		}
+
+		res, err := route.evaluator.EvaluateWithCoverage(ctx, tc.Input, route.coverage)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if allow := res.Allow && res.Deny == nil; allow != tc.Allow {
+			errs = multierror.Append(errs, fmt.Errorf("%s: expected %s, got %s", name, describeAllow(tc.Allow), describeAllow(allow)))
+			fmt.Fprintf(w, "FAIL\t%s: expected %s, got %s\n", name, describeAllow(tc.Allow), describeAllow(allow))
+			continue
+		}
+		fmt.Fprintf(w, "PASS\t%s\n", name)
+	}
+
+	for _, route := range routes {
+		report, err := route.coverage.Report(route.evaluator)
+		if err != nil {
+			return err
+		}
+
+		line := fmt.Sprintf("route %s: policy %.2f%%", route.policy.String(), report.Policy)
+		names := make([]string, 0, len(report.SubPolicies))
+		for name := range report.SubPolicies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			line += fmt.Sprintf(", %s %.2f%%", name, report.SubPolicies[name])
+		}
+		fmt.Fprintln(w, line)
+
+		if err := report.Validate(threshold); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("route %s: %w", route.policy.String(), err))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func readPolicyTests(testsFile string) (*policyTests, error) {
+	data, err := ioutil.ReadFile(testsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is converted to JSON, so that the requests are decoded the same way as the authorize service's
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", testsFile, err)
+	}
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", testsFile, err)
+	}
+
+	var raw struct {
+		policyTests
+		Tests []json.RawMessage `json:"tests"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", testsFile, err)
+	}
+
+	tests := &policyTests{Users: raw.Users, Sessions: raw.Sessions}
+	for _, rawTest := range raw.Tests {
+		// requests have a valid client certificate unless the test says otherwise
+		tc := policyTest{Input: &evaluator.PolicyRequest{IsValidClientCertificate: true}}
+		if err := json.Unmarshal(rawTest, &tc); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", testsFile, err)
+		}
+		if tc.Input == nil {
+			return nil, fmt.Errorf("error parsing %s: every test requires an input", testsFile)
+		}
+		tests.Tests = append(tests.Tests, tc)
+	}
+	return tests, nil
+}
+
+func newPolicyTestStore(tests *policyTests) (*evaluator.Store, error) {
+	var msgs []proto.Message
+	for _, data := range tests.Users {
+		u := new(user.User)
+		if err := protojson.Unmarshal(data, u); err != nil {
+			return nil, fmt.Errorf("invalid user: %w", err)
+		}
+		msgs = append(msgs, u)
+	}
+	for _, data := range tests.Sessions {
+		s := new(session.Session)
+		if err := protojson.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("invalid session: %w", err)
+		}
+		msgs = append(msgs, s)
+	}
+	return evaluator.NewStoreFromProtos(math.MaxUint64, msgs...), nil
+}
+
+// findPolicyForTest returns the index of the first route which matches the test's request URL.
+func findPolicyForTest(policies []config.Policy, tc policyTest) (int, error) {
+	u, err := url.Parse(tc.Input.HTTP.URL)
+	if err != nil || u.Host == "" {
+		return 0, fmt.Errorf("invalid request url %q", tc.Input.HTTP.URL)
+	}
+	for i := range policies {
+		if policies[i].Matches(*u) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no route matches %s", u.String())
+}
+
+func describeAllow(allow bool) string {
+	if allow {
+		return "allow"
+	}
+	return "deny"
+}
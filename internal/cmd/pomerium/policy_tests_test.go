@@ -0,0 +1,102 @@
+package pomerium
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPolicyTests(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(`
+authenticate_service_url: https://authenticate.example.com
+shared_secret: YixWi1MYh77NMECGGIJQevoonYtVF+ZPRkQZrrmeRqM=
+cookie_secret: OqJfHAblE6PI7jR3fo/4TEXPhB0Ggx0X+AKUMl9StbU=
+idp_provider: google
+idp_client_id: CLIENT_ID
+idp_client_secret: CLIENT_SECRET
+insecure_server: true
+policy:
+  - from: https://from.example.com
+    to: https://to.example.com
+    allowed_users: [alice@example.com]
+    sub_policies:
+      - name: admin paths
+        rego:
+          - |
+            package pomerium.policy
+            allow {
+              startswith(input.http.url, "https://from.example.com/public")
+            }
+            deny = [403, "admins only"] {
+              startswith(input.http.url, "https://from.example.com/admin")
+            }
+`), 0o600))
+
+	writeTests := func(t *testing.T, tests string) string {
+		testsFile := filepath.Join(t.TempDir(), "tests.yaml")
+		require.NoError(t, ioutil.WriteFile(testsFile, []byte(`
+users:
+  - id: alice
+    email: alice@example.com
+sessions:
+  - id: s1
+    user_id: alice
+tests:
+`+tests), 0o600))
+		return testsFile
+	}
+	aliceAllowed := `
+  - name: alice allowed
+    input:
+      http: {method: GET, url: https://from.example.com/get}
+      session: {id: s1}
+    allow: true
+`
+	adminDenied := `
+  - name: admin denied
+    input:
+      http: {method: GET, url: https://from.example.com/admin}
+      session: {id: s1}
+    allow: false
+`
+
+	t.Run("pass", func(t *testing.T) {
+		var out bytes.Buffer
+		err := RunPolicyTests(ctx, configFile, writeTests(t, aliceAllowed+adminDenied), 0, &out)
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "PASS\talice allowed\n")
+		assert.Contains(t, out.String(), "PASS\tadmin denied\n")
+		assert.Contains(t, out.String(), "route https://from.example.com → https://to.example.com: policy ")
+		assert.Contains(t, out.String(), ", admin paths ")
+	})
+	t.Run("fail", func(t *testing.T) {
+		var out bytes.Buffer
+		err := RunPolicyTests(ctx, configFile, writeTests(t, `
+  - name: anonymous allowed
+    input:
+      http: {method: GET, url: https://from.example.com/get}
+    allow: true
+  - name: unknown route
+    input:
+      http: {method: GET, url: https://other.example.com/get}
+    allow: true
+`), 0, &out)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "anonymous allowed: expected allow, got deny")
+		assert.Contains(t, err.Error(), "unknown route: no route matches https://other.example.com/get")
+	})
+	t.Run("coverage threshold", func(t *testing.T) {
+		var out bytes.Buffer
+		err := RunPolicyTests(ctx, configFile, writeTests(t, aliceAllowed), 100, &out)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "sub policy coverage below threshold of 100.00%: admin paths")
+	})
+}
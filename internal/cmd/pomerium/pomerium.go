@@ -20,10 +20,12 @@ import (
 	"github.com/pomerium/pomerium/config"
 	databroker_service "github.com/pomerium/pomerium/databroker"
 	"github.com/pomerium/pomerium/internal/autocert"
+	"github.com/pomerium/pomerium/internal/consul"
 	"github.com/pomerium/pomerium/internal/controlplane"
 	"github.com/pomerium/pomerium/internal/databroker"
 	"github.com/pomerium/pomerium/internal/envoy"
 	"github.com/pomerium/pomerium/internal/envoy/files"
+	"github.com/pomerium/pomerium/internal/kubernetes"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/registry"
 	"github.com/pomerium/pomerium/internal/urlutil"
@@ -45,7 +47,10 @@ func Run(ctx context.Context, configFile string) error {
 		return err
 	}
 
+	src = config.NewVaultSource(ctx, src)
+	src = consul.NewConfigSource(ctx, src)
 	src = databroker.NewConfigSource(ctx, src)
+	src = kubernetes.NewConfigSource(ctx, src)
 	logMgr := config.NewLogManager(ctx, src)
 	defer logMgr.Close()
 
@@ -60,10 +65,14 @@ func Run(ctx context.Context, configFile string) error {
 	// override the default http transport so we can use the custom CA in the TLS client config (#1570)
 	http.DefaultTransport = config.NewHTTPTransport(src)
 
+	changeLogMgr := config.NewChangeLogManager(ctx, src)
+	defer changeLogMgr.Close()
 	metricsMgr := config.NewMetricsManager(ctx, src)
 	defer metricsMgr.Close()
 	traceMgr := config.NewTraceManager(ctx, src)
 	defer traceMgr.Close()
+	// the branding is set before the control plane renders envoy's error pages
+	config.NewBrandingManager(ctx, src)
 
 	// setup the control plane
 	controlPlane, err := controlplane.NewServer(src.GetConfig().Options.Services, metricsMgr)
@@ -0,0 +1,90 @@
+package pomerium
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/envoy/files"
+)
+
+// ExportRoutes writes the routes of the configuration, including those of the policy directory, to w as a
+// JSON document in the format of the files in a policy directory.
+func ExportRoutes(ctx context.Context, configFile string, w io.Writer) error {
+	src, err := config.NewFileOrEnvironmentSource(configFile, files.FullVersion())
+	if err != nil {
+		return err
+	}
+
+	bs, err := config.MarshalPolicies(src.GetConfig().Options.Policies)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(bs, '\n'))
+	return err
+}
+
+// ImportRoutes validates the routes of routesFile, a JSON or YAML document in the format of the files in a
+// policy directory, against the configuration, and compiles their policies. If outputFile is set, the
+// routes file is then copied to it atomically, so that a policy directory never contains a partial file.
+func ImportRoutes(ctx context.Context, configFile, routesFile, outputFile string) error {
+	src, err := config.NewFileOrEnvironmentSource(configFile, files.FullVersion())
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(routesFile)
+	if err != nil {
+		return err
+	}
+	configType := "yaml"
+	if strings.EqualFold(filepath.Ext(routesFile), ".json") {
+		configType = "json"
+	}
+	policies, err := config.UnmarshalPolicies(data, configType, src.GetConfig().Options.PolicySets)
+	if err != nil {
+		return err
+	}
+	var errs *multierror.Error
+	errs = multierror.Append(errs, validatePolicies(ctx, &config.Options{Policies: policies})...)
+	if err := errs.ErrorOrNil(); err != nil {
+		return err
+	}
+
+	if outputFile == "" {
+		return nil
+	}
+	return writeFileAtomically(outputFile, data)
+}
+
+func writeFileAtomically(name string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", name, err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return fmt.Errorf("error replacing %s: %w", name, err)
+	}
+	return nil
+}
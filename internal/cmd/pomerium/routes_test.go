@@ -0,0 +1,70 @@
+package pomerium
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutes(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(`
+authenticate_service_url: https://authenticate.example.com
+shared_secret: YixWi1MYh77NMECGGIJQevoonYtVF+ZPRkQZrrmeRqM=
+cookie_secret: OqJfHAblE6PI7jR3fo/4TEXPhB0Ggx0X+AKUMl9StbU=
+idp_provider: google
+idp_client_id: CLIENT_ID
+idp_client_secret: CLIENT_SECRET
+insecure_server: true
+policy:
+  - from: https://from.example.com
+    to: https://to.example.com
+    allowed_domains: [example.com]
+`), 0o600))
+
+	var exported bytes.Buffer
+	require.NoError(t, ExportRoutes(ctx, configFile, &exported))
+	assert.JSONEq(t, `{"policy": [{
+		"from": "https://from.example.com",
+		"to": ["https://to.example.com"],
+		"allowed_domains": ["example.com"]
+	}]}`, exported.String())
+
+	t.Run("import", func(t *testing.T) {
+		routesFile := filepath.Join(dir, "routes.json")
+		require.NoError(t, ioutil.WriteFile(routesFile, exported.Bytes(), 0o600))
+		require.NoError(t, ImportRoutes(ctx, configFile, routesFile, ""), "exported routes should be importable")
+
+		require.NoError(t, ioutil.WriteFile(routesFile, []byte(`{"policy": [{
+			"from": "https://other.example.com",
+			"to": "https://other.internal",
+			"allow_any_authenticated_user": true
+		}]}`), 0o600))
+		require.NoError(t, ImportRoutes(ctx, configFile, routesFile, filepath.Join(dir, "imported.json")))
+		bs, err := ioutil.ReadFile(filepath.Join(dir, "imported.json"))
+		require.NoError(t, err)
+		assert.Contains(t, string(bs), "https://other.example.com")
+	})
+	t.Run("invalid", func(t *testing.T) {
+		routesFile := filepath.Join(dir, "invalid.yaml")
+		require.NoError(t, ioutil.WriteFile(routesFile, []byte(`
+policy:
+  - from: https://other.example.com
+    to: https://other.internal
+    sub_policies:
+      - rego: ["package pomerium.policy\nallow { "]
+`), 0o600))
+		outputFile := filepath.Join(dir, "invalid-output.yaml")
+		err := ImportRoutes(ctx, configFile, routesFile, outputFile)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "rego_parse_error")
+		assert.NoFileExists(t, outputFile)
+	})
+}
@@ -0,0 +1,113 @@
+package pomerium
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/pomerium/pomerium/authenticate"
+	"github.com/pomerium/pomerium/authorize"
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/envoy/files"
+	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/proxy"
+)
+
+// Validate checks the configuration without starting pomerium. It loads the config file and environment,
+// validates the settings of each enabled service and the identity provider, compiles the policy of every
+// route, and checks that the certificates are valid now. Every problem found is returned.
+func Validate(ctx context.Context, configFile string) error {
+	src, err := config.NewFileOrEnvironmentSource(configFile, files.FullVersion())
+	if err != nil {
+		return err
+	}
+	cfg := src.GetConfig()
+
+	var errs *multierror.Error
+	errs = multierror.Append(errs, validatePolicies(ctx, cfg.Options)...)
+	errs = multierror.Append(errs, validateCertificates(cfg.Options, time.Now())...)
+	errs = multierror.Append(errs, validateServices(cfg)...)
+	return errs.ErrorOrNil()
+}
+
+// validatePolicies compiles the policy of every route, including custom rego.
+func validatePolicies(ctx context.Context, options *config.Options) []error {
+	var errs []error
+	store := evaluator.NewStore()
+	for _, p := range options.GetAllPolicies() {
+		p := p
+		if _, err := evaluator.NewPolicyEvaluator(ctx, store, &p); err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %w", p.String(), err))
+		}
+	}
+	return errs
+}
+
+// validateCertificates checks that the server certificates are valid now.
+func validateCertificates(options *config.Options, now time.Time) []error {
+	certs, err := options.GetCertificates()
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, cert := range certs {
+		if len(cert.Certificate) == 0 {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("certificate: %w", err))
+			continue
+		}
+		name := leaf.Subject.CommonName
+		if len(leaf.DNSNames) > 0 {
+			name = leaf.DNSNames[0]
+		}
+		switch {
+		case now.After(leaf.NotAfter):
+			errs = append(errs, fmt.Errorf("certificate %s: expired at %s", name, leaf.NotAfter.Format(time.RFC3339)))
+		case now.Before(leaf.NotBefore):
+			errs = append(errs, fmt.Errorf("certificate %s: not valid until %s", name, leaf.NotBefore.Format(time.RFC3339)))
+		}
+	}
+	return errs
+}
+
+// validateServices validates the settings of each enabled service. The identity provider is checked
+// without contacting it.
+func validateServices(cfg *config.Config) []error {
+	var errs []error
+	if config.IsAuthenticate(cfg.Options.Services) {
+		if err := authenticate.ValidateOptions(cfg.Options); err != nil {
+			errs = append(errs, err)
+		}
+		err := identity.ValidateOptions(oauth.Options{
+			ProviderName: cfg.Options.Provider,
+			ProviderURL:  cfg.Options.ProviderURL,
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if config.IsAuthorize(cfg.Options.Services) {
+		// policies were already compiled by validatePolicies, so that errors name the route
+		cfg := cfg.Clone()
+		cfg.Options.Policies = nil
+		cfg.Options.AdditionalPolicies = nil
+		if _, err := authorize.New(cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if config.IsProxy(cfg.Options.Services) {
+		if err := proxy.ValidateOptions(cfg.Options); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,62 @@
+package pomerium
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	writeConfig := func(t *testing.T, cfg string) string {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, ioutil.WriteFile(configFile, []byte(cfg), 0o600))
+		return configFile
+	}
+	base := `
+authenticate_service_url: https://authenticate.example.com
+shared_secret: YixWi1MYh77NMECGGIJQevoonYtVF+ZPRkQZrrmeRqM=
+cookie_secret: OqJfHAblE6PI7jR3fo/4TEXPhB0Ggx0X+AKUMl9StbU=
+idp_client_id: CLIENT_ID
+idp_client_secret: CLIENT_SECRET
+insecure_server: true
+`
+
+	t.Run("valid", func(t *testing.T) {
+		err := Validate(context.Background(), writeConfig(t, base+`
+idp_provider: google
+policy:
+  - from: https://from.example.com
+    to: https://to.example.com
+    allowed_domains: [example.com]
+`))
+		assert.NoError(t, err)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		err := Validate(context.Background(), writeConfig(t, base+`
+idp_provider: okta
+certificate_file: ../../../config/testdata/example-cert.pem
+certificate_key_file: ../../../config/testdata/example-key.pem
+policy:
+  - from: https://from.example.com
+    to: https://to.example.com
+    sub_policies:
+      - rego: ["package pomerium.policy\nallow { "]
+`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "route https://from.example.com → https://to.example.com: ")
+		assert.Contains(t, err.Error(), "rego_parse_error")
+		assert.Contains(t, err.Error(), "expired at 2018-10-20T19:43:06Z")
+		assert.Contains(t, err.Error(), "identity: a provider url is required for okta")
+	})
+	t.Run("unparseable", func(t *testing.T) {
+		err := Validate(context.Background(), writeConfig(t, base+`
+policy:
+  - from: https://from.example.com
+`))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,89 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Client is a minimal Consul API client which can watch a KV key.
+type Client struct {
+	address    *url.URL
+	token      string
+	tokenFile  string
+	httpClient *http.Client
+}
+
+// NewClient creates a new Client for the Consul agent at address. If tokenFile is set, the ACL token is
+// read from it on every request so that rotated tokens are picked up.
+func NewClient(address *url.URL, token, tokenFile string, httpClient *http.Client) *Client {
+	return &Client{
+		address:    address,
+		token:      token,
+		tokenFile:  tokenFile,
+		httpClient: httpClient,
+	}
+}
+
+// getKey gets the raw value of key using a blocking query. If index is non-zero, the request blocks until
+// the key changes after index or wait elapses. A nil value is returned if the key doesn't exist.
+func (c *Client) getKey(ctx context.Context, key string, index uint64, wait time.Duration) (value []byte, newIndex uint64, err error) {
+	query := url.Values{"raw": {""}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", wait.String())
+	}
+	u := c.address.ResolveReference(&url.URL{
+		Path:     path.Join("/v1/kv", key),
+		RawQuery: query.Encode(),
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	token := c.token
+	if c.tokenFile != "" {
+		bs, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, 0, fmt.Errorf("consul: error reading token file: %w", err)
+		}
+		token = strings.TrimSpace(string(bs))
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+
+	bs, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul: error reading %s: %w", key, err)
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		value = bs
+	case http.StatusNotFound:
+		value = nil
+	default:
+		return nil, 0, fmt.Errorf("consul: unexpected status code for %s: %d %s",
+			key, res.StatusCode, strings.TrimSpace(string(bs)))
+	}
+
+	newIndex, err = strconv.ParseUint(res.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul: invalid index for %s: %w", key, err)
+	}
+	return value, newIndex, nil
+}
@@ -0,0 +1,197 @@
+// Package consul contains a config source which loads configuration from Consul KV.
+package consul
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/hashutil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+	"github.com/pomerium/pomerium/internal/urlutil"
+)
+
+const (
+	// initialLoadTimeout is how long to wait for the initial value before starting without it.
+	initialLoadTimeout = 10 * time.Second
+	// watchWait is how long a blocking query waits for the key to change.
+	watchWait = 5 * time.Minute
+)
+
+// ConfigSource provides a new Config source that merges configuration stored in Consul KV over an
+// underlying config.
+type ConfigSource struct {
+	mu               sync.RWMutex
+	computedConfig   *config.Config
+	underlyingConfig *config.Config
+	value            []byte
+	watcherHash      uint64
+	cancel           func()
+
+	config.ChangeDispatcher
+}
+
+// NewConfigSource creates a new ConfigSource. When consul_address is set, consul_key is watched and its
+// value is merged over the underlying config whenever it changes.
+func NewConfigSource(ctx context.Context, underlying config.Source, listeners ...config.ChangeListener) *ConfigSource {
+	src := &ConfigSource{}
+	for _, li := range listeners {
+		src.OnConfigChange(ctx, li)
+	}
+	underlying.OnConfigChange(ctx, func(ctx context.Context, cfg *config.Config) {
+		src.mu.Lock()
+		src.underlyingConfig = cfg.Clone()
+		src.mu.Unlock()
+
+		src.rebuild(ctx, firstTime(false))
+	})
+	src.underlyingConfig = underlying.GetConfig()
+	src.rebuild(ctx, firstTime(true))
+	return src
+}
+
+// GetConfig gets the current config.
+func (src *ConfigSource) GetConfig() *config.Config {
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+
+	return src.computedConfig
+}
+
+type firstTime bool
+
+func (src *ConfigSource) rebuild(ctx context.Context, firstTime firstTime) {
+	_, span := trace.StartSpan(ctx, "consul.config_source.rebuild")
+	defer span.End()
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	cfg := src.underlyingConfig.Clone()
+
+	src.runWatcher(cfg.Options)
+
+	if cfg.Options.ConsulAddress != "" && src.value != nil {
+		options, err := cfg.Options.MergeConfigData(src.value, "yaml")
+		if err != nil {
+			log.Error(ctx).Err(err).Str("key", cfg.Options.ConsulKey).Msg("consul: error updating config")
+			metrics.SetConfigInfo(ctx, cfg.Options.Services, "consul", cfg.Checksum(), false)
+			// keep the last good config
+			if src.computedConfig != nil {
+				return
+			}
+		} else {
+			cfg.Options = options
+			metrics.SetConfigInfo(ctx, cfg.Options.Services, "consul", cfg.Checksum(), true)
+		}
+	}
+
+	src.computedConfig = cfg
+	if !firstTime {
+		src.Trigger(ctx, cfg)
+	}
+}
+
+func (src *ConfigSource) runWatcher(options *config.Options) {
+	h, err := hashutil.Hash(struct {
+		Address, Key, Token, TokenFile string
+	}{options.ConsulAddress, options.ConsulKey, options.ConsulToken, options.ConsulTokenFile})
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	// nothing changed, so don't restart the watcher
+	if src.watcherHash == h {
+		return
+	}
+	src.watcherHash = h
+
+	if src.cancel != nil {
+		src.cancel()
+		src.cancel = nil
+	}
+	src.value = nil
+
+	if options.ConsulAddress == "" {
+		return
+	}
+
+	ctx := context.Background()
+	ctx, src.cancel = context.WithCancel(ctx)
+
+	address, err := urlutil.ParseAndValidateURL(options.ConsulAddress)
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("consul: invalid consul address")
+		return
+	}
+	client := NewClient(address, options.ConsulToken, options.ConsulTokenFile, http.DefaultClient)
+
+	// load the initial value synchronously so that the first config includes it
+	loadCtx, clearTimeout := context.WithTimeout(ctx, initialLoadTimeout)
+	value, index, err := client.getKey(loadCtx, options.ConsulKey, 0, watchWait)
+	clearTimeout()
+	if err != nil {
+		log.Error(ctx).Err(err).Str("key", options.ConsulKey).Msg("consul: error loading config")
+	} else {
+		src.value = value
+	}
+
+	go src.watch(ctx, client, options.ConsulKey, index)
+}
+
+// watch watches key until the context is canceled, rebuilding the config whenever its value changes.
+func (src *ConfigSource) watch(ctx context.Context, client *Client, key string, index uint64) {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxInterval = time.Minute
+	bo.MaxElapsedTime = 0
+
+	for {
+		value, newIndex, err := client.getKey(ctx, key, index, watchWait)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warn(ctx).Err(err).Str("key", key).Msg("consul: error watching config")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(bo.NextBackOff()):
+			}
+			continue
+		}
+		bo.Reset()
+
+		// per the consul docs, reset the index if it goes backwards and never use an index of 0
+		switch {
+		case newIndex < index:
+			index = 0
+		case newIndex == 0:
+			index = 1
+		default:
+			index = newIndex
+		}
+
+		src.mu.Lock()
+		// the watcher may have been replaced while the request was in flight
+		if ctx.Err() != nil {
+			src.mu.Unlock()
+			return
+		}
+		changed := !bytes.Equal(src.value, value) || (src.value == nil) != (value == nil)
+		if changed {
+			src.value = value
+		}
+		src.mu.Unlock()
+
+		if changed {
+			log.Info(ctx).Str("key", key).Msg("consul: config updated, reconfiguring...")
+			src.rebuild(ctx, firstTime(false))
+		}
+	}
+}
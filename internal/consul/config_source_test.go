@@ -0,0 +1,139 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+// fakeKV is a fake Consul KV endpoint for a single key which supports blocking queries.
+type fakeKV struct {
+	mu      sync.Mutex
+	index   uint64
+	value   []byte
+	changed chan struct{}
+}
+
+func (kv *fakeKV) set(value string) {
+	kv.mu.Lock()
+	kv.index++
+	kv.value = []byte(value)
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+	kv.mu.Unlock()
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != "TOKEN" {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path != "/v1/kv/pomerium/config" {
+		http.NotFound(w, r)
+		return
+	}
+
+	index, _ := strconv.ParseUint(r.FormValue("index"), 10, 64)
+	kv.mu.Lock()
+	if index > 0 && index == kv.index {
+		changed := kv.changed
+		kv.mu.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		kv.mu.Lock()
+	}
+	value, currentIndex := kv.value, kv.index
+	kv.mu.Unlock()
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(currentIndex, 10))
+	if value == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write(value)
+}
+
+func TestConfigSource(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer clearTimeout()
+
+	kv := &fakeKV{index: 1, changed: make(chan struct{})}
+	srv := httptest.NewServer(kv)
+	defer srv.Close()
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(fmt.Sprintf(`
+insecure_server: true
+consul_address: %s
+consul_key: pomerium/config
+consul_token: TOKEN
+policy:
+  - from: https://file.example.com
+    to: https://to.example.com
+`, srv.URL)), 0o600))
+
+	underlying, err := config.NewFileOrEnvironmentSource(configFile, "")
+	require.NoError(t, err)
+
+	changes := make(chan *config.Config, 10)
+	src := NewConfigSource(ctx, underlying, func(ctx context.Context, cfg *config.Config) {
+		changes <- cfg
+	})
+	defer src.cancel()
+
+	getRoutes := func(cfg *config.Config) []string {
+		var froms []string
+		for _, p := range cfg.Options.GetAllPolicies() {
+			froms = append(froms, p.From)
+		}
+		return froms
+	}
+	waitForRoutes := func(expected ...string) {
+		t.Helper()
+		for {
+			if assert.ObjectsAreEqual(expected, getRoutes(src.GetConfig())) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expected routes %v, got %v", expected, getRoutes(src.GetConfig()))
+			case <-changes:
+			}
+		}
+	}
+
+	// the key doesn't exist yet, so the file config is used
+	assert.Equal(t, []string{"https://file.example.com"}, getRoutes(src.GetConfig()))
+
+	kv.set(`
+policy:
+  - from: https://consul.example.com
+    to: https://to.example.com
+`)
+	waitForRoutes("https://consul.example.com")
+	assert.True(t, src.GetConfig().Options.InsecureServer, "file options should be kept")
+
+	// invalid config is ignored
+	kv.set(`policy: [{from: "https://consul.example.com"}]`)
+	kv.set(`
+policy:
+  - from: https://consul2.example.com
+    to: https://to.example.com
+`)
+	waitForRoutes("https://consul2.example.com")
+}
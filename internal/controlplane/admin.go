@@ -0,0 +1,376 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/admintoken"
+	"github.com/pomerium/pomerium/internal/httputil"
+	configpb "github.com/pomerium/pomerium/pkg/grpc/config"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// adminRouteRecordIDPrefix is the prefix of the ids of the databroker records of routes managed by the
+// admin API. Each route is stored as its own config record, so the databroker config source propagates
+// it to every pomerium instance.
+const adminRouteRecordIDPrefix = "admin-api/routes/"
+
+// adminRouteLeasePrefix is the prefix of the names of the databroker leases which serialize the changes to
+// a route, so that its version can't change between the check of a request's preconditions and the change.
+const adminRouteLeasePrefix = "pomerium/admin-api/routes/"
+
+// adminRouteLeaseDuration is how long the lease on a route is held, if it isn't released.
+const adminRouteLeaseDuration = 10 * time.Second
+
+// maxAdminRequestSize is the maximum size of an admin API request body.
+const maxAdminRequestSize = 1 << 20
+
+type adminRoute struct {
+	ID      string          `json:"id"`
+	Version uint64          `json:"version,omitempty"`
+	Route   json.RawMessage `json:"route"`
+}
+
+func (srv *Server) addAdminHandlers(r *mux.Router) {
+	r.Use(srv.requireAdminJWT)
+	r.Path("/routes").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.listAdminRoutes))
+	r.Path("/routes").Methods(http.MethodPost).Handler(httputil.HandlerFunc(srv.createAdminRoute))
+	r.Path("/routes/{id}").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.getAdminRoute))
+	r.Path("/routes/{id}").Methods(http.MethodPut).Handler(httputil.HandlerFunc(srv.putAdminRoute))
+	r.Path("/routes/{id}").Methods(http.MethodDelete).Handler(httputil.HandlerFunc(srv.deleteAdminRoute))
+	r.Path("/api_keys").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.listAdminAPIKeys))
+	r.Path("/api_keys").Methods(http.MethodPost).Handler(httputil.HandlerFunc(srv.createAdminAPIKey))
+	r.Path("/api_keys/{id}").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.getAdminAPIKey))
+	r.Path("/api_keys/{id}").Methods(http.MethodDelete).Handler(httputil.HandlerFunc(srv.deleteAdminAPIKey))
+	r.Path("/access_requests").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.listAdminAccessRequests))
+	r.Path("/access_requests/{id}/approve").Methods(http.MethodPost).Handler(httputil.HandlerFunc(srv.approveAdminAccessRequest))
+	r.Path("/access_requests/{id}/deny").Methods(http.MethodPost).Handler(httputil.HandlerFunc(srv.denyAdminAccessRequest))
+	r.Path("/shared_urls").Methods(http.MethodPost).Handler(httputil.HandlerFunc(srv.createAdminSharedURL))
+	r.Path("/explain").Methods(http.MethodPost).Handler(httputil.HandlerFunc(srv.explainAdminDecision))
+	r.Path("/sessions").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.listAdminSessions))
+	r.Path("/users").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.listAdminUsers))
+	r.Path("/groups").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.listAdminGroups))
+	r.Path("/config/routes").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.listAdminConfiguredRoutes))
+	r.Path("/decisions").Methods(http.MethodGet).Handler(httputil.HandlerFunc(srv.listAdminDecisions))
+}
+
+// requireAdminJWT requires a bearer token which is an admin token, signed with a key derived from the
+// shared secret. Session, service account and internal service tokens aren't accepted.
+func (srv *Server) requireAdminJWT(next http.Handler) http.Handler {
+	return httputil.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		sharedKey, err := srv.currentConfig.Load().Options.GetSharedKey()
+		if err != nil {
+			return httputil.NewError(http.StatusServiceUnavailable, err)
+		}
+
+		rawjwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if rawjwt == "" || rawjwt == r.Header.Get("Authorization") {
+			return httputil.NewError(http.StatusUnauthorized, errors.New("bearer token required"))
+		}
+		if _, err := admintoken.Verify(sharedKey, rawjwt, time.Now()); err != nil {
+			return httputil.NewError(http.StatusUnauthorized, err)
+		}
+
+		next.ServeHTTP(w, r)
+		return nil
+	})
+}
+
+func (srv *Server) listAdminRoutes(w http.ResponseWriter, r *http.Request) error {
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return err
+	}
+
+	routes := []adminRoute{}
+	for offset := int64(0); ; {
+		res, err := client.Query(r.Context(), &databrokerpb.QueryRequest{
+			Type:   grpcutil.GetTypeURL(new(configpb.Config)),
+			Offset: offset,
+			Limit:  100,
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range res.GetRecords() {
+			if !strings.HasPrefix(record.GetId(), adminRouteRecordIDPrefix) {
+				continue
+			}
+			route, err := adminRouteFromRecord(record)
+			if err != nil {
+				return err
+			}
+			routes = append(routes, *route)
+		}
+		offset += int64(len(res.GetRecords()))
+		if len(res.GetRecords()) == 0 || offset >= res.GetTotalCount() {
+			break
+		}
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		Routes []adminRoute `json:"routes"`
+	}{routes})
+	return nil
+}
+
+func (srv *Server) getAdminRoute(w http.ResponseWriter, r *http.Request) error {
+	record, err := srv.getAdminRouteRecord(r, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	route, err := adminRouteFromRecord(record)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", adminRouteETag(route.Version))
+	httputil.RenderJSON(w, http.StatusOK, route)
+	return nil
+}
+
+func (srv *Server) createAdminRoute(w http.ResponseWriter, r *http.Request) error {
+	return srv.storeAdminRoute(w, r, uuid.NewString(), http.StatusCreated)
+}
+
+func (srv *Server) putAdminRoute(w http.ResponseWriter, r *http.Request) error {
+	return srv.storeAdminRoute(w, r, mux.Vars(r)["id"], http.StatusOK)
+}
+
+func (srv *Server) storeAdminRoute(w http.ResponseWriter, r *http.Request, id string, code int) error {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAdminRequestSize))
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+	routepb := new(configpb.Route)
+	if err := protojson.Unmarshal(body, routepb); err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid route: %w", err))
+	}
+	policy, err := config.NewPolicyFromProto(routepb)
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid route: %w", err))
+	}
+	routeID, err := policy.RouteID()
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid route: %w", err))
+	}
+
+	release, err := srv.lockAdminRoute(r, id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// the route being replaced doesn't conflict with its replacement
+	var existingRouteID uint64
+	existing, err := srv.getAdminRouteRecord(r, id)
+	var httpErr *httputil.HTTPError
+	if errors.As(err, &httpErr) && httpErr.Status == http.StatusNotFound {
+		existing, err = nil, nil
+	} else if err != nil {
+		return err
+	}
+	if err := checkAdminRoutePreconditions(r, existing); err != nil {
+		return err
+	}
+	if existing != nil {
+		if existingRouteID, err = adminRouteRecordRouteID(existing); err != nil {
+			return err
+		}
+	}
+	for _, p := range srv.currentConfig.Load().Options.GetAllPolicies() {
+		otherID, err := p.RouteID()
+		if err != nil || otherID == existingRouteID {
+			continue
+		}
+		if otherID == routeID {
+			return httputil.NewError(http.StatusConflict, fmt.Errorf("route %s already exists", policy.String()))
+		}
+	}
+
+	data, err := anypb.New(&configpb.Config{
+		Name:   adminRouteRecordIDPrefix + id,
+		Routes: []*configpb.Route{routepb},
+	})
+	if err != nil {
+		return err
+	}
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return err
+	}
+	res, err := client.Put(r.Context(), &databrokerpb.PutRequest{
+		Record: &databrokerpb.Record{
+			Type: data.GetTypeUrl(),
+			Id:   adminRouteRecordIDPrefix + id,
+			Data: data,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	route, err := adminRouteFromRecord(res.GetRecord())
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", adminRouteETag(route.Version))
+	httputil.RenderJSON(w, code, route)
+	return nil
+}
+
+func (srv *Server) deleteAdminRoute(w http.ResponseWriter, r *http.Request) error {
+	id := mux.Vars(r)["id"]
+	release, err := srv.lockAdminRoute(r, id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	record, err := srv.getAdminRouteRecord(r, id)
+	if err != nil {
+		return err
+	}
+	if err := checkAdminRoutePreconditions(r, record); err != nil {
+		return err
+	}
+
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return err
+	}
+	record.DeletedAt = timestamppb.Now()
+	_, err = client.Put(r.Context(), &databrokerpb.PutRequest{Record: record})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (srv *Server) getAdminRouteRecord(r *http.Request, id string) (*databrokerpb.Record, error) {
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Get(r.Context(), &databrokerpb.GetRequest{
+		Type: grpcutil.GetTypeURL(new(configpb.Config)),
+		Id:   adminRouteRecordIDPrefix + id,
+	})
+	if status.Code(err) == codes.NotFound || (err == nil && res.GetRecord().GetDeletedAt() != nil) {
+		return nil, httputil.NewError(http.StatusNotFound, fmt.Errorf("route %s not found", id))
+	} else if err != nil {
+		return nil, err
+	}
+	return res.GetRecord(), nil
+}
+
+// lockAdminRoute acquires the lease on the route with the given id, and returns the function which releases
+// it. Concurrent changes to the same route are rejected with a 409 Conflict rather than waiting.
+func (srv *Server) lockAdminRoute(r *http.Request, id string) (release func(), err error) {
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	name := adminRouteLeasePrefix + id
+	res, err := client.AcquireLease(r.Context(), &databrokerpb.AcquireLeaseRequest{
+		Name:     name,
+		Duration: durationpb.New(adminRouteLeaseDuration),
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return nil, httputil.NewError(http.StatusConflict, fmt.Errorf("route %s is being modified by another request", id))
+	} else if err != nil {
+		return nil, err
+	}
+	return func() {
+		_, _ = client.ReleaseLease(context.Background(), &databrokerpb.ReleaseLeaseRequest{
+			Name: name,
+			Id:   res.GetId(),
+		})
+	}, nil
+}
+
+// checkAdminRoutePreconditions checks the If-Match and If-None-Match headers of a request which changes a
+// route against the route's current record, which is nil if the route doesn't exist. The ETag of a route is
+// the version of its record, which changes whenever the route does.
+func checkAdminRoutePreconditions(r *http.Request, record *databrokerpb.Record) error {
+	var etag string
+	if record != nil {
+		etag = adminRouteETag(record.GetVersion())
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (record == nil || !etagMatches(ifMatch, etag)) {
+		return httputil.NewError(http.StatusPreconditionFailed, errors.New("route has been modified"))
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && record != nil && etagMatches(ifNoneMatch, etag) {
+		return httputil.NewError(http.StatusPreconditionFailed, errors.New("route already exists"))
+	}
+	return nil
+}
+
+func adminRouteETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// etagMatches returns true if a list of ETags in an If-Match or If-None-Match header contains etag, or is *.
+func etagMatches(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func adminRouteFromRecord(record *databrokerpb.Record) (*adminRoute, error) {
+	var cfgpb configpb.Config
+	if err := record.GetData().UnmarshalTo(&cfgpb); err != nil {
+		return nil, err
+	}
+	route := &adminRoute{
+		ID:      strings.TrimPrefix(record.GetId(), adminRouteRecordIDPrefix),
+		Version: record.GetVersion(),
+		Route:   json.RawMessage("null"),
+	}
+	if len(cfgpb.GetRoutes()) > 0 {
+		bs, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(cfgpb.GetRoutes()[0])
+		if err != nil {
+			return nil, err
+		}
+		route.Route = bs
+	}
+	return route, nil
+}
+
+func adminRouteRecordRouteID(record *databrokerpb.Record) (uint64, error) {
+	var cfgpb configpb.Config
+	if err := record.GetData().UnmarshalTo(&cfgpb); err != nil {
+		return 0, err
+	}
+	if len(cfgpb.GetRoutes()) == 0 {
+		return 0, nil
+	}
+	policy, err := config.NewPolicyFromProto(cfgpb.GetRoutes()[0])
+	if err != nil {
+		return 0, nil
+	}
+	return policy.RouteID()
+}
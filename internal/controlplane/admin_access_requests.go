@@ -0,0 +1,153 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/accessrequest"
+	"github.com/pomerium/pomerium/internal/httputil"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type adminAccessRequestApproval struct {
+	// Duration is how long access is granted for, e.g. "4h". It defaults to, and can't exceed, the route's
+	// max_duration.
+	Duration string `json:"duration"`
+}
+
+func (srv *Server) listAdminAccessRequests(w http.ResponseWriter, r *http.Request) error {
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return err
+	}
+
+	statusFilter := accessrequest.Status(r.FormValue("status"))
+	requests := []*accessrequest.AccessRequest{}
+	for offset := int64(0); ; {
+		res, err := client.Query(r.Context(), &databrokerpb.QueryRequest{
+			Type:   accessrequest.RecordType,
+			Offset: offset,
+			Limit:  100,
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range res.GetRecords() {
+			ar, err := accessrequest.FromRecord(record)
+			if err != nil {
+				return err
+			}
+			if statusFilter == "" || ar.Status == statusFilter {
+				requests = append(requests, ar)
+			}
+		}
+		offset += int64(len(res.GetRecords()))
+		if len(res.GetRecords()) == 0 || offset >= res.GetTotalCount() {
+			break
+		}
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		AccessRequests []*accessrequest.AccessRequest `json:"access_requests"`
+	}{requests})
+	return nil
+}
+
+func (srv *Server) approveAdminAccessRequest(w http.ResponseWriter, r *http.Request) error {
+	var req adminAccessRequestApproval
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminRequestSize)).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid approval: %w", err))
+	}
+
+	ar, err := srv.getAdminAccessRequest(r, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	settings := getAccessRequestSettings(srv.currentConfig.Load().Options, ar.Route)
+	if settings == nil {
+		return httputil.NewError(http.StatusConflict, fmt.Errorf("route %s does not accept access requests", ar.Route))
+	}
+
+	duration := settings.GetMaxDuration()
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid approval: invalid duration: %q", req.Duration))
+		}
+		if d > duration {
+			return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid approval: duration exceeds the route's max_duration of %s", duration))
+		}
+		duration = d
+	}
+
+	expiresAt := time.Now().UTC().Add(duration).Truncate(time.Second)
+	ar.Status = accessrequest.StatusApproved
+	ar.ExpiresAt = &expiresAt
+	return srv.putAdminAccessRequest(w, r, ar)
+}
+
+func (srv *Server) denyAdminAccessRequest(w http.ResponseWriter, r *http.Request) error {
+	ar, err := srv.getAdminAccessRequest(r, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	ar.Status = accessrequest.StatusDenied
+	ar.ExpiresAt = nil
+	return srv.putAdminAccessRequest(w, r, ar)
+}
+
+// getAccessRequestSettings returns the access request settings of the route with the hostname.
+func getAccessRequestSettings(options *config.Options, hostname string) *config.AccessRequests {
+	for _, p := range options.GetAllPolicies() {
+		if p.AccessRequests != nil && p.Source != nil && p.Source.Hostname() == hostname {
+			return p.AccessRequests
+		}
+	}
+	return nil
+}
+
+func (srv *Server) getAdminAccessRequest(r *http.Request, id string) (*accessrequest.AccessRequest, error) {
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Get(r.Context(), &databrokerpb.GetRequest{
+		Type: accessrequest.RecordType,
+		Id:   id,
+	})
+	if status.Code(err) == codes.NotFound || (err == nil && res.GetRecord().GetDeletedAt() != nil) {
+		return nil, httputil.NewError(http.StatusNotFound, fmt.Errorf("access request %s not found", id))
+	} else if err != nil {
+		return nil, err
+	}
+	return accessrequest.FromRecord(res.GetRecord())
+}
+
+func (srv *Server) putAdminAccessRequest(w http.ResponseWriter, r *http.Request, ar *accessrequest.AccessRequest) error {
+	record, err := ar.ToRecord()
+	if err != nil {
+		return err
+	}
+
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return err
+	}
+	_, err = client.Put(r.Context(), &databrokerpb.PutRequest{Record: record})
+	if err != nil {
+		return err
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, ar)
+	return nil
+}
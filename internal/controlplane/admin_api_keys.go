@@ -0,0 +1,155 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/apikey"
+	"github.com/pomerium/pomerium/internal/httputil"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+type adminAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Routes    []string   `json:"routes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type adminAPIKey struct {
+	*apikey.APIKey
+	// Key is only returned when the key is created, since only its hash is stored.
+	Key string `json:"key,omitempty"`
+}
+
+func (srv *Server) listAdminAPIKeys(w http.ResponseWriter, r *http.Request) error {
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return err
+	}
+
+	keys := []*apikey.APIKey{}
+	for offset := int64(0); ; {
+		res, err := client.Query(r.Context(), &databrokerpb.QueryRequest{
+			Type:   apikey.RecordType,
+			Offset: offset,
+			Limit:  100,
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range res.GetRecords() {
+			k, err := apikey.FromRecord(record)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, k)
+		}
+		offset += int64(len(res.GetRecords()))
+		if len(res.GetRecords()) == 0 || offset >= res.GetTotalCount() {
+			break
+		}
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		APIKeys []*apikey.APIKey `json:"api_keys"`
+	}{keys})
+	return nil
+}
+
+func (srv *Server) getAdminAPIKey(w http.ResponseWriter, r *http.Request) error {
+	record, err := srv.getAdminAPIKeyRecord(r, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+	k, err := apikey.FromRecord(record)
+	if err != nil {
+		return err
+	}
+	httputil.RenderJSON(w, http.StatusOK, k)
+	return nil
+}
+
+func (srv *Server) createAdminAPIKey(w http.ResponseWriter, r *http.Request) error {
+	var req adminAPIKeyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminRequestSize)).Decode(&req); err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid api key: %w", err))
+	}
+	if len(req.Routes) == 0 {
+		return httputil.NewError(http.StatusBadRequest, errors.New("invalid api key: routes are required"))
+	}
+	for _, route := range req.Routes {
+		if route == "" {
+			return httputil.NewError(http.StatusBadRequest, errors.New("invalid api key: routes must not be empty"))
+		}
+	}
+
+	key := apikey.New()
+	k := &apikey.APIKey{
+		ID:        apikey.Hash(key),
+		Name:      req.Name,
+		Routes:    req.Routes,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		ExpiresAt: req.ExpiresAt,
+	}
+	record, err := k.ToRecord()
+	if err != nil {
+		return err
+	}
+
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return err
+	}
+	_, err = client.Put(r.Context(), &databrokerpb.PutRequest{Record: record})
+	if err != nil {
+		return err
+	}
+
+	httputil.RenderJSON(w, http.StatusCreated, adminAPIKey{APIKey: k, Key: key})
+	return nil
+}
+
+func (srv *Server) deleteAdminAPIKey(w http.ResponseWriter, r *http.Request) error {
+	record, err := srv.getAdminAPIKeyRecord(r, mux.Vars(r)["id"])
+	if err != nil {
+		return err
+	}
+
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return err
+	}
+	record.DeletedAt = timestamppb.Now()
+	_, err = client.Put(r.Context(), &databrokerpb.PutRequest{Record: record})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (srv *Server) getAdminAPIKeyRecord(r *http.Request, id string) (*databrokerpb.Record, error) {
+	client, err := srv.getDataBrokerClient(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Get(r.Context(), &databrokerpb.GetRequest{
+		Type: apikey.RecordType,
+		Id:   id,
+	})
+	if status.Code(err) == codes.NotFound || (err == nil && res.GetRecord().GetDeletedAt() != nil) {
+		return nil, httputil.NewError(http.StatusNotFound, fmt.Errorf("api key %s not found", id))
+	} else if err != nil {
+		return nil, err
+	}
+	return res.GetRecord(), nil
+}
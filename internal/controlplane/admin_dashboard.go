@@ -0,0 +1,276 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/activity"
+	"github.com/pomerium/pomerium/internal/httputil"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// defaultAdminDecisionsLimit is the number of decisions returned when no limit is given.
+const defaultAdminDecisionsLimit = 100
+
+type adminSession struct {
+	ID                string     `json:"id"`
+	UserID            string     `json:"user_id"`
+	ImpersonateUserID string     `json:"impersonate_user_id,omitempty"`
+	IssuedAt          *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	// LastSeen is when the session was last used, to within a minute. It's empty if the session hasn't
+	// been used since it was created.
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+type adminUser struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	Email    string   `json:"email,omitempty"`
+	GroupIDs []string `json:"group_ids"`
+}
+
+type adminGroup struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type adminConfiguredRoute struct {
+	ID     string   `json:"id"`
+	From   string   `json:"from"`
+	To     []string `json:"to,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+	Path   string   `json:"path,omitempty"`
+	Regex  string   `json:"regex,omitempty"`
+}
+
+func (srv *Server) listAdminSessions(w http.ResponseWriter, r *http.Request) error {
+	lastSeen := map[string]time.Time{}
+	err := srv.queryAdminRecords(r.Context(), activity.SessionRecordType, func(record *databrokerpb.Record) error {
+		a, err := activity.SessionFromRecord(record)
+		if err != nil {
+			return err
+		}
+		lastSeen[a.SessionID] = a.LastSeen
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	sessions := []adminSession{}
+	err = srv.queryAdminRecords(r.Context(), grpcutil.GetTypeURL(new(session.Session)), func(record *databrokerpb.Record) error {
+		var s session.Session
+		if err := record.GetData().UnmarshalTo(&s); err != nil {
+			return err
+		}
+		if s.GetExpiresAt() != nil && !now.Before(s.GetExpiresAt().AsTime()) {
+			return nil
+		}
+		as := adminSession{
+			ID:                s.GetId(),
+			UserID:            s.GetUserId(),
+			ImpersonateUserID: s.GetImpersonateUserId(),
+		}
+		if s.GetIssuedAt() != nil {
+			t := s.GetIssuedAt().AsTime()
+			as.IssuedAt = &t
+		}
+		if s.GetExpiresAt() != nil {
+			t := s.GetExpiresAt().AsTime()
+			as.ExpiresAt = &t
+		}
+		if t, ok := lastSeen[s.GetId()]; ok {
+			as.LastSeen = &t
+		}
+		sessions = append(sessions, as)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		Sessions []adminSession `json:"sessions"`
+	}{sessions})
+	return nil
+}
+
+func (srv *Server) listAdminUsers(w http.ResponseWriter, r *http.Request) error {
+	users := map[string]*adminUser{}
+	getUser := func(id string) *adminUser {
+		u, ok := users[id]
+		if !ok {
+			u = &adminUser{ID: id, GroupIDs: []string{}}
+			users[id] = u
+		}
+		return u
+	}
+
+	err := srv.queryAdminRecords(r.Context(), grpcutil.GetTypeURL(new(user.User)), func(record *databrokerpb.Record) error {
+		var u user.User
+		if err := record.GetData().UnmarshalTo(&u); err != nil {
+			return err
+		}
+		au := getUser(u.GetId())
+		au.Name, au.Email = u.GetName(), u.GetEmail()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = srv.queryAdminRecords(r.Context(), grpcutil.GetTypeURL(new(directory.User)), func(record *databrokerpb.Record) error {
+		var du directory.User
+		if err := record.GetData().UnmarshalTo(&du); err != nil {
+			return err
+		}
+		au := getUser(du.GetId())
+		if au.Name == "" {
+			au.Name = du.GetDisplayName()
+		}
+		if au.Email == "" {
+			au.Email = du.GetEmail()
+		}
+		au.GroupIDs = append(au.GroupIDs, du.GetGroupIds()...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	list := []*adminUser{}
+	for _, u := range users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		Users []*adminUser `json:"users"`
+	}{list})
+	return nil
+}
+
+func (srv *Server) listAdminGroups(w http.ResponseWriter, r *http.Request) error {
+	groups := []adminGroup{}
+	err := srv.queryAdminRecords(r.Context(), grpcutil.GetTypeURL(new(directory.Group)), func(record *databrokerpb.Record) error {
+		var g directory.Group
+		if err := record.GetData().UnmarshalTo(&g); err != nil {
+			return err
+		}
+		groups = append(groups, adminGroup{ID: g.GetId(), Name: g.GetName(), Email: g.GetEmail()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		Groups []adminGroup `json:"groups"`
+	}{groups})
+	return nil
+}
+
+// listAdminConfiguredRoutes lists every route in the current configuration, unlike listAdminRoutes, which
+// only lists the routes managed by the admin API.
+func (srv *Server) listAdminConfiguredRoutes(w http.ResponseWriter, r *http.Request) error {
+	routes := []adminConfiguredRoute{}
+	for _, p := range srv.currentConfig.Load().Options.GetAllPolicies() {
+		id, err := p.RouteID()
+		if err != nil {
+			return err
+		}
+		to, _, err := p.To.Flatten()
+		if err != nil {
+			return err
+		}
+		routes = append(routes, adminConfiguredRoute{
+			ID:     strconv.FormatUint(id, 10),
+			From:   p.From,
+			To:     to,
+			Prefix: p.Prefix,
+			Path:   p.Path,
+			Regex:  p.Regex,
+		})
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		Routes []adminConfiguredRoute `json:"routes"`
+	}{routes})
+	return nil
+}
+
+func (srv *Server) listAdminDecisions(w http.ResponseWriter, r *http.Request) error {
+	limit := defaultAdminDecisionsLimit
+	if raw := r.FormValue("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid limit: %q", raw))
+		}
+	}
+
+	decisions := []*activity.Decision{}
+	err := srv.queryAdminRecords(r.Context(), activity.DecisionRecordType, func(record *databrokerpb.Record) error {
+		d, err := activity.DecisionFromRecord(record)
+		if err != nil {
+			return err
+		}
+		decisions = append(decisions, d)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// newest first
+	sort.Slice(decisions, func(i, j int) bool {
+		return decisions[i].Time.After(decisions[j].Time)
+	})
+	if len(decisions) > limit {
+		decisions = decisions[:limit]
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, struct {
+		Decisions []*activity.Decision `json:"decisions"`
+	}{decisions})
+	return nil
+}
+
+// queryAdminRecords calls fn with every databroker record of the given type.
+func (srv *Server) queryAdminRecords(ctx context.Context, recordType string, fn func(*databrokerpb.Record) error) error {
+	client, err := srv.getDataBrokerClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	for offset := int64(0); ; {
+		res, err := client.Query(ctx, &databrokerpb.QueryRequest{
+			Type:   recordType,
+			Offset: offset,
+			Limit:  100,
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range res.GetRecords() {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		offset += int64(len(res.GetRecords()))
+		if len(res.GetRecords()) == 0 || offset >= res.GetTotalCount() {
+			return nil
+		}
+	}
+}
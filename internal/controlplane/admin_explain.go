@@ -0,0 +1,194 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+	"github.com/pomerium/pomerium/pkg/grpcutil"
+)
+
+// adminExplainSessionID is the id of the session made up for explaining the decision for a user without a
+// session.
+const adminExplainSessionID = "admin-api/explain"
+
+type adminExplainRequest struct {
+	URL       string `json:"url"`
+	Method    string `json:"method"`
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+}
+
+type adminExplainResponse struct {
+	Route string `json:"route"`
+	*evaluator.Explanation
+}
+
+// explainAdminDecision explains why a request to a URL by a session or a user would be allowed or denied, by
+// evaluating the policy of the URL's route with the session's records from the databroker.
+func (srv *Server) explainAdminDecision(w http.ResponseWriter, r *http.Request) error {
+	var req adminExplainRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminRequestSize)).Decode(&req); err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid explain request: %w", err))
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid explain request: %q is not an absolute url", req.URL))
+	}
+	if req.SessionID != "" && req.UserID != "" {
+		return httputil.NewError(http.StatusBadRequest, errors.New("invalid explain request: only one of session_id or user_id may be set"))
+	}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+
+	opts := srv.currentConfig.Load().Options
+	var policy *config.Policy
+	for _, p := range opts.GetAllPolicies() {
+		if p.Matches(*u) {
+			p := p
+			policy = &p
+			break
+		}
+	}
+	if policy == nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid explain request: no route for %s", u.Host))
+	}
+
+	records, sessionID, err := srv.getAdminExplainRecords(r.Context(), req.SessionID, req.UserID)
+	if err != nil {
+		return err
+	}
+
+	e, err := newAdminExplainEvaluator(r.Context(), opts, policy, evaluator.NewStoreFromProtos(0, records...))
+	if err != nil {
+		return err
+	}
+	explanation, err := e.Explain(r.Context(), &evaluator.Request{
+		Policy: policy,
+		HTTP: evaluator.RequestHTTP{
+			Method:  req.Method,
+			URL:     u.String(),
+			Headers: map[string]string{},
+		},
+		Session: evaluator.RequestSession{ID: sessionID},
+	})
+	if err != nil {
+		return err
+	}
+
+	httputil.RenderJSON(w, http.StatusOK, adminExplainResponse{
+		Route:       policy.String(),
+		Explanation: explanation,
+	})
+	return nil
+}
+
+// getAdminExplainRecords returns the databroker records policies use for the session or user, and the id
+// of the session. A session is made up for a user.
+func (srv *Server) getAdminExplainRecords(ctx context.Context, sessionID, userID string) ([]proto.Message, string, error) {
+	if sessionID == "" && userID == "" {
+		return nil, "", nil
+	}
+
+	client, err := srv.getDataBrokerClient(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var records []proto.Message
+	if sessionID != "" {
+		s := new(session.Session)
+		if ok, err := getAdminExplainRecord(ctx, client, sessionID, s); err != nil {
+			return nil, "", err
+		} else if !ok {
+			return nil, "", httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid explain request: session %s not found", sessionID))
+		}
+		records = append(records, s)
+		userID = s.GetUserId()
+		if s.GetImpersonateUserId() != "" {
+			userID = s.GetImpersonateUserId()
+		}
+	} else {
+		sessionID = adminExplainSessionID
+		records = append(records, &session.Session{Id: sessionID, UserId: userID})
+	}
+
+	u := new(user.User)
+	if ok, err := getAdminExplainRecord(ctx, client, userID, u); err != nil {
+		return nil, "", err
+	} else if ok {
+		records = append(records, u)
+	}
+
+	du := new(directory.User)
+	if ok, err := getAdminExplainRecord(ctx, client, userID, du); err != nil {
+		return nil, "", err
+	} else if ok {
+		records = append(records, du)
+	}
+	for _, groupID := range du.GetGroupIds() {
+		g := new(directory.Group)
+		if ok, err := getAdminExplainRecord(ctx, client, groupID, g); err != nil {
+			return nil, "", err
+		} else if ok {
+			records = append(records, g)
+		}
+	}
+
+	return records, sessionID, nil
+}
+
+// getAdminExplainRecord gets the record with the type of msg and the id into msg, returning false if it
+// doesn't exist.
+func getAdminExplainRecord(ctx context.Context, client databrokerpb.DataBrokerServiceClient, id string, msg proto.Message) (bool, error) {
+	res, err := client.Get(ctx, &databrokerpb.GetRequest{
+		Type: grpcutil.GetTypeURL(msg),
+		Id:   id,
+	})
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if res.GetRecord().GetDeletedAt() != nil {
+		return false, nil
+	}
+	return true, res.GetRecord().GetData().UnmarshalTo(msg)
+}
+
+func newAdminExplainEvaluator(ctx context.Context, opts *config.Options, policy *config.Policy, store *evaluator.Store) (*evaluator.Evaluator, error) {
+	clientCA, err := opts.GetClientCA()
+	if err != nil {
+		return nil, err
+	}
+	authenticateURL, err := opts.GetAuthenticateURL()
+	if err != nil {
+		return nil, err
+	}
+	// shared URLs are disabled without a shared key
+	sharedKey, _ := opts.GetSharedKey()
+
+	return evaluator.New(ctx, store, nil,
+		evaluator.WithPolicies([]config.Policy{*policy}),
+		evaluator.WithClientCA(clientCA),
+		evaluator.WithAuthenticateURL(authenticateURL.String()),
+		evaluator.WithProviderURL(opts.ProviderURL),
+		evaluator.WithSharedKey(sharedKey),
+		evaluator.WithGroupsClaim(opts.GroupsClaim),
+	)
+}
@@ -0,0 +1,55 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/sharedurl"
+)
+
+type adminSharedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (srv *Server) createAdminSharedURL(w http.ResponseWriter, r *http.Request) error {
+	var req adminSharedURL
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminRequestSize)).Decode(&req); err != nil {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid shared url: %w", err))
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid shared url: %q is not an absolute url", req.URL))
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		return httputil.NewError(http.StatusBadRequest, errors.New("invalid shared url: expires_at must be in the future"))
+	}
+
+	opts := srv.currentConfig.Load().Options
+	sharedKey, err := opts.GetSharedKey()
+	if err != nil {
+		return httputil.NewError(http.StatusServiceUnavailable, err)
+	}
+	found := false
+	for _, p := range opts.GetAllPolicies() {
+		if p.Matches(*u) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return httputil.NewError(http.StatusBadRequest, fmt.Errorf("invalid shared url: no route for %s", u.Host))
+	}
+
+	expiresAt := req.ExpiresAt.UTC().Truncate(time.Second)
+	httputil.RenderJSON(w, http.StatusCreated, adminSharedURL{
+		URL:       sharedurl.Sign(sharedKey, u, expiresAt).String(),
+		ExpiresAt: expiresAt,
+	})
+	return nil
+}
@@ -0,0 +1,447 @@
+package controlplane
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/authorize/evaluator"
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/accessrequest"
+	"github.com/pomerium/pomerium/internal/activity"
+	"github.com/pomerium/pomerium/internal/admintoken"
+	"github.com/pomerium/pomerium/internal/apikey"
+	internal_databroker "github.com/pomerium/pomerium/internal/databroker"
+	"github.com/pomerium/pomerium/internal/sharedurl"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+	"github.com/pomerium/pomerium/pkg/grpc/user"
+)
+
+func TestAdminRoutes(t *testing.T) {
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer li.Close()
+
+	grpcSrv := grpc.NewServer()
+	databrokerpb.RegisterDataBrokerServiceServer(grpcSrv, internal_databroker.New())
+	go func() { _ = grpcSrv.Serve(li) }()
+	defer grpcSrv.Stop()
+
+	policy := config.Policy{
+		From:           "https://from.example.com",
+		To:             mustParseWeightedURLs(t, "https://to.example.com"),
+		AccessRequests: &config.AccessRequests{MaxDuration: 8 * time.Hour},
+	}
+	require.NoError(t, policy.Validate())
+	explainPolicy := config.Policy{
+		From:           "https://explain.example.com",
+		To:             mustParseWeightedURLs(t, "https://to.example.com"),
+		AllowedDomains: []string{"example.com"},
+	}
+	require.NoError(t, explainPolicy.Validate())
+
+	sharedKey := cryptutil.NewBase64Key()
+	srv := &Server{}
+	srv.currentConfig.Store(versionedConfig{
+		Config: &config.Config{
+			Options: &config.Options{
+				SharedKey:             sharedKey,
+				AuthenticateURLString: "https://authenticate.example.com",
+				DataBrokerURLString:   "http://" + li.Addr().String(),
+				GRPCInsecure:          true,
+				Policies:              []config.Policy{policy, explainPolicy},
+			},
+		},
+	})
+	r := mux.NewRouter()
+	srv.addAdminHandlers(r.PathPrefix("/.pomerium/admin").Subrouter())
+
+	key, _ := base64.StdEncoding.DecodeString(sharedKey)
+	token, err := admintoken.Sign(key, "test", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/.pomerium/admin/routes", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		req.Header.Set("Authorization", "Bearer "+token+"x")
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// tokens signed with the shared secret itself, like those of sessions, aren't admin tokens
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: key}, nil)
+		require.NoError(t, err)
+		sessionToken, err := jwt.Signed(sig).Claims(jwt.Claims{
+			Audience: jwt.Audience{admintoken.Audience},
+			Expiry:   jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}).CompactSerialize()
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+sessionToken)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		w := do(http.MethodPut, "/.pomerium/admin/routes/a", `{"from":"https://a.example.com"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+	t.Run("conflict", func(t *testing.T) {
+		w := do(http.MethodPut, "/.pomerium/admin/routes/a", `{"from":"https://from.example.com","to":["https://to.example.com"]}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+	t.Run("crud", func(t *testing.T) {
+		w := do(http.MethodPut, "/.pomerium/admin/routes/a", `{"from":"https://a.example.com","to":["https://a.internal"]}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = do(http.MethodPut, "/.pomerium/admin/routes/a", `{"from":"https://a.example.com","to":["https://a2.internal"]}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = do(http.MethodPost, "/.pomerium/admin/routes", `{"from":"https://b.example.com","to":["https://b.internal"]}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created adminRoute
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.NotEmpty(t, created.ID)
+
+		w = do(http.MethodGet, "/.pomerium/admin/routes/a", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var route adminRoute
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &route))
+		var routeBody struct {
+			From string   `json:"from"`
+			To   []string `json:"to"`
+		}
+		require.NoError(t, json.Unmarshal(route.Route, &routeBody))
+		assert.Equal(t, "https://a.example.com", routeBody.From)
+		assert.Equal(t, []string{"https://a2.internal"}, routeBody.To)
+
+		w = do(http.MethodGet, "/.pomerium/admin/routes", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var list struct {
+			Routes []adminRoute `json:"routes"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		assert.Len(t, list.Routes, 2)
+
+		w = do(http.MethodDelete, "/.pomerium/admin/routes/a", "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		w = do(http.MethodGet, "/.pomerium/admin/routes/a", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = do(http.MethodDelete, "/.pomerium/admin/routes/a", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("preconditions", func(t *testing.T) {
+		doIf := func(method, path, body, header, etag string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set(header, etag)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := doIf(http.MethodPut, "/.pomerium/admin/routes/c", `{"from":"https://c.example.com","to":["https://c.internal"]}`,
+			"If-Match", "*")
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "the route doesn't exist yet")
+		w = doIf(http.MethodPut, "/.pomerium/admin/routes/c", `{"from":"https://c.example.com","to":["https://c.internal"]}`,
+			"If-None-Match", "*")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		etag := w.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+
+		w = doIf(http.MethodPut, "/.pomerium/admin/routes/c", `{"from":"https://c.example.com","to":["https://c.internal"]}`,
+			"If-None-Match", "*")
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "the route already exists")
+
+		w = do(http.MethodGet, "/.pomerium/admin/routes/c", "")
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+
+		w = doIf(http.MethodPut, "/.pomerium/admin/routes/c", `{"from":"https://c.example.com","to":["https://c2.internal"]}`,
+			"If-Match", etag)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+		w = doIf(http.MethodPut, "/.pomerium/admin/routes/c", `{"from":"https://c.example.com","to":["https://c3.internal"]}`,
+			"If-Match", etag)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "the route was modified by the previous request")
+		w = doIf(http.MethodDelete, "/.pomerium/admin/routes/c", "", "If-Match", etag)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "the route was modified by the previous request")
+
+		w = do(http.MethodGet, "/.pomerium/admin/routes/c", "")
+		assert.Contains(t, w.Body.String(), "https://c2.internal")
+		w = doIf(http.MethodDelete, "/.pomerium/admin/routes/c", "", "If-Match", w.Header().Get("ETag"))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+	t.Run("locked", func(t *testing.T) {
+		client, err := srv.getDataBrokerClient(context.Background())
+		require.NoError(t, err)
+		_, err = client.AcquireLease(context.Background(), &databrokerpb.AcquireLeaseRequest{
+			Name:     adminRouteLeasePrefix + "d",
+			Duration: durationpb.New(time.Minute),
+		})
+		require.NoError(t, err)
+
+		w := do(http.MethodPut, "/.pomerium/admin/routes/d", `{"from":"https://d.example.com","to":["https://d.internal"]}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+	t.Run("api keys", func(t *testing.T) {
+		w := do(http.MethodPost, "/.pomerium/admin/api_keys", `{"name":"webhook"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = do(http.MethodPost, "/.pomerium/admin/api_keys", `{"name":"webhook","routes":["hooks.example.com"]}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			Key  string `json:"key"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.Equal(t, "webhook", created.Name)
+		assert.Equal(t, apikey.Hash(created.Key), created.ID)
+
+		w = do(http.MethodGet, "/.pomerium/admin/api_keys/"+created.ID, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), created.Key)
+
+		w = do(http.MethodGet, "/.pomerium/admin/api_keys", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var list struct {
+			APIKeys []apikey.APIKey `json:"api_keys"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		if assert.Len(t, list.APIKeys, 1) {
+			assert.Equal(t, []string{"hooks.example.com"}, list.APIKeys[0].Routes)
+		}
+
+		w = do(http.MethodDelete, "/.pomerium/admin/api_keys/"+created.ID, "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		w = do(http.MethodGet, "/.pomerium/admin/api_keys/"+created.ID, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+	t.Run("shared urls", func(t *testing.T) {
+		w := do(http.MethodPost, "/.pomerium/admin/shared_urls", `{"url":"https://unknown.example.com/a","expires_at":"2099-01-01T00:00:00Z"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = do(http.MethodPost, "/.pomerium/admin/shared_urls", `{"url":"https://from.example.com/a","expires_at":"2001-01-01T00:00:00Z"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = do(http.MethodPost, "/.pomerium/admin/shared_urls", `{"url":"https://from.example.com/a","expires_at":"2099-01-01T00:00:00Z"}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created struct {
+			URL string `json:"url"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		u, err := url.Parse(created.URL)
+		require.NoError(t, err)
+		assert.NoError(t, sharedurl.Verify(key, http.MethodGet, u, time.Now()))
+	})
+	t.Run("explain", func(t *testing.T) {
+		client, err := srv.getDataBrokerClient(context.Background())
+		require.NoError(t, err)
+		data, err := anypb.New(&user.User{Id: "USER_ID", Email: "a@example.com"})
+		require.NoError(t, err)
+		_, err = client.Put(context.Background(), &databrokerpb.PutRequest{
+			Record: &databrokerpb.Record{Type: data.GetTypeUrl(), Id: "USER_ID", Data: data},
+		})
+		require.NoError(t, err)
+
+		w := do(http.MethodPost, "/.pomerium/admin/explain", `{"url":"https://unknown.example.com/a"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = do(http.MethodPost, "/.pomerium/admin/explain", `{"url":"https://explain.example.com/a","session_id":"SESSION_ID"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		explain := func(userID string) (allow bool, criteria []evaluator.ExplanationCriterion) {
+			w := do(http.MethodPost, "/.pomerium/admin/explain", `{"url":"https://explain.example.com/a","user_id":"`+userID+`"}`)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var res struct {
+				Route    string                           `json:"route"`
+				Allow    bool                             `json:"allow"`
+				Criteria []evaluator.ExplanationCriterion `json:"criteria"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			assert.Equal(t, explainPolicy.String(), res.Route)
+			return res.Allow, res.Criteria
+		}
+		domainCriterion := func(criteria []evaluator.ExplanationCriterion) *evaluator.ExplanationCriterion {
+			for i := range criteria {
+				if strings.Contains(criteria[i].Criterion, "domain") {
+					return &criteria[i]
+				}
+			}
+			return nil
+		}
+
+		allow, criteria := explain("USER_ID")
+		assert.True(t, allow)
+		if c := domainCriterion(criteria); assert.NotNil(t, c) {
+			assert.True(t, c.Matched)
+		}
+
+		allow, criteria = explain("OTHER_USER_ID")
+		assert.False(t, allow)
+		if c := domainCriterion(criteria); assert.NotNil(t, c) {
+			assert.False(t, c.Matched)
+		}
+	})
+	t.Run("access requests", func(t *testing.T) {
+		client, err := srv.getDataBrokerClient(context.Background())
+		require.NoError(t, err)
+		pending := &accessrequest.AccessRequest{
+			ID:     accessrequest.ID("USER_ID", "from.example.com"),
+			UserID: "USER_ID",
+			Route:  "from.example.com",
+			Status: accessrequest.StatusPending,
+		}
+		record, err := pending.ToRecord()
+		require.NoError(t, err)
+		_, err = client.Put(context.Background(), &databrokerpb.PutRequest{Record: record})
+		require.NoError(t, err)
+
+		list := func(status string) []*accessrequest.AccessRequest {
+			w := do(http.MethodGet, "/.pomerium/admin/access_requests?status="+status, "")
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var res struct {
+				AccessRequests []*accessrequest.AccessRequest `json:"access_requests"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+			return res.AccessRequests
+		}
+		if requests := list("pending"); assert.Len(t, requests, 1) {
+			assert.Equal(t, pending.ID, requests[0].ID)
+		}
+
+		w := do(http.MethodPost, "/.pomerium/admin/access_requests/unknown/approve", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = do(http.MethodPost, "/.pomerium/admin/access_requests/"+pending.ID+"/approve", `{"duration":"24h"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "duration should be limited to max_duration")
+
+		w = do(http.MethodPost, "/.pomerium/admin/access_requests/"+pending.ID+"/approve", `{"duration":"1h"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var approved accessrequest.AccessRequest
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &approved))
+		assert.Equal(t, accessrequest.StatusApproved, approved.Status)
+		assert.True(t, approved.GrantsAccess("USER_ID", "from.example.com", time.Now()))
+		assert.False(t, approved.GrantsAccess("USER_ID", "from.example.com", time.Now().Add(2*time.Hour)))
+		assert.Empty(t, list("pending"))
+		assert.Len(t, list("approved"), 1)
+
+		w = do(http.MethodPost, "/.pomerium/admin/access_requests/"+pending.ID+"/deny", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		if requests := list("denied"); assert.Len(t, requests, 1) {
+			assert.Nil(t, requests[0].ExpiresAt)
+		}
+	})
+	t.Run("dashboard", func(t *testing.T) {
+		client, err := srv.getDataBrokerClient(context.Background())
+		require.NoError(t, err)
+		put := func(id string, msg proto.Message) {
+			data, err := anypb.New(msg)
+			require.NoError(t, err)
+			_, err = client.Put(context.Background(), &databrokerpb.PutRequest{
+				Record: &databrokerpb.Record{Type: data.GetTypeUrl(), Id: id, Data: data},
+			})
+			require.NoError(t, err)
+		}
+		putRecord := func(record *databrokerpb.Record, err error) {
+			require.NoError(t, err)
+			_, err = client.Put(context.Background(), &databrokerpb.PutRequest{Record: record})
+			require.NoError(t, err)
+		}
+		get := func(path string, v interface{}) {
+			w := do(http.MethodGet, path, "")
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), v))
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		put("SESSION_ID", &session.Session{Id: "SESSION_ID", UserId: "USER_ID", ExpiresAt: timestamppb.New(now.Add(time.Hour))})
+		put("EXPIRED_SESSION_ID", &session.Session{Id: "EXPIRED_SESSION_ID", UserId: "USER_ID", ExpiresAt: timestamppb.New(now.Add(-time.Hour))})
+		putRecord((&activity.SessionActivity{SessionID: "SESSION_ID", UserID: "USER_ID", LastSeen: now}).ToRecord())
+		put("USER_ID", &directory.User{Id: "USER_ID", GroupIds: []string{"GROUP_ID"}})
+		put("GROUP_ID", &directory.Group{Id: "GROUP_ID", Name: "admins"})
+		putRecord((&activity.Decision{ID: "1", Time: now.Add(-time.Minute), Status: http.StatusForbidden}).ToRecord())
+		putRecord((&activity.Decision{ID: "2", Time: now, Status: http.StatusUnauthorized}).ToRecord())
+
+		var sessions struct {
+			Sessions []adminSession `json:"sessions"`
+		}
+		get("/.pomerium/admin/sessions", &sessions)
+		if assert.Len(t, sessions.Sessions, 1) {
+			assert.Equal(t, "SESSION_ID", sessions.Sessions[0].ID)
+			if assert.NotNil(t, sessions.Sessions[0].LastSeen) {
+				assert.True(t, now.Equal(*sessions.Sessions[0].LastSeen))
+			}
+		}
+
+		var users struct {
+			Users []adminUser `json:"users"`
+		}
+		get("/.pomerium/admin/users", &users)
+		assert.Equal(t, []adminUser{{ID: "USER_ID", Email: "a@example.com", GroupIDs: []string{"GROUP_ID"}}}, users.Users)
+
+		var groups struct {
+			Groups []adminGroup `json:"groups"`
+		}
+		get("/.pomerium/admin/groups", &groups)
+		assert.Equal(t, []adminGroup{{ID: "GROUP_ID", Name: "admins"}}, groups.Groups)
+
+		var routes struct {
+			Routes []adminConfiguredRoute `json:"routes"`
+		}
+		get("/.pomerium/admin/config/routes", &routes)
+		if assert.Len(t, routes.Routes, 2) {
+			assert.Equal(t, "https://from.example.com", routes.Routes[0].From)
+			assert.Equal(t, []string{"https://to.example.com"}, routes.Routes[0].To)
+			assert.NotEmpty(t, routes.Routes[0].ID)
+		}
+
+		var decisions struct {
+			Decisions []*activity.Decision `json:"decisions"`
+		}
+		get("/.pomerium/admin/decisions", &decisions)
+		if assert.Len(t, decisions.Decisions, 2) {
+			assert.Equal(t, "2", decisions.Decisions[0].ID, "decisions should be newest first")
+		}
+		get("/.pomerium/admin/decisions?limit=1", &decisions)
+		assert.Len(t, decisions.Decisions, 1)
+		w := do(http.MethodGet, "/.pomerium/admin/decisions?limit=x", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func mustParseWeightedURLs(t *testing.T, urls ...string) config.WeightedURLs {
+	wu, err := config.ParseWeightedUrls(urls...)
+	require.NoError(t, err)
+	return wu
+}
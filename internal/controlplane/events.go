@@ -96,13 +96,27 @@ func (srv *Server) getDataBrokerClient(ctx context.Context) (databrokerpb.DataBr
 		return nil, err
 	}
 
+	clientCert, err := options.GetGRPCClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+
 	cc, err := grpc.GetGRPCClientConn(ctx, "databroker", &grpc.Options{
 		Addrs:                   urls,
 		OverrideCertificateName: options.OverrideCertificateName,
 		CA:                      options.CA,
 		CAFile:                  options.CAFile,
+		ClientCertificate:       clientCert,
+		SPIREAgentSocket:        options.SPIREAgentSocket,
+		InternalCA:              options.GetInternalCA(),
 		RequestTimeout:          options.GRPCClientTimeout,
 		ClientDNSRoundRobin:     options.GRPCClientDNSRoundRobin,
+		PoolSize:                options.GRPCClientPoolSize,
+		KeepaliveTime:           options.GRPCClientKeepaliveTime,
+		KeepaliveTimeout:        options.GRPCClientKeepaliveTimeout,
+		BackoffMaxDelay:         options.GRPCClientBackoffMaxDelay,
+		CircuitBreakerThreshold: options.GRPCClientCircuitBreakerThreshold,
+		CircuitBreakerTimeout:   options.GRPCClientCircuitBreakerTimeout,
 		WithInsecure:            options.GetGRPCInsecure(),
 		InstallationID:          options.InstallationID,
 		ServiceName:             options.Services,
@@ -1,20 +1,34 @@
 package controlplane
 
 import (
+	"context"
+	"sort"
 	"strings"
+	"time"
 
+	envoy_data_accesslog_v3 "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v3"
 	envoy_service_accesslog_v3 "github.com/envoyproxy/go-control-plane/envoy/service/accesslog/v3"
 	"github.com/golang/protobuf/ptypes"
 	"github.com/rs/zerolog"
 
+	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/log"
+	databrokerpb "github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
+// concurrencyLeaseMetadataKey is the key of the concurrent request lease authorize adds to the dynamic metadata
+// of a request to a route which limits the concurrent requests of a user.
+const concurrencyLeaseMetadataKey = "pomerium_concurrency_lease"
+
+// releaseConcurrencyLeaseTimeout is how long releasing a concurrent request lease may take.
+const releaseConcurrencyLeaseTimeout = 5 * time.Second
+
 func (srv *Server) registerAccessLogHandlers() {
 	envoy_service_accesslog_v3.RegisterAccessLogServiceServer(srv.GRPCServer, srv)
 }
 
-// StreamAccessLogs receives logs from envoy and prints them to stdout.
+// StreamAccessLogs receives logs from envoy and prints them to stdout. Envoy logs a request once it completes,
+// so the concurrent request lease of the request, if any, is released.
 func (srv *Server) StreamAccessLogs(stream envoy_service_accesslog_v3.AccessLogService_StreamAccessLogsServer) error {
 	for {
 		msg, err := stream.Recv()
@@ -23,17 +37,27 @@ func (srv *Server) StreamAccessLogs(stream envoy_service_accesslog_v3.AccessLogS
 			return err
 		}
 
+		logEnabled := srv.currentConfig.Load().Options.IsProxyAccessLogEnabled()
 		for _, entry := range msg.GetHttpLogs().LogEntry {
+			if name, id, ok := getConcurrencyLease(entry); ok {
+				go srv.releaseConcurrencyLease(name, id)
+			}
+			if !logEnabled {
+				// the logs are only sent to release the leases
+				continue
+			}
+
 			reqPath := entry.GetRequest().GetPath()
 			var evt *zerolog.Event
-			if reqPath == "/ping" || reqPath == "/healthz" {
-				evt = log.Debug(stream.Context())
+			if reqPath == "/ping" || reqPath == "/healthz" || reqPath == "/readyz" {
+				evt = log.AccessDebug(stream.Context())
 			} else {
-				evt = log.Info(stream.Context())
+				evt = log.AccessInfo(stream.Context())
 			}
 			// common properties
 			evt = evt.Str("service", "envoy")
 			evt = evt.Str("upstream-cluster", entry.GetCommonProperties().GetUpstreamCluster())
+			evt = evt.Str("upstream-host", entry.GetCommonProperties().GetUpstreamRemoteAddress().GetSocketAddress().GetAddress())
 			// request properties
 			evt = evt.Str("method", entry.GetRequest().GetRequestMethod().String())
 			evt = evt.Str("authority", entry.GetRequest().GetAuthority())
@@ -42,17 +66,62 @@ func (srv *Server) StreamAccessLogs(stream envoy_service_accesslog_v3.AccessLogS
 			evt = evt.Str("referer", stripQueryString(entry.GetRequest().GetReferer()))
 			evt = evt.Str("forwarded-for", entry.GetRequest().GetForwardedFor())
 			evt = evt.Str("request-id", entry.GetRequest().GetRequestId())
+			evt = evt.Uint64("request-size", entry.GetRequest().GetRequestBodyBytes())
 			// response properties
 			dur, _ := ptypes.Duration(entry.CommonProperties.TimeToLastDownstreamTxByte)
 			evt = evt.Dur("duration", dur)
-			evt = evt.Uint64("size", entry.Response.ResponseBodyBytes)
+			evt = evt.Uint64("size", entry.GetResponse().GetResponseBodyBytes())
 			evt = evt.Uint32("response-code", entry.GetResponse().GetResponseCode().GetValue())
 			evt = evt.Str("response-code-details", entry.GetResponse().GetResponseCodeDetails())
+			// authorize decision
+			evt = populateAuthorizeDecision(evt, entry)
 			evt.Msg("http-request")
 		}
 	}
 }
 
+// populateAuthorizeDecision adds the authorize decision to the log event. It's only available if authorize added it
+// to the dynamic metadata of the request.
+func populateAuthorizeDecision(evt *zerolog.Event, entry *envoy_data_accesslog_v3.HTTPAccessLogEntry) *zerolog.Event {
+	md := entry.GetCommonProperties().GetMetadata().GetFilterMetadata()[log.AuthorizeDecisionMetadataNamespace]
+	keys := make([]string, 0, len(md.GetFields()))
+	for k := range md.GetFields() {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		evt = evt.Interface(k, md.GetFields()[k].AsInterface())
+	}
+	return evt
+}
+
+// getConcurrencyLease returns the concurrent request lease authorize acquired for the request, if any.
+func getConcurrencyLease(entry *envoy_data_accesslog_v3.HTTPAccessLogEntry) (name, id string, ok bool) {
+	md := entry.GetCommonProperties().GetMetadata().GetFilterMetadata()[log.AuthorizeDecisionMetadataNamespace]
+	lease := md.GetFields()[concurrencyLeaseMetadataKey].GetStructValue()
+	name = lease.GetFields()["name"].GetStringValue()
+	id = lease.GetFields()["id"].GetStringValue()
+	if !strings.HasPrefix(name, config.ConcurrencyLeasePrefix) || id == "" {
+		return "", "", false
+	}
+	return name, id, true
+}
+
+// releaseConcurrencyLease releases a concurrent request lease. If it can't be released, it expires after the
+// route's timeout.
+func (srv *Server) releaseConcurrencyLease(name, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseConcurrencyLeaseTimeout)
+	defer cancel()
+
+	client, err := srv.getDataBrokerClient(ctx)
+	if err == nil {
+		_, err = client.ReleaseLease(ctx, &databrokerpb.ReleaseLeaseRequest{Name: name, Id: id})
+	}
+	if err != nil {
+		log.Warn(ctx).Err(err).Str("lease", name).Msg("controlplane: error releasing concurrent request lease")
+	}
+}
+
 func stripQueryString(str string) string {
 	if idx := strings.Index(str, "?"); idx != -1 {
 		str = str[:idx]
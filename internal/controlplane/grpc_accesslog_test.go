@@ -0,0 +1,105 @@
+package controlplane
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_data_accesslog_v3 "github.com/envoyproxy/go-control-plane/envoy/data/accesslog/v3"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+func TestPopulateAuthorizeDecision(t *testing.T) {
+	logEntry := func(t *testing.T, entry *envoy_data_accesslog_v3.HTTPAccessLogEntry) map[string]interface{} {
+		var buf bytes.Buffer
+		l := zerolog.New(&buf)
+		populateAuthorizeDecision(l.Info(), entry).Msg("http-request")
+
+		var m map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &m))
+		return m
+	}
+
+	t.Run("decision", func(t *testing.T) {
+		md, err := structpb.NewStruct(map[string]interface{}{
+			"allow": true,
+			"user":  "USER_ID",
+			"email": "user@example.com",
+		})
+		require.NoError(t, err)
+
+		m := logEntry(t, &envoy_data_accesslog_v3.HTTPAccessLogEntry{
+			CommonProperties: &envoy_data_accesslog_v3.AccessLogCommon{
+				Metadata: &envoy_config_core_v3.Metadata{
+					FilterMetadata: map[string]*structpb.Struct{
+						log.AuthorizeDecisionMetadataNamespace: md,
+					},
+				},
+			},
+		})
+		assert.Equal(t, map[string]interface{}{
+			"level":   "info",
+			"message": "http-request",
+			"allow":   true,
+			"user":    "USER_ID",
+			"email":   "user@example.com",
+		}, m)
+	})
+	t.Run("no decision", func(t *testing.T) {
+		m := logEntry(t, &envoy_data_accesslog_v3.HTTPAccessLogEntry{})
+		assert.Equal(t, map[string]interface{}{
+			"level":   "info",
+			"message": "http-request",
+		}, m)
+	})
+}
+
+func TestGetConcurrencyLease(t *testing.T) {
+	entry := func(t *testing.T, md map[string]interface{}) *envoy_data_accesslog_v3.HTTPAccessLogEntry {
+		s, err := structpb.NewStruct(md)
+		require.NoError(t, err)
+		return &envoy_data_accesslog_v3.HTTPAccessLogEntry{
+			CommonProperties: &envoy_data_accesslog_v3.AccessLogCommon{
+				Metadata: &envoy_config_core_v3.Metadata{
+					FilterMetadata: map[string]*structpb.Struct{
+						log.AuthorizeDecisionMetadataNamespace: s,
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("lease", func(t *testing.T) {
+		name, id, ok := getConcurrencyLease(entry(t, map[string]interface{}{
+			"allow": true,
+			"pomerium_concurrency_lease": map[string]interface{}{
+				"name": "pomerium/concurrency/1234/USER_ID/0",
+				"id":   "LEASE_ID",
+			},
+		}))
+		assert.True(t, ok)
+		assert.Equal(t, "pomerium/concurrency/1234/USER_ID/0", name)
+		assert.Equal(t, "LEASE_ID", id)
+	})
+	t.Run("other lease", func(t *testing.T) {
+		_, _, ok := getConcurrencyLease(entry(t, map[string]interface{}{
+			"pomerium_concurrency_lease": map[string]interface{}{
+				"name": "pomerium/identity-manager",
+				"id":   "LEASE_ID",
+			},
+		}))
+		assert.False(t, ok)
+	})
+	t.Run("no lease", func(t *testing.T) {
+		_, _, ok := getConcurrencyLease(entry(t, map[string]interface{}{"allow": true}))
+		assert.False(t, ok)
+		_, _, ok = getConcurrencyLease(&envoy_data_accesslog_v3.HTTPAccessLogEntry{})
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,24 @@
+package controlplane
+
+import (
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/deprecation"
+)
+
+// extAuthzV2Prefix is the method prefix of the v2 ext_authz API, which has been replaced by v3.
+const extAuthzV2Prefix = "/envoy.service.auth.v2."
+
+// unknownServiceHandler rejects calls to unregistered services, recording calls which still use
+// deprecated APIs.
+func unknownServiceHandler(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	if strings.HasPrefix(method, extAuthzV2Prefix) {
+		deprecation.Record(stream.Context(), deprecation.ExtAuthzV2)
+	}
+	return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+}
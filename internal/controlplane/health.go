@@ -0,0 +1,160 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/health"
+	"github.com/pomerium/pomerium/pkg/grpc"
+)
+
+const (
+	authorizeCheckTimeout        = 5 * time.Second
+	identityProviderCheckTimeout = 5 * time.Second
+
+	healthProbeInterval = 10 * time.Second
+	healthProbeTimeout  = authorizeCheckTimeout + identityProviderCheckTimeout
+)
+
+// identityProviderCheckClient is the client used to check the identity provider. Its timeout bounds the
+// check even if its context doesn't.
+var identityProviderCheckClient = &http.Client{Timeout: identityProviderCheckTimeout}
+
+// healthCheckers returns the checkers which are run by the probe of the readiness endpoints, at most once
+// per healthProbeInterval.
+func (srv *Server) healthCheckers() map[string]health.Checker {
+	return map[string]health.Checker{
+		health.Authorize: func(ctx context.Context) error {
+			return checkAuthorize(ctx, srv.currentConfig.Load().Options)
+		},
+		health.Certificates: func(ctx context.Context) error {
+			return checkCertificates(srv.currentConfig.Load().Config, time.Now())
+		},
+		health.IdentityProvider: func(ctx context.Context) error {
+			return checkIdentityProvider(ctx, srv.currentConfig.Load().Options)
+		},
+	}
+}
+
+// checkCertificates checks that every certificate is within its validity window.
+func checkCertificates(cfg *config.Config, now time.Time) error {
+	certs, err := cfg.AllCertificates()
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, cert := range certs {
+		if len(cert.Certificate) == 0 {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		name := leaf.Subject.CommonName
+		if len(leaf.DNSNames) > 0 {
+			name = leaf.DNSNames[0]
+		}
+		switch {
+		case now.After(leaf.NotAfter):
+			problems = append(problems, fmt.Sprintf("certificate %s expired at %s", name, leaf.NotAfter.Format(time.RFC3339)))
+		case now.Before(leaf.NotBefore):
+			problems = append(problems, fmt.Sprintf("certificate %s is not valid until %s", name, leaf.NotBefore.Format(time.RFC3339)))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// checkAuthorize checks that the authorize service can be reached. It is only checked when the proxy
+// service is enabled, so that load balancers stop sending requests to a proxy which would fail them.
+func checkAuthorize(ctx context.Context, options *config.Options) error {
+	if !config.IsProxy(options.Services) {
+		return nil
+	}
+
+	urls, err := options.GetAuthorizeURLs()
+	if err != nil {
+		return err
+	}
+	sharedKey, err := options.GetSharedKey()
+	if err != nil {
+		return err
+	}
+
+	clientCert, err := options.GetGRPCClientCertificate()
+	if err != nil {
+		return err
+	}
+
+	cc, err := grpc.GetGRPCClientConn(ctx, "authorize", &grpc.Options{
+		Addrs:                   urls,
+		OverrideCertificateName: options.OverrideCertificateName,
+		CA:                      options.CA,
+		CAFile:                  options.CAFile,
+		ClientCertificate:       clientCert,
+		SPIREAgentSocket:        options.SPIREAgentSocket,
+		InternalCA:              options.GetInternalCA(),
+		RequestTimeout:          options.GRPCClientTimeout,
+		ClientDNSRoundRobin:     options.GRPCClientDNSRoundRobin,
+		WithInsecure:            options.GetGRPCInsecure(),
+		InstallationID:          options.InstallationID,
+		ServiceName:             options.Services,
+		SignedJWTKey:            sharedKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, authorizeCheckTimeout)
+	defer cancel()
+
+	res, err := grpc_health_v1.NewHealthClient(cc).Check(ctx, &grpc_health_v1.HealthCheckRequest{
+		Service: "envoy.service.auth.v3.Authorization",
+	})
+	if err != nil {
+		return err
+	}
+	if res.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+		return fmt.Errorf("authorize service is %s", res.GetStatus())
+	}
+	return nil
+}
+
+// checkIdentityProvider checks that the identity provider's discovery document can be retrieved. It is
+// only checked when the authenticate service is enabled and a provider url is set.
+func checkIdentityProvider(ctx context.Context, options *config.Options) error {
+	if !config.IsAuthenticate(options.Services) || options.ProviderURL == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, identityProviderCheckTimeout)
+	defer cancel()
+
+	u := strings.TrimSuffix(options.ProviderURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := identityProviderCheckClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code from %s: %d", u, res.StatusCode)
+	}
+	return nil
+}
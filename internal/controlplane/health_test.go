@@ -0,0 +1,52 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestCheckCertificates(t *testing.T) {
+	cert, err := cryptutil.GenerateSelfSignedCertificate("example.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+	cfg := &config.Config{
+		Options:          config.NewDefaultOptions(),
+		AutoCertificates: []tls.Certificate{*cert},
+	}
+
+	assert.NoError(t, checkCertificates(cfg, time.Now()))
+	assert.Error(t, checkCertificates(cfg, time.Now().Add(-24*time.Hour)), "should fail before the validity window")
+	assert.Error(t, checkCertificates(cfg, time.Now().Add(2*365*24*time.Hour)), "should fail after the validity window")
+}
+
+func TestCheckIdentityProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/openid-configuration" {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	options := config.NewDefaultOptions()
+	options.Services = config.ServiceAll
+	options.ProviderURL = srv.URL
+	assert.NoError(t, checkIdentityProvider(context.Background(), options))
+
+	options.ProviderURL = srv.URL + "/missing"
+	assert.Error(t, checkIdentityProvider(context.Background(), options))
+
+	options.Services = config.ServiceProxy
+	assert.NoError(t, checkIdentityProvider(context.Background(), options), "should be skipped without authenticate")
+}
@@ -8,7 +8,10 @@ import (
 
 	"github.com/gorilla/handlers"
 
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/deprecation"
 	"github.com/pomerium/pomerium/internal/frontend"
+	"github.com/pomerium/pomerium/internal/health"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry"
@@ -39,17 +42,39 @@ func (srv *Server) addHTTPMiddleware() {
 	root.Use(telemetry.HTTPStatsHandler(func() string {
 		return srv.currentConfig.Load().Options.InstallationID
 	}, srv.name))
-	root.HandleFunc("/healthz", httputil.HealthCheck)
+	healthProbe := health.NewProbe(srv.healthCheckers(), healthProbeInterval, healthProbeTimeout)
+	root.Handle("/healthz", health.LivenessHandler())
+	root.Handle("/readyz", health.ReadinessHandler(healthProbe, false))
 	root.HandleFunc("/ping", httputil.HealthCheck)
 	root.PathPrefix("/.pomerium/assets/").Handler(http.StripPrefix("/.pomerium/assets/", frontend.MustAssetHandler()))
 
+	// metrics, which the metrics manager authenticates itself
+	root.Handle("/metrics", srv.metricsMgr)
+
+	// the debug endpoints are only routed to by the metrics listener, and require the same credentials
+	debug := root.PathPrefix("/debug/").Subrouter()
+	debug.Use(srv.requireMetricsAuth)
+
 	// pprof
-	root.Path("/debug/pprof/cmdline").HandlerFunc(pprof.Cmdline)
-	root.Path("/debug/pprof/profile").HandlerFunc(pprof.Profile)
-	root.Path("/debug/pprof/symbol").HandlerFunc(pprof.Symbol)
-	root.Path("/debug/pprof/trace").HandlerFunc(pprof.Trace)
-	root.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+	debug.Path("/debug/pprof/cmdline").HandlerFunc(pprof.Cmdline)
+	debug.Path("/debug/pprof/profile").HandlerFunc(pprof.Profile)
+	debug.Path("/debug/pprof/symbol").HandlerFunc(pprof.Symbol)
+	debug.Path("/debug/pprof/trace").HandlerFunc(pprof.Trace)
+	debug.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
 
-	// metrics
-	root.Handle("/metrics", srv.metricsMgr)
+	// deprecated feature usage
+	debug.Path("/debug/deprecations").Handler(deprecation.Handler())
+
+	// the status of every dependency, which the public readiness endpoint doesn't include
+	debug.Path("/debug/readyz").Handler(health.ReadinessHandler(healthProbe, true))
+
+	// admin API
+	srv.addAdminHandlers(root.PathPrefix("/.pomerium/admin").Subrouter())
+}
+
+// requireMetricsAuth requires the metrics basic auth or bearer token of the current options.
+func (srv *Server) requireMetricsAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config.RequireMetricsAuth(srv.currentConfig.Load().Options)(next).ServeHTTP(w, r)
+	})
 }
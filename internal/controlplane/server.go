@@ -25,6 +25,7 @@ import (
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry"
 	"github.com/pomerium/pomerium/internal/telemetry/requestid"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/version"
 	pom_grpc "github.com/pomerium/pomerium/pkg/grpc"
 	"github.com/pomerium/pomerium/pkg/grpc/events"
@@ -59,6 +60,7 @@ type Server struct {
 	currentConfig atomicVersionedConfig
 	name          string
 	xdsmgr        *xdsmgr.Manager
+	resourceCache resourceCache
 	filemgr       *filemgr.Manager
 	metricsMgr    *config.MetricsManager
 	reproxy       *reproxy.Handler
@@ -95,11 +97,13 @@ func NewServer(name string, metricsMgr *config.MetricsManager) (*Server, error)
 		grpc.StatsHandler(telemetry.NewGRPCServerStatsHandler(name)),
 		grpc.ChainUnaryInterceptor(requestid.UnaryServerInterceptor(), ui),
 		grpc.ChainStreamInterceptor(requestid.StreamServerInterceptor(), si),
+		grpc.UnknownServiceHandler(unknownServiceHandler),
 	)
 	reflection.Register(srv.GRPCServer)
 	srv.registerAccessLogHandlers()
 
 	grpc_health_v1.RegisterHealthServer(srv.GRPCServer, pom_grpc.NewHealthCheckServer())
+	trace.RegisterAgentServer(srv.GRPCServer)
 
 	// setup HTTP
 	srv.HTTPListener, err = net.Listen("tcp4", "127.0.0.1:0")
@@ -212,6 +216,10 @@ func (srv *Server) OnConfigChange(ctx context.Context, cfg *config.Config) error
 	if err != nil {
 		return err
 	}
+	// keep removed clusters until the requests to them, on the drained listeners, complete
+	srv.xdsmgr.SetDrainTimeout(clusterTypeURL, cfg.Options.DrainTimeout)
+	// and keep removed route configurations until the drained listeners referencing them close
+	srv.xdsmgr.SetDrainTimeout(routeConfigurationTypeURL, cfg.Options.DrainTimeout)
 	srv.xdsmgr.Update(ctx, res)
 	return nil
 }
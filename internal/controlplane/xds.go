@@ -3,16 +3,19 @@ package controlplane
 import (
 	"context"
 	"encoding/hex"
+	"sync"
 
 	envoy_service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
 
 	"github.com/pomerium/pomerium/pkg/cryptutil"
 )
 
 const (
-	clusterTypeURL  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
-	listenerTypeURL = "type.googleapis.com/envoy.config.listener.v3.Listener"
+	clusterTypeURL            = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	listenerTypeURL           = "type.googleapis.com/envoy.config.listener.v3.Listener"
+	routeConfigurationTypeURL = "type.googleapis.com/envoy.config.route.v3.RouteConfiguration"
 )
 
 func (srv *Server) buildDiscoveryResources(ctx context.Context) (map[string][]*envoy_service_discovery_v3.Resource, error) {
@@ -24,12 +27,7 @@ func (srv *Server) buildDiscoveryResources(ctx context.Context) (map[string][]*e
 		return nil, err
 	}
 	for _, cluster := range clusters {
-		any, _ := anypb.New(cluster)
-		resources[clusterTypeURL] = append(resources[clusterTypeURL], &envoy_service_discovery_v3.Resource{
-			Name:     cluster.Name,
-			Version:  hex.EncodeToString(cryptutil.HashProto(cluster)),
-			Resource: any,
-		})
+		resources[clusterTypeURL] = append(resources[clusterTypeURL], srv.resourceCache.get(clusterTypeURL, cluster.Name, cluster))
 	}
 
 	listeners, err := srv.Builder.BuildListeners(ctx, cfg.Config)
@@ -37,12 +35,71 @@ func (srv *Server) buildDiscoveryResources(ctx context.Context) (map[string][]*e
 		return nil, err
 	}
 	for _, listener := range listeners {
-		any, _ := anypb.New(listener)
-		resources[listenerTypeURL] = append(resources[listenerTypeURL], &envoy_service_discovery_v3.Resource{
-			Name:     listener.Name,
-			Version:  hex.EncodeToString(cryptutil.HashProto(listener)),
-			Resource: any,
-		})
+		resources[listenerTypeURL] = append(resources[listenerTypeURL], srv.resourceCache.get(listenerTypeURL, listener.Name, listener))
 	}
+
+	routeConfigurations, err := srv.Builder.BuildRouteConfigurations(ctx, cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	for _, rc := range routeConfigurations {
+		resources[routeConfigurationTypeURL] = append(resources[routeConfigurationTypeURL],
+			srv.resourceCache.get(routeConfigurationTypeURL, rc.Name, rc))
+	}
+
+	srv.resourceCache.retain(resources)
 	return resources, nil
 }
+
+// A resourceCache caches the discovery resources of the last build, so that the resources which haven't changed
+// are reused rather than copied again.
+type resourceCache struct {
+	mu        sync.Mutex
+	resources map[string]map[string]*envoy_service_discovery_v3.Resource
+}
+
+// get returns the discovery resource for the message. The message is marshaled once, deterministically, both to
+// version it and to build the resource.
+func (c *resourceCache) get(typeURL, name string, msg proto.Message) *envoy_service_discovery_v3.Resource {
+	bs, _ := proto.MarshalOptions{AllowPartial: true, Deterministic: true}.Marshal(msg)
+	version := hex.EncodeToString(cryptutil.Hash("proto", bs))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if resource, ok := c.resources[typeURL][name]; ok && resource.Version == version {
+		return resource
+	}
+
+	resource := &envoy_service_discovery_v3.Resource{
+		Name:     name,
+		Version:  version,
+		Resource: &anypb.Any{TypeUrl: typeURL, Value: bs},
+	}
+	if c.resources == nil {
+		c.resources = make(map[string]map[string]*envoy_service_discovery_v3.Resource)
+	}
+	if c.resources[typeURL] == nil {
+		c.resources[typeURL] = make(map[string]*envoy_service_discovery_v3.Resource)
+	}
+	c.resources[typeURL][name] = resource
+	return resource
+}
+
+// retain removes the resources which aren't part of the given resources from the cache.
+func (c *resourceCache) retain(resources map[string][]*envoy_service_discovery_v3.Resource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for typeURL, byName := range c.resources {
+		current := make(map[string]struct{}, len(resources[typeURL]))
+		for _, resource := range resources[typeURL] {
+			current[resource.Name] = struct{}{}
+		}
+		for name := range byName {
+			if _, ok := current[name]; !ok {
+				delete(byName, name)
+			}
+		}
+	}
+}
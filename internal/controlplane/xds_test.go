@@ -0,0 +1,30 @@
+package controlplane
+
+import (
+	"testing"
+
+	envoy_config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	envoy_service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceCache(t *testing.T) {
+	var c resourceCache
+
+	r1 := c.get(clusterTypeURL, "a", &envoy_config_cluster_v3.Cluster{Name: "a"})
+	var cluster envoy_config_cluster_v3.Cluster
+	require.NoError(t, r1.GetResource().UnmarshalTo(&cluster))
+	assert.Equal(t, "a", cluster.GetName())
+
+	r2 := c.get(clusterTypeURL, "a", &envoy_config_cluster_v3.Cluster{Name: "a"})
+	assert.Same(t, r1, r2, "unchanged resources should be reused")
+
+	r3 := c.get(clusterTypeURL, "a", &envoy_config_cluster_v3.Cluster{Name: "a", AltStatName: "b"})
+	assert.NotEqual(t, r1.GetVersion(), r3.GetVersion())
+
+	c.retain(map[string][]*envoy_service_discovery_v3.Resource{})
+	r4 := c.get(clusterTypeURL, "a", &envoy_config_cluster_v3.Cluster{Name: "a", AltStatName: "b"})
+	assert.NotSame(t, r3, r4, "removed resources should be evicted")
+	assert.Equal(t, r3.GetVersion(), r4.GetVersion())
+}
@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	envoy_service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/google/uuid"
@@ -35,6 +37,21 @@ type streamState struct {
 
 var onHandleDeltaRequest = func(state *streamState) {}
 
+// typeURLOrder is the order in which changes to resources are sent, as recommended by the xDS protocol, so that
+// e.g. the clusters referenced by a listener are added before the listener.
+var typeURLOrder = []string{
+	"type.googleapis.com/envoy.config.cluster.v3.Cluster",
+	"type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment",
+	"type.googleapis.com/envoy.config.listener.v3.Listener",
+	"type.googleapis.com/envoy.config.route.v3.RouteConfiguration",
+}
+
+// A drainingResource is a resource removed by an update, which is kept until its deadline.
+type drainingResource struct {
+	resource *envoy_service_discovery_v3.Resource
+	deadline time.Time
+}
+
 // A Manager manages xDS resources.
 type Manager struct {
 	signal       *signal.Signal
@@ -44,6 +61,10 @@ type Manager struct {
 	nonce     string
 	resources map[string][]*envoy_service_discovery_v3.Resource
 
+	drainTimeouts map[string]time.Duration
+	draining      map[string]map[string]drainingResource
+	drainTimer    *time.Timer
+
 	nonceToConfig *lru.Cache
 
 	hostname string
@@ -60,12 +81,17 @@ func NewManager(resources map[string][]*envoy_service_discovery_v3.Resource, eve
 		nonceToConfig: nonceToConfig,
 		nonce:         uuid.NewString(),
 		resources:     resources,
+		drainTimeouts: make(map[string]time.Duration),
+		draining:      make(map[string]map[string]drainingResource),
 
 		hostname: getHostname(),
 	}
 }
 
-// DeltaAggregatedResources implements the increment xDS server.
+// DeltaAggregatedResources implements the incremental xDS server. Each response only contains the resources
+// whose version differs from the version the client acknowledged, and the names of the resources it has that were
+// removed, so unchanged resources aren't sent again. Resources are versioned as a whole: a change to one route
+// re-sends the whole route configuration containing it.
 func (mgr *Manager) DeltaAggregatedResources(
 	stream envoy_service_discovery_v3.AggregatedDiscoveryService_DeltaAggregatedResourcesServer,
 ) error {
@@ -88,7 +114,7 @@ func (mgr *Manager) DeltaAggregatedResources(
 			Nonce:   mgr.nonce,
 		}
 		seen := map[string]struct{}{}
-		for _, resource := range mgr.resources[typeURL] {
+		for _, resource := range mgr.getResources(typeURL) {
 			seen[resource.Name] = struct{}{}
 			if resource.Version != state.clientResourceVersions[resource.Name] {
 				res.Resources = append(res.Resources, resource)
@@ -133,7 +159,7 @@ func (mgr *Manager) DeltaAggregatedResources(
 			// a NACK
 			// - set the client resource versions to the current resource versions
 			state.clientResourceVersions = make(map[string]string)
-			for _, resource := range mgr.resources[req.GetTypeUrl()] {
+			for _, resource := range mgr.getResources(req.GetTypeUrl()) {
 				state.clientResourceVersions[resource.Name] = resource.Version
 			}
 
@@ -142,7 +168,7 @@ func (mgr *Manager) DeltaAggregatedResources(
 			// an ACK for the last response
 			// - set the client resource versions to the current resource versions
 			state.clientResourceVersions = make(map[string]string)
-			for _, resource := range mgr.resources[req.GetTypeUrl()] {
+			for _, resource := range mgr.getResources(req.GetTypeUrl()) {
 				state.clientResourceVersions[resource.Name] = resource.Version
 			}
 
@@ -205,7 +231,13 @@ func (mgr *Manager) DeltaAggregatedResources(
 				for typeURL := range mgr.resources {
 					typeURLs = append(typeURLs, typeURL)
 				}
+				for typeURL := range mgr.draining {
+					if _, ok := mgr.resources[typeURL]; !ok {
+						typeURLs = append(typeURLs, typeURL)
+					}
+				}
 				mgr.mu.Unlock()
+				sortTypeURLs(typeURLs)
 			}
 
 			for _, typeURL := range typeURLs {
@@ -240,7 +272,8 @@ func (mgr *Manager) DeltaAggregatedResources(
 	return eg.Wait()
 }
 
-// StreamAggregatedResources is not implemented.
+// StreamAggregatedResources is not implemented. Envoy is bootstrapped with the DELTA_GRPC API type, so the state
+// of the world protocol isn't used.
 func (mgr *Manager) StreamAggregatedResources(
 	stream envoy_service_discovery_v3.AggregatedDiscoveryService_StreamAggregatedResourcesServer,
 ) error {
@@ -253,6 +286,7 @@ func (mgr *Manager) Update(ctx context.Context, resources map[string][]*envoy_se
 	nonce := uuid.New().String()
 
 	mgr.mu.Lock()
+	mgr.drainRemovedResources(resources)
 	mgr.nonce = nonce
 	mgr.resources = resources
 	mgr.nonceToConfig.Add(nonce, ctx.Value(contextkeys.UpdateRecordsVersion))
@@ -261,6 +295,112 @@ func (mgr *Manager) Update(ctx context.Context, resources map[string][]*envoy_se
 	mgr.signal.Broadcast(ctx)
 }
 
+// SetDrainTimeout sets how long resources of the type are still served after an update removes them, e.g. so
+// that in-flight requests to a removed cluster can complete. By default they're removed immediately.
+func (mgr *Manager) SetDrainTimeout(typeURL string, timeout time.Duration) {
+	mgr.mu.Lock()
+	mgr.drainTimeouts[typeURL] = timeout
+	mgr.mu.Unlock()
+}
+
+// getResources returns the resources of the type, including the draining ones. The lock must be held.
+func (mgr *Manager) getResources(typeURL string) []*envoy_service_discovery_v3.Resource {
+	draining := mgr.draining[typeURL]
+	if len(draining) == 0 {
+		return mgr.resources[typeURL]
+	}
+
+	resources := append([]*envoy_service_discovery_v3.Resource{}, mgr.resources[typeURL]...)
+	for _, dr := range draining {
+		resources = append(resources, dr.resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Name < resources[j].Name
+	})
+	return resources
+}
+
+// drainRemovedResources starts draining the resources removed by an update. The lock must be held.
+func (mgr *Manager) drainRemovedResources(resources map[string][]*envoy_service_discovery_v3.Resource) {
+	now := time.Now()
+	for typeURL, timeout := range mgr.drainTimeouts {
+		if timeout <= 0 {
+			delete(mgr.draining, typeURL)
+			continue
+		}
+
+		current := make(map[string]struct{})
+		for _, resource := range resources[typeURL] {
+			current[resource.Name] = struct{}{}
+		}
+
+		draining := mgr.draining[typeURL]
+		if draining == nil {
+			draining = make(map[string]drainingResource)
+			mgr.draining[typeURL] = draining
+		}
+		for name := range draining {
+			if _, ok := current[name]; ok {
+				delete(draining, name)
+			}
+		}
+		for _, resource := range mgr.resources[typeURL] {
+			if _, ok := current[resource.Name]; !ok {
+				draining[resource.Name] = drainingResource{resource: resource, deadline: now.Add(timeout)}
+			}
+		}
+	}
+	mgr.scheduleDrain()
+}
+
+// scheduleDrain schedules the removal of the next draining resource. The lock must be held.
+func (mgr *Manager) scheduleDrain() {
+	var next time.Time
+	for _, draining := range mgr.draining {
+		for _, dr := range draining {
+			if next.IsZero() || dr.deadline.Before(next) {
+				next = dr.deadline
+			}
+		}
+	}
+
+	if mgr.drainTimer != nil {
+		mgr.drainTimer.Stop()
+		mgr.drainTimer = nil
+	}
+	if !next.IsZero() {
+		mgr.drainTimer = time.AfterFunc(time.Until(next), mgr.removeDrainedResources)
+	}
+}
+
+// removeDrainedResources removes the draining resources past their deadline, and pushes the change to any
+// listening streams.
+func (mgr *Manager) removeDrainedResources() {
+	nonce := uuid.New().String()
+	now := time.Now()
+
+	mgr.mu.Lock()
+	changed := false
+	for _, draining := range mgr.draining {
+		for name, dr := range draining {
+			if !dr.deadline.After(now) {
+				delete(draining, name)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		mgr.nonceToConfig.Add(nonce, mgr.nonceToConfigVersion(mgr.nonce))
+		mgr.nonce = nonce
+	}
+	mgr.scheduleDrain()
+	mgr.mu.Unlock()
+
+	if changed {
+		mgr.signal.Broadcast(context.Background())
+	}
+}
+
 func (mgr *Manager) nonceToConfigVersion(nonce string) (ver uint64) {
 	val, ok := mgr.nonceToConfig.Get(nonce)
 	if !ok {
@@ -335,6 +475,24 @@ func (mgr *Manager) changeEvent(ctx context.Context, res *envoy_service_discover
 		Msg("sent update")
 }
 
+func sortTypeURLs(typeURLs []string) {
+	index := func(typeURL string) int {
+		for i, t := range typeURLOrder {
+			if t == typeURL {
+				return i
+			}
+		}
+		return len(typeURLOrder)
+	}
+	sort.Slice(typeURLs, func(i, j int) bool {
+		ii, ij := index(typeURLs[i]), index(typeURLs[j])
+		if ii != ij {
+			return ii < ij
+		}
+		return typeURLs[i] < typeURLs[j]
+	})
+}
+
 func resourceNames(res []*envoy_service_discovery_v3.Resource) []string {
 	txt := make([]string, 0, len(res))
 	for _, r := range res {
@@ -36,6 +36,7 @@ func TestManager(t *testing.T) {
 	mgr := NewManager(map[string][]*envoy_service_discovery_v3.Resource{
 		typeURL: {
 			{Name: "r1", Version: "1"},
+			{Name: "r2", Version: "1"},
 		},
 	}, func(evt *events.EnvoyConfigurationEvent) {})
 	envoy_service_discovery_v3.RegisterAggregatedDiscoveryServiceServer(srv, mgr)
@@ -92,29 +93,77 @@ func TestManager(t *testing.T) {
 		assert.NotEmpty(t, msg.GetNonce(), "nonce should not be empty")
 		assert.Equal(t, []*envoy_service_discovery_v3.Resource{
 			{Name: "r1", Version: "1"},
+			{Name: "r2", Version: "1"},
 		}, msg.GetResources())
 		ack(msg.Nonce)
 
 		mgr.Update(ctx, map[string][]*envoy_service_discovery_v3.Resource{
-			typeURL: {{Name: "r1", Version: "2"}},
+			typeURL: {{Name: "r1", Version: "2"}, {Name: "r2", Version: "1"}},
 		})
 
 		msg, err = stream.Recv()
 		assert.NoError(t, err)
 		assert.Equal(t, []*envoy_service_discovery_v3.Resource{
 			{Name: "r1", Version: "2"},
-		}, msg.GetResources())
+		}, msg.GetResources(), "only changed resources should be sent")
+		assert.Empty(t, msg.GetRemovedResources())
 		ack(msg.Nonce)
 
 		mgr.Update(ctx, map[string][]*envoy_service_discovery_v3.Resource{
-			typeURL: nil,
+			typeURL: {{Name: "r2", Version: "1"}},
 		})
 
 		assert.Eventually(t, func() bool {
 			msg, err = stream.Recv()
 			require.NoError(t, err)
 			ack(msg.Nonce)
-			return assert.ObjectsAreEqual([]string{"r1"}, msg.GetRemovedResources())
+			return assert.ObjectsAreEqual([]string{"r1"}, msg.GetRemovedResources()) &&
+				assert.ObjectsAreEqual([]*envoy_service_discovery_v3.Resource(nil), msg.GetResources())
 		}, time.Second*5, time.Millisecond)
 	})
 }
+
+func TestManager_drain(t *testing.T) {
+	typeURL := "example.com/example"
+
+	mgr := NewManager(map[string][]*envoy_service_discovery_v3.Resource{
+		typeURL: {{Name: "r1", Version: "1"}},
+	}, func(evt *events.EnvoyConfigurationEvent) {})
+	mgr.SetDrainTimeout(typeURL, 100*time.Millisecond)
+
+	getNames := func() []string {
+		mgr.mu.Lock()
+		defer mgr.mu.Unlock()
+		return resourceNames(mgr.getResources(typeURL))
+	}
+
+	mgr.Update(context.Background(), map[string][]*envoy_service_discovery_v3.Resource{
+		typeURL: {{Name: "r2", Version: "1"}},
+	})
+	assert.Equal(t, []string{"r1", "r2"}, getNames(), "removed resources should be kept while draining")
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"r2"}, getNames())
+	}, time.Second*5, time.Millisecond*10, "drained resources should be removed")
+
+	mgr.Update(context.Background(), map[string][]*envoy_service_discovery_v3.Resource{
+		typeURL: nil,
+	})
+	mgr.Update(context.Background(), map[string][]*envoy_service_discovery_v3.Resource{
+		typeURL: {{Name: "r2", Version: "2"}},
+	})
+	assert.Equal(t, []string{"r2"}, getNames(), "re-added resources should no longer be draining")
+}
+
+func TestSortTypeURLs(t *testing.T) {
+	typeURLs := []string{
+		"example.com/example",
+		"type.googleapis.com/envoy.config.listener.v3.Listener",
+		"type.googleapis.com/envoy.config.cluster.v3.Cluster",
+	}
+	sortTypeURLs(typeURLs)
+	assert.Equal(t, []string{
+		"type.googleapis.com/envoy.config.cluster.v3.Cluster",
+		"type.googleapis.com/envoy.config.listener.v3.Listener",
+		"example.com/example",
+	}, typeURLs)
+}
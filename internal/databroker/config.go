@@ -26,9 +26,18 @@ type serverConfig struct {
 	secret                  []byte
 	storageType             string
 	storageConnectionString string
+	storageCA               string
 	storageCAFile           string
 	storageCertSkipVerify   bool
 	storageCertificate      *tls.Certificate
+	storageRequireTLS       bool
+	storageUsername         string
+	storagePassword         string
+	storageDB               int
+	storageSentinelMaster   string
+	storageSnapshotFile     string
+	storageSnapshotInterval time.Duration
+	storagePlugin           string
 	getAllPageSize          int
 	registryTTL             time.Duration
 }
@@ -97,6 +106,13 @@ func WithStorageConnectionString(connStr string) ServerOption {
 	}
 }
 
+// WithStorageCA sets the base64 encoded CA in the config.
+func WithStorageCA(ca string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageCA = ca
+	}
+}
+
 // WithStorageCAFile sets the CA file in the config.
 func WithStorageCAFile(filePath string) ServerOption {
 	return func(cfg *serverConfig) {
@@ -117,3 +133,47 @@ func WithStorageCertificate(certificate *tls.Certificate) ServerOption {
 		cfg.storageCertificate = certificate
 	}
 }
+
+// WithStorageRequireTLS enables TLS for the storage connection, even if the connection string doesn't.
+func WithStorageRequireTLS(requireTLS bool) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageRequireTLS = requireTLS
+	}
+}
+
+// WithStorageAuth sets the username and password used to authenticate to storage.
+func WithStorageAuth(username, password string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageUsername = username
+		cfg.storagePassword = password
+	}
+}
+
+// WithStorageDB sets the storage database index.
+func WithStorageDB(db int) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageDB = db
+	}
+}
+
+// WithStorageSentinelMaster sets the name of the master monitored by sentinel.
+func WithStorageSentinelMaster(name string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageSentinelMaster = name
+	}
+}
+
+// WithStorageSnapshot sets the file the in-memory storage is restored from, and saved to at the given interval.
+func WithStorageSnapshot(file string, interval time.Duration) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storageSnapshotFile = file
+		cfg.storageSnapshotInterval = interval
+	}
+}
+
+// WithStoragePlugin sets the path of the storage plugin executable.
+func WithStoragePlugin(path string) ServerOption {
+	return func(cfg *serverConfig) {
+		cfg.storagePlugin = path
+	}
+}
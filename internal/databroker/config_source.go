@@ -164,18 +164,31 @@ func (src *ConfigSource) runUpdater(cfg *config.Config) {
 	}
 
 	sharedKey, _ := cfg.Options.GetSharedKey()
+	clientCert, err := cfg.Options.GetGRPCClientCertificate()
+	if err != nil {
+		log.Error(context.TODO()).Err(err).Msg("databroker: invalid grpc client certificate")
+		return
+	}
 	connectionOptions := &grpc.Options{
 		Addrs:                   urls,
 		OverrideCertificateName: cfg.Options.OverrideCertificateName,
 		CA:                      cfg.Options.CA,
 		CAFile:                  cfg.Options.CAFile,
+		ClientCertificate:       clientCert,
+		SPIREAgentSocket:        cfg.Options.SPIREAgentSocket,
+		InternalCA:              cfg.Options.GetInternalCA(),
 		RequestTimeout:          cfg.Options.GRPCClientTimeout,
 		ClientDNSRoundRobin:     cfg.Options.GRPCClientDNSRoundRobin,
 		WithInsecure:            cfg.Options.GetGRPCInsecure(),
 		ServiceName:             cfg.Options.Services,
 		SignedJWTKey:            sharedKey,
 	}
-	h, err := hashutil.Hash(connectionOptions)
+	// the client certificate isn't hashable, so hash its raw bytes instead
+	var clientCertBytes [][]byte
+	if clientCert != nil {
+		clientCertBytes = clientCert.Certificate
+	}
+	h, err := hashutil.Hash([]interface{}{connectionOptions, clientCertBytes})
 	if err != nil {
 		log.Fatal().Err(err).Send()
 	}
@@ -98,6 +98,10 @@ func (srv *Server) newRegistryLocked() (registry.Interface, error) {
 		r, err := redis.New(
 			srv.cfg.storageConnectionString,
 			redis.WithTLSConfig(srv.getTLSConfigLocked(ctx)),
+			redis.WithRequireTLS(srv.cfg.storageRequireTLS),
+			redis.WithAuth(srv.cfg.storageUsername, srv.cfg.storagePassword),
+			redis.WithDB(srv.cfg.storageDB),
+			redis.WithSentinelMasterName(srv.cfg.storageSentinelMaster),
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create new redis registry: %w", err)
@@ -24,6 +24,7 @@ import (
 	"github.com/pomerium/pomerium/pkg/grpcutil"
 	"github.com/pomerium/pomerium/pkg/storage"
 	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+	"github.com/pomerium/pomerium/pkg/storage/plugin"
 	"github.com/pomerium/pomerium/pkg/storage/redis"
 )
 
@@ -381,16 +382,30 @@ func (srv *Server) newBackendLocked() (backend storage.Backend, err error) {
 	switch srv.cfg.storageType {
 	case config.StorageInMemoryName:
 		log.Info(ctx).Msg("using in-memory store")
-		return inmemory.New(), nil
+		if srv.cfg.storageSnapshotFile == "" {
+			return inmemory.New(), nil
+		}
+		// records are encrypted so that the snapshot isn't stored in plain text
+		backend = inmemory.New(inmemory.WithSnapshot(srv.cfg.storageSnapshotFile, srv.cfg.storageSnapshotInterval))
 	case config.StorageRedisName:
 		log.Info(ctx).Msg("using redis store")
 		backend, err = redis.New(
 			srv.cfg.storageConnectionString,
 			redis.WithTLSConfig(srv.getTLSConfigLocked(ctx)),
+			redis.WithRequireTLS(srv.cfg.storageRequireTLS),
+			redis.WithAuth(srv.cfg.storageUsername, srv.cfg.storagePassword),
+			redis.WithDB(srv.cfg.storageDB),
+			redis.WithSentinelMasterName(srv.cfg.storageSentinelMaster),
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create new redis storage: %w", err)
 		}
+	case config.StoragePluginName:
+		log.Info(ctx).Str("plugin", srv.cfg.storagePlugin).Msg("using storage plugin")
+		backend, err = plugin.Open(ctx, srv.cfg.storagePlugin, srv.cfg.storageConnectionString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start storage plugin: %w", err)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", srv.cfg.storageType)
 	}
@@ -404,7 +419,7 @@ func (srv *Server) newBackendLocked() (backend storage.Backend, err error) {
 }
 
 func (srv *Server) getTLSConfigLocked(ctx context.Context) *tls.Config {
-	caCertPool, err := cryptutil.GetCertPool("", srv.cfg.storageCAFile)
+	caCertPool, err := cryptutil.GetCertPool(srv.cfg.storageCA, srv.cfg.storageCAFile)
 	if err != nil {
 		log.Warn(ctx).Err(err).Msg("failed to read databroker CA file")
 	}
@@ -0,0 +1,108 @@
+// Package deprecation records usage of deprecated options and flows, so operators can confirm they no
+// longer rely on them before upgrading to a version which removes them.
+package deprecation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+)
+
+// A Feature is a deprecated option or flow.
+type Feature struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	RemovedIn   string `json:"removed_in,omitempty"`
+}
+
+// Deprecated features.
+var (
+	HeadersOption = register(Feature{
+		Name:        "headers_option",
+		Description: "the headers option, which has been renamed to set_response_headers",
+		RemovedIn:   "v0.16",
+	})
+	ForwardAuthURIQuery = register(Feature{
+		Name:        "forward_auth_uri_query",
+		Description: "forward auth requests which pass the original URL in the uri query parameter instead of the X-Forwarded-* headers",
+	})
+	ExtAuthzV2 = register(Feature{
+		Name:        "ext_authz_v2",
+		Description: "ext_authz requests using the v2 transport API, which is no longer served",
+	})
+)
+
+// A Usage records how often a Feature has been used.
+type Usage struct {
+	Feature
+	Count    int64      `json:"count"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+var registry = struct {
+	sync.Mutex
+	usages map[string]*Usage
+}{
+	usages: map[string]*Usage{},
+}
+
+func register(f Feature) Feature {
+	registry.Lock()
+	registry.usages[f.Name] = &Usage{Feature: f}
+	registry.Unlock()
+	return f
+}
+
+// Record records a use of a deprecated feature. A warning is logged the first time each feature is used.
+func Record(ctx context.Context, f Feature) {
+	now := time.Now()
+
+	registry.Lock()
+	u, ok := registry.usages[f.Name]
+	if !ok {
+		u = &Usage{Feature: f}
+		registry.usages[f.Name] = u
+	}
+	u.Count++
+	u.LastUsed = &now
+	first := u.Count == 1
+	registry.Unlock()
+
+	metrics.RecordDeprecatedFeatureUsage(ctx, f.Name)
+	if first {
+		evt := log.Warn(ctx).Str("feature", f.Name)
+		if f.RemovedIn != "" {
+			evt = evt.Str("removed_in", f.RemovedIn)
+		}
+		evt.Msgf("deprecated: %s is deprecated", f.Description)
+	}
+}
+
+// Usages returns the usage of every deprecated feature, sorted by name.
+func Usages() []Usage {
+	registry.Lock()
+	defer registry.Unlock()
+
+	usages := make([]Usage, 0, len(registry.usages))
+	for _, u := range registry.usages {
+		usages = append(usages, *u)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Name < usages[j].Name
+	})
+	return usages
+}
+
+// Handler returns an http.Handler which serves the usage of every deprecated feature as JSON.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Usages())
+	})
+}
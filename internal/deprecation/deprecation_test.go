@@ -0,0 +1,45 @@
+package deprecation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecord(t *testing.T) {
+	getUsage := func(name string) Usage {
+		for _, u := range Usages() {
+			if u.Name == name {
+				return u
+			}
+		}
+		t.Fatalf("missing usage for %s", name)
+		return Usage{}
+	}
+
+	before := getUsage(ExtAuthzV2.Name)
+	Record(context.Background(), ExtAuthzV2)
+	Record(context.Background(), ExtAuthzV2)
+	after := getUsage(ExtAuthzV2.Name)
+	assert.Equal(t, before.Count+2, after.Count)
+	assert.NotNil(t, after.LastUsed)
+
+	t.Run("handler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/deprecations", nil))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var usages []Usage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usages))
+		var names []string
+		for _, u := range usages {
+			names = append(names, u.Name)
+		}
+		assert.Equal(t, []string{"ext_authz_v2", "forward_auth_uri_query", "headers_option"}, names)
+	})
+}
@@ -0,0 +1,113 @@
+// Package devicecredential contains the WebAuthn credentials users enroll to identify their devices. Sessions
+// are bound to a device by verifying one of its user's credentials, and policies can then require a device.
+package devicecredential
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// Databroker record types. Records are stored as JSON.
+const (
+	// RecordType is the record type of credentials, whose ids are the hash of the credential id.
+	RecordType = "pomerium.io/DeviceCredential"
+	// SessionRecordType is the record type of session bindings, whose ids are the session id.
+	SessionRecordType = "pomerium.io/DeviceSession"
+)
+
+// A Credential is a WebAuthn credential enrolled by a user.
+type Credential struct {
+	// ID is the hash of the WebAuthn credential id.
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Name   string `json:"name,omitempty"`
+	// RawID is the base64url encoded WebAuthn credential id.
+	RawID string `json:"raw_id"`
+	// PublicKey is the DER encoded SubjectPublicKeyInfo of the credential.
+	PublicKey  []byte     `json:"public_key"`
+	SignCount  uint32     `json:"sign_count"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// ID returns the id of the credential with the given base64url encoded WebAuthn credential id.
+func ID(rawID string) string {
+	return hex.EncodeToString(cryptutil.Hash("device_credential", []byte(rawID)))
+}
+
+// A Session binds a session to the device credential it was verified with.
+type Session struct {
+	SessionID    string    `json:"session_id"`
+	CredentialID string    `json:"credential_id"`
+	VerifiedAt   time.Time `json:"verified_at"`
+}
+
+// ToRecord converts the credential into a databroker record.
+func (c *Credential) ToRecord() (*databroker.Record, error) {
+	return toRecord(RecordType, c.ID, c)
+}
+
+// ToRecord converts the session binding into a databroker record.
+func (s *Session) ToRecord() (*databroker.Record, error) {
+	return toRecord(SessionRecordType, s.SessionID, s)
+}
+
+// FromRecord returns the credential stored in a databroker record.
+func FromRecord(record *databroker.Record) (*Credential, error) {
+	var value wrapperspb.BytesValue
+	if err := record.GetData().UnmarshalTo(&value); err != nil {
+		return nil, fmt.Errorf("devicecredential: error decoding record: %w", err)
+	}
+	return FromBytes(value.GetValue())
+}
+
+// FromBytes returns the credential stored as JSON.
+func FromBytes(bs []byte) (*Credential, error) {
+	var c Credential
+	if err := json.Unmarshal(bs, &c); err != nil {
+		return nil, fmt.Errorf("devicecredential: error decoding credential: %w", err)
+	}
+	return &c, nil
+}
+
+// SessionFromRecord returns the session binding stored in a databroker record.
+func SessionFromRecord(record *databroker.Record) (*Session, error) {
+	var value wrapperspb.BytesValue
+	if err := record.GetData().UnmarshalTo(&value); err != nil {
+		return nil, fmt.Errorf("devicecredential: error decoding record: %w", err)
+	}
+	return SessionFromBytes(value.GetValue())
+}
+
+// SessionFromBytes returns the session binding stored as JSON.
+func SessionFromBytes(bs []byte) (*Session, error) {
+	var s Session
+	if err := json.Unmarshal(bs, &s); err != nil {
+		return nil, fmt.Errorf("devicecredential: error decoding session: %w", err)
+	}
+	return &s, nil
+}
+
+func toRecord(recordType, id string, v interface{}) (*databroker.Record, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	data, err := anypb.New(wrapperspb.Bytes(bs))
+	if err != nil {
+		return nil, err
+	}
+	return &databroker.Record{
+		Type: recordType,
+		Id:   id,
+		Data: data,
+	}, nil
+}
@@ -0,0 +1,170 @@
+package devicecredential
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+// ChallengeTTL is how long a challenge is valid for.
+const ChallengeTTL = 5 * time.Minute
+
+// authenticator data flags
+// https://www.w3.org/TR/webauthn-2/#sctn-authenticator-data
+const flagUserPresent = 0x01
+
+// A RelyingParty is the WebAuthn relying party credentials are scoped to, which is the authenticate service.
+type RelyingParty struct {
+	// ID is the hostname of the relying party.
+	ID string
+	// Origin is the origin of the pages which create and use credentials.
+	Origin string
+}
+
+// NewChallenge returns a new challenge for a session. Challenges are signed rather than stored, so they're only
+// valid for the session and purpose they were created for, until they expire.
+func NewChallenge(key []byte, sessionID, purpose string, now time.Time) string {
+	msg := make([]byte, 24)
+	copy(msg, cryptutil.NewKey()[:16])
+	binary.BigEndian.PutUint64(msg[16:], uint64(now.Add(ChallengeTTL).Unix()))
+	mac := cryptutil.GenerateHMAC(challengeData(msg, sessionID, purpose), key)
+	return base64.RawURLEncoding.EncodeToString(append(msg, mac...))
+}
+
+// VerifyChallenge verifies that the challenge was created for the session and purpose and hasn't expired.
+func VerifyChallenge(key []byte, challenge, sessionID, purpose string, now time.Time) error {
+	raw, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(raw) <= 24 {
+		return errors.New("devicecredential: invalid challenge")
+	}
+	msg, mac := raw[:24], raw[24:]
+	if !cryptutil.CheckHMAC(challengeData(msg, sessionID, purpose), mac, key) {
+		return errors.New("devicecredential: invalid challenge")
+	}
+	if now.Unix() >= int64(binary.BigEndian.Uint64(msg[16:])) {
+		return errors.New("devicecredential: challenge expired")
+	}
+	return nil
+}
+
+func challengeData(msg []byte, sessionID, purpose string) []byte {
+	return bytes.Join([][]byte{msg, []byte(sessionID), []byte(purpose)}, []byte{0})
+}
+
+// VerifyRegistration verifies a credential created by navigator.credentials.create for the challenge. Attestation
+// isn't verified, so credentials identify devices but don't prove what kind of authenticator they are. It returns
+// the initial signature counter of the credential.
+func VerifyRegistration(rp RelyingParty, challenge string, clientDataJSON, authenticatorData, publicKey []byte) (uint32, error) {
+	if err := verifyClientData(rp, "webauthn.create", challenge, clientDataJSON); err != nil {
+		return 0, err
+	}
+	signCount, err := verifyAuthenticatorData(rp, authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := parsePublicKey(publicKey); err != nil {
+		return 0, err
+	}
+	return signCount, nil
+}
+
+// VerifyAssertion verifies an assertion by the credential, made by navigator.credentials.get for the challenge.
+// It returns the new signature counter of the credential.
+func VerifyAssertion(rp RelyingParty, challenge string, c *Credential, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	if err := verifyClientData(rp, "webauthn.get", challenge, clientDataJSON); err != nil {
+		return 0, err
+	}
+	signCount, err := verifyAuthenticatorData(rp, authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	pub, err := parsePublicKey(c.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	if !verifySignature(pub, signed, signature) {
+		return 0, errors.New("devicecredential: invalid signature")
+	}
+
+	// authenticators which count signatures must always increase the count, otherwise the credential may have
+	// been cloned
+	if (signCount != 0 || c.SignCount != 0) && signCount <= c.SignCount {
+		return 0, errors.New("devicecredential: invalid signature counter")
+	}
+	return signCount, nil
+}
+
+func verifyClientData(rp RelyingParty, typ, challenge string, clientDataJSON []byte) error {
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("devicecredential: invalid client data: %w", err)
+	}
+	if clientData.Type != typ {
+		return fmt.Errorf("devicecredential: unexpected client data type: %s", clientData.Type)
+	}
+	if clientData.Challenge != challenge {
+		return errors.New("devicecredential: unexpected challenge")
+	}
+	if clientData.Origin != rp.Origin {
+		return fmt.Errorf("devicecredential: unexpected origin: %s", clientData.Origin)
+	}
+	return nil
+}
+
+func verifyAuthenticatorData(rp RelyingParty, authenticatorData []byte) (signCount uint32, err error) {
+	if len(authenticatorData) < 37 {
+		return 0, errors.New("devicecredential: invalid authenticator data")
+	}
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authenticatorData[:32], rpIDHash[:]) {
+		return 0, errors.New("devicecredential: unexpected relying party")
+	}
+	if authenticatorData[32]&flagUserPresent == 0 {
+		return 0, errors.New("devicecredential: user not present")
+	}
+	return binary.BigEndian.Uint32(authenticatorData[33:37]), nil
+}
+
+func parsePublicKey(der []byte) (crypto.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("devicecredential: invalid public key: %w", err)
+	}
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return pub, nil
+	}
+	return nil, fmt.Errorf("devicecredential: unsupported public key type: %T", pub)
+}
+
+func verifySignature(pub crypto.PublicKey, signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(pub, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, signed, signature)
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package devicecredential
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAuthenticator is a software WebAuthn authenticator.
+type testAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	signCount uint32
+}
+
+func (a *testAuthenticator) authenticatorData(rpID string) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flagUserPresent, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:], a.signCount)
+	return data
+}
+
+func clientData(typ, challenge, origin string) []byte {
+	bs, _ := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": origin})
+	return bs
+}
+
+func (a *testAuthenticator) sign(t *testing.T, authenticatorData, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authenticatorData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+	return sig
+}
+
+func TestChallenge(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Now()
+	challenge := NewChallenge(key, "SESSION_ID", "register", now)
+	assert.NotEqual(t, challenge, NewChallenge(key, "SESSION_ID", "register", now))
+	assert.NoError(t, VerifyChallenge(key, challenge, "SESSION_ID", "register", now))
+	assert.Error(t, VerifyChallenge(key, challenge, "OTHER_SESSION_ID", "register", now))
+	assert.Error(t, VerifyChallenge(key, challenge, "SESSION_ID", "verify", now))
+	assert.Error(t, VerifyChallenge(key, challenge, "SESSION_ID", "register", now.Add(ChallengeTTL)))
+	assert.Error(t, VerifyChallenge([]byte("other key"), challenge, "SESSION_ID", "register", now))
+	assert.Error(t, VerifyChallenge(key, "invalid", "SESSION_ID", "register", now))
+}
+
+func TestWebAuthn(t *testing.T) {
+	rp := RelyingParty{ID: "authenticate.example.com", Origin: "https://authenticate.example.com"}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	a := &testAuthenticator{key: key}
+
+	t.Run("registration", func(t *testing.T) {
+		authenticatorData := a.authenticatorData(rp.ID)
+		_, err := VerifyRegistration(rp, "CHALLENGE",
+			clientData("webauthn.create", "CHALLENGE", rp.Origin), authenticatorData, publicKey)
+		assert.NoError(t, err)
+
+		for _, tc := range []struct {
+			name                                         string
+			clientDataJSON, authenticatorData, publicKey []byte
+		}{
+			{"wrong type", clientData("webauthn.get", "CHALLENGE", rp.Origin), authenticatorData, publicKey},
+			{"wrong challenge", clientData("webauthn.create", "OTHER_CHALLENGE", rp.Origin), authenticatorData, publicKey},
+			{"wrong origin", clientData("webauthn.create", "CHALLENGE", "https://evil.example.com"), authenticatorData, publicKey},
+			{"wrong relying party", clientData("webauthn.create", "CHALLENGE", rp.Origin), a.authenticatorData("evil.example.com"), publicKey},
+			{"invalid public key", clientData("webauthn.create", "CHALLENGE", rp.Origin), authenticatorData, []byte("invalid")},
+		} {
+			_, err := VerifyRegistration(rp, "CHALLENGE", tc.clientDataJSON, tc.authenticatorData, tc.publicKey)
+			assert.Error(t, err, tc.name)
+		}
+	})
+	t.Run("assertion", func(t *testing.T) {
+		c := &Credential{PublicKey: publicKey, SignCount: 1}
+
+		a.signCount = 2
+		authenticatorData := a.authenticatorData(rp.ID)
+		clientDataJSON := clientData("webauthn.get", "CHALLENGE", rp.Origin)
+		signature := a.sign(t, authenticatorData, clientDataJSON)
+		signCount, err := VerifyAssertion(rp, "CHALLENGE", c, clientDataJSON, authenticatorData, signature)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2), signCount)
+
+		_, err = VerifyAssertion(rp, "OTHER_CHALLENGE", c, clientDataJSON, authenticatorData, signature)
+		assert.Error(t, err)
+		tampered := []byte(strings.Replace(string(clientDataJSON), "}", `,"crossOrigin":true}`, 1))
+		_, err = VerifyAssertion(rp, "CHALLENGE", c, tampered, authenticatorData, signature)
+		assert.Error(t, err, "signature should cover the client data")
+
+		c.SignCount = 2
+		_, err = VerifyAssertion(rp, "CHALLENGE", c, clientDataJSON, authenticatorData, signature)
+		assert.Error(t, err, "signature counter should increase")
+
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		c.SignCount = 0
+		_, err = VerifyAssertion(rp, "CHALLENGE", c, clientDataJSON, authenticatorData,
+			(&testAuthenticator{key: other}).sign(t, authenticatorData, clientDataJSON))
+		assert.Error(t, err)
+	})
+}
+
+func TestCredential(t *testing.T) {
+	c := &Credential{
+		ID:        ID("RAW_ID"),
+		UserID:    "USER_ID",
+		Name:      "laptop",
+		RawID:     "RAW_ID",
+		PublicKey: []byte{1, 2, 3},
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	record, err := c.ToRecord()
+	require.NoError(t, err)
+	assert.Equal(t, RecordType, record.GetType())
+	assert.Equal(t, c.ID, record.GetId())
+	decoded, err := FromRecord(record)
+	require.NoError(t, err)
+	assert.Equal(t, c, decoded)
+
+	s := &Session{SessionID: "SESSION_ID", CredentialID: c.ID}
+	record, err = s.ToRecord()
+	require.NoError(t, err)
+	assert.Equal(t, SessionRecordType, record.GetType())
+	assert.Equal(t, "SESSION_ID", record.GetId())
+}
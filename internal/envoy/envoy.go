@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -43,8 +44,10 @@ const (
 )
 
 type serverOptions struct {
-	services string
-	logLevel string
+	services         string
+	logLevel         string
+	spireAgentSocket string
+	drainTimeout     time.Duration
 }
 
 // A Server is a pomerium proxy implemented via envoy.
@@ -144,8 +147,10 @@ func (srv *Server) update(ctx context.Context, cfg *config.Config) {
 	defer srv.mu.Unlock()
 
 	options := serverOptions{
-		services: cfg.Options.Services,
-		logLevel: firstNonEmpty(cfg.Options.ProxyLogLevel, cfg.Options.LogLevel, "debug"),
+		services:         cfg.Options.Services,
+		logLevel:         firstNonEmpty(cfg.Options.ProxyLogLevel, cfg.Options.LogLevel, "debug"),
+		spireAgentSocket: cfg.Options.SPIREAgentSocket,
+		drainTimeout:     cfg.Options.DrainTimeout,
 	}
 
 	if cmp.Equal(srv.options, options, cmp.AllowUnexported(serverOptions{})) {
@@ -175,6 +180,8 @@ func (srv *Server) run(ctx context.Context, cfg *config.Config) error {
 		"--log-level", srv.options.logLevel,
 		"--log-format", "[LOG_FORMAT]%l--%n--%v",
 		"--log-format-escaped",
+		// listeners replaced by a config change are drained for the drain timeout
+		"--drain-time-s", strconv.Itoa(int(math.Ceil(srv.options.drainTimeout.Seconds()))),
 	}
 
 	exePath, args := srv.prepareRunEnvoyCommand(ctx, args)
@@ -260,7 +267,7 @@ func (srv *Server) buildBootstrapConfig(cfg *config.Config) ([]byte, error) {
 		},
 	}
 
-	staticCfg, err := srv.builder.BuildBootstrapStaticResources()
+	staticCfg, err := srv.builder.BuildBootstrapStaticResources(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -283,6 +290,9 @@ func (srv *Server) buildBootstrapConfig(cfg *config.Config) ([]byte, error) {
 		StatsConfig:      statsCfg,
 		LayeredRuntime:   layeredRuntimeCfg,
 	}
+	if cfg.Options.EnvoyOverrides != nil && cfg.Options.EnvoyOverrides.Bootstrap != nil {
+		proto.Merge(bootstrapCfg, cfg.Options.EnvoyOverrides.Bootstrap)
+	}
 
 	jsonBytes, err := protojson.Marshal(proto.MessageV2(bootstrapCfg))
 	if err != nil {
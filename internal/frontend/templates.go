@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -22,6 +23,16 @@ var FS embed.FS
 
 // NewTemplates loads pomerium's templates. Panics on failure.
 func NewTemplates() (*template.Template, error) {
+	return NewThemedTemplates(nil)
+}
+
+// NewThemedTemplates loads pomerium's templates with a theme. Templates in the theme's templates directory
+// override the built-in templates of the same name.
+func NewThemedTemplates(theme *Theme) (*template.Template, error) {
+	if theme == nil {
+		theme = new(Theme)
+	}
+
 	assetsFS, err := fs.Sub(FS, "assets")
 	if err != nil {
 		return nil, err
@@ -68,6 +79,10 @@ func NewTemplates() (*template.Template, error) {
 		"formatTime": func(tm time.Time) string {
 			return tm.Format("2006-01-02 15:04:05 MST")
 		},
+		"theme": func() *Theme {
+			return theme
+		},
+		"themeStyleURL": theme.styleURL,
 	})
 
 	err = fs.WalkDir(assetsFS, "html", func(p string, d os.DirEntry, err error) error {
@@ -92,9 +107,40 @@ func NewTemplates() (*template.Template, error) {
 		return nil, err
 	}
 
+	if theme.TemplatesDirectory != "" {
+		err = parseTemplatesDirectory(t, theme.TemplatesDirectory)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return t, nil
 }
 
+func parseTemplatesDirectory(t *template.Template, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("internal/frontend: error reading templates directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".html" {
+			continue
+		}
+
+		p := filepath.Join(dir, entry.Name())
+		bs, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("internal/frontend: error reading %s: %w", p, err)
+		}
+
+		_, err = t.Parse(string(bs))
+		if err != nil {
+			return fmt.Errorf("internal/frontend: error parsing template %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
 // MustAssetHandler wraps a call to the embedded static file system and panics
 // if the error is non-nil. It is intended for use in variable initializations
 func MustAssetHandler() http.Handler {
@@ -2,6 +2,9 @@ package frontend
 
 import (
 	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -22,3 +25,63 @@ func TestNewTemplates(t *testing.T) {
 <link rel="icon" type="image/png" href="data:image/svg&#43;xml;base64,PHN2ZyBpZD0iTGF5ZXJfMSIgZGF0YS1uYW1lPSJMYXllciAxIiB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciIHZpZXdCb3g9IjAgMCAyNjEuMTUgMTI0LjczIj48dGl0bGU&#43;bG9nby1vbmx5PC90aXRsZT48cGF0aCBkPSJNNzQyLjc2LDE2Mi44MmEyNC4zNiwyNC4zNiwwLDAsMC0yNC4zNi0yNC4zNkg1MDZhMjQuMzYsMjQuMzYsMCwwLDAtMjQuMzYsMjQuMzZWMjYzLjE5aDE2Ljgzdi0yOGgwYTM0LjExLDM0LjExLDAsMSwxLDY4LjIxLDBoMHYyOGgxMi4xOHYtMjhoMGEzNC4xMSwzNC4xMSwwLDEsMSw2OC4yMSwwaDB2MjhoMTIuMTh2LTI4aDBhMzQuMSwzNC4xLDAsMSwxLDY4LjIsMGgwdjI4aDE1LjMzWk00OTguNDQsMTg4LjEzYTM0LjExLDM0LjExLDAsMSwxLDY4LjIxLDBabTgwLjM5LDBhMzQuMTEsMzQuMTEsMCwxLDEsNjguMjEsMFptODAuMzksMGEzNC4xMSwzNC4xMSwwLDEsMSw2OC4yMSwwWiIgdHJhbnNmb3JtPSJ0cmFuc2xhdGUoLTQ4MS42MSAtMTM4LjQ2KSIvPjwvc3ZnPgo=" />
 `, buf.String())
 }
+
+func TestNewThemedTemplates(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "error.html"), []byte(`{{define "error.html"}}custom {{.Status}}{{end}}`), 0o600)
+	require.NoError(t, err)
+
+	tpl, err := NewThemedTemplates(&Theme{
+		LogoURL:            "https://example.com/logo.png",
+		FaviconURL:         "https://example.com/favicon.ico",
+		PrimaryColor:       "#ff0000",
+		BackgroundColor:    "#ffffff",
+		FooterLinks:        []Link{{Title: "Help", URL: "https://help.example.com"}},
+		TemplatesDirectory: dir,
+	})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = tpl.ExecuteTemplate(&buf, "header.html", nil)
+	require.NoError(t, err)
+	css := ".custom-logo img { max-height: 40px; }\n" +
+		"a, .header span, table thead tr th { color: #ff0000; }\n" +
+		"input, button, a.button { background: #ff0000; }\n" +
+		"html, div.category-link, table tbody tr:nth-child(2n + 1) td { background: #ffffff; }\n"
+	assert.Contains(t, buf.String(), `<link rel="stylesheet" type="text/css" href="data:text/css;base64,`+
+		base64.StdEncoding.EncodeToString([]byte(css))+`"/>`, "should not use an inline style, which the CSP blocks")
+	assert.Contains(t, buf.String(), `<link rel="icon" href="https://example.com/favicon.ico" />`)
+
+	buf.Reset()
+	err = tpl.ExecuteTemplate(&buf, "footer.html", nil)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `<li><a href="https://help.example.com">Help</a></li>`)
+	assert.NotContains(t, buf.String(), "Pomerium, Inc.")
+
+	buf.Reset()
+	err = tpl.ExecuteTemplate(&buf, "error.html", map[string]interface{}{"Status": 403})
+	require.NoError(t, err)
+	assert.Equal(t, "custom 403", buf.String())
+
+	_, err = NewThemedTemplates(&Theme{TemplatesDirectory: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestSetTheme(t *testing.T) {
+	defer func() { _ = SetTheme(nil) }()
+
+	err := SetTheme(&Theme{FooterLinks: []Link{{Title: "Help", URL: "https://help.example.com"}}})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = Templates().ExecuteTemplate(&buf, "footer.html", nil)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "Help")
+
+	err = SetTheme(&Theme{TemplatesDirectory: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+	buf.Reset()
+	err = Templates().ExecuteTemplate(&buf, "footer.html", nil)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "Help", "should keep the previous theme on error")
+}
@@ -0,0 +1,72 @@
+package frontend
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync/atomic"
+)
+
+// A Theme customizes the pages served by pomerium.
+type Theme struct {
+	// LogoURL is the URL of the logo, which may be a data URL.
+	LogoURL string
+	// FaviconURL is the URL of the favicon, which may be a data URL.
+	FaviconURL string
+	// PrimaryColor is the color of links and buttons.
+	PrimaryColor string
+	// BackgroundColor is the color of the page background.
+	BackgroundColor string
+	// FooterLinks replace the links in the footer.
+	FooterLinks []Link
+	// TemplatesDirectory is a directory of templates which override the built-in templates.
+	TemplatesDirectory string
+}
+
+// A Link is a link in the footer of a page.
+type Link struct {
+	Title string
+	URL   string
+}
+
+// styleURL returns a data URL of the theme's stylesheet, or an empty URL if it has no styles. The stylesheet
+// is a data URL since the content security policy of the authenticate service doesn't allow inline styles.
+func (theme *Theme) styleURL() template.URL {
+	var b strings.Builder
+	if theme.LogoURL != "" {
+		b.WriteString(".custom-logo img { max-height: 40px; }\n")
+	}
+	if c := theme.PrimaryColor; c != "" {
+		fmt.Fprintf(&b, "a, .header span, table thead tr th { color: %s; }\n", c)
+		fmt.Fprintf(&b, "input, button, a.button { background: %s; }\n", c)
+	}
+	if c := theme.BackgroundColor; c != "" {
+		fmt.Fprintf(&b, "html, div.category-link, table tbody tr:nth-child(2n + 1) td { background: %s; }\n", c)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return template.URL("data:text/css;base64," + base64.StdEncoding.EncodeToString([]byte(b.String())))
+}
+
+var currentTemplates atomic.Value
+
+func init() {
+	currentTemplates.Store(template.Must(NewTemplates()))
+}
+
+// SetTheme sets the theme of the templates returned by Templates. The templates are unchanged on error.
+func SetTheme(theme *Theme) error {
+	t, err := NewThemedTemplates(theme)
+	if err != nil {
+		return err
+	}
+	currentTemplates.Store(t)
+	return nil
+}
+
+// Templates returns pomerium's templates with the current theme.
+func Templates() *template.Template {
+	return currentTemplates.Load().(*template.Template)
+}
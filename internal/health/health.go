@@ -0,0 +1,210 @@
+// Package health tracks the status of the dependencies of pomerium, such as the databroker and the
+// identity provider, so that they can be reported by the health and readiness endpoints.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+)
+
+// Dependency names.
+const (
+	Authorize        = "authorize"
+	DataBroker       = "databroker"
+	IdentityProvider = "identity_provider"
+	Certificates     = "certificates"
+	DirectorySync    = "directory_sync"
+)
+
+// Statuses of a dependency.
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+)
+
+// A Report is the status of a dependency.
+type Report struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// OK returns true if the dependency is not degraded.
+func (r Report) OK() bool {
+	return r.Status != StatusDegraded
+}
+
+// A Checker checks the status of a dependency when a Probe is run. It returns nil if the dependency is ok.
+type Checker func(ctx context.Context) error
+
+var registry = struct {
+	sync.Mutex
+	reports map[string]*Report
+}{
+	reports: map[string]*Report{},
+}
+
+// ReportOK records that a dependency is ok.
+func ReportOK(name string) {
+	now := time.Now()
+
+	registry.Lock()
+	registry.reports[name] = &Report{
+		Name:        name,
+		Status:      StatusOK,
+		LastSuccess: &now,
+		UpdatedAt:   now,
+	}
+	registry.Unlock()
+}
+
+// ReportError records that a dependency is degraded. The time of the last success is kept.
+func ReportError(name string, err error) {
+	now := time.Now()
+
+	registry.Lock()
+	r := &Report{
+		Name:      name,
+		Status:    StatusDegraded,
+		Error:     err.Error(),
+		UpdatedAt: now,
+	}
+	if prev, ok := registry.reports[name]; ok {
+		r.LastSuccess = prev.LastSuccess
+	}
+	registry.reports[name] = r
+	registry.Unlock()
+}
+
+// Reports returns the most recent report for every dependency, sorted by name.
+func Reports() []Report {
+	registry.Lock()
+	defer registry.Unlock()
+
+	reports := make([]Report, 0, len(registry.reports))
+	for _, r := range registry.reports {
+		reports = append(reports, *r)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Name < reports[j].Name
+	})
+	return reports
+}
+
+// A Response is the JSON body returned by the health endpoints. The dependencies are only included by
+// the detailed readiness endpoint.
+type Response struct {
+	Status       string   `json:"status"`
+	Dependencies []Report `json:"dependencies,omitempty"`
+}
+
+// A Probe runs checkers, and records their statuses, at most once per interval however often it's
+// requested, so that requests to the readiness endpoints don't each check every dependency.
+type Probe struct {
+	checkers map[string]Checker
+	interval time.Duration
+	timeout  time.Duration
+
+	group singleflight.Group
+
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+// NewProbe creates a new Probe. The checkers are given up to the timeout to complete.
+func NewProbe(checkers map[string]Checker, interval, timeout time.Duration) *Probe {
+	return &Probe{
+		checkers: checkers,
+		interval: interval,
+		timeout:  timeout,
+	}
+}
+
+// Run runs the checkers, unless they were run within the interval. Concurrent calls share a single run,
+// which isn't canceled by the context of any caller.
+func (p *Probe) Run(ctx context.Context) {
+	if p == nil || len(p.checkers) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	fresh := !p.lastRun.IsZero() && time.Since(p.lastRun) < p.interval
+	p.mu.Unlock()
+	if fresh {
+		return
+	}
+
+	ch := p.group.DoChan("", func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		defer cancel()
+
+		for name, check := range p.checkers {
+			if err := check(ctx); err != nil {
+				ReportError(name, err)
+			} else {
+				ReportOK(name)
+			}
+		}
+
+		p.mu.Lock()
+		p.lastRun = time.Now()
+		p.mu.Unlock()
+		return nil, nil
+	})
+	select {
+	case <-ctx.Done():
+	case <-ch:
+	}
+}
+
+// LivenessHandler returns an http.Handler which reports that the process is serving requests. It
+// doesn't depend on the status of any dependency.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		httputil.RenderJSON(w, http.StatusOK, Response{Status: StatusOK})
+	})
+}
+
+// ReadinessHandler returns an http.Handler which reports the status of every dependency, after running
+// the probe. If any dependency is degraded a 503 is returned. The status of each dependency, including
+// its errors, is only returned if details is true.
+func ReadinessHandler(probe *Probe, details bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		probe.Run(r.Context())
+
+		reports := Reports()
+		res := Response{Status: StatusOK}
+		for _, dep := range reports {
+			if !dep.OK() {
+				res.Status = StatusDegraded
+			}
+		}
+		if details {
+			res.Dependencies = reports
+		}
+
+		code := http.StatusOK
+		if res.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+		httputil.RenderJSON(w, code, res)
+	})
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	getReport := func(t *testing.T, res Response, name string) Report {
+		for _, r := range res.Dependencies {
+			if r.Name == name {
+				return r
+			}
+		}
+		t.Fatalf("missing report for %s", name)
+		return Report{}
+	}
+	serve := func(t *testing.T, checkers map[string]Checker) (int, Response) {
+		w := httptest.NewRecorder()
+		ReadinessHandler(NewProbe(checkers, time.Minute, time.Second), true).
+			ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+		var res Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return w.Code, res
+	}
+
+	registry.Lock()
+	registry.reports = map[string]*Report{}
+	registry.Unlock()
+
+	ReportOK(DataBroker)
+	code, res := serve(t, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, res.Status)
+	assert.Equal(t, StatusOK, getReport(t, res, DataBroker).Status)
+
+	ReportError(DataBroker, errors.New("connection refused"))
+	code, res = serve(t, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDegraded, res.Status)
+	report := getReport(t, res, DataBroker)
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, "connection refused", report.Error)
+	assert.NotNil(t, report.LastSuccess, "should keep the time of the last success")
+
+	ReportOK(DataBroker)
+	code, res = serve(t, map[string]Checker{
+		IdentityProvider: func(ctx context.Context) error {
+			return errors.New("timeout")
+		},
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDegraded, getReport(t, res, IdentityProvider).Status)
+	assert.Equal(t, StatusOK, getReport(t, res, DataBroker).Status)
+
+	t.Run("without details", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ReadinessHandler(nil, false).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.JSONEq(t, `{"status":"degraded"}`, w.Body.String())
+	})
+	t.Run("liveness", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		LivenessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, http.StatusOK, w.Code, "should not depend on the status of dependencies")
+		assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+	})
+	t.Run("method not allowed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ReadinessHandler(nil, true).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/readyz", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
+
+func TestProbe(t *testing.T) {
+	var calls int32
+	probe := NewProbe(map[string]Checker{
+		Certificates: func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		},
+	}, time.Minute, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	probe.Run(ctx)
+	assert.Eventually(t, func() bool {
+		probe.mu.Lock()
+		defer probe.mu.Unlock()
+		return !probe.lastRun.IsZero()
+	}, time.Second, time.Millisecond, "should run even if the caller's context is canceled")
+
+	for i := 0; i < 10; i++ {
+		probe.Run(context.Background())
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "should only run once per interval")
+}
@@ -1,7 +1,7 @@
 package httputil
 
 import (
-	"html/template"
+	"bytes"
 	"net/http"
 	"net/url"
 
@@ -9,16 +9,20 @@ import (
 	"github.com/pomerium/pomerium/internal/telemetry/requestid"
 )
 
-var errorTemplate = template.Must(frontend.NewTemplates())
-
 // HTTPError contains an HTTP status code and wrapped error.
 type HTTPError struct {
 	// HTTP status codes as registered with IANA.
 	Status int
 	// Err is the wrapped error.
 	Err error
+	// Code identifies the kind of error. Defaults to the code of the status.
+	Code ErrorCode
+	// RemediationURL is the URL of a page which helps to resolve the error. Defaults to the access request URL.
+	RemediationURL *url.URL
 	// DebugURL is the URL to the debug endpoint.
 	DebugURL *url.URL
+	// AccessRequestURL is the URL to request access to the route, for routes which accept access requests.
+	AccessRequestURL *url.URL
 	// The request ID.
 	RequestID string
 }
@@ -36,39 +40,84 @@ func (e *HTTPError) Error() string {
 // Unwrap implements the `error` Unwrap interface.
 func (e *HTTPError) Unwrap() error { return e.Err }
 
+// GetCode returns the error code, which defaults to the code of the status.
+func (e *HTTPError) GetCode() ErrorCode {
+	if e.Code == "" {
+		return ErrorCodeForStatus(e.Status)
+	}
+	return e.Code
+}
+
+// GetRemediationURL returns the URL of a page which helps to resolve the error, or nil if there is none.
+func (e *HTTPError) GetRemediationURL() *url.URL {
+	if e.RemediationURL == nil {
+		return e.AccessRequestURL
+	}
+	return e.RemediationURL
+}
+
+type errorResponse struct {
+	Status           int
+	Error            string
+	StatusText       string    `json:"-"`
+	Code             ErrorCode `json:"-"`
+	RemediationURL   *url.URL  `json:"-"`
+	RequestID        string    `json:",omitempty"`
+	CanDebug         bool      `json:"-"`
+	Version          string    `json:"-"`
+	DebugURL         *url.URL  `json:",omitempty"`
+	AccessRequestURL *url.URL  `json:",omitempty"`
+}
+
+func (e *HTTPError) response(reqID string) errorResponse {
+	return errorResponse{
+		Status:           e.Status,
+		StatusText:       http.StatusText(e.Status),
+		Error:            e.Error(),
+		Code:             e.GetCode(),
+		RemediationURL:   e.GetRemediationURL(),
+		RequestID:        reqID,
+		CanDebug:         e.Status/100 == 4 && (e.DebugURL != nil || reqID != ""),
+		DebugURL:         e.DebugURL,
+		AccessRequestURL: e.AccessRequestURL,
+	}
+}
+
 // ErrorResponse replies to the request with the specified error message and HTTP code.
 // It does not otherwise end the request; the caller should ensure no further
 // writes are done to w.
+//
+// Clients which accept application/problem+json are sent RFC 7807 problem details, clients which
+// only accept application/json the legacy JSON error, and browsers the error page.
 func (e *HTTPError) ErrorResponse(w http.ResponseWriter, r *http.Request) {
 	reqID := e.RequestID
 	if e.RequestID == "" {
 		// if empty, try to grab from the request id from the request context
 		reqID = requestid.FromContext(r.Context())
 	}
-	response := struct {
-		Status     int
-		Error      string
-		StatusText string   `json:"-"`
-		RequestID  string   `json:",omitempty"`
-		CanDebug   bool     `json:"-"`
-		Version    string   `json:"-"`
-		DebugURL   *url.URL `json:",omitempty"`
-	}{
-		Status:     e.Status,
-		StatusText: http.StatusText(e.Status),
-		Error:      e.Error(),
-		RequestID:  reqID,
-		CanDebug:   e.Status/100 == 4 && (e.DebugURL != nil || reqID != ""),
-		DebugURL:   e.DebugURL,
-	}
+	response := e.response(reqID)
 	// indicate to clients that the error originates from Pomerium, not the app
 	w.Header().Set(HeaderPomeriumResponse, "true")
 
+	if acceptsProblemJSON(r) {
+		renderProblemJSON(w, e.problemDetails(reqID))
+		return
+	}
 	if r.Header.Get("Accept") == "application/json" {
 		RenderJSON(w, e.Status, response)
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
 	w.WriteHeader(e.Status)
-	errorTemplate.ExecuteTemplate(w, "error.html", response)
+	frontend.Templates().ExecuteTemplate(w, "error.html", response)
+}
+
+// RenderHTML renders the HTML error page for the error. It's used for pages which envoy serves
+// without making a request to pomerium.
+func (e *HTTPError) RenderHTML() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := frontend.Templates().ExecuteTemplate(&buf, "error.html", e.response(e.RequestID)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestHTTPError_ErrorResponse(t *testing.T) {
@@ -70,3 +72,37 @@ func TestNewError(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPError_ErrorResponse_problemJSON(t *testing.T) {
+	remediationURL, _ := url.Parse("https://authenticate.example.com/.pomerium/sign_in")
+	e := &HTTPError{
+		Status:         http.StatusUnauthorized,
+		Err:            errors.New("sign in required"),
+		RemediationURL: remediationURL,
+		RequestID:      "REQUEST_ID",
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/problem+json; q=0.9, text/html; q=0.5")
+	w := httptest.NewRecorder()
+	e.ErrorResponse(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, ContentTypeProblemJSON, w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"type": "urn:pomerium:error:unauthenticated",
+		"title": "Unauthorized",
+		"status": 401,
+		"detail": "sign in required",
+		"code": "unauthenticated",
+		"request_id": "REQUEST_ID",
+		"remediation_url": "https://authenticate.example.com/.pomerium/sign_in"
+	}`, w.Body.String())
+}
+
+func TestHTTPError_GetCode(t *testing.T) {
+	assert.Equal(t, ErrorCodeForbidden, (&HTTPError{Status: http.StatusForbidden}).GetCode())
+	assert.Equal(t, ErrorCodeInvalidClientCertificate, (&HTTPError{Status: StatusInvalidClientCertificate}).GetCode())
+	assert.Equal(t, ErrorCodeError, (&HTTPError{Status: http.StatusTeapot}).GetCode())
+	assert.Equal(t, ErrorCodeTenantMismatch, (&HTTPError{Status: http.StatusForbidden, Code: ErrorCodeTenantMismatch}).GetCode())
+}
@@ -0,0 +1,110 @@
+package httputil
+
+import (
+	"net"
+	"strings"
+)
+
+// A ForwardedElement is one hop of an RFC 7239 Forwarded header.
+type ForwardedElement struct {
+	By    string
+	For   string
+	Host  string
+	Proto string
+}
+
+// ForIP returns the IP address of the for parameter, or nil if it's obfuscated or unknown.
+func (e ForwardedElement) ForIP() net.IP {
+	return ParseNodeIP(e.For)
+}
+
+// ParseForwarded parses the value of a Forwarded header. Elements are returned in the order they were added
+// by proxies, so the first element describes the client-facing request. Malformed parameters are ignored.
+//
+// https://tools.ietf.org/html/rfc7239
+func ParseForwarded(value string) []ForwardedElement {
+	var elements []ForwardedElement
+	for _, rawElement := range splitQuoted(value, ',') {
+		var element ForwardedElement
+		for _, pair := range splitQuoted(rawElement, ';') {
+			idx := strings.IndexByte(pair, '=')
+			if idx < 0 {
+				continue
+			}
+			k, v := strings.ToLower(strings.TrimSpace(pair[:idx])), unquote(strings.TrimSpace(pair[idx+1:]))
+			switch k {
+			case "by":
+				element.By = v
+			case "for":
+				element.For = v
+			case "host":
+				element.Host = v
+			case "proto":
+				element.Proto = strings.ToLower(v)
+			}
+		}
+		elements = append(elements, element)
+	}
+	return elements
+}
+
+// ParseNodeIP parses the IP address of a node, as found in the X-Forwarded-For header or the for parameter
+// of the Forwarded header. The node may include a port, and IPv6 addresses may be in brackets.
+func ParseNodeIP(node string) net.IP {
+	node = strings.TrimSpace(node)
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	return net.ParseIP(node)
+}
+
+// FirstHeaderValue returns the first of the comma-separated values of a header which proxies append to,
+// such as X-Forwarded-Proto.
+func FirstHeaderValue(value string) string {
+	if idx := strings.IndexByte(value, ','); idx >= 0 {
+		value = value[:idx]
+	}
+	return strings.TrimSpace(value)
+}
+
+// splitQuoted splits s on sep, ignoring separators within quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	inQuotes, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuotes && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && s[i] == sep:
+			if part := strings.TrimSpace(s[start:i]); part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+	if part := strings.TrimSpace(s[start:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// unquote removes the quotes and escapes of a quoted string.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
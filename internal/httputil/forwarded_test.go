@@ -0,0 +1,49 @@
+package httputil
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseForwarded(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []ForwardedElement{
+		{For: "192.0.2.60", Proto: "http", By: "203.0.113.43"},
+		{For: "[2001:db8:cafe::17]:4711", Host: "example.com"},
+		{For: "unknown"},
+	}, ParseForwarded(`for=192.0.2.60;Proto=HTTP;by=203.0.113.43, For="[2001:db8:cafe::17]:4711";host="example.com",for=unknown`))
+	assert.Equal(t, []ForwardedElement{
+		{Host: `a,b;"c`},
+	}, ParseForwarded(`host="a,b;\"c"`))
+	assert.Empty(t, ParseForwarded(""))
+}
+
+func TestParseNodeIP(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		node   string
+		expect net.IP
+	}{
+		{"192.0.2.43", net.ParseIP("192.0.2.43")},
+		{" 192.0.2.43:47011", net.ParseIP("192.0.2.43")},
+		{"2001:db8:cafe::17", net.ParseIP("2001:db8:cafe::17")},
+		{"[2001:db8:cafe::17]", net.ParseIP("2001:db8:cafe::17")},
+		{"[2001:db8:cafe::17]:4711", net.ParseIP("2001:db8:cafe::17")},
+		{"_hidden", nil},
+		{"unknown", nil},
+	} {
+		assert.Equal(t, tc.expect, ParseNodeIP(tc.node), tc.node)
+	}
+}
+
+func TestFirstHeaderValue(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "https", FirstHeaderValue("https"))
+	assert.Equal(t, "https", FirstHeaderValue(" https , http"))
+	assert.Equal(t, "", FirstHeaderValue(""))
+}
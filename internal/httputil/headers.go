@@ -21,6 +21,8 @@ const (
 	HeaderPomeriumJWTAssertion = "x-pomerium-jwt-assertion"
 	// HeaderPomeriumJWTAssertionFor carries over original user identity from a chain of network calls.
 	HeaderPomeriumJWTAssertionFor = "x-pomerium-jwt-assertion-for"
+	// HeaderPomeriumSubdomain is the header key containing the subdomain matched by a wildcard route.
+	HeaderPomeriumSubdomain = "x-pomerium-subdomain"
 	// HeaderPomeriumReproxyPolicy is the header key containing the policy to reproxy a request to.
 	HeaderPomeriumReproxyPolicy = "x-pomerium-reproxy-policy"
 	// HeaderPomeriumReproxyPolicyHMAC is an HMAC of the HeaderPomeriumReproxyPolicy header.
@@ -42,9 +44,10 @@ var HeadersContentSecurityPolicy = map[string]string{
 // https://tools.ietf.org/html/rfc7239
 // https://en.wikipedia.org/wiki/X-Forwarded-For
 const (
+	HeaderForwarded       = "Forwarded"
 	HeaderForwardedFor    = "X-Forwarded-For"
 	HeaderForwardedHost   = "X-Forwarded-Host"
-	HeaderForwardedMethod = "X-Forwarded-Method" // traefik
+	HeaderForwardedMethod = "X-Forwarded-Method" // traefik, caddy
 	HeaderForwardedPort   = "X-Forwarded-Port"
 	HeaderForwardedProto  = "X-Forwarded-Proto"
 	HeaderForwardedServer = "X-Forwarded-Server"
@@ -62,6 +65,7 @@ const (
 // https://tools.ietf.org/html/rfc7239
 // https://en.wikipedia.org/wiki/X-Forwarded-For
 var HeadersXForwarded = []string{
+	HeaderForwarded,
 	HeaderForwardedFor,
 	HeaderForwardedHost,
 	HeaderForwardedMethod,
@@ -0,0 +1,129 @@
+package httputil
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ContentTypeProblemJSON is the content type of problem details.
+//
+// https://tools.ietf.org/html/rfc7807
+const ContentTypeProblemJSON = "application/problem+json"
+
+// An ErrorCode identifies the kind of an error returned by pomerium, so that clients and log aggregation can
+// tell errors apart without parsing their messages.
+type ErrorCode string
+
+// Error codes.
+const (
+	ErrorCodeError                    ErrorCode = "error"
+	ErrorCodeBadRequest               ErrorCode = "bad_request"
+	ErrorCodeUnauthenticated          ErrorCode = "unauthenticated"
+	ErrorCodeForbidden                ErrorCode = "forbidden"
+	ErrorCodeNotFound                 ErrorCode = "not_found"
+	ErrorCodeRouteNotFound            ErrorCode = "route_not_found"
+	ErrorCodeTooManyRequests          ErrorCode = "too_many_requests"
+	ErrorCodeInvalidClientCertificate ErrorCode = "invalid_client_certificate"
+	ErrorCodeInvalidClientCredentials ErrorCode = "invalid_client_credentials"
+	ErrorCodeInvalidAPIKey            ErrorCode = "invalid_api_key"
+	ErrorCodeInvalidSharedURL         ErrorCode = "invalid_shared_url"
+	ErrorCodeExternalAuthorizerDenied ErrorCode = "external_authorizer_denied"
+	ErrorCodeTenantMismatch           ErrorCode = "tenant_mismatch"
+	ErrorCodeMaintenance              ErrorCode = "maintenance"
+	ErrorCodeServiceUnavailable       ErrorCode = "service_unavailable"
+)
+
+// ErrorCodeForStatus returns the error code of errors with the given status which don't have a more specific
+// one.
+func ErrorCodeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorCodeBadRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthenticated
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusTooManyRequests:
+		return ErrorCodeTooManyRequests
+	case StatusInvalidClientCertificate:
+		return ErrorCodeInvalidClientCertificate
+	case http.StatusServiceUnavailable:
+		return ErrorCodeServiceUnavailable
+	}
+	return ErrorCodeError
+}
+
+// Type returns the problem type URI of the error code.
+func (code ErrorCode) Type() string {
+	return "urn:pomerium:error:" + string(code)
+}
+
+// problemDetails is the RFC 7807 representation of an HTTPError. The fields after detail are extension members.
+type problemDetails struct {
+	Type             string    `json:"type"`
+	Title            string    `json:"title"`
+	Status           int       `json:"status"`
+	Detail           string    `json:"detail,omitempty"`
+	Code             ErrorCode `json:"code"`
+	RequestID        string    `json:"request_id,omitempty"`
+	RemediationURL   string    `json:"remediation_url,omitempty"`
+	DebugURL         string    `json:"debug_url,omitempty"`
+	AccessRequestURL string    `json:"access_request_url,omitempty"`
+}
+
+func (e *HTTPError) problemDetails(reqID string) problemDetails {
+	code := e.GetCode()
+	details := problemDetails{
+		Type:      code.Type(),
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Code:      code,
+		RequestID: reqID,
+	}
+	if details.Title == "" {
+		details.Title = StatusText(e.Status)
+	}
+	if e.Err != nil {
+		details.Detail = e.Err.Error()
+	}
+	if u := e.GetRemediationURL(); u != nil {
+		details.RemediationURL = u.String()
+	}
+	if e.DebugURL != nil {
+		details.DebugURL = e.DebugURL.String()
+	}
+	if e.AccessRequestURL != nil {
+		details.AccessRequestURL = e.AccessRequestURL.String()
+	}
+	return details
+}
+
+// acceptsProblemJSON returns whether the client accepts problem details.
+func acceptsProblemJSON(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(value, ",") {
+			if idx := strings.IndexByte(mediaRange, ';'); idx >= 0 {
+				mediaRange = mediaRange[:idx]
+			}
+			if strings.EqualFold(strings.TrimSpace(mediaRange), ContentTypeProblemJSON) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func renderProblemJSON(w http.ResponseWriter, details problemDetails) {
+	bs, err := json.Marshal(details)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeProblemJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(details.Status)
+	_, _ = w.Write(bs)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/pomerium/pomerium/internal/directory"
+	"github.com/pomerium/pomerium/internal/identity"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
@@ -23,6 +24,8 @@ type config struct {
 	groupRefreshTimeout           time.Duration
 	sessionRefreshGracePeriod     time.Duration
 	sessionRefreshCoolOffDuration time.Duration
+	claimsTransform               func(identity.FlattenedClaims)
+	idpOutageGracePeriod          time.Duration
 }
 
 func newConfig(options ...Option) *config {
@@ -89,6 +92,21 @@ func WithSessionRefreshCoolOffDuration(dur time.Duration) Option {
 	}
 }
 
+// WithClaimsTransform sets the transform applied to the claims of refreshed sessions.
+func WithClaimsTransform(transform func(identity.FlattenedClaims)) Option {
+	return func(cfg *config) {
+		cfg.claimsTransform = transform
+	}
+}
+
+// WithIdPOutageGracePeriod sets how long sessions are kept during an identity provider outage. Zero, the
+// default, deletes sessions which can't be refreshed.
+func WithIdPOutageGracePeriod(dur time.Duration) Option {
+	return func(cfg *config) {
+		cfg.idpOutageGracePeriod = dur
+	}
+}
+
 type atomicConfig struct {
 	value atomic.Value
 }
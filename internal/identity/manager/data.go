@@ -92,6 +92,13 @@ func (s Session) NextRefresh() time.Time {
 	return tm
 }
 
+// transformClaims replaces the claims of the session with the transformed claims.
+func (s *Session) transformClaims(transform func(identity.FlattenedClaims)) {
+	claims := identity.NewFlattenedClaimsFromPB(s.GetClaims())
+	transform(claims)
+	s.Claims = claims.ToPB()
+}
+
 // UnmarshalJSON unmarshals json data into the session object.
 func (s *Session) UnmarshalJSON(data []byte) error {
 	if s.Session == nil {
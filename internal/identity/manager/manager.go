@@ -5,6 +5,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"time"
 
 	"github.com/google/btree"
@@ -17,6 +19,7 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/internal/directory"
+	"github.com/pomerium/pomerium/internal/health"
 	"github.com/pomerium/pomerium/internal/identity/identity"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/scheduler"
@@ -58,6 +61,9 @@ type Manager struct {
 
 	directoryNextRefresh time.Time
 
+	// idpOutageSince is when the identity provider started failing, or zero if it's reachable.
+	idpOutageSince time.Time
+
 	dataBrokerSemaphore *semaphore.Weighted
 }
 
@@ -225,12 +231,15 @@ func (mgr *Manager) refreshDirectoryUserGroups(ctx context.Context) {
 			msg += "(https://www.pomerium.io/reference/#identity-provider-refresh-directory-settings)"
 		}
 		log.Warn(ctx).Err(err).Msg(msg)
+		health.ReportError(health.DirectorySync, err)
 		return
 	}
 
 	mgr.mergeGroups(ctx, directoryGroups)
 	mgr.mergeUsers(ctx, directoryUsers)
 
+	health.ReportOK(health.DirectorySync)
+
 	metrics.RecordIdentityManagerLastRefresh()
 }
 
@@ -398,6 +407,9 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 
 	expiry := s.GetExpiresAt().AsTime()
 	if !expiry.After(time.Now()) {
+		if mgr.keepSessionDuringIdPOutage(ctx, s) {
+			return
+		}
 		log.Info(ctx).
 			Str("user_id", userID).
 			Str("session_id", sessionID).
@@ -415,13 +427,23 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 	}
 
 	newToken, err := mgr.cfg.Load().authenticator.Refresh(ctx, FromOAuthToken(s.OauthToken), &s)
+	mgr.updateIdPOutage(ctx, err)
 	if isTemporaryError(err) {
 		log.Error(ctx).Err(err).
 			Str("user_id", s.GetUserId()).
 			Str("session_id", s.GetId()).
 			Msg("failed to refresh oauth2 token")
+		mgr.keepSessionDuringIdPOutage(ctx, s)
 		return
 	} else if err != nil {
+		// sessions are only kept when the identity provider is unreachable, not when it rejects them
+		if isIdPOutageError(err) && mgr.keepSessionDuringIdPOutage(ctx, s) {
+			log.Error(ctx).Err(err).
+				Str("user_id", s.GetUserId()).
+				Str("session_id", s.GetId()).
+				Msg("failed to refresh oauth2 token during idp outage, keeping session")
+			return
+		}
 		log.Error(ctx).Err(err).
 			Str("user_id", s.GetUserId()).
 			Str("session_id", s.GetId()).
@@ -432,13 +454,23 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 	s.OauthToken = ToOAuthToken(newToken)
 
 	err = mgr.cfg.Load().authenticator.UpdateUserInfo(ctx, FromOAuthToken(s.OauthToken), &s)
+	mgr.updateIdPOutage(ctx, err)
 	if isTemporaryError(err) {
 		log.Error(ctx).Err(err).
 			Str("user_id", s.GetUserId()).
 			Str("session_id", s.GetId()).
 			Msg("failed to update user info")
+		mgr.keepSessionDuringIdPOutage(ctx, s)
 		return
 	} else if err != nil {
+		// sessions are only kept when the identity provider is unreachable, not when it rejects them
+		if isIdPOutageError(err) && mgr.keepSessionDuringIdPOutage(ctx, s) {
+			log.Error(ctx).Err(err).
+				Str("user_id", s.GetUserId()).
+				Str("session_id", s.GetId()).
+				Msg("failed to update user info during idp outage, keeping session")
+			return
+		}
 		log.Error(ctx).Err(err).
 			Str("user_id", s.GetUserId()).
 			Str("session_id", s.GetId()).
@@ -447,6 +479,10 @@ func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string
 		return
 	}
 
+	if transform := mgr.cfg.Load().claimsTransform; transform != nil {
+		s.transformClaims(transform)
+	}
+
 	res, err := session.Put(ctx, mgr.cfg.Load().dataBrokerClient, s.Session)
 	if err != nil {
 		log.Error(ctx).Err(err).
@@ -600,6 +636,112 @@ func (mgr *Manager) deleteSession(ctx context.Context, pbSession *session.Sessio
 	}
 }
 
+// updateIdPOutage starts or ends an identity provider outage based on the result of a call to it. Any
+// response which isn't an outage error, including a rejection, ends the outage, since the identity provider
+// answered.
+func (mgr *Manager) updateIdPOutage(ctx context.Context, err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		// the call was canceled before the identity provider answered
+	case isIdPOutageError(err):
+		if mgr.idpOutageSince.IsZero() {
+			log.Warn(ctx).Err(err).Msg("identity provider outage started")
+			mgr.idpOutageSince = time.Now()
+			metrics.RecordIdentityManagerIdPOutage(true)
+		}
+	default:
+		if !mgr.idpOutageSince.IsZero() {
+			log.Info(ctx).
+				Str("idp_outage_since", mgr.idpOutageSince.Format(time.RFC3339)).
+				Msg("identity provider outage ended")
+			mgr.idpOutageSince = time.Time{}
+			metrics.RecordIdentityManagerIdPOutage(false)
+		}
+	}
+}
+
+// keepSessionDuringIdPOutage keeps a session which couldn't be refreshed while the identity provider is
+// unreachable and the outage grace period hasn't passed. Sessions which expire within the grace period are
+// extended to its end, and the refresh is retried after the cool-off duration. It returns false if the
+// session should be handled as usual.
+func (mgr *Manager) keepSessionDuringIdPOutage(ctx context.Context, s Session) bool {
+	gracePeriod := mgr.cfg.Load().idpOutageGracePeriod
+	if gracePeriod <= 0 || mgr.idpOutageSince.IsZero() {
+		return false
+	}
+
+	now := time.Now()
+	expiresAt := s.GetExpiresAt().AsTime()
+	extendedExpiresAt, ok := idpOutageSessionExpiry(expiresAt, mgr.idpOutageSince, gracePeriod, now)
+	if !ok {
+		return false
+	}
+
+	if extendedExpiresAt.Equal(expiresAt) {
+		mgr.sessionScheduler.Add(now.Add(mgr.cfg.Load().sessionRefreshCoolOffDuration),
+			toSessionSchedulerKey(s.GetUserId(), s.GetId()))
+		return true
+	}
+
+	s.Session = proto.Clone(s.Session).(*session.Session)
+	s.ExpiresAt = timestamppb.New(extendedExpiresAt)
+	res, err := session.Put(ctx, mgr.cfg.Load().dataBrokerClient, s.Session)
+	if err != nil {
+		log.Error(ctx).Err(err).
+			Str("user_id", s.GetUserId()).
+			Str("session_id", s.GetId()).
+			Msg("failed to extend session during idp outage")
+		return false
+	}
+
+	log.Warn(ctx).
+		Str("user_id", s.GetUserId()).
+		Str("session_id", s.GetId()).
+		Time("expires_at", expiresAt).
+		Time("extended_expires_at", extendedExpiresAt).
+		Time("idp_outage_since", mgr.idpOutageSince).
+		Msg("extended session during idp outage")
+	metrics.RecordIdentityManagerIdPOutageSessionExtension()
+
+	mgr.onUpdateSession(ctx, res.GetRecord(), s.Session)
+	return true
+}
+
+// idpOutageSessionExpiry returns the expiry of a session during an identity provider outage. Sessions
+// expiring before the end of the grace period are extended to its end, and sessions which expired before
+// the outage, or after the grace period has passed, aren't kept.
+func idpOutageSessionExpiry(expiresAt, outageSince time.Time, gracePeriod time.Duration, now time.Time) (time.Time, bool) {
+	graceEnd := outageSince.Add(gracePeriod)
+	if !now.Before(graceEnd) || expiresAt.Before(outageSince) {
+		return expiresAt, false
+	}
+	if expiresAt.Before(graceEnd) {
+		return graceEnd, true
+	}
+	return expiresAt, true
+}
+
+// isIdPOutageError returns true if the error means the identity provider is unreachable, rather than that
+// it rejected the session.
+func isIdPOutageError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if isTemporaryError(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.Response != nil {
+		return retrieveErr.Response.StatusCode >= http.StatusInternalServerError ||
+			retrieveErr.Response.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
 func isTemporaryError(err error) bool {
 	if err == nil {
 		return false
@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/btree"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/internal/identity/identity"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestIdPOutageSessionExpiry(t *testing.T) {
+	outageSince := time.Date(2020, 6, 5, 12, 0, 0, 0, time.UTC)
+	gracePeriod := time.Hour
+	graceEnd := outageSince.Add(gracePeriod)
+
+	for _, tc := range []struct {
+		name      string
+		expiresAt time.Time
+		now       time.Time
+		expect    time.Time
+		ok        bool
+	}{
+		{"extended", outageSince.Add(time.Minute), outageSince.Add(2 * time.Minute), graceEnd, true},
+		{"not expiring", graceEnd.Add(time.Hour), outageSince.Add(time.Minute), graceEnd.Add(time.Hour), true},
+		{"expired before outage", outageSince.Add(-time.Minute), outageSince.Add(time.Minute), outageSince.Add(-time.Minute), false},
+		{"grace period passed", outageSince.Add(time.Minute), graceEnd, outageSince.Add(time.Minute), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			expiresAt, ok := idpOutageSessionExpiry(tc.expiresAt, outageSince, gracePeriod, tc.now)
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expect, expiresAt)
+		})
+	}
+}
+
+func TestIsIdPOutageError(t *testing.T) {
+	retrieveError := func(statusCode int) error {
+		return fmt.Errorf("identity/oidc: refresh failed: %w", &oauth2.RetrieveError{
+			Response: &http.Response{StatusCode: statusCode},
+		})
+	}
+
+	for _, tc := range []struct {
+		name   string
+		err    error
+		expect bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"server error", retrieveError(http.StatusBadGateway), true},
+		{"rate limited", retrieveError(http.StatusTooManyRequests), true},
+		{"invalid grant", retrieveError(http.StatusBadRequest), false},
+		{"other", errors.New("invalid token"), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, isIdPOutageError(tc.err))
+		})
+	}
+}
+
+type mockAuthenticator struct {
+	refreshErr error
+}
+
+func (m mockAuthenticator) Refresh(ctx context.Context, tok *oauth2.Token, state identity.State) (*oauth2.Token, error) {
+	return tok, m.refreshErr
+}
+
+func (m mockAuthenticator) Revoke(ctx context.Context, tok *oauth2.Token) error {
+	return nil
+}
+
+func (m mockAuthenticator) UpdateUserInfo(ctx context.Context, tok *oauth2.Token, v interface{}) error {
+	return nil
+}
+
+type mockDataBrokerServiceClient struct {
+	databroker.DataBrokerServiceClient
+
+	puts []*databroker.Record
+}
+
+func (m *mockDataBrokerServiceClient) Put(ctx context.Context, in *databroker.PutRequest, opts ...grpc.CallOption) (*databroker.PutResponse, error) {
+	m.puts = append(m.puts, in.GetRecord())
+	return &databroker.PutResponse{Record: in.GetRecord()}, nil
+}
+
+func TestManager_refreshSession_idpOutage(t *testing.T) {
+	newManager := func(refreshErr error) (*Manager, *mockDataBrokerServiceClient) {
+		client := new(mockDataBrokerServiceClient)
+		mgr := New(
+			WithAuthenticator(mockAuthenticator{refreshErr: refreshErr}),
+			WithDataBrokerClient(client),
+			WithIdPOutageGracePeriod(time.Hour),
+		)
+		mgr.sessions = sessionCollection{BTree: btree.New(8)}
+		mgr.sessions.ReplaceOrInsert(Session{Session: &session.Session{
+			Id:         "SESSION_ID",
+			UserId:     "USER_ID",
+			ExpiresAt:  timestamppb.New(time.Now().Add(time.Minute)),
+			OauthToken: &session.OAuthToken{AccessToken: "ACCESS_TOKEN", RefreshToken: "REFRESH_TOKEN"},
+		}})
+		mgr.idpOutageSince = time.Now().Add(-time.Minute)
+		return mgr, client
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		mgr, client := newManager(fmt.Errorf("identity/oidc: refresh failed: %w", &oauth2.RetrieveError{
+			Response: &http.Response{StatusCode: http.StatusBadRequest},
+		}))
+		mgr.refreshSession(context.Background(), "USER_ID", "SESSION_ID")
+
+		require.Len(t, client.puts, 1)
+		assert.Equal(t, "SESSION_ID", client.puts[0].GetId())
+		assert.NotNil(t, client.puts[0].GetDeletedAt(), "rejected sessions should be deleted during an outage")
+		assert.True(t, mgr.idpOutageSince.IsZero(), "a rejection should end the outage")
+	})
+	t.Run("unreachable", func(t *testing.T) {
+		mgr, client := newManager(fmt.Errorf("identity/oidc: refresh failed: %w", &oauth2.RetrieveError{
+			Response: &http.Response{StatusCode: http.StatusBadGateway},
+		}))
+		mgr.refreshSession(context.Background(), "USER_ID", "SESSION_ID")
+
+		require.Len(t, client.puts, 1)
+		assert.Nil(t, client.puts[0].GetDeletedAt(), "sessions should be kept during an outage")
+		assert.False(t, mgr.idpOutageSince.IsZero())
+	})
+}
@@ -3,7 +3,11 @@
 // authorization with Bearer JWT.
 package oauth
 
-import "net/url"
+import (
+	"net/url"
+
+	"github.com/go-jose/go-jose/v3"
+)
 
 // Options contains the fields required for an OAuth 2.0 (inc. OIDC) auth flow.
 //
@@ -33,4 +37,21 @@ type Options struct {
 	// AuthCodeOptions specifies additional key value pairs query params to add
 	// to the request flow signin url.
 	AuthCodeOptions map[string]string
+
+	// PKCE enables Proof Key for Code Exchange with the S256 method. The code verifier of each
+	// authorization request is derived from its state with PKCEKey.
+	//
+	// https://tools.ietf.org/html/rfc7636
+	PKCE    bool
+	PKCEKey []byte
+	// PushedAuthorizationRequests sends the parameters of authorization requests to the provider's
+	// pushed authorization request endpoint, rather than in the sign in url.
+	//
+	// https://tools.ietf.org/html/rfc9126
+	PushedAuthorizationRequests bool
+	// RequestObjectSigningKey, if set, is the private key which signs the parameters of authorization
+	// requests as a request object.
+	//
+	// https://tools.ietf.org/html/rfc9101
+	RequestObjectSigningKey *jose.JSONWebKey
 }
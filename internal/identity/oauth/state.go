@@ -0,0 +1,17 @@
+package oauth
+
+import "context"
+
+type stateKey struct{}
+
+// WithState returns a context with the state of the authorization request whose code is redeemed with it,
+// which providers need to redeem codes issued with PKCE.
+func WithState(ctx context.Context, state string) context.Context {
+	return context.WithValue(ctx, stateKey{}, state)
+}
+
+// StateFromContext returns the state of the authorization request set with WithState, if any.
+func StateFromContext(ctx context.Context) string {
+	state, _ := ctx.Value(stateKey{}).(string)
+	return state
+}
@@ -0,0 +1,164 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+
+	"github.com/pomerium/pomerium/internal/version"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+const (
+	// requestObjectLifetime is how long a signed request object is valid for.
+	requestObjectLifetime = 5 * time.Minute
+	// pushedAuthorizationRequestTimeout is the timeout of requests to the pushed authorization request endpoint.
+	pushedAuthorizationRequestTimeout = 30 * time.Second
+)
+
+// getCodeVerifier returns the PKCE code verifier of the authorization request with the given state. It's
+// derived from the state, so that it doesn't have to be stored until the code is redeemed, but can't be
+// derived by anyone who intercepts the state without the key.
+func getCodeVerifier(key []byte, state string) string {
+	return base64.RawURLEncoding.EncodeToString(cryptutil.GenerateHMAC([]byte("pkce|"+state), key))
+}
+
+// getCodeChallenge returns the S256 PKCE code challenge of a code verifier.
+func getCodeChallenge(verifier string) string {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+// getAuthorizationRequestURL returns the sign in url of an authorization request with the parameters of
+// signInURL, signed as a request object and/or pushed to the pushed authorization request endpoint.
+func (p *Provider) getAuthorizationRequestURL(ctx context.Context, oa *oauth2.Config, signInURL string) (string, error) {
+	u, err := url.Parse(signInURL)
+	if err != nil {
+		return "", err
+	}
+	params := u.Query()
+
+	if p.requestObjectSigningKey != nil {
+		requestObject, err := p.signRequestObject(oa, params)
+		if err != nil {
+			return "", fmt.Errorf("identity/oidc: error signing request object: %w", err)
+		}
+		// OpenID Connect requires the response type and scope outside of the request object too
+		params = url.Values{
+			"client_id":     {oa.ClientID},
+			"response_type": {params.Get("response_type")},
+			"scope":         {params.Get("scope")},
+			"request":       {requestObject},
+		}
+	}
+
+	if p.pushedAuthorizationRequests {
+		requestURI, err := p.pushAuthorizationRequest(ctx, oa, params)
+		if err != nil {
+			return "", fmt.Errorf("identity/oidc: error pushing authorization request: %w", err)
+		}
+		params = url.Values{
+			"client_id":   {oa.ClientID},
+			"request_uri": {requestURI},
+		}
+	}
+
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// signRequestObject returns a request object with the parameters of an authorization request.
+//
+// https://tools.ietf.org/html/rfc9101#section-4
+func (p *Provider) signRequestObject(oa *oauth2.Config, params url.Values) (string, error) {
+	key := p.requestObjectSigningKey
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key},
+		(&jose.SignerOptions{}).WithType("oauth-authz-req+jwt"))
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{}
+	for k := range params {
+		claims[k] = params.Get(k)
+	}
+	claims["iss"] = oa.ClientID
+	claims["aud"] = p.Issuer
+	claims["iat"] = jwt.NewNumericDate(now)
+	claims["nbf"] = jwt.NewNumericDate(now)
+	claims["exp"] = jwt.NewNumericDate(now.Add(requestObjectLifetime))
+	claims["jti"] = uuid.NewString()
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+// pushAuthorizationRequest sends the parameters of an authorization request to the pushed authorization
+// request endpoint, and returns the request uri which references them.
+//
+// https://tools.ietf.org/html/rfc9126#section-2
+func (p *Provider) pushAuthorizationRequest(ctx context.Context, oa *oauth2.Config, params url.Values) (string, error) {
+	if p.PushedAuthorizationRequestURL == "" {
+		return "", ErrPushedAuthorizationRequestsNotSupported
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pushedAuthorizationRequestTimeout)
+	defer cancel()
+
+	body := url.Values{}
+	for k, v := range params {
+		body[k] = v
+	}
+	body.Set("client_id", oa.ClientID)
+	body.Set("client_secret", oa.ClientSecret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.PushedAuthorizationRequestURL,
+		strings.NewReader(body.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", version.UserAgent())
+
+	client := http.DefaultClient
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		client = c
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	bs, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	var response struct {
+		RequestURI       string `json:"request_uri"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.Unmarshal(bs, &response)
+	if res.StatusCode/100 != 2 {
+		if response.Error != "" {
+			return "", fmt.Errorf("%s: %s", response.Error, response.ErrorDescription)
+		}
+		return "", fmt.Errorf("unexpected response status: %d", res.StatusCode)
+	}
+	if response.RequestURI == "" {
+		return "", fmt.Errorf("missing request_uri")
+	}
+	return response.RequestURI, nil
+}
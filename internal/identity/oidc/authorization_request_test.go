@@ -0,0 +1,142 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+)
+
+func newAuthorizationRequestTestServer(t *testing.T, pushed chan<- url.Values, exchanged chan<- url.Values) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":                                srv.URL,
+				"authorization_endpoint":                srv.URL + "/oauth2/authorize",
+				"token_endpoint":                        srv.URL + "/oauth2/token",
+				"jwks_uri":                              srv.URL + "/.well-known/jwks.json",
+				"pushed_authorization_request_endpoint": srv.URL + "/oauth2/par",
+			})
+		case "/oauth2/par":
+			_ = r.ParseForm()
+			pushed <- r.PostForm
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, `{"request_uri": "urn:ietf:params:oauth:request_uri:1234", "expires_in": 60}`)
+		case "/oauth2/token":
+			_ = r.ParseForm()
+			exchanged <- r.PostForm
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"access_token": "ACCESS_TOKEN", "token_type": "Bearer"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProvider_PKCE(t *testing.T) {
+	ctx := context.Background()
+	exchanged := make(chan url.Values, 1)
+	srv := newAuthorizationRequestTestServer(t, nil, exchanged)
+
+	redirectURL, _ := url.Parse("https://authenticate.example.com/oauth2/callback")
+	p, err := New(ctx, &oauth.Options{
+		RedirectURL:  redirectURL,
+		ProviderURL:  srv.URL,
+		ClientID:     "CLIENT_ID",
+		ClientSecret: "CLIENT_SECRET",
+		PKCE:         true,
+		PKCEKey:      []byte("01234567890123456789012345678901"),
+	})
+	require.NoError(t, err)
+
+	signInURL, err := p.GetSignInURL("STATE")
+	require.NoError(t, err)
+	u, err := url.Parse(signInURL)
+	require.NoError(t, err)
+	verifier := getCodeVerifier(p.pkceKey, "STATE")
+	assert.Equal(t, getCodeChallenge(verifier), u.Query().Get("code_challenge"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	assert.NotEqual(t, verifier, getCodeVerifier(p.pkceKey, "OTHER_STATE"))
+
+	_, err = p.Authenticate(ctx, "CODE", nil)
+	assert.ErrorIs(t, err, ErrMissingState)
+
+	// the token response has no id token, so only the exchange is checked
+	_, _ = p.Authenticate(oauth.WithState(ctx, "STATE"), "CODE", nil)
+	form := <-exchanged
+	assert.Equal(t, "CODE", form.Get("code"))
+	assert.Equal(t, verifier, form.Get("code_verifier"))
+}
+
+func TestProvider_PushedSignedAuthorizationRequests(t *testing.T) {
+	ctx := context.Background()
+	pushed := make(chan url.Values, 1)
+	srv := newAuthorizationRequestTestServer(t, pushed, nil)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	key := &jose.JSONWebKey{Key: privateKey, KeyID: "KEY_ID", Algorithm: string(jose.ES256), Use: "sig"}
+
+	redirectURL, _ := url.Parse("https://authenticate.example.com/oauth2/callback")
+	p, err := New(ctx, &oauth.Options{
+		RedirectURL:                 redirectURL,
+		ProviderURL:                 srv.URL,
+		ClientID:                    "CLIENT_ID",
+		ClientSecret:                "CLIENT_SECRET",
+		Scopes:                      []string{"openid", "email"},
+		PushedAuthorizationRequests: true,
+		RequestObjectSigningKey:     key,
+	})
+	require.NoError(t, err)
+
+	signInURL, err := p.GetSignInURL("STATE")
+	require.NoError(t, err)
+	u, err := url.Parse(signInURL)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/oauth2/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, url.Values{
+		"client_id":   {"CLIENT_ID"},
+		"request_uri": {"urn:ietf:params:oauth:request_uri:1234"},
+	}, u.Query())
+
+	form := <-pushed
+	assert.Equal(t, "CLIENT_ID", form.Get("client_id"))
+	assert.Equal(t, "CLIENT_SECRET", form.Get("client_secret"))
+	assert.Equal(t, "code", form.Get("response_type"))
+	assert.Equal(t, "openid email", form.Get("scope"))
+	assert.Empty(t, form.Get("state"), "the state should only be in the request object")
+
+	tok, err := jwt.ParseSigned(form.Get("request"))
+	require.NoError(t, err)
+	require.Len(t, tok.Headers, 1)
+	assert.Equal(t, "oauth-authz-req+jwt", tok.Headers[0].ExtraHeaders[jose.HeaderType])
+	assert.Equal(t, "KEY_ID", tok.Headers[0].KeyID)
+	var claims map[string]interface{}
+	require.NoError(t, tok.Claims(&privateKey.PublicKey, &claims))
+	assert.Equal(t, "CLIENT_ID", claims["iss"])
+	assert.Equal(t, srv.URL, claims["aud"])
+	assert.Equal(t, "CLIENT_ID", claims["client_id"])
+	assert.Equal(t, "STATE", claims["state"])
+	assert.Equal(t, redirectURL.String(), claims["redirect_uri"])
+	assert.NotEmpty(t, claims["jti"])
+	assert.NotEmpty(t, claims["exp"])
+}
@@ -26,3 +26,11 @@ var ErrMissingRefreshToken = errors.New("identity/oidc: missing refresh token")
 
 // ErrMissingAccessToken is returned when no access token was found.
 var ErrMissingAccessToken = errors.New("identity/oidc: missing access token")
+
+// ErrPushedAuthorizationRequestsNotSupported is returned when pushed authorization requests are enabled,
+// but the identity provider doesn't have a pushed authorization request endpoint.
+var ErrPushedAuthorizationRequestsNotSupported = errors.New("identity/oidc: pushed authorization requests not supported")
+
+// ErrMissingState is returned when a code issued with PKCE is redeemed without the state of its
+// authorization request.
+var ErrMissingState = errors.New("identity/oidc: missing state")
@@ -13,6 +13,7 @@ import (
 	"sync"
 
 	go_oidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v3"
 	"golang.org/x/oauth2"
 
 	"github.com/pomerium/pomerium/internal/httputil"
@@ -44,10 +45,22 @@ type Provider struct {
 	// https://openid.net/specs/openid-connect-frontchannel-1_0.html#RPInitiated
 	EndSessionURL string `json:"end_session_endpoint,omitempty"`
 
+	// Issuer is the issuer of the provider, which is the audience of request objects.
+	Issuer string `json:"issuer,omitempty"`
+
+	// PushedAuthorizationRequestURL is the location of the pushed authorization request endpoint.
+	// https://tools.ietf.org/html/rfc9126
+	PushedAuthorizationRequestURL string `json:"pushed_authorization_request_endpoint,omitempty"`
+
 	// AuthCodeOptions specifies additional key value pairs query params to add
 	// to the request flow signin url.
 	AuthCodeOptions map[string]string
 
+	pkce                        bool
+	pkceKey                     []byte
+	pushedAuthorizationRequests bool
+	requestObjectSigningKey     *jose.JSONWebKey
+
 	mu       sync.Mutex
 	provider *go_oidc.Provider
 }
@@ -65,6 +78,10 @@ func New(ctx context.Context, o *oauth.Options, options ...Option) (*Provider, e
 	if len(o.AuthCodeOptions) != 0 {
 		p.AuthCodeOptions = o.AuthCodeOptions
 	}
+	p.pkce = o.PKCE
+	p.pkceKey = o.PKCEKey
+	p.pushedAuthorizationRequests = o.PushedAuthorizationRequests
+	p.requestObjectSigningKey = o.RequestObjectSigningKey
 
 	p.cfg = getConfig(append([]Option{
 		WithGetOauthConfig(func(provider *go_oidc.Provider) *oauth2.Config {
@@ -113,7 +130,16 @@ func (p *Provider) GetSignInURL(state string) (string, error) {
 	for k, v := range p.AuthCodeOptions {
 		opts = append(opts, oauth2.SetAuthURLParam(k, v))
 	}
-	return oa.AuthCodeURL(state, opts...), nil
+	if p.pkce {
+		opts = append(opts,
+			oauth2.SetAuthURLParam("code_challenge", getCodeChallenge(getCodeVerifier(p.pkceKey, state))),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+	}
+	signInURL := oa.AuthCodeURL(state, opts...)
+	if p.requestObjectSigningKey == nil && !p.pushedAuthorizationRequests {
+		return signInURL, nil
+	}
+	return p.getAuthorizationRequestURL(context.Background(), oa, signInURL)
 }
 
 // Authenticate converts an authorization code returned from the identity
@@ -124,8 +150,17 @@ func (p *Provider) Authenticate(ctx context.Context, code string, v identity.Sta
 		return nil, err
 	}
 
+	var opts []oauth2.AuthCodeOption
+	if p.pkce {
+		state := oauth.StateFromContext(ctx)
+		if state == "" {
+			return nil, ErrMissingState
+		}
+		opts = append(opts, oauth2.SetAuthURLParam("code_verifier", getCodeVerifier(p.pkceKey, state)))
+	}
+
 	// Exchange converts an authorization code into a token.
-	oauth2Token, err := oa.Exchange(ctx, code)
+	oauth2Token, err := oa.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("identity/oidc: token exchange failed: %w", err)
 	}
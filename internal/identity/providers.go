@@ -21,6 +21,7 @@ import (
 	"github.com/pomerium/pomerium/internal/identity/oidc/okta"
 	"github.com/pomerium/pomerium/internal/identity/oidc/onelogin"
 	"github.com/pomerium/pomerium/internal/identity/oidc/ping"
+	"github.com/pomerium/pomerium/internal/urlutil"
 )
 
 // Authenticator is an interface representing the ability to authenticate with an identity provider.
@@ -65,6 +66,26 @@ func NewAuthenticator(o oauth.Options) (a Authenticator, err error) {
 	return a, nil
 }
 
+// ValidateOptions checks that the provider is known and that its options are complete, without
+// contacting the provider.
+func ValidateOptions(o oauth.Options) error {
+	switch o.ProviderName {
+	case azure.Name, gitlab.Name, github.Name, google.Name, onelogin.Name:
+	case auth0.Name, oidc.Name, okta.Name, ping.Name:
+		if o.ProviderURL == "" {
+			return fmt.Errorf("identity: a provider url is required for %s", o.ProviderName)
+		}
+	default:
+		return fmt.Errorf("identity: unknown provider: %s", o.ProviderName)
+	}
+	if o.ProviderURL != "" {
+		if _, err := urlutil.ParseAndValidateURL(o.ProviderURL); err != nil {
+			return fmt.Errorf("identity: invalid provider url: %w", err)
+		}
+	}
+	return nil
+}
+
 // wrap the Authenticator for the AtomicAuthenticator to support a nil default value.
 type authenticatorValue struct {
 	Authenticator
@@ -0,0 +1,398 @@
+package internalca
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+const (
+	// BootstrapServerName is the TLS server name services use to connect to the bootstrap service of the
+	// databroker. Connections with it don't require a client certificate, because they're made to get one.
+	BootstrapServerName = "pomerium-internal-ca-bootstrap"
+	// BootstrapServiceName is the name of the gRPC bootstrap service.
+	BootstrapServiceName = "pomerium.internalca.Bootstrap"
+
+	bootstrapIssuer        = "pomerium-internal-ca-bootstrap"
+	bootstrapRequestTTL    = time.Minute
+	bootstrapTimeout       = 10 * time.Second
+	bootstrapRetryInterval = time.Minute
+)
+
+// bootstrapRequestClaims are the claims of a certificate signing request sent to the bootstrap service.
+type bootstrapRequestClaims struct {
+	jwt.Claims
+	// CSR is the DER encoded certificate signing request.
+	CSR string `json:"csr"`
+}
+
+// bootstrapResponseClaims are the claims of the response of the bootstrap service. The response is signed,
+// because the client doesn't know the CA yet and so can't verify the server certificate of the databroker.
+type bootstrapResponseClaims struct {
+	jwt.Claims
+	// CSRHash is the hex encoded SHA-256 hash of the certificate signing request.
+	CSRHash     string `json:"csr_hash"`
+	Certificate string `json:"certificate"`
+	CA          string `json:"ca"`
+}
+
+// A BootstrapServer signs the certificate signing requests of the other services. Requests are authenticated
+// with a key derived from the shared secret, but the CA key itself never leaves the databroker.
+type BootstrapServer struct {
+	allowed func(service string) bool
+
+	mu        sync.RWMutex
+	ca        *CA
+	sharedKey []byte
+}
+
+// NewBootstrapServer creates a new BootstrapServer, which issues certificates to the services allowed.
+func NewBootstrapServer(allowed func(service string) bool) *BootstrapServer {
+	return &BootstrapServer{allowed: allowed}
+}
+
+// Update updates the CA and the shared secret of the server. Requests are rejected while the CA is nil.
+func (srv *BootstrapServer) Update(ca *CA, sharedKey []byte) {
+	srv.mu.Lock()
+	srv.ca, srv.sharedKey = ca, sharedKey
+	srv.mu.Unlock()
+}
+
+// Register registers the bootstrap service with the gRPC server.
+func (srv *BootstrapServer) Register(grpcServer *grpc.Server) {
+	grpcServer.RegisterService(&bootstrapServiceDesc, srv)
+}
+
+// Sign signs a certificate signing request.
+func (srv *BootstrapServer) Sign(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	srv.mu.RLock()
+	ca, sharedKey := srv.ca, srv.sharedKey
+	srv.mu.RUnlock()
+	if ca == nil {
+		return nil, status.Error(codes.Unavailable, "internal CA is not enabled")
+	}
+
+	tok, err := jwt.ParseSigned(req.GetValue())
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid request")
+	}
+	var claims bootstrapRequestClaims
+	if err := tok.Claims(bootstrapKey(sharedKey), &claims); err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid request")
+	}
+	if claims.Expiry == nil || claims.IssuedAt == nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid request")
+	}
+	err = claims.ValidateWithLeeway(jwt.Expected{Issuer: bootstrapIssuer, Time: time.Now()}, certificateBackdate)
+	if err != nil || claims.Expiry.Time().Sub(claims.IssuedAt.Time()) > bootstrapRequestTTL {
+		return nil, status.Error(codes.Unauthenticated, "invalid request")
+	}
+	if !srv.allowed(claims.Subject) {
+		return nil, status.Errorf(codes.PermissionDenied, "certificates can't be issued to %q", claims.Subject)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(claims.CSR)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid certificate signing request")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil || csr.CheckSignature() != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid certificate signing request")
+	}
+	names := append([]string(nil), csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	// the common name identifies the service to the databroker, so it's always the authenticated subject
+	leaf, err := ca.sign(csr.PublicKey, claims.Subject, names, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	log.Info(ctx).
+		Str("service", claims.Subject).
+		Strs("names", names).
+		Str("serial", leaf.SerialNumber.String()).
+		Msg("internalca: issued certificate")
+
+	sum := sha256.Sum256(der)
+	res, err := signBootstrapClaims(sharedKey, bootstrapResponseClaims{
+		Claims: jwt.Claims{
+			Issuer:   bootstrapIssuer,
+			Audience: jwt.Audience{claims.Subject},
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		CSRHash:     hex.EncodeToString(sum[:]),
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})),
+		CA:          string(ca.PEM()),
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return wrapperspb.String(res), nil
+}
+
+var bootstrapServiceDesc = grpc.ServiceDesc{
+	ServiceName: BootstrapServiceName,
+	HandlerType: (*interface {
+		Sign(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+	})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Sign",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(wrapperspb.StringValue)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.(*BootstrapServer).Sign(ctx, req.(*wrapperspb.StringValue))
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + BootstrapServiceName + "/Sign",
+			}, handler)
+		},
+	}},
+	Streams: []grpc.StreamDesc{},
+}
+
+var bootstrapped = struct {
+	sync.Mutex
+	m map[string]*bootstrappedCertificate
+}{
+	m: make(map[string]*bootstrappedCertificate),
+}
+
+type bootstrappedCertificate struct {
+	cert    *tls.Certificate
+	caPEM   []byte
+	renewAt time.Time
+}
+
+// Bootstrap returns a certificate for the service, requested from the bootstrap service of one of the databroker
+// URLs, along with the PEM encoded CA certificate and the time it should be renewed at. Certificates are reused
+// until two thirds of their lifetime has passed. If they can't be renewed, they're used until they expire.
+func Bootstrap(
+	ctx context.Context,
+	dataBrokerURLs []*url.URL,
+	sharedKey []byte,
+	commonName string,
+	names []string,
+) (*tls.Certificate, []byte, time.Time, error) {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	var urls []string
+	for _, u := range dataBrokerURLs {
+		urls = append(urls, u.String())
+	}
+	id := commonName + "|" + strings.Join(names, ",") + "|" + strings.Join(urls, ",") + "|" +
+		hex.EncodeToString(cryptutil.Hash("internal_ca_bootstrap_cache", sharedKey))
+
+	bootstrapped.Lock()
+	defer bootstrapped.Unlock()
+
+	now := time.Now()
+	cached, ok := bootstrapped.m[id]
+	if ok && now.Before(cached.renewAt) {
+		return cached.cert, cached.caPEM, cached.renewAt, nil
+	}
+
+	var err error
+	for _, u := range dataBrokerURLs {
+		var cert *tls.Certificate
+		var caPEM []byte
+		cert, caPEM, err = requestCertificate(ctx, u, sharedKey, commonName, names)
+		if err == nil {
+			cached = &bootstrappedCertificate{
+				cert:    cert,
+				caPEM:   caPEM,
+				renewAt: now.Add(CertificateLifetime * 2 / 3),
+			}
+			bootstrapped.m[id] = cached
+			return cached.cert, cached.caPEM, cached.renewAt, nil
+		}
+		log.Warn(ctx).Err(err).Str("databroker", u.String()).Msg("internalca: failed to request certificate")
+	}
+	if err == nil {
+		err = errors.New("no databroker urls")
+	}
+
+	if ok && now.Before(cached.cert.Leaf.NotAfter) {
+		cached.renewAt = minTime(now.Add(bootstrapRetryInterval), cached.cert.Leaf.NotAfter)
+		return cached.cert, cached.caPEM, cached.renewAt, nil
+	}
+	return nil, nil, time.Time{}, fmt.Errorf("internalca: error requesting certificate for %s: %w", commonName, err)
+}
+
+func requestCertificate(
+	ctx context.Context,
+	dataBrokerURL *url.URL,
+	sharedKey []byte,
+	commonName string,
+	names []string,
+) (*tls.Certificate, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, bootstrapTimeout)
+	defer cancel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: commonName}}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	req, err := signBootstrapClaims(sharedKey, bootstrapRequestClaims{
+		Claims: jwt.Claims{
+			Issuer:   bootstrapIssuer,
+			Subject:  commonName,
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(bootstrapRequestTTL)),
+		},
+		CSR: base64.StdEncoding.EncodeToString(der),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the server certificate isn't verified, because it's issued by the CA we're about to learn. Instead
+	// the response is signed with the shared secret and checked below.
+	dialOption := grpc.WithInsecure()
+	if dataBrokerURL.Scheme == "https" {
+		dialOption = grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			ServerName:         BootstrapServerName,
+			InsecureSkipVerify: true, //nolint:gosec
+			MinVersion:         tls.VersionTLS12,
+		}))
+	}
+	host := dataBrokerURL.Host
+	if dataBrokerURL.Port() == "" {
+		host = net.JoinHostPort(dataBrokerURL.Hostname(), map[string]string{"http": "80", "https": "443"}[dataBrokerURL.Scheme])
+	}
+	cc, err := grpc.DialContext(ctx, host, dialOption)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = cc.Close() }()
+
+	res := new(wrapperspb.StringValue)
+	err = cc.Invoke(ctx, "/"+BootstrapServiceName+"/Sign", wrapperspb.String(req), res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return verifyBootstrapResponse(sharedKey, res.GetValue(), der, key, commonName)
+}
+
+func verifyBootstrapResponse(
+	sharedKey []byte,
+	rawResponse string,
+	csr []byte,
+	key *ecdsa.PrivateKey,
+	commonName string,
+) (*tls.Certificate, []byte, error) {
+	tok, err := jwt.ParseSigned(rawResponse)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid response: %w", err)
+	}
+	var claims bootstrapResponseClaims
+	if err := tok.Claims(bootstrapKey(sharedKey), &claims); err != nil {
+		return nil, nil, fmt.Errorf("invalid response: %w", err)
+	}
+	sum := sha256.Sum256(csr)
+	if claims.Issuer != bootstrapIssuer || claims.CSRHash != hex.EncodeToString(sum[:]) {
+		return nil, nil, errors.New("invalid response: certificate signing request mismatch")
+	}
+
+	block, _ := pem.Decode([]byte(claims.Certificate))
+	if block == nil {
+		return nil, nil, errors.New("invalid response: no certificate")
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if pub, ok := leaf.PublicKey.(*ecdsa.PublicKey); !ok || !pub.Equal(&key.PublicKey) {
+		return nil, nil, errors.New("invalid response: certificate public key mismatch")
+	}
+	if leaf.Subject.CommonName != commonName {
+		return nil, nil, errors.New("invalid response: certificate common name mismatch")
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(claims.CA)) {
+		return nil, nil, errors.New("invalid response: no CA certificate")
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, []byte(claims.CA), nil
+}
+
+func signBootstrapClaims(sharedKey []byte, claims interface{}) (string, error) {
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: bootstrapKey(sharedKey)},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(sig).Claims(claims).CompactSerialize()
+}
+
+func bootstrapKey(sharedKey []byte) []byte {
+	return cryptutil.Hash("internal_ca_bootstrap", sharedKey)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,67 @@
+package internalca
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestBootstrap(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer clearTimeout()
+
+	sharedKey := cryptutil.NewKey()
+	ca, err := Get(newTestKey(t))
+	require.NoError(t, err)
+
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer()
+	bootstrap := NewBootstrapServer(func(service string) bool { return service != "databroker" })
+	bootstrap.Update(ca, sharedKey)
+	bootstrap.Register(srv)
+	go func() { _ = srv.Serve(li) }()
+	defer srv.Stop()
+
+	u := &url.URL{Scheme: "http", Host: li.Addr().String()}
+
+	cert, caPEM, renewAt, err := Bootstrap(ctx, []*url.URL{u}, sharedKey, "authorize", []string{"authorize.internal"})
+	require.NoError(t, err)
+	assert.Equal(t, ca.PEM(), caPEM)
+	assert.Equal(t, "authorize", cert.Leaf.Subject.CommonName)
+	assert.WithinDuration(t, time.Now().Add(CertificateLifetime*2/3), renewAt, time.Minute)
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{
+		DNSName:   "authorize.internal",
+		Roots:     ca.CertPool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	assert.NoError(t, err)
+
+	again, _, _, err := Bootstrap(ctx, []*url.URL{u}, sharedKey, "authorize", []string{"authorize.internal"})
+	require.NoError(t, err)
+	assert.Same(t, cert, again, "should reuse certificates until they're renewed")
+
+	t.Run("wrong shared secret", func(t *testing.T) {
+		_, _, _, err := Bootstrap(ctx, []*url.URL{u}, cryptutil.NewKey(), "proxy", nil)
+		assert.Error(t, err)
+	})
+	t.Run("not allowed", func(t *testing.T) {
+		_, _, _, err := Bootstrap(ctx, []*url.URL{u}, sharedKey, "databroker", nil)
+		assert.Error(t, err)
+	})
+	t.Run("unavailable", func(t *testing.T) {
+		bootstrap.Update(nil, nil)
+		defer bootstrap.Update(ca, sharedKey)
+		_, _, _, err := Bootstrap(ctx, []*url.URL{u}, sharedKey, "proxy", nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,223 @@
+// Package internalca contains a certificate authority which issues the short-lived certificates the pomerium
+// services use to authenticate to each other. The CA key is only held by the databroker, and the other services
+// request their certificates from it with a certificate signing request.
+package internalca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CommonName is the common name of the CA certificate.
+	CommonName = "Pomerium Internal CA"
+	// CertificateLifetime is how long issued certificates are valid for.
+	CertificateLifetime = 24 * time.Hour
+	// certificateBackdate allows for clock skew between services.
+	certificateBackdate = 5 * time.Minute
+)
+
+// A CA issues certificates signed by the CA key. Every databroker with the same key issues certificates
+// trusted by the others.
+type CA struct {
+	key  crypto.Signer
+	cert *x509.Certificate
+	pem  []byte
+
+	mu     sync.Mutex
+	issued map[string]*issuedCertificate
+}
+
+type issuedCertificate struct {
+	cert    *tls.Certificate
+	renewAt time.Time
+}
+
+var cas = struct {
+	sync.Mutex
+	m map[[sha256.Size]byte]*CA
+}{
+	m: make(map[[sha256.Size]byte]*CA),
+}
+
+// Get returns the CA for the given PEM encoded private key.
+func Get(keyPEM []byte) (*CA, error) {
+	if len(keyPEM) == 0 {
+		return nil, fmt.Errorf("internalca: CA key is required")
+	}
+
+	cas.Lock()
+	defer cas.Unlock()
+
+	id := sha256.Sum256(keyPEM)
+	if ca, ok := cas.m[id]; ok {
+		return ca, nil
+	}
+
+	key, err := ParseKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := newCA(key)
+	if err != nil {
+		return nil, err
+	}
+	cas.m[id] = ca
+	return ca, nil
+}
+
+// ParseKey parses a PEM encoded EC or PKCS #8 ECDSA private key.
+func ParseKey(keyPEM []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("internalca: invalid CA key: no PEM data found")
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("internalca: invalid CA key: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("internalca: invalid CA key: unsupported key type %T", key)
+	}
+	return ecKey, nil
+}
+
+func newCA(key *ecdsa.PrivateKey) (*CA, error) {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: CommonName},
+		NotBefore:             time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2121, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("internalca: error creating CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("internalca: error parsing CA certificate: %w", err)
+	}
+
+	return &CA{
+		key:    key,
+		cert:   cert,
+		pem:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		issued: make(map[string]*issuedCertificate),
+	}, nil
+}
+
+// PEM returns the PEM encoded CA certificate.
+func (ca *CA) PEM() []byte {
+	return ca.pem
+}
+
+// CertPool returns a certificate pool containing the CA certificate.
+func (ca *CA) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// GetCertificate returns a certificate for the service with the given common name, and the time it should be
+// renewed at. If names are given the certificate may also be used as a server certificate for those DNS names and
+// IP addresses. Certificates are reused until two thirds of their lifetime has passed.
+func (ca *CA) GetCertificate(commonName string, names []string) (*tls.Certificate, time.Time, error) {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	id := commonName + "|" + strings.Join(names, ",")
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	now := time.Now()
+	if issued, ok := ca.issued[id]; ok && now.Before(issued.renewAt) {
+		return issued.cert, issued.renewAt, nil
+	}
+
+	cert, err := ca.issue(commonName, names, now)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	issued := &issuedCertificate{
+		cert:    cert,
+		renewAt: now.Add(CertificateLifetime * 2 / 3),
+	}
+	ca.issued[id] = issued
+	return issued.cert, issued.renewAt, nil
+}
+
+func (ca *CA) issue(commonName string, names []string, now time.Time) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("internalca: error generating key: %w", err)
+	}
+	leaf, err := ca.sign(&key.PublicKey, commonName, names, now)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{leaf.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// sign issues a certificate for the public key. Certificates with names may also be used as server certificates.
+func (ca *CA) sign(publicKey interface{}, commonName string, names []string, now time.Time) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("internalca: error generating serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-certificateBackdate),
+		NotAfter:     now.Add(CertificateLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	if len(names) > 0 {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, publicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("internalca: error issuing certificate for %s: %w", commonName, err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("internalca: error parsing certificate for %s: %w", commonName, err)
+	}
+	return leaf, nil
+}
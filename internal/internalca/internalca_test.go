@@ -0,0 +1,90 @@
+package internalca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKey(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func TestGet(t *testing.T) {
+	keyPEM := newTestKey(t)
+
+	ca, err := Get(keyPEM)
+	require.NoError(t, err)
+	again, err := Get(keyPEM)
+	require.NoError(t, err)
+	assert.Same(t, ca, again)
+
+	_, err = Get(nil)
+	assert.Error(t, err)
+	_, err = Get([]byte("not a key"))
+	assert.Error(t, err)
+}
+
+func TestCA_GetCertificate(t *testing.T) {
+	keyPEM := newTestKey(t)
+	ca, err := Get(keyPEM)
+	require.NoError(t, err)
+
+	// a CA created by another databroker from the same key
+	key, err := ParseKey(keyPEM)
+	require.NoError(t, err)
+	other, err := newCA(key)
+	require.NoError(t, err)
+
+	cert, renewAt, err := ca.GetCertificate("databroker", []string{"databroker.internal", "10.0.0.1"})
+	require.NoError(t, err)
+	assert.Equal(t, "databroker", cert.Leaf.Subject.CommonName)
+	assert.Equal(t, []string{"databroker.internal"}, cert.Leaf.DNSNames)
+	assert.Len(t, cert.Leaf.IPAddresses, 1)
+	assert.WithinDuration(t, cert.Leaf.NotBefore.Add(certificateBackdate+CertificateLifetime*2/3), renewAt, time.Second)
+
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{
+		DNSName:   "databroker.internal",
+		Roots:     other.CertPool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	assert.NoError(t, err)
+
+	again, _, err := ca.GetCertificate("databroker", []string{"10.0.0.1", "databroker.internal"})
+	require.NoError(t, err)
+	assert.Same(t, cert, again, "should reuse certificates until they're renewed")
+
+	client, _, err := ca.GetCertificate("proxy", nil)
+	require.NoError(t, err)
+	_, err = client.Leaf.Verify(x509.VerifyOptions{
+		Roots:     other.CertPool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.NoError(t, err)
+	_, err = client.Leaf.Verify(x509.VerifyOptions{
+		Roots:     other.CertPool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	assert.Error(t, err, "client certificates can't be used by servers")
+
+	untrusted, err := Get(newTestKey(t))
+	require.NoError(t, err)
+	_, err = client.Leaf.Verify(x509.VerifyOptions{
+		Roots:     untrusted.CertPool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,180 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	serviceAccountDir       = "/var/run/secrets/kubernetes.io/serviceaccount"
+	serviceAccountTokenFile = serviceAccountDir + "/token"
+	serviceAccountCAFile    = serviceAccountDir + "/ca.crt"
+)
+
+// errGone is returned by watch when the resource version is too old and the resources need to be listed again.
+var errGone = errors.New("kubernetes: resource version too old")
+
+// A Client is a minimal Kubernetes API client which can list and watch resources.
+type Client struct {
+	apiURL     *url.URL
+	tokenFile  string
+	httpClient *http.Client
+}
+
+// NewClient creates a new Client for the API server at apiURL. The bearer token is read from tokenFile on
+// every request so that rotated service account tokens are picked up.
+func NewClient(apiURL *url.URL, tokenFile string, httpClient *http.Client) *Client {
+	return &Client{
+		apiURL:     apiURL,
+		tokenFile:  tokenFile,
+		httpClient: httpClient,
+	}
+}
+
+// NewInClusterClient creates a new Client using the service account Kubernetes mounts into pods.
+func NewInClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("kubernetes: not running in a cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set")
+	}
+
+	ca, err := ioutil.ReadFile(serviceAccountCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: error reading service account ca: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("kubernetes: no certificates found in %s", serviceAccountCAFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    roots,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	apiURL := &url.URL{Scheme: "https", Host: net.JoinHostPort(host, port)}
+	return NewClient(apiURL, serviceAccountTokenFile, &http.Client{Transport: transport}), nil
+}
+
+type objectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Annotations     map[string]string `json:"annotations"`
+}
+
+type object struct {
+	Metadata objectMeta `json:"metadata"`
+}
+
+type objectList struct {
+	Metadata objectMeta        `json:"metadata"`
+	Items    []json.RawMessage `json:"items"`
+}
+
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// list lists the resources at path.
+func (c *Client) list(ctx context.Context, path string) (*objectList, error) {
+	res, err := c.do(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var list objectList
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("kubernetes: error decoding %s: %w", path, err)
+	}
+	return &list, nil
+}
+
+// watch watches the resources at path starting from resourceVersion, calling fn for every change. It blocks
+// until the server closes the watch, an error occurs or the context is canceled.
+func (c *Client) watch(ctx context.Context, path, resourceVersion string, fn func(*watchEvent)) error {
+	res, err := c.do(ctx, path, url.Values{
+		"watch":               {"1"},
+		"resourceVersion":     {resourceVersion},
+		"allowWatchBookmarks": {"true"},
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var evt watchEvent
+		if err := decoder.Decode(&evt); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("kubernetes: error decoding watch event: %w", err)
+		}
+
+		if evt.Type == "ERROR" {
+			var st status
+			_ = json.Unmarshal(evt.Object, &st)
+			if st.Code == http.StatusGone {
+				return errGone
+			}
+			return fmt.Errorf("kubernetes: watch error: %s", st.Message)
+		}
+
+		fn(&evt)
+	}
+}
+
+func (c *Client) do(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := c.apiURL.ResolveReference(&url.URL{Path: path, RawQuery: query.Encode()})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.tokenFile != "" {
+		token, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes: error reading service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		var st status
+		_ = json.NewDecoder(res.Body).Decode(&st)
+		if res.StatusCode == http.StatusGone {
+			return nil, errGone
+		}
+		return nil, fmt.Errorf("kubernetes: unexpected status code for %s: %d %s", path, res.StatusCode, st.Message)
+	}
+	return res, nil
+}
@@ -0,0 +1,242 @@
+// Package kubernetes contains a config source which generates routes from Kubernetes Ingress resources and
+// pomerium.io Policy custom resources.
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/hashutil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
+)
+
+// ConfigSource provides a new Config source that decorates an underlying config with routes generated from
+// Kubernetes resources.
+type ConfigSource struct {
+	mu               sync.RWMutex
+	computedConfig   *config.Config
+	underlyingConfig *config.Config
+	watchers         []*watcher
+	watcherHash      uint64
+	cancel           func()
+	newClient        func() (*Client, error)
+
+	config.ChangeDispatcher
+}
+
+// NewConfigSource creates a new ConfigSource. When the kubernetes controller is enabled, resources are
+// watched using the pod's service account.
+func NewConfigSource(ctx context.Context, underlying config.Source, listeners ...config.ChangeListener) *ConfigSource {
+	return newConfigSource(ctx, underlying, NewInClusterClient, listeners...)
+}
+
+func newConfigSource(
+	ctx context.Context,
+	underlying config.Source,
+	newClient func() (*Client, error),
+	listeners ...config.ChangeListener,
+) *ConfigSource {
+	src := &ConfigSource{
+		newClient: newClient,
+	}
+	for _, li := range listeners {
+		src.OnConfigChange(ctx, li)
+	}
+	underlying.OnConfigChange(ctx, func(ctx context.Context, cfg *config.Config) {
+		src.mu.Lock()
+		src.underlyingConfig = cfg.Clone()
+		src.mu.Unlock()
+
+		src.rebuild(ctx, firstTime(false))
+	})
+	src.underlyingConfig = underlying.GetConfig()
+	src.rebuild(ctx, firstTime(true))
+	return src
+}
+
+// GetConfig gets the current config.
+func (src *ConfigSource) GetConfig() *config.Config {
+	src.mu.RLock()
+	defer src.mu.RUnlock()
+
+	return src.computedConfig
+}
+
+type firstTime bool
+
+func (src *ConfigSource) rebuild(ctx context.Context, firstTime firstTime) {
+	_, span := trace.StartSpan(ctx, "kubernetes.config_source.rebuild")
+	defer span.End()
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	cfg := src.underlyingConfig.Clone()
+
+	src.runWatchers(cfg.Options)
+
+	if cfg.Options.KubernetesController {
+		// add the additional policies here since calling `Validate` will reset them.
+		cfg.Options.AdditionalPolicies = append(cfg.Options.AdditionalPolicies, src.buildPolicies(ctx, cfg.Options)...)
+	}
+
+	src.computedConfig = cfg
+	if !firstTime {
+		src.Trigger(ctx, cfg)
+	}
+}
+
+func (src *ConfigSource) runWatchers(options *config.Options) {
+	h, err := hashutil.Hash(struct {
+		Enabled    bool
+		Namespaces []string
+	}{options.KubernetesController, options.KubernetesNamespaces})
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	// nothing changed, so don't restart the watchers
+	if src.watcherHash == h {
+		return
+	}
+	src.watcherHash = h
+
+	if src.cancel != nil {
+		src.cancel()
+		src.cancel = nil
+	}
+	src.watchers = nil
+
+	if !options.KubernetesController {
+		return
+	}
+
+	ctx := context.Background()
+	ctx, src.cancel = context.WithCancel(ctx)
+
+	client, err := src.newClient()
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("kubernetes: failed to create kubernetes client")
+		return
+	}
+
+	namespaces := options.KubernetesNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	for _, namespace := range namespaces {
+		for _, kind := range []resourceKind{resourceKindIngress, resourceKindPolicy} {
+			w := newWatcher(client, kind, namespace)
+			src.watchers = append(src.watchers, w)
+			go w.run(ctx, func() { src.rebuild(ctx, firstTime(false)) })
+		}
+	}
+}
+
+func (src *ConfigSource) buildPolicies(ctx context.Context, options *config.Options) []config.Policy {
+	seen := map[uint64]struct{}{}
+	for _, policy := range options.GetAllPolicies() {
+		if id, err := policy.RouteID(); err == nil {
+			seen[id] = struct{}{}
+		}
+	}
+
+	var policies []config.Policy
+	add := func(resource string, resourcePolicies ...config.Policy) {
+		for _, policy := range resourcePolicies {
+			policy := policy
+			if err := policy.Validate(); err != nil {
+				log.Warn(ctx).Err(err).
+					Str("resource", resource).
+					Str("policy", policy.String()).
+					Msg("kubernetes: invalid policy, ignoring")
+				continue
+			}
+
+			routeID, err := policy.RouteID()
+			if err != nil {
+				log.Warn(ctx).Err(err).
+					Str("resource", resource).
+					Str("policy", policy.String()).
+					Msg("kubernetes: cannot establish policy route ID, ignoring")
+				continue
+			}
+
+			if _, ok := seen[routeID]; ok {
+				log.Warn(ctx).
+					Str("resource", resource).
+					Str("policy", policy.String()).
+					Msg("kubernetes: duplicate policy detected, ignoring")
+				continue
+			}
+			seen[routeID] = struct{}{}
+
+			policies = append(policies, policy)
+		}
+	}
+
+	class := options.GetKubernetesIngressClass()
+	for _, w := range src.watchers {
+		for _, raw := range w.getObjects() {
+			switch w.kind {
+			case resourceKindIngress:
+				var ing ingress
+				if err := json.Unmarshal(raw, &ing); err != nil {
+					log.Warn(ctx).Err(err).Msg("kubernetes: error decoding ingress, ignoring")
+					continue
+				}
+				if !ing.hasClass(class) {
+					continue
+				}
+				resource := "ingress/" + getObjectKey(&object{Metadata: ing.Metadata})
+				ingPolicies, err := ing.policies(options.KubernetesAllowedAnnotations)
+				if err != nil {
+					log.Warn(ctx).Err(err).Str("resource", resource).Msg("kubernetes: invalid ingress, ignoring")
+					continue
+				}
+				add(resource, ingPolicies...)
+			case resourceKindPolicy:
+				var p policyResource
+				if err := json.Unmarshal(raw, &p); err != nil {
+					log.Warn(ctx).Err(err).Msg("kubernetes: error decoding policy, ignoring")
+					continue
+				}
+				resource := "policy/" + getObjectKey(&object{Metadata: p.Metadata})
+				policy, err := p.policy()
+				if err != nil {
+					log.Warn(ctx).Err(err).Str("resource", resource).Msg("kubernetes: invalid policy, ignoring")
+					continue
+				}
+				add(resource, *policy)
+			}
+		}
+	}
+
+	sortPolicies(policies)
+	return policies
+}
+
+// sortPolicies sorts the policies so that the most specific route for a host is matched first: exact paths,
+// then prefixes from longest to shortest, then everything else.
+func sortPolicies(policies []config.Policy) {
+	specificity := func(p *config.Policy) int {
+		switch {
+		case p.Path != "":
+			return 1 << 30
+		case p.Prefix != "":
+			return len(p.Prefix)
+		default:
+			return 0
+		}
+	}
+	sort.SliceStable(policies, func(i, j int) bool {
+		if hi, hj := strings.ToLower(policies[i].Source.Host), strings.ToLower(policies[j].Source.Host); hi != hj {
+			return hi < hj
+		}
+		return specificity(&policies[i]) > specificity(&policies[j])
+	})
+}
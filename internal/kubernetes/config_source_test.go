@@ -0,0 +1,134 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+const testIngress = `{
+	"metadata": {"name": "%s", "namespace": "apps", "resourceVersion": "%d"},
+	"spec": {
+		"ingressClassName": "%s",
+		"rules": [{
+			"host": "%s",
+			"http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "httpbin", "port": {"number": 80}}}}]}
+		}]
+	}
+}`
+
+func TestConfigSource(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer clearTimeout()
+
+	ingressEvents := make(chan string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer TOKEN", r.Header.Get("Authorization"))
+		switch {
+		case r.URL.Path == "/apis/networking.k8s.io/v1/namespaces/apps/ingresses" && r.FormValue("watch") == "":
+			fmt.Fprintf(w, `{"metadata": {"resourceVersion": "1"}, "items": [`+testIngress+`, `+testIngress+`]}`,
+				"httpbin", 1, "pomerium", "httpbin.example.com",
+				"other", 1, "nginx", "ignored.example.com")
+		case r.URL.Path == "/apis/networking.k8s.io/v1/namespaces/apps/ingresses":
+			assert.Equal(t, "1", r.FormValue("resourceVersion"))
+			w.(http.Flusher).Flush()
+			select {
+			case evt := <-ingressEvents:
+				fmt.Fprintln(w, evt)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+			}
+			<-r.Context().Done()
+		case r.URL.Path == "/apis/pomerium.io/v1alpha1/namespaces/apps/policies" && r.FormValue("watch") == "":
+			fmt.Fprint(w, `{"metadata": {"resourceVersion": "1"}, "items": [{
+				"metadata": {"name": "policy", "namespace": "apps"},
+				"spec": {"from": "https://policy.example.com", "to": "http://policy.apps.svc.cluster.local", "allow_any_authenticated_user": true}
+			}]}`)
+		case r.URL.Path == "/apis/pomerium.io/v1alpha1/namespaces/apps/policies":
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	apiURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	tokenFile := t.TempDir() + "/token"
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("TOKEN\n"), 0o600))
+
+	opts := config.NewDefaultOptions()
+	opts.KubernetesController = true
+	opts.KubernetesNamespaces = []string{"apps"}
+
+	changes := make(chan *config.Config, 10)
+	src := newConfigSource(ctx, config.NewStaticSource(&config.Config{Options: opts}), func() (*Client, error) {
+		return NewClient(apiURL, tokenFile, srv.Client()), nil
+	}, func(ctx context.Context, cfg *config.Config) {
+		changes <- cfg
+	})
+	defer src.cancel()
+
+	waitForRoutes := func(expected ...string) {
+		t.Helper()
+		for {
+			var froms []string
+			for _, p := range src.GetConfig().Options.AdditionalPolicies {
+				froms = append(froms, p.From)
+			}
+			if assert.ObjectsAreEqual(expected, froms) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("expected routes %v, got %v", expected, froms)
+			case <-changes:
+			}
+		}
+	}
+
+	waitForRoutes("https://httpbin.example.com", "https://policy.example.com")
+
+	ingressEvents <- `{"type": "MODIFIED", "object": ` + fmt.Sprintf(testIngress, "httpbin", 2, "pomerium", "httpbin2.example.com") + `}`
+	waitForRoutes("https://httpbin2.example.com", "https://policy.example.com")
+}
+
+func TestSortPolicies(t *testing.T) {
+	var err error
+	var policies []config.Policy
+	for _, p := range []config.Policy{
+		{From: "https://b.example.com"},
+		{From: "https://a.example.com", Prefix: "/a"},
+		{From: "https://a.example.com"},
+		{From: "https://a.example.com", Prefix: "/a/b"},
+		{From: "https://a.example.com", Path: "/a/b/c"},
+	} {
+		p.To, err = config.ParseWeightedUrls("https://to.example.com")
+		require.NoError(t, err)
+		require.NoError(t, p.Validate())
+		policies = append(policies, p)
+	}
+	sortPolicies(policies)
+
+	var actual []string
+	for _, p := range policies {
+		actual = append(actual, p.From+p.Path+p.Prefix)
+	}
+	assert.Equal(t, []string{
+		"https://a.example.com/a/b/c",
+		"https://a.example.com/a/b",
+		"https://a.example.com/a",
+		"https://a.example.com",
+		"https://b.example.com",
+	}, actual)
+}
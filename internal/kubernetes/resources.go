@@ -0,0 +1,226 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/pomerium/pomerium/config"
+)
+
+const (
+	// annotationPrefix is the prefix of ingress annotations containing route settings, e.g.
+	// ingress.pomerium.io/allowed_users.
+	annotationPrefix = "ingress.pomerium.io/"
+	// annotationSecureUpstream makes routes connect to the backend service with https.
+	annotationSecureUpstream = annotationPrefix + "secure_upstream"
+	// annotationIngressClass is the deprecated annotation used to select the ingress class.
+	annotationIngressClass = "kubernetes.io/ingress.class"
+
+	pathTypeExact = "Exact"
+)
+
+// annotationSettings are the route settings ingress annotations may set. Settings which bypass authorization,
+// set request headers or make pomerium read local files, such as allow_public_unauthenticated_access,
+// set_request_headers or tls_client_key_file, are only allowed if listed in kubernetes_allowed_annotations.
+var annotationSettings = map[string]struct{}{
+	"allowed_users":                        {},
+	"allowed_groups":                       {},
+	"allowed_domains":                      {},
+	"allowed_idp_claims":                   {},
+	"policy_sets":                          {},
+	"listeners":                            {},
+	"prefix_rewrite":                       {},
+	"regex_rewrite_pattern":                {},
+	"regex_rewrite_substitution":           {},
+	"host_rewrite":                         {},
+	"host_rewrite_header":                  {},
+	"host_path_regex_rewrite_pattern":      {},
+	"host_path_regex_rewrite_substitution": {},
+	"timeout":                              {},
+	"idle_timeout":                         {},
+	"max_stream_duration":                  {},
+	"max_request_body_size":                {},
+	"buffer_request_body":                  {},
+	"allow_websockets":                     {},
+	"allow_spdy":                           {},
+	"tls_server_name":                      {},
+	"preserve_host_header":                 {},
+	"pass_identity_headers":                {},
+	"jwt_claims_headers":                   {},
+	"remove_request_headers":               {},
+	"rewrite_response_headers":             {},
+	"set_response_headers":                 {},
+	"security_headers":                     {},
+	"cache":                                {},
+	"compression":                          {},
+	"maintenance":                          {},
+	"maintenance_message":                  {},
+	"maintenance_retry_after":              {},
+	"local_rate_limit":                     {},
+	"max_concurrent_requests_per_user":     {},
+}
+
+type ingress struct {
+	Metadata objectMeta  `json:"metadata"`
+	Spec     ingressSpec `json:"spec"`
+}
+
+type ingressSpec struct {
+	IngressClassName *string       `json:"ingressClassName"`
+	Rules            []ingressRule `json:"rules"`
+}
+
+type ingressRule struct {
+	Host string `json:"host"`
+	HTTP *struct {
+		Paths []ingressPath `json:"paths"`
+	} `json:"http"`
+}
+
+type ingressPath struct {
+	Path     string         `json:"path"`
+	PathType string         `json:"pathType"`
+	Backend  ingressBackend `json:"backend"`
+}
+
+type ingressBackend struct {
+	Service *struct {
+		Name string `json:"name"`
+		Port struct {
+			Name   string `json:"name"`
+			Number int    `json:"number"`
+		} `json:"port"`
+	} `json:"service"`
+}
+
+// hasClass returns true if the ingress should be handled by the controller for the given ingress class.
+func (ing *ingress) hasClass(class string) bool {
+	if ing.Spec.IngressClassName != nil {
+		return *ing.Spec.IngressClassName == class
+	}
+	return ing.Metadata.Annotations[annotationIngressClass] == class
+}
+
+// policies returns the routes for the ingress. Every path of every rule becomes a route from the rule's host
+// to the backend service, with the route settings from the ingress annotations. allowedAnnotations are the
+// settings annotations may set in addition to the safe ones.
+func (ing *ingress) policies(allowedAnnotations []string) ([]config.Policy, error) {
+	settings, err := getAnnotationSettings(ing.Metadata.Annotations, allowedAnnotations)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if v, ok := ing.Metadata.Annotations[annotationSecureUpstream]; ok {
+		secure, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", annotationSecureUpstream, err)
+		}
+		if secure {
+			scheme = "https"
+		}
+	}
+
+	var policies []config.Policy
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host == "" {
+			return nil, fmt.Errorf("rules without a host are not supported")
+		}
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			to, err := ing.getBackendURL(scheme, path.Backend)
+			if err != nil {
+				return nil, err
+			}
+
+			m := make(map[string]interface{}, len(settings)+3)
+			for k, v := range settings {
+				m[k] = v
+			}
+			m["from"] = (&url.URL{Scheme: "https", Host: rule.Host}).String()
+			m["to"] = to
+			switch {
+			case path.PathType == pathTypeExact:
+				m["path"] = path.Path
+			case path.Path != "" && path.Path != "/":
+				m["prefix"] = path.Path
+			}
+
+			policy, err := config.NewPolicyFromMap(m)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, *policy)
+		}
+	}
+	return policies, nil
+}
+
+func (ing *ingress) getBackendURL(scheme string, backend ingressBackend) (string, error) {
+	svc := backend.Service
+	if svc == nil {
+		return "", fmt.Errorf("only service backends are supported")
+	}
+	if svc.Port.Number == 0 {
+		return "", fmt.Errorf("service %s: only numeric service ports are supported", svc.Name)
+	}
+	host := fmt.Sprintf("%s.%s.svc.cluster.local", svc.Name, ing.Metadata.Namespace)
+	return (&url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(host, strconv.Itoa(svc.Port.Number)),
+	}).String(), nil
+}
+
+// getAnnotationSettings returns the route settings in the annotations. Values are YAML, so lists and objects
+// can be used, e.g. `ingress.pomerium.io/allowed_domains: '["example.com"]'`. Only the annotationSettings and
+// allowedAnnotations may be set.
+func getAnnotationSettings(annotations map[string]string, allowedAnnotations []string) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+	for k, v := range annotations {
+		if !strings.HasPrefix(k, annotationPrefix) || k == annotationSecureUpstream {
+			continue
+		}
+		key := strings.TrimPrefix(k, annotationPrefix)
+		switch key {
+		case "from", "to", "prefix", "path", "regex":
+			return nil, fmt.Errorf("annotation %s is not allowed, it is derived from the ingress rules", k)
+		}
+		if _, ok := annotationSettings[key]; !ok && !containsString(allowedAnnotations, key) {
+			return nil, fmt.Errorf("annotation %s is not allowed, it must be listed in kubernetes_allowed_annotations", k)
+		}
+
+		var value interface{}
+		if err := yaml.Unmarshal([]byte(v), &value); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", k, err)
+		}
+		settings[key] = value
+	}
+	return settings, nil
+}
+
+// A policyResource is a pomerium.io/v1alpha1 Policy custom resource. Its spec contains the same settings as a
+// `policy` entry in the config file.
+type policyResource struct {
+	Metadata objectMeta             `json:"metadata"`
+	Spec     map[string]interface{} `json:"spec"`
+}
+
+func (p *policyResource) policy() (*config.Policy, error) {
+	return config.NewPolicyFromMap(p.Spec)
+}
+
+func containsString(xs []string, x string) bool {
+	for _, s := range xs {
+		if s == x {
+			return true
+		}
+	}
+	return false
+}
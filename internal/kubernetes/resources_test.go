@@ -0,0 +1,116 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngressPolicies(t *testing.T) {
+	var ing ingress
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"metadata": {
+			"name": "httpbin",
+			"namespace": "apps",
+			"annotations": {
+				"ingress.pomerium.io/allowed_domains": "[\"example.com\", \"example.org\"]",
+				"ingress.pomerium.io/pass_identity_headers": "true",
+				"ingress.pomerium.io/timeout": "10s"
+			}
+		},
+		"spec": {
+			"ingressClassName": "pomerium",
+			"rules": [{
+				"host": "httpbin.example.com",
+				"http": {
+					"paths": [
+						{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "httpbin", "port": {"number": 80}}}},
+						{"path": "/admin", "pathType": "Exact", "backend": {"service": {"name": "admin", "port": {"number": 8080}}}},
+						{"path": "/api", "pathType": "ImplementationSpecific", "backend": {"service": {"name": "api", "port": {"number": 8000}}}}
+					]
+				}
+			}]
+		}
+	}`), &ing))
+
+	assert.True(t, ing.hasClass("pomerium"))
+	assert.False(t, ing.hasClass("nginx"))
+
+	policies, err := ing.policies(nil)
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+
+	for _, p := range policies {
+		assert.Equal(t, "https://httpbin.example.com", p.From)
+		assert.Equal(t, []string{"example.com", "example.org"}, p.AllowedDomains)
+		assert.True(t, p.PassIdentityHeaders)
+		assert.Equal(t, "10s", p.UpstreamTimeout.String())
+	}
+	assert.Equal(t, "http://httpbin.apps.svc.cluster.local:80", policies[0].To[0].URL.String())
+	assert.Empty(t, policies[0].Prefix)
+	assert.Equal(t, "http://admin.apps.svc.cluster.local:8080", policies[1].To[0].URL.String())
+	assert.Equal(t, "/admin", policies[1].Path)
+	assert.Equal(t, "/api", policies[2].Prefix)
+
+	t.Run("secure upstream", func(t *testing.T) {
+		ing := ing
+		ing.Metadata.Annotations = map[string]string{annotationSecureUpstream: "true"}
+		policies, err := ing.policies(nil)
+		require.NoError(t, err)
+		assert.Equal(t, "https", policies[0].To[0].URL.Scheme)
+	})
+	t.Run("derived settings", func(t *testing.T) {
+		ing := ing
+		ing.Metadata.Annotations = map[string]string{annotationPrefix + "to": "https://example.com"}
+		_, err := ing.policies(nil)
+		assert.Error(t, err)
+	})
+	t.Run("unsafe settings", func(t *testing.T) {
+		for _, setting := range []string{
+			"allow_public_unauthenticated_access",
+			"set_request_headers",
+			"tls_client_key_file",
+			"kubernetes_service_account_token_file",
+		} {
+			ing := ing
+			ing.Metadata.Annotations = map[string]string{annotationPrefix + setting: "true"}
+			_, err := ing.policies(nil)
+			assert.Error(t, err, setting)
+		}
+
+		ing := ing
+		ing.Metadata.Annotations = map[string]string{annotationPrefix + "allow_public_unauthenticated_access": "true"}
+		policies, err := ing.policies([]string{"allow_public_unauthenticated_access"})
+		require.NoError(t, err)
+		assert.True(t, policies[0].AllowPublicUnauthenticatedAccess, "settings should be allowed by the operator")
+	})
+	t.Run("class annotation", func(t *testing.T) {
+		ing := ing
+		ing.Spec.IngressClassName = nil
+		ing.Metadata.Annotations = map[string]string{annotationIngressClass: "pomerium"}
+		assert.True(t, ing.hasClass("pomerium"))
+	})
+}
+
+func TestPolicyResource(t *testing.T) {
+	var p policyResource
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"metadata": {"name": "httpbin", "namespace": "apps"},
+		"spec": {
+			"from": "https://httpbin.example.com",
+			"to": ["http://httpbin.apps.svc.cluster.local"],
+			"allowed_users": ["user@example.com"],
+			"set_request_headers": {"X-Test": "1"}
+		}
+	}`), &p))
+
+	policy, err := p.policy()
+	require.NoError(t, err)
+	require.NoError(t, policy.Validate())
+	assert.Equal(t, "https://httpbin.example.com", policy.Source.String())
+	assert.Equal(t, "http://httpbin.apps.svc.cluster.local", policy.To[0].URL.String())
+	assert.Equal(t, []string{"user@example.com"}, policy.AllowedUsers)
+	assert.Equal(t, map[string]string{"X-Test": "1"}, policy.SetRequestHeaders)
+}
@@ -0,0 +1,150 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+type resourceKind string
+
+const (
+	resourceKindIngress resourceKind = "ingress"
+	resourceKindPolicy  resourceKind = "policy"
+)
+
+func getResourcePath(kind resourceKind, namespace string) string {
+	prefix, plural := "/apis/networking.k8s.io/v1", "ingresses"
+	if kind == resourceKindPolicy {
+		prefix, plural = "/apis/pomerium.io/v1alpha1", "policies"
+	}
+	if namespace == "" {
+		return path.Join(prefix, plural)
+	}
+	return path.Join(prefix, "namespaces", namespace, plural)
+}
+
+// A watcher keeps a local copy of the resources at a path up to date by listing and then watching them.
+type watcher struct {
+	client *Client
+	kind   resourceKind
+	path   string
+
+	mu      sync.Mutex
+	objects map[string]json.RawMessage
+}
+
+func newWatcher(client *Client, kind resourceKind, namespace string) *watcher {
+	return &watcher{
+		client:  client,
+		kind:    kind,
+		path:    getResourcePath(kind, namespace),
+		objects: make(map[string]json.RawMessage),
+	}
+}
+
+// run watches the resources until the context is canceled, calling onChange whenever they change.
+func (w *watcher) run(ctx context.Context, onChange func()) {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxInterval = time.Minute
+	bo.MaxElapsedTime = 0
+
+	for {
+		err := w.sync(ctx, bo, onChange)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errGone) {
+			// the resource version expired, so list the resources again
+			continue
+		}
+
+		log.Warn(ctx).Err(err).Str("path", w.path).Msg("kubernetes: error watching resources")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bo.NextBackOff()):
+		}
+	}
+}
+
+func (w *watcher) sync(ctx context.Context, bo backoff.BackOff, onChange func()) error {
+	list, err := w.client.list(ctx, w.path)
+	if err != nil {
+		return err
+	}
+
+	objects := make(map[string]json.RawMessage, len(list.Items))
+	for _, item := range list.Items {
+		var obj object
+		if err := json.Unmarshal(item, &obj); err != nil {
+			return err
+		}
+		objects[getObjectKey(&obj)] = item
+	}
+	w.mu.Lock()
+	w.objects = objects
+	w.mu.Unlock()
+	onChange()
+	bo.Reset()
+
+	resourceVersion := list.Metadata.ResourceVersion
+	for {
+		err := w.client.watch(ctx, w.path, resourceVersion, func(evt *watchEvent) {
+			var obj object
+			if err := json.Unmarshal(evt.Object, &obj); err != nil {
+				log.Warn(ctx).Err(err).Str("path", w.path).Msg("kubernetes: error decoding watch event")
+				return
+			}
+			resourceVersion = obj.Metadata.ResourceVersion
+
+			w.mu.Lock()
+			switch evt.Type {
+			case "ADDED", "MODIFIED":
+				w.objects[getObjectKey(&obj)] = evt.Object
+			case "DELETED":
+				delete(w.objects, getObjectKey(&obj))
+			default:
+				// bookmarks only update the resource version
+				w.mu.Unlock()
+				return
+			}
+			w.mu.Unlock()
+			onChange()
+		})
+		if err != nil {
+			return err
+		}
+		// the server closed the watch, so resume it
+	}
+}
+
+// getObjects returns the current resources sorted by namespace and name.
+func (w *watcher) getObjects() []json.RawMessage {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	keys := make([]string, 0, len(w.objects))
+	for k := range w.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	objects := make([]json.RawMessage, 0, len(keys))
+	for _, k := range keys {
+		objects = append(objects, w.objects[k])
+	}
+	return objects
+}
+
+func getObjectKey(obj *object) string {
+	return obj.Metadata.Namespace + "/" + obj.Metadata.Name
+}
@@ -0,0 +1,41 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+func TestAccessOutput(t *testing.T) {
+	defer func() {
+		log.SetOutput(nil)
+		log.SetAccessOutput(nil)
+		log.DisableDebug()
+	}()
+
+	var app, access bytes.Buffer
+	log.SetOutput(&app)
+	log.DisableDebug()
+
+	ctx := log.WithContext(context.Background(), func(c zerolog.Context) zerolog.Context {
+		return c.Str("request-id", "REQUEST_ID")
+	})
+
+	log.AccessInfo(ctx).Msg("access 1")
+	assert.Contains(t, app.String(), `"message":"access 1"`, "should be written with the application logs by default")
+
+	app.Reset()
+	log.SetAccessOutput(&access)
+	log.AccessInfo(ctx).Msg("access 2")
+	log.Info(ctx).Msg("app")
+	assert.Contains(t, access.String(), `"request-id":"REQUEST_ID"`)
+	assert.Contains(t, access.String(), `"message":"access 2"`)
+	assert.NotContains(t, access.String(), `"message":"app"`)
+	assert.Contains(t, app.String(), `"message":"app"`)
+	assert.NotContains(t, app.String(), `"message":"access 2"`)
+}
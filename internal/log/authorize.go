@@ -0,0 +1,166 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// AuthorizeDecisionMetadataNamespace is the namespace of the envoy dynamic metadata authorize uses to add its
+// decision to the envoy access log entry of a request.
+const AuthorizeDecisionMetadataNamespace = "envoy.filters.http.ext_authz"
+
+// An AuthorizeLogField is a field in the authorize check logs.
+type AuthorizeLogField string
+
+// known authorize log fields
+const (
+	AuthorizeLogFieldAllow                   AuthorizeLogField = "allow"
+	AuthorizeLogFieldCheckRequestID          AuthorizeLogField = "check-request-id"
+	AuthorizeLogFieldDataBrokerRecordVersion AuthorizeLogField = "databroker_record_version"
+	AuthorizeLogFieldDataBrokerServerVersion AuthorizeLogField = "databroker_server_version"
+	AuthorizeLogFieldDeny                    AuthorizeLogField = "deny"
+	AuthorizeLogFieldEmail                   AuthorizeLogField = "email"
+	AuthorizeLogFieldErrorCode               AuthorizeLogField = "error-code"
+	AuthorizeLogFieldHeaders                 AuthorizeLogField = "headers"
+	AuthorizeLogFieldHost                    AuthorizeLogField = "host"
+	AuthorizeLogFieldImpersonateEmail        AuthorizeLogField = "impersonate-email"
+	AuthorizeLogFieldImpersonateGroups       AuthorizeLogField = "impersonate-groups"
+	AuthorizeLogFieldImpersonateUserID       AuthorizeLogField = "impersonate-user-id"
+	AuthorizeLogFieldIP                      AuthorizeLogField = "ip"
+	AuthorizeLogFieldMethod                  AuthorizeLogField = "method"
+	AuthorizeLogFieldPath                    AuthorizeLogField = "path"
+	AuthorizeLogFieldQuery                   AuthorizeLogField = "query"
+	AuthorizeLogFieldRequestID               AuthorizeLogField = "request-id"
+	AuthorizeLogFieldRouteID                 AuthorizeLogField = "route-id"
+	AuthorizeLogFieldServiceAccountID        AuthorizeLogField = "service-account-id"
+	AuthorizeLogFieldSessionID               AuthorizeLogField = "session-id"
+	AuthorizeLogFieldUser                    AuthorizeLogField = "user"
+)
+
+// Prefixes of authorize log fields which log a single request header or JWT claim, e.g.
+// headers.user-agent or claims.groups.
+const (
+	AuthorizeLogFieldHeaderPrefix = "headers."
+	AuthorizeLogFieldClaimPrefix  = "claims."
+)
+
+var knownAuthorizeLogFields = map[AuthorizeLogField]struct{}{
+	AuthorizeLogFieldAllow:                   {},
+	AuthorizeLogFieldCheckRequestID:          {},
+	AuthorizeLogFieldDataBrokerRecordVersion: {},
+	AuthorizeLogFieldDataBrokerServerVersion: {},
+	AuthorizeLogFieldDeny:                    {},
+	AuthorizeLogFieldEmail:                   {},
+	AuthorizeLogFieldErrorCode:               {},
+	AuthorizeLogFieldHeaders:                 {},
+	AuthorizeLogFieldHost:                    {},
+	AuthorizeLogFieldImpersonateEmail:        {},
+	AuthorizeLogFieldImpersonateGroups:       {},
+	AuthorizeLogFieldImpersonateUserID:       {},
+	AuthorizeLogFieldIP:                      {},
+	AuthorizeLogFieldMethod:                  {},
+	AuthorizeLogFieldPath:                    {},
+	AuthorizeLogFieldQuery:                   {},
+	AuthorizeLogFieldRequestID:               {},
+	AuthorizeLogFieldRouteID:                 {},
+	AuthorizeLogFieldServiceAccountID:        {},
+	AuthorizeLogFieldSessionID:               {},
+	AuthorizeLogFieldUser:                    {},
+}
+
+// ErrUnknownAuthorizeLogField indicates that an authorize log field is unknown.
+var ErrUnknownAuthorizeLogField = errors.New("unknown authorize log field")
+
+// Validate returns an error if the authorize log field is unknown.
+func (field AuthorizeLogField) Validate() error {
+	if name, ok := field.Header(); ok {
+		if name == "" {
+			return fmt.Errorf("%w: %s", ErrUnknownAuthorizeLogField, field)
+		}
+		return nil
+	}
+	if name, ok := field.Claim(); ok {
+		if name == "" {
+			return fmt.Errorf("%w: %s", ErrUnknownAuthorizeLogField, field)
+		}
+		return nil
+	}
+	if _, ok := knownAuthorizeLogFields[field]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAuthorizeLogField, field)
+	}
+	return nil
+}
+
+// Header returns the name of the request header logged by the field, if it's a headers.<name> field.
+func (field AuthorizeLogField) Header() (name string, ok bool) {
+	if !strings.HasPrefix(string(field), AuthorizeLogFieldHeaderPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(string(field), AuthorizeLogFieldHeaderPrefix), true
+}
+
+// Claim returns the name of the JWT claim logged by the field, if it's a claims.<name> field.
+func (field AuthorizeLogField) Claim() (name string, ok bool) {
+	if !strings.HasPrefix(string(field), AuthorizeLogFieldClaimPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(string(field), AuthorizeLogFieldClaimPrefix), true
+}
+
+// DefaultAuthorizeLogFields returns the fields logged when none are configured. The request headers
+// are potentially sensitive, so they're only included in debug mode.
+func DefaultAuthorizeLogFields() []AuthorizeLogField {
+	fields := []AuthorizeLogField{
+		AuthorizeLogFieldRequestID,
+		AuthorizeLogFieldCheckRequestID,
+		AuthorizeLogFieldMethod,
+		AuthorizeLogFieldPath,
+		AuthorizeLogFieldHost,
+		AuthorizeLogFieldQuery,
+		AuthorizeLogFieldSessionID,
+		AuthorizeLogFieldImpersonateEmail,
+		AuthorizeLogFieldImpersonateGroups,
+		AuthorizeLogFieldImpersonateUserID,
+		AuthorizeLogFieldServiceAccountID,
+		AuthorizeLogFieldAllow,
+		AuthorizeLogFieldDeny,
+		AuthorizeLogFieldErrorCode,
+		AuthorizeLogFieldUser,
+		AuthorizeLogFieldEmail,
+		AuthorizeLogFieldDataBrokerServerVersion,
+		AuthorizeLogFieldDataBrokerRecordVersion,
+	}
+	if zerolog.GlobalLevel() <= zerolog.DebugLevel {
+		fields = append(fields, AuthorizeLogFieldHeaders)
+	}
+	return fields
+}
+
+// An AuthorizeLogFormat is the format of the authorize check logs.
+type AuthorizeLogFormat string
+
+// known authorize log formats
+const (
+	// AuthorizeLogFormatJSON logs the selected fields using their pomerium names. It's the default.
+	AuthorizeLogFormatJSON AuthorizeLogFormat = "json"
+	// AuthorizeLogFormatECS logs the selected fields using Elastic Common Schema names.
+	AuthorizeLogFormatECS AuthorizeLogFormat = "ecs"
+	// AuthorizeLogFormatCombined logs the request as an Apache combined log line.
+	AuthorizeLogFormatCombined AuthorizeLogFormat = "combined"
+)
+
+// ParseAuthorizeLogFormat parses an authorize log format. An empty string is the JSON format.
+func ParseAuthorizeLogFormat(raw string) (AuthorizeLogFormat, error) {
+	switch AuthorizeLogFormat(strings.TrimSpace(strings.ToLower(raw))) {
+	case "", AuthorizeLogFormatJSON:
+		return AuthorizeLogFormatJSON, nil
+	case AuthorizeLogFormatECS:
+		return AuthorizeLogFormatECS, nil
+	case AuthorizeLogFormatCombined:
+		return AuthorizeLogFormatCombined, nil
+	}
+	return AuthorizeLogFormatJSON, fmt.Errorf("unknown authorize log format: %s", raw)
+}
@@ -0,0 +1,31 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizeLogField_Validate(t *testing.T) {
+	for _, field := range []string{"email", "headers.x-custom", "claims.groups"} {
+		assert.NoError(t, AuthorizeLogField(field).Validate(), field)
+	}
+	for _, field := range []string{"unknown", "headers.", "claims."} {
+		assert.ErrorIs(t, AuthorizeLogField(field).Validate(), ErrUnknownAuthorizeLogField, field)
+	}
+}
+
+func TestParseAuthorizeLogFormat(t *testing.T) {
+	for raw, expect := range map[string]AuthorizeLogFormat{
+		"":         AuthorizeLogFormatJSON,
+		"json":     AuthorizeLogFormatJSON,
+		"ECS":      AuthorizeLogFormatECS,
+		"combined": AuthorizeLogFormatCombined,
+	} {
+		format, err := ParseAuthorizeLogFormat(raw)
+		assert.NoError(t, err, raw)
+		assert.Equal(t, expect, format, raw)
+	}
+	_, err := ParseAuthorizeLogFormat("xml")
+	assert.Error(t, err)
+}
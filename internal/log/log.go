@@ -3,6 +3,7 @@ package log
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"os"
 	"sync/atomic"
@@ -13,13 +14,31 @@ import (
 )
 
 var (
-	logger    atomic.Value
-	zapLogger atomic.Value
-	zapLevel  zap.AtomicLevel
+	logger       atomic.Value
+	zapLogger    atomic.Value
+	zapLevel     zap.AtomicLevel
+	output       atomic.Value
+	accessOutput atomic.Value
 )
 
+// writerValue wraps writers so they can be stored in an atomic.Value.
+type writerValue struct {
+	w io.Writer
+}
+
 func init() {
 	zapLevel = zap.NewAtomicLevel()
+	output.Store(writerValue{})
+	accessOutput.Store(writerValue{})
+
+	setZapOutput(nil)
+	DisableDebug()
+}
+
+func setZapOutput(w io.Writer) {
+	if w == nil {
+		w = os.Stdout
+	}
 
 	zapCfg := zap.NewProductionEncoderConfig()
 	zapCfg.TimeKey = "time"
@@ -27,23 +46,45 @@ func init() {
 
 	zapLogger.Store(zap.New(zapcore.NewCore(
 		zapcore.NewJSONEncoder(zapCfg),
-		zapcore.Lock(os.Stdout),
+		zapcore.Lock(zapcore.AddSync(w)),
 		zapLevel,
 	)))
+}
 
-	DisableDebug()
+// SetOutput sets the writer application logs are written to. If nil, they are written to stdout. It
+// must be followed by a call to DisableDebug or EnableDebug.
+func SetOutput(w io.Writer) {
+	output.Store(writerValue{w})
+	setZapOutput(w)
 }
 
-// DisableDebug tells the logger to use stdout and json output.
+// SetAccessOutput sets the writer access and audit logs are written to. If nil, they are written with
+// the application logs.
+func SetAccessOutput(w io.Writer) {
+	accessOutput.Store(writerValue{w})
+}
+
+// DisableDebug tells the logger to use json output.
 func DisableDebug() {
-	l := zerolog.New(os.Stdout).With().Timestamp().Logger()
+	w := output.Load().(writerValue).w
+	if w == nil {
+		w = os.Stdout
+	}
+	l := zerolog.New(w).With().Timestamp().Logger()
 	SetLogger(&l)
 	zapLevel.SetLevel(zapcore.InfoLevel)
 }
 
-// EnableDebug tells the logger to use stdout and pretty print output.
+// EnableDebug tells the logger to use pretty print output. Logs written to a writer other than stdout
+// stay in json.
 func EnableDebug() {
-	l := zerolog.New(os.Stdout).With().Timestamp().Logger().Output(zerolog.ConsoleWriter{Out: os.Stdout})
+	w := output.Load().(writerValue).w
+	var l zerolog.Logger
+	if w == nil {
+		l = zerolog.New(os.Stdout).With().Timestamp().Logger().Output(zerolog.ConsoleWriter{Out: os.Stdout})
+	} else {
+		l = zerolog.New(w).With().Timestamp().Logger()
+	}
 	SetLogger(&l)
 	zapLevel.SetLevel(zapcore.DebugLevel)
 }
@@ -114,6 +155,30 @@ func Warn(ctx context.Context) *zerolog.Event {
 	return contextLogger(ctx).Warn()
 }
 
+// AccessInfo starts a new access or audit log message with info level.
+//
+// You must call Msg on the returned event in order to send the event.
+func AccessInfo(ctx context.Context) *zerolog.Event {
+	return accessLogger(ctx).Info()
+}
+
+// AccessDebug starts a new access or audit log message with debug level.
+//
+// You must call Msg on the returned event in order to send the event.
+func AccessDebug(ctx context.Context) *zerolog.Event {
+	return accessLogger(ctx).Debug()
+}
+
+func accessLogger(ctx context.Context) *zerolog.Logger {
+	l := contextLogger(ctx)
+	w := accessOutput.Load().(writerValue).w
+	if w == nil {
+		return l
+	}
+	al := l.Output(w)
+	return &al
+}
+
 func contextLogger(ctx context.Context) *zerolog.Logger {
 	global := Logger()
 	if global.GetLevel() == zerolog.Disabled {
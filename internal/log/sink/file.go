@@ -0,0 +1,148 @@
+package sink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the format of the timestamp added to the name of rotated files.
+const backupTimeFormat = "20060102T150405.000"
+
+// A fileSink writes logs to a file, which is renamed and replaced by a new file when it gets too big
+// or too old.
+type fileSink struct {
+	path string
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func newFileSink(path string, opts Options) (*fileSink, error) {
+	s := &fileSink{path: path, opts: opts, now: time.Now}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if s.shouldRotate(len(p)) {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *fileSink) shouldRotate(n int) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.opts.FileMaxSize > 0 && s.size+int64(n) > s.opts.FileMaxSize {
+		return true
+	}
+	if s.opts.FileMaxAge > 0 && s.now().Sub(s.openedAt) >= s.opts.FileMaxAge {
+		return true
+	}
+	return false
+}
+
+func (s *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("log/sink: error creating log directory: %w", err)
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("log/sink: error opening log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("log/sink: error opening log file: %w", err)
+	}
+
+	s.file = f
+	s.size = fi.Size()
+	s.openedAt = s.now()
+	// an existing file is as old as its first write, which is approximated by its modification time
+	if s.size > 0 && fi.ModTime().Before(s.openedAt) {
+		s.openedAt = fi.ModTime()
+	}
+	return nil
+}
+
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("log/sink: error closing log file: %w", err)
+	}
+	s.file = nil
+
+	backup := s.path + "." + s.now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(s.path, backup); err != nil {
+		return fmt.Errorf("log/sink: error rotating log file: %w", err)
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	return s.removeOldBackups()
+}
+
+func (s *fileSink) removeOldBackups() error {
+	if s.opts.FileMaxBackups <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(s.path + ".*")
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, match := range matches {
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(match, s.path+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	if len(backups) <= s.opts.FileMaxBackups {
+		return nil
+	}
+
+	// the timestamps sort in chronological order
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-s.opts.FileMaxBackups] {
+		if err := os.Remove(backup); err != nil {
+			return fmt.Errorf("log/sink: error removing old log file: %w", err)
+		}
+	}
+	return nil
+}
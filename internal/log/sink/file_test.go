@@ -0,0 +1,105 @@
+package sink
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	readDir := func(t *testing.T, dir string) map[string]string {
+		t.Helper()
+		fis, err := ioutil.ReadDir(dir)
+		require.NoError(t, err)
+		files := map[string]string{}
+		for _, fi := range fis {
+			bs, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+			require.NoError(t, err)
+			files[fi.Name()] = string(bs)
+		}
+		return files
+	}
+
+	t.Run("size", func(t *testing.T) {
+		dir := t.TempDir()
+		now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		s := &fileSink{path: filepath.Join(dir, "logs", "pomerium.log"), opts: Options{FileMaxSize: 10}, now: func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}}
+		require.NoError(t, s.open())
+		defer s.Close()
+
+		for _, line := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+			_, err := s.Write([]byte(line))
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, map[string]string{
+			"pomerium.log":                     "line 3\n",
+			"pomerium.log.20210102T030407.000": "line 1\n",
+			"pomerium.log.20210102T030409.000": "line 2\n",
+		}, readDir(t, filepath.Join(dir, "logs")))
+	})
+	t.Run("age", func(t *testing.T) {
+		dir := t.TempDir()
+		now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		s := &fileSink{path: filepath.Join(dir, "pomerium.log"), opts: Options{FileMaxAge: time.Hour}, now: func() time.Time {
+			return now
+		}}
+		require.NoError(t, s.open())
+		defer s.Close()
+
+		_, err := s.Write([]byte("line 1\n"))
+		require.NoError(t, err)
+		now = now.Add(30 * time.Minute)
+		_, err = s.Write([]byte("line 2\n"))
+		require.NoError(t, err)
+		now = now.Add(30 * time.Minute)
+		_, err = s.Write([]byte("line 3\n"))
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]string{
+			"pomerium.log":                     "line 3\n",
+			"pomerium.log.20210102T040405.000": "line 1\nline 2\n",
+		}, readDir(t, dir))
+	})
+	t.Run("backups", func(t *testing.T) {
+		dir := t.TempDir()
+		now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+		s := &fileSink{path: filepath.Join(dir, "pomerium.log"), opts: Options{FileMaxSize: 1, FileMaxBackups: 2}, now: func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}}
+		require.NoError(t, s.open())
+		defer s.Close()
+
+		for i := 0; i < 5; i++ {
+			_, err := s.Write([]byte("line\n"))
+			require.NoError(t, err)
+		}
+
+		var names []string
+		for name := range readDir(t, dir) {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		assert.Equal(t, []string{
+			"pomerium.log",
+			"pomerium.log.20210102T030411.000",
+			"pomerium.log.20210102T030413.000",
+		}, names)
+	})
+	t.Run("closed", func(t *testing.T) {
+		s, err := newFileSink(filepath.Join(t.TempDir(), "pomerium.log"), Options{})
+		require.NoError(t, err)
+		require.NoError(t, s.Close())
+		_, err = s.Write([]byte("line\n"))
+		assert.Error(t, err)
+	})
+}
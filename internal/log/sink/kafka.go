@@ -0,0 +1,39 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// A kafkaSink publishes every log entry to a kafka topic. Messages are sent asynchronously so logging
+// never blocks on the brokers.
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSink(addrs []string, topic string) *kafkaSink {
+	return &kafkaSink{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(addrs...),
+			Topic:    topic,
+			Balancer: &kafka.RoundRobin{},
+			Async:    true,
+		},
+	}
+}
+
+func (s *kafkaSink) Write(p []byte) (int, error) {
+	// the logger reuses its buffers, so the message must be copied
+	value := append([]byte(nil), bytes.TrimRight(p, "\n")...)
+	err := s.writer.WriteMessages(context.Background(), kafka.Message{Value: value})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
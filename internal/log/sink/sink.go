@@ -0,0 +1,118 @@
+// Package sink contains writers which send logs to destinations other than stdout: rotated files,
+// syslog and kafka.
+package sink
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Options are the options for log sinks.
+type Options struct {
+	// FileMaxSize is the size in bytes after which a log file is rotated. If 0, files aren't rotated
+	// by size.
+	FileMaxSize int64
+	// FileMaxAge is the age after which a log file is rotated. If 0, files aren't rotated by age.
+	FileMaxAge time.Duration
+	// FileMaxBackups is the number of rotated log files to keep. If 0, all of them are kept.
+	FileMaxBackups int
+}
+
+// New creates a new log sink for an output, which is one of:
+//
+//   - stdout or stderr
+//   - the absolute path of a file, which is rotated according to the options
+//   - syslog://host:port or syslog+tcp://host:port, which sends RFC 5424 messages over UDP or TCP
+//   - kafka://host:port/topic, which publishes every log entry to a kafka topic. Multiple brokers can
+//     be given as a comma-separated list of hosts, e.g. kafka://kafka-1:9092,kafka-2:9092/logs.
+func New(output string, opts Options) (io.WriteCloser, error) {
+	dst, err := parse(output)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dst.kind {
+	case "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	case "file":
+		return newFileSink(dst.path, opts)
+	case "syslog":
+		return newSyslogSink(dst.network, dst.addr)
+	case "kafka":
+		return newKafkaSink(dst.addrs, dst.topic), nil
+	}
+	return nil, fmt.Errorf("log/sink: unsupported output: %s", output)
+}
+
+// Validate returns an error if the output is invalid.
+func Validate(output string) error {
+	_, err := parse(output)
+	return err
+}
+
+// IsStdout returns true if the output is stdout.
+func IsStdout(output string) bool {
+	return output == "" || output == "stdout"
+}
+
+type destination struct {
+	kind    string
+	path    string
+	network string
+	addr    string
+	addrs   []string
+	topic   string
+}
+
+func parse(output string) (*destination, error) {
+	switch output {
+	case "", "stdout":
+		return &destination{kind: "stdout"}, nil
+	case "stderr":
+		return &destination{kind: "stderr"}, nil
+	}
+
+	if !strings.Contains(output, "://") {
+		if !filepath.IsAbs(output) {
+			return nil, fmt.Errorf("log/sink: file path must be absolute: %s", output)
+		}
+		return &destination{kind: "file", path: output}, nil
+	}
+
+	u, err := url.Parse(output)
+	if err != nil {
+		return nil, fmt.Errorf("log/sink: invalid url: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("log/sink: invalid url, no host: %s", output)
+	}
+
+	switch u.Scheme {
+	case "syslog":
+		return &destination{kind: "syslog", network: "udp", addr: u.Host}, nil
+	case "syslog+tcp":
+		return &destination{kind: "syslog", network: "tcp", addr: u.Host}, nil
+	case "kafka":
+		topic := strings.Trim(u.Path, "/")
+		if topic == "" {
+			return nil, fmt.Errorf("log/sink: kafka topic is required: %s", output)
+		}
+		return &destination{kind: "kafka", addrs: strings.Split(u.Host, ","), topic: topic}, nil
+	}
+	return nil, fmt.Errorf("log/sink: unsupported url scheme: %s", u.Scheme)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,39 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	for _, output := range []string{
+		"",
+		"stdout",
+		"stderr",
+		"/var/log/pomerium.log",
+		"syslog://localhost:514",
+		"syslog+tcp://localhost:601",
+		"kafka://kafka-1:9092,kafka-2:9092/logs",
+	} {
+		assert.NoError(t, Validate(output), output)
+	}
+	for _, output := range []string{
+		"pomerium.log",
+		"syslog://",
+		"kafka://kafka-1:9092",
+		"http://localhost:8080",
+	} {
+		assert.Error(t, Validate(output), output)
+	}
+}
+
+func TestParse(t *testing.T) {
+	dst, err := parse("kafka://kafka-1:9092,kafka-2:9092/logs")
+	assert.NoError(t, err)
+	assert.Equal(t, &destination{kind: "kafka", addrs: []string{"kafka-1:9092", "kafka-2:9092"}, topic: "logs"}, dst)
+
+	dst, err = parse("syslog+tcp://localhost:601")
+	assert.NoError(t, err)
+	assert.Equal(t, &destination{kind: "syslog", network: "tcp", addr: "localhost:601"}, dst)
+}
@@ -0,0 +1,153 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	syslogAppName     = "pomerium"
+	syslogDialTimeout = 5 * time.Second
+	// syslogFacilityDaemon is the facility of all messages.
+	syslogFacilityDaemon = 3
+)
+
+// syslog severities
+const (
+	syslogSeverityEmergency = 0
+	syslogSeverityAlert     = 1
+	syslogSeverityCritical  = 2
+	syslogSeverityError     = 3
+	syslogSeverityWarning   = 4
+	syslogSeverityNotice    = 5
+	syslogSeverityInfo      = 6
+	syslogSeverityDebug     = 7
+)
+
+// A syslogSink sends every log entry as an RFC 5424 message. Over TCP, messages are framed using
+// octet counting (RFC 6587).
+type syslogSink struct {
+	network  string
+	addr     string
+	hostname string
+	pid      string
+	now      func() time.Time
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogSink(network, addr string) (*syslogSink, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &syslogSink{
+		network:  network,
+		addr:     addr,
+		hostname: hostname,
+		pid:      strconv.Itoa(os.Getpid()),
+		now:      time.Now,
+	}
+	// connect eagerly so configuration errors are reported right away
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write sends a log entry with the info severity.
+func (s *syslogSink) Write(p []byte) (int, error) {
+	return s.write(syslogSeverityInfo, p)
+}
+
+// WriteLevel sends a log entry with the severity corresponding to the zerolog level.
+func (s *syslogSink) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	return s.write(syslogSeverity(level), p)
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *syslogSink) write(severity int, p []byte) (int, error) {
+	msg := s.format(severity, p)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// if the connection was lost, reconnect and try again once
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				continue
+			}
+		}
+		if _, err = s.conn.Write(msg); err == nil {
+			return len(p), nil
+		}
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	return 0, fmt.Errorf("log/sink: error sending syslog message: %w", err)
+}
+
+func (s *syslogSink) connect() error {
+	conn, err := net.DialTimeout(s.network, s.addr, syslogDialTimeout)
+	if err != nil {
+		return fmt.Errorf("log/sink: error connecting to syslog: %w", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// format returns the message, which is:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *syslogSink) format(severity int, p []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %s - - ",
+		syslogFacilityDaemon*8+severity,
+		s.now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname, syslogAppName, s.pid)
+	buf.Write(bytes.TrimRight(p, "\n"))
+
+	if s.network == "udp" {
+		return buf.Bytes()
+	}
+	return append([]byte(strconv.Itoa(buf.Len())+" "), buf.Bytes()...)
+}
+
+func syslogSeverity(level zerolog.Level) int {
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return syslogSeverityDebug
+	case zerolog.InfoLevel:
+		return syslogSeverityInfo
+	case zerolog.WarnLevel:
+		return syslogSeverityWarning
+	case zerolog.ErrorLevel:
+		return syslogSeverityError
+	case zerolog.FatalLevel:
+		return syslogSeverityCritical
+	case zerolog.PanicLevel:
+		return syslogSeverityAlert
+	}
+	return syslogSeverityNotice
+}
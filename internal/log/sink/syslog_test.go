@@ -0,0 +1,69 @@
+package sink
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogSink(t *testing.T) {
+	now := func() time.Time {
+		return time.Date(2021, 1, 2, 3, 4, 5, 6000, time.UTC)
+	}
+
+	t.Run("udp", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		s, err := newSyslogSink("udp", conn.LocalAddr().String())
+		require.NoError(t, err)
+		defer s.Close()
+		s.hostname, s.pid, s.now = "HOST", "123", now
+
+		_, err = s.WriteLevel(zerolog.WarnLevel, []byte(`{"message":"hello"}`+"\n"))
+		require.NoError(t, err)
+
+		buf := make([]byte, 1024)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, `<28>1 2021-01-02T03:04:05.000006Z HOST pomerium 123 - - {"message":"hello"}`, string(buf[:n]))
+	})
+	t.Run("tcp", func(t *testing.T) {
+		li, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer li.Close()
+
+		received := make(chan string, 1)
+		go func() {
+			conn, err := li.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			line, _ := bufio.NewReader(conn).ReadString('}')
+			received <- line
+		}()
+
+		s, err := newSyslogSink("tcp", li.Addr().String())
+		require.NoError(t, err)
+		defer s.Close()
+		s.hostname, s.pid, s.now = "HOST", "123", now
+
+		_, err = s.Write([]byte(`{"message":"hello"}` + "\n"))
+		require.NoError(t, err)
+
+		select {
+		case line := <-received:
+			assert.Equal(t, `75 <30>1 2021-01-02T03:04:05.000006Z HOST pomerium 123 - - {"message":"hello"}`, line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for syslog message")
+		}
+	})
+}
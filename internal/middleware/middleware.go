@@ -105,3 +105,27 @@ func RequireBasicAuth(username, password string) func(next http.Handler) http.Ha
 		})
 	}
 }
+
+// RequireBearerToken creates a new handler that requires the given bearer token from the client
+// before calling the underlying handler.
+func RequireBearerToken(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			givenToken := sha256.Sum256([]byte(strings.TrimPrefix(auth, "Bearer ")))
+			requiredToken := sha256.Sum256([]byte(token))
+			if subtle.ConstantTimeCompare(givenToken[:], requiredToken[:]) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -196,3 +196,37 @@ func TestRequireBasicAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireBearerToken(t *testing.T) {
+	t.Parallel()
+
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, http.StatusText(http.StatusOK))
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"good", "Bearer secret", 200},
+		{"bad token", "Bearer other", 401},
+		{"basic auth", "Basic c2VjcmV0", 401},
+		{"empty", "", 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			RequireBearerToken("secret")(fn).ServeHTTP(rr, req)
+			if status := rr.Code; status != tt.wantStatus {
+				t.Errorf("RequireBearerToken() status = %v, want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
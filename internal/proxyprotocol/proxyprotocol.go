@@ -0,0 +1,237 @@
+// Package proxyprotocol contains a listener which reads the HAProxy PROXY protocol header of incoming connections,
+// see https://www.haproxy.org/download/2.3/doc/proxy-protocol.txt. Versions 1 and 2 are supported.
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// DefaultHeaderTimeout is how long a client has to send the PROXY protocol header.
+const DefaultHeaderTimeout = 10 * time.Second
+
+const maxV1HeaderLength = 107
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidHeader indicates that a connection didn't start with a valid PROXY protocol header.
+var ErrInvalidHeader = errors.New("proxyprotocol: invalid header")
+
+// A Listener accepts connections which start with a PROXY protocol header. Connections without a valid header are
+// closed. The remote address of accepted connections is the client address sent in the header.
+type Listener struct {
+	net.Listener
+	headerTimeout time.Duration
+
+	conns     chan net.Conn
+	errs      chan error
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewListener creates a new Listener. Headers are read concurrently, so a slow client doesn't block the others.
+func NewListener(li net.Listener, headerTimeout time.Duration) *Listener {
+	l := &Listener{
+		Listener:      li,
+		headerTimeout: headerTimeout,
+		conns:         make(chan net.Conn),
+		errs:          make(chan error, 1),
+		closed:        make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Accept waits for and returns the next connection with a valid PROXY protocol header.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+func (l *Listener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.closed:
+			}
+			return
+		}
+		go l.handle(conn)
+	}
+}
+
+func (l *Listener) handle(conn net.Conn) {
+	pconn, err := newConn(conn, l.headerTimeout)
+	if err != nil {
+		log.Debug(context.Background()).Err(err).
+			Str("remote-addr", conn.RemoteAddr().String()).
+			Msg("proxyprotocol: closing connection")
+		_ = conn.Close()
+		return
+	}
+
+	select {
+	case l.conns <- pconn:
+	case <-l.closed:
+		_ = conn.Close()
+	}
+}
+
+// A Conn is a connection whose PROXY protocol header has been read.
+type Conn struct {
+	net.Conn
+	r          *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func newConn(conn net.Conn, headerTimeout time.Duration) (*Conn, error) {
+	if headerTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(headerTimeout)); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Conn{
+		Conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+	remoteAddr, err := readHeader(c.r)
+	if err != nil {
+		return nil, err
+	}
+	c.remoteAddr = remoteAddr
+
+	if headerTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Read reads data from the connection, after the PROXY protocol header.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client address sent in the PROXY protocol header. For LOCAL and UNKNOWN connections, e.g.
+// the health checks of load balancers, it's the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readHeader reads a version 1 or version 2 PROXY protocol header and returns the source address. The address is nil
+// if the header doesn't contain one.
+func readHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(v2Signature))
+	if err == nil && bytes.Equal(sig, v2Signature) {
+		return readV2Header(r)
+	}
+	if len(sig) >= 6 && string(sig[:6]) == "PROXY " {
+		return readV1Header(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, ErrInvalidHeader
+}
+
+func readV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= maxV1HeaderLength {
+			return nil, fmt.Errorf("%w: header too long", ErrInvalidHeader)
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+
+	// PROXY TCP4 <src addr> <dst addr> <src port> <dst port>, or PROXY UNKNOWN ...
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidHeader
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("%w: invalid source address", ErrInvalidHeader)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid source port", ErrInvalidHeader)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readV2Header(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, len(v2Signature)+4)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	verCmd, fam := hdr[12], hdr[13]
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version", ErrInvalidHeader)
+	}
+	switch verCmd & 0xf {
+	case 0: // LOCAL
+		return nil, nil
+	case 1: // PROXY
+	default:
+		return nil, fmt.Errorf("%w: unsupported command", ErrInvalidHeader)
+	}
+
+	// the addresses are followed by TLVs, which are ignored
+	switch fam {
+	case 0x11: // TCP over IPv4
+		if len(body) < 12 {
+			return nil, fmt.Errorf("%w: invalid addresses", ErrInvalidHeader)
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(body) < 36 {
+			return nil, fmt.Errorf("%w: invalid addresses", ErrInvalidHeader)
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:]))}, nil
+	}
+	// other protocols, e.g. UDP or unix sockets, don't have a usable source address
+	return nil, nil
+}
@@ -0,0 +1,98 @@
+package proxyprotocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func v2Header(cmd, fam byte, addrs []byte) string {
+	hdr := append([]byte(nil), v2Signature...)
+	hdr = append(hdr, 0x20|cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(hdr[14:], uint16(len(addrs)))
+	return string(append(hdr, addrs...))
+}
+
+func TestReadHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header string
+		expect string
+		err    bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "192.0.2.1:56324", false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\n", "", false},
+		{"v1 mismatched family", "PROXY TCP4 2001:db8::1 2001:db8::2 56324 443\r\n", "", true},
+		{"v1 invalid port", "PROXY TCP4 192.0.2.1 198.51.100.1 port 443\r\n", "", true},
+		{"v1 too long", "PROXY " + strings.Repeat("A", 200) + "\r\n", "", true},
+		{"v2 tcp4", v2Header(1, 0x11, []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}), "192.0.2.1:56324", false},
+		{"v2 tcp6", v2Header(1, 0x21, append(append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...), 0xdc, 0x04, 0x01, 0xbb)), "[2001:db8::1]:56324", false},
+		{"v2 local", v2Header(0, 0, nil), "", false},
+		{"v2 short addresses", v2Header(1, 0x11, []byte{192, 0, 2, 1}), "", true},
+		{"no header", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, err := readHeader(bufio.NewReader(strings.NewReader(tc.header + "DATA")))
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tc.expect == "" {
+				assert.Nil(t, addr)
+			} else {
+				assert.Equal(t, tc.expect, addr.String())
+			}
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	pli := NewListener(li, time.Second)
+	defer pli.Close()
+
+	// connections without a header are closed, without blocking the others
+	bad, err := net.Dial("tcp", li.Addr().String())
+	require.NoError(t, err)
+	defer bad.Close()
+	_, err = bad.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+
+	good, err := net.Dial("tcp", li.Addr().String())
+	require.NoError(t, err)
+	defer good.Close()
+	_, err = good.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\nHELLO"))
+	require.NoError(t, err)
+	require.NoError(t, good.(*net.TCPConn).CloseWrite())
+
+	conn, err := pli.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+	data, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO", string(data))
+
+	// the connection may be reset instead of closed, but it shouldn't be left open
+	require.NoError(t, bad.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = ioutil.ReadAll(bad)
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		assert.False(t, netErr.Timeout(), "connection without a header should be closed")
+	}
+
+	require.NoError(t, pli.Close())
+	_, err = pli.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
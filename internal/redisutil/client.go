@@ -43,33 +43,96 @@ var (
 	)
 )
 
-// NewClientFromURL creates a new redis client by parsing the raw URL.
-func NewClientFromURL(rawURL string, tlsConfig *tls.Config) (redis.UniversalClient, error) {
+// ClientOptions are settings which override those of the redis URL, so that they don't need to be encoded in it.
+type ClientOptions struct {
+	// TLSConfig is used for TLS connections.
+	TLSConfig *tls.Config
+	// RequireTLS enables TLS even if the URL scheme doesn't.
+	RequireTLS bool
+	// Username and Password are used to authenticate to redis, if set.
+	Username string
+	Password string
+	// DB is the database to select, if non-zero.
+	DB int
+	// SentinelMasterName is the name of the master monitored by sentinel, if set.
+	SentinelMasterName string
+}
+
+func (o *ClientOptions) getTLSConfig(parsed *tls.Config) *tls.Config {
+	switch {
+	case parsed == nil && !o.RequireTLS:
+		return nil
+	case o.TLSConfig != nil:
+		return o.TLSConfig
+	case parsed != nil:
+		return parsed
+	}
+	return &tls.Config{} //nolint
+}
+
+func (o *ClientOptions) setAuth(username, password *string) {
+	if o.Username != "" {
+		*username = o.Username
+	}
+	if o.Password != "" {
+		*password = o.Password
+	}
+}
+
+func (o *ClientOptions) setDB(db *int) {
+	if o.DB != 0 {
+		*db = o.DB
+	}
+}
+
+func (o *ClientOptions) setSentinelMasterName(opts *redis.FailoverOptions) error {
+	if o.SentinelMasterName != "" {
+		opts.MasterName = o.SentinelMasterName
+	}
+	if opts.MasterName == "" {
+		return fmt.Errorf("redis: sentinel master name is required")
+	}
+	return nil
+}
+
+// NewClientFromURL creates a new redis client by parsing the raw URL. The options override the settings of the URL,
+// and may be nil.
+func NewClientFromURL(rawURL string, options *ClientOptions) (redis.UniversalClient, error) {
+	if options == nil {
+		options = new(ClientOptions)
+	}
+
 	u, err := url.Parse(rawURL)
 	if err != nil {
 		return nil, err
 	}
 
+	isSentinel := sentinelSchemes.Has(u.Scheme) || sentinelClusterSchemes.Has(u.Scheme)
+	if options.SentinelMasterName != "" && !isSentinel {
+		return nil, fmt.Errorf("redis: a sentinel master name requires a sentinel URL")
+	}
+
 	switch {
 	case standardSchemes.Has(u.Scheme):
 		opts, err := redis.ParseURL(rawURL)
 		if err != nil {
 			return nil, err
 		}
-		// when using TLS, the TLS config will not be set to nil, in which case we replace it with our own
-		if opts.TLSConfig != nil {
-			opts.TLSConfig = tlsConfig
-		}
+		opts.TLSConfig = options.getTLSConfig(opts.TLSConfig)
+		options.setAuth(&opts.Username, &opts.Password)
+		options.setDB(&opts.DB)
 		return redis.NewClient(opts), nil
 
 	case clusterSchemes.Has(u.Scheme):
+		if options.DB != 0 {
+			return nil, fmt.Errorf("redis: cluster mode doesn't support selecting a database")
+		}
 		opts, err := ParseClusterURL(rawURL)
 		if err != nil {
 			return nil, err
 		}
-		if opts.TLSConfig != nil {
-			opts.TLSConfig = tlsConfig
-		}
+		opts.TLSConfig = options.getTLSConfig(opts.TLSConfig)
+		options.setAuth(&opts.Username, &opts.Password)
 		return redis.NewClusterClient(opts), nil
 
 	case sentinelSchemes.Has(u.Scheme):
@@ -77,18 +140,26 @@ func NewClientFromURL(rawURL string, tlsConfig *tls.Config) (redis.UniversalClie
 		if err != nil {
 			return nil, err
 		}
-		if opts.TLSConfig != nil {
-			opts.TLSConfig = tlsConfig
+		opts.TLSConfig = options.getTLSConfig(opts.TLSConfig)
+		options.setAuth(&opts.Username, &opts.Password)
+		options.setDB(&opts.DB)
+		if err := options.setSentinelMasterName(opts); err != nil {
+			return nil, err
 		}
 		return redis.NewFailoverClient(opts), nil
 
 	case sentinelClusterSchemes.Has(u.Scheme):
+		if options.DB != 0 {
+			return nil, fmt.Errorf("redis: cluster mode doesn't support selecting a database")
+		}
 		opts, err := ParseSentinelURL(rawURL)
 		if err != nil {
 			return nil, err
 		}
-		if opts.TLSConfig != nil {
-			opts.TLSConfig = tlsConfig
+		opts.TLSConfig = options.getTLSConfig(opts.TLSConfig)
+		options.setAuth(&opts.Username, &opts.Password)
+		if err := options.setSentinelMasterName(opts); err != nil {
+			return nil, err
 		}
 		return redis.NewFailoverClusterClient(opts), nil
 
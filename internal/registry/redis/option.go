@@ -3,12 +3,14 @@ package redis
 import (
 	"crypto/tls"
 	"time"
+
+	"github.com/pomerium/pomerium/internal/redisutil"
 )
 
 const defaultTTL = time.Second * 30
 
 type config struct {
-	tls    *tls.Config
+	client redisutil.ClientOptions
 	ttl    time.Duration
 	getNow func() time.Time
 }
@@ -26,7 +28,7 @@ func WithGetNow(getNow func() time.Time) Option {
 // WithTLSConfig sets the tls.Config in the config.
 func WithTLSConfig(tlsConfig *tls.Config) Option {
 	return func(cfg *config) {
-		cfg.tls = tlsConfig
+		cfg.client.TLSConfig = tlsConfig
 	}
 }
 
@@ -37,6 +39,35 @@ func WithTTL(ttl time.Duration) Option {
 	}
 }
 
+// WithRequireTLS enables TLS even if the URL scheme doesn't.
+func WithRequireTLS(requireTLS bool) Option {
+	return func(cfg *config) {
+		cfg.client.RequireTLS = requireTLS
+	}
+}
+
+// WithAuth sets the username and password used to authenticate to redis, overriding those of the URL.
+func WithAuth(username, password string) Option {
+	return func(cfg *config) {
+		cfg.client.Username = username
+		cfg.client.Password = password
+	}
+}
+
+// WithDB sets the database to select, overriding that of the URL.
+func WithDB(db int) Option {
+	return func(cfg *config) {
+		cfg.client.DB = db
+	}
+}
+
+// WithSentinelMasterName sets the name of the master monitored by sentinel, overriding that of the URL.
+func WithSentinelMasterName(name string) Option {
+	return func(cfg *config) {
+		cfg.client.SentinelMasterName = name
+	}
+}
+
 func getConfig(options ...Option) *config {
 	cfg := new(config)
 	WithGetNow(time.Now)(cfg)
@@ -43,7 +43,7 @@ type impl struct {
 func New(rawURL string, options ...Option) (registry.Interface, error) {
 	cfg := getConfig(options...)
 
-	client, err := redisutil.NewClientFromURL(rawURL, cfg.tls)
+	client, err := redisutil.NewClientFromURL(rawURL, &cfg.client)
 	if err != nil {
 		return nil, err
 	}
@@ -45,13 +45,28 @@ func (r *Reporter) OnConfigChange(ctx context.Context, cfg *config.Config) {
 		return
 	}
 
+	clientCert, err := cfg.Options.GetGRPCClientCertificate()
+	if err != nil {
+		log.Error(ctx).Err(err).Msg("invalid grpc client certificate")
+		return
+	}
+
 	registryConn, err := grpc.GetGRPCClientConn(ctx, "databroker", &grpc.Options{
 		Addrs:                   urls,
 		OverrideCertificateName: cfg.Options.OverrideCertificateName,
 		CA:                      cfg.Options.CA,
 		CAFile:                  cfg.Options.CAFile,
+		ClientCertificate:       clientCert,
+		SPIREAgentSocket:        cfg.Options.SPIREAgentSocket,
+		InternalCA:              cfg.Options.GetInternalCA(),
 		RequestTimeout:          cfg.Options.GRPCClientTimeout,
 		ClientDNSRoundRobin:     cfg.Options.GRPCClientDNSRoundRobin,
+		PoolSize:                cfg.Options.GRPCClientPoolSize,
+		KeepaliveTime:           cfg.Options.GRPCClientKeepaliveTime,
+		KeepaliveTimeout:        cfg.Options.GRPCClientKeepaliveTimeout,
+		BackoffMaxDelay:         cfg.Options.GRPCClientBackoffMaxDelay,
+		CircuitBreakerThreshold: cfg.Options.GRPCClientCircuitBreakerThreshold,
+		CircuitBreakerTimeout:   cfg.Options.GRPCClientCircuitBreakerTimeout,
 		WithInsecure:            cfg.Options.GetGRPCInsecure(),
 		InstallationID:          cfg.Options.InstallationID,
 		ServiceName:             cfg.Options.Services,
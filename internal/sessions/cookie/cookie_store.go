@@ -37,8 +37,11 @@ const (
 
 // Options holds options for Store
 type Options struct {
-	Name     string
-	Domain   string
+	Name   string
+	Domain string
+	// Path defaults to /.
+	Path     string
+	SameSite http.SameSite
 	Expire   time.Duration
 	HTTPOnly bool
 	Secure   bool
@@ -76,6 +79,46 @@ func NewCookieLoader(getOptions GetOptionsFunc, dencoder encoding.Unmarshaler) (
 	return cs, nil
 }
 
+// A GetRequestOptionsFunc is a getter for the cookie options of a request.
+type GetRequestOptionsFunc func(r *http.Request) Options
+
+type requestStore struct {
+	getOptions GetRequestOptionsFunc
+	encoder    encoding.MarshalUnmarshaler
+}
+
+// NewRequestStore returns a new store that implements the SessionStore interface using http cookies, whose
+// options depend on the request, e.g. on its host.
+func NewRequestStore(getOptions GetRequestOptionsFunc, encoder encoding.MarshalUnmarshaler) (sessions.SessionStore, error) {
+	if encoder == nil {
+		return nil, fmt.Errorf("internal/sessions: dencoder cannot be nil")
+	}
+	return &requestStore{getOptions: getOptions, encoder: encoder}, nil
+}
+
+func (rs *requestStore) store(r *http.Request) *Store {
+	return &Store{
+		getOptions: func() Options { return rs.getOptions(r) },
+		encoder:    rs.encoder,
+		decoder:    rs.encoder,
+	}
+}
+
+// ClearSession clears the session cookie from a request
+func (rs *requestStore) ClearSession(w http.ResponseWriter, r *http.Request) {
+	rs.store(r).ClearSession(w, r)
+}
+
+// LoadSession returns a State from the cookie in the request.
+func (rs *requestStore) LoadSession(r *http.Request) (string, error) {
+	return rs.store(r).LoadSession(r)
+}
+
+// SaveSession saves a session state to a request's cookie store.
+func (rs *requestStore) SaveSession(w http.ResponseWriter, r *http.Request, x interface{}) error {
+	return rs.store(r).SaveSession(w, r, x)
+}
+
 func newStore(getOptions GetOptionsFunc) *Store {
 	return &Store{
 		getOptions: getOptions,
@@ -84,13 +127,18 @@ func newStore(getOptions GetOptionsFunc) *Store {
 
 func (cs *Store) makeCookie(value string) *http.Cookie {
 	opts := cs.getOptions()
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
 	return &http.Cookie{
 		Name:     opts.Name,
 		Value:    value,
-		Path:     "/",
+		Path:     path,
 		Domain:   opts.Domain,
 		HttpOnly: opts.HTTPOnly,
 		Secure:   opts.Secure,
+		SameSite: opts.SameSite,
 		Expires:  timeNow().Add(opts.Expire),
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
@@ -174,3 +175,51 @@ func TestStore_SaveSession(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestStore(t *testing.T) {
+	c, err := cryptutil.NewAEADCipher(cryptutil.NewKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewRequestStore(func(r *http.Request) Options {
+		if r.Host == "app.example.com" {
+			return Options{Name: "_app", Path: "/app", SameSite: http.SameSiteNoneMode, Secure: true}
+		}
+		return Options{Name: "_pomerium"}
+	}, ecjson.New(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := &sessions.State{Version: "v1", ID: "xyz"}
+	for _, tt := range []struct {
+		host string
+		want string
+	}{
+		{"app.example.com", "_app=VALUE; Path=/app; Secure; SameSite=None"},
+		{"other.example.com", "_pomerium=VALUE; Path=/"},
+	} {
+		r := httptest.NewRequest("GET", "https://"+tt.host+"/", nil)
+		w := httptest.NewRecorder()
+		if err := s.SaveSession(w, r, state); err != nil {
+			t.Fatal(err)
+		}
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("SaveSession() set %d cookies", len(cookies))
+		}
+		value := cookies[0].Value
+		cookies[0].Value = "VALUE"
+		cookies[0].Expires = time.Time{}
+		cookies[0].Raw = ""
+		if got := cookies[0].String(); got != tt.want {
+			t.Errorf("SaveSession() cookie = %s, want %s", got, tt.want)
+		}
+
+		r = httptest.NewRequest("GET", "https://"+tt.host+"/", nil)
+		r.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: value})
+		if _, err := s.LoadSession(r); err != nil {
+			t.Errorf("LoadSession() error = %v", err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/go-jose/go-jose/v3/jwt"
+	"google.golang.org/protobuf/proto"
 )
 
 // ErrMissingID is the error for a session state that has no ID set.
@@ -63,6 +64,11 @@ type State struct {
 	// Programmatic whether this state is used for machine-to-machine
 	// programmatic access.
 	Programmatic bool `json:"programmatic"`
+
+	// StatelessSession and StatelessUser are the protobuf encoded session and user of a stateless session,
+	// which are stored in the state itself instead of the databroker.
+	StatelessSession []byte `json:"pomerium_session,omitempty"`
+	StatelessUser    []byte `json:"pomerium_user,omitempty"`
 }
 
 // NewSession updates issuer, audience, and issuance timestamps but keeps
@@ -89,6 +95,35 @@ func (s *State) UserID(provider string) string {
 	return s.Subject
 }
 
+// SetStateless stores the session and user in the state, for stateless sessions.
+func (s *State) SetStateless(session, user proto.Message) error {
+	var err error
+	s.StatelessSession, err = proto.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("invalid stateless session: %w", err)
+	}
+	s.StatelessUser, err = proto.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("invalid stateless user: %w", err)
+	}
+	return nil
+}
+
+// GetStateless retrieves the session and user stored in the state. It returns false if the state isn't a
+// stateless session.
+func (s *State) GetStateless(session, user proto.Message) (bool, error) {
+	if len(s.StatelessSession) == 0 {
+		return false, nil
+	}
+	if err := proto.Unmarshal(s.StatelessSession, session); err != nil {
+		return false, fmt.Errorf("invalid stateless session: %w", err)
+	}
+	if err := proto.Unmarshal(s.StatelessUser, user); err != nil {
+		return false, fmt.Errorf("invalid stateless user: %w", err)
+	}
+	return true, nil
+}
+
 // UnmarshalJSON returns a State struct from JSON. Additionally munges
 // a user's session by using by setting `user` claim to `sub` if empty.
 func (s *State) UnmarshalJSON(data []byte) error {
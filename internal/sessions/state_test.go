@@ -8,6 +8,7 @@ import (
 	"github.com/go-jose/go-jose/v3/jwt"
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/oauth2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestState_IsExpired(t *testing.T) {
@@ -122,3 +123,33 @@ func TestVersion_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestState_Stateless(t *testing.T) {
+	var s State
+	ok, err := s.GetStateless(new(wrapperspb.StringValue), new(wrapperspb.StringValue))
+	if ok || err != nil {
+		t.Fatalf("GetStateless() = %v, %v, want false for a stateful session", ok, err)
+	}
+
+	s.ID = "SESSION_ID"
+	if err := s.SetStateless(wrapperspb.String("session"), wrapperspb.String("user")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got State
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	session, user := new(wrapperspb.StringValue), new(wrapperspb.StringValue)
+	ok, err = got.GetStateless(session, user)
+	if !ok || err != nil {
+		t.Fatalf("GetStateless() = %v, %v", ok, err)
+	}
+	if session.GetValue() != "session" || user.GetValue() != "user" {
+		t.Errorf("GetStateless() session = %q, user = %q", session.GetValue(), user.GetValue())
+	}
+}
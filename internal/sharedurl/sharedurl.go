@@ -0,0 +1,92 @@
+// Package sharedurl contains time-limited signed URLs for a route's path, which the authorize service allows
+// without a session, so that a one-off download or dashboard snapshot can be shared with an external party.
+package sharedurl
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+// Query parameters of shared URLs. They're distinct from the parameters of the URLs signed for redirects, so
+// that those URLs can't be used to access a route.
+const (
+	QueryExpiry    = "pomerium_shared_expiry"
+	QuerySignature = "pomerium_shared_signature"
+)
+
+var (
+	// ErrExpired indicates that a shared URL has expired.
+	ErrExpired = errors.New("sharedurl: expired")
+	// ErrInvalidSignature indicates that the signature of a shared URL is invalid.
+	ErrInvalidSignature = errors.New("sharedurl: invalid signature")
+	// ErrInvalidMethod indicates that a shared URL was used for a request other than a GET or HEAD.
+	ErrInvalidMethod = errors.New("sharedurl: only GET and HEAD requests are allowed")
+)
+
+// Sign returns a copy of the URL which is valid for its hostname, path and query until the expiry. The key is
+// derived from the shared secret, so shared URLs are only valid for the pomerium instances with the same secret.
+func Sign(sharedKey []byte, u *url.URL, expiry time.Time) *url.URL {
+	signed := *u
+	params := signed.Query()
+	params.Del(QuerySignature)
+	params.Set(QueryExpiry, strconv.FormatInt(expiry.Unix(), 10))
+	params.Set(QuerySignature, base64.RawURLEncoding.EncodeToString(
+		cryptutil.GenerateHMAC(signedData(u.Hostname(), u.Path, params), signingKey(sharedKey))))
+	signed.RawQuery = params.Encode()
+	return &signed
+}
+
+// HasSignature returns true if the URL is a shared URL.
+func HasSignature(u *url.URL) bool {
+	return u.Query().Get(QuerySignature) != ""
+}
+
+// Verify returns an error if the URL isn't a valid shared URL for the request method at the given time.
+func Verify(sharedKey []byte, method string, u *url.URL, now time.Time) error {
+	params := u.Query()
+	sig, err := base64.RawURLEncoding.DecodeString(params.Get(QuerySignature))
+	if err != nil || len(sig) == 0 {
+		return ErrInvalidSignature
+	}
+	expiry, err := strconv.ParseInt(params.Get(QueryExpiry), 10, 64)
+	if err != nil {
+		return fmt.Errorf("sharedurl: invalid expiry: %w", err)
+	}
+
+	if !cryptutil.CheckHMAC(signedData(u.Hostname(), u.Path, params), sig, signingKey(sharedKey)) {
+		return ErrInvalidSignature
+	}
+	if !now.Before(time.Unix(expiry, 0)) {
+		return ErrExpired
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		return ErrInvalidMethod
+	}
+	return nil
+}
+
+// signingKey derives the key of shared URLs from the shared secret, so that their signatures can't be confused
+// with other HMACs of the shared secret.
+func signingKey(sharedKey []byte) []byte {
+	return cryptutil.Hash("shared_url", sharedKey)
+}
+
+// signedData returns the data signed for a shared URL. The query, which includes the expiry, is signed too, so
+// that parameters can't be added to a shared URL or changed.
+func signedData(hostname, path string, params url.Values) []byte {
+	query := url.Values{}
+	for k, vs := range params {
+		if k != QuerySignature {
+			query[k] = vs
+		}
+	}
+	return []byte(strings.Join([]string{strings.ToLower(hostname), path, query.Encode()}, "\n"))
+}
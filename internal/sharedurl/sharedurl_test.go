@@ -0,0 +1,55 @@
+package sharedurl
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+func TestSharedURL(t *testing.T) {
+	key := cryptutil.NewKey()
+	now := time.Now()
+	u, err := url.Parse("https://files.example.com/reports/q1.pdf?download=1")
+	require.NoError(t, err)
+	signed := Sign(key, u, now.Add(time.Hour))
+	assert.True(t, HasSignature(signed))
+	assert.False(t, HasSignature(u))
+	assert.Equal(t, "1", signed.Query().Get("download"))
+
+	modify := func(f func(u *url.URL)) *url.URL {
+		c := *signed
+		f(&c)
+		return &c
+	}
+
+	assert.NoError(t, Verify(key, http.MethodGet, signed, now))
+	assert.NoError(t, Verify(key, http.MethodHead, signed, now))
+	assert.NoError(t, Verify(key, http.MethodGet, modify(func(u *url.URL) { u.Host = "FILES.example.com" }), now))
+	assert.ErrorIs(t, Verify(key, http.MethodPost, signed, now), ErrInvalidMethod)
+	assert.ErrorIs(t, Verify(key, http.MethodGet, signed, now.Add(time.Hour)), ErrExpired)
+	assert.ErrorIs(t, Verify(cryptutil.NewKey(), http.MethodGet, signed, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(key, http.MethodGet, modify(func(u *url.URL) { u.Path = "/reports/q2.pdf" }), now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(key, http.MethodGet, modify(func(u *url.URL) { u.Host = "other.example.com" }), now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(key, http.MethodGet, modify(func(u *url.URL) {
+		params := u.Query()
+		params.Set(QueryExpiry, "99999999999")
+		u.RawQuery = params.Encode()
+	}), now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(key, http.MethodGet, modify(func(u *url.URL) {
+		params := u.Query()
+		params.Set("download", "0")
+		u.RawQuery = params.Encode()
+	}), now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(key, http.MethodGet, modify(func(u *url.URL) {
+		params := u.Query()
+		params.Add("format", "csv")
+		u.RawQuery = params.Encode()
+	}), now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(key, http.MethodGet, u, now), ErrInvalidSignature)
+}
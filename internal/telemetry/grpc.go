@@ -6,13 +6,14 @@ import (
 
 	"go.opencensus.io/plugin/ocgrpc"
 	"go.opencensus.io/plugin/ochttp/propagation/b3"
-	"go.opencensus.io/trace"
+	octrace "go.opencensus.io/trace"
 	"go.opencensus.io/trace/propagation"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	grpcstats "google.golang.org/grpc/stats"
 
 	"github.com/pomerium/pomerium/internal/telemetry/metrics"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
 )
 
 const (
@@ -34,18 +35,26 @@ type GRPCServerStatsHandler struct {
 
 // TagRPC implements grpc.stats.Handler and adds metrics and tracing metadata to the context of a given RPC
 func (h *GRPCServerStatsHandler) TagRPC(ctx context.Context, tagInfo *grpcstats.RPCTagInfo) context.Context {
-	// the opencensus trace handler only supports grpc-trace-bin, so we use that code and support b3 too
+	// the opencensus trace handler only supports grpc-trace-bin, so we use that code and support
+	// w3c trace context and b3 too
 
 	md, _ := metadata.FromIncomingContext(ctx)
 	name := strings.TrimPrefix(tagInfo.FullMethodName, "/")
 	name = strings.Replace(name, "/", ".", -1)
 
-	var parent trace.SpanContext
+	var parent octrace.SpanContext
 	hasParent := false
 	if traceBin := md[grpcTraceBinHeader]; len(traceBin) > 0 {
 		parent, hasParent = propagation.FromBinary([]byte(traceBin[0]))
 	}
 
+	if hdr := md[trace.TraceparentHeader]; len(hdr) > 0 {
+		if sc, ok := trace.SpanContextFromW3CHeaders(hdr[0], strings.Join(md[trace.TracestateHeader], ",")); ok {
+			parent = sc
+			hasParent = true
+		}
+	}
+
 	if hdr := md[b3TraceIDHeader]; len(hdr) > 0 {
 		if tid, ok := b3.ParseTraceID(hdr[0]); ok {
 			parent.TraceID = tid
@@ -60,11 +69,12 @@ func (h *GRPCServerStatsHandler) TagRPC(ctx context.Context, tagInfo *grpcstats.
 	}
 
 	if hasParent {
-		ctx, _ = trace.StartSpanWithRemoteParent(ctx, name, parent,
-			trace.WithSpanKind(trace.SpanKindServer))
+		ctx, _ = octrace.StartSpanWithRemoteParent(ctx, name, parent,
+			octrace.WithSpanKind(octrace.SpanKindServer))
+		ctx = trace.ContextWithRemoteParent(ctx)
 	} else {
-		ctx, _ = trace.StartSpan(ctx, name,
-			trace.WithSpanKind(trace.SpanKindServer))
+		ctx, _ = octrace.StartSpan(ctx, name,
+			octrace.WithSpanKind(octrace.SpanKindServer))
 	}
 
 	metricCtx := h.metricsHandler.TagRPC(ctx, tagInfo)
@@ -10,6 +10,8 @@ import (
 	"go.opencensus.io/trace"
 	"google.golang.org/grpc/metadata"
 	grpcstats "google.golang.org/grpc/stats"
+
+	pomeriumtrace "github.com/pomerium/pomerium/internal/telemetry/trace"
 )
 
 type mockTagHandler struct {
@@ -45,3 +47,22 @@ func Test_GRPCServerStatsHandler(t *testing.T) {
 	expectedTraceID, _ := b3.ParseTraceID("9de3f6756f315fef")
 	assert.Equal(t, expectedTraceID, span.SpanContext().TraceID)
 }
+
+func Test_GRPCServerStatsHandler_W3C(t *testing.T) {
+	h := &GRPCServerStatsHandler{
+		metricsHandler: &mockTagHandler{},
+		Handler:        &ocgrpc.ServerHandler{},
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{
+		"traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+	ctx = h.TagRPC(ctx, &grpcstats.RPCTagInfo{})
+
+	span := trace.FromContext(ctx)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID.String())
+	assert.True(t, pomeriumtrace.HasRemoteParent(ctx))
+
+	ctx = h.TagRPC(context.Background(), &grpcstats.RPCTagInfo{})
+	assert.False(t, pomeriumtrace.HasRemoteParent(ctx))
+}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	octrace "go.opencensus.io/trace"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/metrics"
+)
+
+// Authorize decisions
+const (
+	AuthorizeDecisionAllow = "allow"
+	AuthorizeDecisionDeny  = "deny"
+)
+
+var (
+	// AuthorizeViews contains opencensus views for authorize checks.
+	AuthorizeViews = []*view.View{
+		AuthorizeEvaluatorDurationView,
+		AuthorizeDecisionsView,
+		AuthorizeRecordCacheLookupsView,
+	}
+
+	authorizeEvaluatorDuration = stats.Float64(
+		metrics.AuthorizeEvaluatorDurationMilliseconds,
+		"Duration of policy evaluations in ms",
+		stats.UnitMilliseconds)
+	authorizeDecisions = stats.Int64(
+		metrics.AuthorizeDecisionsTotal,
+		"Number of authorize decisions",
+		stats.UnitDimensionless)
+	authorizeRecordCacheLookups = stats.Int64(
+		metrics.AuthorizeRecordCacheLookupsTotal,
+		"Number of lookups of databroker records in the local copy of the authorize service",
+		stats.UnitDimensionless)
+
+	// AuthorizeEvaluatorDurationView is an OpenCensus view that tracks the duration of policy
+	// evaluations by route.
+	AuthorizeEvaluatorDurationView = &view.View{
+		Name:        authorizeEvaluatorDuration.Name(),
+		Description: authorizeEvaluatorDuration.Description(),
+		Measure:     authorizeEvaluatorDuration,
+		TagKeys:     []tag.Key{TagKeyRouteID},
+		Aggregation: DefaultMillisecondsDistribution,
+	}
+	// AuthorizeDecisionsView is an OpenCensus view that counts authorize decisions by route, decision
+	// and reason.
+	AuthorizeDecisionsView = &view.View{
+		Name:        authorizeDecisions.Name(),
+		Description: authorizeDecisions.Description(),
+		Measure:     authorizeDecisions,
+		TagKeys:     []tag.Key{TagKeyRouteID, TagKeyDecision, TagKeyReason},
+		Aggregation: view.Count(),
+	}
+	// AuthorizeRecordCacheLookupsView is an OpenCensus view that counts lookups of databroker records
+	// by record type and result (hit or miss). A miss means the authorize service had to wait for the
+	// record to be synced from the databroker.
+	AuthorizeRecordCacheLookupsView = &view.View{
+		Name:        authorizeRecordCacheLookups.Name(),
+		Description: authorizeRecordCacheLookups.Description(),
+		Measure:     authorizeRecordCacheLookups,
+		TagKeys:     []tag.Key{TagKeyRecordType, TagKeyCacheResult},
+		Aggregation: view.Count(),
+	}
+)
+
+// authorizeCheckDuration is a native prometheus histogram, rather than an OpenCensus view, because the
+// OpenCensus prometheus exporter does not support exemplars.
+var authorizeCheckDuration = prom.NewHistogram(prom.HistogramOpts{
+	Namespace: "pomerium",
+	Name:      metrics.AuthorizeCheckDurationMilliseconds,
+	Help:      "authorize check duration in ms",
+	Buckets:   DefaultMillisecondsDistribution.Buckets,
+})
+
+// RecordAuthorizeCheckDuration records the duration of an authorize check. If the span in the
+// context is sampled, its trace id is attached to the observation as an exemplar.
+func RecordAuthorizeCheckDuration(ctx context.Context, duration time.Duration) {
+	ms := float64(duration) / float64(time.Millisecond)
+
+	sc := octrace.FromContext(ctx).SpanContext()
+	if !sc.IsSampled() {
+		authorizeCheckDuration.Observe(ms)
+		return
+	}
+
+	authorizeCheckDuration.(prom.ExemplarObserver).ObserveWithExemplar(ms, prom.Labels{
+		metrics.TraceIDExemplarLabel: sc.TraceID.String(),
+	})
+}
+
+// RecordAuthorizeEvaluation records the duration of a policy evaluation for a route.
+func RecordAuthorizeEvaluation(ctx context.Context, routeID string, duration time.Duration) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyRouteID, routeID)},
+		authorizeEvaluatorDuration.M(float64(duration)/float64(time.Millisecond)),
+	)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordAuthorizeDecision records an authorize decision for a route. decision is
+// AuthorizeDecisionAllow or AuthorizeDecisionDeny.
+func RecordAuthorizeDecision(ctx context.Context, routeID, decision, reason string) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyRouteID, routeID),
+			tag.Upsert(TagKeyDecision, decision),
+			tag.Upsert(TagKeyReason, reason),
+		},
+		authorizeDecisions.M(1),
+	)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
+
+// RecordAuthorizeRecordCacheLookup records a lookup of a databroker record of the given type.
+func RecordAuthorizeRecordCacheLookup(ctx context.Context, recordType string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyRecordType, recordType),
+			tag.Upsert(TagKeyCacheResult, result),
+		},
+		authorizeRecordCacheLookups.M(1),
+	)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+)
+
+func Test_RecordAuthorizeEvaluation(t *testing.T) {
+	view.Unregister(AuthorizeViews...)
+	view.Register(AuthorizeViews...)
+	RecordAuthorizeEvaluation(context.Background(), "1234", time.Millisecond*5)
+
+	testDataRetrieval(AuthorizeEvaluatorDurationView, t, "{ { {route_id 1234} }&{1 5 5 5 0")
+}
+
+func Test_RecordAuthorizeDecision(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision string
+		reason   string
+		want     string
+	}{
+		{"allow", AuthorizeDecisionAllow, "allowed", "{ { {decision allow}{reason allowed}{route_id 1234} }"},
+		{"deny", AuthorizeDecisionDeny, "unauthenticated", "{ { {decision deny}{reason unauthenticated}{route_id 1234} }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view.Unregister(AuthorizeViews...)
+			view.Register(AuthorizeViews...)
+			RecordAuthorizeDecision(context.Background(), "1234", tt.decision, tt.reason)
+
+			testDataRetrieval(AuthorizeDecisionsView, t, tt.want)
+		})
+	}
+}
+
+func Test_RecordAuthorizeRecordCacheLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		hit  bool
+		want string
+	}{
+		{"hit", true, "{ { {record_type session}{result hit} }"},
+		{"miss", false, "{ { {record_type session}{result miss} }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view.Unregister(AuthorizeViews...)
+			view.Register(AuthorizeViews...)
+			RecordAuthorizeRecordCacheLookup(context.Background(), "session", tt.hit)
+
+			testDataRetrieval(AuthorizeRecordCacheLookupsView, t, tt.want)
+		})
+	}
+}
@@ -19,6 +19,14 @@ var (
 	TagKeyStorageOperation = tag.MustNewKey("operation")
 	TagKeyStorageResult    = tag.MustNewKey("result")
 	TagKeyStorageBackend   = tag.MustNewKey("backend")
+
+	TagKeyFeature = tag.MustNewKey("feature")
+
+	TagKeyRouteID     = tag.MustNewKey("route_id")
+	TagKeyDecision    = tag.MustNewKey("decision")
+	TagKeyReason      = tag.MustNewKey("reason")
+	TagKeyRecordType  = tag.MustNewKey("record_type")
+	TagKeyCacheResult = tag.MustNewKey("result")
 )
 
 // Default distributions used by views in this package.
@@ -45,5 +53,7 @@ var (
 		HTTPServerViews,
 		InfoViews,
 		StorageViews,
+		DeprecationViews,
+		AuthorizeViews,
 	}
 )
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/metrics"
+)
+
+var (
+	// DeprecationViews contains opencensus views for usage of deprecated features.
+	DeprecationViews = []*view.View{DeprecatedFeatureUsageView}
+
+	deprecatedFeatureUsage = stats.Int64(
+		metrics.DeprecatedFeatureUsageTotal,
+		"Number of times a deprecated option or flow was used",
+		stats.UnitDimensionless)
+
+	// DeprecatedFeatureUsageView is an OpenCensus view that counts usage of deprecated features by feature.
+	DeprecatedFeatureUsageView = &view.View{
+		Name:        deprecatedFeatureUsage.Name(),
+		Description: deprecatedFeatureUsage.Description(),
+		Measure:     deprecatedFeatureUsage,
+		TagKeys:     []tag.Key{TagKeyFeature},
+		Aggregation: view.Count(),
+	}
+)
+
+// RecordDeprecatedFeatureUsage records a use of the deprecated feature with the given name.
+func RecordDeprecatedFeatureUsage(ctx context.Context, feature string) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{tag.Upsert(TagKeyFeature, feature)},
+		deprecatedFeatureUsage.M(1),
+	)
+	if err != nil {
+		log.Warn(ctx).Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"go.opencensus.io/tag"
 
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/trace"
 	"github.com/pomerium/pomerium/internal/tripper"
 )
 
@@ -126,7 +127,8 @@ func HTTPMetricsHandler(getInstallationID func() string, service string) func(ne
 			}
 
 			ocHandler := ochttp.Handler{
-				Handler: next,
+				Handler:     next,
+				Propagation: &trace.HTTPFormat{},
 				FormatSpanName: func(r *http.Request) string {
 					return fmt.Sprintf("%s%s", r.Host, r.URL.Path)
 				},
@@ -152,7 +154,7 @@ func HTTPMetricsRoundTripper(getInstallationID func() string, service string, de
 				return next.RoundTrip(r)
 			}
 
-			ocTransport := ochttp.Transport{Base: next}
+			ocTransport := ochttp.Transport{Base: next, Propagation: &trace.HTTPFormat{}}
 			return ocTransport.RoundTrip(r.WithContext(ctx))
 		})
 	}
@@ -21,6 +21,8 @@ var (
 		ConfigLastReloadView,
 		ConfigLastReloadSuccessView,
 		IdentityManagerLastRefreshView,
+		IdentityManagerIdPOutageView,
+		IdentityManagerIdPOutageSessionExtensionsView,
 		ConfigDBVersionView,
 		ConfigDBErrorsView,
 	}
@@ -48,6 +50,16 @@ var (
 		"Timestamp of last directory refresh",
 		"seconds",
 	)
+	identityManagerIdPOutage = stats.Int64(
+		metrics.IdentityManagerIdPOutage,
+		"Returns 1 while the identity provider is unreachable",
+		stats.UnitDimensionless,
+	)
+	identityManagerIdPOutageSessionExtensions = stats.Int64(
+		metrics.IdentityManagerIdPOutageSessionExtensionsTotal,
+		"Total sessions extended during identity provider outages",
+		stats.UnitDimensionless,
+	)
 
 	// ConfigDBVersionView contains last databroker config version that was processed
 	ConfigDBVersionView = &view.View{
@@ -95,6 +107,24 @@ var (
 		Measure:     identityManagerLastRefresh,
 		Aggregation: view.LastValue(),
 	}
+
+	// IdentityManagerIdPOutageView contains whether the identity manager is
+	// in an identity provider outage.
+	IdentityManagerIdPOutageView = &view.View{
+		Name:        identityManagerIdPOutage.Name(),
+		Description: identityManagerIdPOutage.Description(),
+		Measure:     identityManagerIdPOutage,
+		Aggregation: view.LastValue(),
+	}
+
+	// IdentityManagerIdPOutageSessionExtensionsView contains the number of
+	// sessions extended during identity provider outages.
+	IdentityManagerIdPOutageSessionExtensionsView = &view.View{
+		Name:        identityManagerIdPOutageSessionExtensions.Name(),
+		Description: identityManagerIdPOutageSessionExtensions.Description(),
+		Measure:     identityManagerIdPOutageSessionExtensions,
+		Aggregation: view.Count(),
+	}
 )
 
 // RecordIdentityManagerLastRefresh records that the identity manager refreshed users and groups.
@@ -102,6 +132,21 @@ func RecordIdentityManagerLastRefresh() {
 	stats.Record(context.Background(), identityManagerLastRefresh.M(time.Now().Unix()))
 }
 
+// RecordIdentityManagerIdPOutage records whether the identity provider is unreachable.
+func RecordIdentityManagerIdPOutage(outage bool) {
+	var value int64
+	if outage {
+		value = 1
+	}
+	stats.Record(context.Background(), identityManagerIdPOutage.M(value))
+}
+
+// RecordIdentityManagerIdPOutageSessionExtension records that a session was extended during an
+// identity provider outage.
+func RecordIdentityManagerIdPOutageSessionExtension() {
+	stats.Record(context.Background(), identityManagerIdPOutageSessionExtensions.M(1))
+}
+
 // SetDBConfigInfo records status, databroker version and error count while parsing
 // the configuration from a databroker
 func SetDBConfigInfo(ctx context.Context, service, configID string, version uint64, errCount int64) {
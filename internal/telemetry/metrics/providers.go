@@ -2,20 +2,22 @@ package metrics
 
 import (
 	"fmt"
-	"io"
 	"net/http"
-	"net/http/httptest"
 	"net/url"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	ocprom "contrib.go.opencensus.io/exporter/prometheus"
 	prom "github.com/prometheus/client_golang/prometheus"
 	io_prometheus_client "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
+	"go.opencensus.io/metric/metricexport"
 	"go.opencensus.io/stats/view"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/pomerium/pomerium/internal/telemetry/otlp"
 	"github.com/pomerium/pomerium/pkg/metrics"
 
 	log "github.com/pomerium/pomerium/internal/log"
@@ -24,7 +26,7 @@ import (
 // PrometheusHandler creates an exporter that exports stats to Prometheus
 // and returns a handler suitable for exporting metrics.
 func PrometheusHandler(envoyURL *url.URL, installationID string) (http.Handler, error) {
-	exporter, err := getGlobalExporter()
+	_, err := getGlobalExporter()
 	if err != nil {
 		return nil, err
 	}
@@ -36,10 +38,28 @@ func PrometheusHandler(envoyURL *url.URL, installationID string) (http.Handler,
 		return nil, fmt.Errorf("telemetry/metrics: invalid proxy URL: %w", err)
 	}
 
-	mux.Handle("/metrics", newProxyMetricsHandler(exporter, *envoyMetricsURL, installationID))
+	mux.Handle("/metrics", newProxyMetricsHandler(prom.DefaultGatherer, *envoyMetricsURL, installationID))
 	return mux, nil
 }
 
+// StartOTLPExporter starts pushing metrics to an OpenTelemetry collector every interval. The returned
+// function stops the exporter, after pushing metrics one last time.
+func StartOTLPExporter(opts otlp.Options, interval time.Duration) (stop func(), err error) {
+	if err := registerDefaultViews(); err != nil {
+		return nil, fmt.Errorf("telemetry/metrics: failed registering views: %w", err)
+	}
+
+	ir, err := metricexport.NewIntervalReader(metricexport.NewReader(), otlp.NewMetricsExporter(opts, "pomerium_"))
+	if err != nil {
+		return nil, fmt.Errorf("telemetry/metrics: otlp exporter: %w", err)
+	}
+	ir.ReportingInterval = interval
+	if err := ir.Start(); err != nil {
+		return nil, fmt.Errorf("telemetry/metrics: otlp exporter: %w", err)
+	}
+	return ir.Stop, nil
+}
+
 var (
 	globalExporter     *ocprom.Exporter
 	globalExporterErr  error
@@ -65,6 +85,12 @@ func getGlobalExporter() (*ocprom.Exporter, error) {
 			return
 		}
 
+		globalExporterErr = reg.Register(authorizeCheckDuration)
+		if globalExporterErr != nil {
+			globalExporterErr = fmt.Errorf("telemetry/metrics: failed registering authorize check duration: %w", globalExporterErr)
+			return
+		}
+
 		view.RegisterExporter(globalExporter)
 	})
 	return globalExporter, globalExporterErr
@@ -80,7 +106,7 @@ func registerDefaultViews() error {
 
 // newProxyMetricsHandler creates a subrequest to the envoy control plane for metrics and
 // combines them with our own
-func newProxyMetricsHandler(exporter *ocprom.Exporter, envoyURL url.URL, installationID string) http.HandlerFunc {
+func newProxyMetricsHandler(gatherer prom.Gatherer, envoyURL url.URL, installationID string) http.HandlerFunc {
 	hostname, err := os.Hostname()
 	if err != nil {
 		hostname = "__none__"
@@ -94,13 +120,25 @@ func newProxyMetricsHandler(exporter *ocprom.Exporter, envoyURL url.URL, install
 	}}
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Ensure we don't get entangled with compression from ocprom
-		r.Header.Del("Accept-Encoding")
-
-		rec := httptest.NewRecorder()
-		exporter.ServeHTTP(rec, r)
+		// exemplars are only exposed when the scraper negotiates the OpenMetrics format
+		format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		enc := expfmt.NewEncoder(w, format)
+		defer func() {
+			if closer, ok := enc.(expfmt.Closer); ok {
+				if err := closer.Close(); err != nil {
+					log.Error(r.Context()).Err(err).Send()
+				}
+			}
+		}()
+
+		ms, err := gatherer.Gather()
+		if err != nil {
+			log.Error(r.Context()).Err(err).Msg("telemetry/metrics: failed to gather metrics")
+			return
+		}
 
-		err := writeMetricsWithLabels(w, rec.Body, extraLabels)
+		err = writeMetricsWithLabels(enc, ms, extraLabels)
 		if err != nil {
 			log.Error(r.Context()).Err(err).Send()
 			return
@@ -119,7 +157,14 @@ func newProxyMetricsHandler(exporter *ocprom.Exporter, envoyURL url.URL, install
 		}
 		defer resp.Body.Close()
 
-		err = writeMetricsWithLabels(w, resp.Body, extraLabels)
+		var parser expfmt.TextParser
+		envoyMetrics, err := parser.TextToMetricFamilies(resp.Body)
+		if err != nil {
+			log.Error(r.Context()).Err(err).Msg("telemetry/metric: failed to read prometheus metrics")
+			return
+		}
+
+		err = writeMetricsWithLabels(enc, sortedMetricFamilies(envoyMetrics), extraLabels)
 		if err != nil {
 			log.Error(r.Context()).Err(err).Send()
 			return
@@ -127,18 +172,12 @@ func newProxyMetricsHandler(exporter *ocprom.Exporter, envoyURL url.URL, install
 	}
 }
 
-func writeMetricsWithLabels(w io.Writer, r io.Reader, extra []*io_prometheus_client.LabelPair) error {
-	var parser expfmt.TextParser
-	ms, err := parser.TextToMetricFamilies(r)
-	if err != nil {
-		return fmt.Errorf("telemetry/metric: failed to read prometheus metrics: %w", err)
-	}
-
+func writeMetricsWithLabels(enc expfmt.Encoder, ms []*io_prometheus_client.MetricFamily, extra []*io_prometheus_client.LabelPair) error {
 	for _, m := range ms {
 		for _, mm := range m.Metric {
 			mm.Label = append(mm.Label, extra...)
 		}
-		_, err = expfmt.MetricFamilyToText(w, m)
+		err := enc.Encode(m)
 		if err != nil {
 			return fmt.Errorf("telemetry/metric: failed to write prometheus metrics: %w", err)
 		}
@@ -146,3 +185,17 @@ func writeMetricsWithLabels(w io.Writer, r io.Reader, extra []*io_prometheus_cli
 
 	return nil
 }
+
+func sortedMetricFamilies(m map[string]*io_prometheus_client.MetricFamily) []*io_prometheus_client.MetricFamily {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ms := make([]*io_prometheus_client.MetricFamily, 0, len(m))
+	for _, name := range names {
+		ms = append(ms, m[name])
+	}
+	return ms
+}
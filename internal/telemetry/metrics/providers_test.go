@@ -1,12 +1,16 @@
 package metrics
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"regexp"
 	"testing"
+	"time"
+
+	octrace "go.opencensus.io/trace"
 )
 
 func newEnvoyMetricsHandler() http.HandlerFunc {
@@ -67,3 +71,43 @@ func Test_PrometheusHandler(t *testing.T) {
 		}
 	})
 }
+
+func Test_PrometheusHandlerExemplars(t *testing.T) {
+	ctx, span := octrace.StartSpan(context.Background(), "test", octrace.WithSampler(octrace.AlwaysSample()))
+	RecordAuthorizeCheckDuration(ctx, time.Millisecond*3)
+	span.End()
+
+	h, err := PrometheusHandler(&url.URL{}, "test_installation_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("text", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://test.local/metrics", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		b := rec.Body.Bytes()
+
+		if m, _ := regexp.Match(`(?m)^pomerium_authorize_check_duration_ms_bucket`, b); !m {
+			t.Errorf("Metrics endpoint did not contain authorize check duration: %s", b)
+		}
+		if m, _ := regexp.Match(`trace_id=`, b); m {
+			t.Errorf("Metrics endpoint contained exemplars in the text format: %s", b)
+		}
+	})
+	t.Run("openmetrics", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "http://test.local/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		b := rec.Body.Bytes()
+
+		re := regexp.MustCompile(`(?m)^pomerium_authorize_check_duration_ms_bucket.* # \{trace_id="` + span.SpanContext().TraceID.String() + `"\} 3\.0 `)
+		if !re.Match(b) {
+			t.Errorf("Metrics endpoint did not contain the trace id exemplar: %s", b)
+		}
+		if m, _ := regexp.Match(`(?m)^# EOF$`, b); !m {
+			t.Errorf("Metrics endpoint did not terminate the OpenMetrics exposition: %s", b)
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package otlp
+
+import (
+	"context"
+	"strconv"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+// aggregationTemporalityCumulative is the OTLP cumulative aggregation temporality.
+const aggregationTemporalityCumulative = 2
+
+type exportMetricsServiceRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type metric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Gauge       *gauge     `json:"gauge,omitempty"`
+	Sum         *sum       `json:"sum,omitempty"`
+	Histogram   *histogram `json:"histogram,omitempty"`
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type numberDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsInt             *string    `json:"asInt,omitempty"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+}
+
+type histogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	BucketCounts      []string   `json:"bucketCounts"`
+	ExplicitBounds    []float64  `json:"explicitBounds"`
+}
+
+// A MetricsExporter is an OpenCensus metrics exporter which sends metrics to an OTLP collector. It's
+// meant to be used with a metricexport.IntervalReader.
+type MetricsExporter struct {
+	opts Options
+	// prefix is added to the name of every metric.
+	prefix string
+}
+
+// NewMetricsExporter creates a new MetricsExporter. prefix is added to the name of every metric.
+func NewMetricsExporter(opts Options, prefix string) *MetricsExporter {
+	return &MetricsExporter{opts: opts, prefix: prefix}
+}
+
+// ExportMetrics sends metrics to the collector.
+func (e *MetricsExporter) ExportMetrics(ctx context.Context, data []*metricdata.Metric) error {
+	metrics := make([]metric, 0, len(data))
+	for _, m := range data {
+		if om, ok := e.toMetric(m); ok {
+			metrics = append(metrics, om)
+		}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	return e.opts.post(ctx, "/v1/metrics", &exportMetricsServiceRequest{
+		ResourceMetrics: []resourceMetrics{{
+			Resource: e.opts.resource(),
+			ScopeMetrics: []scopeMetrics{{
+				Scope:   newScope(),
+				Metrics: metrics,
+			}},
+		}},
+	})
+}
+
+func (e *MetricsExporter) toMetric(m *metricdata.Metric) (metric, bool) {
+	om := metric{
+		Name:        e.prefix + m.Descriptor.Name,
+		Description: m.Descriptor.Description,
+		Unit:        string(m.Descriptor.Unit),
+	}
+
+	switch m.Descriptor.Type {
+	case metricdata.TypeGaugeInt64, metricdata.TypeGaugeFloat64:
+		om.Gauge = &gauge{DataPoints: toNumberDataPoints(m)}
+	case metricdata.TypeCumulativeInt64, metricdata.TypeCumulativeFloat64:
+		om.Sum = &sum{
+			DataPoints:             toNumberDataPoints(m),
+			AggregationTemporality: aggregationTemporalityCumulative,
+			IsMonotonic:            true,
+		}
+	case metricdata.TypeCumulativeDistribution:
+		om.Histogram = &histogram{
+			DataPoints:             toHistogramDataPoints(m),
+			AggregationTemporality: aggregationTemporalityCumulative,
+		}
+	default:
+		// gauge distributions and summaries have no equivalent
+		return om, false
+	}
+	return om, true
+}
+
+func toAttributes(m *metricdata.Metric, ts *metricdata.TimeSeries) []keyValue {
+	attrs := map[string]interface{}{}
+	for i, lv := range ts.LabelValues {
+		if lv.Present && i < len(m.Descriptor.LabelKeys) {
+			attrs[m.Descriptor.LabelKeys[i].Key] = lv.Value
+		}
+	}
+	return toKeyValues(attrs)
+}
+
+func toNumberDataPoints(m *metricdata.Metric) []numberDataPoint {
+	var dps []numberDataPoint
+	for _, ts := range m.TimeSeries {
+		for _, p := range ts.Points {
+			dp := numberDataPoint{
+				Attributes:        toAttributes(m, ts),
+				StartTimeUnixNano: unixNano(ts.StartTime),
+				TimeUnixNano:      unixNano(p.Time),
+			}
+			switch v := p.Value.(type) {
+			case int64:
+				s := strconv.FormatInt(v, 10)
+				dp.AsInt = &s
+			case float64:
+				dp.AsDouble = &v
+			default:
+				continue
+			}
+			dps = append(dps, dp)
+		}
+	}
+	return dps
+}
+
+func toHistogramDataPoints(m *metricdata.Metric) []histogramDataPoint {
+	var dps []histogramDataPoint
+	for _, ts := range m.TimeSeries {
+		for _, p := range ts.Points {
+			d, ok := p.Value.(*metricdata.Distribution)
+			if !ok {
+				continue
+			}
+			dp := histogramDataPoint{
+				Attributes:        toAttributes(m, ts),
+				StartTimeUnixNano: unixNano(ts.StartTime),
+				TimeUnixNano:      unixNano(p.Time),
+				Count:             strconv.FormatInt(d.Count, 10),
+				Sum:               d.Sum,
+				BucketCounts:      make([]string, 0, len(d.Buckets)),
+				ExplicitBounds:    []float64{},
+			}
+			if d.BucketOptions != nil {
+				dp.ExplicitBounds = d.BucketOptions.Bounds
+			}
+			for _, b := range d.Buckets {
+				dp.BucketCounts = append(dp.BucketCounts, strconv.FormatInt(b.Count, 10))
+			}
+			dps = append(dps, dp)
+		}
+	}
+	return dps
+}
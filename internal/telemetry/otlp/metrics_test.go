@@ -0,0 +1,78 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/metric/metricdata"
+)
+
+func TestMetricsExporter(t *testing.T) {
+	var req exportMetricsServiceRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/metrics", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	e := NewMetricsExporter(Options{Endpoint: u, ServiceName: "pomerium", HTTPClient: srv.Client()}, "pomerium_")
+
+	now := time.Unix(1600000000, 0)
+	err := e.ExportMetrics(context.Background(), []*metricdata.Metric{{
+		Descriptor: metricdata.Descriptor{
+			Name:      "http_server_requests_total",
+			Type:      metricdata.TypeCumulativeInt64,
+			LabelKeys: []metricdata.LabelKey{{Key: "service"}, {Key: "host"}},
+		},
+		TimeSeries: []*metricdata.TimeSeries{{
+			LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue("proxy"), {}},
+			Points:      []metricdata.Point{metricdata.NewInt64Point(now, 5)},
+			StartTime:   now.Add(-time.Minute),
+		}},
+	}, {
+		Descriptor: metricdata.Descriptor{
+			Name: "http_server_request_duration_ms",
+			Unit: metricdata.UnitMilliseconds,
+			Type: metricdata.TypeCumulativeDistribution,
+		},
+		TimeSeries: []*metricdata.TimeSeries{{
+			Points: []metricdata.Point{metricdata.NewDistributionPoint(now, &metricdata.Distribution{
+				Count:         3,
+				Sum:           12,
+				BucketOptions: &metricdata.BucketOptions{Bounds: []float64{5}},
+				Buckets:       []metricdata.Bucket{{Count: 2}, {Count: 1}},
+			})},
+		}},
+	}, {
+		Descriptor: metricdata.Descriptor{Name: "summary", Type: metricdata.TypeSummary},
+	}})
+	require.NoError(t, err)
+
+	require.Len(t, req.ResourceMetrics, 1)
+	require.Len(t, req.ResourceMetrics[0].ScopeMetrics, 1)
+	metrics := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 2, "summaries should be skipped")
+
+	assert.Equal(t, "pomerium_http_server_requests_total", metrics[0].Name)
+	require.NotNil(t, metrics[0].Sum)
+	assert.True(t, metrics[0].Sum.IsMonotonic)
+	require.Len(t, metrics[0].Sum.DataPoints, 1)
+	dp := metrics[0].Sum.DataPoints[0]
+	assert.Equal(t, "5", *dp.AsInt)
+	assert.Equal(t, []keyValue{{Key: "service", Value: stringValue("proxy")}}, dp.Attributes)
+
+	assert.Equal(t, "ms", metrics[1].Unit)
+	require.NotNil(t, metrics[1].Histogram)
+	hdp := metrics[1].Histogram.DataPoints[0]
+	assert.Equal(t, "3", hdp.Count)
+	assert.Equal(t, []string{"2", "1"}, hdp.BucketCounts)
+	assert.Equal(t, []float64{5}, hdp.ExplicitBounds)
+}
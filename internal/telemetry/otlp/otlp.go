@@ -0,0 +1,153 @@
+// Package otlp contains OpenCensus trace and metrics exporters which send data to an OpenTelemetry
+// collector using the OTLP/HTTP JSON protocol.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/version"
+)
+
+// scopeName is the name of the instrumentation scope of exported data.
+const scopeName = "github.com/pomerium/pomerium"
+
+// Options are the options for the OTLP exporters.
+type Options struct {
+	// Endpoint is the base URL of the collector. Data is sent to /v1/traces and /v1/metrics under it.
+	Endpoint *url.URL
+	// Headers are added to every request, for example for authentication.
+	Headers map[string]string
+	// ServiceName is the service.name resource attribute.
+	ServiceName string
+	// ResourceAttributes are added to the resource of all exported data.
+	ResourceAttributes map[string]string
+	// HTTPClient is used to send requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+func (opts *Options) resource() resource {
+	attrs := map[string]string{"service.name": opts.ServiceName}
+	for k, v := range opts.ResourceAttributes {
+		attrs[k] = v
+	}
+
+	var r resource
+	for k, v := range attrs {
+		r.Attributes = append(r.Attributes, keyValue{Key: k, Value: stringValue(v)})
+	}
+	sort.Slice(r.Attributes, func(i, j int) bool {
+		return r.Attributes[i].Key < r.Attributes[j].Key
+	})
+	return r
+}
+
+func (opts *Options) post(ctx context.Context, path string, body interface{}) error {
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	u := *opts.Endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pomerium/"+version.FullVersion())
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp: error sending %s: %w", path, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("otlp: unexpected status code for %s: %d %s", path, res.StatusCode, msg)
+	}
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	return nil
+}
+
+// The types below are the JSON encoding of the OTLP protobuf messages. 64 bit integers are encoded as
+// strings.
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func stringValue(v string) anyValue {
+	return anyValue{StringValue: &v}
+}
+
+func toAnyValue(v interface{}) anyValue {
+	switch v := v.(type) {
+	case string:
+		return stringValue(v)
+	case bool:
+		return anyValue{BoolValue: &v}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return anyValue{IntValue: &s}
+	case float64:
+		return anyValue{DoubleValue: &v}
+	}
+	return stringValue(fmt.Sprint(v))
+}
+
+func toKeyValues(attrs map[string]interface{}) []keyValue {
+	kvs := make([]keyValue, 0, len(attrs))
+	for k, v := range attrs {
+		kvs = append(kvs, keyValue{Key: k, Value: toAnyValue(v)})
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
+	return kvs
+}
+
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+func newScope() scope {
+	return scope{Name: scopeName, Version: version.FullVersion()}
+}
@@ -0,0 +1,212 @@
+package otlp
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	octrace "go.opencensus.io/trace"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+const (
+	traceExportInterval  = 5 * time.Second
+	traceExportBatchSize = 512
+	traceMaxQueueSize    = 4096
+)
+
+// OTLP span kinds and status codes
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	statusCodeError = 2
+)
+
+type exportTraceServiceRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Events            []event    `json:"events,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type event struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// A TraceExporter is an OpenCensus trace exporter which sends spans to an OTLP collector. Spans are
+// queued and sent in batches in the background.
+type TraceExporter struct {
+	opts Options
+
+	mu    sync.Mutex
+	queue []*octrace.SpanData
+
+	flush     chan chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// NewTraceExporter creates a new TraceExporter.
+func NewTraceExporter(opts Options) *TraceExporter {
+	e := &TraceExporter{
+		opts:   opts,
+		flush:  make(chan chan struct{}),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// ExportSpan queues a span to be exported. If the queue is full the span is dropped.
+func (e *TraceExporter) ExportSpan(sd *octrace.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.queue) >= traceMaxQueueSize {
+		return
+	}
+	e.queue = append(e.queue, sd)
+}
+
+// Flush sends all the queued spans.
+func (e *TraceExporter) Flush() {
+	ch := make(chan struct{})
+	select {
+	case e.flush <- ch:
+		<-ch
+	case <-e.done:
+	}
+}
+
+// Close sends all the queued spans and stops the exporter.
+func (e *TraceExporter) Close() error {
+	e.closeOnce.Do(func() {
+		close(e.closed)
+	})
+	<-e.done
+	return nil
+}
+
+func (e *TraceExporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(traceExportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.closed:
+			e.send()
+			return
+		case ch := <-e.flush:
+			e.send()
+			close(ch)
+		case <-ticker.C:
+			e.send()
+		}
+	}
+}
+
+func (e *TraceExporter) send() {
+	e.mu.Lock()
+	queue := e.queue
+	e.queue = nil
+	e.mu.Unlock()
+
+	for len(queue) > 0 {
+		batch := queue
+		if len(batch) > traceExportBatchSize {
+			batch = batch[:traceExportBatchSize]
+		}
+		queue = queue[len(batch):]
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := e.opts.post(ctx, "/v1/traces", e.newRequest(batch))
+		cancel()
+		if err != nil {
+			log.Warn(ctx).Err(err).Int("spans", len(batch)).Msg("otlp: error exporting spans")
+		}
+	}
+}
+
+func (e *TraceExporter) newRequest(batch []*octrace.SpanData) *exportTraceServiceRequest {
+	spans := make([]span, 0, len(batch))
+	for _, sd := range batch {
+		spans = append(spans, toSpan(sd))
+	}
+	return &exportTraceServiceRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: e.opts.resource(),
+			ScopeSpans: []scopeSpans{{
+				Scope: newScope(),
+				Spans: spans,
+			}},
+		}},
+	}
+}
+
+func toSpan(sd *octrace.SpanData) span {
+	s := span{
+		TraceID:           hex.EncodeToString(sd.TraceID[:]),
+		SpanID:            hex.EncodeToString(sd.SpanID[:]),
+		Name:              sd.Name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: unixNano(sd.StartTime),
+		EndTimeUnixNano:   unixNano(sd.EndTime),
+		Attributes:        toKeyValues(sd.Attributes),
+	}
+	if sd.ParentSpanID != (octrace.SpanID{}) {
+		s.ParentSpanID = hex.EncodeToString(sd.ParentSpanID[:])
+	}
+	switch sd.SpanKind {
+	case octrace.SpanKindServer:
+		s.Kind = spanKindServer
+	case octrace.SpanKindClient:
+		s.Kind = spanKindClient
+	}
+	// opencensus uses gRPC status codes, where 0 is OK
+	if sd.Status.Code != 0 {
+		s.Status = status{Code: statusCodeError, Message: sd.Status.Message}
+	}
+	for _, a := range sd.Annotations {
+		s.Events = append(s.Events, event{
+			TimeUnixNano: unixNano(a.Time),
+			Name:         a.Message,
+			Attributes:   toKeyValues(a.Attributes),
+		})
+	}
+	return s
+}
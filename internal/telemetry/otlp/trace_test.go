@@ -0,0 +1,74 @@
+package otlp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	octrace "go.opencensus.io/trace"
+)
+
+func TestTraceExporter(t *testing.T) {
+	requests := make(chan *exportTraceServiceRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/otlp/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "KEY", r.Header.Get("X-Api-Key"))
+
+		var req exportTraceServiceRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests <- &req
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL + "/otlp/")
+	e := NewTraceExporter(Options{
+		Endpoint:           u,
+		Headers:            map[string]string{"X-Api-Key": "KEY"},
+		ServiceName:        "pomerium-authorize",
+		ResourceAttributes: map[string]string{"deployment.environment": "prod"},
+		HTTPClient:         srv.Client(),
+	})
+	defer e.Close()
+
+	start := time.Unix(1600000000, 0)
+	e.ExportSpan(&octrace.SpanData{
+		SpanContext: octrace.SpanContext{
+			TraceID: octrace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+			SpanID:  octrace.SpanID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+		},
+		ParentSpanID: octrace.SpanID{0x08},
+		SpanKind:     octrace.SpanKindServer,
+		Name:         "authorize.grpc.Check",
+		StartTime:    start,
+		EndTime:      start.Add(time.Millisecond),
+		Attributes:   map[string]interface{}{"allow": true, "count": int64(3)},
+		Status:       octrace.Status{Code: 7, Message: "denied"},
+	})
+	e.Flush()
+
+	req := <-requests
+	require.Len(t, req.ResourceSpans, 1)
+	rs := req.ResourceSpans[0]
+	assert.Equal(t, []keyValue{
+		{Key: "deployment.environment", Value: stringValue("prod")},
+		{Key: "service.name", Value: stringValue("pomerium-authorize")},
+	}, rs.Resource.Attributes)
+	require.Len(t, rs.ScopeSpans, 1)
+	require.Len(t, rs.ScopeSpans[0].Spans, 1)
+	s := rs.ScopeSpans[0].Spans[0]
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", s.TraceID)
+	assert.Equal(t, "0102030405060708", s.SpanID)
+	assert.Equal(t, "0800000000000000", s.ParentSpanID)
+	assert.Equal(t, "authorize.grpc.Check", s.Name)
+	assert.Equal(t, spanKindServer, s.Kind)
+	assert.Equal(t, "1600000000000000000", s.StartTimeUnixNano)
+	assert.Equal(t, "1600000000001000000", s.EndTimeUnixNano)
+	assert.Equal(t, status{Code: statusCodeError, Message: "denied"}, s.Status)
+	assert.Len(t, s.Attributes, 2)
+}
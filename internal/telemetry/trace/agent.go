@@ -0,0 +1,187 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/golang/protobuf/proto"
+	octrace "go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// AgentTraceServicePath is the path prefix of the OpenCensus agent trace service's methods.
+const AgentTraceServicePath = "/opencensus.proto.agent.trace.v1.TraceService/"
+
+// agentExporter is the exporter of the spans received by the agent trace service.
+var agentExporter atomic.Value
+
+// exporterValue wraps exporters so they can be stored in an atomic.Value.
+type exporterValue struct {
+	exporter octrace.Exporter
+}
+
+func init() {
+	agentExporter.Store(exporterValue{})
+}
+
+// setAgentExporter sets the exporter of the spans received by the agent trace service. If nil, they are
+// dropped.
+func setAgentExporter(exporter octrace.Exporter) {
+	agentExporter.Store(exporterValue{exporter})
+}
+
+// An AgentServer implements the Export method of the OpenCensus agent trace service, which envoy exports its
+// spans to when the tracing provider isn't supported by envoy itself. The spans are exported with pomerium's
+// own.
+type AgentServer struct{}
+
+// RegisterAgentServer registers the agent trace service with the gRPC server.
+func RegisterAgentServer(srv *grpc.Server) {
+	srv.RegisterService(&agentTraceServiceDesc, AgentServer{})
+}
+
+// Export exports the spans received from the stream.
+func (AgentServer) Export(stream grpc.ServerStream) error {
+	for {
+		req := new(exportTraceServiceRequest)
+		err := stream.RecvMsg(req)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		exporter := agentExporter.Load().(exporterValue).exporter
+		if exporter == nil {
+			continue
+		}
+		for _, span := range req.spans {
+			if sd, ok := fromAgentSpan(span); ok {
+				exporter.ExportSpan(sd)
+			}
+		}
+	}
+}
+
+// agentTraceServiceDesc describes the agent trace service. The generated package of the service isn't used,
+// since it depends on grpc-gateway.
+var agentTraceServiceDesc = grpc.ServiceDesc{
+	ServiceName: "opencensus.proto.agent.trace.v1.TraceService",
+	HandlerType: (*interface {
+		Export(grpc.ServerStream) error
+	})(nil),
+	Methods: []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Export",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(AgentServer).Export(stream)
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
+
+// exportTraceServiceRequest is an ExportTraceServiceRequest of the agent trace service. Only its spans are
+// decoded.
+type exportTraceServiceRequest struct {
+	spans []*tracepb.Span
+}
+
+const exportTraceServiceRequestSpansField = 2
+
+func (req *exportTraceServiceRequest) Reset()         { *req = exportTraceServiceRequest{} }
+func (req *exportTraceServiceRequest) String() string { return fmt.Sprintf("%d spans", len(req.spans)) }
+func (req *exportTraceServiceRequest) ProtoMessage()  {}
+
+// Marshal marshals the spans of the request.
+func (req *exportTraceServiceRequest) Marshal() ([]byte, error) {
+	var b []byte
+	for _, span := range req.spans {
+		bs, err := proto.Marshal(span)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, exportTraceServiceRequestSpansField, protowire.BytesType)
+		b = protowire.AppendBytes(b, bs)
+	}
+	return b, nil
+}
+
+// Unmarshal unmarshals the spans of the request. Other fields are skipped.
+func (req *exportTraceServiceRequest) Unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if num != exportTraceServiceRequestSpansField || typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			continue
+		}
+
+		bs, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		span := new(tracepb.Span)
+		if err := proto.Unmarshal(bs, span); err != nil {
+			return err
+		}
+		req.spans = append(req.spans, span)
+	}
+	return nil
+}
+
+func fromAgentSpan(span *tracepb.Span) (*octrace.SpanData, bool) {
+	sd := &octrace.SpanData{
+		Name:       span.GetName().GetValue(),
+		StartTime:  span.GetStartTime().AsTime(),
+		EndTime:    span.GetEndTime().AsTime(),
+		Attributes: map[string]interface{}{},
+		Status: octrace.Status{
+			Code:    span.GetStatus().GetCode(),
+			Message: span.GetStatus().GetMessage(),
+		},
+	}
+	if len(span.GetTraceId()) != len(sd.TraceID) || len(span.GetSpanId()) != len(sd.SpanID) {
+		return nil, false
+	}
+	copy(sd.TraceID[:], span.GetTraceId())
+	copy(sd.SpanID[:], span.GetSpanId())
+	if len(span.GetParentSpanId()) == len(sd.ParentSpanID) {
+		copy(sd.ParentSpanID[:], span.GetParentSpanId())
+	}
+
+	switch span.GetKind() {
+	case tracepb.Span_SERVER:
+		sd.SpanKind = octrace.SpanKindServer
+	case tracepb.Span_CLIENT:
+		sd.SpanKind = octrace.SpanKindClient
+	}
+
+	for k, v := range span.GetAttributes().GetAttributeMap() {
+		switch v := v.GetValue().(type) {
+		case *tracepb.AttributeValue_StringValue:
+			sd.Attributes[k] = v.StringValue.GetValue()
+		case *tracepb.AttributeValue_IntValue:
+			sd.Attributes[k] = v.IntValue
+		case *tracepb.AttributeValue_BoolValue:
+			sd.Attributes[k] = v.BoolValue
+		case *tracepb.AttributeValue_DoubleValue:
+			sd.Attributes[k] = v.DoubleValue
+		}
+	}
+	return sd, true
+}
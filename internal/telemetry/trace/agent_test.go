@@ -0,0 +1,86 @@
+package trace
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	octrace "go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type testExporter chan *octrace.SpanData
+
+func (exporter testExporter) ExportSpan(sd *octrace.SpanData) {
+	exporter <- sd
+}
+
+func TestAgentServer(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second*10)
+	defer clearTimeout()
+
+	exporter := make(testExporter, 1)
+	setAgentExporter(exporter)
+	defer setAgentExporter(nil)
+
+	srv := grpc.NewServer()
+	RegisterAgentServer(srv)
+	li := bufconn.Listen(1024 * 1024)
+	go func() { _ = srv.Serve(li) }()
+	defer srv.Stop()
+
+	cc, err := grpc.Dial("test",
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, target string) (net.Conn, error) {
+			return li.Dial()
+		}))
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	stream, err := cc.NewStream(ctx, &agentTraceServiceDesc.Streams[0], AgentTraceServicePath+"Export")
+	require.NoError(t, err)
+
+	start := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, stream.SendMsg(&exportTraceServiceRequest{spans: []*tracepb.Span{
+		{
+			TraceId:      []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+			SpanId:       []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			ParentSpanId: []byte{8, 7, 6, 5, 4, 3, 2, 1},
+			Name:         &tracepb.TruncatableString{Value: "ingress"},
+			Kind:         tracepb.Span_SERVER,
+			StartTime:    timestamppb.New(start),
+			EndTime:      timestamppb.New(start.Add(time.Second)),
+			Attributes: &tracepb.Span_Attributes{AttributeMap: map[string]*tracepb.AttributeValue{
+				"http.status_code": {Value: &tracepb.AttributeValue_StringValue{
+					StringValue: &tracepb.TruncatableString{Value: "200"},
+				}},
+			}},
+		},
+		{Name: &tracepb.TruncatableString{Value: "invalid ids"}},
+	}}))
+	require.NoError(t, stream.CloseSend())
+
+	select {
+	case sd := <-exporter:
+		assert.Equal(t, octrace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, sd.TraceID)
+		assert.Equal(t, octrace.SpanID{1, 2, 3, 4, 5, 6, 7, 8}, sd.SpanID)
+		assert.Equal(t, octrace.SpanID{8, 7, 6, 5, 4, 3, 2, 1}, sd.ParentSpanID)
+		assert.Equal(t, "ingress", sd.Name)
+		assert.Equal(t, octrace.SpanKindServer, sd.SpanKind)
+		assert.Equal(t, start, sd.StartTime.UTC())
+		assert.Equal(t, start.Add(time.Second), sd.EndTime.UTC())
+		assert.Equal(t, map[string]interface{}{"http.status_code": "200"}, sd.Attributes)
+	case <-ctx.Done():
+		t.Fatal("span wasn't exported")
+	}
+
+	assert.ErrorIs(t, stream.RecvMsg(new(exportTraceServiceRequest)), io.EOF)
+	assert.Empty(t, exporter, "spans with invalid ids should be dropped")
+}
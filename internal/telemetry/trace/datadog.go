@@ -3,6 +3,8 @@ package trace
 import (
 	datadog "github.com/DataDog/opencensus-go-exporter-datadog"
 	octrace "go.opencensus.io/trace"
+
+	"github.com/pomerium/pomerium/internal/version"
 )
 
 type datadogProvider struct {
@@ -11,8 +13,9 @@ type datadogProvider struct {
 
 func (provider *datadogProvider) Register(opts *TracingOptions) error {
 	dOpts := datadog.Options{
-		Service:   opts.Service,
-		TraceAddr: opts.DatadogAddress,
+		Service:    opts.Service,
+		TraceAddr:  opts.DatadogAddress,
+		GlobalTags: DatadogGlobalTags(opts),
 	}
 	dex, err := datadog.NewExporter(dOpts)
 	if err != nil {
@@ -32,3 +35,18 @@ func (provider *datadogProvider) Unregister() error {
 	provider.exporter = nil
 	return nil
 }
+
+// DatadogGlobalTags returns the tags added to all spans sent to Datadog: the unified service tags env
+// and version, and any configured tags.
+func DatadogGlobalTags(opts *TracingOptions) map[string]interface{} {
+	tags := map[string]interface{}{
+		"version": version.FullVersion(),
+	}
+	if opts.DatadogEnv != "" {
+		tags["env"] = opts.DatadogEnv
+	}
+	for k, v := range opts.DatadogTags {
+		tags[k] = v
+	}
+	return tags
+}
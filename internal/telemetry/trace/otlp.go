@@ -0,0 +1,35 @@
+package trace
+
+import (
+	octrace "go.opencensus.io/trace"
+
+	"github.com/pomerium/pomerium/internal/telemetry/otlp"
+)
+
+type otlpProvider struct {
+	exporter *otlp.TraceExporter
+}
+
+func (provider *otlpProvider) Register(opts *TracingOptions) error {
+	provider.exporter = otlp.NewTraceExporter(otlp.Options{
+		Endpoint:           opts.OTLPEndpoint,
+		Headers:            opts.OTLPHeaders,
+		ServiceName:        opts.Service,
+		ResourceAttributes: opts.ResourceAttributes,
+	})
+	octrace.RegisterExporter(provider.exporter)
+	// envoy doesn't support OTLP, so its spans are received by the agent trace service and exported here
+	setAgentExporter(provider.exporter)
+	return nil
+}
+
+func (provider *otlpProvider) Unregister() error {
+	if provider.exporter == nil {
+		return nil
+	}
+	setAgentExporter(nil)
+	octrace.UnregisterExporter(provider.exporter)
+	err := provider.exporter.Close()
+	provider.exporter = nil
+	return err
+}
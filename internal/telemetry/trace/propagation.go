@@ -0,0 +1,68 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+
+	"go.opencensus.io/plugin/ochttp/propagation/b3"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	octrace "go.opencensus.io/trace"
+	"go.opencensus.io/trace/propagation"
+)
+
+// W3C trace context headers.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// HTTPFormat propagates span contexts using both the W3C trace context headers (traceparent and
+// tracestate) and the B3 headers. When both are present on a request, the W3C headers take precedence.
+type HTTPFormat struct {
+	w3c tracecontext.HTTPFormat
+	b3  b3.HTTPFormat
+}
+
+var _ propagation.HTTPFormat = (*HTTPFormat)(nil)
+
+// SpanContextFromRequest extracts a span context from the request headers.
+func (f *HTTPFormat) SpanContextFromRequest(req *http.Request) (octrace.SpanContext, bool) {
+	if sc, ok := f.w3c.SpanContextFromRequest(req); ok {
+		return sc, true
+	}
+	return f.b3.SpanContextFromRequest(req)
+}
+
+// SpanContextToRequest adds the span context to the request headers.
+func (f *HTTPFormat) SpanContextToRequest(sc octrace.SpanContext, req *http.Request) {
+	f.w3c.SpanContextToRequest(sc, req)
+	f.b3.SpanContextToRequest(sc, req)
+}
+
+// SpanContextFromW3CHeaders parses a span context from traceparent and tracestate header values.
+func SpanContextFromW3CHeaders(traceparent, tracestate string) (octrace.SpanContext, bool) {
+	var f tracecontext.HTTPFormat
+	return f.SpanContextFromHeaders(traceparent, tracestate)
+}
+
+// SpanContextToW3CHeaders returns the traceparent and tracestate header values for a span context. The
+// tracestate is empty if the span context has none.
+func SpanContextToW3CHeaders(sc octrace.SpanContext) (traceparent, tracestate string) {
+	var f tracecontext.HTTPFormat
+	return f.SpanContextToHeaders(sc)
+}
+
+type remoteParentKey struct{}
+
+// ContextWithRemoteParent marks the span in the context as having been started from a span context
+// propagated by the caller.
+func ContextWithRemoteParent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, remoteParentKey{}, true)
+}
+
+// HasRemoteParent returns true if the span in the context was started from a span context propagated by
+// the caller.
+func HasRemoteParent(ctx context.Context) bool {
+	ok, _ := ctx.Value(remoteParentKey{}).(bool)
+	return ok
+}
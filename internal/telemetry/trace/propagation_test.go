@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	octrace "go.opencensus.io/trace"
+)
+
+func TestHTTPFormat(t *testing.T) {
+	var f HTTPFormat
+
+	t.Run("w3c", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		req.Header.Set("tracestate", "vendor=value")
+		req.Header.Set("X-B3-TraceId", "9de3f6756f315fef")
+		req.Header.Set("X-B3-SpanId", "b4f83d3096b6bf9c")
+
+		sc, ok := f.SpanContextFromRequest(req)
+		assert.True(t, ok)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+		assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+		assert.True(t, sc.IsSampled())
+		if assert.NotNil(t, sc.Tracestate) {
+			assert.Equal(t, "value", sc.Tracestate.Entries()[0].Value)
+		}
+	})
+	t.Run("b3", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		req.Header.Set("X-B3-TraceId", "9de3f6756f315fef")
+		req.Header.Set("X-B3-SpanId", "b4f83d3096b6bf9c")
+
+		sc, ok := f.SpanContextFromRequest(req)
+		assert.True(t, ok)
+		assert.Equal(t, "b4f83d3096b6bf9c", sc.SpanID.String())
+	})
+	t.Run("inject", func(t *testing.T) {
+		sc, _ := SpanContextFromW3CHeaders("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "")
+		req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+		f.SpanContextToRequest(sc, req)
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", req.Header.Get("traceparent"))
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", req.Header.Get("X-B3-TraceId"))
+		assert.Equal(t, "00f067aa0ba902b7", req.Header.Get("X-B3-SpanId"))
+	})
+}
+
+func TestSpanContextToW3CHeaders(t *testing.T) {
+	sc, ok := SpanContextFromW3CHeaders("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "a=1,b=2")
+	assert.True(t, ok)
+	assert.False(t, sc.IsSampled())
+
+	traceparent, tracestate := SpanContextToW3CHeaders(sc)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", traceparent)
+	assert.Equal(t, "a=1,b=2", tracestate)
+
+	_, ok = SpanContextFromW3CHeaders("invalid", "")
+	assert.False(t, ok)
+
+	traceparent, tracestate = SpanContextToW3CHeaders(octrace.SpanContext{})
+	assert.Equal(t, "00-00000000000000000000000000000000-0000000000000000-00", traceparent)
+	assert.Empty(t, tracestate)
+}
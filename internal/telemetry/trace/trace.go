@@ -2,6 +2,7 @@ package trace
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
 
@@ -15,10 +16,22 @@ const (
 	DatadogTracingProviderName = "datadog"
 	// JaegerTracingProviderName is the name of the tracing provider Jaeger.
 	JaegerTracingProviderName = "jaeger"
+	// OTLPTracingProviderName is the name of the tracing provider OpenTelemetry (OTLP).
+	OTLPTracingProviderName = "otlp"
 	// ZipkinTracingProviderName is the name of the tracing provider Zipkin.
 	ZipkinTracingProviderName = "zipkin"
 )
 
+const (
+	// AlwaysSampler samples every trace.
+	AlwaysSampler = "always"
+	// NeverSampler samples no traces.
+	NeverSampler = "never"
+	// ProbabilitySampler samples the fraction of traces given by the sample rate, and every trace whose
+	// parent span was sampled. It's the default.
+	ProbabilitySampler = "probability"
+)
+
 // Provider is a trace provider.
 type Provider interface {
 	Register(options *TracingOptions) error
@@ -34,6 +47,10 @@ type TracingOptions struct {
 
 	// Datadog
 	DatadogAddress string
+	// DatadogEnv is the env tag of all spans.
+	DatadogEnv string
+	// DatadogTags are added to all spans. The version tag defaults to the pomerium version.
+	DatadogTags map[string]string
 
 	// Jaeger
 
@@ -50,10 +67,35 @@ type TracingOptions struct {
 	// Example: http://zipkin:9411/api/v2/spans
 	ZipkinEndpoint *url.URL
 
+	// OTLP
+
+	// OTLPEndpoint is the base URL of the OpenTelemetry collector's OTLP/HTTP receiver.
+	// Example: http://otel-collector:4318
+	OTLPEndpoint *url.URL
+	// OTLPHeaders are added to every request sent to the collector.
+	OTLPHeaders map[string]string
+	// ResourceAttributes are added to the OTLP resource of every span.
+	ResourceAttributes map[string]string
+
+	// Sampler is the sampler used to decide which traces are sampled.
+	Sampler string
 	// SampleRate is percentage of requests which are sampled
 	SampleRate float64
 }
 
+// MarshalJSON marshals the options with the values of the OTLP headers, which may contain credentials, redacted.
+func (t TracingOptions) MarshalJSON() ([]byte, error) {
+	type tracingOptions TracingOptions
+	opts := tracingOptions(t)
+	if len(t.OTLPHeaders) > 0 {
+		opts.OTLPHeaders = make(map[string]string, len(t.OTLPHeaders))
+		for k := range t.OTLPHeaders {
+			opts.OTLPHeaders[k] = "[redacted]"
+		}
+	}
+	return json.Marshal(opts)
+}
+
 // Enabled indicates whether tracing is enabled on a given TracingOptions
 func (t *TracingOptions) Enabled() bool {
 	return t.Provider != ""
@@ -67,17 +109,36 @@ func GetProvider(opts *TracingOptions) (Provider, error) {
 		provider = new(datadogProvider)
 	case JaegerTracingProviderName:
 		provider = new(jaegerProvider)
+	case OTLPTracingProviderName:
+		provider = new(otlpProvider)
 	case ZipkinTracingProviderName:
 		provider = new(zipkinProvider)
 	default:
 		return nil, fmt.Errorf("telemetry/trace: provider %s unknown", opts.Provider)
 	}
-	octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.ProbabilitySampler(opts.SampleRate)})
+	sampler, err := GetSampler(opts.Sampler, opts.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+	octrace.ApplyConfig(octrace.Config{DefaultSampler: sampler})
 
 	log.Debug(context.TODO()).Interface("Opts", opts).Msg("telemetry/trace: provider created")
 	return provider, nil
 }
 
+// GetSampler returns the named sampler.
+func GetSampler(name string, sampleRate float64) (octrace.Sampler, error) {
+	switch name {
+	case AlwaysSampler:
+		return octrace.AlwaysSample(), nil
+	case NeverSampler:
+		return octrace.NeverSample(), nil
+	case ProbabilitySampler, "":
+		return octrace.ProbabilitySampler(sampleRate), nil
+	}
+	return nil, fmt.Errorf("telemetry/trace: sampler %s unknown", name)
+}
+
 // StartSpan starts a new child span of the current span in the context. If
 // there is no span in the context, creates a new trace and span.
 //
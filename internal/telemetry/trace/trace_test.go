@@ -1,7 +1,9 @@
 package trace
 
 import (
+	"encoding/json"
 	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -16,6 +18,8 @@ func TestGetProvider(t *testing.T) {
 		{"jaeger no endpoint", &TracingOptions{JaegerAgentEndpoint: "", Service: "all", Provider: "jaeger"}, false},
 		{"unknown provider", &TracingOptions{JaegerAgentEndpoint: "localhost:0", Service: "all", Provider: "Lucius Cornelius Sulla"}, true},
 		{"zipkin with debug", &TracingOptions{ZipkinEndpoint: &url.URL{Host: "localhost"}, Service: "all", Provider: "zipkin", Debug: true}, false},
+		{"otlp", &TracingOptions{OTLPEndpoint: &url.URL{Scheme: "http", Host: "localhost:4318"}, Service: "all", Provider: "otlp", Sampler: "always"}, false},
+		{"unknown sampler", &TracingOptions{OTLPEndpoint: &url.URL{Scheme: "http", Host: "localhost:4318"}, Service: "all", Provider: "otlp", Sampler: "sometimes"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -25,3 +29,17 @@ func TestGetProvider(t *testing.T) {
 		})
 	}
 }
+
+func TestTracingOptions_MarshalJSON(t *testing.T) {
+	opts := &TracingOptions{Provider: "otlp", OTLPHeaders: map[string]string{"Authorization": "Bearer SECRET"}}
+	bs, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(bs), "SECRET") || !strings.Contains(string(bs), `"OTLPHeaders":{"Authorization":"[redacted]"}`) {
+		t.Errorf("MarshalJSON() = %s, expected the OTLP headers to be redacted", bs)
+	}
+	if opts.OTLPHeaders["Authorization"] != "Bearer SECRET" {
+		t.Errorf("MarshalJSON() modified the options")
+	}
+}
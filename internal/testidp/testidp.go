@@ -0,0 +1,521 @@
+// Package testidp is an OpenID Connect provider for integration tests and local development. It signs in
+// the configured users without a password, so it must never be used to protect anything.
+package testidp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+// Endpoint paths.
+const (
+	DiscoveryPath     = "/.well-known/openid-configuration"
+	JWKSPath          = "/.well-known/jwks.json"
+	AuthorizationPath = "/oauth2/authorize"
+	TokenPath         = "/oauth2/token"
+	UserInfoPath      = "/oauth2/userinfo"
+	RevocationPath    = "/oauth2/revoke"
+	EndSessionPath    = "/oauth2/logout"
+)
+
+const (
+	defaultTokenLifetime = time.Hour
+	codeLifetime         = time.Minute
+)
+
+// A User is a user the provider signs in.
+type User struct {
+	// ID is the subject of the user's tokens.
+	ID     string   `json:"id" yaml:"id"`
+	Email  string   `json:"email" yaml:"email"`
+	Name   string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	// Claims are additional claims of the user's ID token and user info.
+	Claims map[string]interface{} `json:"claims,omitempty" yaml:"claims,omitempty"`
+}
+
+// claims returns the claims of the user. The standard claims take precedence over the additional ones.
+func (u *User) claims() map[string]interface{} {
+	claims := make(map[string]interface{}, len(u.Claims)+5)
+	for k, v := range u.Claims {
+		claims[k] = v
+	}
+	claims["sub"] = u.ID
+	if u.Email != "" {
+		claims["email"] = u.Email
+		claims["email_verified"] = true
+	}
+	if u.Name != "" {
+		claims["name"] = u.Name
+	}
+	if len(u.Groups) > 0 {
+		claims["groups"] = u.Groups
+	}
+	return claims
+}
+
+// Options are the options of the provider.
+type Options struct {
+	// Issuer is the issuer url of the provider. If empty, it's derived from the host of each request.
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	// ClientID and ClientSecret are the credentials of the only client of the provider. If ClientID is empty,
+	// any client is accepted.
+	ClientID     string `json:"client_id,omitempty" yaml:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+	// TokenLifetime is the lifetime of access and ID tokens. Defaults to 1 hour.
+	TokenLifetime time.Duration `json:"token_lifetime,omitempty" yaml:"token_lifetime,omitempty"`
+	// Users are the users the provider signs in.
+	Users []User `json:"users" yaml:"users"`
+}
+
+// LoadOptions loads options from a YAML or JSON file.
+func LoadOptions(name string) (*Options, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var options Options
+	if err := yaml.Unmarshal(data, &options); err != nil {
+		return nil, fmt.Errorf("testidp: invalid options in %s: %w", name, err)
+	}
+	return &options, nil
+}
+
+// An IDP is a mock OpenID Connect provider. It supports the authorization code flow, with PKCE, refresh
+// tokens, user info, token revocation and RP-initiated log out.
+type IDP struct {
+	options Options
+	key     jose.JSONWebKey
+	signer  jose.Signer
+	now     func() time.Time
+
+	mu            sync.Mutex
+	codes         map[string]*authorization
+	accessTokens  map[string]*grant
+	refreshTokens map[string]*grant
+}
+
+// An authorization is an authorization request which was granted a code.
+type authorization struct {
+	user                *User
+	clientID            string
+	redirectURI         string
+	nonce               string
+	codeChallenge       string
+	codeChallengeMethod string
+	expiry              time.Time
+}
+
+// A grant is the grant of an access or refresh token.
+type grant struct {
+	user     *User
+	clientID string
+	expiry   time.Time
+}
+
+// New creates a new IDP, with a new signing key.
+func New(options Options) (*IDP, error) {
+	if len(options.Users) == 0 {
+		return nil, errors.New("testidp: at least one user is required")
+	}
+	for i, u := range options.Users {
+		if u.ID == "" {
+			return nil, fmt.Errorf("testidp: user %d: id is required", i)
+		}
+	}
+	if options.TokenLifetime <= 0 {
+		options.TokenLifetime = defaultTokenLifetime
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("testidp: error generating signing key: %w", err)
+	}
+	key := jose.JSONWebKey{Key: privateKey, Algorithm: string(jose.ES256), Use: "sig"}
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	key.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return nil, fmt.Errorf("testidp: error creating signer: %w", err)
+	}
+
+	return &IDP{
+		options:       options,
+		key:           key,
+		signer:        signer,
+		now:           time.Now,
+		codes:         make(map[string]*authorization),
+		accessTokens:  make(map[string]*grant),
+		refreshTokens: make(map[string]*grant),
+	}, nil
+}
+
+// ServeHTTP serves the endpoints of the provider.
+func (idp *IDP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case DiscoveryPath:
+		idp.serveDiscovery(w, r)
+	case JWKSPath:
+		writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{idp.key.Public()}})
+	case AuthorizationPath:
+		idp.serveAuthorization(w, r)
+	case TokenPath:
+		idp.serveToken(w, r)
+	case UserInfoPath:
+		idp.serveUserInfo(w, r)
+	case RevocationPath:
+		idp.serveRevocation(w, r)
+	case EndSessionPath:
+		idp.serveEndSession(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (idp *IDP) issuer(r *http.Request) string {
+	if idp.options.Issuer != "" {
+		return strings.TrimSuffix(idp.options.Issuer, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (idp *IDP) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	issuer := idp.issuer(r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + AuthorizationPath,
+		"token_endpoint":                        issuer + TokenPath,
+		"userinfo_endpoint":                     issuer + UserInfoPath,
+		"jwks_uri":                              issuer + JWKSPath,
+		"revocation_endpoint":                   issuer + RevocationPath,
+		"end_session_endpoint":                  issuer + EndSessionPath,
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{string(jose.ES256)},
+		"scopes_supported":                      []string{"openid", "email", "profile", "groups", "offline_access"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"claims_supported":                      []string{"sub", "email", "email_verified", "name", "groups"},
+	})
+}
+
+var userPickerTemplate = template.Must(template.New("users").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in</title></head>
+<body>
+<h1>Sign in as</h1>
+<ul>
+{{range .}}<li><a href="{{.URL}}">{{.User.Email}}{{if .User.Name}} ({{.User.Name}}){{end}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+// serveAuthorization signs in the user given by the user parameter or the login hint, or the only user.
+// Otherwise the user is asked who to sign in as.
+func (idp *IDP) serveAuthorization(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clientID := r.Form.Get("client_id")
+	if idp.options.ClientID != "" && clientID != idp.options.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	// the remaining errors are returned to the client
+	redirectError := func(code, description string) {
+		q := redirectURI.Query()
+		q.Set("error", code)
+		q.Set("error_description", description)
+		if state := r.Form.Get("state"); state != "" {
+			q.Set("state", state)
+		}
+		redirectURI.RawQuery = q.Encode()
+		http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+	}
+	if r.Form.Get("response_type") != "code" {
+		redirectError("unsupported_response_type", "only the code response type is supported")
+		return
+	}
+	if r.Form.Get("request") != "" || r.Form.Get("request_uri") != "" {
+		redirectError("request_not_supported", "request objects aren't supported")
+		return
+	}
+	method := r.Form.Get("code_challenge_method")
+	if r.Form.Get("code_challenge") != "" && method != "" && method != "S256" && method != "plain" {
+		redirectError("invalid_request", "unsupported code_challenge_method")
+		return
+	}
+
+	user := idp.findUser(r.Form.Get("user"))
+	if user == nil {
+		user = idp.findUser(r.Form.Get("login_hint"))
+	}
+	if user == nil && len(idp.options.Users) == 1 {
+		user = &idp.options.Users[0]
+	}
+	if user == nil {
+		idp.serveUserPicker(w, r)
+		return
+	}
+
+	code := newToken()
+	idp.mu.Lock()
+	idp.codes[code] = &authorization{
+		user:                user,
+		clientID:            clientID,
+		redirectURI:         r.Form.Get("redirect_uri"),
+		nonce:               r.Form.Get("nonce"),
+		codeChallenge:       r.Form.Get("code_challenge"),
+		codeChallengeMethod: method,
+		expiry:              idp.now().Add(codeLifetime),
+	}
+	idp.mu.Unlock()
+
+	q := redirectURI.Query()
+	q.Set("code", code)
+	if state := r.Form.Get("state"); state != "" {
+		q.Set("state", state)
+	}
+	redirectURI.RawQuery = q.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (idp *IDP) serveUserPicker(w http.ResponseWriter, r *http.Request) {
+	type choice struct {
+		User *User
+		URL  string
+	}
+	var choices []choice
+	for i := range idp.options.Users {
+		u := &idp.options.Users[i]
+		q := make(url.Values)
+		for k, vs := range r.Form {
+			q[k] = vs
+		}
+		q.Set("user", u.ID)
+		choices = append(choices, choice{User: u, URL: AuthorizationPath + "?" + q.Encode()})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	_ = userPickerTemplate.Execute(w, choices)
+}
+
+// findUser returns the user with the given id or email, or nil if there is none.
+func (idp *IDP) findUser(idOrEmail string) *User {
+	if idOrEmail == "" {
+		return nil
+	}
+	for i := range idp.options.Users {
+		u := &idp.options.Users[i]
+		if u.ID == idOrEmail || strings.EqualFold(u.Email, idOrEmail) {
+			return u
+		}
+	}
+	return nil
+}
+
+func (idp *IDP) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	clientID, ok := idp.authenticateClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="testidp"`)
+		writeTokenError(w, http.StatusUnauthorized, "invalid_client", "invalid client credentials")
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		idp.mu.Lock()
+		authz, ok := idp.codes[r.PostForm.Get("code")]
+		// codes can only be used once
+		delete(idp.codes, r.PostForm.Get("code"))
+		idp.mu.Unlock()
+
+		switch {
+		case !ok, authz.expiry.Before(idp.now()), authz.clientID != clientID:
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+		case authz.redirectURI != r.PostForm.Get("redirect_uri"):
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri doesn't match")
+		case !verifyCodeChallenge(authz, r.PostForm.Get("code_verifier")):
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+		default:
+			idp.writeTokens(w, r, authz.user, clientID, authz.nonce)
+		}
+	case "refresh_token":
+		idp.mu.Lock()
+		g, ok := idp.refreshTokens[r.PostForm.Get("refresh_token")]
+		// refresh tokens are rotated
+		delete(idp.refreshTokens, r.PostForm.Get("refresh_token"))
+		idp.mu.Unlock()
+
+		if !ok || g.clientID != clientID {
+			writeTokenError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+		idp.writeTokens(w, r, g.user, clientID, "")
+	default:
+		writeTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant_type")
+	}
+}
+
+// authenticateClient returns the id of the client, authenticated with basic auth or the client_secret_post
+// method.
+func (idp *IDP) authenticateClient(r *http.Request) (clientID string, ok bool) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		// the credentials are form encoded before they're base64 encoded
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if idp.options.ClientID == "" {
+		return clientID, true
+	}
+	return clientID, clientID == idp.options.ClientID &&
+		subtle.ConstantTimeCompare([]byte(clientSecret), []byte(idp.options.ClientSecret)) == 1
+}
+
+func verifyCodeChallenge(authz *authorization, verifier string) bool {
+	if authz.codeChallenge == "" {
+		return true
+	}
+	if authz.codeChallengeMethod == "plain" {
+		return verifier == authz.codeChallenge
+	}
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:]) == authz.codeChallenge
+}
+
+func (idp *IDP) writeTokens(w http.ResponseWriter, r *http.Request, user *User, clientID, nonce string) {
+	now := idp.now()
+	expiry := now.Add(idp.options.TokenLifetime)
+
+	claims := user.claims()
+	claims["iss"] = idp.issuer(r)
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = expiry.Unix()
+	claims["auth_time"] = now.Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	idToken, err := jwt.Signed(idp.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		writeTokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	accessToken, refreshToken := newToken(), newToken()
+	idp.mu.Lock()
+	idp.accessTokens[accessToken] = &grant{user: user, clientID: clientID, expiry: expiry}
+	idp.refreshTokens[refreshToken] = &grant{user: user, clientID: clientID}
+	idp.mu.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int64(idp.options.TokenLifetime.Seconds()),
+		"refresh_token": refreshToken,
+		"id_token":      idToken,
+	})
+}
+
+func (idp *IDP) serveUserInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	idp.mu.Lock()
+	g, ok := idp.accessTokens[accessToken]
+	idp.mu.Unlock()
+	if !ok || g.expiry.Before(idp.now()) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.user.claims())
+}
+
+// serveRevocation revokes an access or refresh token. As required by RFC 7009, unknown tokens aren't an error.
+func (idp *IDP) serveRevocation(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token := r.PostForm.Get("token")
+	idp.mu.Lock()
+	delete(idp.accessTokens, token)
+	delete(idp.refreshTokens, token)
+	idp.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (idp *IDP) serveEndSession(w http.ResponseWriter, r *http.Request) {
+	if redirectURI := r.FormValue("post_logout_redirect_uri"); redirectURI != "" {
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	_, _ = fmt.Fprintln(w, "signed out")
+}
+
+func newToken() string {
+	return base64.RawURLEncoding.EncodeToString(cryptutil.NewKey())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeTokenError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,179 @@
+package testidp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/internal/identity"
+	"github.com/pomerium/pomerium/internal/identity/oauth"
+	"github.com/pomerium/pomerium/internal/identity/oidc"
+)
+
+func newTestServer(t *testing.T, options Options) *httptest.Server {
+	idp, err := New(options)
+	require.NoError(t, err)
+	srv := httptest.NewServer(idp)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// signIn follows the sign in url to the provider, and returns the query of the redirect to the client.
+func signIn(t *testing.T, signInURL string) url.Values {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(signInURL)
+	require.NoError(t, err)
+	_ = res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	return location.Query()
+}
+
+// TestConformance signs in with pomerium's OpenID Connect provider.
+func TestConformance(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer clearTimeout()
+
+	srv := newTestServer(t, Options{
+		ClientID:     "CLIENT_ID",
+		ClientSecret: "CLIENT_SECRET",
+		Users: []User{
+			{ID: "alice", Email: "alice@example.com", Name: "Alice", Groups: []string{"admins"}},
+			{ID: "bob", Email: "bob@example.com", Claims: map[string]interface{}{"tenant": "acme"}},
+		},
+	})
+
+	for _, pkce := range []bool{false, true} {
+		redirectURL, _ := url.Parse("https://authenticate.example.com/oauth2/callback")
+		p, err := oidc.New(ctx, &oauth.Options{
+			ProviderURL:     srv.URL,
+			ClientID:        "CLIENT_ID",
+			ClientSecret:    "CLIENT_SECRET",
+			RedirectURL:     redirectURL,
+			AuthCodeOptions: map[string]string{"login_hint": "bob@example.com"},
+			PKCE:            pkce,
+			PKCEKey:         []byte("01234567890123456789012345678901"),
+		})
+		require.NoError(t, err)
+
+		signInURL, err := p.GetSignInURL("STATE")
+		require.NoError(t, err)
+		q := signIn(t, signInURL)
+		assert.Equal(t, "STATE", q.Get("state"))
+		require.NotEmpty(t, q.Get("code"), q.Get("error_description"))
+
+		var claims identity.SessionClaims
+		token, err := p.Authenticate(oauth.WithState(ctx, "STATE"), q.Get("code"), &claims)
+		require.NoError(t, err, "pkce: %v", pkce)
+		assert.Equal(t, "bob", claims.Claims["sub"])
+		assert.Equal(t, "bob@example.com", claims.Claims["email"])
+		assert.Equal(t, "acme", claims.Claims["tenant"])
+		assert.NotEmpty(t, claims.RawIDToken)
+
+		_, err = p.Authenticate(oauth.WithState(ctx, "STATE"), q.Get("code"), &claims)
+		assert.Error(t, err, "codes should only be used once")
+
+		// tokens are only refreshed once they expire
+		token.Expiry = time.Now().Add(-time.Minute)
+		var refreshed identity.SessionClaims
+		newToken, err := p.Refresh(ctx, token, &refreshed)
+		require.NoError(t, err)
+		assert.NotEqual(t, token.RefreshToken, newToken.RefreshToken)
+		assert.Equal(t, "bob", refreshed.Claims["sub"])
+		_, err = p.Refresh(ctx, token, &refreshed)
+		assert.Error(t, err, "refresh tokens should be rotated")
+
+		assert.NoError(t, p.Revoke(ctx, newToken))
+		assert.Error(t, p.UpdateUserInfo(ctx, newToken, &refreshed), "revoked tokens should be rejected")
+
+		logOutURL, err := p.LogOut()
+		require.NoError(t, err)
+		assert.Equal(t, srv.URL+EndSessionPath, logOutURL.String())
+	}
+}
+
+func TestIDP_authorization(t *testing.T) {
+	srv := newTestServer(t, Options{
+		Users: []User{{ID: "alice", Email: "alice@example.com"}, {ID: "bob", Email: "bob@example.com"}},
+	})
+	authorize := func(params url.Values) *http.Response {
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		res, err := client.Get(srv.URL + AuthorizationPath + "?" + params.Encode())
+		require.NoError(t, err)
+		_ = res.Body.Close()
+		return res
+	}
+
+	t.Run("user picker", func(t *testing.T) {
+		res := authorize(url.Values{
+			"response_type": {"code"},
+			"client_id":     {"CLIENT_ID"},
+			"redirect_uri":  {"https://client.example.com/callback"},
+		})
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "text/html; charset=UTF-8", res.Header.Get("Content-Type"))
+	})
+	t.Run("invalid redirect uri", func(t *testing.T) {
+		res := authorize(url.Values{"response_type": {"code"}, "redirect_uri": {"/callback"}})
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+	t.Run("unsupported response type", func(t *testing.T) {
+		res := authorize(url.Values{
+			"response_type": {"token"},
+			"redirect_uri":  {"https://client.example.com/callback"},
+			"state":         {"STATE"},
+		})
+		assert.Equal(t, http.StatusFound, res.StatusCode)
+		location, err := url.Parse(res.Header.Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "unsupported_response_type", location.Query().Get("error"))
+		assert.Equal(t, "STATE", location.Query().Get("state"))
+	})
+}
+
+func TestLoadOptions(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "users.yaml")
+	require.NoError(t, os.WriteFile(name, []byte(`
+client_id: pomerium
+client_secret: secret
+token_lifetime: 5m
+users:
+  - id: alice
+    email: alice@example.com
+    groups: [admins]
+    claims:
+      tenant: acme
+      address:
+        country: US
+`), 0o600))
+
+	options, err := LoadOptions(name)
+	require.NoError(t, err)
+	assert.Equal(t, &Options{
+		ClientID:      "pomerium",
+		ClientSecret:  "secret",
+		TokenLifetime: 5 * time.Minute,
+		Users: []User{{
+			ID:     "alice",
+			Email:  "alice@example.com",
+			Groups: []string{"admins"},
+			Claims: map[string]interface{}{
+				"tenant":  "acme",
+				"address": map[string]interface{}{"country": "US"},
+			},
+		}},
+	}, options)
+}
@@ -12,6 +12,7 @@ const (
 	QuerySessionEncrypted = "pomerium_session_encrypted"
 	QueryRedirectURI      = "pomerium_redirect_uri"
 	QueryForwardAuthURI   = "uri"
+	QueryAudience         = "pomerium_audience"
 )
 
 // URL signature based query params used for verifying the authenticity of a URL.
@@ -109,6 +109,44 @@ func GetDomainsForURL(u url.URL) []string {
 	return []string{u.Hostname(), net.JoinHostPort(u.Hostname(), defaultPort)}
 }
 
+// IsWildcardHost returns whether or not the given host, with an optional port, matches any subdomain, e.g.
+// *.apps.example.com.
+func IsWildcardHost(host string) bool {
+	return strings.HasPrefix(host, "*.")
+}
+
+// MatchWildcardHost returns the subdomain of the host matched by the wildcard of the pattern, e.g. tenant for
+// tenant.apps.example.com and *.apps.example.com. The wildcard matches one or more labels, and the ports must be
+// the same. It returns false if the pattern isn't a wildcard host or the host doesn't match it.
+func MatchWildcardHost(pattern, host string) (string, bool) {
+	if !IsWildcardHost(pattern) {
+		return "", false
+	}
+	suffix := pattern[1:]
+	if len(host) <= len(suffix) || !strings.HasSuffix(host, suffix) {
+		return "", false
+	}
+	subdomain := host[:len(host)-len(suffix)]
+	if strings.ContainsAny(subdomain, ":[]") {
+		return "", false
+	}
+	return subdomain, true
+}
+
+// IsUnix returns whether or not the given URL is for a unix domain socket, e.g. unix:///var/run/app.sock.
+func IsUnix(u *url.URL) bool {
+	return u.Scheme == "unix"
+}
+
+// UnixSocketPath returns the path of a unix domain socket address, e.g. unix:///var/run/pomerium.sock, and whether
+// the address is for a unix domain socket.
+func UnixSocketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, "unix://") {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, "unix://"), true
+}
+
 // IsTCP returns whether or not the given URL is for TCP via HTTP Connect.
 func IsTCP(u *url.URL) bool {
 	return u.Scheme == "tcp+http" || u.Scheme == "tcp+https"
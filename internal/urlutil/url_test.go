@@ -158,3 +158,32 @@ func TestGetDomainsForURL(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchWildcardHost(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		pattern       string
+		host          string
+		wantSubdomain string
+		wantOK        bool
+	}{
+		{"subdomain", "*.apps.example.com", "tenant.apps.example.com", "tenant", true},
+		{"nested subdomain", "*.apps.example.com", "a.tenant.apps.example.com", "a.tenant", true},
+		{"with port", "*.apps.example.com:8443", "tenant.apps.example.com:8443", "tenant", true},
+		{"different port", "*.apps.example.com:8443", "tenant.apps.example.com:9443", "", false},
+		{"port on host only", "*.apps.example.com", "tenant.apps.example.com:8443", "", false},
+		{"parent domain", "*.apps.example.com", "apps.example.com", "", false},
+		{"empty subdomain", "*.apps.example.com", ".apps.example.com", "", false},
+		{"other domain", "*.apps.example.com", "tenant.example.com", "", false},
+		{"not a wildcard", "apps.example.com", "tenant.apps.example.com", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subdomain, ok := MatchWildcardHost(tt.pattern, tt.host)
+			if subdomain != tt.wantSubdomain || ok != tt.wantOK {
+				t.Errorf("MatchWildcardHost() = %v, %v, want %v, %v", subdomain, ok, tt.wantSubdomain, tt.wantOK)
+			}
+		})
+	}
+}
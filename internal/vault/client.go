@@ -0,0 +1,178 @@
+// Package vault contains a minimal client for the HashiCorp Vault HTTP API.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// A Client is a minimal Vault API client which can read KV version 2 secrets, issue PKI certificates and
+// renew its token.
+type Client struct {
+	address    *url.URL
+	token      string
+	tokenFile  string
+	httpClient *http.Client
+}
+
+// NewClient creates a new Client for the Vault server at address. If tokenFile is set, the token is read
+// from it on every request so that tokens rotated by a Vault agent are picked up.
+func NewClient(address *url.URL, token, tokenFile string, httpClient *http.Client) *Client {
+	return &Client{
+		address:    address,
+		token:      token,
+		tokenFile:  tokenFile,
+		httpClient: httpClient,
+	}
+}
+
+// A Certificate is a certificate issued by a PKI secrets engine.
+type Certificate struct {
+	// Certificate is the PEM encoded certificate followed by its CA chain.
+	Certificate string
+	// PrivateKey is the PEM encoded private key.
+	PrivateKey string
+	Expiration time.Time
+}
+
+// A TokenInfo describes the client token.
+type TokenInfo struct {
+	TTL       time.Duration
+	Renewable bool
+}
+
+// ReadKV reads the data of a KV version 2 secret at path in the secrets engine mounted at mount.
+func (c *Client) ReadKV(ctx context.Context, mount, secretPath string) (map[string]interface{}, error) {
+	var res struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, path.Join("/v1", mount, "data", secretPath), nil, &res); err != nil {
+		return nil, err
+	}
+	if res.Data.Data == nil {
+		return nil, fmt.Errorf("vault: secret %s/%s not found", mount, secretPath)
+	}
+	return res.Data.Data, nil
+}
+
+// IssueCertificate issues a new certificate from role in the PKI secrets engine mounted at mount.
+func (c *Client) IssueCertificate(ctx context.Context, mount, role, commonName string, altNames []string) (*Certificate, error) {
+	req := map[string]interface{}{
+		"common_name": commonName,
+	}
+	if len(altNames) > 0 {
+		req["alt_names"] = strings.Join(altNames, ",")
+	}
+
+	var res struct {
+		Data struct {
+			Certificate string   `json:"certificate"`
+			CAChain     []string `json:"ca_chain"`
+			PrivateKey  string   `json:"private_key"`
+			Expiration  int64    `json:"expiration"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodPost, path.Join("/v1", mount, "issue", role), req, &res); err != nil {
+		return nil, err
+	}
+
+	chain := append([]string{res.Data.Certificate}, res.Data.CAChain...)
+	return &Certificate{
+		Certificate: strings.Join(chain, "\n"),
+		PrivateKey:  res.Data.PrivateKey,
+		Expiration:  time.Unix(res.Data.Expiration, 0),
+	}, nil
+}
+
+// LookupSelf looks up the client token.
+func (c *Client) LookupSelf(ctx context.Context) (*TokenInfo, error) {
+	var res struct {
+		Data struct {
+			TTL       int64 `json:"ttl"`
+			Renewable bool  `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/auth/token/lookup-self", nil, &res); err != nil {
+		return nil, err
+	}
+	return &TokenInfo{
+		TTL:       time.Duration(res.Data.TTL) * time.Second,
+		Renewable: res.Data.Renewable,
+	}, nil
+}
+
+// RenewSelf renews the client token.
+func (c *Client) RenewSelf(ctx context.Context) (*TokenInfo, error) {
+	var res struct {
+		Auth struct {
+			LeaseDuration int64 `json:"lease_duration"`
+			Renewable     bool  `json:"renewable"`
+		} `json:"auth"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", map[string]interface{}{}, &res); err != nil {
+		return nil, err
+	}
+	return &TokenInfo{
+		TTL:       time.Duration(res.Auth.LeaseDuration) * time.Second,
+		Renewable: res.Auth.Renewable,
+	}, nil
+}
+
+func (c *Client) do(ctx context.Context, method, apiPath string, body, dst interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	u := c.address.ResolveReference(&url.URL{Path: apiPath})
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	token := c.token
+	if c.tokenFile != "" {
+		bs, err := ioutil.ReadFile(c.tokenFile)
+		if err != nil {
+			return fmt.Errorf("vault: error reading token file: %w", err)
+		}
+		token = strings.TrimSpace(string(bs))
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		var errRes struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&errRes)
+		return fmt.Errorf("vault: unexpected status code for %s: %d %s",
+			apiPath, res.StatusCode, strings.Join(errRes.Errors, ", "))
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return fmt.Errorf("vault: error decoding %s: %w", apiPath, err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/hex"
@@ -33,6 +34,9 @@ func loadKey(data []byte, alg jose.SignatureAlgorithm, unmarshal func([]byte) (i
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal key: %w", err)
 	}
+	if err := checkKeyAlgorithm(priv, alg); err != nil {
+		return nil, err
+	}
 
 	key := &jose.JSONWebKey{Key: priv, Use: "sig", Algorithm: string(alg)}
 	thumbprint, err := key.Thumbprint(crypto.SHA256)
@@ -43,6 +47,45 @@ func loadKey(data []byte, alg jose.SignatureAlgorithm, unmarshal func([]byte) (i
 	return key, nil
 }
 
+// checkKeyAlgorithm returns an error if the key can't be used to sign or verify with the algorithm.
+func checkKeyAlgorithm(key interface{}, alg jose.SignatureAlgorithm) error {
+	if cert, ok := key.(*x509.Certificate); ok {
+		key = cert.PublicKey
+	}
+
+	var ok bool
+	switch alg {
+	case jose.ES256, jose.ES384, jose.ES512:
+		curves := map[jose.SignatureAlgorithm]elliptic.Curve{
+			jose.ES256: elliptic.P256(),
+			jose.ES384: elliptic.P384(),
+			jose.ES512: elliptic.P521(),
+		}
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			ok = k.Curve == curves[alg]
+		case *ecdsa.PublicKey:
+			ok = k.Curve == curves[alg]
+		}
+	case jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.PS384, jose.PS512:
+		switch key.(type) {
+		case *rsa.PrivateKey, *rsa.PublicKey:
+			ok = true
+		}
+	case jose.EdDSA:
+		switch key.(type) {
+		case ed25519.PrivateKey, ed25519.PublicKey:
+			ok = true
+		}
+	default:
+		return fmt.Errorf("unsupported signing key algorithm: %s", alg)
+	}
+	if !ok {
+		return fmt.Errorf("%T can't be used with the %s signing key algorithm", key, alg)
+	}
+	return nil
+}
+
 func loadPrivateKey(b []byte) (interface{}, error) {
 	var wrappedErr error
 	var err error
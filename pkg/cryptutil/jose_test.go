@@ -1,8 +1,12 @@
 package cryptutil
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"testing"
 
 	"github.com/go-jose/go-jose/v3"
@@ -118,3 +122,48 @@ func TestPublicJWKFromBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestPrivateJWKFromBytes_Algorithm(t *testing.T) {
+	t.Parallel()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	ecKey, err := NewSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPEM, err := EncodePrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		alg     jose.SignatureAlgorithm
+		wantErr bool
+	}{
+		{"EdDSA", edPEM, jose.EdDSA, false},
+		{"ES256", ecPEM, jose.ES256, false},
+		{"ed25519 with ES256", edPEM, jose.ES256, true},
+		{"P-256 with ES384", ecPEM, jose.ES384, true},
+		{"P-256 with RS256", ecPEM, jose.RS256, true},
+		{"unsupported", ecPEM, jose.HS256, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PrivateJWKFromBytes(tt.data, tt.alg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PrivateJWKFromBytes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
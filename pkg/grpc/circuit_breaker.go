@@ -0,0 +1,104 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+const defaultCircuitBreakerTimeout = 10 * time.Second
+
+var errCircuitBreakerOpen = status.Error(codes.Unavailable, "grpc: circuit breaker is open")
+
+// A circuitBreaker fails unary calls immediately after repeated failures. Since calls wait for the connection
+// to be ready, without it every call to an unavailable service blocks until its deadline.
+//
+// Once the threshold of consecutive failures is reached the breaker opens for the timeout. After that a
+// single call is allowed through: if it succeeds the breaker closes, otherwise it opens again.
+type circuitBreaker struct {
+	threshold int
+	timeout   time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, timeout time.Duration) *circuitBreaker {
+	if timeout <= 0 {
+		timeout = defaultCircuitBreakerTimeout
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		timeout:   timeout,
+		now:       time.Now,
+	}
+}
+
+// UnaryInterceptor is a unary client interceptor which fails calls while the circuit breaker is open.
+func (cb *circuitBreaker) UnaryInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	if !cb.allow() {
+		return errCircuitBreakerOpen
+	}
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if cb.record(err) {
+		log.Warn(ctx).Err(err).
+			Str("method", method).
+			Str("target", cc.Target()).
+			Dur("timeout", cb.timeout).
+			Msg("grpc: circuit breaker opened after repeated failures")
+	}
+	return err
+}
+
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch {
+	case cb.failures < cb.threshold:
+		return true
+	case cb.probing || cb.now().Before(cb.openUntil):
+		return false
+	default:
+		cb.probing = true
+		return true
+	}
+}
+
+// record records the result of a call and returns true if the breaker was opened.
+func (cb *circuitBreaker) record(err error) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+	default:
+		// any other result means the service is reachable
+		cb.failures = 0
+		return false
+	}
+
+	cb.failures++
+	if cb.failures < cb.threshold {
+		return false
+	}
+	cb.openUntil = cb.now().Add(cb.timeout)
+	return true
+}
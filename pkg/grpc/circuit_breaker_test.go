@@ -0,0 +1,54 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb := newCircuitBreaker(3, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	cc, err := grpc.Dial("pomerium:///localhost.example:443", grpc.WithInsecure())
+	require.NoError(t, err)
+	defer func() { _ = cc.Close() }()
+
+	var calls int
+	invoke := func(err error) error {
+		return cb.UnaryInterceptor(context.Background(), "test", nil, nil, cc,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				calls++
+				return err
+			})
+	}
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	assert.Equal(t, unavailable, invoke(unavailable))
+	assert.Equal(t, unavailable, invoke(unavailable))
+	assert.NoError(t, invoke(nil), "success should reset the failure count")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, unavailable, invoke(unavailable))
+	}
+	assert.Equal(t, 6, calls)
+
+	assert.Equal(t, errCircuitBreakerOpen, invoke(nil), "calls should fail while the breaker is open")
+	assert.Equal(t, 6, calls)
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, unavailable, invoke(unavailable), "a call should be allowed after the timeout")
+	assert.Equal(t, errCircuitBreakerOpen, invoke(nil), "a failed call should open the breaker again")
+	assert.Equal(t, 7, calls)
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, codes.NotFound, status.Code(invoke(status.Error(codes.NotFound, "not found"))))
+	assert.NoError(t, invoke(nil), "any other result should close the breaker")
+	assert.Equal(t, 9, calls)
+}
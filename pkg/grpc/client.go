@@ -13,7 +13,9 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/telemetry"
@@ -39,6 +41,14 @@ type Options struct {
 	CA string
 	// CAFile specifies the TLS certificate authority file to use.
 	CAFile string
+	// InternalCA is the PEM encoded certificate of the internal certificate authority, trusted in addition to the
+	// system and custom certificate authorities.
+	InternalCA []byte
+	// ClientCertificate is the certificate presented to the service, if any.
+	ClientCertificate *tls.Certificate `hash:"ignore"`
+	// SPIREAgentSocket is the unix socket of a SPIRE agent. When set, the X.509 SVID fetched from the agent is
+	// presented to the service instead of ClientCertificate.
+	SPIREAgentSocket string
 	// RequestTimeout specifies the timeout for individual RPC calls
 	RequestTimeout time.Duration
 	// ClientDNSRoundRobin enables or disables DNS resolver based load balancing
@@ -54,8 +64,24 @@ type Options struct {
 	// ServiceName specifies the service name for telemetry exposition
 	ServiceName string
 
-	// SignedJWTKey is the JWT key to use for signing a JWT attached to metadata.
+	// SignedJWTKey is the JWT key to use for signing a JWT attached to metadata. The JWT's subject is the
+	// ServiceName.
 	SignedJWTKey []byte
+
+	// PoolSize is the number of connections made to each address. Defaults to 1.
+	PoolSize int
+	// KeepaliveTime is the time after which an idle connection is pinged. Zero disables keepalive pings.
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is how long to wait for a keepalive ping to be acknowledged before closing the connection.
+	KeepaliveTimeout time.Duration
+	// BackoffMaxDelay is the maximum delay between attempts to reconnect. Defaults to the gRPC default of 2 minutes.
+	BackoffMaxDelay time.Duration
+	// CircuitBreakerThreshold is the number of consecutive unavailable errors after which unary calls fail
+	// immediately, rather than waiting for the connection to be ready. Zero disables the circuit breaker.
+	CircuitBreakerThreshold int
+	// CircuitBreakerTimeout is how long unary calls fail once the circuit breaker opens, before a call is
+	// allowed through to check if the service is available again.
+	CircuitBreakerTimeout time.Duration
 }
 
 // NewGRPCClientConn returns a new gRPC pomerium service client connection.
@@ -87,12 +113,16 @@ func NewGRPCClientConn(ctx context.Context, opts *Options, other ...grpc.DialOpt
 		grpcTimeoutInterceptor(opts.RequestTimeout),
 		clientStatsHandler.UnaryInterceptor,
 	}
+	if opts.CircuitBreakerThreshold > 0 {
+		cb := newCircuitBreaker(opts.CircuitBreakerThreshold, opts.CircuitBreakerTimeout)
+		unaryClientInterceptors = append(unaryClientInterceptors, cb.UnaryInterceptor)
+	}
 	streamClientInterceptors := []grpc.StreamClientInterceptor{
 		requestid.StreamClientInterceptor(),
 	}
 	if opts.SignedJWTKey != nil {
-		unaryClientInterceptors = append(unaryClientInterceptors, grpcutil.WithUnarySignedJWT(opts.SignedJWTKey))
-		streamClientInterceptors = append(streamClientInterceptors, grpcutil.WithStreamSignedJWT(opts.SignedJWTKey))
+		unaryClientInterceptors = append(unaryClientInterceptors, grpcutil.WithUnarySignedServiceJWT(opts.SignedJWTKey, opts.ServiceName))
+		streamClientInterceptors = append(streamClientInterceptors, grpcutil.WithStreamSignedServiceJWT(opts.SignedJWTKey, opts.ServiceName))
 	}
 
 	dialOptions := []grpc.DialOption{
@@ -102,6 +132,19 @@ func NewGRPCClientConn(ctx context.Context, opts *Options, other ...grpc.DialOpt
 		grpc.WithStatsHandler(clientStatsHandler.Handler),
 		grpc.WithDefaultServiceConfig(roundRobinServiceConfig),
 		grpc.WithDisableServiceConfig(),
+		grpc.WithResolvers(&pomeriumBuilder{poolSize: opts.PoolSize}),
+	}
+	if opts.KeepaliveTime > 0 {
+		dialOptions = append(dialOptions, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                opts.KeepaliveTime,
+			Timeout:             opts.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	if opts.BackoffMaxDelay > 0 {
+		bc := backoff.DefaultConfig
+		bc.MaxDelay = opts.BackoffMaxDelay
+		dialOptions = append(dialOptions, grpc.WithConnectParams(grpc.ConnectParams{Backoff: bc}))
 	}
 
 	dialOptions = append(dialOptions, other...)
@@ -114,8 +157,17 @@ func NewGRPCClientConn(ctx context.Context, opts *Options, other ...grpc.DialOpt
 		if err != nil {
 			return nil, err
 		}
+		if len(opts.InternalCA) > 0 && !rootCAs.AppendCertsFromPEM(opts.InternalCA) {
+			return nil, errors.New("internal/grpc: invalid internal certificate authority")
+		}
 
-		cert := credentials.NewTLS(&tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12})
+		tlsConfig := &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+		if opts.SPIREAgentSocket != "" {
+			tlsConfig.GetClientCertificate = getSPIRESVIDSource(opts.SPIREAgentSocket).GetClientCertificate
+		} else if opts.ClientCertificate != nil {
+			tlsConfig.Certificates = []tls.Certificate{*opts.ClientCertificate}
+		}
+		cert := credentials.NewTLS(tlsConfig)
 
 		// override allowed certificate name string, typically used when doing behind ingress connection
 		if opts.OverrideCertificateName != "" {
@@ -165,7 +217,7 @@ func GetGRPCClientConn(ctx context.Context, name string, opts *Options) (*grpc.C
 
 	current, ok := grpcClientConns.m[name]
 	if ok {
-		if cmp.Equal(current.opts, opts) {
+		if cmp.Equal(current.opts, opts, cmp.Comparer(equalCertificates)) {
 			return current.conn, nil
 		}
 
@@ -186,3 +238,10 @@ func GetGRPCClientConn(ctx context.Context, name string, opts *Options) (*grpc.C
 	}
 	return cc, nil
 }
+
+func equalCertificates(x, y *tls.Certificate) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return cmp.Equal(x.Certificate, y.Certificate)
+}
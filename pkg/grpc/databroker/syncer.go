@@ -11,6 +11,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/pomerium/pomerium/internal/contextkeys"
+	"github.com/pomerium/pomerium/internal/health"
 	"github.com/pomerium/pomerium/internal/log"
 )
 
@@ -103,6 +104,7 @@ func (syncer *Syncer) Run(ctx context.Context) error {
 		}
 
 		if err != nil {
+			health.ReportError(health.DataBroker, err)
 			log.Error(ctx).Err(err).Msg("sync")
 			select {
 			case <-ctx.Done():
@@ -123,6 +125,7 @@ func (syncer *Syncer) init(ctx context.Context) error {
 		return err
 	}
 	syncer.backoff.Reset()
+	health.ReportOK(health.DataBroker)
 
 	// reset the records as we have to sync latest
 	syncer.handler.ClearRecords(ctx)
@@ -144,6 +147,7 @@ func (syncer *Syncer) sync(ctx context.Context) error {
 		return err
 	}
 
+	health.ReportOK(health.DataBroker)
 	log.Info(ctx).Msg("listening for updates")
 
 	for {
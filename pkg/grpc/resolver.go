@@ -12,12 +12,15 @@ func init() {
 }
 
 type pomeriumBuilder struct {
+	// poolSize is the number of connections made to each address
+	poolSize int
 }
 
-func (*pomeriumBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+func (pb *pomeriumBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
 	endpoints := strings.Split(target.Endpoint, ",")
 	pccd := &pomeriumClientConnData{
-		states: make([]resolver.State, len(endpoints)),
+		states:   make([]resolver.State, len(endpoints)),
+		poolSize: pb.poolSize,
 	}
 	pr := &pomeriumResolver{}
 	for i, endpoint := range endpoints {
@@ -68,8 +71,9 @@ func (pcc *pomeriumClientConn) UpdateState(state resolver.State) error {
 }
 
 type pomeriumClientConnData struct {
-	mu     sync.Mutex
-	states []resolver.State
+	mu       sync.Mutex
+	states   []resolver.State
+	poolSize int
 }
 
 func (pccd *pomeriumClientConnData) updateState(idx int, state resolver.State) resolver.State {
@@ -84,9 +88,30 @@ func (pccd *pomeriumClientConnData) updateState(idx int, state resolver.State) r
 		merged.ServiceConfig = s.ServiceConfig
 		merged.Attributes = s.Attributes
 	}
+	merged.Addresses = pccd.pool(merged.Addresses)
 	return merged
 }
 
+// pool duplicates each address so that the balancer makes multiple connections to it. The balancer treats
+// addresses which only differ by their metadata as distinct.
+func (pccd *pomeriumClientConnData) pool(addrs []resolver.Address) []resolver.Address {
+	if pccd.poolSize <= 1 {
+		return addrs
+	}
+	pooled := make([]resolver.Address, 0, len(addrs)*pccd.poolSize)
+	for _, addr := range addrs {
+		if addr.Metadata != nil {
+			pooled = append(pooled, addr)
+			continue
+		}
+		for i := 0; i < pccd.poolSize; i++ {
+			addr.Metadata = i
+			pooled = append(pooled, addr)
+		}
+	}
+	return pooled
+}
+
 func parseTarget(raw string) resolver.Target {
 	target := resolver.Target{
 		Scheme: resolver.GetDefaultScheme(),
@@ -8,6 +8,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
 	"google.golang.org/grpc/test/grpc_testing"
 )
 
@@ -66,3 +67,18 @@ func TestResolver(t *testing.T) {
 	assert.Greater(t, usernames["srv1"], 0)
 	assert.Greater(t, usernames["srv2"], 0)
 }
+
+func TestResolverPool(t *testing.T) {
+	pccd := &pomeriumClientConnData{
+		states:   make([]resolver.State, 2),
+		poolSize: 2,
+	}
+	pccd.updateState(0, resolver.State{Addresses: []resolver.Address{{Addr: "127.0.0.1:1"}}})
+	merged := pccd.updateState(1, resolver.State{Addresses: []resolver.Address{{Addr: "127.0.0.1:2"}}})
+	assert.Equal(t, []resolver.Address{
+		{Addr: "127.0.0.1:1", Metadata: 0},
+		{Addr: "127.0.0.1:1", Metadata: 1},
+		{Addr: "127.0.0.1:2", Metadata: 0},
+		{Addr: "127.0.0.1:2", Metadata: 1},
+	}, merged.Addresses)
+}
@@ -0,0 +1,124 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	envoy_service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	envoy_service_secret_v3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"google.golang.org/grpc"
+)
+
+const (
+	// spireSVIDSecretName is the default name of the X.509 SVID served by the SPIRE agent's SDS API
+	spireSVIDSecretName = "default"
+	spireFetchTimeout   = 10 * time.Second
+)
+
+var spireSVIDSources = struct {
+	sync.Mutex
+	m map[string]*spireSVIDSource
+}{
+	m: make(map[string]*spireSVIDSource),
+}
+
+// getSPIRESVIDSource returns the shared SVID source for the SPIRE agent listening on the given unix socket.
+func getSPIRESVIDSource(socketPath string) *spireSVIDSource {
+	spireSVIDSources.Lock()
+	defer spireSVIDSources.Unlock()
+
+	src, ok := spireSVIDSources.m[socketPath]
+	if !ok {
+		src = &spireSVIDSource{socketPath: socketPath}
+		spireSVIDSources.m[socketPath] = src
+	}
+	return src
+}
+
+// A spireSVIDSource fetches the X.509 SVID of this workload from a SPIRE agent's SDS API. The SVID is cached
+// and fetched again once half its lifetime has passed, which is when the SPIRE agent rotates it.
+type spireSVIDSource struct {
+	socketPath string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	refreshAt time.Time
+}
+
+// GetClientCertificate returns the current SVID. It implements tls.Config.GetClientCertificate.
+func (src *spireSVIDSource) GetClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	now := time.Now()
+	if src.cert != nil && now.Before(src.refreshAt) {
+		return src.cert, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), spireFetchTimeout)
+	defer cancel()
+
+	cert, err := fetchSPIRESVID(ctx, src.socketPath)
+	if err != nil {
+		// keep using the previous SVID while it's valid
+		if src.cert != nil && now.Before(src.cert.Leaf.NotAfter) {
+			return src.cert, nil
+		}
+		return nil, err
+	}
+
+	src.cert = cert
+	src.refreshAt = cert.Leaf.NotBefore.Add(cert.Leaf.NotAfter.Sub(cert.Leaf.NotBefore) / 2)
+	return src.cert, nil
+}
+
+func fetchSPIRESVID(ctx context.Context, socketPath string) (*tls.Certificate, error) {
+	cc, err := grpc.DialContext(ctx, socketPath,
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", addr)
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("internal/grpc: error connecting to spire agent: %w", err)
+	}
+	defer func() { _ = cc.Close() }()
+
+	res, err := envoy_service_secret_v3.NewSecretDiscoveryServiceClient(cc).FetchSecrets(ctx,
+		&envoy_service_discovery_v3.DiscoveryRequest{
+			ResourceNames: []string{spireSVIDSecretName},
+		})
+	if err != nil {
+		return nil, fmt.Errorf("internal/grpc: error fetching svid from spire agent: %w", err)
+	}
+
+	for _, resource := range res.GetResources() {
+		var secret envoy_extensions_transport_sockets_tls_v3.Secret
+		if err := resource.UnmarshalTo(&secret); err != nil {
+			return nil, fmt.Errorf("internal/grpc: invalid secret from spire agent: %w", err)
+		}
+		if secret.GetName() != spireSVIDSecretName || secret.GetTlsCertificate() == nil {
+			continue
+		}
+
+		cert, err := tls.X509KeyPair(
+			secret.GetTlsCertificate().GetCertificateChain().GetInlineBytes(),
+			secret.GetTlsCertificate().GetPrivateKey().GetInlineBytes())
+		if err != nil {
+			return nil, fmt.Errorf("internal/grpc: invalid svid from spire agent: %w", err)
+		}
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("internal/grpc: invalid svid from spire agent: %w", err)
+		}
+		return &cert, nil
+	}
+
+	return nil, fmt.Errorf("internal/grpc: spire agent did not return the %q svid", spireSVIDSecretName)
+}
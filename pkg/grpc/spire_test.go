@@ -0,0 +1,110 @@
+package grpc
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	envoy_config_core_v3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_extensions_transport_sockets_tls_v3 "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	envoy_service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	envoy_service_secret_v3 "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+)
+
+type mockSDSServer struct {
+	envoy_service_secret_v3.UnimplementedSecretDiscoveryServiceServer
+
+	secret  *envoy_extensions_transport_sockets_tls_v3.Secret
+	fetches int32
+}
+
+func (srv *mockSDSServer) FetchSecrets(
+	_ context.Context,
+	req *envoy_service_discovery_v3.DiscoveryRequest,
+) (*envoy_service_discovery_v3.DiscoveryResponse, error) {
+	atomic.AddInt32(&srv.fetches, 1)
+	res := new(envoy_service_discovery_v3.DiscoveryResponse)
+	for _, name := range req.GetResourceNames() {
+		if name == srv.secret.GetName() {
+			resource, err := anypb.New(srv.secret)
+			if err != nil {
+				return nil, err
+			}
+			res.Resources = append(res.Resources, resource)
+		}
+	}
+	return res, nil
+}
+
+func startMockSDSServer(t *testing.T, secret *envoy_extensions_transport_sockets_tls_v3.Secret) (*mockSDSServer, string) {
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+	li, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	srv := &mockSDSServer{secret: secret}
+	s := grpc.NewServer()
+	envoy_service_secret_v3.RegisterSecretDiscoveryServiceServer(s, srv)
+	go func() { _ = s.Serve(li) }()
+	t.Cleanup(s.Stop)
+
+	return srv, socketPath
+}
+
+func TestSPIRESVIDSource(t *testing.T) {
+	cert, err := cryptutil.GenerateSelfSignedCertificate("workload.example.com")
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(cert.PrivateKey.(*rsa.PrivateKey)),
+	})
+
+	t.Run("svid", func(t *testing.T) {
+		srv, socketPath := startMockSDSServer(t, &envoy_extensions_transport_sockets_tls_v3.Secret{
+			Name: "default",
+			Type: &envoy_extensions_transport_sockets_tls_v3.Secret_TlsCertificate{
+				TlsCertificate: &envoy_extensions_transport_sockets_tls_v3.TlsCertificate{
+					CertificateChain: &envoy_config_core_v3.DataSource{
+						Specifier: &envoy_config_core_v3.DataSource_InlineBytes{InlineBytes: certPEM},
+					},
+					PrivateKey: &envoy_config_core_v3.DataSource{
+						Specifier: &envoy_config_core_v3.DataSource_InlineBytes{InlineBytes: keyPEM},
+					},
+				},
+			},
+		})
+
+		src := &spireSVIDSource{socketPath: socketPath}
+		svid, err := src.GetClientCertificate(nil)
+		require.NoError(t, err)
+		assert.Equal(t, cert.Certificate[0], svid.Certificate[0])
+		assert.Equal(t, []string{"workload.example.com"}, svid.Leaf.DNSNames)
+
+		_, err = src.GetClientCertificate(nil)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&srv.fetches), "should cache the svid")
+	})
+	t.Run("missing svid", func(t *testing.T) {
+		_, socketPath := startMockSDSServer(t, &envoy_extensions_transport_sockets_tls_v3.Secret{
+			Name: "ROOTCA",
+		})
+
+		src := &spireSVIDSource{socketPath: socketPath}
+		_, err := src.GetClientCertificate(nil)
+		assert.Error(t, err)
+	})
+	t.Run("shared", func(t *testing.T) {
+		assert.Same(t, getSPIRESVIDSource("/tmp/agent.sock"), getSPIRESVIDSource("/tmp/agent.sock"))
+	})
+}
@@ -48,6 +48,26 @@ func Put(ctx context.Context, client databroker.DataBrokerServiceClient, u *User
 	return res.GetRecord(), nil
 }
 
+// GetServiceAccount gets a service account from the databroker.
+func GetServiceAccount(ctx context.Context, client databroker.DataBrokerServiceClient, serviceAccountID string) (*ServiceAccount, error) {
+	any, _ := anypb.New(new(ServiceAccount))
+
+	res, err := client.Get(ctx, &databroker.GetRequest{
+		Type: any.GetTypeUrl(),
+		Id:   serviceAccountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sa ServiceAccount
+	err = res.GetRecord().GetData().UnmarshalTo(&sa)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling service account from databroker: %w", err)
+	}
+	return &sa, nil
+}
+
 // PutServiceAccount sets a service account in the databroker.
 func PutServiceAccount(ctx context.Context, client databroker.DataBrokerServiceClient, sa *ServiceAccount) (*databroker.Record, error) {
 	any, _ := anypb.New(sa)
@@ -12,8 +12,18 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// signedJWTLifetime is how long the JWTs attached to requests are valid for. A new JWT is signed for every
+// request, so it only needs to outlast clock skew between services.
+const signedJWTLifetime = 5 * time.Minute
+
 // WithStreamSignedJWT returns a StreamClientInterceptor that adds a JWT to requests.
 func WithStreamSignedJWT(key []byte) grpc.StreamClientInterceptor {
+	return WithStreamSignedServiceJWT(key, "")
+}
+
+// WithStreamSignedServiceJWT returns a StreamClientInterceptor that adds a JWT to requests, whose subject
+// is the name of the calling service.
+func WithStreamSignedServiceJWT(key []byte, service string) grpc.StreamClientInterceptor {
 	return func(
 		ctx context.Context,
 		desc *grpc.StreamDesc,
@@ -21,7 +31,7 @@ func WithStreamSignedJWT(key []byte) grpc.StreamClientInterceptor {
 		method string, streamer grpc.Streamer,
 		opts ...grpc.CallOption,
 	) (grpc.ClientStream, error) {
-		ctx, err := withSignedJWT(ctx, key)
+		ctx, err := withSignedJWT(ctx, key, service)
 		if err != nil {
 			return nil, err
 		}
@@ -32,8 +42,14 @@ func WithStreamSignedJWT(key []byte) grpc.StreamClientInterceptor {
 
 // WithUnarySignedJWT returns a UnaryClientInterceptor that adds a JWT to requests.
 func WithUnarySignedJWT(key []byte) grpc.UnaryClientInterceptor {
+	return WithUnarySignedServiceJWT(key, "")
+}
+
+// WithUnarySignedServiceJWT returns a UnaryClientInterceptor that adds a JWT to requests, whose subject
+// is the name of the calling service.
+func WithUnarySignedServiceJWT(key []byte, service string) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		ctx, err := withSignedJWT(ctx, key)
+		ctx, err := withSignedJWT(ctx, key, service)
 		if err != nil {
 			return err
 		}
@@ -42,7 +58,7 @@ func WithUnarySignedJWT(key []byte) grpc.UnaryClientInterceptor {
 	}
 }
 
-func withSignedJWT(ctx context.Context, key []byte) (context.Context, error) {
+func withSignedJWT(ctx context.Context, key []byte, service string) (context.Context, error) {
 	if len(key) > 0 {
 		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: key},
 			(&jose.SignerOptions{}).WithType("JWT"))
@@ -50,8 +66,11 @@ func withSignedJWT(ctx context.Context, key []byte) (context.Context, error) {
 			return ctx, err
 		}
 
+		now := time.Now()
 		rawjwt, err := jwt.Signed(sig).Claims(jwt.Claims{
-			Expiry: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			Subject:  service,
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(signedJWTLifetime)),
 		}).CompactSerialize()
 		if err != nil {
 			return ctx, err
@@ -86,28 +105,38 @@ func StreamRequireSignedJWT(key string) grpc.StreamServerInterceptor {
 
 // RequireSignedJWT requires a JWT in the gRPC metadata and that it be signed by the given key.
 func RequireSignedJWT(ctx context.Context, key []byte) error {
-	if len(key) > 0 {
-		rawjwt, ok := JWTFromGRPCRequest(ctx)
-		if !ok {
-			return status.Error(codes.Unauthenticated, "unauthenticated")
-		}
+	_, err := GetSignedJWTSubject(ctx, key)
+	return err
+}
 
-		tok, err := jwt.ParseSigned(rawjwt)
-		if err != nil {
-			return status.Errorf(codes.Unauthenticated, "invalid JWT: %v", err)
-		}
+// GetSignedJWTSubject requires a JWT in the gRPC metadata signed by the given key, and returns its subject,
+// the name of the calling service. The subject is empty for clients which don't set it.
+func GetSignedJWTSubject(ctx context.Context, key []byte) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
 
-		var claims struct {
-			Expiry *jwt.NumericDate `json:"exp,omitempty"`
-		}
-		err = tok.Claims(key, &claims)
-		if err != nil {
-			return status.Errorf(codes.Unauthenticated, "invalid JWT: %v", err)
-		}
+	rawjwt, ok := JWTFromGRPCRequest(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "unauthenticated")
+	}
 
-		if claims.Expiry == nil || time.Now().After(claims.Expiry.Time()) {
-			return status.Errorf(codes.Unauthenticated, "expired JWT: %v", err)
-		}
+	tok, err := jwt.ParseSigned(rawjwt)
+	if err != nil {
+		return "", status.Errorf(codes.Unauthenticated, "invalid JWT: %v", err)
+	}
+
+	var claims struct {
+		Subject string           `json:"sub,omitempty"`
+		Expiry  *jwt.NumericDate `json:"exp,omitempty"`
+	}
+	err = tok.Claims(key, &claims)
+	if err != nil {
+		return "", status.Errorf(codes.Unauthenticated, "invalid JWT: %v", err)
+	}
+
+	if claims.Expiry == nil || time.Now().After(claims.Expiry.Time()) {
+		return "", status.Error(codes.Unauthenticated, "expired JWT")
 	}
-	return nil
+	return claims.Subject, nil
 }
@@ -10,8 +10,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/status"
@@ -100,3 +102,24 @@ func TestSignedJWT(t *testing.T) {
 		assert.Equal(t, codes.OK, status.Code(err))
 	})
 }
+
+func TestGetSignedJWTSubject(t *testing.T) {
+	key := cryptutil.NewKey()
+
+	incoming := func(ctx context.Context) context.Context {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		return metadata.NewIncomingContext(context.Background(), md)
+	}
+
+	ctx, err := withSignedJWT(context.Background(), key, "proxy")
+	require.NoError(t, err)
+	subject, err := GetSignedJWTSubject(incoming(ctx), key)
+	assert.NoError(t, err)
+	assert.Equal(t, "proxy", subject)
+
+	_, err = GetSignedJWTSubject(incoming(ctx), cryptutil.NewKey())
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = GetSignedJWTSubject(context.Background(), key)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
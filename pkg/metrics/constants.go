@@ -13,6 +13,10 @@ const (
 	ConfigLastReloadSuccess = "config_last_reload_success"
 	// IdentityManagerLastRefreshTimestamp is IdP sync timestamp
 	IdentityManagerLastRefreshTimestamp = "identity_manager_last_refresh_timestamp"
+	// IdentityManagerIdPOutage is set to 1 while the identity manager can't reach the IdP
+	IdentityManagerIdPOutage = "identity_manager_idp_outage"
+	// IdentityManagerIdPOutageSessionExtensionsTotal is the number of sessions extended during IdP outages
+	IdentityManagerIdPOutageSessionExtensionsTotal = "identity_manager_idp_outage_session_extensions_total"
 	// BuildInfo is a gauge that may be used to detect whether component is live, and also has version
 	BuildInfo = "build_info"
 	// PolicyCountTotal is total amount of routes currently configured
@@ -27,6 +31,17 @@ const (
 	ConfigDBErrors = "config_db_errors"
 	// ConfigDBErrorsHelp is the help text for ConfigDBErrors.
 	ConfigDBErrorsHelp = "amount of errors observed while applying databroker config; -1 if validation failed and was rejected altogether"
+	// AuthorizeCheckDurationMilliseconds is the duration of authorize checks, with trace ids attached as exemplars
+	AuthorizeCheckDurationMilliseconds = "authorize_check_duration_ms"
+	// AuthorizeEvaluatorDurationMilliseconds is the duration of policy evaluations authorize_evaluator_duration_ms{route_id="route_id"}
+	AuthorizeEvaluatorDurationMilliseconds = "authorize_evaluator_duration_ms"
+	// AuthorizeDecisionsTotal is the number of authorize decisions authorize_decisions_total{route_id="route_id",decision="allow",reason="reason"}
+	AuthorizeDecisionsTotal = "authorize_decisions_total"
+	// AuthorizeRecordCacheLookupsTotal is the number of lookups of databroker records in the authorize service's local copy
+	// authorize_record_cache_lookups_total{record_type="session",result="hit"}
+	AuthorizeRecordCacheLookupsTotal = "authorize_record_cache_lookups_total"
+	// DeprecatedFeatureUsageTotal is the number of times a deprecated option or flow was used deprecated_feature_usage_total{feature="feature"}
+	DeprecatedFeatureUsageTotal = "deprecated_feature_usage_total"
 )
 
 // labels
@@ -41,3 +56,8 @@ const (
 	GoVersionLabel      = "goversion"
 	HostLabel           = "host"
 )
+
+// exemplar labels
+const (
+	TraceIDExemplarLabel = "trace_id"
+)
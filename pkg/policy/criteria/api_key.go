@@ -0,0 +1,40 @@
+package criteria
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var apiKeyBody = ast.Body{
+	ast.MustParseExpr(`input.api_key.id != null`),
+	ast.MustParseExpr(`input.api_key.id != ""`),
+}
+
+type apiKeyCriterion struct {
+	g *Generator
+}
+
+func (apiKeyCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnused
+}
+
+func (apiKeyCriterion) Names() []string {
+	return []string{"api_key"}
+}
+
+func (c apiKeyCriterion) GenerateRule(_ string, _ parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	rule := c.g.NewRule("api_key")
+	rule.Body = apiKeyBody
+	return rule, nil, nil
+}
+
+// APIKey returns a Criterion which returns true if the request has an API key which is valid for the route.
+func APIKey(generator *Generator) Criterion {
+	return apiKeyCriterion{g: generator}
+}
+
+func init() {
+	Register(APIKey)
+}
@@ -0,0 +1,30 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKey(t *testing.T) {
+	t.Run("no api key", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - api_key: 1
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, false, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+	t.Run("api key", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - api_key: 1
+`, []dataBrokerRecord{}, Input{APIKey: &InputAPIKey{ID: "API_KEY_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, true, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+}
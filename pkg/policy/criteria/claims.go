@@ -27,9 +27,6 @@ var claimsBody = ast.Body{
 	ast.MustParseExpr(`
 		values := object_get(all_claims, rule_path, [])
 	`),
-	ast.MustParseExpr(`
-		rule_data == values[_]
-	`),
 }
 
 type claimsCriterion struct {
@@ -46,11 +43,29 @@ func (claimsCriterion) Names() []string {
 
 func (c claimsCriterion) GenerateRule(subPath string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
 	r := c.g.NewRule("claims")
-	r.Body = append(r.Body,
-		ast.Assign.Expr(ast.VarTerm("rule_data"), ast.NewTerm(data.RegoValue())),
-		ast.Assign.Expr(ast.VarTerm("rule_path"), ast.NewTerm(ast.MustInterfaceToValue(subPath))),
-	)
-	r.Body = append(r.Body, claimsBody...)
+
+	// objects are string matchers (e.g. `starts_with`), other values must equal one of the claim's values
+	if obj, ok := data.(parser.Object); ok {
+		r.Body = append(r.Body,
+			ast.Assign.Expr(ast.VarTerm("rule_path"), ast.NewTerm(ast.MustInterfaceToValue(subPath))),
+		)
+		r.Body = append(r.Body, claimsBody...)
+		r.Body = append(r.Body,
+			ast.MustParseExpr(`value := values[_]`),
+			ast.MustParseExpr(`is_string(value)`),
+		)
+		err := matchString(&r.Body, ast.VarTerm("value"), obj)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		r.Body = append(r.Body,
+			ast.Assign.Expr(ast.VarTerm("rule_data"), ast.NewTerm(data.RegoValue())),
+			ast.Assign.Expr(ast.VarTerm("rule_path"), ast.NewTerm(ast.MustInterfaceToValue(subPath))),
+		)
+		r.Body = append(r.Body, claimsBody...)
+		r.Body = append(r.Body, ast.MustParseExpr(`rule_data == values[_]`))
+	}
 
 	return r, []*ast.Rule{
 		rules.GetSession(),
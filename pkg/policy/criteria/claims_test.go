@@ -69,4 +69,64 @@ allow:
 		require.Equal(t, true, res["allow"])
 		require.Equal(t, false, res["deny"])
 	})
+	t.Run("by list claim", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - claim/groups: engineering
+`,
+			[]dataBrokerRecord{
+				&session.Session{
+					Id:     "SESSION_ID",
+					UserId: "USER_ID",
+					Claims: map[string]*structpb.ListValue{
+						"groups": {Values: []*structpb.Value{
+							structpb.NewStringValue("admins"),
+							structpb.NewStringValue("engineering"),
+						}},
+					},
+				},
+			},
+			Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, true, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+	t.Run("by prefix", func(t *testing.T) {
+		for _, tc := range []struct {
+			department string
+			expect     bool
+		}{
+			{"eng-platform", true},
+			{"sales", false},
+		} {
+			res, err := evaluate(t, `
+allow:
+  and:
+    - claim/department:
+        starts_with: eng-
+`,
+				[]dataBrokerRecord{
+					&session.Session{
+						Id:     "SESSION_ID",
+						UserId: "USER_ID",
+						Claims: map[string]*structpb.ListValue{
+							"department": {Values: []*structpb.Value{structpb.NewStringValue(tc.department)}},
+						},
+					},
+				},
+				Input{Session: InputSession{ID: "SESSION_ID"}})
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, res["allow"], tc.department)
+		}
+	})
+	t.Run("unknown string matcher", func(t *testing.T) {
+		_, err := evaluate(t, `
+allow:
+  and:
+    - claim/department:
+        prefix: eng-
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.Error(t, err)
+	})
 }
@@ -0,0 +1,47 @@
+package criteria
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var clientIDsBody = ast.Body{
+	ast.MustParseExpr(`
+		client_id := input.client_credentials.client_id
+	`),
+}
+
+type clientIDsCriterion struct {
+	g *Generator
+}
+
+func (clientIDsCriterion) DataType() generator.CriterionDataType {
+	return CriterionDataTypeStringMatcher
+}
+
+func (clientIDsCriterion) Names() []string {
+	return []string{"client_id", "client_ids"}
+}
+
+func (c clientIDsCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	r := c.g.NewRule("client_ids")
+	r.Body = append(r.Body, clientIDsBody...)
+
+	err := matchString(&r.Body, ast.VarTerm("client_id"), data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r, nil, nil
+}
+
+// ClientIDs returns a Criterion on the client id of a client credentials token.
+func ClientIDs(generator *Generator) Criterion {
+	return clientIDsCriterion{g: generator}
+}
+
+func init() {
+	Register(ClientIDs)
+}
@@ -0,0 +1,43 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIDs(t *testing.T) {
+	t.Run("no client credentials", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - client_id:
+        is: CLIENT_ID
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, false, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+	t.Run("allowed", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - client_id:
+        is: CLIENT_ID
+`, []dataBrokerRecord{}, Input{ClientCredentials: &InputClientCredentials{ClientID: "CLIENT_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, true, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+	t.Run("denied", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - client_id:
+        is: CLIENT_ID
+`, []dataBrokerRecord{}, Input{ClientCredentials: &InputClientCredentials{ClientID: "OTHER_CLIENT_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, false, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+}
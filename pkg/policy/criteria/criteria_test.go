@@ -24,16 +24,30 @@ var testingNow = time.Date(2021, 5, 11, 13, 43, 0, 0, time.Local)
 
 type (
 	Input struct {
-		HTTP    InputHTTP    `json:"http"`
-		Session InputSession `json:"session"`
+		HTTP              InputHTTP               `json:"http"`
+		Session           InputSession            `json:"session"`
+		ClientCredentials *InputClientCredentials `json:"client_credentials,omitempty"`
+		APIKey            *InputAPIKey            `json:"api_key,omitempty"`
+		Device            *InputDevice            `json:"device,omitempty"`
 	}
 	InputHTTP struct {
 		Method  string              `json:"method"`
 		Headers map[string][]string `json:"headers"`
+		IP      string              `json:"ip"`
 	}
 	InputSession struct {
 		ID string `json:"id"`
 	}
+	InputAPIKey struct {
+		ID string `json:"id"`
+	}
+	InputDevice struct {
+		ID string `json:"id"`
+	}
+	InputClientCredentials struct {
+		ClientID string   `json:"client_id"`
+		Scopes   []string `json:"scopes"`
+	}
 )
 
 func generateRegoFromYAML(raw string) (string, error) {
@@ -0,0 +1,50 @@
+package criteria
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var deviceBody = ast.Body{
+	ast.MustParseExpr(`device_id := input.device.id`),
+	ast.MustParseExpr(`device_id != null`),
+	ast.MustParseExpr(`device_id != ""`),
+}
+
+type deviceCriterion struct {
+	g *Generator
+}
+
+func (deviceCriterion) DataType() CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (deviceCriterion) Names() []string {
+	return []string{"device"}
+}
+
+func (c deviceCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	r := c.g.NewRule("device")
+	r.Body = append(r.Body, deviceBody...)
+
+	// objects are string matchers on the device id, other values match any enrolled device
+	if obj, ok := data.(parser.Object); ok {
+		err := matchString(&r.Body, ast.VarTerm("device_id"), obj)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return r, nil, nil
+}
+
+// Device returns a Criterion which returns true if the request's session was verified with an enrolled device.
+func Device(generator *Generator) Criterion {
+	return deviceCriterion{g: generator}
+}
+
+func init() {
+	Register(Device)
+}
@@ -0,0 +1,52 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevice(t *testing.T) {
+	t.Run("no device", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - device: true
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, false, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+	t.Run("any device", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - device: true
+`, []dataBrokerRecord{}, Input{Device: &InputDevice{ID: "DEVICE_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, true, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+	t.Run("device id", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - device:
+        is: DEVICE_ID
+`, []dataBrokerRecord{}, Input{Device: &InputDevice{ID: "DEVICE_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, true, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+	t.Run("other device id", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - device:
+        is: DEVICE_ID
+`, []dataBrokerRecord{}, Input{Device: &InputDevice{ID: "OTHER_DEVICE_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, false, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+}
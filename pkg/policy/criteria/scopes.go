@@ -0,0 +1,47 @@
+package criteria
+
+import (
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+var scopesBody = ast.Body{
+	ast.MustParseExpr(`
+		scopes := input.client_credentials.scopes
+	`),
+}
+
+type scopesCriterion struct {
+	g *Generator
+}
+
+func (scopesCriterion) DataType() generator.CriterionDataType {
+	return CriterionDataTypeStringListMatcher
+}
+
+func (scopesCriterion) Names() []string {
+	return []string{"scope", "scopes"}
+}
+
+func (c scopesCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	r := c.g.NewRule("scopes")
+	r.Body = append(r.Body, scopesBody...)
+
+	err := matchStringList(&r.Body, ast.VarTerm("scopes"), data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r, nil, nil
+}
+
+// Scopes returns a Criterion on the scopes of a client credentials token.
+func Scopes(generator *Generator) Criterion {
+	return scopesCriterion{g: generator}
+}
+
+func init() {
+	Register(Scopes)
+}
@@ -0,0 +1,43 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopes(t *testing.T) {
+	t.Run("no client credentials", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - scope:
+        has: read
+`, []dataBrokerRecord{}, Input{Session: InputSession{ID: "SESSION_ID"}})
+		require.NoError(t, err)
+		require.Equal(t, false, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+	t.Run("has scope", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - scope:
+        has: read
+`, []dataBrokerRecord{}, Input{ClientCredentials: &InputClientCredentials{ClientID: "CLIENT_ID", Scopes: []string{"read", "write"}}})
+		require.NoError(t, err)
+		require.Equal(t, true, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+	t.Run("missing scope", func(t *testing.T) {
+		res, err := evaluate(t, `
+allow:
+  and:
+    - scope:
+        has: admin
+`, []dataBrokerRecord{}, Input{ClientCredentials: &InputClientCredentials{ClientID: "CLIENT_ID", Scopes: []string{"read", "write"}}})
+		require.NoError(t, err)
+		require.Equal(t, false, res["allow"])
+		require.Equal(t, false, res["deny"])
+	})
+}
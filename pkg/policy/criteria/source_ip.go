@@ -0,0 +1,85 @@
+package criteria
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+
+	"github.com/pomerium/pomerium/pkg/policy/generator"
+	"github.com/pomerium/pomerium/pkg/policy/parser"
+)
+
+type sourceIPCriterion struct {
+	g *Generator
+}
+
+func (sourceIPCriterion) DataType() generator.CriterionDataType {
+	return generator.CriterionDataTypeUnknown
+}
+
+func (sourceIPCriterion) Names() []string {
+	return []string{"source_ip", "source_ips"}
+}
+
+func (c sourceIPCriterion) GenerateRule(_ string, data parser.Value) (*ast.Rule, []*ast.Rule, error) {
+	var values []parser.Value
+	switch v := data.(type) {
+	case parser.String:
+		values = []parser.Value{v}
+	case parser.Array:
+		values = v
+	default:
+		return nil, nil, fmt.Errorf("expected string or array of strings for source_ip, got: %T", data)
+	}
+
+	var cidrs []*ast.Term
+	for _, v := range values {
+		s, ok := v.(parser.String)
+		if !ok {
+			return nil, nil, fmt.Errorf("expected string for source_ip, got: %T", v)
+		}
+		cidr, err := parseSourceIPCIDR(string(s))
+		if err != nil {
+			return nil, nil, err
+		}
+		cidrs = append(cidrs, ast.StringTerm(cidr))
+	}
+
+	r := c.g.NewRule("source_ip")
+	r.Body = append(r.Body,
+		ast.Assign.Expr(ast.VarTerm("cidrs"), ast.ArrayTerm(cidrs...)),
+		ast.MustParseExpr(`net.cidr_contains(cidrs[_], input.http.ip)`),
+	)
+	return r, nil, nil
+}
+
+// parseSourceIPCIDR parses a CIDR, or an IP address as a CIDR containing only that address.
+func parseSourceIPCIDR(raw string) (string, error) {
+	if strings.Contains(raw, "/") {
+		_, ipNet, err := net.ParseCIDR(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid source_ip: %w", err)
+		}
+		return ipNet.String(), nil
+	}
+
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return "", fmt.Errorf("invalid source_ip: %s", raw)
+	}
+	if ip.To4() != nil {
+		return ip.String() + "/32", nil
+	}
+	return ip.String() + "/128", nil
+}
+
+// SourceIP returns a Criterion on the IP address of the client, which matches any of a list of CIDRs.
+func SourceIP(generator *Generator) Criterion {
+	return sourceIPCriterion{g: generator}
+}
+
+func init() {
+	Register(SourceIP)
+}
@@ -0,0 +1,42 @@
+package criteria
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceIP(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy string
+		ip     string
+		expect bool
+	}{
+		{"cidr", `source_ip: 10.0.0.0/8`, "10.1.2.3", true},
+		{"outside cidr", `source_ip: 10.0.0.0/8`, "192.168.1.1", false},
+		{"list", `source_ip: [192.168.0.0/16, 10.0.0.0/8]`, "10.1.2.3", true},
+		{"address", `source_ip: 192.168.1.1`, "192.168.1.1", true},
+		{"ipv6", `source_ip: "2001:db8::/32"`, "2001:db8::1", true},
+		{"no ip", `source_ip: 10.0.0.0/8`, "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := evaluate(t, `
+allow:
+  and:
+    - `+tc.policy+`
+`, []dataBrokerRecord{}, Input{HTTP: InputHTTP{IP: tc.ip}})
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, res["allow"])
+			require.Equal(t, false, res["deny"])
+		})
+	}
+	t.Run("invalid", func(t *testing.T) {
+		_, err := evaluate(t, `
+allow:
+  and:
+    - source_ip: 10.0.0.0/33
+`, []dataBrokerRecord{}, Input{})
+		require.Error(t, err)
+	})
+}
@@ -87,6 +87,15 @@ func (g *Generator) generateNorRule(dst *ast.RuleSet, policyCriteria []parser.Cr
 func (g *Generator) generateCriterionRules(dst *ast.RuleSet, policyCriteria []parser.Criterion) ([]*ast.Term, error) {
 	var terms []*ast.Term
 	for _, policyCriterion := range policyCriteria {
+		if parser.IsLogicalOperator(policyCriterion.Name) && policyCriterion.SubPath == "" {
+			subRule, err := g.generateNestedRule(dst, policyCriterion)
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, ast.VarTerm(string(subRule.Head.Name)))
+			continue
+		}
+
 		criterion, ok := g.criteria[policyCriterion.Name]
 		if !ok {
 			return nil, fmt.Errorf("unknown policy criterion: %s", policyCriterion.Name)
@@ -103,6 +112,28 @@ func (g *Generator) generateCriterionRules(dst *ast.RuleSet, policyCriteria []pa
 	return terms, nil
 }
 
+// generateNestedRule generates the rule for a nested "and", "or", "not" or "nor" criterion.
+func (g *Generator) generateNestedRule(dst *ast.RuleSet, policyCriterion parser.Criterion) (*ast.Rule, error) {
+	nestedCriteria, err := parser.CriteriaFromValue(policyCriterion.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid criteria in \"%s\": %w", policyCriterion.Name, err)
+	}
+	if len(nestedCriteria) == 0 {
+		return nil, fmt.Errorf("nested \"%s\" requires at least one criterion", policyCriterion.Name)
+	}
+
+	switch policyCriterion.Name {
+	case "and":
+		return g.generateAndRule(dst, nestedCriteria)
+	case "or":
+		return g.generateOrRule(dst, nestedCriteria)
+	case "not":
+		return g.generateNotRule(dst, nestedCriteria)
+	default:
+		return g.generateNorRule(dst, nestedCriteria)
+	}
+}
+
 func (g *Generator) fillViaAnd(rule *ast.Rule, terms []*ast.Term) {
 	currentRule := rule
 	currentRule.Head.Value = ast.VarTerm("v1")
@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/open-policy-agent/opa/ast"
@@ -199,3 +200,82 @@ deny = v1 {
 }
 `, string(format.MustAst(mod)))
 }
+
+func TestNested(t *testing.T) {
+	g := New(WithCriterion(func(g *Generator) Criterion {
+		return NewCriterionFunc(CriterionDataTypeUnused, []string{"accept"}, func(subPath string, data parser.Value) (rule *ast.Rule, additionalRules []*ast.Rule, err error) {
+			rule = g.NewRule("accept")
+			rule.Body = append(rule.Body, ast.MustParseExpr("1 == 1"))
+			return rule, nil, nil
+		})
+	}))
+
+	t.Run("nested", func(t *testing.T) {
+		p, err := parser.ParseYAML(strings.NewReader(`
+allow:
+  and:
+    - accept: true
+    - or:
+      - accept: true
+      - not:
+        - accept: true
+`))
+		require.NoError(t, err)
+
+		mod, err := g.Generate(p)
+		require.NoError(t, err)
+		assert.Equal(t, `package pomerium.policy
+
+default allow = false
+
+default deny = false
+
+accept_0 {
+	1 == 1
+}
+
+accept_1 {
+	1 == 1
+}
+
+accept_2 {
+	1 == 1
+}
+
+not_0 = v {
+	v := count({1 | not accept_2}) == 1
+}
+
+or_0 = v1 {
+	v1 := accept_1
+	v1
+}
+
+else = v2 {
+	v2 := not_0
+	v2
+}
+
+and_0 = v1 {
+	v1 := accept_0
+	v1
+	v2 := or_0
+	v2
+}
+
+allow = v1 {
+	v1 := and_0
+	v1
+}
+`, string(format.MustAst(mod)))
+	})
+	t.Run("empty", func(t *testing.T) {
+		_, err := g.Generate(&parser.Policy{
+			Rules: []parser.Rule{{
+				Action: parser.ActionAllow,
+				And:    []parser.Criterion{{Name: "or", Data: parser.Array{}}},
+			}},
+		})
+		assert.Error(t, err)
+	})
+}
@@ -235,10 +235,12 @@ func CriteriaFromArray(a Array) ([]Criterion, error) {
 
 // CriterionFromObject converts an Object into a Criterion.
 //
-// One form is supported:
+// Two forms are supported:
 //
 // 1. An object where the keys are the names with a sub path and the values are the corresponding
 //    data for each Criterion: `{ "groups": "group1" }`
+// 2. An object with a single "and", "or", "not" or "nor" key whose value is nested criteria:
+//    `{ "or": [ {"groups": "group1"}, {"groups": "group2"} ] }`
 //
 func CriterionFromObject(o Object) (*Criterion, error) {
 	if len(o) != 1 {
@@ -251,6 +253,15 @@ func CriterionFromObject(o Object) (*Criterion, error) {
 		if idx := strings.Index(k, "/"); idx >= 0 {
 			name, subPath = k[:idx], k[idx+1:]
 		}
+		if IsLogicalOperator(name) && subPath == "" {
+			criteria, err := CriteriaFromValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid criteria in \"%s\": %w", name, err)
+			}
+			if len(criteria) == 0 {
+				return nil, fmt.Errorf("nested \"%s\" requires at least one criterion", name)
+			}
+		}
 		return &Criterion{
 			Name:    name,
 			SubPath: subPath,
@@ -262,6 +273,16 @@ func CriterionFromObject(o Object) (*Criterion, error) {
 	panic("each criteria may only contain a single key and value")
 }
 
+// IsLogicalOperator returns true if the name is one of the logical operators: "and", "or", "not" or "nor".
+// Criteria with these names contain nested criteria.
+func IsLogicalOperator(name string) bool {
+	switch name {
+	case "and", "or", "not", "nor":
+		return true
+	}
+	return false
+}
+
 // MarshalJSON marshals the criterion as JSON.
 func (c *Criterion) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.ToJSON())
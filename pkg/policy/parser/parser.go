@@ -9,16 +9,19 @@
 //
 // An action is either "allow" or "deny".
 //
-// The logical operators are "and", "or" and "not" and contain zero or more criteria.
+// The logical operators are "and", "or", "not" and "nor" and contain zero or more criteria.
 //
-// A criterion has a name and arbitrary JSON data.
+// A criterion has a name and arbitrary JSON data, or is a nested logical operator containing one or more
+// criteria.
 //
 // An example policy:
 //
 //    allow:
 //      and:
 //      - domain: example.com
-//      - group: admin
+//      - or:
+//        - group: admin
+//        - group: support
 //    deny:
 //      or:
 //      - user: user1@example.com
@@ -130,6 +130,51 @@ func TestParseJSON(t *testing.T) {
 		assert.Error(t, err)
 		assert.Nil(t, p)
 	})
+	t.Run("nested criteria", func(t *testing.T) {
+		p, err := ParseJSON(strings.NewReader(`{
+		  "allow": {
+		    "and": [
+		      { "criterion1": 1 },
+		      { "or": [ { "criterion2": 2 }, { "not": [ { "criterion3": 3 } ] } ] }
+		    ]
+		  }
+		}`))
+		assert.NoError(t, err)
+		assert.Equal(t, &Policy{
+			Rules: []Rule{{
+				Action: ActionAllow,
+				And: []Criterion{
+					{Name: "criterion1", Data: Number("1")},
+					{Name: "or", Data: Array{
+						Object{"criterion2": Number("2")},
+						Object{"not": Array{Object{"criterion3": Number("3")}}},
+					}},
+				},
+			}},
+		}, p)
+	})
+	t.Run("invalid nested criteria", func(t *testing.T) {
+		p, err := ParseJSON(strings.NewReader(`{
+		  "allow": {
+		    "and": [
+		      { "or": [ { "not": [ 1 ] } ] }
+		    ]
+		  }
+		}`))
+		assert.Error(t, err)
+		assert.Nil(t, p)
+	})
+	t.Run("empty nested criteria", func(t *testing.T) {
+		p, err := ParseJSON(strings.NewReader(`{
+		  "allow": {
+		    "and": [
+		      { "or": [] }
+		    ]
+		  }
+		}`))
+		assert.Error(t, err)
+		assert.Nil(t, p)
+	})
 }
 
 func TestParseYAML(t *testing.T) {
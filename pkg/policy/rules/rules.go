@@ -73,7 +73,8 @@ get_directory_group(id) = v {
 `)
 }
 
-// GetGroupIDs returns the group ids for the given session or directory user.
+// GetGroupIDs returns the group ids for the given session or directory user. Without a directory user, the
+// groups in the session's groups claim are used, if one is configured.
 func GetGroupIDs() *ast.Rule {
 	return ast.MustParseRule(`
 get_group_ids(session, directory_user) = v {
@@ -82,6 +83,10 @@ get_group_ids(session, directory_user) = v {
 } else = v {
 	v = directory_user.group_ids
 	v != null
+} else = v {
+	data.groups_claim != ""
+	v = session.claims[data.groups_claim]
+	v != null
 } else = [] {
 	true
 }
@@ -0,0 +1,65 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a grpc.UnaryServerInterceptor which verifies the attestation JWT of
+// each call. The verified claims are added to the context passed to the handler.
+func (v *Verifier) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := v.verifyGRPC(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a grpc.StreamServerInterceptor which verifies the attestation JWT
+// of each stream. The verified claims are added to the stream's context.
+func (v *Verifier) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := v.verifyGRPC(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (v *Verifier) verifyGRPC(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var rawJWT, authority string
+	if vals := md.Get(HeaderJWTAssertion); len(vals) > 0 {
+		rawJWT = vals[0]
+	}
+	if vals := md.Get(":authority"); len(vals) > 0 {
+		authority = vals[0]
+	}
+
+	claims, err := v.Verify(ctx, rawJWT, authority)
+	if err != nil {
+		if httpStatusCode(err) == http.StatusUnauthorized {
+			return ctx, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return ctx, status.Error(codes.Unavailable, err.Error())
+	}
+	return NewContext(ctx, claims), nil
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
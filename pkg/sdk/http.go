@@ -0,0 +1,31 @@
+package sdk
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Middleware returns an http.Handler which verifies the attestation JWT of each request before
+// calling next. The verified claims are added to the request context. Requests without a valid JWT
+// are rejected with a 401, or a 503 if the JSON web key set could not be retrieved.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := v.Verify(r.Context(), r.Header.Get(HeaderJWTAssertion), r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatusCode(err))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
+
+func httpStatusCode(err error) int {
+	for _, target := range []error{
+		ErrTokenNotFound, ErrInvalidToken, ErrUnknownKey, ErrInvalidIssuer, ErrInvalidAudience, ErrExpired,
+	} {
+		if errors.Is(err, target) {
+			return http.StatusUnauthorized
+		}
+	}
+	return http.StatusServiceUnavailable
+}
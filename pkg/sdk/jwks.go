@@ -0,0 +1,106 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+)
+
+// maxJWKSSize is the maximum size of a JSON web key set response.
+const maxJWKSSize = 1 << 20
+
+// A keySet retrieves and caches the JSON web key set used to verify attestation JWTs. The key set
+// is refreshed when it is older than the cache duration, or when a JWT is signed by an unknown key
+// id (at most once per refresh interval), so that signing key rotations are picked up.
+type keySet struct {
+	client          *http.Client
+	endpoint        string
+	cacheDuration   time.Duration
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu        sync.Mutex
+	keys      *jose.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+func newKeySet(client *http.Client, endpoint string, cacheDuration, refreshInterval time.Duration) *keySet {
+	return &keySet{
+		client:          client,
+		endpoint:        endpoint,
+		cacheDuration:   cacheDuration,
+		refreshInterval: refreshInterval,
+		now:             time.Now,
+	}
+}
+
+// get returns the public key with the given key id.
+func (ks *keySet) get(ctx context.Context, keyID string) (*jose.JSONWebKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := ks.now()
+	if ks.keys == nil || now.Sub(ks.fetchedAt) > ks.cacheDuration {
+		if err := ks.refreshLocked(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if key, ok := ks.lookupLocked(keyID); ok {
+		return key, nil
+	}
+
+	if now.Sub(ks.fetchedAt) > ks.refreshInterval {
+		if err := ks.refreshLocked(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := ks.lookupLocked(keyID); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+}
+
+func (ks *keySet) lookupLocked(keyID string) (*jose.JSONWebKey, bool) {
+	for _, key := range ks.keys.Keys {
+		if keyID == "" || key.KeyID == keyID {
+			key := key
+			return &key, true
+		}
+	}
+	return nil, false
+}
+
+func (ks *keySet) refreshLocked(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("sdk: invalid jwks endpoint: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := ks.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sdk: error retrieving jwks: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("sdk: unexpected status code retrieving jwks from %s: %d", ks.endpoint, res.StatusCode)
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxJWKSSize)).Decode(&keys); err != nil {
+		return fmt.Errorf("sdk: error decoding jwks: %w", err)
+	}
+
+	ks.keys = &keys
+	ks.fetchedAt = ks.now()
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package sdk helps upstream Go services verify the attestation JWT that pomerium adds to every
+// proxied request, so that they can trust the identity of the user without re-implementing the
+// verification themselves.
+//
+// A Verifier is created once and shared:
+//
+//	verifier, err := sdk.New(&sdk.Options{Issuer: "authenticate.example.com"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	http.ListenAndServe(":8080", verifier.Middleware(handler))
+//
+// The verified claims are then available to the handler via sdk.FromContext.
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+// HeaderJWTAssertion is the header (or gRPC metadata key) which contains the attestation JWT.
+const HeaderJWTAssertion = "x-pomerium-jwt-assertion"
+
+const (
+	defaultCacheDuration   = time.Hour
+	defaultRefreshInterval = 10 * time.Second
+)
+
+// Errors returned when verifying an attestation JWT.
+var (
+	ErrTokenNotFound   = errors.New("sdk: attestation jwt not found")
+	ErrInvalidToken    = errors.New("sdk: invalid attestation jwt")
+	ErrUnknownKey      = errors.New("sdk: attestation jwt signed by an unknown key")
+	ErrInvalidIssuer   = errors.New("sdk: attestation jwt has an invalid issuer")
+	ErrInvalidAudience = errors.New("sdk: attestation jwt has an invalid audience")
+	ErrExpired         = errors.New("sdk: attestation jwt is expired")
+)
+
+// Options are the options used to create a Verifier.
+type Options struct {
+	// Issuer is the expected issuer of the JWT, which is the host of the authenticate service
+	// (e.g. authenticate.example.com). It is required.
+	Issuer string
+	// Audience is the list of accepted audiences. If empty, the audience must match the host the
+	// request was sent to.
+	Audience []string
+	// JWKSEndpoint is the url of the JSON web key set used to verify the JWT. It defaults to the
+	// key set served by the authenticate service.
+	JWKSEndpoint string
+	// HTTPClient is the client used to retrieve the JSON web key set. It defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// CacheDuration is how long the JSON web key set is cached. It defaults to an hour.
+	CacheDuration time.Duration
+	// Leeway is the allowed clock skew when checking the expiry of the JWT. It defaults to
+	// jwt.DefaultLeeway.
+	Leeway time.Duration
+}
+
+// Claims are the claims of a verified attestation JWT.
+type Claims struct {
+	jwt.Claims
+	User         string   `json:"user,omitempty"`
+	Email        string   `json:"email,omitempty"`
+	Groups       []string `json:"groups,omitempty"`
+	FeatureFlags []string `json:"feature_flags,omitempty"`
+
+	// RawClaims contains every claim of the JWT, including any additional claims configured via
+	// jwt_claims_headers.
+	RawClaims map[string]interface{} `json:"-"`
+}
+
+// A Verifier verifies attestation JWTs.
+type Verifier struct {
+	issuer   string
+	audience []string
+	leeway   time.Duration
+	now      func() time.Time
+	keys     *keySet
+}
+
+// New creates a new Verifier.
+func New(options *Options) (*Verifier, error) {
+	if options == nil || options.Issuer == "" {
+		return nil, errors.New("sdk: issuer is required")
+	}
+
+	o := *options
+	if o.JWKSEndpoint == "" {
+		o.JWKSEndpoint = "https://" + o.Issuer + "/.well-known/pomerium/jwks.json"
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = http.DefaultClient
+	}
+	if o.CacheDuration <= 0 {
+		o.CacheDuration = defaultCacheDuration
+	}
+	if o.Leeway <= 0 {
+		o.Leeway = jwt.DefaultLeeway
+	}
+
+	return &Verifier{
+		issuer:   o.Issuer,
+		audience: o.Audience,
+		leeway:   o.Leeway,
+		now:      time.Now,
+		keys:     newKeySet(o.HTTPClient, o.JWKSEndpoint, o.CacheDuration, defaultRefreshInterval),
+	}, nil
+}
+
+// Verify verifies the raw attestation JWT and returns its claims. The host is the host the request
+// was sent to and is used as the expected audience when no audience was configured.
+func (v *Verifier) Verify(ctx context.Context, rawJWT, host string) (*Claims, error) {
+	if rawJWT == "" {
+		return nil, ErrTokenNotFound
+	}
+
+	tok, err := jwt.ParseSigned(rawJWT)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if len(tok.Headers) != 1 {
+		return nil, fmt.Errorf("%w: expected exactly one signature", ErrInvalidToken)
+	}
+
+	key, err := v.keys.get(ctx, tok.Headers[0].KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := tok.Claims(key, &claims, &claims.RawClaims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.Issuer != v.issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if !v.validAudience(claims.Audience, host) {
+		return nil, ErrInvalidAudience
+	}
+	err = claims.ValidateWithLeeway(jwt.Expected{Time: v.now()}, v.leeway)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExpired, err)
+	}
+
+	return &claims, nil
+}
+
+func (v *Verifier) validAudience(aud jwt.Audience, host string) bool {
+	if len(v.audience) == 0 {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		return host != "" && aud.Contains(host)
+	}
+	for _, expected := range v.audience {
+		if aud.Contains(expected) {
+			return true
+		}
+	}
+	return false
+}
+
+type claimsKey struct{}
+
+// NewContext returns a new context containing the claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims stored in the context, if any.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
@@ -0,0 +1,224 @@
+package sdk
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type testIssuer struct {
+	t       *testing.T
+	key     *ecdsa.PrivateKey
+	keyID   string
+	fetches int64
+	srv     *httptest.Server
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	ti := &testIssuer{t: t}
+	ti.rotate("key-1")
+	ti.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&ti.fetches, 1)
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+			Key:       ti.key.Public(),
+			KeyID:     ti.keyID,
+			Algorithm: string(jose.ES256),
+			Use:       "sig",
+		}}})
+	}))
+	t.Cleanup(ti.srv.Close)
+	return ti
+}
+
+func (ti *testIssuer) rotate(keyID string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(ti.t, err)
+	ti.key, ti.keyID = key, keyID
+}
+
+func (ti *testIssuer) sign(claims map[string]interface{}) string {
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: ti.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", ti.keyID))
+	require.NoError(ti.t, err)
+	rawJWT, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+	require.NoError(ti.t, err)
+	return rawJWT
+}
+
+func (ti *testIssuer) verifier(audience ...string) *Verifier {
+	v, err := New(&Options{
+		Issuer:       "authenticate.example.com",
+		Audience:     audience,
+		JWKSEndpoint: ti.srv.URL,
+	})
+	require.NoError(ti.t, err)
+	return v
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":    "authenticate.example.com",
+		"aud":    "app.example.com",
+		"sub":    "user-1",
+		"email":  "user@example.com",
+		"groups": []string{"admins"},
+		"exp":    time.Now().Add(time.Minute).Unix(),
+		"iat":    time.Now().Unix(),
+		"extra":  "value",
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(&Options{})
+	assert.Error(t, err)
+
+	v, err := New(&Options{Issuer: "authenticate.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://authenticate.example.com/.well-known/pomerium/jwks.json", v.keys.endpoint)
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	ti := newTestIssuer(t)
+
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		claims[key] = value
+		return claims
+	}
+
+	for _, tc := range []struct {
+		name     string
+		rawJWT   string
+		host     string
+		audience []string
+		expect   error
+	}{
+		{"valid", ti.sign(validClaims()), "app.example.com:443", nil, nil},
+		{"configured audience", ti.sign(validClaims()), "other.example.com", []string{"x", "app.example.com"}, nil},
+		{"missing", "", "app.example.com", nil, ErrTokenNotFound},
+		{"malformed", "not-a-jwt", "app.example.com", nil, ErrInvalidToken},
+		{"wrong issuer", ti.sign(with("iss", "evil.example.com")), "app.example.com", nil, ErrInvalidIssuer},
+		{"wrong host", ti.sign(validClaims()), "other.example.com", nil, ErrInvalidAudience},
+		{"wrong audience", ti.sign(validClaims()), "app.example.com", []string{"other.example.com"}, ErrInvalidAudience},
+		{"expired", ti.sign(with("exp", time.Now().Add(-time.Hour).Unix())), "app.example.com", nil, ErrExpired},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := ti.verifier(tc.audience...).Verify(context.Background(), tc.rawJWT, tc.host)
+			if tc.expect != nil {
+				assert.ErrorIs(t, err, tc.expect)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", claims.Subject)
+			assert.Equal(t, "user@example.com", claims.Email)
+			assert.Equal(t, []string{"admins"}, claims.Groups)
+			assert.Equal(t, "value", claims.RawClaims["extra"])
+		})
+	}
+
+	t.Run("forged", func(t *testing.T) {
+		v := ti.verifier()
+		_, err := v.Verify(context.Background(), ti.sign(validClaims()), "app.example.com")
+		require.NoError(t, err)
+
+		// a different key with the same key id must not verify
+		key := ti.key
+		ti.rotate(ti.keyID)
+		rawJWT := ti.sign(validClaims())
+		ti.key = key
+		_, err = v.Verify(context.Background(), rawJWT, "app.example.com")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestVerifier_KeyRotation(t *testing.T) {
+	ti := newTestIssuer(t)
+	v := ti.verifier()
+	now := time.Now()
+	v.keys.now = func() time.Time { return now }
+
+	_, err := v.Verify(context.Background(), ti.sign(validClaims()), "app.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&ti.fetches))
+
+	ti.rotate("key-2")
+	_, err = v.Verify(context.Background(), ti.sign(validClaims()), "app.example.com")
+	assert.ErrorIs(t, err, ErrUnknownKey, "should not refresh before the refresh interval")
+	assert.Equal(t, int64(1), atomic.LoadInt64(&ti.fetches))
+
+	now = now.Add(defaultRefreshInterval + time.Second)
+	_, err = v.Verify(context.Background(), ti.sign(validClaims()), "app.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&ti.fetches))
+}
+
+func TestVerifier_Middleware(t *testing.T) {
+	ti := newTestIssuer(t)
+	h := ti.verifier().Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromContext(r.Context())
+		require.True(t, ok)
+		_, _ = w.Write([]byte(claims.Email))
+	}))
+
+	t.Run("ok", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "https://app.example.com/", nil)
+		r.Header.Set("X-Pomerium-Jwt-Assertion", ti.sign(validClaims()))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "user@example.com", w.Body.String())
+	})
+	t.Run("unauthorized", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "https://app.example.com/", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+	t.Run("unavailable", func(t *testing.T) {
+		v, err := New(&Options{Issuer: "authenticate.example.com", JWKSEndpoint: "http://127.0.0.1:0"})
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodGet, "https://app.example.com/", nil)
+		r.Header.Set("X-Pomerium-Jwt-Assertion", ti.sign(validClaims()))
+		w := httptest.NewRecorder()
+		v.Middleware(http.NotFoundHandler()).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
+
+func TestVerifier_UnaryServerInterceptor(t *testing.T) {
+	ti := newTestIssuer(t)
+	interceptor := ti.verifier().UnaryServerInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		claims, _ := FromContext(ctx)
+		return claims.Email, nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		":authority", "app.example.com",
+		HeaderJWTAssertion, ti.sign(validClaims()),
+	))
+	res, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", res)
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(":authority", "app.example.com"))
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -53,6 +53,8 @@ type Backend struct {
 	capacity map[string]*uint64
 	changes  *btree.BTree
 	leases   map[string]*lease
+	// snapshotDirty is true if records or options have changed since the last snapshot.
+	snapshotDirty bool
 }
 
 // New creates a new in-memory backend storage.
@@ -68,6 +70,16 @@ func New(options ...Option) *Backend {
 		changes:       btree.New(cfg.degree),
 		leases:        make(map[string]*lease),
 	}
+	if cfg.snapshotFile != "" {
+		if err := backend.loadSnapshot(); err != nil {
+			log.Error(context.Background()).Err(err).
+				Str("file", cfg.snapshotFile).
+				Msg("inmemory: error loading snapshot, starting empty")
+		}
+		if cfg.snapshotInterval > 0 {
+			go backend.runSnapshots()
+		}
+	}
 	if cfg.expiry != 0 {
 		go func() {
 			ticker := time.NewTicker(time.Second)
@@ -109,11 +121,16 @@ func (backend *Backend) removeChangesBefore(cutoff time.Time) {
 	}
 }
 
-// Close closes the in-memory store and erases any stored data.
+// Close closes the in-memory store and erases any stored data. If snapshots are enabled, the data is saved first.
 func (backend *Backend) Close() error {
+	var err error
 	backend.closeOnce.Do(func() {
 		close(backend.closed)
 
+		if backend.cfg.snapshotFile != "" {
+			err = backend.writeSnapshot()
+		}
+
 		backend.mu.Lock()
 		defer backend.mu.Unlock()
 
@@ -121,7 +138,7 @@ func (backend *Backend) Close() error {
 		backend.capacity = map[string]*uint64{}
 		backend.changes = btree.New(backend.cfg.degree)
 	})
-	return nil
+	return err
 }
 
 // Get gets a record from the in-memory store.
@@ -220,6 +237,7 @@ func (backend *Backend) Put(ctx context.Context, record *databroker.Record) (ser
 	defer backend.onChange.Broadcast(ctx)
 
 	backend.recordChange(record)
+	backend.snapshotDirty = true
 
 	c, ok := backend.lookup[record.GetType()]
 	if !ok {
@@ -243,6 +261,7 @@ func (backend *Backend) SetOptions(_ context.Context, recordType string, options
 	backend.mu.Lock()
 	defer backend.mu.Unlock()
 
+	backend.snapshotDirty = true
 	if options.Capacity == nil {
 		delete(backend.capacity, recordType)
 	} else {
@@ -3,6 +3,10 @@ package inmemory
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 	"time"
 
@@ -14,6 +18,7 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/protoutil"
 	"github.com/pomerium/pomerium/pkg/storage"
 )
 
@@ -245,3 +250,59 @@ func TestLease(t *testing.T) {
 		assert.True(t, ok, "expected b to to acquire the lease")
 	}
 }
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "databroker.snapshot")
+
+	backend := New(WithSnapshot(file, time.Hour))
+	for i := 0; i < 3; i++ {
+		_, err := backend.Put(ctx, &databroker.Record{
+			Type: "TYPE",
+			Id:   fmt.Sprint(i),
+			Data: protoutil.NewAnyString(fmt.Sprint(i)),
+		})
+		require.NoError(t, err)
+	}
+	_, err := backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "1", DeletedAt: timestamppb.Now()})
+	require.NoError(t, err)
+	require.NoError(t, backend.SetOptions(ctx, "TYPE", &databroker.Options{Capacity: proto.Uint64(10)}))
+	require.NoError(t, backend.Close())
+
+	restored := New(WithSnapshot(file, time.Hour))
+	defer func() { _ = restored.Close() }()
+	records, versions, err := restored.GetAll(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, backend.serverVersion, versions.ServerVersion, "should force clients to sync again")
+	assert.Equal(t, uint64(4), versions.LatestRecordVersion)
+	if assert.Len(t, records, 2) {
+		sort.Slice(records, func(i, j int) bool { return records[i].GetId() < records[j].GetId() })
+		assert.Equal(t, "0", records[0].GetId())
+		assert.Equal(t, "2", records[1].GetId())
+		assert.True(t, proto.Equal(protoutil.NewAnyString("2"), records[1].GetData()))
+	}
+	options, err := restored.GetOptions(ctx, "TYPE")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), options.GetCapacity())
+
+	t.Run("periodic", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "databroker.snapshot")
+		backend := New(WithSnapshot(file, 10*time.Millisecond))
+		defer func() { _ = backend.Close() }()
+		_, err := backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "0"})
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(file)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+	})
+	t.Run("corrupt", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "databroker.snapshot")
+		require.NoError(t, ioutil.WriteFile(file, []byte{0xff, 0xff, 0x01, 0x02}, 0o600))
+		backend := New(WithSnapshot(file, time.Hour))
+		defer func() { _ = backend.Close() }()
+		records, _, err := backend.GetAll(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, records)
+	})
+}
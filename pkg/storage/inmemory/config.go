@@ -3,8 +3,10 @@ package inmemory
 import "time"
 
 type config struct {
-	degree int
-	expiry time.Duration
+	degree           int
+	expiry           time.Duration
+	snapshotFile     string
+	snapshotInterval time.Duration
 }
 
 // An Option customizes the in-memory backend.
@@ -34,3 +36,12 @@ func WithExpiry(expiry time.Duration) Option {
 		cfg.expiry = expiry
 	}
 }
+
+// WithSnapshot sets the file the backend is restored from, and periodically saved to at the given interval. The
+// backend is also saved when it's closed.
+func WithSnapshot(file string, interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.snapshotFile = file
+		cfg.snapshotInterval = interval
+	}
+}
@@ -0,0 +1,205 @@
+package inmemory
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// maxSnapshotMessageSize limits the size of a message read from a snapshot, so a corrupt length prefix doesn't
+// allocate an unbounded amount of memory.
+const maxSnapshotMessageSize = 64 << 20
+
+// A snapshot file is a sequence of length-prefixed Any messages. It starts with the databroker.Versions of the
+// backend, followed by a databroker.SetOptionsRequest for each record type with options and the databroker.Record of
+// each record, in insertion order. Leases and the changes used for syncing aren't stored.
+
+// runSnapshots writes a snapshot of the backend every snapshot interval, if it has changed.
+func (backend *Backend) runSnapshots() {
+	ticker := time.NewTicker(backend.cfg.snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-backend.closed:
+			return
+		case <-ticker.C:
+		}
+
+		if err := backend.writeSnapshot(); err != nil {
+			log.Error(context.Background()).Err(err).
+				Str("file", backend.cfg.snapshotFile).
+				Msg("inmemory: error writing snapshot")
+		}
+	}
+}
+
+// writeSnapshot writes the records and options of the backend to the snapshot file, if they have changed since the
+// last snapshot. The file is replaced atomically, so an interrupted write leaves the previous snapshot in place.
+func (backend *Backend) writeSnapshot() error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	if !backend.snapshotDirty {
+		return nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(backend.cfg.snapshotFile), filepath.Base(backend.cfg.snapshotFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("inmemory: error creating snapshot file: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	w := bufio.NewWriter(f)
+	if err := backend.writeSnapshotLocked(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("inmemory: error writing snapshot: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("inmemory: error writing snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("inmemory: error writing snapshot: %w", err)
+	}
+	if err := os.Rename(f.Name(), backend.cfg.snapshotFile); err != nil {
+		return fmt.Errorf("inmemory: error replacing snapshot file: %w", err)
+	}
+
+	backend.snapshotDirty = false
+	return nil
+}
+
+func (backend *Backend) writeSnapshotLocked(w io.Writer) error {
+	if err := writeSnapshotMessage(w, &databroker.Versions{
+		ServerVersion:       backend.serverVersion,
+		LatestRecordVersion: backend.lastVersion,
+	}); err != nil {
+		return err
+	}
+	for recordType, capacity := range backend.capacity {
+		if err := writeSnapshotMessage(w, &databroker.SetOptionsRequest{
+			Type:    recordType,
+			Options: &databroker.Options{Capacity: proto.Uint64(*capacity)},
+		}); err != nil {
+			return err
+		}
+	}
+	for _, records := range backend.lookup {
+		for _, record := range records.List() {
+			if err := writeSnapshotMessage(w, record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeSnapshotMessage(w io.Writer, msg proto.Message) error {
+	data, err := anypb.New(msg)
+	if err != nil {
+		return fmt.Errorf("inmemory: error encoding snapshot: %w", err)
+	}
+	bs, err := proto.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("inmemory: error encoding snapshot: %w", err)
+	}
+	if _, err := w.Write(protowire.AppendBytes(nil, bs)); err != nil {
+		return fmt.Errorf("inmemory: error writing snapshot: %w", err)
+	}
+	return nil
+}
+
+// loadSnapshot restores the records and options of the backend from the snapshot file, if it exists. The server
+// version isn't restored, so clients sync all the records again.
+func (backend *Backend) loadSnapshot() error {
+	f, err := os.Open(backend.cfg.snapshotFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("inmemory: error opening snapshot file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var lastVersion uint64
+	capacity := make(map[string]*uint64)
+	lookup := make(map[string]*RecordCollection)
+	r := bufio.NewReader(f)
+	for {
+		msg, err := readSnapshotMessage(r)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch msg := msg.(type) {
+		case *databroker.Versions:
+			lastVersion = msg.GetLatestRecordVersion()
+		case *databroker.SetOptionsRequest:
+			if msg.GetOptions().Capacity != nil {
+				capacity[msg.GetType()] = proto.Uint64(msg.GetOptions().GetCapacity())
+			}
+		case *databroker.Record:
+			c, ok := lookup[msg.GetType()]
+			if !ok {
+				c = NewRecordCollection()
+				lookup[msg.GetType()] = c
+			}
+			c.Put(msg)
+			if msg.GetVersion() > lastVersion {
+				lastVersion = msg.GetVersion()
+			}
+		}
+	}
+
+	backend.mu.Lock()
+	backend.lastVersion = lastVersion
+	backend.capacity = capacity
+	backend.lookup = lookup
+	backend.mu.Unlock()
+	return nil
+}
+
+func readSnapshotMessage(r *bufio.Reader) (proto.Message, error) {
+	sz, err := binary.ReadUvarint(r)
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("inmemory: invalid snapshot: %w", err)
+	}
+	if sz > maxSnapshotMessageSize {
+		return nil, fmt.Errorf("inmemory: invalid snapshot: message too large")
+	}
+	bs := make([]byte, sz)
+	if _, err := io.ReadFull(r, bs); err != nil {
+		return nil, fmt.Errorf("inmemory: invalid snapshot: %w", err)
+	}
+
+	var data anypb.Any
+	if err := proto.Unmarshal(bs, &data); err != nil {
+		return nil, fmt.Errorf("inmemory: invalid snapshot: %w", err)
+	}
+	msg, err := data.UnmarshalNew()
+	if err != nil {
+		return nil, fmt.Errorf("inmemory: invalid snapshot: %w", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,263 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+var (
+	getAllStreamDesc = &grpc.StreamDesc{StreamName: "GetAll", ServerStreams: true}
+	syncStreamDesc   = &grpc.StreamDesc{StreamName: "Sync", ServerStreams: true}
+)
+
+// A Backend is a storage.Backend which calls a storage plugin over gRPC.
+type Backend struct {
+	cc      *grpc.ClientConn
+	onClose func() error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewBackend creates a new Backend which calls the storage plugin served on the given connection.
+// The connection is closed when the backend is.
+func NewBackend(cc *grpc.ClientConn) *Backend {
+	return &Backend{cc: cc}
+}
+
+// Close closes the connection to the plugin, and stops the plugin process if the backend started it.
+func (backend *Backend) Close() error {
+	backend.closeOnce.Do(func() {
+		backend.closeErr = backend.cc.Close()
+		if backend.onClose != nil {
+			if err := backend.onClose(); err != nil && backend.closeErr == nil {
+				backend.closeErr = err
+			}
+		}
+	})
+	return backend.closeErr
+}
+
+// Get gets a record from the plugin.
+func (backend *Backend) Get(ctx context.Context, recordType, id string) (*databroker.Record, error) {
+	res := new(databroker.GetResponse)
+	err := backend.invoke(ctx, "Get", &databroker.GetRequest{Type: recordType, Id: id}, res)
+	if err != nil {
+		return nil, err
+	}
+	return res.GetRecord(), nil
+}
+
+// GetAll gets all the records from the plugin.
+func (backend *Backend) GetAll(ctx context.Context) ([]*databroker.Record, *databroker.Versions, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := backend.newStream(ctx, getAllStreamDesc, new(emptypb.Empty))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var records []*databroker.Record
+	for {
+		res := new(databroker.SyncLatestResponse)
+		if err := stream.RecvMsg(res); err != nil {
+			return nil, nil, fromStatus(err)
+		}
+		switch res := res.GetResponse().(type) {
+		case *databroker.SyncLatestResponse_Record:
+			records = append(records, res.Record)
+		case *databroker.SyncLatestResponse_Versions:
+			// the versions are always sent last
+			return records, res.Versions, nil
+		default:
+			return nil, nil, fmt.Errorf("storage/plugin: unexpected get all response: %T", res)
+		}
+	}
+}
+
+// GetOptions gets the options for a type from the plugin.
+func (backend *Backend) GetOptions(ctx context.Context, recordType string) (*databroker.Options, error) {
+	res := new(databroker.Options)
+	err := backend.invoke(ctx, "GetOptions", wrapperspb.String(recordType), res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Lease acquires, renews or releases a lease in the plugin.
+func (backend *Backend) Lease(ctx context.Context, leaseName, leaseID string, ttl time.Duration) (bool, error) {
+	res := new(wrapperspb.BoolValue)
+	err := backend.invoke(ctx, "Lease", &databroker.RenewLeaseRequest{
+		Name:     leaseName,
+		Id:       leaseID,
+		Duration: durationpb.New(ttl),
+	}, res)
+	if err != nil {
+		return false, err
+	}
+	return res.GetValue(), nil
+}
+
+// Put puts a record into the plugin. The record's version and modification time are updated to those
+// set by the plugin.
+func (backend *Backend) Put(ctx context.Context, record *databroker.Record) (uint64, error) {
+	res := new(databroker.PutResponse)
+	err := backend.invoke(ctx, "Put", &databroker.PutRequest{Record: record}, res)
+	if err != nil {
+		return 0, err
+	}
+	record.Version = res.GetRecord().GetVersion()
+	record.ModifiedAt = res.GetRecord().GetModifiedAt()
+	return res.GetServerVersion(), nil
+}
+
+// SetOptions sets the options for a type in the plugin.
+func (backend *Backend) SetOptions(ctx context.Context, recordType string, options *databroker.Options) error {
+	return backend.invoke(ctx, "SetOptions", &databroker.SetOptionsRequest{
+		Type:    recordType,
+		Options: options,
+	}, new(emptypb.Empty))
+}
+
+// Sync streams the record changes after the given version from the plugin.
+func (backend *Backend) Sync(ctx context.Context, serverVersion, recordVersion uint64) (storage.RecordStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := backend.newStream(ctx, syncStreamDesc, &databroker.SyncRequest{
+		ServerVersion: serverVersion,
+		RecordVersion: recordVersion,
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return newRecordStream(ctx, cancel, stream), nil
+}
+
+func (backend *Backend) invoke(ctx context.Context, method string, req, res interface{}) error {
+	err := backend.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res)
+	return fromStatus(err)
+}
+
+func (backend *Backend) newStream(ctx context.Context, desc *grpc.StreamDesc, req interface{}) (grpc.ClientStream, error) {
+	stream, err := backend.cc.NewStream(ctx, desc, "/"+serviceName+"/"+desc.StreamName)
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, fromStatus(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fromStatus(err)
+	}
+	return stream, nil
+}
+
+// recordStream receives the records of a sync stream in the background, so that Next can be called
+// without blocking.
+type recordStream struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	records chan *databroker.Record
+	record  *databroker.Record
+
+	done chan struct{}
+	err  error
+}
+
+func newRecordStream(ctx context.Context, cancel context.CancelFunc, stream grpc.ClientStream) *recordStream {
+	rs := &recordStream{
+		ctx:     ctx,
+		cancel:  cancel,
+		records: make(chan *databroker.Record, 1),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(rs.done)
+		for {
+			res := new(databroker.SyncResponse)
+			if err := stream.RecvMsg(res); err != nil {
+				rs.err = err
+				return
+			}
+			select {
+			case rs.records <- res.GetRecord():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return rs
+}
+
+func (rs *recordStream) Close() error {
+	rs.cancel()
+	return nil
+}
+
+func (rs *recordStream) Next(block bool) bool {
+	if !block {
+		select {
+		case rs.record = <-rs.records:
+			return true
+		default:
+			return false
+		}
+	}
+
+	select {
+	case rs.record = <-rs.records:
+		return true
+	case <-rs.done:
+		// the stream may have ended after the last record was received
+		select {
+		case rs.record = <-rs.records:
+			return true
+		default:
+			return false
+		}
+	case <-rs.ctx.Done():
+		return false
+	}
+}
+
+func (rs *recordStream) Record() *databroker.Record {
+	return rs.record
+}
+
+func (rs *recordStream) Err() error {
+	select {
+	case <-rs.done:
+	default:
+		return rs.ctx.Err()
+	}
+
+	switch {
+	case rs.err == nil, errors.Is(rs.err, context.Canceled):
+		return rs.ctx.Err()
+	case errors.Is(rs.err, io.EOF):
+		// sync streams don't end unless the plugin closes them
+		return storage.ErrStreamClosed
+	case status.Code(rs.err) == codes.Canceled:
+		if err := rs.ctx.Err(); err != nil {
+			return err
+		}
+		return storage.ErrStreamClosed
+	}
+	return fromStatus(rs.err)
+}
@@ -0,0 +1,215 @@
+// Package plugin serves and calls storage backends which run as separate processes, so that the
+// databroker can use storage which isn't built into pomerium.
+//
+// A plugin is an executable which calls Serve with its storage.Backend. The databroker starts the
+// executable with Open, and the plugin writes the address it listens on to stdout:
+//
+//	<protocol version>|unix|<socket path>
+//
+// after which the databroker calls the backend over gRPC on that address. Any other output of the
+// plugin is logged.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+const (
+	// ProtocolVersion is the version of the plugin protocol. It changes when the Backend
+	// service changes incompatibly.
+	ProtocolVersion = 1
+
+	// MagicCookieKey and MagicCookieValue are set in the environment of plugins started by Open, so
+	// that a plugin executed directly can tell the user it isn't meant to be.
+	MagicCookieKey   = "POMERIUM_STORAGE_PLUGIN"
+	MagicCookieValue = "b5c8d6a1-5e0f-4c8a-9a49-4b2f0f8f3b1e"
+
+	// ConnectionStringKey is the environment variable the databroker storage connection string
+	// is passed to plugins in.
+	ConnectionStringKey = "POMERIUM_STORAGE_CONNECTION_STRING"
+)
+
+// DefaultStartTimeout is the default amount of time to wait for a plugin to start serving.
+var DefaultStartTimeout = 30 * time.Second
+
+// Serve serves the backend to the databroker which started this process, until the process is
+// interrupted or terminated. It is meant to be called from the main function of a plugin.
+func Serve(backend storage.Backend) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return errors.New("storage/plugin: this executable is a pomerium storage plugin, " +
+			"set databroker_storage_plugin to its path instead of running it directly")
+	}
+
+	dir, err := ioutil.TempDir("", "pomerium-storage-plugin")
+	if err != nil {
+		return fmt.Errorf("storage/plugin: error creating socket directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	li, err := net.Listen("unix", filepath.Join(dir, "plugin.sock"))
+	if err != nil {
+		return fmt.Errorf("storage/plugin: error listening: %w", err)
+	}
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&backendServiceDesc, &backendServer{backend: backend})
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		if _, ok := <-sigs; ok {
+			srv.GracefulStop()
+		}
+	}()
+
+	fmt.Fprintf(os.Stdout, "%d|%s|%s\n", ProtocolVersion, li.Addr().Network(), li.Addr().String())
+
+	err = srv.Serve(li)
+	if closeErr := backend.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Open starts the plugin executable at the given path and returns a Backend which calls it. The
+// plugin is stopped when the backend is closed.
+func Open(ctx context.Context, path, connectionString string) (*Backend, error) {
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(),
+		MagicCookieKey+"="+MagicCookieValue,
+		ConnectionStringKey+"="+connectionString,
+	)
+	cmd.Stderr = &logWriter{ctx: ctx, path: path}
+	// an os.Pipe rather than cmd.StdoutPipe, so that waiting for the process doesn't race reading its output
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("storage/plugin: %w", err)
+	}
+	cmd.Stdout = w
+	err = cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		_ = stdout.Close()
+		return nil, fmt.Errorf("storage/plugin: error starting %s: %w", path, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+		_ = stdout.Close()
+	}()
+	stop := func() error {
+		_ = cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+		return nil
+	}
+
+	output := bufio.NewReader(stdout)
+	target, err := readHandshake(ctx, output, exited)
+	if err != nil {
+		_ = stop()
+		return nil, fmt.Errorf("storage/plugin: %s: %w", path, err)
+	}
+	// forward any other output to the log
+	go func() { _, _ = io.Copy(&logWriter{ctx: ctx, path: path}, output) }()
+
+	cc, err := grpc.DialContext(ctx, target, grpc.WithInsecure())
+	if err != nil {
+		_ = stop()
+		return nil, fmt.Errorf("storage/plugin: error connecting to %s: %w", path, err)
+	}
+	log.Info(ctx).Str("plugin", path).Int("pid", cmd.Process.Pid).Msg("storage/plugin: started")
+
+	backend := NewBackend(cc)
+	backend.onClose = stop
+	return backend, nil
+}
+
+// readHandshake reads the address the plugin listens on from its output, and returns it as a gRPC
+// target.
+func readHandshake(ctx context.Context, output *bufio.Reader, exited <-chan struct{}) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	lines := make(chan result, 1)
+	go func() {
+		line, err := output.ReadString('\n')
+		lines <- result{line, err}
+	}()
+
+	var line string
+	select {
+	case res := <-lines:
+		if res.err != nil {
+			return "", fmt.Errorf("error reading handshake: %w", res.err)
+		}
+		line = res.line
+	case <-exited:
+		return "", errors.New("plugin exited before serving")
+	case <-time.After(DefaultStartTimeout):
+		return "", errors.New("timed out waiting for the plugin to start")
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return parseHandshake(line)
+}
+
+func parseHandshake(line string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid handshake: %q", line)
+	}
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid handshake protocol version: %q", parts[0])
+	}
+	if version != ProtocolVersion {
+		return "", fmt.Errorf("unsupported protocol version %d, expected %d", version, ProtocolVersion)
+	}
+	switch parts[1] {
+	case "unix":
+		return "unix://" + parts[2], nil
+	case "tcp":
+		return parts[2], nil
+	}
+	return "", fmt.Errorf("unsupported handshake network: %q", parts[1])
+}
+
+// logWriter logs the output of a plugin.
+type logWriter struct {
+	ctx  context.Context
+	path string
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		log.Info(w.ctx).Str("plugin", w.path).Msg(line)
+	}
+	return len(p), nil
+}
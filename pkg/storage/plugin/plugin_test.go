@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+	"github.com/pomerium/pomerium/pkg/storage/inmemory"
+)
+
+func newTestBackend(t *testing.T) *Backend {
+	t.Helper()
+
+	li := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	srv.RegisterService(&backendServiceDesc, &backendServer{backend: inmemory.New()})
+	go func() { _ = srv.Serve(li) }()
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return li.Dial()
+		}),
+		grpc.WithInsecure())
+	require.NoError(t, err)
+	backend := NewBackend(cc)
+	t.Cleanup(func() { _ = backend.Close() })
+	return backend
+}
+
+func TestBackend(t *testing.T) {
+	ctx, clearTimeout := context.WithTimeout(context.Background(), 10*time.Second)
+	defer clearTimeout()
+
+	backend := newTestBackend(t)
+
+	t.Run("get missing record", func(t *testing.T) {
+		record, err := backend.Get(ctx, "TYPE", "abcd")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+		assert.Nil(t, record)
+	})
+	t.Run("put and get record", func(t *testing.T) {
+		data := new(anypb.Any)
+		record := &databroker.Record{Type: "TYPE", Id: "abcd", Data: data}
+		serverVersion, err := backend.Put(ctx, record)
+		require.NoError(t, err)
+		assert.NotZero(t, serverVersion)
+		assert.Equal(t, uint64(1), record.GetVersion())
+		assert.NotNil(t, record.GetModifiedAt())
+
+		got, err := backend.Get(ctx, "TYPE", "abcd")
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(record, got))
+	})
+	t.Run("get all records", func(t *testing.T) {
+		_, err := backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "efgh", DeletedAt: timestamppb.Now()})
+		require.NoError(t, err)
+
+		records, versions, err := backend.GetAll(ctx)
+		require.NoError(t, err)
+		assert.Len(t, records, 1)
+		assert.Equal(t, uint64(2), versions.GetLatestRecordVersion())
+	})
+	t.Run("options", func(t *testing.T) {
+		err := backend.SetOptions(ctx, "TYPE", &databroker.Options{Capacity: proto.Uint64(10)})
+		require.NoError(t, err)
+		options, err := backend.GetOptions(ctx, "TYPE")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(10), options.GetCapacity())
+	})
+	t.Run("lease", func(t *testing.T) {
+		acquired, err := backend.Lease(ctx, "lock", "a", time.Minute)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+		acquired, err = backend.Lease(ctx, "lock", "b", time.Minute)
+		require.NoError(t, err)
+		assert.False(t, acquired)
+		_, err = backend.Lease(ctx, "lock", "a", -1)
+		require.NoError(t, err)
+		acquired, err = backend.Lease(ctx, "lock", "b", time.Minute)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+	})
+	t.Run("sync", func(t *testing.T) {
+		_, versions, err := backend.GetAll(ctx)
+		require.NoError(t, err)
+
+		stream, err := backend.Sync(ctx, versions.GetServerVersion(), versions.GetLatestRecordVersion())
+		require.NoError(t, err)
+		defer func() { _ = stream.Close() }()
+
+		assert.False(t, stream.Next(false))
+		_, err = backend.Put(ctx, &databroker.Record{Type: "TYPE", Id: "ijkl"})
+		require.NoError(t, err)
+		require.True(t, stream.Next(true))
+		assert.Equal(t, "ijkl", stream.Record().GetId())
+
+		require.NoError(t, stream.Close())
+		assert.False(t, stream.Next(true))
+		assert.Error(t, stream.Err())
+	})
+	t.Run("sync invalid server version", func(t *testing.T) {
+		stream, err := backend.Sync(ctx, 1234, 0)
+		require.NoError(t, err)
+		defer func() { _ = stream.Close() }()
+
+		assert.False(t, stream.Next(true))
+		assert.ErrorIs(t, stream.Err(), storage.ErrInvalidServerVersion)
+	})
+}
+
+func TestParseHandshake(t *testing.T) {
+	for _, tc := range []struct {
+		line   string
+		expect string
+		err    bool
+	}{
+		{"1|unix|/tmp/plugin/plugin.sock\n", "unix:///tmp/plugin/plugin.sock", false},
+		{"1|tcp|127.0.0.1:1234\n", "127.0.0.1:1234", false},
+		{"2|unix|/tmp/plugin/plugin.sock\n", "", true},
+		{"1|udp|127.0.0.1:1234\n", "", true},
+		{"hello world\n", "", true},
+	} {
+		target, err := parseHandshake(tc.line)
+		if tc.err {
+			assert.Error(t, err, tc.line)
+		} else {
+			assert.NoError(t, err, tc.line)
+			assert.Equal(t, tc.expect, target)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/storage"
+)
+
+// serviceName is the name of the gRPC service which exposes a storage.Backend to the databroker.
+const serviceName = "pomerium.storage.plugin.Backend"
+
+// backendServer exposes a storage.Backend over gRPC. The service re-uses the databroker messages, so
+// that it doesn't need generated code of its own, and its methods map one to one to those of the
+// storage.Backend interface.
+type backendServer struct {
+	backend storage.Backend
+}
+
+var backendServiceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(databroker.GetRequest)
+				return handleUnary(ctx, srv, "Get", dec, in, interceptor, func(ctx context.Context) (interface{}, error) {
+					return srv.(*backendServer).get(ctx, in)
+				})
+			},
+		},
+		{
+			MethodName: "GetOptions",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(wrapperspb.StringValue)
+				return handleUnary(ctx, srv, "GetOptions", dec, in, interceptor, func(ctx context.Context) (interface{}, error) {
+					return srv.(*backendServer).getOptions(ctx, in)
+				})
+			},
+		},
+		{
+			MethodName: "Lease",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(databroker.RenewLeaseRequest)
+				return handleUnary(ctx, srv, "Lease", dec, in, interceptor, func(ctx context.Context) (interface{}, error) {
+					return srv.(*backendServer).lease(ctx, in)
+				})
+			},
+		},
+		{
+			MethodName: "Put",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(databroker.PutRequest)
+				return handleUnary(ctx, srv, "Put", dec, in, interceptor, func(ctx context.Context) (interface{}, error) {
+					return srv.(*backendServer).put(ctx, in)
+				})
+			},
+		},
+		{
+			MethodName: "SetOptions",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(databroker.SetOptionsRequest)
+				return handleUnary(ctx, srv, "SetOptions", dec, in, interceptor, func(ctx context.Context) (interface{}, error) {
+					return srv.(*backendServer).setOptions(ctx, in)
+				})
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "GetAll",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(*backendServer).getAll(stream)
+			},
+			ServerStreams: true,
+		},
+		{
+			StreamName: "Sync",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(*backendServer).sync(stream)
+			},
+			ServerStreams: true,
+		},
+	},
+}
+
+// handleUnary decodes the request into in and calls fn, through the interceptor if there is one.
+func handleUnary(
+	ctx context.Context,
+	srv interface{},
+	method string,
+	dec func(interface{}) error,
+	in interface{},
+	interceptor grpc.UnaryServerInterceptor,
+	fn func(ctx context.Context) (interface{}, error),
+) (interface{}, error) {
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return fn(ctx)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + serviceName + "/" + method,
+	}
+	return interceptor(ctx, in, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		return fn(ctx)
+	})
+}
+
+func (srv *backendServer) get(ctx context.Context, req *databroker.GetRequest) (*databroker.GetResponse, error) {
+	record, err := srv.backend.Get(ctx, req.GetType(), req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &databroker.GetResponse{Record: record}, nil
+}
+
+func (srv *backendServer) getOptions(ctx context.Context, req *wrapperspb.StringValue) (*databroker.Options, error) {
+	options, err := srv.backend.GetOptions(ctx, req.GetValue())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return options, nil
+}
+
+func (srv *backendServer) lease(ctx context.Context, req *databroker.RenewLeaseRequest) (*wrapperspb.BoolValue, error) {
+	acquired, err := srv.backend.Lease(ctx, req.GetName(), req.GetId(), req.GetDuration().AsDuration())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return wrapperspb.Bool(acquired), nil
+}
+
+func (srv *backendServer) put(ctx context.Context, req *databroker.PutRequest) (*databroker.PutResponse, error) {
+	serverVersion, err := srv.backend.Put(ctx, req.GetRecord())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	// the backend sets the version and modification time of the record
+	return &databroker.PutResponse{ServerVersion: serverVersion, Record: req.GetRecord()}, nil
+}
+
+func (srv *backendServer) setOptions(ctx context.Context, req *databroker.SetOptionsRequest) (*emptypb.Empty, error) {
+	err := srv.backend.SetOptions(ctx, req.GetType(), req.GetOptions())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return new(emptypb.Empty), nil
+}
+
+// getAll streams every record, followed by the versions.
+func (srv *backendServer) getAll(stream grpc.ServerStream) error {
+	if err := stream.RecvMsg(new(emptypb.Empty)); err != nil {
+		return err
+	}
+
+	records, versions, err := srv.backend.GetAll(stream.Context())
+	if err != nil {
+		return toStatus(err)
+	}
+	for _, record := range records {
+		err = stream.SendMsg(&databroker.SyncLatestResponse{
+			Response: &databroker.SyncLatestResponse_Record{Record: record},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return stream.SendMsg(&databroker.SyncLatestResponse{
+		Response: &databroker.SyncLatestResponse_Versions{Versions: versions},
+	})
+}
+
+func (srv *backendServer) sync(stream grpc.ServerStream) error {
+	req := new(databroker.SyncRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+
+	recordStream, err := srv.backend.Sync(stream.Context(), req.GetServerVersion(), req.GetRecordVersion())
+	if err != nil {
+		return toStatus(err)
+	}
+	defer func() { _ = recordStream.Close() }()
+
+	for recordStream.Next(true) {
+		err = stream.SendMsg(&databroker.SyncResponse{Record: recordStream.Record()})
+		if err != nil {
+			return err
+		}
+	}
+	return toStatus(recordStream.Err())
+}
+
+// toStatus converts the storage errors to gRPC status errors, so that the client can convert them back.
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, storage.ErrStreamClosed):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// fromStatus converts the gRPC status errors returned by the plugin to storage errors.
+func fromStatus(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return storage.ErrNotFound
+	}
+	return err
+}
@@ -3,10 +3,12 @@ package redis
 import (
 	"crypto/tls"
 	"time"
+
+	"github.com/pomerium/pomerium/internal/redisutil"
 )
 
 type config struct {
-	tls    *tls.Config
+	client redisutil.ClientOptions
 	expiry time.Duration
 }
 
@@ -16,7 +18,7 @@ type Option func(*config)
 // WithTLSConfig sets the tls.Config which Backend uses.
 func WithTLSConfig(tlsConfig *tls.Config) Option {
 	return func(cfg *config) {
-		cfg.tls = tlsConfig
+		cfg.client.TLSConfig = tlsConfig
 	}
 }
 
@@ -27,6 +29,35 @@ func WithExpiry(expiry time.Duration) Option {
 	}
 }
 
+// WithRequireTLS enables TLS even if the URL scheme doesn't.
+func WithRequireTLS(requireTLS bool) Option {
+	return func(cfg *config) {
+		cfg.client.RequireTLS = requireTLS
+	}
+}
+
+// WithAuth sets the username and password used to authenticate to redis, overriding those of the URL.
+func WithAuth(username, password string) Option {
+	return func(cfg *config) {
+		cfg.client.Username = username
+		cfg.client.Password = password
+	}
+}
+
+// WithDB sets the database to select, overriding that of the URL.
+func WithDB(db int) Option {
+	return func(cfg *config) {
+		cfg.client.DB = db
+	}
+}
+
+// WithSentinelMasterName sets the name of the master monitored by sentinel, overriding that of the URL.
+func WithSentinelMasterName(name string) Option {
+	return func(cfg *config) {
+		cfg.client.SentinelMasterName = name
+	}
+}
+
 func getConfig(options ...Option) *config {
 	cfg := new(config)
 	WithExpiry(time.Hour * 24)(cfg)
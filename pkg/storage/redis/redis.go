@@ -78,7 +78,7 @@ func New(rawURL string, options ...Option) (*Backend, error) {
 		onChange: signal.New(),
 	}
 	var err error
-	backend.client, err = redisutil.NewClientFromURL(rawURL, backend.cfg.tls)
+	backend.client, err = redisutil.NewClientFromURL(rawURL, &backend.cfg.client)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +38,8 @@ type RecordStream interface {
 	Err() error
 }
 
-// Backend is the interface required for a storage backend.
+// Backend is the interface required for a storage backend. Backends which aren't built into pomerium
+// can be served to the databroker by a plugin, see the plugin package.
 type Backend interface {
 	// Close closes the backend.
 	Close() error
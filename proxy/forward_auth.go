@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/pomerium/pomerium/internal/deprecation"
 	"github.com/pomerium/pomerium/internal/httputil"
 	"github.com/pomerium/pomerium/internal/urlutil"
 )
@@ -23,17 +24,17 @@ func (p *Proxy) registerFwdAuthHandlers() http.Handler {
 	// 		 to reason about so each step has a postfix order step.
 
 	// nginx 3: save the returned session post authenticate flow
-	r.Handle("/verify", httputil.HandlerFunc(p.nginxCallback)).
+	r.Handle("/verify", uriQueryForwardAuth(p.nginxCallback)).
 		Queries(urlutil.QueryForwardAuthURI, "{uri}",
 			urlutil.QuerySessionEncrypted, "",
 			urlutil.QueryRedirectURI, "")
 
 	// nginx 1: verify, fronted by ext_authz
-	r.Handle("/verify", httputil.HandlerFunc(p.allowUpstream)).
+	r.Handle("/verify", uriQueryForwardAuth(p.allowUpstream)).
 		Queries(urlutil.QueryForwardAuthURI, "{uri}")
 
 	// nginx 4: redirect the user back to their originally requested location.
-	r.Handle("/", httputil.HandlerFunc(p.nginxPostCallbackRedirect)).
+	r.Handle("/", uriQueryForwardAuth(p.nginxPostCallbackRedirect)).
 		Queries(urlutil.QueryForwardAuthURI, "{uri}",
 			urlutil.QuerySessionEncrypted, "",
 			urlutil.QueryRedirectURI, "")
@@ -42,7 +43,7 @@ func (p *Proxy) registerFwdAuthHandlers() http.Handler {
 	r.Handle("/", httputil.HandlerFunc(p.forwardedURIHeaderCallback)).
 		HeadersRegexp(httputil.HeaderForwardedURI, urlutil.QuerySessionEncrypted)
 
-	r.Handle("/", httputil.HandlerFunc(p.startAuthN)).
+	r.Handle("/", uriQueryForwardAuth(p.startAuthN)).
 		Queries(urlutil.QueryForwardAuthURI, "{uri}")
 
 	// otherwise, send a 200 OK for any other route.
@@ -51,13 +52,25 @@ func (p *Proxy) registerFwdAuthHandlers() http.Handler {
 	return r
 }
 
+// uriQueryForwardAuth records usage of the deprecated forward auth flows which pass the original URL in
+// the uri query parameter.
+func uriQueryForwardAuth(h httputil.HandlerFunc) httputil.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		deprecation.Record(r.Context(), deprecation.ForwardAuthURIQuery)
+		return h(w, r)
+	}
+}
+
 // nginxPostCallbackRedirect redirects the user to their original destination
 // in order to drop the authenticate related query params
 func (p *Proxy) nginxPostCallbackRedirect(w http.ResponseWriter, r *http.Request) error {
-	u, err := url.Parse(r.FormValue(urlutil.QueryRedirectURI))
+	u, err := urlutil.ParseAndValidateURL(r.FormValue(urlutil.QueryRedirectURI))
 	if err != nil {
 		return httputil.NewError(http.StatusBadRequest, err)
 	}
+	if !p.currentOptions.Load().IsRedirectAllowed(u) {
+		return httputil.NewError(http.StatusBadRequest, errors.New("invalid redirect uri"))
+	}
 	httputil.Redirect(w, r, u.String(), http.StatusFound)
 	return nil
 }
@@ -85,6 +98,16 @@ func (p *Proxy) forwardedURIHeaderCallback(w http.ResponseWriter, r *http.Reques
 	redirectURLString := q.Get(urlutil.QueryRedirectURI)
 	encryptedSession := q.Get(urlutil.QuerySessionEncrypted)
 
+	if redirectURLString != "" {
+		redirectURL, err := urlutil.ParseAndValidateURL(redirectURLString)
+		if err != nil {
+			return httputil.NewError(http.StatusBadRequest, err)
+		}
+		if !p.currentOptions.Load().IsRedirectAllowed(redirectURL) {
+			return httputil.NewError(http.StatusBadRequest, errors.New("invalid redirect uri"))
+		}
+	}
+
 	if _, err := p.saveCallbackSession(w, r, encryptedSession); err != nil {
 		return httputil.NewError(http.StatusBadRequest, err)
 	}
@@ -98,10 +121,10 @@ func (p *Proxy) allowUpstream(w http.ResponseWriter, r *http.Request) error {
 	if status := r.FormValue("auth_status"); status == fmt.Sprint(http.StatusForbidden) {
 		return httputil.NewError(http.StatusForbidden, errors.New(http.StatusText(http.StatusForbidden)))
 	}
-	// in forward-auth configuration we want to treat our request headers as response headers
-	// so that they can be forwarded by the fronting proxy, if desired
-	for k, vs := range r.Header {
-		for _, v := range vs {
+	// in forward-auth configuration the identity headers added to the request by the authorize service are
+	// returned as response headers, so that they can be forwarded by the fronting proxy, if desired
+	for _, k := range p.state.Load().forwardAuthResponseHeaders {
+		if v := r.Header.Get(k); v != "" {
 			w.Header().Set(k, v)
 		}
 	}
@@ -118,14 +141,21 @@ func (p *Proxy) startAuthN(w http.ResponseWriter, r *http.Request) error {
 	state := p.state.Load()
 	uriString := r.FormValue(urlutil.QueryForwardAuthURI)
 	if uriString == "" {
+		host := httputil.FirstHeaderValue(r.Header.Get(httputil.HeaderForwardedHost))
+		if elements := httputil.ParseForwarded(r.Header.Get(httputil.HeaderForwarded)); len(elements) > 0 && elements[0].Host != "" {
+			host = elements[0].Host
+		}
 		uriString = "https://" + // always use HTTPS for external urls
-			r.Header.Get(httputil.HeaderForwardedHost) +
+			host +
 			r.Header.Get(httputil.HeaderForwardedURI)
 	}
 	uri, err := urlutil.ParseAndValidateURL(uriString)
 	if err != nil {
 		return httputil.NewError(http.StatusBadRequest, err)
 	}
+	if !p.currentOptions.Load().IsRedirectAllowed(uri) {
+		return httputil.NewError(http.StatusBadRequest, errors.New("invalid redirect uri"))
+	}
 	// add any non-empty existing path from the forwarded URI
 	if xfu := r.Header.Get(httputil.HeaderForwardedURI); xfu != "" && xfu != "/" {
 		uri.Path = xfu
@@ -46,6 +46,7 @@ func TestProxy_ForwardAuth(t *testing.T) {
 	}
 
 	opts := testOptions(t)
+	opts.RedirectAllowlist = []string{"some.domain.example"}
 	tests := []struct {
 		name     string
 		options  *config.Options
@@ -75,9 +76,12 @@ func TestProxy_ForwardAuth(t *testing.T) {
 		{"good traefik verify uri from headers", opts, nil, http.MethodGet, map[string]string{httputil.HeaderForwardedProto: "https", httputil.HeaderForwardedHost: "some.domain.example:8080"}, nil, "https://some.domain.example/", "", &mock.Encoder{}, &mstore.Store{Session: &sessions.State{Expiry: jwt.NewNumericDate(time.Now().Add(10 * time.Minute))}}, allowClient, http.StatusOK, ""},
 		{"good traefik verify uri from insecure headers", opts, nil, http.MethodGet, map[string]string{httputil.HeaderForwardedProto: "http", httputil.HeaderForwardedHost: "some.domain.example:8080"}, nil, "https://some.domain.example/", "", &mock.Encoder{}, &mstore.Store{Session: &sessions.State{Expiry: jwt.NewNumericDate(time.Now().Add(10 * time.Minute))}}, allowClient, http.StatusOK, ""},
 
+		{"bad traefik callback redirect not allowed", opts, nil, http.MethodGet, map[string]string{httputil.HeaderForwardedURI: "https://some.domain.example?" + urlutil.QueryRedirectURI + "=https://evil.example&" + urlutil.QuerySessionEncrypted + "=" + goodEncryptionString}, nil, "https://some.domain.example/", "https://some.domain.example", &mock.Encoder{}, &mstore.Store{Session: &sessions.State{Expiry: jwt.NewNumericDate(time.Now().Add(10 * time.Minute))}}, allowClient, http.StatusBadRequest, "{\"Status\":400,\"Error\":\"Bad Request: invalid redirect uri\"}\n"},
+
 		// // nginx
 		{"good nginx callback redirect", opts, nil, http.MethodGet, nil, map[string]string{urlutil.QueryRedirectURI: "https://some.domain.example/", urlutil.QuerySessionEncrypted: goodEncryptionString}, "https://some.domain.example/", "https://some.domain.example", &mock.Encoder{}, &mstore.Store{Session: &sessions.State{Expiry: jwt.NewNumericDate(time.Now().Add(10 * time.Minute))}}, allowClient, http.StatusFound, ""},
 		{"good nginx callback set session okay but return unauthorized", opts, nil, http.MethodGet, nil, map[string]string{urlutil.QueryRedirectURI: "https://some.domain.example/", urlutil.QuerySessionEncrypted: goodEncryptionString}, "https://some.domain.example/verify", "https://some.domain.example", &mock.Encoder{}, &mstore.Store{Session: &sessions.State{Expiry: jwt.NewNumericDate(time.Now().Add(10 * time.Minute))}}, allowClient, http.StatusUnauthorized, ""},
+		{"bad nginx callback redirect not allowed", opts, nil, http.MethodGet, nil, map[string]string{urlutil.QueryRedirectURI: "https://evil.example/", urlutil.QuerySessionEncrypted: goodEncryptionString}, "https://some.domain.example/", "https://some.domain.example", &mock.Encoder{}, &mstore.Store{Session: &sessions.State{Expiry: jwt.NewNumericDate(time.Now().Add(10 * time.Minute))}}, allowClient, http.StatusBadRequest, "{\"Status\":400,\"Error\":\"Bad Request: invalid redirect uri\"}\n"},
 		{"bad nginx callback failed to set session", opts, nil, http.MethodGet, nil, map[string]string{urlutil.QueryRedirectURI: "https://some.domain.example/", urlutil.QuerySessionEncrypted: goodEncryptionString + "nope"}, "https://some.domain.example/verify", "https://some.domain.example", &mock.Encoder{}, &mstore.Store{Session: &sessions.State{Expiry: jwt.NewNumericDate(time.Now().Add(10 * time.Minute))}}, allowClient, http.StatusBadRequest, ""},
 	}
 	for _, tt := range tests {
@@ -137,3 +141,34 @@ func TestProxy_ForwardAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestProxy_ForwardAuthResponseHeaders(t *testing.T) {
+	opts := testOptions(t)
+	opts.JWTClaimsHeaders = config.NewJWTClaimHeaders("email")
+	p, err := New(&config.Config{Options: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "https://some.domain.example/verify?uri=https://some.domain.example", nil)
+	r.Header.Set(httputil.HeaderPomeriumJWTAssertion, "JWT")
+	r.Header.Set("X-Pomerium-Claim-Email", "user@example.com")
+	r.Header.Set("X-Pomerium-Claim-Groups", "")
+	r.Header.Set("Cookie", "session=SECRET")
+	w := httptest.NewRecorder()
+	p.registerFwdAuthHandlers().ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code: got %v want %v", w.Code, http.StatusOK)
+	}
+	for k, want := range map[string]string{
+		"X-Pomerium-Jwt-Assertion": "JWT",
+		"X-Pomerium-Claim-Email":   "user@example.com",
+		"X-Pomerium-Claim-Groups":  "",
+		"Cookie":                   "",
+	} {
+		if got := w.Header().Get(k); got != want {
+			t.Errorf("header %s: got %q want %q", k, got, want)
+		}
+	}
+}
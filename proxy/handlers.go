@@ -11,9 +11,12 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/middleware"
+	"github.com/pomerium/pomerium/internal/sessions"
 	"github.com/pomerium/pomerium/internal/urlutil"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
 )
 
 // registerDashboardHandlers returns the proxy service's ServeMux
@@ -25,6 +28,8 @@ func (p *Proxy) registerDashboardHandlers(r *mux.Router) *mux.Router {
 	h.Path("/").HandlerFunc(p.userInfo).Methods(http.MethodGet)
 	h.Path("/sign_out").Handler(httputil.HandlerFunc(p.SignOut)).Methods(http.MethodGet, http.MethodPost)
 	h.Path("/jwt").Handler(httputil.HandlerFunc(p.jwtAssertion)).Methods(http.MethodGet)
+	h.Path("/userinfo").Handler(httputil.HandlerFunc(p.userInfoJSON)).Methods(http.MethodGet, http.MethodOptions)
+	h.Path("/revoke_session").Handler(httputil.HandlerFunc(p.RevokeSession)).Methods(http.MethodPost)
 
 	// called following authenticate auth flow to grab a new or existing session
 	// the route specific cookie is returned in a signed query params
@@ -44,6 +49,47 @@ func (p *Proxy) registerDashboardHandlers(r *mux.Router) *mux.Router {
 	return r
 }
 
+// registerWellKnownHandlers registers the discovery endpoints used by upstream applications to verify the
+// JWT assertion header.
+func (p *Proxy) registerWellKnownHandlers(r *mux.Router) *mux.Router {
+	wk := r.PathPrefix("/.well-known/pomerium").Subrouter()
+	wk.Path("/jwks.json").Handler(httputil.HandlerFunc(p.jwks)).Methods(http.MethodGet)
+	wk.Path("/").Handler(httputil.HandlerFunc(p.wellKnown)).Methods(http.MethodGet)
+	return r
+}
+
+// wellKnown returns the issuer and the urls used to verify the JWT assertion header, relative to the route's
+// domain.
+func (p *Proxy) wellKnown(w http.ResponseWriter, r *http.Request) error {
+	state := p.state.Load()
+	routeURL := &url.URL{Scheme: "https", Host: r.Host}
+	wellKnownURLs := struct {
+		Issuer                 string   `json:"issuer"`
+		JSONWebKeySetURL       string   `json:"jwks_uri"`                         // RFC7517
+		SigningAlgorithms      []string `json:"jwt_signing_alg_values_supported"` // RFC8414
+		JWTAssertionHeader     string   `json:"jwt_assertion_header"`
+		OAuth2Callback         string   `json:"authentication_callback_endpoint"`
+		FrontchannelLogoutURI  string   `json:"frontchannel_logout_uri"` // https://openid.net/specs/openid-connect-frontchannel-1_0.html
+		AuthenticateServiceURL string   `json:"authenticate_service_url"`
+	}{
+		Issuer:                 state.authenticateURL.Host,
+		JSONWebKeySetURL:       routeURL.ResolveReference(&url.URL{Path: "/.well-known/pomerium/jwks.json"}).String(),
+		SigningAlgorithms:      state.signingKeyAlgorithms,
+		JWTAssertionHeader:     httputil.HeaderPomeriumJWTAssertion,
+		OAuth2Callback:         routeURL.ResolveReference(&url.URL{Path: dashboardPath + "/callback/"}).String(),
+		FrontchannelLogoutURI:  routeURL.ResolveReference(&url.URL{Path: dashboardPath + "/sign_out"}).String(),
+		AuthenticateServiceURL: state.authenticateURL.String(),
+	}
+	httputil.RenderJSON(w, http.StatusOK, wellKnownURLs)
+	return nil
+}
+
+// jwks returns the public keys which verify the JWT assertion header.
+func (p *Proxy) jwks(w http.ResponseWriter, r *http.Request) error {
+	httputil.RenderJSON(w, http.StatusOK, p.state.Load().jwks)
+	return nil
+}
+
 // RobotsTxt sets the User-Agent header in the response to be "Disallow"
 func (p *Proxy) RobotsTxt(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -56,9 +102,10 @@ func (p *Proxy) RobotsTxt(w http.ResponseWriter, _ *http.Request) {
 // the authenticate service's session state.
 func (p *Proxy) SignOut(w http.ResponseWriter, r *http.Request) error {
 	state := p.state.Load()
+	options := p.currentOptions.Load()
 
 	var redirectURL *url.URL
-	signOutURL, err := p.currentOptions.Load().GetSignOutRedirectURL()
+	signOutURL, err := options.GetSignOutRedirectURL()
 	if err != nil {
 		return httputil.NewError(http.StatusInternalServerError, err)
 	}
@@ -66,6 +113,9 @@ func (p *Proxy) SignOut(w http.ResponseWriter, r *http.Request) error {
 		redirectURL = signOutURL
 	}
 	if uri, err := urlutil.ParseAndValidateURL(r.FormValue(urlutil.QueryRedirectURI)); err == nil && uri.String() != "" {
+		if !options.IsRedirectAllowed(uri) {
+			return httputil.NewError(http.StatusBadRequest, errors.New("invalid redirect uri"))
+		}
 		redirectURL = uri
 	}
 
@@ -81,12 +131,52 @@ func (p *Proxy) SignOut(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// RevokeSession deletes the current session from the databroker and clears the local session. Envoy calls
+// it when an upstream responds with the X-Pomerium-Revoke-Session header on a route which allows it.
+func (p *Proxy) RevokeSession(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	state := p.state.Load()
+
+	var rawJWT string
+	err := sessions.ErrNoSessionFound
+	for _, loader := range state.sessionLoaders {
+		rawJWT, err = loader.LoadSession(r)
+		if !errors.Is(err, sessions.ErrNoSessionFound) {
+			break
+		}
+	}
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+
+	var s sessions.State
+	if err := state.encoder.Unmarshal([]byte(rawJWT), &s); err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+
+	if err := session.Delete(ctx, state.dataBrokerClient, s.ID); err != nil {
+		return httputil.NewError(http.StatusInternalServerError, err)
+	}
+	state.sessionStore.ClearSession(w, r)
+
+	log.Info(ctx).
+		Str("service", "proxy").
+		Str("host", r.Host).
+		Str("session-id", s.ID).
+		Str("subject", s.Subject).
+		Msg("proxy: session revoked by upstream")
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 func (p *Proxy) userInfo(w http.ResponseWriter, r *http.Request) {
 	state := p.state.Load()
 
 	redirectURL := urlutil.GetAbsoluteURL(r).String()
-	if ref := r.Header.Get(httputil.HeaderReferrer); ref != "" {
-		redirectURL = ref
+	if ref, err := urlutil.ParseAndValidateURL(r.Header.Get(httputil.HeaderReferrer)); err == nil &&
+		p.currentOptions.Load().IsRedirectAllowed(ref) {
+		redirectURL = ref.String()
 	}
 
 	uri := state.authenticateDashboardURL.ResolveReference(&url.URL{
@@ -72,6 +72,7 @@ func New(cfg *config.Config) (*Proxy, error) {
 		state:          newAtomicProxyState(state),
 		currentOptions: config.NewAtomicOptions(),
 	}
+	p.currentOptions.Store(cfg.Options)
 	p.currentRouter.Store(httputil.NewRouter())
 
 	metrics.AddPolicyCountCallback("pomerium-proxy", func() int64 {
@@ -111,6 +112,7 @@ func (p *Proxy) setHandlers(opts *config.Options) error {
 	r.HandleFunc("/robots.txt", p.RobotsTxt).Methods(http.MethodGet)
 	// dashboard handlers are registered to all routes
 	r = p.registerDashboardHandlers(r)
+	r = p.registerWellKnownHandlers(r)
 
 	forwardAuthURL, err := opts.GetForwardAuthURL()
 	if err != nil {
@@ -1,12 +1,17 @@
 package proxy
 
 import (
+	"context"
 	"crypto/cipher"
 	"encoding/base64"
+	"fmt"
+	"net/http"
 	"net/url"
 	"sync/atomic"
 	"time"
 
+	"github.com/go-jose/go-jose/v3"
+
 	"github.com/pomerium/pomerium/config"
 	"github.com/pomerium/pomerium/internal/encoding"
 	"github.com/pomerium/pomerium/internal/encoding/jws"
@@ -16,6 +21,8 @@ import (
 	"github.com/pomerium/pomerium/internal/sessions/header"
 	"github.com/pomerium/pomerium/internal/sessions/queryparam"
 	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 )
 
 type proxyState struct {
@@ -34,7 +41,13 @@ type proxyState struct {
 	sessionLoaders  []sessions.SessionLoader
 	jwtClaimHeaders config.JWTClaimHeaders
 
+	dataBrokerClient databroker.DataBrokerServiceClient
+
+	jwks                 *jose.JSONWebKeySet
+	signingKeyAlgorithms []string
+
 	programmaticRedirectDomainWhitelist []string
+	forwardAuthResponseHeaders          []string
 }
 
 func newProxyStateFromConfig(cfg *config.Config) (*proxyState, error) {
@@ -78,14 +91,9 @@ func newProxyStateFromConfig(cfg *config.Config) (*proxyState, error) {
 	state.authenticateSigninURL = state.authenticateURL.ResolveReference(&url.URL{Path: signinURL})
 	state.authenticateRefreshURL = state.authenticateURL.ResolveReference(&url.URL{Path: refreshURL})
 
-	state.sessionStore, err = cookie.NewStore(func() cookie.Options {
-		return cookie.Options{
-			Name:     cfg.Options.CookieName,
-			Domain:   cfg.Options.CookieDomain,
-			Secure:   cfg.Options.CookieSecure,
-			HTTPOnly: cfg.Options.CookieHTTPOnly,
-			Expire:   cfg.Options.CookieExpire,
-		}
+	// the session cookie is set on the domains of the routes, which may customize it
+	state.sessionStore, err = cookie.NewRequestStore(func(r *http.Request) cookie.Options {
+		return cfg.Options.GetCookieOptionsForHost(r.Host)
 	}, state.encoder)
 	if err != nil {
 		return nil, err
@@ -96,6 +104,56 @@ func newProxyStateFromConfig(cfg *config.Config) (*proxyState, error) {
 		queryparam.NewStore(state.encoder, "pomerium_session"),
 	}
 	state.programmaticRedirectDomainWhitelist = cfg.Options.ProgrammaticRedirectDomainWhitelist
+	state.forwardAuthResponseHeaders = cfg.Options.GetForwardAuthResponseHeaders()
+
+	state.jwks, err = cfg.Options.GetPublicJWKS()
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	for _, key := range state.jwks.Keys {
+		if !containsString(state.signingKeyAlgorithms, key.Algorithm) {
+			state.signingKeyAlgorithms = append(state.signingKeyAlgorithms, key.Algorithm)
+		}
+	}
+	if len(state.signingKeyAlgorithms) == 0 {
+		state.signingKeyAlgorithms = []string{string(cfg.Options.GetSigningKeyAlgorithm())}
+	}
+
+	urls, err := cfg.Options.GetDataBrokerURLs()
+	if err != nil {
+		return nil, err
+	}
+
+	clientCert, err := cfg.Options.GetGRPCClientCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	cc, err := grpc.GetGRPCClientConn(context.Background(), "databroker", &grpc.Options{
+		Addrs:                   urls,
+		OverrideCertificateName: cfg.Options.OverrideCertificateName,
+		CA:                      cfg.Options.CA,
+		CAFile:                  cfg.Options.CAFile,
+		ClientCertificate:       clientCert,
+		SPIREAgentSocket:        cfg.Options.SPIREAgentSocket,
+		InternalCA:              cfg.Options.GetInternalCA(),
+		RequestTimeout:          cfg.Options.GRPCClientTimeout,
+		ClientDNSRoundRobin:     cfg.Options.GRPCClientDNSRoundRobin,
+		PoolSize:                cfg.Options.GRPCClientPoolSize,
+		KeepaliveTime:           cfg.Options.GRPCClientKeepaliveTime,
+		KeepaliveTimeout:        cfg.Options.GRPCClientKeepaliveTimeout,
+		BackoffMaxDelay:         cfg.Options.GRPCClientBackoffMaxDelay,
+		CircuitBreakerThreshold: cfg.Options.GRPCClientCircuitBreakerThreshold,
+		CircuitBreakerTimeout:   cfg.Options.GRPCClientCircuitBreakerTimeout,
+		WithInsecure:            cfg.Options.GetGRPCInsecure(),
+		InstallationID:          cfg.Options.InstallationID,
+		ServiceName:             cfg.Options.Services,
+		SignedJWTKey:            state.sharedKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("proxy: error creating databroker connection: %w", err)
+	}
+	state.dataBrokerClient = databroker.NewDataBrokerServiceClient(cc)
 
 	return state, nil
 }
@@ -117,3 +175,12 @@ func (aps *atomicProxyState) Load() *proxyState {
 func (aps *atomicProxyState) Store(state *proxyState) {
 	aps.value.Store(state)
 }
+
+func containsString(xs []string, x string) bool {
+	for _, s := range xs {
+		if s == x {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-jose/go-jose/v3/jwt"
+
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/urlutil"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+// userInfoResponse is the JSON body returned by the userinfo endpoint.
+type userInfoResponse struct {
+	Subject   string   `json:"sub"`
+	User      string   `json:"user,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Groups    []string `json:"groups"`
+	SessionID string   `json:"session_id,omitempty"`
+
+	Impersonating     bool     `json:"impersonating"`
+	ImpersonateEmail  string   `json:"impersonate_email,omitempty"`
+	ImpersonateGroups []string `json:"impersonate_groups,omitempty"`
+
+	IssuedAt  *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// userInfoJSON returns the identity of the current session as JSON, so that frontends can render it without
+// parsing the JWT assertion themselves. The route is protected by ext_authz, so the JWT assertion header has
+// been set by the authorize service.
+func (p *Proxy) userInfoJSON(w http.ResponseWriter, r *http.Request) error {
+	p.setUserInfoCORSHeaders(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	assertionJWT := r.Header.Get(httputil.HeaderPomeriumJWTAssertion)
+	if assertionJWT == "" {
+		return httputil.NewError(http.StatusUnauthorized, errors.New("jwt not found"))
+	}
+	tok, err := jwt.ParseSigned(assertionJWT)
+	if err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+	var claims struct {
+		jwt.Claims
+		User   string   `json:"user"`
+		Email  string   `json:"email"`
+		Groups []string `json:"groups"`
+	}
+	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return httputil.NewError(http.StatusBadRequest, err)
+	}
+
+	res := userInfoResponse{
+		Subject:   claims.Subject,
+		User:      claims.User,
+		Email:     claims.Email,
+		Groups:    claims.Groups,
+		SessionID: claims.ID,
+	}
+	if res.Groups == nil {
+		res.Groups = []string{}
+	}
+	if claims.IssuedAt != nil {
+		t := claims.IssuedAt.Time()
+		res.IssuedAt = &t
+	}
+	if claims.Expiry != nil {
+		t := claims.Expiry.Time()
+		res.ExpiresAt = &t
+	}
+
+	// the impersonation state and the real expiry are only stored on the session
+	if claims.ID != "" {
+		s, err := session.Get(r.Context(), p.state.Load().dataBrokerClient, claims.ID)
+		if err != nil {
+			log.Warn(r.Context()).Err(err).Str("session-id", claims.ID).Msg("proxy: failed to get session for userinfo")
+		} else {
+			res.Impersonating = s.ImpersonateEmail != nil || s.ImpersonateUserId != nil || len(s.ImpersonateGroups) > 0
+			res.ImpersonateEmail = s.GetImpersonateEmail()
+			res.ImpersonateGroups = s.GetImpersonateGroups()
+			if s.GetIssuedAt() != nil {
+				t := s.GetIssuedAt().AsTime()
+				res.IssuedAt = &t
+			}
+			if s.GetExpiresAt() != nil {
+				t := s.GetExpiresAt().AsTime()
+				res.ExpiresAt = &t
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.RenderJSON(w, http.StatusOK, res)
+	return nil
+}
+
+// setUserInfoCORSHeaders allows single page apps served from the domains pomerium manages to call the userinfo
+// endpoint with credentials.
+func (p *Proxy) setUserInfoCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	originURL, err := urlutil.ParseAndValidateURL(origin)
+	if err != nil || !p.currentOptions.Load().IsRedirectAllowed(originURL) {
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+		w.Header().Set("Access-Control-Max-Age", "600")
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/pomerium/pomerium/config"
+	"github.com/pomerium/pomerium/internal/httputil"
+	"github.com/pomerium/pomerium/pkg/cryptutil"
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+	"github.com/pomerium/pomerium/pkg/grpc/session"
+)
+
+func TestProxy_userInfoJSON(t *testing.T) {
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	dataBrokerClient := mockDataBrokerServiceClient{
+		get: func(ctx context.Context, in *databroker.GetRequest, opts ...grpc.CallOption) (*databroker.GetResponse, error) {
+			if in.GetId() != "SESSION_ID" {
+				return nil, status.Error(codes.NotFound, "not found")
+			}
+			data, _ := anypb.New(&session.Session{
+				Id:               "SESSION_ID",
+				UserId:           "USER_ID",
+				ExpiresAt:        timestamppb.New(expiresAt),
+				ImpersonateEmail: proto.String("other@example.com"),
+			})
+			return &databroker.GetResponse{Record: &databroker.Record{Id: in.GetId(), Type: data.GetTypeUrl(), Data: data}}, nil
+		},
+	}
+
+	opts := testOptions(t)
+	p := &Proxy{
+		state:          newAtomicProxyState(&proxyState{dataBrokerClient: dataBrokerClient}),
+		currentOptions: config.NewAtomicOptions(),
+	}
+	p.currentOptions.Store(opts)
+
+	sign := func(claims interface{}) string {
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: cryptutil.NewKey()}, nil)
+		require.NoError(t, err)
+		rawJWT, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+		require.NoError(t, err)
+		return rawJWT
+	}
+
+	t.Run("session", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "https://corp.example.example/.pomerium/userinfo", nil)
+		r.Header.Set(httputil.HeaderPomeriumJWTAssertion, sign(map[string]interface{}{
+			"sub":    "USER_ID",
+			"jti":    "SESSION_ID",
+			"email":  "other@example.com",
+			"groups": []string{"admins"},
+		}))
+		r.Header.Set("Origin", "https://corp.example.example")
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(p.userInfoJSON).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://corp.example.example", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.JSONEq(t, `{
+			"sub": "USER_ID",
+			"email": "other@example.com",
+			"groups": ["admins"],
+			"session_id": "SESSION_ID",
+			"impersonating": true,
+			"impersonate_email": "other@example.com",
+			"expires_at": "2030-01-02T03:04:05Z"
+		}`, w.Body.String())
+	})
+	t.Run("service account", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "https://corp.example.example/.pomerium/userinfo", nil)
+		r.Header.Set(httputil.HeaderPomeriumJWTAssertion, sign(map[string]interface{}{
+			"sub": "SERVICE_ACCOUNT",
+			"exp": expiresAt.Unix(),
+		}))
+		r.Header.Set("Origin", "https://evil.example")
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(p.userInfoJSON).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.JSONEq(t, `{
+			"sub": "SERVICE_ACCOUNT",
+			"groups": [],
+			"impersonating": false,
+			"expires_at": "2030-01-02T03:04:05Z"
+		}`, w.Body.String())
+	})
+	t.Run("preflight", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodOptions, "https://corp.example.example/.pomerium/userinfo", nil)
+		r.Header.Set("Origin", "https://corp.example.example")
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(p.userInfoJSON).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "GET, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+	})
+	t.Run("missing jwt", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "https://corp.example.example/.pomerium/userinfo", nil)
+		w := httptest.NewRecorder()
+		httputil.HandlerFunc(p.userInfoJSON).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}